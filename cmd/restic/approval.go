@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/approval"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// requireApproval enforces the approval policy of the repository for the
+// operation described by want. If a matching request was approved by two
+// admins, it is returned and must be consumed using consumeApproval once the
+// operation was carried out. Otherwise, a new request signed with the signing
+// key is stored in the repository and an error is returned. Without a policy,
+// requireApproval returns nil.
+func requireApproval(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, want *approval.Request) (*approval.Request, error) {
+	policy := repo.Config().ApprovalPolicy
+	if policy == nil {
+		return nil, nil
+	}
+
+	requests, err := approval.Load(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if req := approval.Find(requests, policy, want); req != nil {
+		id := req.ID()
+		Verbosef("%v was approved by request %v\n", want.Operation, id.Str())
+		return req, nil
+	}
+
+	now := time.Now()
+	for _, req := range requests {
+		if req.Matches(want) && now.Before(req.Expires) {
+			id := req.ID()
+			return nil, errors.Fatalf("%v is waiting for approval, a second admin must run `restic approval approve %v` before %v",
+				want.Operation, id.Str(), req.Expires.Local().Format(TimeFormat))
+		}
+	}
+
+	key, err := loadSigningKey(gopts.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errors.Fatalf("%v requires the approval of two admins, use --signing-key with an admin key to request it", want.Operation)
+	}
+
+	err = approval.RemoveExpired(ctx, repo, requests, now)
+	if err != nil {
+		return nil, fmt.Errorf("removing expired approval requests failed: %w", err)
+	}
+	id, err := approval.Create(ctx, repo, policy, want, key)
+	if err != nil {
+		return nil, errors.Fatalf("unable to request approval: %v", err)
+	}
+	return nil, errors.Fatalf("%v requires the approval of two admins, created request %v\n"+
+		"A second admin must run `restic approval approve %v` before %v, then run this command again.",
+		want.Operation, id.Str(), id.Str(), want.Expires.Local().Format(TimeFormat))
+}
+
+// approveSnapshotRemoval enforces the approval policy of the repository for
+// removing the snapshots ids by operation. The removal requires approval if,
+// together with the snapshots already removed without approval within the
+// approval window, it exceeds the forget threshold of the policy. This
+// applies to all commands which remove snapshots, such that the threshold
+// cannot be bypassed by several smaller runs or by using a different command.
+func approveSnapshotRemoval(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, operation string, ids restic.IDs) (*approval.Request, error) {
+	policy := repo.Config().ApprovalPolicy
+	if policy == nil || len(ids) == 0 {
+		return nil, nil
+	}
+
+	window := policy.ApprovalWindow()
+	removed, err := removedSince(ctx, repo, time.Now().Add(-window))
+	if err != nil {
+		return nil, err
+	}
+	if removed+uint(len(ids)) <= policy.ForgetThreshold {
+		return nil, nil
+	}
+	if removed > 0 {
+		Verbosef("%d snapshots were already removed without approval within the last %v\n", removed, window)
+	}
+	return requireApproval(ctx, repo, gopts, &approval.Request{Operation: operation, Snapshots: ids})
+}
+
+// approvalID returns the ID of the approved request req which is stored in
+// the operation log, it is nil if no approval was necessary.
+func approvalID(req *approval.Request) *restic.ID {
+	if req == nil {
+		return nil
+	}
+	id := req.ID()
+	return &id
+}
+
+// consumeApproval removes an approved request after the operation was carried
+// out, such that it cannot be used again.
+func consumeApproval(ctx context.Context, repo *repository.Repository, req *approval.Request) error {
+	if req == nil {
+		return nil
+	}
+	err := approval.Remove(ctx, repo, req)
+	if err != nil {
+		return fmt.Errorf("unable to remove approved request %v: %w", req.ID(), err)
+	}
+	return nil
+}
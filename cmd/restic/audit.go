@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/restic/restic/internal/audit"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// auditLogger records security-relevant events if --audit-log is set.
+var auditLogger *audit.Logger
+
+// auditRepository is the repository location reported in audit events.
+var auditRepository string
+
+// setupAudit opens the audit log.
+func setupAudit(gopts GlobalOptions, command string) error {
+	if gopts.AuditLog == "" {
+		return nil
+	}
+
+	format := audit.CEF
+	if gopts.AuditFormat != "" {
+		f, err := audit.ParseFormat(gopts.AuditFormat)
+		if err != nil {
+			return errors.Fatalf("%v", err)
+		}
+		format = f
+	}
+
+	l, err := audit.Open(gopts.AuditLog, format, version, command)
+	if err != nil {
+		return errors.Fatalf("%v", err)
+	}
+	auditLogger = l
+
+	auditRepository = gopts.Repo
+	if auditRepository == "" {
+		auditRepository = gopts.RepositoryFile
+	}
+	auditRepository = location.StripPassword(gopts.backends, auditRepository)
+	return nil
+}
+
+// auditEvent records ev in the audit log. The time, the user and host running
+// restic and the repository are filled in automatically.
+func auditEvent(ev audit.Event) {
+	if auditLogger == nil {
+		return
+	}
+
+	ev.Time = time.Now()
+	if ev.Outcome == "" {
+		ev.Outcome = audit.Success
+	}
+	if usr, err := user.Current(); err == nil {
+		ev.User = usr.Username
+	}
+	ev.Host, _ = os.Hostname()
+	ev.Repository = auditRepository
+
+	err := auditLogger.Log(ev)
+	if err != nil {
+		Warningf("unable to write audit event: %v\n", err)
+	}
+}
+
+// closeAudit closes the audit log.
+func closeAudit() {
+	if auditLogger == nil {
+		return
+	}
+
+	l := auditLogger
+	auditLogger = nil
+	err := l.Close()
+	if err != nil {
+		debug.Log("unable to close audit log: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/ui"
+)
+
+// lowFreeSpaceRatio is the fraction of the backend storage below which
+// commands which add data to the repository warn about the free space.
+const lowFreeSpaceRatio = 0.05
+
+// repoCapacity returns the capacity of the storage used by repo, or nil if the
+// backend cannot determine it.
+func repoCapacity(ctx context.Context, repo *repository.Repository) *backend.Capacity {
+	capacity, ok, err := repo.Capacity(ctx)
+	if err != nil {
+		debug.Log("unable to determine the free space of the backend: %v", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	return &capacity
+}
+
+// lowFreeSpace returns a warning if less than lowFreeSpaceRatio of the storage
+// is free, otherwise an empty string.
+func lowFreeSpace(capacity backend.Capacity) string {
+	if capacity.Total == 0 || float64(capacity.Free) >= lowFreeSpaceRatio*float64(capacity.Total) {
+		return ""
+	}
+	return "only " + formatCapacity(capacity) + " are free in the repository storage"
+}
+
+// formatCapacity returns the free and total space as a human readable string.
+func formatCapacity(capacity backend.Capacity) string {
+	if capacity.Total == 0 {
+		return ui.FormatBytes(capacity.Free)
+	}
+	return ui.FormatBytes(capacity.Free) + " of " + ui.FormatBytes(capacity.Total) +
+		" (" + ui.FormatPercent(capacity.Free, capacity.Total) + ")"
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/backend/cache"
+	"github.com/restic/restic/internal/catalog"
+	"github.com/restic/restic/internal/repository"
+	"github.com/spf13/pflag"
+)
+
+// catalogOptions selects the directory containing the file catalogs.
+type catalogOptions struct {
+	CatalogDir string
+}
+
+func initCatalogOptions(f *pflag.FlagSet, opts *catalogOptions) {
+	f.StringVar(&opts.CatalogDir, "catalog-dir", os.Getenv("RESTIC_CATALOG_DIR"), "`directory` containing the file catalogs (default: $RESTIC_CATALOG_DIR or a \"catalog\" directory in the cache directory)")
+}
+
+// catalogDir returns the directory of the catalog of repo. Each repository
+// uses its own subdirectory named after the repository ID.
+func (opts catalogOptions) catalogDir(gopts GlobalOptions, repo *repository.Repository) (string, error) {
+	dir := opts.CatalogDir
+	if dir == "" {
+		dir = gopts.CacheDir
+		if dir == "" {
+			var err error
+			dir, err = cache.DefaultDir()
+			if err != nil {
+				return "", err
+			}
+		}
+		dir = filepath.Join(dir, "catalog")
+	}
+	return filepath.Join(dir, repo.Config().ID), nil
+}
+
+func (opts catalogOptions) openCatalog(gopts GlobalOptions, repo *repository.Repository) (*catalog.Catalog, error) {
+	dir, err := opts.catalogDir(gopts, repo)
+	if err != nil {
+		return nil, err
+	}
+	return catalog.Open(dir)
+}
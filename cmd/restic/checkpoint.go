@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+)
+
+// ErrCheckpoint is returned by backup and restore if they were interrupted by
+// a checkpoint signal after saving their progress.
+var ErrCheckpoint = errors.New("interrupted, progress was saved and the command can be run again to resume")
+
+// checkpointToken records a backup or restore interrupted by a checkpoint
+// signal. It is stored in the cache directory of the repository and removed
+// once the same backup or restore completes.
+type checkpointToken struct {
+	Operation string    `json:"operation"`
+	Time      time.Time `json:"time"`
+	Hostname  string    `json:"hostname,omitempty"`
+	Paths     []string  `json:"paths,omitempty"`
+	Snapshot  string    `json:"snapshot,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Files     uint64    `json:"files"`
+	Bytes     uint64    `json:"bytes"`
+}
+
+// checkpointRequested returns whether ch was closed.
+func checkpointRequested(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// filename returns the file name of the token in the cache directory. It only
+// depends on the fields identifying the operation.
+func (t *checkpointToken) filename(repo *repository.Repository) string {
+	if repo.Cache() == nil {
+		return ""
+	}
+	key := append([]string{t.Operation, t.Hostname, t.Snapshot, t.Target}, t.Paths...)
+	h := sha256.Sum256([]byte(strings.Join(key, "\x00")))
+	return filepath.Join(repo.Cache().Path(), "checkpoints", hex.EncodeToString(h[:8])+".json")
+}
+
+// load returns the token saved for the same operation, or nil if there is
+// none.
+func (t *checkpointToken) load(repo *repository.Repository) *checkpointToken {
+	filename := t.filename(repo)
+	if filename == "" {
+		return nil
+	}
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	var saved checkpointToken
+	if err := json.Unmarshal(buf, &saved); err != nil {
+		debug.Log("ignoring invalid checkpoint token %v: %v", filename, err)
+		return nil
+	}
+	return &saved
+}
+
+// save stores the token in the cache directory. Without a cache, the token is
+// not recorded.
+func (t *checkpointToken) save(repo *repository.Repository) error {
+	filename := t.filename(repo)
+	if filename == "" {
+		return nil
+	}
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf, 0600)
+}
+
+// remove deletes the token saved for the same operation.
+func (t *checkpointToken) remove(repo *repository.Repository) {
+	filename := t.filename(repo)
+	if filename == "" {
+		return
+	}
+	if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		debug.Log("unable to remove checkpoint token %v: %v", filename, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/restic/restic/internal/debug"
@@ -14,14 +15,74 @@ func createGlobalContext() context.Context {
 
 	ch := make(chan os.Signal, 1)
 	go cleanupHandler(ch, cancel)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(ch, append([]os.Signal{syscall.SIGINT}, checkpointSignals...)...)
 
 	return ctx
 }
 
-// cleanupHandler handles the SIGINT and SIGTERM signals.
+// checkpoint is closed when a checkpoint signal is received while a backup or
+// restore is running, see registerCheckpoint.
+var checkpoint struct {
+	sync.Mutex
+	ch        chan struct{}
+	active    int
+	requested bool
+}
+
+// registerCheckpoint returns a channel which is closed when one of the
+// checkpointSignals is received. The command should then save its progress
+// and exit. The function done must be called once the command has finished,
+// afterwards the signals cancel the global context again.
+func registerCheckpoint() (ch <-chan struct{}, done func()) {
+	checkpoint.Lock()
+	defer checkpoint.Unlock()
+
+	if checkpoint.ch == nil {
+		checkpoint.ch = make(chan struct{})
+	}
+	checkpoint.active++
+
+	return checkpoint.ch, func() {
+		checkpoint.Lock()
+		defer checkpoint.Unlock()
+		checkpoint.active--
+	}
+}
+
+// requestCheckpoint closes the checkpoint channel. It returns false if no
+// command handles the request.
+func requestCheckpoint() bool {
+	checkpoint.Lock()
+	defer checkpoint.Unlock()
+
+	if checkpoint.active == 0 || checkpoint.requested {
+		return false
+	}
+	checkpoint.requested = true
+	close(checkpoint.ch)
+	return true
+}
+
+func isCheckpointSignal(s os.Signal) bool {
+	for _, cs := range checkpointSignals {
+		if s == cs {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupHandler handles the SIGINT and SIGTERM signals. The first checkpoint
+// signal lets a running backup or restore save its progress, any further
+// signal cancels the command immediately.
 func cleanupHandler(c <-chan os.Signal, cancel context.CancelFunc) {
 	s := <-c
+	if isCheckpointSignal(s) && requestCheckpoint() {
+		debug.Log("signal %v received, saving checkpoint", s)
+		Warnf("%ssignal %v received, saving checkpoint (send the signal again to abort immediately)\n", clearLine(0), s)
+		s = <-c
+	}
+
 	debug.Log("signal %v received, cleaning up", s)
 	Warnf("%ssignal %v received, cleaning up\n", clearLine(0), s)
 
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// checkpointSignals let a running backup or restore save its progress before
+// exiting. SIGPWR is sent by some UPS daemons before the system shuts down.
+var checkpointSignals = []os.Signal{syscall.SIGTERM, syscall.SIGPWR}
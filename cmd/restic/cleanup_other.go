@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// checkpointSignals let a running backup or restore save its progress before
+// exiting. On Windows, the Go runtime delivers the console close, logoff and
+// shutdown events as SIGTERM.
+var checkpointSignals = []os.Signal{syscall.SIGTERM}
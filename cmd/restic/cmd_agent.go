@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/restic/restic/internal/agent"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdAgent = &cobra.Command{
+	Use:   "agent [flags]",
+	Short: "Keep the repository open and serve a local API",
+	Long: `
+The "agent" command opens the repository, loads the index and keeps both in
+memory. Other programs, like graphical frontends or scripts which run many
+small jobs, can then list snapshots, browse and download files, and restore
+files using a local API without paying the cost of opening the repository and
+loading the index for each operation.
+
+The API is served via a Unix socket, or a named pipe on Windows, which only the
+current user can access. Additionally, each request must carry a random token
+as bearer token in the Authorization header. The token is written to the file
+given by --token-file when the agent starts.
+
+The repository is locked for the duration of each request, not while the agent
+is idle, so it does not block other operations like prune. The index is
+reloaded when index files were added or removed since it was loaded.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return runAgent(cmd.Context(), agentOptions, globalOptions)
+	},
+}
+
+// AgentOptions collects all options for the agent command.
+type AgentOptions struct {
+	Socket    string
+	TokenFile string
+}
+
+var agentOptions AgentOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdAgent)
+
+	flags := cmdAgent.Flags()
+	flags.StringVar(&agentOptions.Socket, "socket", agent.DefaultAddress(), "listen on the Unix socket or named pipe at `path`")
+	flags.StringVar(&agentOptions.TokenFile, "token-file", agent.DefaultTokenFile(), "write the token clients must send to `file`")
+}
+
+func runAgent(ctx context.Context, opts AgentOptions, gopts GlobalOptions) error {
+	if opts.Socket == "" || opts.TokenFile == "" {
+		return errors.Fatal("--socket and --token-file must not be empty")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	err = repo.LoadIndex(ctx, bar)
+	if err != nil {
+		return err
+	}
+
+	token, err := agent.NewToken()
+	if err != nil {
+		return err
+	}
+
+	cfg := agent.Config{Token: token}
+	if !gopts.NoLock {
+		cfg.Lock = func(ctx context.Context) (context.Context, func(), error) {
+			lock, ctx, err := repository.Lock(ctx, repo, false, gopts.RetryLock, func(msg string) {
+				debug.Log("%s", msg)
+			}, Warnf)
+			if err != nil {
+				return nil, nil, err
+			}
+			return ctx, lock.Unlock, nil
+		}
+	}
+
+	handler, err := agent.New(ctx, repo, cfg)
+	if err != nil {
+		return err
+	}
+
+	listener, err := agent.Listen(opts.Socket)
+	if err != nil {
+		return errors.Fatalf("unable to listen: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	err = agent.WriteTokenFile(opts.TokenFile, token)
+	if err != nil {
+		return errors.Fatalf("unable to write token file: %v", err)
+	}
+	defer func() { _ = os.Remove(opts.TokenFile) }()
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: time.Minute,
+	}
+
+	Printf("Agent for repository %v listening on %v\n", repo.Config().ID[:8], opts.Socket)
+	Printf("The token for requests is stored in %v\n", opts.TokenFile)
+	Printf("When finished, quit with Ctrl-c here.\n")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+		debug.Log("shutting down agent")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+		return ErrOK
+	case err := <-done:
+		return err
+	}
+}
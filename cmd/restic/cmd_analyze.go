@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
+	"github.com/restic/restic/internal/walker"
+	"github.com/spf13/cobra"
+)
+
+var cmdAnalyze = &cobra.Command{
+	Use:   "analyze [flags] [snapshot ID] [...]",
+	Short: "Analyze which backup sources share data",
+	Long: `
+The "analyze" command reports how data is deduplicated between the sources
+backing up to the repository, for example to guide the consolidation of a
+fleet of hosts. The snapshots are grouped into sources using --group-by, by
+default one source per host.
+
+For each source, the report lists the size of all data it references, the data
+only referenced by this source and the data shared with other sources. The
+shared data is an estimate of the savings when adding a similar source: if the
+source was added to the repository now, only its unique data would have to be
+uploaded.
+
+The report also lists the pairs of sources sharing the most data, and based on
+the latest snapshot of each source, the directories contributing the most
+unique data and the directories sharing the most data with other sources.
+Directories are reported up to the depth given by --depth below the root of
+the snapshot.
+
+It operates on all snapshots matching the selection criteria or all snapshots
+if nothing is specified. Sizes refer to the uncompressed data.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAnalyze(cmd.Context(), analyzeOptions, globalOptions, args)
+	},
+}
+
+// AnalyzeOptions collects all options for the analyze command.
+type AnalyzeOptions struct {
+	restic.SnapshotFilter
+	GroupBy restic.SnapshotGroupByOptions
+	Depth   int
+	Top     int
+}
+
+var analyzeOptions AnalyzeOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdAnalyze)
+
+	f := cmdAnalyze.Flags()
+	initMultiSnapshotFilter(f, &analyzeOptions.SnapshotFilter, true)
+	analyzeOptions.GroupBy = restic.SnapshotGroupByOptions{Host: true}
+	f.VarP(&analyzeOptions.GroupBy, "group-by", "g", "`group` snapshots into sources by host, paths and/or tags, separated by comma")
+	f.IntVar(&analyzeOptions.Depth, "depth", 2, "report directories up to `n` levels below the snapshot root")
+	f.IntVar(&analyzeOptions.Top, "top", 10, "list the `n` largest entries of each report")
+}
+
+// AnalyzeSource describes the data referenced by one source.
+type AnalyzeSource struct {
+	Source    string `json:"source"`
+	Snapshots int    `json:"snapshots"`
+	Size      uint64 `json:"size"`
+	Unique    uint64 `json:"unique"`
+	Shared    uint64 `json:"shared"`
+}
+
+// AnalyzeOverlap is the data shared by two sources.
+type AnalyzeOverlap struct {
+	Sources [2]string `json:"sources"`
+	Shared  uint64    `json:"shared"`
+}
+
+// AnalyzeDir describes a directory in the latest snapshot of a source.
+type AnalyzeDir struct {
+	Source string `json:"source"`
+	Path   string `json:"path"`
+	Size   uint64 `json:"size"`
+	Unique uint64 `json:"unique"`
+	// SharedWith and Shared are the source sharing the most data with the
+	// directory and the amount of data.
+	SharedWith string `json:"shared_with,omitempty"`
+	Shared     uint64 `json:"shared,omitempty"`
+}
+
+// AnalyzeReport is printed with --json.
+type AnalyzeReport struct {
+	MessageType string           `json:"message_type"` // "summary"
+	TotalSize   uint64           `json:"total_size"`
+	Sources     []AnalyzeSource  `json:"sources"`
+	Overlaps    []AnalyzeOverlap `json:"overlaps"`
+	UniqueDirs  []AnalyzeDir     `json:"unique_dirs"`
+	SharedDirs  []AnalyzeDir     `json:"shared_dirs"`
+}
+
+// sourceSets interns sets of sources, such that each blob only stores the
+// index of the set of sources referencing it.
+type sourceSets struct {
+	sets [][]int
+	next map[[2]int]int
+}
+
+func newSourceSets() *sourceSets {
+	return &sourceSets{sets: [][]int{nil}, next: make(map[[2]int]int)}
+}
+
+// add returns the index of the set containing the sources of set and source.
+func (s *sourceSets) add(set, source int) int {
+	if next, ok := s.next[[2]int{set, source}]; ok {
+		return next
+	}
+	sources := s.sets[set]
+	i := sort.SearchInts(sources, source)
+	if i < len(sources) && sources[i] == source {
+		s.next[[2]int{set, source}] = set
+		return set
+	}
+
+	added := make([]int, 0, len(sources)+1)
+	added = append(added, sources[:i]...)
+	added = append(added, source)
+	added = append(added, sources[i:]...)
+
+	// look for an existing set with the same sources
+	next := -1
+	for j, other := range s.sets {
+		if slices.Equal(other, added) {
+			next = j
+			break
+		}
+	}
+	if next < 0 {
+		next = len(s.sets)
+		s.sets = append(s.sets, added)
+	}
+	s.next[[2]int{set, source}] = next
+	return next
+}
+
+// sourceName formats the group key of a source.
+func sourceName(key restic.SnapshotGroupKey) string {
+	name := key.Hostname
+	if len(key.Paths) > 0 {
+		if name != "" {
+			name += ":"
+		}
+		name += strings.Join(key.Paths, ",")
+	}
+	if len(key.Tags) > 0 {
+		if name != "" {
+			name += " "
+		}
+		name += "[" + strings.Join(key.Tags, ",") + "]"
+	}
+	if name == "" {
+		name = "all"
+	}
+	return name
+}
+
+type analyzer struct {
+	repo    restic.Loader
+	sets    *sourceSets
+	blobs   map[restic.ID]int
+	visited map[treeSource]struct{}
+}
+
+type treeSource struct {
+	tree   restic.ID
+	source int
+}
+
+// addSnapshot records the data blobs referenced by the snapshot for source.
+func (a *analyzer) addSnapshot(ctx context.Context, sn *restic.Snapshot, source int) error {
+	if sn.Tree == nil {
+		return errors.Errorf("snapshot %v has no tree", sn.ID().Str())
+	}
+	return walker.Walk(ctx, a.repo, *sn.Tree, walker.WalkVisitor{
+		ProcessNode: func(_ restic.ID, _ string, node *restic.Node, err error) error {
+			if err != nil {
+				return err
+			}
+			if node == nil || node.Type != restic.NodeTypeFile {
+				return nil
+			}
+			for _, id := range node.Content {
+				a.blobs[id] = a.sets.add(a.blobs[id], source)
+			}
+			return nil
+		},
+		SkipTree: func(_ string, node *restic.Node) bool {
+			// the blobs of a tree were already added for the source
+			key := treeSource{*node.Subtree, source}
+			if _, ok := a.visited[key]; ok {
+				return true
+			}
+			a.visited[key] = struct{}{}
+			return false
+		},
+	})
+}
+
+// blobSize returns the uncompressed size of the data blob.
+func (a *analyzer) blobSize(id restic.ID) uint64 {
+	size, _ := a.repo.LookupBlobSize(restic.DataBlob, id)
+	return uint64(size)
+}
+
+// dirKey returns the directory at most depth levels below the root which
+// contains the file at p.
+func dirKey(p string, depth int) string {
+	parts := strings.Split(strings.Trim(path.Dir(p), "/"), "/")
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	return "/" + path.Join(parts...)
+}
+
+type analyzeDirStats struct {
+	AnalyzeDir
+	seen   restic.IDSet
+	shared map[int]uint64
+}
+
+// addDirs attributes the data of the snapshot to its directories.
+func (a *analyzer) addDirs(ctx context.Context, sn *restic.Snapshot, source int, depth int, dirs map[string]*analyzeDirStats, names []string) error {
+	return walker.Walk(ctx, a.repo, *sn.Tree, walker.WalkVisitor{
+		ProcessNode: func(_ restic.ID, nodepath string, node *restic.Node, err error) error {
+			if err != nil {
+				return err
+			}
+			if node == nil || node.Type != restic.NodeTypeFile {
+				return nil
+			}
+			key := dirKey(nodepath, depth)
+			d, ok := dirs[key]
+			if !ok {
+				d = &analyzeDirStats{
+					AnalyzeDir: AnalyzeDir{Source: names[source], Path: key},
+					seen:       restic.NewIDSet(),
+					shared:     make(map[int]uint64),
+				}
+				dirs[key] = d
+			}
+			for _, id := range node.Content {
+				if d.seen.Has(id) {
+					continue
+				}
+				d.seen.Insert(id)
+				size := a.blobSize(id)
+				d.Size += size
+				sources := a.sets.sets[a.blobs[id]]
+				if len(sources) == 1 {
+					d.Unique += size
+				}
+				for _, other := range sources {
+					if other != source {
+						d.shared[other] += size
+					}
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func runAnalyze(ctx context.Context, opts AnalyzeOptions, gopts GlobalOptions, args []string) error {
+	if opts.Depth < 0 {
+		return errors.Fatal("--depth must not be negative")
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	snapshotLister, err := restic.MemorizeList(ctx, repo, restic.SnapshotFile)
+	if err != nil {
+		return err
+	}
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	if err = repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	var snapshots restic.Snapshots
+	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, &opts.SnapshotFilter, args) {
+		snapshots = append(snapshots, sn)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	groups, _, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		var key restic.SnapshotGroupKey
+		if err := json.Unmarshal([]byte(k), &key); err != nil {
+			return err
+		}
+		names[i] = sourceName(key)
+	}
+
+	if !gopts.JSON {
+		Printf("scanning %d snapshots of %d sources...\n", len(snapshots), len(keys))
+	}
+
+	a := &analyzer{
+		repo:    repo,
+		sets:    newSourceSets(),
+		blobs:   make(map[restic.ID]int),
+		visited: make(map[treeSource]struct{}),
+	}
+	for i, k := range keys {
+		for _, sn := range groups[k] {
+			if err := a.addSnapshot(ctx, sn, i); err != nil {
+				return fmt.Errorf("error walking snapshot %v: %w", sn.ID().Str(), err)
+			}
+		}
+	}
+
+	report := analyze(a, names, groups, keys)
+
+	dirs := make(map[string]*analyzeDirStats)
+	var allDirs []*analyzeDirStats
+	for i, k := range keys {
+		sns := groups[k]
+		sort.Sort(sns)
+		latest := sns[len(sns)-1]
+		clear(dirs)
+		if err := a.addDirs(ctx, latest, i, opts.Depth, dirs, names); err != nil {
+			return fmt.Errorf("error walking snapshot %v: %w", latest.ID().Str(), err)
+		}
+		for _, d := range dirs {
+			d.seen = nil
+			for other, shared := range d.shared {
+				if shared > d.Shared || (shared == d.Shared && names[other] < d.SharedWith) {
+					d.SharedWith, d.Shared = names[other], shared
+				}
+			}
+			allDirs = append(allDirs, d)
+		}
+	}
+	report.UniqueDirs = topDirs(allDirs, opts.Top, func(d *analyzeDirStats) uint64 { return d.Unique })
+	report.SharedDirs = topDirs(allDirs, opts.Top, func(d *analyzeDirStats) uint64 { return d.Shared })
+	if opts.Top > 0 && len(report.Overlaps) > opts.Top {
+		report.Overlaps = report.Overlaps[:opts.Top]
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(report)
+	}
+	return printAnalyzeReport(report)
+}
+
+// analyze computes the size of the data per source and the overlaps between
+// sources.
+func analyze(a *analyzer, names []string, groups map[string]restic.Snapshots, keys []string) AnalyzeReport {
+	setSize := make([]uint64, len(a.sets.sets))
+	for id, set := range a.blobs {
+		setSize[set] += a.blobSize(id)
+	}
+
+	report := AnalyzeReport{MessageType: "summary"}
+	for i, k := range keys {
+		report.Sources = append(report.Sources, AnalyzeSource{Source: names[i], Snapshots: len(groups[k])})
+	}
+	overlaps := make(map[[2]int]uint64)
+	for set, sources := range a.sets.sets {
+		size := setSize[set]
+		report.TotalSize += size
+		for i, source := range sources {
+			s := &report.Sources[source]
+			s.Size += size
+			if len(sources) == 1 {
+				s.Unique += size
+			} else {
+				s.Shared += size
+			}
+			for _, other := range sources[i+1:] {
+				overlaps[[2]int{source, other}] += size
+			}
+		}
+	}
+
+	for pair, size := range overlaps {
+		if size == 0 {
+			continue
+		}
+		report.Overlaps = append(report.Overlaps, AnalyzeOverlap{Sources: [2]string{names[pair[0]], names[pair[1]]}, Shared: size})
+	}
+	sort.Slice(report.Overlaps, func(i, j int) bool {
+		if report.Overlaps[i].Shared != report.Overlaps[j].Shared {
+			return report.Overlaps[i].Shared > report.Overlaps[j].Shared
+		}
+		return report.Overlaps[i].Sources[0]+report.Overlaps[i].Sources[1] < report.Overlaps[j].Sources[0]+report.Overlaps[j].Sources[1]
+	})
+	return report
+}
+
+// topDirs returns the n directories with the largest non-zero value.
+func topDirs(dirs []*analyzeDirStats, n int, value func(*analyzeDirStats) uint64) []AnalyzeDir {
+	sorted := make([]*analyzeDirStats, 0, len(dirs))
+	for _, d := range dirs {
+		if value(d) > 0 {
+			sorted = append(sorted, d)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if value(sorted[i]) != value(sorted[j]) {
+			return value(sorted[i]) > value(sorted[j])
+		}
+		if sorted[i].Source != sorted[j].Source {
+			return sorted[i].Source < sorted[j].Source
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+	if n > 0 && len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	result := make([]AnalyzeDir, 0, len(sorted))
+	for _, d := range sorted {
+		result = append(result, d.AnalyzeDir)
+	}
+	return result
+}
+
+func percent(part, total uint64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)/float64(total)*100)
+}
+
+func printAnalyzeReport(report AnalyzeReport) error {
+	Printf("\nTotal size of referenced data: %v\n\n", ui.FormatBytes(report.TotalSize))
+
+	type row struct {
+		Source, Snapshots, Size, Unique, Shared, Savings string
+	}
+	tab := table.New()
+	tab.AddColumn("Source", "{{ .Source }}")
+	tab.AddColumn("Snapshots", "{{ .Snapshots }}")
+	tab.AddColumn("Size", "{{ .Size }}")
+	tab.AddColumn("Unique", "{{ .Unique }}")
+	tab.AddColumn("Shared", "{{ .Shared }}")
+	tab.AddColumn("Savings if added", "{{ .Savings }}")
+	for _, s := range report.Sources {
+		tab.AddRow(row{s.Source, fmt.Sprint(s.Snapshots), ui.FormatBytes(s.Size), ui.FormatBytes(s.Unique),
+			ui.FormatBytes(s.Shared), percent(s.Shared, s.Size)})
+	}
+	if err := tab.Write(globalOptions.stdout); err != nil {
+		return err
+	}
+
+	if len(report.Overlaps) > 0 {
+		Printf("\nSources sharing the most data:\n")
+		tab = table.New()
+		tab.AddColumn("Source", "{{ index . 0 }}")
+		tab.AddColumn("Source", "{{ index . 1 }}")
+		tab.AddColumn("Shared", "{{ index . 2 }}")
+		for _, o := range report.Overlaps {
+			tab.AddRow([]string{o.Sources[0], o.Sources[1], ui.FormatBytes(o.Shared)})
+		}
+		if err := tab.Write(globalOptions.stdout); err != nil {
+			return err
+		}
+	}
+
+	if len(report.UniqueDirs) > 0 {
+		Printf("\nDirectories with the most unique data:\n")
+		tab = table.New()
+		tab.AddColumn("Source", "{{ index . 0 }}")
+		tab.AddColumn("Directory", "{{ index . 1 }}")
+		tab.AddColumn("Size", "{{ index . 2 }}")
+		tab.AddColumn("Unique", "{{ index . 3 }}")
+		for _, d := range report.UniqueDirs {
+			tab.AddRow([]string{d.Source, d.Path, ui.FormatBytes(d.Size), ui.FormatBytes(d.Unique)})
+		}
+		if err := tab.Write(globalOptions.stdout); err != nil {
+			return err
+		}
+	}
+
+	if len(report.SharedDirs) > 0 {
+		Printf("\nDirectories sharing the most data with other sources:\n")
+		tab = table.New()
+		tab.AddColumn("Source", "{{ index . 0 }}")
+		tab.AddColumn("Directory", "{{ index . 1 }}")
+		tab.AddColumn("Size", "{{ index . 2 }}")
+		tab.AddColumn("Shared with", "{{ index . 3 }}")
+		tab.AddColumn("Shared", "{{ index . 4 }}")
+		for _, d := range report.SharedDirs {
+			tab.AddRow([]string{d.Source, d.Path, ui.FormatBytes(d.Size), d.SharedWith, ui.FormatBytes(d.Shared)})
+		}
+		if err := tab.Write(globalOptions.stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
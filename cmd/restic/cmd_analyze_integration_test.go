@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunAnalyze(t testing.TB, opts AnalyzeOptions, gopts GlobalOptions) AnalyzeReport {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runAnalyze(context.TODO(), opts, gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	var report AnalyzeReport
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &report))
+	return report
+}
+
+func TestAnalyze(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	shared := rtest.Random(1, 100*1024)
+	for host, size := range map[string]int{"a": 50 * 1024, "b": 30 * 1024} {
+		dir := filepath.Join(env.testdata, host)
+		rtest.OK(t, os.MkdirAll(filepath.Join(dir, "shared"), 0700))
+		rtest.OK(t, os.MkdirAll(filepath.Join(dir, "only"), 0700))
+		rtest.OK(t, os.WriteFile(filepath.Join(dir, "shared", "file"), shared, 0600))
+		rtest.OK(t, os.WriteFile(filepath.Join(dir, "only", "file"), rtest.Random(int(host[0]), size), 0600))
+		testRunBackup(t, dir, []string{"."}, BackupOptions{Host: host}, env.gopts)
+	}
+	// a second snapshot of the same data does not change the result
+	testRunBackup(t, filepath.Join(env.testdata, "a"), []string{"."}, BackupOptions{Host: "a"}, env.gopts)
+
+	report := testRunAnalyze(t, AnalyzeOptions{GroupBy: analyzeOptions.GroupBy, Depth: 1, Top: 10}, env.gopts)
+	rtest.Equals(t, uint64(180*1024), report.TotalSize)
+	rtest.Equals(t, []AnalyzeSource{
+		{Source: "a", Snapshots: 2, Size: 150 * 1024, Unique: 50 * 1024, Shared: 100 * 1024},
+		{Source: "b", Snapshots: 1, Size: 130 * 1024, Unique: 30 * 1024, Shared: 100 * 1024},
+	}, report.Sources)
+	rtest.Equals(t, []AnalyzeOverlap{{Sources: [2]string{"a", "b"}, Shared: 100 * 1024}}, report.Overlaps)
+	rtest.Equals(t, []AnalyzeDir{
+		{Source: "a", Path: "/only", Size: 50 * 1024, Unique: 50 * 1024},
+		{Source: "b", Path: "/only", Size: 30 * 1024, Unique: 30 * 1024},
+	}, report.UniqueDirs)
+	rtest.Equals(t, []AnalyzeDir{
+		{Source: "a", Path: "/shared", Size: 100 * 1024, SharedWith: "b", Shared: 100 * 1024},
+		{Source: "b", Path: "/shared", Size: 100 * 1024, SharedWith: "a", Shared: 100 * 1024},
+	}, report.SharedDirs)
+
+	buf, err := withCaptureStdout(func() error {
+		return runAnalyze(context.TODO(), AnalyzeOptions{GroupBy: analyzeOptions.GroupBy, Depth: 1, Top: 10}, env.gopts, nil)
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), "Directories sharing the most data with other sources"), "unexpected output %v", buf.String())
+}
+
+func TestSourceSets(t *testing.T) {
+	s := newSourceSets()
+	ab := s.add(s.add(0, 1), 0)
+	rtest.Equals(t, []int{0, 1}, s.sets[ab])
+	rtest.Equals(t, ab, s.add(s.add(0, 0), 1))
+	rtest.Equals(t, ab, s.add(ab, 1))
+	// the empty set, {1}, {0, 1} and {0}
+	rtest.Equals(t, 4, len(s.sets))
+}
+
+func TestDirKey(t *testing.T) {
+	rtest.Equals(t, "/home/user", dirKey("/home/user/docs/file", 2))
+	rtest.Equals(t, "/home", dirKey("/home/file", 2))
+	rtest.Equals(t, "/", dirKey("/file", 2))
+	rtest.Equals(t, "/", dirKey("/home/file", 0))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdApproval = &cobra.Command{
+	Use:   "approval",
+	Short: "Manage the two-person rule for destructive operations",
+	Long: `
+The "approval" command manages the approval policy of the repository. If a
+policy is set, removing more snapshots than allowed by its threshold using
+"forget", "rewrite" or "repair snapshots", the "rechunk" migration, removing a
+key using "key remove" or "key passwd" and changing the policy itself must be
+authorized by two distinct admins. The threshold applies to all snapshots
+removed without approval within the approval window.
+
+Admins are identified by Ed25519 signing keys, which are kept separately from
+the repository password. The first admin runs the destructive command with
+"--signing-key", which stores a signed request in the repository and exits.
+A second admin inspects the request using "approval list" and approves it using
+"approval approve" with their own signing key. Afterwards, the command is run
+again and carries out the operation. Requests expire at the end of the approval
+window of the policy.
+	`,
+	DisableAutoGenTag: true,
+	GroupID:           cmdGroupAdvanced,
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdApproval)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/restic/restic/internal/approval"
+	"github.com/restic/restic/internal/errors"
+	"github.com/spf13/cobra"
+)
+
+var cmdApprovalApprove = &cobra.Command{
+	Use:   "approve [flags] request-ID",
+	Short: "Approve a request for a destructive operation",
+	Long: `
+The "approve" sub-command countersigns a request for a destructive operation
+using the signing key given by "--signing-key". It must be an admin key of the
+approval policy and differ from the key which signed the request. Afterwards,
+the command which created the request can be run again to carry out the
+operation.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runApprovalApprove(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdApproval.AddCommand(cmdApprovalApprove)
+}
+
+func runApprovalApprove(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("approval approve expects one argument as the request ID")
+	}
+
+	key, err := loadSigningKey(gopts.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return errors.Fatal("approving a request requires an admin key, use --signing-key")
+	}
+
+	ctx, repo, unlock, err := openWithAppendLock(ctx, gopts, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	policy := repo.Config().ApprovalPolicy
+	if policy == nil {
+		return errors.Fatal("repository has no approval policy")
+	}
+
+	requests, err := approval.Load(ctx, repo)
+	if err != nil {
+		return err
+	}
+	req, err := findRequest(requests, args[0])
+	if err != nil {
+		return err
+	}
+	id := req.ID()
+
+	Verbosef("approving %v, requested by %v@%v\n", requestDetails(req), req.Username, req.Hostname)
+	err = approval.Approve(ctx, repo, policy, req, key)
+	if err != nil {
+		return errors.Fatalf("unable to approve request %v: %v", id.Str(), err)
+	}
+	Verbosef("approved request %v, it is valid until %v\n", id.Str(), req.Expires.Local().Format(TimeFormat))
+	return nil
+}
+
+// findRequest returns the request whose ID starts with prefix.
+func findRequest(requests []*approval.Request, prefix string) (*approval.Request, error) {
+	var found *approval.Request
+	for _, req := range requests {
+		if !strings.HasPrefix(req.ID().String(), prefix) {
+			continue
+		}
+		if found != nil {
+			return nil, errors.Fatalf("request ID prefix %q is ambiguous", prefix)
+		}
+		found = req
+	}
+	if found == nil {
+		return nil, errors.Fatalf("no request with ID %q found", prefix)
+	}
+	return found, nil
+}
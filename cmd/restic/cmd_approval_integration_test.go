@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunApprovalList(t testing.TB, gopts GlobalOptions) []jsonApprovalRequest {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runApprovalList(context.TODO(), gopts, nil)
+	})
+	rtest.OK(t, err)
+	var requests []jsonApprovalRequest
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &requests))
+	return requests
+}
+
+func testRunApprovalApprove(gopts GlobalOptions, keyFile string, id string) error {
+	gopts.SigningKeyFile = keyFile
+	return runApprovalApprove(context.TODO(), gopts, []string{id})
+}
+
+func TestApprovalPolicy(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	privA, pubA := testWriteSigningKeys(t, t.TempDir())
+	privB, pubB := testWriteSigningKeys(t, t.TempDir())
+
+	testSetupBackupData(t, env)
+	for i := 0; i < 3; i++ {
+		testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	}
+
+	rtest.OK(t, runApprovalPolicy(context.TODO(), ApprovalPolicyOptions{
+		AdminKeyFiles:   []string{pubA, pubB},
+		ForgetThreshold: 1,
+		Window:          restic.DefaultApprovalWindow,
+	}, env.gopts, nil))
+
+	adminA := env.gopts
+	adminA.SigningKeyFile = privA
+
+	// removing a single snapshot is below the threshold
+	testRunForget(t, env.gopts, ForgetOptions{Last: 2})
+	testListSnapshots(t, env.gopts, 2)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	// removing two snapshots requires approval
+	rtest.Assert(t, testRunForgetMayFail(env.gopts, ForgetOptions{Last: 1}) != nil, "expected forget without signing key to fail")
+	rtest.Assert(t, testRunForgetMayFail(adminA, ForgetOptions{Last: 1}) != nil, "expected forget to wait for approval")
+	testListSnapshots(t, env.gopts, 3)
+
+	requests := testRunApprovalList(t, env.gopts)
+	rtest.Equals(t, 1, len(requests))
+	rtest.Equals(t, "pending", requests[0].Status)
+	rtest.Equals(t, 2, len(requests[0].Snapshots))
+
+	id := requests[0].ID.String()
+	rtest.Assert(t, testRunApprovalApprove(env.gopts, privA, id) != nil, "expected error for approval by requester")
+	rtest.OK(t, testRunApprovalApprove(env.gopts, privB, id))
+	rtest.Equals(t, "approved", testRunApprovalList(t, env.gopts)[0].Status)
+
+	testRunForget(t, env.gopts, ForgetOptions{Last: 1})
+	testListSnapshots(t, env.gopts, 1)
+	rtest.Equals(t, 0, len(testRunApprovalList(t, env.gopts)))
+
+	// the removals without approval within the window are added up, the
+	// single snapshot removed at first uses up the threshold
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	rtest.Assert(t, testRunForgetMayFail(env.gopts, ForgetOptions{Last: 1}) != nil, "expected forget below the threshold to require approval")
+	testListSnapshots(t, env.gopts, 2)
+
+	// removing the policy requires approval as well
+	removeOpts := ApprovalPolicyOptions{Remove: true}
+	rtest.Assert(t, runApprovalPolicy(context.TODO(), removeOpts, adminA, nil) != nil, "expected removing the policy to wait for approval")
+	requests = testRunApprovalList(t, env.gopts)
+	rtest.Equals(t, 1, len(requests))
+	rtest.OK(t, testRunApprovalApprove(env.gopts, privB, requests[0].ID.String()))
+	rtest.OK(t, runApprovalPolicy(context.TODO(), removeOpts, env.gopts, nil))
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.Assert(t, repo.Config().ApprovalPolicy == nil, "policy was not removed")
+}
+
+func TestApprovalPolicyRewrite(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	privA, pubA := testWriteSigningKeys(t, t.TempDir())
+	privB, pubB := testWriteSigningKeys(t, t.TempDir())
+
+	testSetupBackupData(t, env)
+	for i := 0; i < 2; i++ {
+		testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	}
+
+	rtest.OK(t, runApprovalPolicy(context.TODO(), ApprovalPolicyOptions{
+		AdminKeyFiles:   []string{pubA, pubB},
+		ForgetThreshold: 1,
+		Window:          restic.DefaultApprovalWindow,
+	}, env.gopts, nil))
+
+	adminA := env.gopts
+	adminA.SigningKeyFile = privA
+
+	// rewrite --forget removes both original snapshots
+	opts := RewriteOptions{Forget: true, ExcludePatternOptions: filter.ExcludePatternOptions{Excludes: []string{"0"}}}
+	rtest.Assert(t, runRewrite(context.TODO(), opts, adminA, nil) != nil, "expected rewrite to wait for approval")
+	requests := testRunApprovalList(t, env.gopts)
+	rtest.Equals(t, 1, len(requests))
+	rtest.Equals(t, "rewrite", requests[0].Operation)
+	rtest.Equals(t, 2, len(requests[0].Snapshots))
+
+	rtest.OK(t, testRunApprovalApprove(env.gopts, privB, requests[0].ID.String()))
+	rtest.OK(t, runRewrite(context.TODO(), opts, env.gopts, nil))
+	testListSnapshots(t, env.gopts, 2)
+	rtest.Equals(t, 0, len(testRunApprovalList(t, env.gopts)))
+
+	// replacing the key used to access the repository removes the old key
+	err := runKeyPasswd(context.TODO(), env.gopts, KeyPasswdOptions{}, nil)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "approval"), "expected key passwd to require approval, got %v", err)
+}
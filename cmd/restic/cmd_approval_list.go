@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/approval"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/table"
+	"github.com/spf13/cobra"
+)
+
+var cmdApprovalList = &cobra.Command{
+	Use:   "list [flags]",
+	Short: "List requests for destructive operations",
+	Long: `
+The "list" sub-command lists the requests for destructive operations stored in
+the repository, together with the admin keys which signed them and their
+status. A request is "pending" until it is approved by a second admin, and
+"expired" once the approval window has passed.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runApprovalList(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdApproval.AddCommand(cmdApprovalList)
+}
+
+// jsonApprovalRequest is a request together with its ID and status.
+type jsonApprovalRequest struct {
+	*approval.Request
+	ID      restic.ID `json:"id"`
+	Signers []string  `json:"signers"`
+	Status  string    `json:"status"`
+}
+
+func runApprovalList(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the approval list command expects no arguments, only options - please see `restic help approval list` for usage and flags")
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	policy := repo.Config().ApprovalPolicy
+	if policy == nil {
+		Warnf("repository has no approval policy\n")
+		policy = &restic.ApprovalPolicy{}
+	}
+
+	requests, err := approval.Load(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if gopts.JSON {
+		list := make([]jsonApprovalRequest, 0, len(requests))
+		for _, req := range requests {
+			list = append(list, jsonApprovalRequest{
+				Request: req,
+				ID:      req.ID(),
+				Signers: req.Signers(policy),
+				Status:  requestStatus(req, policy, now),
+			})
+		}
+		return json.NewEncoder(globalOptions.stdout).Encode(list)
+	}
+
+	if len(requests) == 0 {
+		Printf("no requests found\n")
+		return nil
+	}
+
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ID }}")
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Host", "{{ .Hostname }}")
+	tab.AddColumn("User", "{{ .Username }}")
+	tab.AddColumn("Signed by", "{{ .Signers }}")
+	tab.AddColumn("Status", "{{ .Status }}")
+	tab.AddColumn("Operation", "{{ .Details }}")
+
+	type row struct {
+		ID       string
+		Time     string
+		Hostname string
+		Username string
+		Signers  string
+		Status   string
+		Details  string
+	}
+	for _, req := range requests {
+		id := req.ID()
+		tab.AddRow(row{
+			ID:       id.Str(),
+			Time:     req.Time.Local().Format(TimeFormat),
+			Hostname: req.Hostname,
+			Username: req.Username,
+			Signers:  strings.Join(req.Signers(policy), ", "),
+			Status:   requestStatus(req, policy, now),
+			Details:  requestDetails(req),
+		})
+	}
+	return tab.Write(globalOptions.stdout)
+}
+
+// requestStatus returns whether req is approved, pending or expired.
+func requestStatus(req *approval.Request, policy *restic.ApprovalPolicy, now time.Time) string {
+	switch {
+	case !now.Before(req.Expires):
+		return "expired"
+	case req.Approved(policy, now):
+		return "approved"
+	default:
+		return "pending"
+	}
+}
+
+// requestDetails describes the operation requested by req.
+func requestDetails(req *approval.Request) string {
+	switch req.Operation {
+	case approval.OpForget, approval.OpRewrite, approval.OpRepairSnapshots:
+		ids := make([]string, 0, len(req.Snapshots))
+		for _, id := range req.Snapshots {
+			ids = append(ids, id.Str())
+		}
+		if req.Operation == approval.OpForget {
+			return fmt.Sprintf("forget %d snapshots: %v", len(ids), strings.Join(ids, " "))
+		}
+		return fmt.Sprintf("%v removing %d snapshots: %v", req.Operation, len(ids), strings.Join(ids, " "))
+	case approval.OpKeyRemove:
+		if req.Key != nil {
+			return "remove key " + req.Key.Str()
+		}
+	case approval.OpKeyPasswd:
+		if req.Key != nil {
+			return "replace key " + req.Key.Str()
+		}
+	case approval.OpRechunk:
+		return "rechunk all snapshots"
+	case approval.OpPolicy:
+		if req.Policy == nil {
+			return "remove approval policy"
+		}
+		return fmt.Sprintf("set approval policy with %d admin keys, forget threshold %d, window %v",
+			len(req.Policy.AdminKeys), req.Policy.ForgetThreshold, req.Policy.ApprovalWindow())
+	}
+	return req.Operation
+}
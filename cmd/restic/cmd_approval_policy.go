@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/approval"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdApprovalPolicy = &cobra.Command{
+	Use:   "policy [flags]",
+	Short: "Show or set the approval policy",
+	Long: `
+The "policy" sub-command shows the approval policy of the repository. If
+"--admin-key" is given, the policy is replaced by a policy with the given admin
+keys, at least two are required. "--remove" removes the policy.
+
+If the repository already has a policy, changing or removing it must be
+approved by two admins of the current policy.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runApprovalPolicy(cmd.Context(), approvalPolicyOptions, globalOptions, args)
+	},
+}
+
+// ApprovalPolicyOptions bundles all options for the approval policy command.
+type ApprovalPolicyOptions struct {
+	AdminKeyFiles   []string
+	ForgetThreshold uint
+	Window          time.Duration
+	Remove          bool
+}
+
+var approvalPolicyOptions ApprovalPolicyOptions
+
+func init() {
+	cmdApproval.AddCommand(cmdApprovalPolicy)
+
+	f := cmdApprovalPolicy.Flags()
+	f.StringArrayVar(&approvalPolicyOptions.AdminKeyFiles, "admin-key", nil, "`file` containing the PEM encoded Ed25519 public key of an admin (can be specified multiple times)")
+	f.UintVar(&approvalPolicyOptions.ForgetThreshold, "forget-threshold", 0, "number of snapshots `n` which may be removed without approval within the window")
+	f.DurationVar(&approvalPolicyOptions.Window, "window", restic.DefaultApprovalWindow, "`duration` within which a request must be approved")
+	f.BoolVar(&approvalPolicyOptions.Remove, "remove", false, "remove the approval policy")
+}
+
+// newApprovalPolicy returns the policy described by opts.
+func newApprovalPolicy(opts ApprovalPolicyOptions) (*restic.ApprovalPolicy, error) {
+	if opts.Window <= 0 {
+		return nil, errors.Fatal("--window must be positive")
+	}
+
+	policy := &restic.ApprovalPolicy{ForgetThreshold: opts.ForgetThreshold, Window: opts.Window}
+	seen := make(map[string]struct{})
+	for _, filename := range opts.AdminKeyFiles {
+		key, err := loadVerifyKey(filename)
+		if err != nil {
+			return nil, err
+		}
+		id := restic.SigningKeyID(key)
+		if _, ok := seen[id]; ok {
+			return nil, errors.Fatalf("admin key %v was specified more than once", filename)
+		}
+		seen[id] = struct{}{}
+		policy.AdminKeys = append(policy.AdminKeys, key)
+	}
+	if len(policy.AdminKeys) < 2 {
+		return nil, errors.Fatal("an approval policy requires at least two admin keys")
+	}
+	return policy, nil
+}
+
+func runApprovalPolicy(ctx context.Context, opts ApprovalPolicyOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the approval policy command expects no arguments, only options - please see `restic help approval policy` for usage and flags")
+	}
+	if opts.Remove && len(opts.AdminKeyFiles) > 0 {
+		return errors.Fatal("--remove and --admin-key cannot be used together")
+	}
+
+	if !opts.Remove && len(opts.AdminKeyFiles) == 0 {
+		_, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		return printApprovalPolicy(repo.Config().ApprovalPolicy, gopts)
+	}
+
+	var policy *restic.ApprovalPolicy
+	if !opts.Remove {
+		var err error
+		policy, err = newApprovalPolicy(opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if policy == nil && repo.Config().ApprovalPolicy == nil {
+		Verbosef("repository has no approval policy\n")
+		return nil
+	}
+
+	approved, err := requireApproval(ctx, repo, gopts, &approval.Request{Operation: approval.OpPolicy, Policy: policy})
+	if err != nil {
+		return err
+	}
+
+	err = repository.SetApprovalPolicy(ctx, repo, policy)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		Verbosef("removed approval policy\n")
+	} else {
+		Verbosef("saved approval policy with %d admin keys\n", len(policy.AdminKeys))
+	}
+	return consumeApproval(ctx, repo, approved)
+}
+
+func printApprovalPolicy(policy *restic.ApprovalPolicy, gopts GlobalOptions) error {
+	type jsonPolicy struct {
+		AdminKeys       []string `json:"admin_keys"`
+		ForgetThreshold uint     `json:"forget_threshold"`
+		Window          string   `json:"window"`
+	}
+
+	if policy == nil {
+		if gopts.JSON {
+			return json.NewEncoder(globalOptions.stdout).Encode(nil)
+		}
+		Printf("repository has no approval policy\n")
+		return nil
+	}
+
+	p := jsonPolicy{ForgetThreshold: policy.ForgetThreshold, Window: policy.ApprovalWindow().String()}
+	for _, key := range policy.AdminKeys {
+		p.AdminKeys = append(p.AdminKeys, restic.SigningKeyID(key))
+	}
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(p)
+	}
+
+	Printf("admin keys:       %v\n", strings.Join(p.AdminKeys, ", "))
+	Printf("forget threshold: %d snapshots\n", p.ForgetThreshold)
+	Printf("approval window:  %v\n", p.Window)
+	return nil
+}
@@ -12,16 +12,22 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/limiter"
+	"github.com/restic/restic/internal/cluster"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/metrics"
+	"github.com/restic/restic/internal/mssql"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/textfile"
@@ -43,11 +49,17 @@ EXIT STATUS
 Exit status is 0 if the command was successful.
 Exit status is 1 if there was a fatal error (no snapshot created).
 Exit status is 3 if some source data could not be read (incomplete snapshot created).
+Exit status is 4 if the snapshot was created, but a source path was skipped because it does not exist.
 Exit status is 10 if the repository does not exist.
 Exit status is 11 if the repository is already locked.
 Exit status is 12 if the password is incorrect.
+Exit status is 14 if the storage backend returned an error.
 `,
 	PreRun: func(_ *cobra.Command, _ []string) {
+		if backupOptions.Host == "" && backupOptions.ClusterRole != "" {
+			// snapshots of a clustered role must not depend on the active node
+			backupOptions.Host = backupOptions.ClusterRole
+		}
 		if backupOptions.Host == "" {
 			hostname, err := os.Hostname()
 			if err != nil {
@@ -62,6 +74,15 @@ Exit status is 12 if the password is incorrect.
 	RunE: func(cmd *cobra.Command, args []string) error {
 		term, cancel := setupTermstatus()
 		defer cancel()
+		if len(backupOptions.MSSQL) > 0 {
+			return runMSSQLBackup(cmd.Context(), backupOptions, globalOptions, term, args)
+		}
+		if len(backupOptions.VSphereVMs) > 0 {
+			return runVSphereBackup(cmd.Context(), backupOptions, globalOptions, term, args)
+		}
+		if backupOptions.WindowsShares {
+			return runWindowsSharesBackup(cmd.Context(), backupOptions, globalOptions, term, args)
+		}
 		return runBackup(cmd.Context(), backupOptions, globalOptions, term, args)
 	},
 }
@@ -78,6 +99,7 @@ type BackupOptions struct {
 	ExcludeCaches     bool
 	ExcludeLargerThan string
 	ExcludeCloudFiles bool
+	ExcludeCommand    string
 	Stdin             bool
 	StdinFilename     string
 	StdinCommand      bool
@@ -86,15 +108,44 @@ type BackupOptions struct {
 	FilesFrom         []string
 	FilesFromVerbatim []string
 	FilesFromRaw      []string
+	FilesFromVerified []string
 	TimeStamp         string
 	WithAtime         bool
 	IgnoreInode       bool
 	IgnoreCtime       bool
 	UseFsSnapshot     bool
+	VSSWriters        bool
 	DryRun            bool
 	ReadConcurrency   uint
+	LimitReadKb       int
+	MinFreeSpace      string
 	NoScan            bool
 	SkipIfUnchanged   bool
+	AnomalyPolicy     string
+	SpecialFiles      string
+	Classify          bool
+	ClassifyRules     string
+	MSSQL             []string
+	MSSQLInstance     string
+	VSphereVMs        []string
+	VSphereURL        string
+	VSphereInsecure   bool
+	VSphereQuiesce    bool
+	WindowsShares     bool
+	ClusterRole       string
+	SlowFileThreshold time.Duration
+	SlowestFiles      int
+	Job               string
+	JobShare          uint
+
+	// mssqlDatabase is set by runMSSQLBackup for the database to back up
+	mssqlDatabase string
+	// vsphereDisk is set by runVSphereBackup for the disk to back up
+	vsphereDisk *vsphereDisk
+	// windowsShares is set by runWindowsSharesBackup to the share definitions
+	windowsShares []byte
+	// manifest is set by runBackup to the files listed in the manifests
+	manifest *backupManifest
 }
 
 var backupOptions BackupOptions
@@ -118,11 +169,14 @@ func init() {
 	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes `filename[:header]`, exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file. See https://bford.info/cachedir/ for the Cache Directory Tagging Standard`)
 	f.StringVar(&backupOptions.ExcludeLargerThan, "exclude-larger-than", "", "max `size` of the files to be backed up (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.StringVar(&backupOptions.ExcludeCommand, "exclude-command", "", "ask `command` which files to exclude, see the documentation for the protocol")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin")
 	f.BoolVar(&backupOptions.StdinCommand, "stdin-from-command", false, "interpret arguments as command to execute and store its stdout")
 	f.Var(&backupOptions.Tags, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]` (can be specified multiple times)")
 	f.UintVar(&backupOptions.ReadConcurrency, "read-concurrency", 0, "read `n` files concurrently (default: $RESTIC_READ_CONCURRENCY or 2)")
+	f.IntVar(&backupOptions.LimitReadKb, "limit-read", 0, "limits reading files to a maximum `rate` in KiB/s (default: unlimited)")
+	f.StringVar(&backupOptions.MinFreeSpace, "min-free-space", "", "abort if less than `size` is free in the repository storage, if the backend can determine it (allowed suffixes: k/K, m/M, g/G, t/T)")
 	f.StringVarP(&backupOptions.Host, "host", "H", "", "set the `hostname` for the snapshot manually (default: $RESTIC_HOST). To prevent an expensive rescan use the \"parent\" flag")
 	f.StringVar(&backupOptions.Host, "hostname", "", "set the `hostname` for the snapshot manually")
 	err := f.MarkDeprecated("hostname", "use --host")
@@ -133,6 +187,7 @@ func init() {
 	f.StringArrayVar(&backupOptions.FilesFrom, "files-from", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
 	f.StringArrayVar(&backupOptions.FilesFromVerbatim, "files-from-verbatim", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
 	f.StringArrayVar(&backupOptions.FilesFromRaw, "files-from-raw", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.FilesFromVerified, "files-from-verified", nil, "read the files to backup from manifest `file` and verify their sizes and hashes (can be specified multiple times)")
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "`time` of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
 	f.BoolVar(&backupOptions.IgnoreInode, "ignore-inode", false, "ignore inode number and ctime changes when checking for modified files")
@@ -141,9 +196,26 @@ func init() {
 	f.BoolVar(&backupOptions.NoScan, "no-scan", false, "do not run scanner to estimate size of backup")
 	if runtime.GOOS == "windows" {
 		f.BoolVar(&backupOptions.UseFsSnapshot, "use-fs-snapshot", false, "use filesystem snapshot where possible (currently only Windows VSS)")
+		f.BoolVar(&backupOptions.VSSWriters, "vss-writers", false, "include the components of VSS writers (e.g. SQL Server, Exchange, Hyper-V) for application-consistent snapshots (requires --use-fs-snapshot)")
 		f.BoolVar(&backupOptions.ExcludeCloudFiles, "exclude-cloud-files", false, "excludes online-only cloud files (such as OneDrive Files On-Demand)")
+		f.StringSliceVar(&backupOptions.MSSQL, "mssql", nil, "back up the SQL Server `databases` (comma separated), each to its own snapshot")
+		f.StringVar(&backupOptions.MSSQLInstance, "mssql-instance", "", "name of the local SQL Server `instance` (default: the default instance)")
+		f.BoolVar(&backupOptions.WindowsShares, "windows-shares", false, "also back up the SMB share definitions and share permissions to a separate snapshot")
+		f.StringVar(&backupOptions.ClusterRole, "cluster-role", "", "only back up on the cluster node which owns the clustered `role`, use the role as host name")
 	}
 	f.BoolVar(&backupOptions.SkipIfUnchanged, "skip-if-unchanged", false, "skip snapshot creation if identical to parent snapshot")
+	f.StringVar(&backupOptions.AnomalyPolicy, "anomaly-policy", "off", "action if suspicious changes compared to the parent snapshot are detected: off, warn, tag or abort")
+	f.StringArrayVar(&backupOptions.VSphereVMs, "vsphere-vm", nil, "back up the disks of the vSphere virtual machine with the inventory `path` (can be specified multiple times)")
+	f.StringVar(&backupOptions.VSphereURL, "vsphere-url", os.Getenv("RESTIC_VSPHERE_URL"), "`url` of the vCenter server or ESXi host, e.g. https://user@vcenter.example.com (default: $RESTIC_VSPHERE_URL)")
+	f.BoolVar(&backupOptions.VSphereInsecure, "vsphere-insecure-tls", false, "skip TLS certificate verification when connecting to vSphere")
+	f.BoolVar(&backupOptions.VSphereQuiesce, "vsphere-quiesce", false, "quiesce the file systems of the virtual machines using VMware Tools before creating the snapshot")
+	f.BoolVar(&backupOptions.Classify, "classify", false, "classify the files by content and store the statistics per class in the snapshot")
+	f.StringVar(&backupOptions.ClassifyRules, "classify-rules", "", "read additional classification rules from `file` (implies --classify)")
+	f.DurationVar(&backupOptions.SlowFileThreshold, "slow-file-threshold", 0, "report files which take longer than `duration` to save, with the time spent per phase")
+	f.IntVar(&backupOptions.SlowestFiles, "slowest-files", 0, "list the `n` slowest files in the summary")
+	f.StringVar(&backupOptions.Job, "job", "", "coordinate with other backups of the repository running on this computer, using `name` for this backup")
+	f.UintVar(&backupOptions.JobShare, "job-share", 1, "`weight` of this backup when dividing the bandwidth limits and CPUs among concurrent jobs (requires --job)")
+	f.StringVar(&backupOptions.SpecialFiles, "special-files", "", "`policy` for device nodes, FIFOs and sockets: store, skip or fail (default: store devices and FIFOs, skip sockets)")
 
 	// parse read concurrency from env, on error the default value will be used
 	readConcurrency, _ := strconv.ParseUint(os.Getenv("RESTIC_READ_CONCURRENCY"), 10, 32)
@@ -161,7 +233,7 @@ func filterExisting(items []string) (result []string, err error) {
 	for _, item := range items {
 		_, err := fs.Lstat(item)
 		if errors.Is(err, os.ErrNotExist) {
-			Warnf("%v does not exist, skipping\n", item)
+			Warningf("%v does not exist, skipping\n", item)
 			continue
 		}
 
@@ -273,7 +345,7 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 			return errors.Fatal("cannot read both password and data from stdin")
 		}
 
-		filesFrom := append(append(opts.FilesFrom, opts.FilesFromVerbatim...), opts.FilesFromRaw...)
+		filesFrom := append(append(append(opts.FilesFrom, opts.FilesFromVerbatim...), opts.FilesFromRaw...), opts.FilesFromVerified...)
 		for _, filename := range filesFrom {
 			if filename == "-" {
 				return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file or $RESTIC_PASSWORD")
@@ -291,15 +363,54 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 		if len(opts.FilesFromRaw) > 0 {
 			return errors.Fatal("--stdin and --files-from-raw cannot be used together")
 		}
+		if len(opts.FilesFromVerified) > 0 {
+			return errors.Fatal("--stdin and --files-from-verified cannot be used together")
+		}
 
 		if len(args) > 0 && !opts.StdinCommand {
 			return errors.Fatal("--stdin was specified and files/dirs were listed as arguments")
 		}
 	}
 
+	if _, err := archiver.ParseAnomalyPolicy(opts.AnomalyPolicy); err != nil {
+		return errors.Fatalf("%v", err)
+	}
+	if _, err := restic.ParseSpecialFilesPolicy(opts.SpecialFiles); err != nil {
+		return errors.Fatalf("%v", err)
+	}
+
+	if opts.LimitReadKb < 0 {
+		return errors.Fatal("--limit-read must not be negative")
+	}
+	if opts.SlowFileThreshold < 0 {
+		return errors.Fatal("--slow-file-threshold must not be negative")
+	}
+	if opts.SlowestFiles < 0 {
+		return errors.Fatal("--slowest-files must not be negative")
+	}
+	if opts.VSSWriters && !opts.UseFsSnapshot {
+		return errors.Fatal("--vss-writers requires --use-fs-snapshot")
+	}
+	if opts.Job == "" && opts.JobShare > 1 {
+		return errors.Fatal("--job-share requires --job")
+	}
+
 	return nil
 }
 
+// readClassRules reads the content classification rules from filename.
+func readClassRules(filename string) ([]archiver.ClassRule, error) {
+	data, err := textfile.Read(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read classification rules: %v", err)
+	}
+	rules, err := archiver.ParseClassRules(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Fatalf("invalid classification rules in %v: %v", filename, err)
+	}
+	return rules, nil
+}
+
 // collectRejectByNameFuncs returns a list of all functions which may reject data
 // from being saved in a snapshot based on path only
 func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository) (fs []archiver.RejectByNameFunc, err error) {
@@ -401,7 +512,7 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 				return nil, fmt.Errorf("pattern: %s: %w", line, err)
 			}
 			if len(expanded) == 0 {
-				Warnf("pattern %q does not match any files, skipping\n", line)
+				Warningf("pattern %q does not match any files, skipping\n", line)
 			}
 			targets = append(targets, expanded...)
 		}
@@ -428,6 +539,10 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 		targets = append(targets, fromfile...)
 	}
 
+	if opts.manifest != nil {
+		targets = append(targets, opts.manifest.paths()...)
+	}
+
 	// Merge args into files-from so we can reuse the normal args checks
 	// and have the ability to use both files-from and args at the same time.
 	targets = append(targets, args...)
@@ -481,6 +596,7 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		if vsscfg, err = fs.ParseVSSConfig(gopts.extended); err != nil {
 			return err
 		}
+		vsscfg.Writers = opts.VSSWriters
 	}
 
 	err = opts.Check(gopts, args)
@@ -488,11 +604,37 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
+	if len(opts.FilesFromVerified) > 0 {
+		opts.manifest, err = readManifests(opts.FilesFromVerified)
+		if err != nil {
+			return err
+		}
+		failed := opts.manifest.verify(func(path string, err error) {
+			Warnf("manifest: %v: %v\n", path, err)
+		})
+		if failed > 0 {
+			return errors.Fatalf("%d of %d files do not match the manifest, no snapshot created", failed, len(opts.manifest.entries))
+		}
+	}
+
 	targets, err := collectTargets(opts, args)
 	if err != nil {
 		return err
 	}
 
+	var clusterRole cluster.Role
+	if opts.ClusterRole != "" {
+		var active bool
+		clusterRole, active, err = lookupClusterRole(opts.ClusterRole)
+		if err != nil {
+			return err
+		}
+		if !active {
+			Verbosef("clustered role %v is owned by node %v, skipping backup\n", clusterRole.Name, clusterRole.OwnerNode)
+			return nil
+		}
+	}
+
 	timeStamp := time.Now()
 	backupStart := timeStamp
 	if opts.TimeStamp != "" {
@@ -502,21 +644,72 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		}
 	}
 
+	signingKey, err := loadSigningKey(gopts.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+
 	if gopts.verbosity >= 2 && !gopts.JSON {
 		Verbosef("open repository\n")
 	}
 
+	var minFreeSpace uint64
+	if opts.MinFreeSpace != "" {
+		size, err := ui.ParseBytes(opts.MinFreeSpace)
+		if err != nil {
+			return errors.Fatalf("invalid --min-free-space: %v", err)
+		}
+		minFreeSpace = uint64(size)
+	}
+
+	if opts.Job != "" {
+		gopts.bandwidthShare = limiter.NewShare()
+	}
+
 	ctx, repo, unlock, err := openWithAppendLock(ctx, gopts, opts.DryRun)
 	if err != nil {
 		return err
 	}
 	defer unlock()
 
+	var job *backupJob
+	if opts.Job != "" {
+		job, err = startBackupJob(ctx, gopts, repo, opts)
+		if err != nil {
+			return err
+		}
+		defer job.Stop()
+	}
+
+	events := newJSONEvents(gopts, term, "backup")
+
+	if capacity := repoCapacity(ctx, repo); capacity != nil {
+		if capacity.Free < minFreeSpace && !opts.DryRun {
+			return errors.Fatalf("only %v are free in the repository storage, --min-free-space requires %v", ui.FormatBytes(capacity.Free), ui.FormatBytes(minFreeSpace))
+		}
+		if msg := lowFreeSpace(*capacity); msg != "" {
+			if events != nil {
+				events.Warning("", msg)
+			} else {
+				Warnf("warning: %s\n", msg)
+			}
+		}
+	}
 	var progressPrinter backup.ProgressPrinter
-	if gopts.JSON {
+	switch {
+	case events != nil:
+		progressPrinter = backup.NewJSONEventsProgress(events)
+	case gopts.JSON:
 		progressPrinter = backup.NewJSONProgress(term, gopts.verbosity)
-	} else {
-		progressPrinter = backup.NewTextProgress(term, gopts.verbosity)
+	default:
+		textProgress := backup.NewTextProgress(term, gopts.verbosity)
+		if job != nil {
+			textProgress.SetOtherJobs(job.StatusLines)
+		}
+		progressPrinter = textProgress
+	}
+	if job != nil {
+		progressPrinter = jobProgressPrinter{progressPrinter, job.sched}
 	}
 	progressReporter := backup.NewProgress(progressPrinter,
 		calculateProgressInterval(!gopts.Quiet, gopts.JSON))
@@ -547,14 +740,16 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	if !gopts.JSON {
 		progressPrinter.V("load index files")
 	}
+	events.Phase("load index")
 
-	bar := newIndexTerminalProgress(gopts.Quiet, gopts.JSON, term)
+	bar := newIndexEventsProgress(gopts, events, term)
 	err = repo.LoadIndex(ctx, bar)
 	if err != nil {
 		return err
 	}
 
 	var targetFS fs.FS = fs.Local{}
+	var localVss *fs.LocalVss
 	if runtime.GOOS == "windows" && opts.UseFsSnapshot {
 		if err = fs.HasSufficientPrivilegesForVSS(); err != nil {
 			return err
@@ -570,18 +765,43 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 			}
 		}
 
-		localVss := fs.NewLocalVss(errorHandler, messageHandler, vsscfg)
+		localVss = fs.NewLocalVss(errorHandler, messageHandler, vsscfg)
 		defer localVss.DeleteSnapshots()
 		targetFS = localVss
 	}
 
+	var mssqlBackup *mssql.Backup
 	if opts.Stdin || opts.StdinCommand {
 		if !gopts.JSON {
-			progressPrinter.V("read data from stdin")
+			if opts.vsphereDisk != nil {
+				progressPrinter.V("read %v of virtual machine %v", opts.vsphereDisk.disk.Label, opts.vsphereDisk.vmName)
+			} else if opts.mssqlDatabase != "" {
+				progressPrinter.V("read backup of database %v from SQL Server", opts.mssqlDatabase)
+			} else if opts.windowsShares != nil {
+				progressPrinter.V("read share definitions")
+			} else {
+				progressPrinter.V("read data from stdin")
+			}
 		}
 		filename := path.Join("/", opts.StdinFilename)
 		var source io.ReadCloser = os.Stdin
-		if opts.StdinCommand {
+		var size int64
+		if opts.vsphereDisk != nil {
+			source, err = opts.vsphereDisk.open(ctx, repo, parentSnapshot)
+			if err != nil {
+				return err
+			}
+			size = opts.vsphereDisk.disk.Capacity
+		} else if opts.mssqlDatabase != "" {
+			mssqlBackup, err = mssql.Start(ctx, mssql.Config{Instance: opts.MSSQLInstance}, opts.mssqlDatabase)
+			if err != nil {
+				return err
+			}
+			source = mssqlBackup
+		} else if opts.windowsShares != nil {
+			source = io.NopCloser(bytes.NewReader(opts.windowsShares))
+			size = int64(len(opts.windowsShares))
+		} else if opts.StdinCommand {
 			source, err = fs.NewCommandReader(ctx, args, globalOptions.stderr)
 			if err != nil {
 				return err
@@ -591,6 +811,7 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 			ModTime:    timeStamp,
 			Name:       filename,
 			Mode:       0644,
+			Size:       size,
 			ReadCloser: source,
 		}
 		targets = []string{filename}
@@ -606,6 +827,30 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
+	var excludeCmd *archiver.ExcludeCommand
+	if opts.ExcludeCommand != "" && !opts.Stdin && !opts.StdinCommand {
+		args, err := backend.SplitShellStrings(opts.ExcludeCommand)
+		if err != nil {
+			return err
+		}
+
+		// abort the backup if the exclude command fails, rejecting the
+		// remaining files would silently create an incomplete snapshot
+		var cancelBackup context.CancelCauseFunc
+		ctx, cancelBackup = context.WithCancelCause(ctx)
+		defer cancelBackup(nil)
+
+		excludeCmd, err = archiver.NewExcludeCommand(ctx, args, globalOptions.stderr)
+		if err != nil {
+			return errors.Fatalf("%v", err)
+		}
+		defer func() {
+			_ = excludeCmd.Close()
+		}()
+		excludeCmd.OnError = cancelBackup
+		rejectFuncs = append(rejectFuncs, excludeCmd.Reject)
+	}
+
 	selectByNameFilter := archiver.CombineRejectByNames(rejectByNameFuncs)
 	selectFilter := archiver.CombineRejects(rejectFuncs)
 
@@ -630,9 +875,12 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	arch.SelectByName = selectByNameFilter
 	arch.Select = selectFilter
 	arch.WithAtime = opts.WithAtime
+	arch.SetEventSink(progressReporter)
 	success := true
+	var errorCount atomic.Uint64
 	arch.Error = func(item string, err error) error {
 		success = false
+		errorCount.Add(1)
 		reterr := progressReporter.Error(item, err)
 		// If we receive a fatal error during the execution of the snapshot,
 		// we abort the snapshot.
@@ -641,9 +889,6 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		}
 		return reterr
 	}
-	arch.CompleteItem = progressReporter.CompleteItem
-	arch.StartFile = progressReporter.StartFile
-	arch.CompleteBlob = progressReporter.CompleteBlob
 
 	if opts.IgnoreInode {
 		// --ignore-inode implies --ignore-ctime: on FUSE, the ctime is not
@@ -654,6 +899,52 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		arch.ChangeIgnoreFlags |= archiver.ChangeIgnoreCtime
 	}
 
+	anomalyPolicy, err := archiver.ParseAnomalyPolicy(opts.AnomalyPolicy)
+	if err != nil {
+		return errors.Fatalf("%v", err)
+	}
+	if anomalyPolicy != archiver.AnomalyPolicyOff {
+		arch.Anomalies = archiver.NewAnomalyDetector(archiver.AnomalyOptions{Policy: anomalyPolicy})
+	}
+
+	if opts.Classify || opts.ClassifyRules != "" {
+		var rules []archiver.ClassRule
+		if opts.ClassifyRules != "" {
+			rules, err = readClassRules(opts.ClassifyRules)
+			if err != nil {
+				return err
+			}
+		}
+		arch.Classifier = archiver.NewClassifier(rules)
+	}
+
+	if opts.manifest != nil {
+		completeItem := arch.CompleteItem
+		arch.CompleteItem = func(item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
+			completeItem(item, previous, current, s, d)
+			opts.manifest.observe(item, current)
+		}
+	}
+
+	if opts.SlowFileThreshold > 0 || opts.SlowestFiles > 0 {
+		arch.SlowFiles = archiver.NewSlowFileTracker(opts.SlowFileThreshold, opts.SlowestFiles, progressPrinter.SlowFile)
+	}
+
+	arch.SpecialFiles, err = restic.ParseSpecialFilesPolicy(opts.SpecialFiles)
+	if err != nil {
+		return errors.Fatalf("%v", err)
+	}
+
+	if opts.LimitReadKb > 0 || gopts.LimitSchedule != "" {
+		limits, schedule, err := bandwidthLimits(gopts)
+		if err != nil {
+			return err
+		}
+		readLimiter := limiter.NewScheduledLimiter(schedule, limits, opts.LimitReadKb)
+		readLimiter.SetShare(gopts.bandwidthShare)
+		arch.LimitRead = readLimiter.DiskReader
+	}
+
 	snapshotOpts := archiver.SnapshotOptions{
 		Excludes:        opts.Excludes,
 		Tags:            opts.Tags.Flatten(),
@@ -663,11 +954,45 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		ParentSnapshot:  parentSnapshot,
 		ProgramVersion:  "restic " + version,
 		SkipIfUnchanged: opts.SkipIfUnchanged,
+		SigningKey:      signingKey,
+		AccountNames:    fs.AccountNames,
+	}
+	if opts.ClusterRole != "" {
+		snapshotOpts.Tags = append(snapshotOpts.Tags, clusterRole.Tags(clusterSharedVolumes(targets))...)
+	}
+	if localVss != nil {
+		snapshotOpts.AuxiliaryDocuments = localVss.Documents
+		if opts.VSSWriters {
+			snapshotOpts.VSSWriters = localVss.Writers
+		}
+	}
+	if mssqlBackup != nil {
+		snapshotOpts.ExtraTags = func() restic.TagList {
+			info, err := mssqlBackup.Info(ctx)
+			if err != nil {
+				Warnf("unable to query backup details of database %v: %v\n", opts.mssqlDatabase, err)
+				return mssql.Info{}.Tags(opts.mssqlDatabase)
+			}
+			return info.Tags(opts.mssqlDatabase)
+		}
+	}
+
+	token := &checkpointToken{Operation: "backup", Hostname: opts.Host, Paths: targets}
+	if !opts.DryRun {
+		var done func()
+		snapshotOpts.Checkpoint, done = registerCheckpoint()
+		defer done()
+
+		if saved := token.load(repo); saved != nil && !gopts.JSON {
+			progressPrinter.P("resuming backup interrupted at %v, data of %d files (%v) is already stored in the repository",
+				saved.Time.Format(TimeFormat), saved.Files, ui.FormatBytes(saved.Bytes))
+		}
 	}
 
 	if !gopts.JSON {
 		progressPrinter.V("start backup on %v", targets)
 	}
+	events.Phase("backup")
 	_, id, summary, err := arch.Snapshot(ctx, targets, snapshotOpts)
 
 	// cleanly shutdown all running goroutines
@@ -676,13 +1001,62 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	// let's see if one returned an error
 	werr := wg.Wait()
 
+	if excludeCmd != nil {
+		if cerr := excludeCmd.Close(); cerr != nil {
+			if err == nil && !id.IsNull() {
+				return errors.Fatalf("snapshot %v is incomplete: %v", id.Str(), cerr)
+			}
+			return errors.Fatalf("unable to save snapshot: %v", cerr)
+		}
+	}
+
+	if summary != nil {
+		for _, a := range summary.Anomalies {
+			Warnf("Warning: %v\n", a)
+		}
+		if len(summary.Anomalies) > 0 && anomalyPolicy == archiver.AnomalyPolicyTag && !id.IsNull() {
+			Warnf("snapshot %v has been tagged %q\n", id.Str(), archiver.SuspectTag)
+		}
+	}
+
+	if errors.Is(err, archiver.ErrCheckpoint) {
+		token.Time = time.Now()
+		token.Files = uint64(summary.Files.New + summary.Files.Changed + summary.Files.Unchanged)
+		token.Bytes = summary.ProcessedBytes
+		if err := token.save(repo); err != nil {
+			Warnf("unable to record checkpoint: %v\n", err)
+		}
+		Warnf("backup interrupted, the data of %d files (%v) read so far was saved to the repository\n",
+			token.Files, ui.FormatBytes(token.Bytes))
+		return ErrCheckpoint
+	}
+
 	// return original error
 	if err != nil {
 		return errors.Fatalf("unable to save snapshot: %v", err)
 	}
+	token.remove(repo)
 
 	// Report finished execution
 	progressReporter.Finish(id, summary, opts.DryRun)
+	snapshotID := ""
+	if !id.IsNull() {
+		snapshotID = id.String()
+	}
+	recordMetrics(metrics.Stats{
+		Files:     uint64(summary.Files.New + summary.Files.Changed + summary.Files.Unchanged),
+		Bytes:     summary.ProcessedBytes,
+		DataAdded: summary.DataSize,
+	}, errorCount.Load(), snapshotID)
+	if opts.manifest != nil {
+		failed := opts.manifest.check(func(path string, err error) {
+			Warnf("manifest: %v: %v\n", path, err)
+		})
+		if failed > 0 {
+			Warnf("%d of %d files from the manifest are missing or differ in the snapshot\n", failed, len(opts.manifest.entries))
+			return ErrInvalidSourceData
+		}
+	}
 	if !success {
 		return ErrInvalidSourceData
 	}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/restic/restic/internal/cluster"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// lookupClusterRole returns the clustered role with the given name. active is
+// false if the role is owned by another node of the cluster, in which case the
+// backup is left to that node.
+func lookupClusterRole(name string) (role cluster.Role, active bool, err error) {
+	role, err = cluster.LookupRole(name)
+	if err != nil {
+		return cluster.Role{}, false, errors.Fatalf("%v", err)
+	}
+	node, err := cluster.LocalNode()
+	if err != nil {
+		return cluster.Role{}, false, errors.Fatalf("unable to determine the name of the local node: %v", err)
+	}
+
+	if !role.OwnedBy(node) {
+		return role, false, nil
+	}
+	if role.State != cluster.StateOnline {
+		Warnf("clustered role %v is %v\n", role.Name, role.StateString())
+	}
+	return role, true, nil
+}
+
+// clusterSharedVolumes returns the names of the cluster shared volumes the
+// targets are located on.
+func clusterSharedVolumes(targets []string) []string {
+	var volumes []string
+	for _, target := range targets {
+		root, ok := fs.SharedVolume(target)
+		if !ok {
+			continue
+		}
+		name := filepath.Base(root)
+		if !slices.Contains(volumes, name) {
+			volumes = append(volumes, name)
+		}
+	}
+	return volumes
+}
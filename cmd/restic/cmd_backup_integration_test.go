@@ -2,15 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/jobs"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 	"github.com/restic/restic/internal/ui/termstatus"
@@ -723,3 +726,119 @@ func TestBackupSkipIfUnchanged(t *testing.T) {
 
 	testRunCheck(t, env.gopts)
 }
+
+func TestBackupMetrics(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testSetupBackupData(t, env)
+
+	metricsFile := filepath.Join(env.base, "restic.prom")
+	oldOptions := globalOptions
+	defer func() {
+		globalOptions = oldOptions
+		jobMetrics = nil
+	}()
+	globalOptions.MetricsFile = metricsFile
+	globalOptions.MetricsJob = "nightly"
+
+	setupMetrics(globalOptions, "backup")
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs := testListSnapshots(t, env.gopts, 1)
+	rtest.Assert(t, jobMetrics.Stats != nil && jobMetrics.Stats.Files > 0, "missing stats in %+v", jobMetrics)
+	writeMetrics(0)
+
+	data, err := os.ReadFile(metricsFile)
+	rtest.OK(t, err)
+	for _, line := range []string{
+		`restic_job_success{command="backup",job_name="nightly"} 1`,
+		fmt.Sprintf(`restic_job_snapshot_info{command="backup",job_name="nightly",snapshot_id=%q} 1`, snapshotIDs[0].String()),
+	} {
+		rtest.Assert(t, strings.Contains(string(data), line+"\n"), "missing line %q in\n%s", line, data)
+	}
+}
+
+func TestBackupFilesFromVerified(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.base, "source")
+	rtest.OK(t, os.MkdirAll(dir, 0755))
+	var manifest strings.Builder
+	for _, name := range []string{"foo", "bar"} {
+		data := []byte("content of " + name)
+		filename := filepath.Join(dir, name)
+		rtest.OK(t, os.WriteFile(filename, data, 0644))
+		fmt.Fprintf(&manifest, "%s\tsize=%d\tsha256=%x\n", filename, len(data), sha256.Sum256(data))
+	}
+	// not listed in the manifest
+	rtest.OK(t, os.WriteFile(filepath.Join(dir, "other"), []byte("other"), 0644))
+
+	manifestFile := filepath.Join(env.base, "manifest")
+	rtest.OK(t, os.WriteFile(manifestFile, []byte(manifest.String()), 0644))
+
+	opts := BackupOptions{FilesFromVerified: []string{manifestFile}}
+	testRunBackup(t, "", nil, opts, env.gopts)
+	snapshotIDs := testListSnapshots(t, env.gopts, 1)
+
+	var names []string
+	for _, line := range testRunLs(t, env.gopts, snapshotIDs[0].String()) {
+		if filepath.Base(line) != "source" && strings.HasPrefix(line, filepath.ToSlash(dir)) {
+			names = append(names, filepath.Base(line))
+		}
+	}
+	rtest.Equals(t, []string{"bar", "foo"}, names)
+
+	// excluded files are missing in the snapshot
+	excludeOpts := opts
+	excludeOpts.Excludes = []string{"foo"}
+	err := testRunBackupAssumeFailure(t, "", nil, excludeOpts, env.gopts)
+	rtest.Assert(t, err == ErrInvalidSourceData, "expected ErrInvalidSourceData, got %v", err)
+	testListSnapshots(t, env.gopts, 2)
+
+	// a modified file must be detected before creating a snapshot
+	rtest.OK(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("modified"), 0644))
+	err = testRunBackupAssumeFailure(t, "", nil, opts, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "do not match the manifest"), "expected verification error, got %v", err)
+
+	// as must a missing file
+	rtest.OK(t, os.Remove(filepath.Join(dir, "foo")))
+	err = testRunBackupAssumeFailure(t, "", nil, opts, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "do not match the manifest"), "expected verification error, got %v", err)
+	testListSnapshots(t, env.gopts, 2)
+}
+
+func TestBackupJob(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{Job: "first", JobShare: 1}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+
+	// the job is removed after the backup
+	dirs, err := filepath.Glob(filepath.Join(env.cache, "jobs", "*"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(dirs))
+	entries, err := os.ReadDir(dirs[0])
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(entries))
+
+	// a concurrently running job keeps its registration
+	other, err := jobs.Join(dirs[0], "other", 3)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, other.Leave())
+	}()
+	procs := runtime.GOMAXPROCS(0)
+	opts.Job = "second"
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.Equals(t, procs, runtime.GOMAXPROCS(0))
+	rtest.OK(t, other.Refresh())
+	rtest.Equals(t, 1.0, other.Share())
+	testListSnapshots(t, env.gopts, 2)
+
+	err = testRunBackupAssumeFailure(t, "", []string{env.testdata}, BackupOptions{JobShare: 2}, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for --job-share without --job")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/restic/restic/internal/backend/cache"
+	"github.com/restic/restic/internal/backend/limiter"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/jobs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/backup"
+)
+
+// jobsRefreshInterval is the interval in which a backup job publishes its
+// progress and adapts its share to the other jobs.
+const jobsRefreshInterval = 2 * time.Second
+
+// backupJob coordinates a backup with the other backups of the same
+// repository which run at the same time on this computer, see --job.
+type backupJob struct {
+	sched *jobs.Scheduler
+	share *limiter.Share
+	procs int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// jobsDir returns the scheduler directory for the repository with the given
+// ID in the local cache.
+func jobsDir(gopts GlobalOptions, repoID string) (string, error) {
+	dir := gopts.CacheDir
+	if dir == "" {
+		var err error
+		dir, err = cache.DefaultDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, "jobs", repoID), nil
+}
+
+// startBackupJob registers the backup as job and divides the bandwidth limits
+// and CPUs among the running jobs until Stop is called.
+func startBackupJob(ctx context.Context, gopts GlobalOptions, repo restic.Repository, opts BackupOptions) (*backupJob, error) {
+	dir, err := jobsDir(gopts, repo.Config().ID)
+	if err != nil {
+		return nil, err
+	}
+	sched, err := jobs.Join(dir, opts.Job, max(1, opts.JobShare))
+	if err != nil {
+		return nil, fmt.Errorf("unable to register backup job: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	j := &backupJob{
+		sched:  sched,
+		share:  gopts.bandwidthShare,
+		procs:  runtime.GOMAXPROCS(0),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if others := sched.Others(); len(others) > 0 {
+		Verbosef("%d other backup jobs are running, using %.0f%% of the resources\n", len(others), sched.Share()*100)
+	}
+	j.apply(sched.Share())
+
+	go func() {
+		defer close(j.done)
+		sched.Run(ctx, jobsRefreshInterval, j.apply)
+	}()
+	return j, nil
+}
+
+// apply limits the backup to the given share of the bandwidth limits and CPUs.
+func (j *backupJob) apply(share float64) {
+	if j.share != nil {
+		j.share.Set(share)
+	}
+	procs := max(1, int(math.Round(float64(j.procs)*share)))
+	if runtime.GOMAXPROCS(0) != procs {
+		debug.Log("job share %.2f, using %d CPUs", share, procs)
+		runtime.GOMAXPROCS(procs)
+	}
+}
+
+// Stop removes the job and restores the number of CPUs.
+func (j *backupJob) Stop() {
+	j.cancel()
+	<-j.done
+	if err := j.sched.Leave(); err != nil {
+		debug.Log("unable to remove backup job: %v", err)
+	}
+	runtime.GOMAXPROCS(j.procs)
+}
+
+// StatusLines returns a status line for each of the other running jobs.
+func (j *backupJob) StatusLines() []string {
+	var lines []string
+	for _, other := range j.sched.Others() {
+		p := other.Progress
+		var status string
+		if p.TotalBytes > 0 {
+			status = fmt.Sprintf("%s  %v files %s, total %v files %s", ui.FormatPercent(p.Bytes, p.TotalBytes),
+				p.Files, ui.FormatBytes(p.Bytes), p.TotalFiles, ui.FormatBytes(p.TotalBytes))
+		} else {
+			status = fmt.Sprintf("%v files %s", p.Files, ui.FormatBytes(p.Bytes))
+		}
+		lines = append(lines, fmt.Sprintf("job %s: [%s] %s", other.Name, ui.FormatDuration(time.Since(other.Started)), status))
+	}
+	return lines
+}
+
+// jobProgressPrinter publishes the progress of the backup to the other jobs.
+type jobProgressPrinter struct {
+	backup.ProgressPrinter
+	sched *jobs.Scheduler
+}
+
+func (p jobProgressPrinter) Update(total, processed backup.Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64) {
+	p.sched.SetProgress(jobs.Progress{
+		Files:      processed.Files,
+		Bytes:      processed.Bytes,
+		TotalFiles: total.Files,
+		TotalBytes: total.Bytes,
+	})
+	p.ProgressPrinter.Update(total, processed, errors, currentFiles, start, secs)
+}
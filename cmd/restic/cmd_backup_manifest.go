@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/textfile"
+)
+
+// manifestEntry is a file listed in a manifest passed to --files-from-verified.
+type manifestEntry struct {
+	Path   string
+	Size   int64 // -1 if the size is not listed
+	SHA256 []byte
+
+	// modTime and size are recorded when the file is verified before the
+	// backup, the snapshot must contain the file in exactly this state.
+	modTime time.Time
+	size    int64
+}
+
+// backupManifest contains the files which must be backed up.
+type backupManifest struct {
+	entries []manifestEntry
+
+	m     sync.Mutex
+	nodes map[string]*restic.Node
+}
+
+// readManifests reads the manifests from the named files, or from stdin if
+// the filename is "-". Entries are separated by newlines, or by zero bytes if
+// the manifest contains one. Each entry consists of the path, optionally
+// followed by tab-separated fields "size=<bytes>" and "sha256=<hex digest>".
+// In newline-separated manifests, empty lines and lines starting with '#' are
+// ignored.
+func readManifests(filenames []string) (*backupManifest, error) {
+	manifest := &backupManifest{nodes: make(map[string]*restic.Node)}
+	seen := make(map[string]struct{})
+
+	for _, filename := range filenames {
+		var (
+			data []byte
+			err  error
+		)
+		if filename == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = textfile.Read(filename)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entries, err := parseManifest(data)
+		if err != nil {
+			return nil, errors.Fatalf("invalid manifest %v: %v", filename, err)
+		}
+
+		for _, entry := range entries {
+			abs, err := filepath.Abs(entry.Path)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := seen[abs]; ok {
+				return nil, errors.Fatalf("invalid manifest %v: %v is listed more than once", filename, entry.Path)
+			}
+			seen[abs] = struct{}{}
+			entry.Path = abs
+			manifest.entries = append(manifest.entries, entry)
+		}
+	}
+
+	if len(manifest.entries) == 0 {
+		return nil, errors.Fatal("--files-from-verified: no files listed in the manifest")
+	}
+	return manifest, nil
+}
+
+func parseManifest(data []byte) ([]manifestEntry, error) {
+	var lines []string
+	raw := bytes.IndexByte(data, 0) >= 0
+	if raw {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+	} else {
+		lines = strings.Split(string(data), "\n")
+	}
+
+	var entries []manifestEntry
+	for i, line := range lines {
+		if !raw {
+			line = strings.TrimSuffix(line, "\r")
+			if line == "" || line[0] == '#' {
+				continue
+			}
+		}
+
+		fields := strings.Split(line, "\t")
+		entry := manifestEntry{Path: fields[0], Size: -1}
+		if entry.Path == "" {
+			return nil, errors.Errorf("entry %d: empty filename", i+1)
+		}
+
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "size":
+				size, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || size < 0 {
+					return nil, errors.Errorf("entry %d: invalid size %q", i+1, value)
+				}
+				entry.Size = size
+			case "sha256":
+				sum, err := hex.DecodeString(value)
+				if err != nil || len(sum) != sha256.Size {
+					return nil, errors.Errorf("entry %d: invalid SHA-256 hash %q", i+1, value)
+				}
+				entry.SHA256 = sum
+			default:
+				return nil, errors.Errorf("entry %d: unknown field %q", i+1, field)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// paths returns the paths of all files in the manifest.
+func (m *backupManifest) paths() []string {
+	paths := make([]string, 0, len(m.entries))
+	for _, entry := range m.entries {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
+
+// verify checks that all files in the manifest exist and match the listed
+// size and hash. Each mismatch is passed to report, the number of mismatches
+// is returned.
+func (m *backupManifest) verify(report func(path string, err error)) int {
+	failed := 0
+	for i := range m.entries {
+		entry := &m.entries[i]
+		if err := entry.verify(); err != nil {
+			report(entry.Path, err)
+			failed++
+		}
+	}
+	return failed
+}
+
+func (e *manifestEntry) verify() error {
+	fi, err := fs.Lstat(e.Path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return errors.New("not a regular file")
+	}
+	if e.Size >= 0 && fi.Size() != e.Size {
+		return errors.Errorf("size is %d, expected %d", fi.Size(), e.Size)
+	}
+
+	if e.SHA256 != nil {
+		f, err := fs.OpenFile(e.Path, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+		if sum := h.Sum(nil); !bytes.Equal(sum, e.SHA256) {
+			return errors.Errorf("SHA-256 hash is %x, expected %x", sum, e.SHA256)
+		}
+
+		// make sure the file was not modified while it was hashed
+		after, err := fs.Lstat(e.Path)
+		if err != nil {
+			return err
+		}
+		if after.Size() != fi.Size() || !after.ModTime().Equal(fi.ModTime()) {
+			return errors.New("file was modified during verification")
+		}
+	}
+
+	e.modTime = fi.ModTime()
+	e.size = fi.Size()
+	return nil
+}
+
+// observe records the node of a file saved by the archiver.
+func (m *backupManifest) observe(item string, current *restic.Node) {
+	if current == nil || current.Type != restic.NodeTypeFile {
+		return
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.nodes[item] = current
+}
+
+// check verifies that the snapshot contains all files in the manifest in the
+// state they had during verification. Each mismatch is passed to report, the
+// number of mismatches is returned.
+func (m *backupManifest) check(report func(path string, err error)) int {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	failed := 0
+	for _, entry := range m.entries {
+		node, ok := m.nodes[manifestSnapshotPath(entry.Path)]
+		switch {
+		case !ok:
+			report(entry.Path, errors.New("not contained in the snapshot"))
+		case int64(node.Size) != entry.size:
+			report(entry.Path, errors.Errorf("saved with size %d, verified size was %d", node.Size, entry.size))
+		case !node.ModTime.Equal(entry.modTime):
+			report(entry.Path, errors.New("file was modified after verification"))
+		default:
+			continue
+		}
+		failed++
+	}
+	return failed
+}
+
+// manifestSnapshotPath returns the path of the absolute filename p within the
+// snapshot. On Windows, the volume name is stored as the first directory.
+func manifestSnapshotPath(p string) string {
+	volume := filepath.VolumeName(p)
+	p = filepath.ToSlash(p[len(volume):])
+	if volume != "" {
+		p = "/" + strings.TrimSuffix(volume, ":") + p
+	}
+	return p
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// runMSSQLBackup creates one snapshot for each SQL Server database in
+// opts.MSSQL. The backup stream of each database is stored as a single file
+// named mssql/[instance/]database.bak.
+func runMSSQLBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	if runtime.GOOS != "windows" {
+		return errors.Fatal("--mssql is only supported on Windows")
+	}
+	if len(args) > 0 {
+		return errors.Fatal("--mssql was specified and files/dirs were listed as arguments")
+	}
+	if opts.Stdin || opts.StdinCommand {
+		return errors.Fatal("--mssql and --stdin cannot be used together")
+	}
+
+	var databases []string
+	for _, db := range opts.MSSQL {
+		if db = strings.TrimSpace(db); db != "" {
+			databases = append(databases, db)
+		}
+	}
+	if len(databases) == 0 {
+		return errors.Fatal("--mssql requires at least one database name")
+	}
+
+	for _, db := range databases {
+		dbOpts := opts
+		// the backup is read as a single stream, like with --stdin-from-command
+		dbOpts.StdinCommand = true
+		dbOpts.mssqlDatabase = db
+		dbOpts.StdinFilename = path.Join("mssql", opts.MSSQLInstance, db+".bak")
+		if err := runBackup(ctx, dbOpts, gopts, term, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
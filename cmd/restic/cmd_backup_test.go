@@ -113,3 +113,36 @@ func TestReadFilenamesRaw(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), "zero byte"),
 		"wrong error message: %v", err.Error())
 }
+
+func TestParseManifest(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	entries, err := parseManifest([]byte("# comment\n/foo\tsize=12\r\n\n/bar baz\tsha256=" + sum + "\tsize=0\n"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(entries))
+	rtest.Equals(t, "/foo", entries[0].Path)
+	rtest.Equals(t, int64(12), entries[0].Size)
+	rtest.Assert(t, entries[0].SHA256 == nil, "unexpected hash for /foo")
+	rtest.Equals(t, "/bar baz", entries[1].Path)
+	rtest.Equals(t, int64(0), entries[1].Size)
+	rtest.Equals(t, sum, fmt.Sprintf("%x", entries[1].SHA256))
+
+	// zero bytes separate the entries, newlines are part of the filename
+	entries, err = parseManifest([]byte("#foo\nbar\x00/baz\tsize=1\x00"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(entries))
+	rtest.Equals(t, "#foo\nbar", entries[0].Path)
+	rtest.Equals(t, int64(-1), entries[0].Size)
+	rtest.Equals(t, "/baz", entries[1].Path)
+
+	for _, data := range []string{
+		"/foo\tsize=-1\n",
+		"/foo\tsize=abc\n",
+		"/foo\tsha256=abcd\n",
+		"/foo\tmd5=" + sum + "\n",
+		"\tsize=1\n",
+		"/foo\x00\x00",
+	} {
+		_, err := parseManifest([]byte(data))
+		rtest.Assert(t, err != nil, "expected error for %q", data)
+	}
+}
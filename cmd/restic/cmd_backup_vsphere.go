@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/termstatus"
+	"github.com/restic/restic/internal/vsphere"
+)
+
+// vsphereChangeIDTag prefixes the tag recording the CBT change ID of a disk.
+const vsphereChangeIDTag = "vsphere-change-id:"
+
+// vsphereDisk is a disk of a virtual machine snapshot which is backed up.
+type vsphereDisk struct {
+	client       *vsphere.Client
+	vm, snapshot vsphere.ManagedObject
+	vmName       string
+	datacenter   string
+	filename     string
+	disk         vsphere.Disk
+}
+
+// runVSphereBackup creates one snapshot for each disk of the virtual machines
+// in opts.VSphereVMs. The data of each disk is stored as a single raw image
+// named vsphere/vm/disk-flat.vmdk.
+func runVSphereBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("--vsphere-vm was specified and files/dirs were listed as arguments")
+	}
+	if opts.Stdin || opts.StdinCommand {
+		return errors.Fatal("--vsphere-vm and --stdin cannot be used together")
+	}
+	if opts.VSphereURL == "" {
+		return errors.Fatal("--vsphere-vm requires --vsphere-url or $RESTIC_VSPHERE_URL")
+	}
+	u, err := url.Parse(opts.VSphereURL)
+	if err != nil || u.Host == "" {
+		return errors.Fatalf("invalid --vsphere-url %q", opts.VSphereURL)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return errors.Fatal("--vsphere-url does not contain a user name")
+	}
+	password, ok := u.User.Password()
+	if !ok {
+		password = os.Getenv("RESTIC_VSPHERE_PASSWORD")
+	}
+
+	client, err := vsphere.NewClient(u, opts.VSphereInsecure)
+	if err != nil {
+		return err
+	}
+	if err := client.Login(ctx, u.User.Username(), password); err != nil {
+		return errors.Fatalf("login to %v failed: %v", u.Host, err)
+	}
+	defer func() {
+		if err := client.Logout(context.Background()); err != nil {
+			debug.Log("logout failed: %v", err)
+		}
+	}()
+
+	for _, vmPath := range opts.VSphereVMs {
+		if err := backupVSphereVM(ctx, client, opts, gopts, term, vmPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backupVSphereVM(ctx context.Context, client *vsphere.Client, opts BackupOptions, gopts GlobalOptions, term *termstatus.Terminal, vmPath string) error {
+	vm, err := client.FindVM(ctx, vmPath)
+	if err != nil {
+		return errors.Fatalf("%v", err)
+	}
+	datacenter, _, _ := strings.Cut(vmPath, "/")
+	vmName := path.Base(vmPath)
+
+	enabled, err := client.ChangeTrackingEnabled(ctx, vm)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		Verbosef("enabling changed block tracking for %v\n", vmPath)
+		if err := client.EnableChangeTracking(ctx, vm); err != nil {
+			Warnf("unable to enable changed block tracking for %v, disks are read completely: %v\n", vmPath, err)
+		}
+	}
+
+	Verbosef("create snapshot of virtual machine %v\n", vmPath)
+	snapshot, err := client.CreateSnapshot(ctx, vm, "restic", "temporary snapshot for a backup by restic", opts.VSphereQuiesce)
+	if err != nil {
+		return errors.Fatalf("unable to create snapshot of %v: %v", vmPath, err)
+	}
+	defer func() {
+		// the snapshot must also be removed if the backup was interrupted
+		if err := client.RemoveSnapshot(context.Background(), snapshot); err != nil {
+			Warnf("unable to remove snapshot of virtual machine %v: %v\n", vmPath, err)
+		}
+	}()
+
+	disks, err := client.Disks(ctx, snapshot)
+	if err != nil {
+		return errors.Fatalf("%v: %v", vmPath, err)
+	}
+	for _, disk := range disks {
+		diskOpts := opts
+		// each disk is read as a single stream, like with --stdin-from-command
+		diskOpts.StdinCommand = true
+		diskOpts.StdinFilename = path.Join("vsphere", vmName, disk.FlatFile())
+		tags := restic.TagList{"vsphere", "vsphere-vm:" + vmName, "vsphere-disk:" + disk.Label}
+		if disk.ChangeID != "" {
+			tags = append(tags, vsphereChangeIDTag+disk.ChangeID)
+		}
+		diskOpts.Tags = append(slices.Clone(opts.Tags), tags)
+		diskOpts.vsphereDisk = &vsphereDisk{
+			client:     client,
+			vm:         vm,
+			snapshot:   snapshot,
+			vmName:     vmName,
+			datacenter: datacenter,
+			filename:   path.Join("/", diskOpts.StdinFilename),
+			disk:       disk,
+		}
+		if err := runBackup(ctx, diskOpts, gopts, term, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open returns a reader for the data of the disk. If the parent snapshot
+// contains the same disk and records its change ID, only the areas changed
+// since then are read from vSphere and the rest is taken from the parent.
+func (d *vsphereDisk) open(ctx context.Context, repo *repository.Repository, parent *restic.Snapshot) (io.ReadCloser, error) {
+	var base io.ReaderAt
+	changeID := "*"
+	if parent != nil && d.disk.ChangeID != "" {
+		if id := parentChangeID(parent); id != "" {
+			node, err := findSnapshotFile(ctx, repo, parent, d.filename)
+			switch {
+			case err != nil:
+				debug.Log("unable to find %v in parent snapshot: %v", d.filename, err)
+			case node.Size != uint64(d.disk.Capacity):
+				debug.Log("size of %v changed, reading all data", d.filename)
+			default:
+				base, err = newSnapshotFileReader(ctx, repo, node)
+				if err != nil {
+					return nil, err
+				}
+				changeID = id
+			}
+		}
+	}
+
+	extents, err := d.client.ChangedAreas(ctx, d.vm, d.snapshot, d.disk, changeID)
+	if err != nil && changeID != "*" {
+		Warnf("unable to query changed areas of %v, reading all data: %v\n", d.disk.Label, err)
+		base, changeID = nil, "*"
+		extents, err = d.client.ChangedAreas(ctx, d.vm, d.snapshot, d.disk, changeID)
+	}
+	if err != nil {
+		// without changed block tracking, the complete disk must be read
+		Warnf("unable to query allocated areas of %v, reading the complete disk: %v\n", d.disk.Label, err)
+		extents = []vsphere.Extent{{Start: 0, Length: d.disk.Capacity}}
+	}
+
+	return d.client.OpenDisk(ctx, d.datacenter, d.disk, extents, base), nil
+}
+
+// parentChangeID returns the CBT change ID recorded in the tags of the
+// snapshot.
+func parentChangeID(sn *restic.Snapshot) string {
+	for _, tag := range sn.Tags {
+		if id, ok := strings.CutPrefix(tag, vsphereChangeIDTag); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// findSnapshotFile returns the node of the file p in the snapshot.
+func findSnapshotFile(ctx context.Context, repo restic.BlobLoader, sn *restic.Snapshot, p string) (*restic.Node, error) {
+	id, err := restic.FindTreeDirectory(ctx, repo, sn.Tree, path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+	tree, err := restic.LoadTree(ctx, repo, *id)
+	if err != nil {
+		return nil, err
+	}
+	node := tree.Find(path.Base(p))
+	if node == nil || node.Type != restic.NodeTypeFile {
+		return nil, errors.Errorf("%v is not a file", p)
+	}
+	return node, nil
+}
+
+// snapshotFileReader reads the content of a file stored in the repository.
+// The last blob is cached, so that sequential reads load each blob once.
+type snapshotFileReader struct {
+	ctx     context.Context
+	repo    *repository.Repository
+	content restic.IDs
+	// cumsize[i] holds the cumulative size of blobs[:i].
+	cumsize []int64
+
+	blobIdx int
+	blob    []byte
+}
+
+func newSnapshotFileReader(ctx context.Context, repo *repository.Repository, node *restic.Node) (*snapshotFileReader, error) {
+	cumsize := make([]int64, 1+len(node.Content))
+	for i, id := range node.Content {
+		size, found := repo.LookupBlobSize(restic.DataBlob, id)
+		if !found {
+			return nil, errors.Errorf("id %v not found in repository", id)
+		}
+		cumsize[i+1] = cumsize[i] + int64(size)
+	}
+	return &snapshotFileReader{ctx: ctx, repo: repo, content: node.Content, cumsize: cumsize, blobIdx: -1}, nil
+}
+
+func (r *snapshotFileReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.cumsize[len(r.cumsize)-1] {
+			return n, io.EOF
+		}
+
+		i := sort.Search(len(r.cumsize), func(i int) bool {
+			return r.cumsize[i] > pos
+		}) - 1
+		if i != r.blobIdx {
+			blob, err := r.repo.LoadBlob(r.ctx, restic.DataBlob, r.content[i], r.blob)
+			if err != nil {
+				return n, err
+			}
+			r.blob, r.blobIdx = blob, i
+		}
+		n += copy(p[n:], r.blob[pos-r.cumsize[i]:])
+	}
+	return n, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSnapshotFileReader(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	data := rtest.Random(23, 5*1024*1024)
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "disk.img"), data, 0600))
+	testRunBackup(t, env.testdata, []string{"disk.img"}, BackupOptions{}, env.gopts)
+	sn := getSnapshot(t, testListSnapshots(t, env.gopts, 1)[0], env)
+
+	ctx, repo, unlock, err := openWithReadLock(context.TODO(), env.gopts, false)
+	rtest.OK(t, err)
+	defer unlock()
+	rtest.OK(t, repo.LoadIndex(ctx, nil))
+
+	node, err := findSnapshotFile(ctx, repo, sn, "/disk.img")
+	rtest.OK(t, err)
+	rd, err := newSnapshotFileReader(ctx, repo, node)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(node.Content) > 1, "expected several blobs, got %d", len(node.Content))
+
+	for _, off := range []int64{0, 1000, 2*1024*1024 + 17, int64(len(data)) - 100} {
+		buf := make([]byte, 1024*1024)
+		n, err := rd.ReadAt(buf, off)
+		if n < len(buf) {
+			rtest.Equals(t, io.EOF, err)
+		}
+		rtest.Assert(t, bytes.Equal(data[off:off+int64(n)], buf[:n]), "wrong data at offset %d", off)
+	}
+
+	_, err = findSnapshotFile(ctx, repo, sn, "/missing.img")
+	rtest.Assert(t, err != nil, "expected error for missing file")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"slices"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/termstatus"
+	"github.com/restic/restic/internal/winshares"
+)
+
+const (
+	// windowsSharesFilename is the name of the file containing the share
+	// definitions in the snapshot.
+	windowsSharesFilename = "windows/shares.json"
+	// windowsSharesTag is the tag of the snapshots of share definitions.
+	windowsSharesTag = "windows-shares"
+)
+
+// runWindowsSharesBackup backs up the files and directories listed in args
+// as usual, and afterwards the definitions of the SMB shares of the host to
+// a separate snapshot containing the single file windows/shares.json.
+func runWindowsSharesBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	if runtime.GOOS != "windows" {
+		return errors.Fatal("--windows-shares is only supported on Windows")
+	}
+	if opts.Stdin || opts.StdinCommand {
+		return errors.Fatal("--windows-shares and --stdin cannot be used together")
+	}
+
+	if len(args) > 0 || len(opts.FilesFrom) > 0 || len(opts.FilesFromVerbatim) > 0 || len(opts.FilesFromRaw) > 0 {
+		if err := runBackup(ctx, opts, gopts, term, args); err != nil {
+			return err
+		}
+	}
+
+	shares, err := winshares.Read()
+	if err != nil {
+		return err
+	}
+	hostname := opts.Host
+	if hostname == "" {
+		hostname, err = os.Hostname()
+		if err != nil {
+			return err
+		}
+	}
+	buf, err := winshares.Definitions{Hostname: hostname, Shares: shares}.Marshal()
+	if err != nil {
+		return err
+	}
+
+	sharesOpts := opts
+	// the definitions are stored as a single stream, like with --stdin-from-command
+	sharesOpts.StdinCommand = true
+	sharesOpts.StdinFilename = windowsSharesFilename
+	sharesOpts.windowsShares = buf
+	sharesOpts.Tags = append(slices.Clone(opts.Tags), restic.TagList{windowsSharesTag})
+	return runBackup(ctx, sharesOpts, gopts, term, nil)
+}
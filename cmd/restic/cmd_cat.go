@@ -10,6 +10,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
 )
 
 var catAllowedCmds = []string{"config", "index", "snapshot", "key", "masterkey", "lock", "pack", "blob", "tree"}
@@ -194,11 +195,9 @@ func runCat(ctx context.Context, gopts GlobalOptions, args []string) error {
 			return errors.Fatalf("could not find snapshot: %v\n", err)
 		}
 
-		bar := newIndexProgress(gopts.Quiet, gopts.JSON)
-		err = repo.LoadIndex(ctx, bar)
-		if err != nil {
-			return err
-		}
+		repo.LoadIndexLazy(func() *progress.Counter {
+			return newIndexProgress(gopts.Quiet, gopts.JSON)
+		})
 
 		sn.Tree, err = restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
 		if err != nil {
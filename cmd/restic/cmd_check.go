@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,9 +16,11 @@ import (
 	"github.com/restic/restic/internal/backend/cache"
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/oplog"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/jsonevents"
 	"github.com/restic/restic/internal/ui/progress"
 	"github.com/restic/restic/internal/ui/termstatus"
 )
@@ -32,14 +35,25 @@ finds. It can also be used to read all data and therefore simulate a restore.
 By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
 
+On hosts with little memory, the "--memory-limit" option limits the memory used
+by the check. The set of referenced blobs is then kept in a temporary file
+instead of in memory and the Go garbage collector runs more often as the limit
+is approached. The temporary file is created in the directory specified by the
+TMPDIR environment variable. Note that the repository index and the list of
+pack files must still fit into memory, they require roughly 80 bytes per blob
+and 100 bytes per pack file.
+
 EXIT STATUS
 ===========
 
 Exit status is 0 if the command was successful.
 Exit status is 1 if there was any error.
+Exit status is 4 if no errors were found, but the repository should be cleaned up using prune or repair index.
 Exit status is 10 if the repository does not exist.
 Exit status is 11 if the repository is already locked.
 Exit status is 12 if the password is incorrect.
+Exit status is 13 if the repository contains errors.
+Exit status is 14 if the storage backend returned an error.
 `,
 	GroupID:           cmdGroupDefault,
 	DisableAutoGenTag: true,
@@ -51,7 +65,12 @@ Exit status is 12 if the password is incorrect.
 			if err != nil && summary.NumErrors == 0 {
 				summary.NumErrors = 1
 			}
-			term.Print(ui.ToJSONString(summary))
+			if events := newJSONEvents(globalOptions, term, "check"); events != nil {
+				summary.MessageType = ""
+				events.Summary(summary)
+			} else {
+				term.Print(ui.ToJSONString(summary))
+			}
 		}
 		return err
 	},
@@ -66,6 +85,7 @@ type CheckOptions struct {
 	ReadDataSubset string
 	CheckUnused    bool
 	WithCache      bool
+	MemoryLimit    string
 }
 
 var checkOptions CheckOptions
@@ -84,6 +104,7 @@ func init() {
 		panic(err)
 	}
 	f.BoolVar(&checkOptions.WithCache, "with-cache", false, "use existing cache, only read uncached data from repository")
+	f.StringVar(&checkOptions.MemoryLimit, "memory-limit", "", "limit memory usage to `size` (allowed suffixes: k/K, m/M, g/G, t/T) by using temporary files")
 }
 
 func checkFlags(opts CheckOptions) error {
@@ -126,6 +147,12 @@ func checkFlags(opts CheckOptions) error {
 
 		}
 	}
+	if opts.MemoryLimit != "" {
+		limit, err := ui.ParseBytes(opts.MemoryLimit)
+		if err != nil || limit <= 0 {
+			return errors.Fatal("check flag --memory-limit has invalid value, please see documentation")
+		}
+	}
 
 	return nil
 }
@@ -224,11 +251,15 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		return summary, errors.Fatal("the check command expects no arguments, only options - please see `restic help check` for usage and flags")
 	}
 
+	events := newJSONEvents(gopts, term, "check")
 	var printer progress.Printer
-	if !gopts.JSON {
-		printer = newTerminalProgressPrinter(gopts.verbosity, term)
-	} else {
+	switch {
+	case events != nil:
+		printer = events
+	case gopts.JSON:
 		printer = newJSONErrorPrinter(term)
+	default:
+		printer = newTerminalProgressPrinter(gopts.verbosity, term)
 	}
 
 	cleanup := prepareCheckCache(opts, &gopts, printer)
@@ -237,6 +268,8 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	if !gopts.NoLock {
 		printer.P("create exclusive lock for repository\n")
 	}
+	// check only verifies the repository and can therefore run on replicas
+	gopts.allowReplica = true
 	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, gopts.NoLock)
 	if err != nil {
 		return summary, err
@@ -244,13 +277,29 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	defer unlock()
 
 	chkr := checker.New(repo, opts.CheckUnused)
+	defer func() {
+		_ = chkr.Close()
+	}()
+	if opts.MemoryLimit != "" {
+		limit, err := ui.ParseBytes(opts.MemoryLimit)
+		if err != nil {
+			return summary, err
+		}
+		debug.SetMemoryLimit(limit)
+		err = chkr.SpillBlobRefs("")
+		if err != nil {
+			return summary, errors.Fatalf("unable to create temporary file: %v", err)
+		}
+	}
+
 	err = chkr.LoadSnapshots(ctx)
 	if err != nil {
 		return summary, err
 	}
 
 	printer.P("load indexes\n")
-	bar := newIndexTerminalProgress(gopts.Quiet, gopts.JSON, term)
+	events.Phase("load index")
+	bar := newIndexEventsProgress(gopts, events, term)
 	hints, errs := chkr.LoadIndex(ctx, bar)
 	if ctx.Err() != nil {
 		return summary, ctx.Err()
@@ -260,10 +309,10 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	for _, hint := range hints {
 		switch hint.(type) {
 		case *checker.ErrDuplicatePacks:
-			term.Print(hint.Error())
+			printHint(term, events, hint)
 			summary.HintRepairIndex = true
 		case *checker.ErrMixedPack:
-			term.Print(hint.Error())
+			printHint(term, events, hint)
 			summary.HintPrune = true
 		default:
 			printer.E("error: %v\n", hint)
@@ -271,10 +320,10 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		}
 	}
 
-	if summary.HintRepairIndex {
+	if summary.HintRepairIndex && events == nil {
 		term.Print("Duplicate packs are non-critical, you can run `restic repair index' to correct this.\n")
 	}
-	if summary.HintPrune {
+	if summary.HintPrune && events == nil {
 		term.Print("Mixed packs with tree and data blobs are non-critical, you can run `restic prune` to correct this.\n")
 	}
 
@@ -286,7 +335,7 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		summary.NumErrors += len(errs)
 		summary.HintRepairIndex = true
 		printer.E("\nThe repository index is damaged and must be repaired. You must run `restic repair index' to correct this.\n\n")
-		return summary, errors.Fatal("repository contains errors")
+		return summary, ErrRepositoryDamaged
 	}
 
 	orphanedPacks := 0
@@ -294,6 +343,7 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	salvagePacks := restic.NewIDSet()
 
 	printer.P("check all packs\n")
+	events.Phase("check packs")
 	go chkr.Packs(ctx, errChan)
 
 	for err := range errChan {
@@ -320,6 +370,7 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		summary.HintPrune = true
 		if !errorsFound {
 			// hide notice if repository is damaged
+			events.Warning("", fmt.Sprintf("%d additional files were found in the repo, which likely contain duplicate data", orphanedPacks))
 			printer.P("%d additional files were found in the repo, which likely contain duplicate data.\nThis is non-critical, you can run `restic prune` to correct this.\n", orphanedPacks)
 		}
 	}
@@ -328,6 +379,7 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	}
 
 	printer.P("check snapshots, trees and blobs\n")
+	events.Phase("check structure")
 	errChan = make(chan error)
 	var wg sync.WaitGroup
 
@@ -361,6 +413,21 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		return summary, ctx.Err()
 	}
 
+	printer.P("check operation log\n")
+	events.Phase("check operation log")
+	opLog, err := oplog.Load(ctx, repo)
+	if err != nil {
+		errorsFound = true
+		summary.NumErrors++
+		printer.E("error: unable to load operation log: %v\n", err)
+	} else {
+		for _, problem := range opLog.Verify() {
+			errorsFound = true
+			summary.NumErrors++
+			printer.E("error: operation log: %v\n", problem)
+		}
+	}
+
 	if opts.CheckUnused {
 		unused, err := chkr.UnusedBlobs(ctx)
 		if err != nil {
@@ -368,11 +435,13 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		}
 		for _, id := range unused {
 			printer.P("unused blob %v\n", id)
+			events.Warning(id.String(), "unused blob")
 			errorsFound = true
 		}
 	}
 
 	doReadData := func(packs map[restic.ID]int64) {
+		events.Phase("read data")
 		p := printer.NewCounter("packs")
 		p.SetMax(uint64(len(packs)))
 		errChan := make(chan error)
@@ -448,9 +517,13 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		if len(salvagePacks) == 0 {
 			printer.E("\nThe repository is damaged and must be repaired. Please follow the troubleshooting guide at https://restic.readthedocs.io/en/stable/077_troubleshooting.html .\n\n")
 		}
-		return summary, errors.Fatal("repository contains errors")
+		return summary, ErrRepositoryDamaged
 	}
 	printer.P("no errors were found\n")
+	if summary.HintRepairIndex || summary.HintPrune {
+		// the repository is fine, but should be cleaned up
+		warningsReported.Store(true)
+	}
 	return summary, nil
 }
 
@@ -499,13 +572,22 @@ func selectRandomPacksByFileSize(allPacks map[restic.ID]int64, subsetSize int64,
 }
 
 type checkSummary struct {
-	MessageType     string   `json:"message_type"` // "summary"
+	MessageType     string   `json:"message_type,omitempty"` // "summary"
 	NumErrors       int      `json:"num_errors"`
 	BrokenPacks     []string `json:"broken_packs"`         // run "restic repair packs ID..." and "restic repair snapshots --forget" to remove damaged files
 	HintRepairIndex bool     `json:"suggest_repair_index"` // run "restic repair index"
 	HintPrune       bool     `json:"suggest_prune"`        // run "restic prune"
 }
 
+// printHint prints a hint about a non-critical problem of the repository.
+func printHint(term *termstatus.Terminal, events *jsonevents.Stream, hint error) {
+	if events != nil {
+		events.Warning("", hint.Error())
+		return
+	}
+	term.Print(hint.Error())
+}
+
 type checkError struct {
 	MessageType string `json:"message_type"` // "error"
 	Message     string `json:"message"`
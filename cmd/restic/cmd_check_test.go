@@ -244,3 +244,12 @@ func TestPrepareDefaultCheckCache(t *testing.T) {
 	_, err = os.ReadDir(gopts.CacheDir)
 	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "Expected cache directory to be removed, but it still exists")
 }
+
+func TestCheckFlagsMemoryLimit(t *testing.T) {
+	rtest.OK(t, checkFlags(CheckOptions{MemoryLimit: "1G"}))
+	rtest.OK(t, checkFlags(CheckOptions{MemoryLimit: "512M"}))
+	for _, limit := range []string{"foo", "0", "-1G"} {
+		err := checkFlags(CheckOptions{MemoryLimit: limit})
+		rtest.Assert(t, err != nil, "expected error for --memory-limit %q", limit)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdChunker = &cobra.Command{
+	Use:   "chunker",
+	Short: "Show and export the chunker parameters of the repository",
+	Long: `
+The "chunker" command shows and exports the chunker profile of the repository.
+The profile consists of the chunker polynomial, which determines how files are
+split into blobs, and the content hash used to compute blob IDs.
+
+Snapshots copied between repositories using "restic copy" only deduplicate
+against the data in the destination repository if both repositories use the
+same profile. Export the profile of an existing repository using "chunker
+export" and pass it to "restic init --chunker-profile" when creating further
+repositories.
+	`,
+	DisableAutoGenTag: true,
+	GroupID:           cmdGroupAdvanced,
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdChunker)
+}
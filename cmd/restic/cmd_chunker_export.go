@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/spf13/cobra"
+)
+
+var cmdChunkerExport = &cobra.Command{
+	Use:   "export [flags] [file]",
+	Short: "Export the chunker profile of the repository",
+	Long: `
+The "export" sub-command writes the chunker profile of the repository as JSON
+to the given file, or to standard output if no file or "-" is given. The file
+can be used to initialize further repositories with the same profile using
+"restic init --chunker-profile".
+
+The chunker polynomial is stored encrypted in the repository, as knowing it
+makes it easier to guess from the sizes of the stored blobs whether a
+repository contains a known file. Keep exported profiles as confidential as
+the repository password.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runChunkerExport(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdChunker.AddCommand(cmdChunkerExport)
+}
+
+func runChunkerExport(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) > 1 {
+		return errors.Fatal("the chunker export command expects at most one file name")
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	buf, err := json.MarshalIndent(repo.Config().ChunkerProfile(), "", "  ")
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+
+	if len(args) == 0 || args[0] == "-" {
+		_, err = globalOptions.stdout.Write(buf)
+		return err
+	}
+
+	err = os.WriteFile(args[0], buf, 0600)
+	if err != nil {
+		return errors.Fatalf("unable to write chunker profile: %v", err)
+	}
+	Verbosef("exported chunker profile to %v\n", args[0])
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var cmdChunkerShow = &cobra.Command{
+	Use:   "show [flags]",
+	Short: "Show the chunker parameters of the repository",
+	Long: `
+The "show" sub-command prints the chunker polynomial and the content hash of
+the repository, together with the chunk sizes used by the chunker.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runChunkerShow(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdChunker.AddCommand(cmdChunkerShow)
+}
+
+func runChunkerShow(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the chunker show command expects no arguments, only options - please see `restic help chunker show` for usage and flags")
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	profile := repo.Config().ChunkerProfile()
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(profile)
+	}
+
+	Printf("chunker polynomial: %v\n", profile.ChunkerPolynomial)
+	Printf("content hash:       %v\n", profile.ContentHash)
+	Printf("chunk size:         %v to %v\n", ui.FormatBytes(chunker.MinSize), ui.FormatBytes(chunker.MaxSize))
+	if previous := repo.Config().PreviousChunkerPolynomial; previous != nil {
+		Printf("rechunking from %v is in progress, run 'restic migrate rechunk' to continue\n", *previous)
+	}
+	return nil
+}
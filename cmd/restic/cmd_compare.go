@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"path"
+	"slices"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var cmdCompare = &cobra.Command{
+	Use:   "compare [flags] snapshotID snapshotID",
+	Short: "Compare two snapshots stored in different repositories",
+	Long: `
+The "compare" command checks whether two snapshots stored in different
+repositories contain the same data, for example to validate that "copy" or an
+external replication produced identical snapshots. The first snapshot is
+loaded from the repository given by "--repo" and the second one from the
+repository given by "--repo2". When using "--from-repo" instead, the first
+snapshot is loaded from that repository and the second one from "--repo".
+
+The first characters in each line display how an item differs:
+
+* +  The item only exists in the second snapshot
+* -  The item only exists in the first snapshot
+* T  The type differs, e.g. a file in one snapshot is a symlink in the other
+* M  The file's content differs
+* U  The metadata (access mode, timestamps, ...) of the item differs
+
+Directories which only exist in one of the snapshots are reported as a whole.
+
+If both repositories use the same chunker parameters (see "restic help
+chunker"), file contents are compared using the IDs of their blobs. Otherwise,
+the content of each file which may differ is read from both repositories and
+compared using its SHA-256 hash, which downloads the data of these files.
+
+Use "latest" to select the latest snapshot of a repository. To only compare
+files in specific subfolders, you can use the "snapshotID:subfolder" syntax,
+where "subfolder" is a path within the snapshot.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the snapshots are identical.
+Exit status is 1 if the snapshots differ or there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCompare(cmd.Context(), compareOptions, globalOptions, args)
+	},
+}
+
+// CompareOptions collects all options for the compare command.
+type CompareOptions struct {
+	secondaryRepoOptions
+}
+
+var compareOptions CompareOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdCompare)
+
+	f := cmdCompare.Flags()
+	initSecondaryRepoOptions(f, &compareOptions.secondaryRepoOptions, "second", "containing the second snapshot")
+}
+
+// CompareStats counts the differences found by compare.
+type CompareStats struct {
+	MessageType     string `json:"message_type"` // "statistics"
+	FirstSnapshot   string `json:"first_snapshot"`
+	SecondSnapshot  string `json:"second_snapshot"`
+	Identical       bool   `json:"identical"`
+	Added           int    `json:"added"`
+	Removed         int    `json:"removed"`
+	TypeChanged     int    `json:"type_changed"`
+	Modified        int    `json:"modified"`
+	MetadataChanged int    `json:"metadata_changed"`
+	HashedBytes     uint64 `json:"hashed_bytes"`
+}
+
+// repoComparer compares two snapshots stored in different repositories.
+type repoComparer struct {
+	repo1, repo2 restic.BlobLoader
+	// sameContentHash is set if both repositories compute blob IDs using the
+	// same hash, then equal IDs imply equal data.
+	sameContentHash bool
+	// sameChunker is set if both repositories also use the same chunker
+	// polynomial, then different blob IDs imply different data.
+	sameChunker bool
+
+	stats       *CompareStats
+	printChange func(change *Change)
+	buf         []byte
+}
+
+// hashContent returns the SHA-256 hash of the data stored in the blobs.
+func (c *repoComparer) hashContent(ctx context.Context, repo restic.BlobLoader, content restic.IDs) ([sha256.Size]byte, error) {
+	h := sha256.New()
+	for _, id := range content {
+		var err error
+		c.buf, err = repo.LoadBlob(ctx, restic.DataBlob, id, c.buf)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		_, _ = h.Write(c.buf)
+		c.stats.HashedBytes += uint64(len(c.buf))
+	}
+
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+// sameContent returns whether both files contain the same data.
+func (c *repoComparer) sameContent(ctx context.Context, node1, node2 *restic.Node) (bool, error) {
+	if node1.Size != node2.Size {
+		return false, nil
+	}
+	if c.sameContentHash && slices.Equal(node1.Content, node2.Content) {
+		return true, nil
+	}
+	if c.sameChunker {
+		return false, nil
+	}
+
+	sum1, err := c.hashContent(ctx, c.repo1, node1.Content)
+	if err != nil {
+		return false, err
+	}
+	sum2, err := c.hashContent(ctx, c.repo2, node2.Content)
+	if err != nil {
+		return false, err
+	}
+	return sum1 == sum2, nil
+}
+
+// sameMetadata compares all attributes of the nodes except for their content.
+func sameMetadata(node1, node2 *restic.Node) bool {
+	n1, n2 := *node1, *node2
+	n1.Content, n2.Content = nil, nil
+	n1.Subtree, n2.Subtree = nil, nil
+	return n1.Equals(n2)
+}
+
+func (c *repoComparer) compareTree(ctx context.Context, prefix string, id1, id2 restic.ID) error {
+	if c.sameContentHash && id1.Equal(id2) {
+		debug.Log("tree %v is identical in both repositories", id1)
+		return nil
+	}
+
+	debug.Log("comparing %v to %v", id1, id2)
+	tree1, err := restic.LoadTree(ctx, c.repo1, id1)
+	if err != nil {
+		return err
+	}
+	tree2, err := restic.LoadTree(ctx, c.repo2, id2)
+	if err != nil {
+		return err
+	}
+
+	tree1Nodes, tree2Nodes, names := uniqueNodeNames(tree1, tree2)
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		node1, t1 := tree1Nodes[name]
+		node2, t2 := tree2Nodes[name]
+		name := path.Join(prefix, name)
+
+		switch {
+		case t1 && t2:
+			if node2.Type == restic.NodeTypeDir {
+				name += "/"
+			}
+
+			mod := ""
+			if node1.Type != node2.Type {
+				mod += "T"
+				c.stats.TypeChanged++
+			} else if node1.Type == restic.NodeTypeFile {
+				same, err := c.sameContent(ctx, node1, node2)
+				if err != nil {
+					return errors.Wrapf(err, "comparing %v", name)
+				}
+				if !same {
+					mod += "M"
+					c.stats.Modified++
+				}
+			}
+			if !sameMetadata(node1, node2) {
+				mod += "U"
+				c.stats.MetadataChanged++
+			}
+			if mod != "" {
+				c.printChange(NewChange(name, mod))
+			}
+
+			if node1.Type == restic.NodeTypeDir && node2.Type == restic.NodeTypeDir {
+				err := c.compareTree(ctx, name, *node1.Subtree, *node2.Subtree)
+				if err != nil {
+					return err
+				}
+			}
+		case t1:
+			if node1.Type == restic.NodeTypeDir {
+				name += "/"
+			}
+			c.printChange(NewChange(name, "-"))
+			c.stats.Removed++
+		case t2:
+			if node2.Type == restic.NodeTypeDir {
+				name += "/"
+			}
+			c.printChange(NewChange(name, "+"))
+			c.stats.Added++
+		}
+	}
+
+	return ctx.Err()
+}
+
+// loadCompareSnapshot loads the snapshot described by desc from repo and
+// returns the ID of its tree, or of the subfolder if one is given.
+func loadCompareSnapshot(ctx context.Context, repo *repository.Repository, desc string) (*restic.Snapshot, restic.ID, error) {
+	sn, subfolder, err := (&restic.SnapshotFilter{}).FindLatest(ctx, repo, repo, desc)
+	if err != nil {
+		return nil, restic.ID{}, errors.Fatal(err.Error())
+	}
+	if sn.Tree == nil {
+		return nil, restic.ID{}, errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+	tree, err := restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+	return sn, *tree, nil
+}
+
+func runCompare(ctx context.Context, opts CompareOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 2 {
+		return errors.Fatalf("specify two snapshot IDs")
+	}
+
+	secondaryGopts, isFromRepo, err := fillSecondaryGlobalOpts(ctx, opts.secondaryRepoOptions, gopts, "second")
+	if err != nil {
+		return err
+	}
+	if isFromRepo {
+		// the first snapshot is stored in the source repository
+		gopts, secondaryGopts = secondaryGopts, gopts
+	}
+
+	ctx, repo1, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ctx, repo2, unlock, err := openWithReadLock(ctx, secondaryGopts, secondaryGopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sn1, tree1, err := loadCompareSnapshot(ctx, repo1, args[0])
+	if err != nil {
+		return err
+	}
+	sn2, tree2, err := loadCompareSnapshot(ctx, repo2, args[1])
+	if err != nil {
+		return err
+	}
+
+	if !gopts.JSON {
+		Verbosef("comparing snapshot %v to %v:\n\n", sn1.ID().Str(), sn2.ID().Str())
+	}
+	for _, repo := range []*repository.Repository{repo1, repo2} {
+		bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+		if err = repo.LoadIndex(ctx, bar); err != nil {
+			return err
+		}
+	}
+
+	stats := &CompareStats{
+		MessageType:    "statistics",
+		FirstSnapshot:  sn1.ID().String(),
+		SecondSnapshot: sn2.ID().String(),
+	}
+	profile1, profile2 := repo1.Config().ChunkerProfile(), repo2.Config().ChunkerProfile()
+	c := &repoComparer{
+		repo1:           repo1,
+		repo2:           repo2,
+		sameContentHash: profile1.ContentHash == profile2.ContentHash,
+		sameChunker:     profile1 == profile2,
+		stats:           stats,
+		printChange: func(change *Change) {
+			Printf("%-5s%v\n", change.Modifier, change.Path)
+		},
+	}
+	if !c.sameChunker {
+		Verbosef("repositories use different chunker parameters, comparing file contents by their hash\n")
+	}
+
+	if gopts.JSON {
+		enc := json.NewEncoder(globalOptions.stdout)
+		c.printChange = func(change *Change) {
+			err := enc.Encode(change)
+			if err != nil {
+				Warnf("JSON encode failed: %v\n", err)
+			}
+		}
+	}
+	if gopts.Quiet {
+		c.printChange = func(_ *Change) {}
+	}
+
+	err = c.compareTree(ctx, "/", tree1, tree2)
+	if err != nil {
+		return err
+	}
+
+	stats.Identical = stats.Added+stats.Removed+stats.TypeChanged+stats.Modified+stats.MetadataChanged == 0
+	if gopts.JSON {
+		err := json.NewEncoder(globalOptions.stdout).Encode(stats)
+		if err != nil {
+			Warnf("JSON encode failed: %v\n", err)
+		}
+	} else {
+		Printf("\n")
+		Printf("Items:       %5d added, %5d removed, %5d type changed\n", stats.Added, stats.Removed, stats.TypeChanged)
+		Printf("Files:       %5d modified\n", stats.Modified)
+		Printf("Metadata:    %5d changed\n", stats.MetadataChanged)
+		Printf("Hashed:      %v\n", ui.FormatBytes(stats.HashedBytes))
+	}
+
+	if !stats.Identical {
+		return errors.Fatal("snapshots differ")
+	}
+	if !gopts.JSON {
+		Printf("snapshots are identical\n")
+	}
+	return nil
+}
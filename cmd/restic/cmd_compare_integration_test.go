@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunCompare(gopts GlobalOptions, secondGopts GlobalOptions, firstSnapshotID string, secondSnapshotID string) (string, error) {
+	buf, err := withCaptureStdout(func() error {
+		opts := CompareOptions{
+			secondaryRepoOptions: secondaryRepoOptions{
+				LegacyRepo: secondGopts.Repo,
+				password:   secondGopts.password,
+			},
+		}
+		return runCompare(context.TODO(), opts, gopts, []string{firstSnapshotID, secondSnapshotID})
+	})
+	return buf.String(), err
+}
+
+func TestCompare(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+	env3, cleanup3 := withTestEnvironment(t)
+	defer cleanup3()
+
+	testSetupBackupData(t, env)
+	datadir := filepath.Join(env.testdata, "0", "0", "9")
+	testRunBackup(t, "", []string{datadir}, BackupOptions{}, env.gopts)
+
+	// env2 uses a different chunker polynomial, env3 the same one
+	testRunInit(t, env2.gopts)
+	testRunCopy(t, env.gopts, env2.gopts)
+	rtest.OK(t, runInit(context.TODO(), InitOptions{
+		secondaryRepoOptions:  secondaryRepoOptions{Repo: env.gopts.Repo, password: env.gopts.password},
+		CopyChunkerParameters: true,
+	}, env3.gopts, nil))
+	testRunCopy(t, env.gopts, env3.gopts)
+
+	for _, gopts := range []GlobalOptions{env2.gopts, env3.gopts} {
+		out, err := testRunCompare(env.gopts, gopts, "latest", "latest")
+		rtest.OK(t, err)
+		rtest.Assert(t, strings.Contains(out, "snapshots are identical"), "unexpected output %v", out)
+	}
+
+	// modify a file and back it up to the second repository only
+	var modified string
+	entries, err := os.ReadDir(datadir)
+	rtest.OK(t, err)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			modified = entry.Name()
+			break
+		}
+	}
+	rtest.Assert(t, modified != "", "no file found in %v", datadir)
+	f, err := os.OpenFile(filepath.Join(datadir, modified), os.O_WRONLY|os.O_APPEND, 0)
+	rtest.OK(t, err)
+	_, err = f.Write([]byte("modified"))
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+	rtest.OK(t, os.WriteFile(filepath.Join(datadir, "new-file"), []byte("new"), 0600))
+
+	for _, gopts := range []GlobalOptions{env2.gopts, env3.gopts} {
+		testRunBackup(t, "", []string{datadir}, BackupOptions{}, gopts)
+
+		env.gopts.JSON = true
+		out, err := testRunCompare(env.gopts, gopts, "latest", "latest")
+		env.gopts.JSON = false
+		rtest.Assert(t, err != nil, "expected error for different snapshots")
+
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		var stats CompareStats
+		rtest.OK(t, json.Unmarshal([]byte(lines[len(lines)-1]), &stats))
+		rtest.Assert(t, !stats.Identical, "snapshots must not be identical")
+		rtest.Equals(t, 1, stats.Added)
+		rtest.Equals(t, 1, stats.Modified)
+		rtest.Assert(t, strings.Contains(out, modified), "modified file %v not reported in %v", modified, out)
+	}
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/jsonevents"
+	"github.com/restic/restic/internal/ui/termstatus"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/spf13/cobra"
@@ -28,8 +31,18 @@ NOTE: The copying process does not re-chunk files, which may break deduplication
 between the files copied and files already stored in the destination repository.
 This means that copied files, which existed in both the source and destination
 repository, /may occupy up to twice their space/ in the destination repository.
-This can be mitigated by the "--copy-chunker-params" option when initializing a
-new destination repository using the "init" command.
+This can be mitigated by the "--copy-chunker-params" or "--chunker-profile"
+options when initializing a new destination repository using the "init"
+command, see "restic help chunker".
+
+Snapshots can only be copied between repositories which use the same content
+hash (see "restic help init").
+
+The snapshots to copy can be selected using the --host, --tag and --path
+filters, and restricted to a time range using --since and --until. The
+copied snapshots can be modified in the destination repository using
+--set-host, --add-tag and --remove-tag, for example to split a repository into
+several repositories per team or retention class.
 
 EXIT STATUS
 ===========
@@ -43,7 +56,9 @@ Exit status is 12 if the password is incorrect.
 	GroupID:           cmdGroupDefault,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runCopy(cmd.Context(), copyOptions, globalOptions, args)
+		term, cancel := setupTermstatus()
+		defer cancel()
+		return runCopy(cmd.Context(), copyOptions, globalOptions, args, term)
 	},
 }
 
@@ -51,6 +66,10 @@ Exit status is 12 if the password is incorrect.
 type CopyOptions struct {
 	secondaryRepoOptions
 	restic.SnapshotFilter
+
+	SetHost    string
+	AddTags    restic.TagLists
+	RemoveTags restic.TagLists
 }
 
 var copyOptions CopyOptions
@@ -61,9 +80,26 @@ func init() {
 	f := cmdCopy.Flags()
 	initSecondaryRepoOptions(f, &copyOptions.secondaryRepoOptions, "destination", "to copy snapshots from")
 	initMultiSnapshotFilter(f, &copyOptions.SnapshotFilter, true)
+	f.StringVar(&copyOptions.SetHost, "set-host", "", "set the `hostname` of the copied snapshots")
+	f.Var(&copyOptions.AddTags, "add-tag", "add `tags` to the copied snapshots in the format `tag[,tag,...]` (can be specified multiple times)")
+	f.Var(&copyOptions.RemoveTags, "remove-tag", "remove `tags` from the copied snapshots in the format `tag[,tag,...]` (can be specified multiple times)")
+}
+
+// transformsSnapshots returns whether the copied snapshots are modified.
+func (opts CopyOptions) transformsSnapshots() bool {
+	return opts.SetHost != "" || len(opts.AddTags) > 0 || len(opts.RemoveTags) > 0
 }
 
-func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []string) error {
+// transformSnapshot applies the requested modifications to a copied snapshot.
+func (opts CopyOptions) transformSnapshot(sn *restic.Snapshot) {
+	if opts.SetHost != "" {
+		sn.Hostname = opts.SetHost
+	}
+	sn.AddTags(opts.AddTags.Flatten())
+	sn.RemoveTags(opts.RemoveTags.Flatten())
+}
+
+func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []string, term *termstatus.Terminal) error {
 	secondaryGopts, isFromRepo, err := fillSecondaryGlobalOpts(ctx, opts.secondaryRepoOptions, gopts, "destination")
 	if err != nil {
 		return err
@@ -72,6 +108,16 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 		// swap global options, if the secondary repo was set via from-repo
 		gopts, secondaryGopts = secondaryGopts, gopts
 	}
+	// copy keeps replicas up to date
+	secondaryGopts.allowReplica = true
+
+	var signingKey ed25519.PrivateKey
+	if opts.transformsSnapshots() {
+		signingKey, err = loadSigningKey(gopts.SigningKeyFile)
+		if err != nil {
+			return err
+		}
+	}
 
 	ctx, srcRepo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
 	if err != nil {
@@ -85,6 +131,14 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 	}
 	defer unlock()
 
+	if srcRepo.Config().ContentHashName() != dstRepo.Config().ContentHashName() {
+		return errors.Fatalf("cannot copy snapshots between repositories with different content hashes (%v and %v)",
+			srcRepo.Config().ContentHashName(), dstRepo.Config().ContentHashName())
+	}
+	if srcRepo.Config().ChunkerPolynomial != dstRepo.Config().ChunkerPolynomial {
+		Verbosef("source and destination repository use different chunker parameters, copied files do not deduplicate against other files in the destination, see `restic help chunker`\n")
+	}
+
 	srcSnapshotLister, err := restic.MemorizeList(ctx, srcRepo, restic.SnapshotFile)
 	if err != nil {
 		return err
@@ -95,19 +149,28 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 		return err
 	}
 
+	events := newJSONEvents(gopts, term, "copy")
+	events.Phase("load index")
+
 	debug.Log("Loading source index")
-	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	bar := newIndexEventsProgress(gopts, events, term)
 	if err := srcRepo.LoadIndex(ctx, bar); err != nil {
 		return err
 	}
-	bar = newIndexProgress(gopts.Quiet, gopts.JSON)
+	bar = newIndexEventsProgress(gopts, events, term)
 	debug.Log("Loading destination index")
 	if err := dstRepo.LoadIndex(ctx, bar); err != nil {
 		return err
 	}
 
+	dstFilter := &opts.SnapshotFilter
+	if opts.transformsSnapshots() {
+		// the copied snapshots may no longer match the host and tag filters
+		dstFilter = &restic.SnapshotFilter{}
+	}
+
 	dstSnapshotByOriginal := make(map[restic.ID][]*restic.Snapshot)
-	for sn := range FindFilteredSnapshots(ctx, dstSnapshotLister, dstRepo, &opts.SnapshotFilter, nil) {
+	for sn := range FindFilteredSnapshots(ctx, dstSnapshotLister, dstRepo, dstFilter, nil) {
 		if sn.Original != nil && !sn.Original.IsNull() {
 			dstSnapshotByOriginal[*sn.Original] = append(dstSnapshotByOriginal[*sn.Original], sn)
 		}
@@ -120,8 +183,15 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 
 	// remember already processed trees across all snapshots
 	visitedTrees := restic.NewIDSet()
+	var summary copySummary
+
+	events.Phase("copy")
 
 	for sn := range FindFilteredSnapshots(ctx, srcSnapshotLister, srcRepo, &opts.SnapshotFilter, args) {
+		if opts.transformsSnapshots() {
+			opts.transformSnapshot(sn)
+		}
+
 		// check whether the destination has a snapshot with the same persistent ID which has similar snapshot fields
 		srcOriginal := *sn.ID()
 		if sn.Original != nil {
@@ -132,20 +202,27 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 			isCopy := false
 			for _, originalSn := range originalSns {
 				if similarSnapshots(originalSn, sn) {
-					Verboseff("\n%v\n", sn)
-					Verboseff("skipping source snapshot %s, was already copied to snapshot %s\n", sn.ID().Str(), originalSn.ID().Str())
+					if events == nil {
+						Verboseff("\n%v\n", sn)
+						Verboseff("skipping source snapshot %s, was already copied to snapshot %s\n", sn.ID().Str(), originalSn.ID().Str())
+					}
 					isCopy = true
 					break
 				}
 			}
 			if isCopy {
+				summary.SnapshotsSkipped++
 				continue
 			}
 		}
-		Verbosef("\n%v\n", sn)
-		Verbosef("  copy started, this may take a while...\n")
-		if err := copyTree(ctx, srcRepo, dstRepo, visitedTrees, *sn.Tree, gopts.Quiet); err != nil {
-			return err
+		if events == nil {
+			Verbosef("\n%v\n", sn)
+			Verbosef("  copy started, this may take a while...\n")
+		}
+		for _, treeID := range sn.TreeIDs() {
+			if err := copyTree(ctx, srcRepo, dstRepo, visitedTrees, treeID, gopts.Quiet, events); err != nil {
+				return err
+			}
 		}
 		debug.Log("tree copied")
 
@@ -155,13 +232,31 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 		if sn.Original == nil {
 			sn.Original = sn.ID()
 		}
+		if opts.transformsSnapshots() {
+			if err := updateSnapshotSignature(sn, signingKey); err != nil {
+				return err
+			}
+		}
 		newID, err := restic.SaveSnapshot(ctx, dstRepo, sn)
 		if err != nil {
 			return err
 		}
-		Verbosef("snapshot %s saved\n", newID.Str())
+		if events == nil {
+			Verbosef("snapshot %s saved\n", newID.Str())
+		}
+		summary.SnapshotsCopied++
 	}
-	return ctx.Err()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	events.Summary(summary)
+	return nil
+}
+
+// copySummary is the summary reported by --json-events.
+type copySummary struct {
+	SnapshotsCopied  uint `json:"snapshots_copied"`
+	SnapshotsSkipped uint `json:"snapshots_skipped"`
 }
 
 func similarSnapshots(sna *restic.Snapshot, snb *restic.Snapshot) bool {
@@ -184,7 +279,7 @@ func similarSnapshots(sna *restic.Snapshot, snb *restic.Snapshot) bool {
 }
 
 func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Repository,
-	visitedTrees restic.IDSet, rootTreeID restic.ID, quiet bool) error {
+	visitedTrees restic.IDSet, rootTreeID restic.ID, quiet bool, events *jsonevents.Stream) error {
 
 	wg, wgCtx := errgroup.WithContext(ctx)
 
@@ -220,8 +315,9 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 
 			for _, entry := range tree.Nodes {
 				// Recursion into directories is handled by StreamTrees
-				// Copy the blobs for this file.
-				for _, blobID := range entry.Content {
+				// Copy the blobs for this file, including its alternate
+				// data streams.
+				for _, blobID := range entry.DataBlobs() {
 					h := restic.BlobHandle{Type: restic.DataBlob, ID: blobID}
 					if _, ok := dstRepo.LookupBlobSize(h.Type, h.ID); !ok {
 						enqueue(h)
@@ -236,7 +332,10 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 		return err
 	}
 
-	bar := newProgressMax(!quiet, uint64(len(packList)), "packs copied")
+	bar := newProgressMax(!quiet && events == nil, uint64(len(packList)), "packs copied")
+	if events != nil {
+		bar = events.NewCounterMax("packs copied", uint64(len(packList)))
+	}
 	_, err = repository.Repack(
 		ctx,
 		srcRepo,
@@ -244,7 +343,13 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 		packList,
 		copyBlobs,
 		bar,
-		func(msg string, args ...interface{}) { fmt.Printf(msg+"\n", args...) },
+		func(msg string, args ...interface{}) {
+			if events != nil {
+				events.Warning("", fmt.Sprintf(msg, args...))
+				return
+			}
+			fmt.Printf(msg+"\n", args...)
+		},
 	)
 	bar.Done()
 	if err != nil {
@@ -5,24 +5,31 @@ import (
 	"fmt"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
 )
 
 func testRunCopy(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions) {
+	testRunCopyWithOptions(t, srcGopts, dstGopts, CopyOptions{})
+}
+
+func testRunCopyWithOptions(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions, copyOpts CopyOptions) {
 	gopts := srcGopts
 	gopts.Repo = dstGopts.Repo
 	gopts.password = dstGopts.password
 	gopts.InsecureNoPassword = dstGopts.InsecureNoPassword
-	copyOpts := CopyOptions{
-		secondaryRepoOptions: secondaryRepoOptions{
-			Repo:               srcGopts.Repo,
-			password:           srcGopts.password,
-			InsecureNoPassword: srcGopts.InsecureNoPassword,
-		},
+	copyOpts.secondaryRepoOptions = secondaryRepoOptions{
+		Repo:               srcGopts.Repo,
+		password:           srcGopts.password,
+		InsecureNoPassword: srcGopts.InsecureNoPassword,
 	}
 
-	rtest.OK(t, runCopy(context.TODO(), copyOpts, gopts, nil))
+	rtest.OK(t, withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runCopy(ctx, copyOpts, gopts, nil, term)
+	}))
 }
 
 func TestCopy(t *testing.T) {
@@ -155,3 +162,39 @@ func TestCopyToEmptyPassword(t *testing.T) {
 	testListSnapshots(t, env2.gopts, 1)
 	testRunCheck(t, env2.gopts)
 }
+
+func TestCopyFilteredTransform(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	target := []string{filepath.Join(env.testdata, "0", "0", "9")}
+	testRunBackup(t, "", target, BackupOptions{TimeStamp: "2023-01-10 10:00:00", Host: "team-a"}, env.gopts)
+	testRunBackup(t, "", target, BackupOptions{TimeStamp: "2023-02-10 10:00:00", Host: "team-a"}, env.gopts)
+	testRunBackup(t, "", target, BackupOptions{TimeStamp: "2023-02-11 10:00:00", Host: "team-b"}, env.gopts)
+
+	testRunInit(t, env2.gopts)
+	since, err := parseTime("2023-02-01")
+	rtest.OK(t, err)
+	copyOpts := CopyOptions{
+		SnapshotFilter: restic.SnapshotFilter{Hosts: []string{"team-a"}, Since: since},
+		SetHost:        "archive",
+		AddTags:        restic.TagLists{restic.TagList{"team-a"}},
+	}
+	testRunCopyWithOptions(t, env.gopts, env2.gopts, copyOpts)
+
+	_, snapshots := testRunSnapshots(t, env2.gopts)
+	rtest.Equals(t, 1, len(snapshots))
+	for _, sn := range snapshots {
+		rtest.Equals(t, "archive", sn.Hostname)
+		rtest.Equals(t, []string{"team-a"}, sn.Tags)
+		rtest.Equals(t, 2023, sn.Time.Year())
+		rtest.Equals(t, time.February, sn.Time.Month())
+	}
+
+	// copying again must not create duplicates
+	testRunCopyWithOptions(t, env.gopts, env2.gopts, copyOpts)
+	testListSnapshots(t, env2.gopts, 1)
+}
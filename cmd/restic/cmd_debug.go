@@ -201,7 +201,7 @@ var cmdDebugExamine = &cobra.Command{
 	},
 }
 
-func tryRepairWithBitflip(ctx context.Context, key *crypto.Key, input []byte, bytewise bool) []byte {
+func tryRepairWithBitflip(ctx context.Context, cfg restic.Config, key *crypto.Key, input []byte, bytewise bool) []byte {
 	if bytewise {
 		Printf("        trying to repair blob by finding a broken byte\n")
 	} else {
@@ -231,7 +231,7 @@ func tryRepairWithBitflip(ctx context.Context, key *crypto.Key, input []byte, by
 				if err == nil {
 					Printf("\n")
 					Printf("        blob could be repaired by XORing byte %v with 0x%02x\n", idx, pattern)
-					Printf("        hash is %v\n", restic.Hash(plaintext))
+					Printf("        hash is %v\n", cfg.BlobHash(plaintext))
 					close(done)
 					found = true
 					fixed = plaintext
@@ -351,7 +351,7 @@ func loadBlobs(ctx context.Context, opts DebugExamineOptions, repo restic.Reposi
 			if err != nil {
 				Warnf("error decrypting blob: %v\n", err)
 				if opts.TryRepair || opts.RepairByte {
-					plaintext = tryRepairWithBitflip(ctx, key, buf, opts.RepairByte)
+					plaintext = tryRepairWithBitflip(ctx, repo.Config(), key, buf, opts.RepairByte)
 				}
 				if plaintext != nil {
 					outputPrefix = "repaired "
@@ -376,7 +376,7 @@ func loadBlobs(ctx context.Context, opts DebugExamineOptions, repo restic.Reposi
 				}
 			}
 
-			id := restic.Hash(plaintext)
+			id := repo.Config().BlobHash(plaintext)
 			var prefix string
 			if !id.Equal(blob.ID) {
 				Printf("         successfully %vdecrypted blob (length %v), hash is %v, ID does not match, wanted %v\n", outputPrefix, len(plaintext), id, blob.ID)
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"github.com/restic/restic/internal/dump"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 
 	"github.com/spf13/cobra"
 )
@@ -31,6 +33,12 @@ To include the folder content at the root of the archive, you can use the
 "snapshotID:subfolder" syntax, where "subfolder" is a path within the
 snapshot.
 
+With "--seekable", the output is compressed using the zstd seekable format.
+The data is split into independently compressed frames, followed by an index
+of all frames. Tools which support the format can read any part of the output
+without decompressing everything before it, which is useful for large files
+like VM images or database dumps. The output is also a valid zstd file.
+
 EXIT STATUS
 ===========
 
@@ -50,8 +58,10 @@ Exit status is 12 if the password is incorrect.
 // DumpOptions collects all options for the dump command.
 type DumpOptions struct {
 	restic.SnapshotFilter
-	Archive string
-	Target  string
+	Archive           string
+	Target            string
+	Seekable          bool
+	SeekableFrameSize string
 }
 
 var dumpOptions DumpOptions
@@ -63,6 +73,8 @@ func init() {
 	initSingleSnapshotFilter(flags, &dumpOptions.SnapshotFilter)
 	flags.StringVarP(&dumpOptions.Archive, "archive", "a", "tar", "set archive `format` as \"tar\" or \"zip\"")
 	flags.StringVarP(&dumpOptions.Target, "target", "t", "", "write the output to target `path`")
+	flags.BoolVar(&dumpOptions.Seekable, "seekable", false, "compress the output using the zstd seekable format")
+	flags.StringVar(&dumpOptions.SeekableFrameSize, "seekable-frame-size", "4M", "uncompressed `size` of each frame for --seekable (allowed suffixes: k/K, m/M, g/G)")
 }
 
 func splitPath(p string) []string {
@@ -133,6 +145,20 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 		return fmt.Errorf("unknown archive format %q", opts.Archive)
 	}
 
+	frameSize, err := ui.ParseBytes(opts.SeekableFrameSize)
+	if err != nil {
+		return errors.Fatalf("invalid --seekable-frame-size: %v", err)
+	}
+	if frameSize <= 0 || frameSize > dump.MaxSeekableFrameSize {
+		return errors.Fatalf("--seekable-frame-size must be between 1 byte and %v", ui.FormatBytes(dump.MaxSeekableFrameSize))
+	}
+	if opts.Seekable && opts.Target == "" {
+		// compressed output is never printed to a terminal
+		if err := checkStdoutArchive(); err != nil {
+			return err
+		}
+	}
+
 	snapshotIDString := args[0]
 	pathToPrint := args[1]
 
@@ -171,7 +197,7 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 		return errors.Fatalf("loading tree for snapshot %q failed: %v", snapshotIDString, err)
 	}
 
-	outputFileWriter := os.Stdout
+	var outputFileWriter io.Writer = os.Stdout
 	canWriteArchiveFunc := checkStdoutArchive
 
 	if opts.Target != "" {
@@ -187,12 +213,26 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 		canWriteArchiveFunc = func() error { return nil }
 	}
 
+	var seekable *dump.SeekableWriter
+	if opts.Seekable {
+		seekable, err = dump.NewSeekableWriter(outputFileWriter, int(frameSize))
+		if err != nil {
+			return err
+		}
+		outputFileWriter = seekable
+	}
+
 	d := dump.New(opts.Archive, repo, outputFileWriter)
 	err = printFromTree(ctx, tree, repo, "/", splittedPath, d, canWriteArchiveFunc)
 	if err != nil {
 		return errors.Fatalf("cannot dump file: %v", err)
 	}
 
+	if seekable != nil {
+		if err := seekable.Close(); err != nil {
+			return errors.Fatalf("cannot dump file: %v", err)
+		}
+	}
 	return nil
 }
 
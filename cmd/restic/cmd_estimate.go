@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdEstimate = &cobra.Command{
+	Use:   "estimate",
+	Short: "Estimate the cost of operations before running them",
+	Long: `
+The "estimate" command calculates how much data an operation would transfer
+without running it, for example to plan the egress cost of a restore from a
+cloud repository.
+	`,
+	DisableAutoGenTag: true,
+	GroupID:           cmdGroupDefault,
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdEstimate)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/restorer"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/walker"
+	"github.com/spf13/cobra"
+)
+
+var cmdEstimateRestore = &cobra.Command{
+	Use:   "restore [flags] snapshotID [path...]",
+	Short: "Estimate the data downloaded by a restore",
+	Long: `
+The "estimate restore" command reports how many files a restore of the given
+snapshot would create, their total size, and how much data would be downloaded
+from the backend to restore them. No data is downloaded to calculate the
+estimate, only the index and the trees of the snapshot are read.
+
+The restore can be limited to directories or files within the snapshot by
+listing their absolute paths after the snapshot ID, or by using the
+"snapshotID:subfolder" syntax like the "restore" command.
+
+The download size counts each blob used by the selected files once. As restic
+reads the blobs of a pack file using as few requests as possible, unused parts
+of pack files located between needed blobs are also downloaded and included in
+the estimate. Tree blobs are reported separately, they are usually read from
+the local cache. Files which already exist in the target directory and are
+skipped by the restore command are not taken into account, the estimate is
+therefore an upper bound.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runEstimateRestore(cmd.Context(), estimateRestoreOptions, globalOptions, args)
+	},
+}
+
+// EstimateRestoreOptions collects all options for the estimate restore command.
+type EstimateRestoreOptions struct {
+	restic.SnapshotFilter
+}
+
+var estimateRestoreOptions EstimateRestoreOptions
+
+func init() {
+	cmdEstimate.AddCommand(cmdEstimateRestore)
+
+	initSingleSnapshotFilter(cmdEstimateRestore.Flags(), &estimateRestoreOptions.SnapshotFilter)
+}
+
+// RestoreEstimate is the result of the estimate restore command.
+type RestoreEstimate struct {
+	SnapshotID string `json:"snapshot_id"`
+
+	Files        uint64 `json:"files"`
+	Dirs         uint64 `json:"dirs"`
+	Others       uint64 `json:"others"`
+	TotalSize    uint64 `json:"total_size"`
+	DataBlobs    uint64 `json:"data_blobs"`
+	DataSize     uint64 `json:"data_size"`
+	Packs        uint64 `json:"packs"`
+	Requests     uint64 `json:"requests"`
+	DownloadSize uint64 `json:"download_size"`
+	TreeBlobs    uint64 `json:"tree_blobs"`
+	TreeSize     uint64 `json:"tree_size"`
+}
+
+func runEstimateRestore(ctx context.Context, opts EstimateRestoreOptions, gopts GlobalOptions, args []string) error {
+	if len(args) == 0 {
+		return errors.Fatal("no snapshot ID specified")
+	}
+	paths := args[1:]
+	for _, p := range paths {
+		if !path.IsAbs(p) {
+			return errors.Fatalf("path %q is not absolute", p)
+		}
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sn, subfolder, err := opts.SnapshotFilter.FindLatest(ctx, repo, repo, args[0])
+	if err != nil {
+		return errors.Fatalf("failed to find snapshot: %v", err)
+	}
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	if err := repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	tree, err := restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
+	if err != nil {
+		return err
+	}
+
+	est, err := estimateRestore(ctx, repo, *tree, paths)
+	if err != nil {
+		return err
+	}
+	est.SnapshotID = sn.ID().String()
+
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(est)
+	}
+
+	Printf("snapshot %v of %v at %v\n", sn.ID().Str(), sn.Paths, sn.Time)
+	Printf("  Files:          %d\n", est.Files)
+	Printf("  Dirs:           %d\n", est.Dirs)
+	if est.Others > 0 {
+		Printf("  Others:         %d\n", est.Others)
+	}
+	Printf("  Total size:     %v\n", ui.FormatBytes(est.TotalSize))
+	Printf("  Unique blobs:   %d (%v stored)\n", est.DataBlobs, ui.FormatBytes(est.DataSize))
+	Printf("  Packs:          %d\n", est.Packs)
+	Printf("  Download:       %v in %d requests\n", ui.FormatBytes(est.DownloadSize), est.Requests)
+	Printf("  Tree blobs:     %d (%v stored, usually cached)\n", est.TreeBlobs, ui.FormatBytes(est.TreeSize))
+	return nil
+}
+
+// estimateRestore calculates the data needed to restore the files in tree which
+// are within one of paths, or all files if paths is empty.
+func estimateRestore(ctx context.Context, repo restic.Repository, tree restic.ID, paths []string) (*RestoreEstimate, error) {
+	est := &RestoreEstimate{}
+
+	// selected reports whether the node at nodepath is restored, descend
+	// whether the node may contain restored nodes
+	selected := func(nodepath string) (selected bool, descend bool) {
+		if len(paths) == 0 {
+			return true, true
+		}
+		for _, p := range paths {
+			if fs.HasPathPrefix(p, nodepath) {
+				return true, true
+			}
+			if fs.HasPathPrefix(nodepath, p) {
+				descend = true
+			}
+		}
+		return false, descend
+	}
+
+	dataBlobs := restic.NewIDSet()
+	trees := restic.NewIDSet(tree)
+	hardlinks := restorer.NewHardlinkIndex[struct{}]()
+
+	err := walker.Walk(ctx, repo, tree, walker.WalkVisitor{
+		ProcessNode: func(_ restic.ID, nodepath string, node *restic.Node, err error) error {
+			if err != nil {
+				return err
+			}
+			if node == nil {
+				return nil
+			}
+
+			sel, descend := selected(nodepath)
+			if node.Type == restic.NodeTypeDir {
+				if !descend {
+					return walker.ErrSkipNode
+				}
+				trees.Insert(*node.Subtree)
+			}
+			if !sel {
+				return nil
+			}
+
+			switch node.Type {
+			case restic.NodeTypeDir:
+				est.Dirs++
+				return nil
+			case restic.NodeTypeFile:
+				est.Files++
+			default:
+				est.Others++
+				return nil
+			}
+
+			if node.Links > 1 {
+				// hard links are restored by linking to the first file
+				if hardlinks.Has(node.Inode, node.DeviceID) {
+					return nil
+				}
+				hardlinks.Add(node.Inode, node.DeviceID, struct{}{})
+			}
+			est.TotalSize += node.Size
+			for _, id := range node.Content {
+				dataBlobs.Insert(id)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range trees {
+		pbs := repo.LookupBlob(restic.TreeBlob, id)
+		if len(pbs) == 0 {
+			return nil, errors.Errorf("tree %v not found in index", id.Str())
+		}
+		est.TreeBlobs++
+		est.TreeSize += uint64(pbs[0].Length)
+	}
+
+	packs := make(map[restic.ID][]restic.Blob)
+	for id := range dataBlobs {
+		pbs := repo.LookupBlob(restic.DataBlob, id)
+		if len(pbs) == 0 {
+			return nil, errors.Errorf("data blob %v not found in index", id.Str())
+		}
+		est.DataBlobs++
+		est.DataSize += uint64(pbs[0].Length)
+		packs[pbs[0].PackID] = append(packs[pbs[0].PackID], pbs[0].Blob)
+	}
+
+	for packID, blobs := range packs {
+		requests, size, err := repository.PackDownloadSize(packID, blobs)
+		if err != nil {
+			return nil, err
+		}
+		est.Packs++
+		est.Requests += uint64(requests)
+		est.DownloadSize += size
+	}
+	return est, nil
+}
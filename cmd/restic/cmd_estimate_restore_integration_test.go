@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunEstimateRestore(t testing.TB, gopts GlobalOptions, args ...string) RestoreEstimate {
+	gopts.JSON = true
+	buf, err := withCaptureStdout(func() error {
+		return runEstimateRestore(context.TODO(), EstimateRestoreOptions{}, gopts, args)
+	})
+	rtest.OK(t, err)
+
+	var est RestoreEstimate
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &est))
+	return est
+}
+
+func TestEstimateRestore(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	est := testRunEstimateRestore(t, env.gopts, snapshotID.String())
+	rtest.Equals(t, snapshotID.String(), est.SnapshotID)
+	rtest.Assert(t, est.Files > 0 && est.Dirs > 0, "no files or directories counted: %+v", est)
+	rtest.Assert(t, est.TotalSize > 0, "total size is zero")
+	rtest.Assert(t, est.DataBlobs > 0 && est.Packs > 0, "no data blobs counted: %+v", est)
+	rtest.Assert(t, est.Requests >= est.Packs, "less requests than packs: %+v", est)
+	rtest.Assert(t, est.DownloadSize >= est.DataSize, "download size %d smaller than data size %d", est.DownloadSize, est.DataSize)
+	rtest.Assert(t, est.TreeBlobs > 0, "no trees counted")
+
+	// the restore size must match the one reported by the stats command
+	gopts := env.gopts
+	gopts.JSON = true
+	buf, err := withCaptureStdout(func() error {
+		return runStats(context.TODO(), StatsOptions{countMode: countModeRestoreSize}, gopts, []string{snapshotID.String()})
+	})
+	rtest.OK(t, err)
+	var stats statsContainer
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &stats))
+	rtest.Equals(t, stats.TotalSize, est.TotalSize)
+
+	if runtime.GOOS == "windows" {
+		// snapshot paths use a different format on Windows
+		return
+	}
+	sub := testRunEstimateRestore(t, env.gopts, snapshotID.String(), filepath.Join(env.testdata, "0", "0", "9"))
+	rtest.Assert(t, sub.Files > 0 && sub.Files < est.Files, "unexpected file count %d for subdirectory, %d in total", sub.Files, est.Files)
+	rtest.Assert(t, sub.TotalSize < est.TotalSize, "unexpected size %d for subdirectory, %d in total", sub.TotalSize, est.TotalSize)
+	rtest.Assert(t, sub.DownloadSize <= est.DownloadSize, "unexpected download size %d for subdirectory, %d in total", sub.DownloadSize, est.DownloadSize)
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+	"github.com/spf13/cobra"
+)
+
+var cmdExportCatalog = &cobra.Command{
+	Use:   "export-catalog [flags] file [snapshotID ...]",
+	Short: "Export a listing of all files in snapshots to CSV or SQL",
+	Long: `
+The "export-catalog" command writes a complete listing of all files and
+directories contained in one or more snapshots, including their size,
+timestamps, owner and file attributes. If no snapshot is specified, all
+snapshots matching the "--host", "--tag" and "--path" filters are exported.
+
+The output format is selected using "--format" or based on the extension of
+the file:
+
+* csv     Comma-separated values with a header row (".csv")
+* sql     SQL statements which create and fill the tables "snapshots" and
+          "files" (".sql")
+
+The SQL statements use the dialect of SQLite. To create an SQLite database,
+write them to stdout using "-" as file and pipe them into the "sqlite3"
+command line tool. An existing file is never overwritten.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	Example: `restic export-catalog listing.csv latest
+restic export-catalog --host fileserver listing.sql
+restic export-catalog --format sql - 79766175 | sqlite3 audit.db`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runExportCatalog(cmd.Context(), exportCatalogOptions, globalOptions, args)
+	},
+}
+
+// ExportCatalogOptions bundles all options for the export-catalog command.
+type ExportCatalogOptions struct {
+	restic.SnapshotFilter
+	Format string
+}
+
+var exportCatalogOptions ExportCatalogOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdExportCatalog)
+
+	f := cmdExportCatalog.Flags()
+	initMultiSnapshotFilter(f, &exportCatalogOptions.SnapshotFilter, true)
+	f.StringVar(&exportCatalogOptions.Format, "format", "", "output `format` (csv|sql), default is based on the file extension")
+}
+
+// exportColumn is a column of the file listing written by "export-catalog"
+// and "ls --format csv".
+type exportColumn struct {
+	name    string
+	integer bool
+}
+
+var exportColumns = []exportColumn{
+	{name: "snapshot"},
+	{name: "path"},
+	{name: "type"},
+	{name: "size", integer: true},
+	{name: "mode"},
+	{name: "uid", integer: true},
+	{name: "gid", integer: true},
+	{name: "user"},
+	{name: "group"},
+	{name: "mtime"},
+	{name: "atime"},
+	{name: "ctime"},
+	{name: "inode", integer: true},
+	{name: "links", integer: true},
+	{name: "attributes"},
+}
+
+// exportTime formats t for the export, zero timestamps are left empty.
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// windowsFileAttributes are the names of the Windows file attributes in the
+// order they are exported.
+var windowsFileAttributes = []struct {
+	flag uint32
+	name string
+}{
+	{0x1, "readonly"},
+	{0x2, "hidden"},
+	{0x4, "system"},
+	{0x20, "archive"},
+	{0x100, "temporary"},
+	{0x200, "sparse"},
+	{0x400, "reparse-point"},
+	{0x800, "compressed"},
+	{0x1000, "offline"},
+	{0x2000, "not-content-indexed"},
+	{0x4000, "encrypted"},
+}
+
+// exportAttributes returns the Windows file attributes of the node as a
+// comma-separated list. Nodes without file attributes return an empty string.
+func exportAttributes(node *restic.Node) string {
+	attrs, ok := nodeFileAttributes(node)
+	if !ok {
+		return ""
+	}
+
+	var names []string
+	for _, attr := range windowsFileAttributes {
+		if attrs&attr.flag != 0 {
+			names = append(names, attr.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// exportSnapshotID returns the ID of the snapshot, or an empty string if the
+// snapshot has not been saved.
+func exportSnapshotID(sn *restic.Snapshot) string {
+	if sn.ID() == nil {
+		return ""
+	}
+	return sn.ID().String()
+}
+
+// exportRow returns the values for exportColumns.
+func exportRow(snapshotID string, path string, node *restic.Node) []string {
+	size := ""
+	if node.Type == restic.NodeTypeFile {
+		size = strconv.FormatUint(node.Size, 10)
+	}
+	links := ""
+	if node.Links != 0 {
+		links = strconv.FormatUint(node.Links, 10)
+	}
+	inode := ""
+	if node.Inode != 0 {
+		inode = strconv.FormatUint(node.Inode, 10)
+	}
+
+	return []string{
+		snapshotID,
+		path,
+		string(node.Type),
+		size,
+		node.Mode.String(),
+		strconv.FormatUint(uint64(node.UID), 10),
+		strconv.FormatUint(uint64(node.GID), 10),
+		node.User,
+		node.Group,
+		exportTime(node.ModTime),
+		exportTime(node.AccessTime),
+		exportTime(node.ChangeTime),
+		inode,
+		links,
+		exportAttributes(node),
+	}
+}
+
+// catalogWriter writes the file listing of snapshots in an export format.
+type catalogWriter interface {
+	Snapshot(sn *restic.Snapshot) error
+	Node(sn *restic.Snapshot, path string, node *restic.Node) error
+	Close() error
+}
+
+type csvCatalogWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSVCatalogWriter(w io.Writer) *csvCatalogWriter {
+	return &csvCatalogWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvCatalogWriter) Snapshot(_ *restic.Snapshot) error {
+	if c.headerWritten {
+		return nil
+	}
+	c.headerWritten = true
+
+	header := make([]string, 0, len(exportColumns))
+	for _, col := range exportColumns {
+		header = append(header, col.name)
+	}
+	return c.w.Write(header)
+}
+
+func (c *csvCatalogWriter) Node(sn *restic.Snapshot, path string, node *restic.Node) error {
+	return c.w.Write(exportRow(exportSnapshotID(sn), path, node))
+}
+
+func (c *csvCatalogWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// sqlCatalogWriter writes SQL statements in the dialect understood by SQLite.
+type sqlCatalogWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func newSQLCatalogWriter(w io.Writer) *sqlCatalogWriter {
+	c := &sqlCatalogWriter{w: bufio.NewWriter(w)}
+	c.printf("BEGIN TRANSACTION;\n")
+	c.printf("CREATE TABLE IF NOT EXISTS snapshots (id TEXT PRIMARY KEY, time TEXT, hostname TEXT, username TEXT, paths TEXT, tags TEXT);\n")
+
+	columns := make([]string, 0, len(exportColumns))
+	for _, col := range exportColumns {
+		typ := "TEXT"
+		if col.integer {
+			typ = "INTEGER"
+		}
+		name := col.name
+		if col.name == "snapshot" {
+			name = "snapshot_id"
+			typ += " REFERENCES snapshots(id)"
+		}
+		columns = append(columns, sqlQuoteIdentifier(name)+" "+typ)
+	}
+	c.printf("CREATE TABLE IF NOT EXISTS files (%s);\n", strings.Join(columns, ", "))
+	return c
+}
+
+func (c *sqlCatalogWriter) printf(format string, args ...interface{}) {
+	if c.err != nil {
+		return
+	}
+	_, c.err = fmt.Fprintf(c.w, format, args...)
+}
+
+func sqlQuoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func sqlQuoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (c *sqlCatalogWriter) Snapshot(sn *restic.Snapshot) error {
+	c.printf("INSERT INTO snapshots VALUES (%s, %s, %s, %s, %s, %s);\n",
+		sqlQuoteString(exportSnapshotID(sn)), sqlQuoteString(exportTime(sn.Time)),
+		sqlQuoteString(sn.Hostname), sqlQuoteString(sn.Username),
+		sqlQuoteString(strings.Join(sn.Paths, "\n")), sqlQuoteString(strings.Join(sn.Tags, ",")))
+	return c.err
+}
+
+func (c *sqlCatalogWriter) Node(sn *restic.Snapshot, path string, node *restic.Node) error {
+	row := exportRow(exportSnapshotID(sn), path, node)
+	values := make([]string, 0, len(row))
+	for i, value := range row {
+		switch {
+		case exportColumns[i].integer && value == "":
+			values = append(values, "NULL")
+		case exportColumns[i].integer:
+			values = append(values, value)
+		default:
+			values = append(values, sqlQuoteString(value))
+		}
+	}
+	c.printf("INSERT INTO files VALUES (%s);\n", strings.Join(values, ", "))
+	return c.err
+}
+
+func (c *sqlCatalogWriter) Close() error {
+	c.printf("CREATE INDEX IF NOT EXISTS files_path ON files (path);\n")
+	c.printf("COMMIT;\n")
+	if c.err != nil {
+		return c.err
+	}
+	return c.w.Flush()
+}
+
+// exportFormat returns the format selected by the option or the extension of
+// filename.
+func exportFormat(format, filename string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".csv":
+			format = "csv"
+		case ".sql":
+			format = "sql"
+		case ".db", ".sqlite", ".sqlite3":
+			return "", errors.Fatalf("SQLite databases cannot be written directly, use `restic export-catalog --format sql - | sqlite3 %s`", filename)
+		default:
+			return "", errors.Fatalf("unable to determine the format for %q, use --format", filename)
+		}
+	}
+
+	switch format {
+	case "csv", "sql":
+	default:
+		return "", errors.Fatalf("invalid format %q, must be csv or sql", format)
+	}
+	return format, nil
+}
+
+func runExportCatalog(ctx context.Context, opts ExportCatalogOptions, gopts GlobalOptions, args []string) error {
+	if len(args) == 0 {
+		return errors.Fatal("no output file specified")
+	}
+	filename, snapshotIDs := args[0], args[1:]
+
+	format, err := exportFormat(opts.Format, filename)
+	if err != nil {
+		return err
+	}
+	if filename != "-" {
+		if _, err := os.Lstat(filename); err == nil {
+			return errors.Fatalf("output file %v already exists", filename)
+		}
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var snapshots []*restic.Snapshot
+	for sn := range FindFilteredSnapshots(ctx, repo, repo, &opts.SnapshotFilter, snapshotIDs) {
+		snapshots = append(snapshots, sn)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(snapshots) == 0 {
+		return errors.Fatal("no matching snapshots found")
+	}
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	if err = repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	var out io.WriteCloser
+	if filename == "-" {
+		out = nopCloser{globalOptions.stdout}
+	} else {
+		out, err = os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	var w catalogWriter
+	if format == "csv" {
+		w = newCSVCatalogWriter(out)
+	} else {
+		w = newSQLCatalogWriter(out)
+	}
+
+	// messages must not end up in the listing written to stdout
+	printf := Printf
+	if filename == "-" {
+		printf = Warnf
+	}
+
+	nodes, err := exportSnapshots(ctx, repo, snapshots, w, printf)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if globalOptions.verbosity >= 1 {
+		printf("exported %d items of %d snapshots\n", nodes, len(snapshots))
+	}
+	return nil
+}
+
+// exportSnapshots writes all items of the snapshots to w and returns the
+// number of items. Progress messages are written using printf.
+func exportSnapshots(ctx context.Context, repo restic.BlobLoader, snapshots []*restic.Snapshot, w catalogWriter, printf func(string, ...interface{})) (nodes int, err error) {
+	for _, sn := range snapshots {
+		if sn.Tree == nil {
+			return nodes, errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+		}
+		if globalOptions.verbosity >= 2 {
+			printf("exporting snapshot %v\n", sn.ID().Str())
+		}
+
+		if err := w.Snapshot(sn); err != nil {
+			return nodes, err
+		}
+		err := walker.Walk(ctx, repo, *sn.Tree, walker.WalkVisitor{
+			ProcessNode: func(_ restic.ID, nodepath string, node *restic.Node, err error) error {
+				if err != nil {
+					return err
+				}
+				if node == nil {
+					return nil
+				}
+				nodes++
+				return w.Node(sn, nodepath, node)
+			},
+		})
+		if err != nil {
+			return nodes, err
+		}
+	}
+	return nodes, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunExportCatalog(t testing.TB, gopts GlobalOptions, opts ExportCatalogOptions, args ...string) {
+	gopts.Quiet = true
+	rtest.OK(t, runExportCatalog(context.TODO(), opts, gopts, args))
+}
+
+func TestExportCatalog(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, env.testdata+"/0", []string{"."}, BackupOptions{}, env.gopts)
+	testRunBackup(t, env.testdata+"/0", []string{"."}, BackupOptions{}, env.gopts)
+	// the listing ends with an empty line
+	items := len(testRunLs(t, env.gopts, "latest")) - 1
+
+	filename := filepath.Join(env.base, "listing.csv")
+	testRunExportCatalog(t, env.gopts, ExportCatalogOptions{}, filename)
+
+	f, err := os.Open(filename)
+	rtest.OK(t, err)
+	records, err := csv.NewReader(f).ReadAll()
+	rtest.OK(t, f.Close())
+	rtest.OK(t, err)
+
+	rtest.Equals(t, "snapshot", records[0][0])
+	snapshots := make(map[string]int)
+	for _, record := range records[1:] {
+		snapshots[record[0]]++
+	}
+	rtest.Equals(t, 2, len(snapshots))
+	for id, count := range snapshots {
+		rtest.Equals(t, items, count, "unexpected number of items in snapshot %v", id)
+	}
+
+	// existing files are not overwritten
+	err = runExportCatalog(context.TODO(), ExportCatalogOptions{}, env.gopts, []string{filename})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "already exists"), "unexpected error %v", err)
+
+	sqlFile := filepath.Join(env.base, "listing.sql")
+	testRunExportCatalog(t, env.gopts, ExportCatalogOptions{}, sqlFile, "latest")
+	buf, err := os.ReadFile(sqlFile)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, strings.Count(string(buf), "INSERT INTO snapshots"))
+	rtest.Equals(t, items, strings.Count(string(buf), "INSERT INTO files"))
+
+	// SQLite databases are created by piping the SQL statements into sqlite3
+	dbFile := filepath.Join(env.base, "listing.db")
+	err = runExportCatalog(context.TODO(), ExportCatalogOptions{}, env.gopts, []string{dbFile, "latest"})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "sqlite3"), "unexpected error %v", err)
+
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not available")
+	}
+	sql, err := withCaptureStdout(func() error {
+		// messages are written to stderr instead of stdout
+		globalOptions.verbosity = 2
+		return runExportCatalog(context.TODO(), ExportCatalogOptions{Format: "sql"}, env.gopts, []string{"-", "latest"})
+	})
+	rtest.OK(t, err)
+	cmd := exec.Command("sqlite3", dbFile)
+	cmd.Stdin = sql
+	rtest.OK(t, cmd.Run())
+	out, err := exec.Command("sqlite3", dbFile, "SELECT COUNT(*) FROM files").Output()
+	rtest.OK(t, err)
+	rtest.Equals(t, strconv.Itoa(items), strings.TrimSpace(string(out)))
+}
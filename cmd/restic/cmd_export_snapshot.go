@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/export"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdExportSnapshot = &cobra.Command{
+	Use:   "export-snapshot [flags] snapshotID file",
+	Short: "Export a snapshot to an encrypted archive",
+	Long: `
+The "export-snapshot" command writes a single snapshot together with all trees
+and file contents it references to an archive file, or to standard output if
+the file is "-". The archive can be imported into another repository using
+the "import-snapshot" command, for example to transfer a snapshot to a
+repository on an air-gapped system.
+
+The archive is encrypted using a separate archive password, which is read
+from the file given by --archive-password-file or requested interactively.
+The archive format is described in the design document.
+
+Use "latest" to export the latest snapshot, optionally filtered by --host,
+--path and --tag.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runExportSnapshot(cmd.Context(), exportSnapshotOptions, globalOptions, args)
+	},
+}
+
+// ExportSnapshotOptions collects all options for the export-snapshot command.
+type ExportSnapshotOptions struct {
+	restic.SnapshotFilter
+	ArchivePasswordFile string
+}
+
+var exportSnapshotOptions ExportSnapshotOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdExportSnapshot)
+
+	f := cmdExportSnapshot.Flags()
+	initSingleSnapshotFilter(f, &exportSnapshotOptions.SnapshotFilter)
+	f.StringVar(&exportSnapshotOptions.ArchivePasswordFile, "archive-password-file", "", "`file` to read the archive password from")
+}
+
+// readArchivePassword returns the password of a snapshot archive. When
+// creating an archive, the password is requested twice.
+func readArchivePassword(ctx context.Context, gopts GlobalOptions, passwordFile string, create bool) (string, error) {
+	var password string
+	var err error
+	if passwordFile != "" {
+		password, err = loadPasswordFromFile(passwordFile)
+	} else {
+		// do not use the repository password
+		pwopts := gopts
+		pwopts.password = ""
+		pwopts.InsecureNoPassword = false
+		if create {
+			password, err = ReadPasswordTwice(ctx, pwopts, "enter archive password: ", "enter archive password again: ")
+		} else {
+			password, err = ReadPassword(ctx, pwopts, "enter archive password: ")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.Fatal("an empty archive password is not allowed")
+	}
+	return password, nil
+}
+
+func runExportSnapshot(ctx context.Context, opts ExportSnapshotOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 2 {
+		return errors.Fatal("no snapshot ID and file specified")
+	}
+	if args[1] == "-" && stdoutIsTerminal() {
+		return errors.Fatal("stdout is the terminal, please redirect output")
+	}
+
+	password, err := readArchivePassword(ctx, gopts, opts.ArchivePasswordFile, true)
+	if err != nil {
+		return err
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sn, subfolder, err := opts.SnapshotFilter.FindLatest(ctx, repo, repo, args[0])
+	if err != nil {
+		return errors.Fatalf("failed to find snapshot: %v", err)
+	}
+	if subfolder != "" {
+		return errors.Fatal("exporting a subfolder of a snapshot is not supported")
+	}
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	if err := repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	params, err := repository.KDFParams()
+	if err != nil {
+		return err
+	}
+
+	if args[1] == "-" {
+		return export.Write(ctx, repo, *sn.ID(), sn, gopts.stdout, password, params, nil)
+	}
+
+	f, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Fatalf("unable to create archive: %v", err)
+	}
+
+	Verbosef("exporting snapshot %v of %v at %v\n", sn.ID().Str(), sn.Paths, sn.Time)
+	bar = newProgressMax(!gopts.Quiet, 0, "blobs exported")
+	err = export.Write(ctx, repo, *sn.ID(), sn, f, password, params, bar)
+	bar.Done()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.Fatalf("unable to write archive: %v", err)
+	}
+
+	Verbosef("exported snapshot to %v\n", args[1])
+	return nil
+}
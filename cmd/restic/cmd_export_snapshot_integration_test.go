@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestExportImportSnapshot(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	snapshotIDs := testListSnapshots(t, env.gopts, 1)
+
+	pwFile := filepath.Join(env.base, "archive-password")
+	rtest.OK(t, os.WriteFile(pwFile, []byte("archive secret\n"), 0600))
+	archive := filepath.Join(env.base, "snapshot.tar")
+	rtest.OK(t, runExportSnapshot(context.TODO(), ExportSnapshotOptions{ArchivePasswordFile: pwFile},
+		env.gopts, []string{snapshotIDs[0].String(), archive}))
+
+	testRunInit(t, env2.gopts)
+	importOpts := ImportSnapshotOptions{ArchivePasswordFile: pwFile}
+	rtest.OK(t, runImportSnapshot(context.TODO(), importOpts, env2.gopts, []string{archive}))
+	// the second import is skipped
+	rtest.OK(t, runImportSnapshot(context.TODO(), importOpts, env2.gopts, []string{archive}))
+	importedIDs := testListSnapshots(t, env2.gopts, 1)
+	testRunCheck(t, env2.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	restoredir2 := filepath.Join(env2.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshotIDs[0].String())
+	testRunRestore(t, env2.gopts, restoredir2, importedIDs[0].String())
+	rtest.Equals(t, "", directoriesContentsDiff(restoredir, restoredir2))
+}
@@ -24,7 +24,10 @@ The "find" command searches for files or directories in snapshots stored in the
 repo.
 It can also be used to search for restic blobs or trees for troubleshooting.
 The default sort option for the snapshots is youngest to oldest. To sort the
-output from oldest to youngest specify --reverse.`,
+output from oldest to youngest specify --reverse.
+
+--oldest and --newest select files by their modification time, while --since
+and --until select the snapshots to search by their creation time.`,
 	Example: `restic find config.json
 restic find --json "*.yml" "*.json"
 restic find --json --blob 420f620f b46ebe8a ddd38656
@@ -91,6 +94,7 @@ type findPattern struct {
 
 var timeFormats = []string{
 	"2006-01-02",
+	"2006-01",
 	"2006-01-02 15:04",
 	"2006-01-02 15:04:05",
 	"2006-01-02 15:04:05 -0700",
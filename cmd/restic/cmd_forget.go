@@ -5,10 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 
+	"github.com/restic/restic/internal/approval"
+	"github.com/restic/restic/internal/audit"
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/oplog"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
 	"github.com/restic/restic/internal/ui/termstatus"
 	"github.com/spf13/cobra"
 )
@@ -24,6 +33,12 @@ If there are not enough snapshots to keep one for each duration related
 "--keep-{within-,}*" option, the oldest snapshot in the group is kept
 additionally.
 
+The policy can also be read from a YAML file using "--policy-file". With
+"--simulate", nothing is removed. Instead, the policy is applied to the
+existing snapshots and then projected into the future, assuming that a new
+snapshot is created at regular intervals. The output shows when each existing
+snapshot would be removed and how many snapshots would be kept over time.
+
 Please note that this command really only deletes the snapshot object in the
 repository, which is a reference to data stored there. In order to remove the
 unreferenced data after "forget" was run successfully, see the "prune" command.
@@ -31,6 +46,9 @@ unreferenced data after "forget" was run successfully, see the "prune" command.
 Please also read the documentation for "forget" to learn about some important
 security considerations.
 
+If the repository has an approval policy, removing more snapshots than allowed
+by its threshold must be approved by two admins, see "restic help approval".
+
 EXIT STATUS
 ===========
 
@@ -101,6 +119,11 @@ type ForgetOptions struct {
 	KeepTags      restic.TagLists
 
 	UnsafeAllowRemoveAll bool
+	PolicyFile           string
+
+	Simulate         bool
+	SimulateFor      restic.Duration
+	SimulateInterval time.Duration
 
 	restic.SnapshotFilter
 	Compact bool
@@ -132,6 +155,11 @@ func init() {
 	f.VarP(&forgetOptions.WithinYearly, "keep-within-yearly", "", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 	f.Var(&forgetOptions.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
 	f.BoolVar(&forgetOptions.UnsafeAllowRemoveAll, "unsafe-allow-remove-all", false, "allow deleting all snapshots of a snapshot group")
+	f.StringVar(&forgetOptions.PolicyFile, "policy-file", "", "read the retention policy from YAML `file` instead of the --keep-* options")
+	f.BoolVar(&forgetOptions.Simulate, "simulate", false, "do not delete anything, show which snapshots the policy keeps now and in the future")
+	forgetOptions.SimulateFor = restic.Duration{Years: 1}
+	f.Var(&forgetOptions.SimulateFor, "simulate-for", "project the policy `duration` (eg. 1y6m) into the future")
+	f.DurationVar(&forgetOptions.SimulateInterval, "simulate-interval", 0, "assume a new snapshot every `duration` (default: typical interval of the existing snapshots)")
 
 	initMultiSnapshotFilter(f, &forgetOptions.SnapshotFilter, false)
 	f.StringArrayVar(&forgetOptions.Hosts, "hostname", nil, "only consider snapshots with the given `hostname` (can be specified multiple times)")
@@ -151,6 +179,25 @@ func init() {
 	addPruneOptions(cmdForget, &forgetPruneOptions)
 }
 
+// expirePolicy returns the retention policy specified by the --keep-* options.
+func (opts ForgetOptions) expirePolicy() restic.ExpirePolicy {
+	return restic.ExpirePolicy{
+		Last:          int(opts.Last),
+		Hourly:        int(opts.Hourly),
+		Daily:         int(opts.Daily),
+		Weekly:        int(opts.Weekly),
+		Monthly:       int(opts.Monthly),
+		Yearly:        int(opts.Yearly),
+		Within:        opts.Within,
+		WithinHourly:  opts.WithinHourly,
+		WithinDaily:   opts.WithinDaily,
+		WithinWeekly:  opts.WithinWeekly,
+		WithinMonthly: opts.WithinMonthly,
+		WithinYearly:  opts.WithinYearly,
+		Tags:          opts.KeepTags,
+	}
+}
+
 func verifyForgetOptions(opts *ForgetOptions) error {
 	if opts.Last < -1 || opts.Hourly < -1 || opts.Daily < -1 || opts.Weekly < -1 ||
 		opts.Monthly < -1 || opts.Yearly < -1 {
@@ -178,11 +225,43 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 		return err
 	}
 
+	if opts.PolicyFile != "" {
+		if !opts.expirePolicy().Empty() {
+			return errors.Fatal("--policy-file cannot be combined with --keep-* options")
+		}
+		err = loadForgetPolicyFile(opts.PolicyFile, &opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Simulate {
+		if len(args) > 0 {
+			return errors.Fatal("--simulate cannot be used with snapshot IDs")
+		}
+		if opts.Prune {
+			return errors.Fatal("--simulate and --prune cannot be used together")
+		}
+		if opts.SimulateInterval < 0 {
+			return errors.Fatal("--simulate-interval must not be negative")
+		}
+		opts.DryRun = true
+	}
+
 	if gopts.NoLock && !opts.DryRun {
 		return errors.Fatal("--no-lock is only applicable in combination with --dry-run for forget command")
 	}
 
-	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, opts.DryRun && gopts.NoLock)
+	var (
+		repo   *repository.Repository
+		unlock func()
+	)
+	if opts.Simulate {
+		// the simulation only reads snapshots
+		ctx, repo, unlock, err = openWithReadLock(ctx, gopts, gopts.NoLock)
+	} else {
+		ctx, repo, unlock, err = openWithExclusiveLock(ctx, gopts, opts.DryRun && gopts.NoLock)
+	}
 	if err != nil {
 		return err
 	}
@@ -195,10 +274,20 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 	printer := newTerminalProgressPrinter(verbosity, term)
 
 	var snapshots restic.Snapshots
+	// allSnapshots contains all snapshots of the repository, it is nil unless
+	// all of them could be loaded
+	var allSnapshots restic.Snapshots
 	removeSnIDs := restic.NewIDSet()
+	// removeTrees maps the removed snapshots to their root trees
+	removeTrees := make(map[restic.ID]restic.ID)
 
-	for sn := range FindFilteredSnapshots(ctx, repo, repo, &opts.SnapshotFilter, args) {
-		snapshots = append(snapshots, sn)
+	if len(args) > 0 {
+		for sn := range FindFilteredSnapshots(ctx, repo, repo, &opts.SnapshotFilter, args) {
+			snapshots = append(snapshots, sn)
+		}
+	} else {
+		// load all snapshots only once, prune reuses them
+		allSnapshots, snapshots = loadForgetSnapshots(ctx, repo, &opts.SnapshotFilter)
 	}
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -210,6 +299,9 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 		// When explicit snapshots args are given, remove them immediately.
 		for _, sn := range snapshots {
 			removeSnIDs.Insert(*sn.ID())
+			if sn.Tree != nil {
+				removeTrees[*sn.ID()] = *sn.Tree
+			}
 		}
 	} else {
 		snapshotGroups, _, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
@@ -217,21 +309,7 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 			return err
 		}
 
-		policy := restic.ExpirePolicy{
-			Last:          int(opts.Last),
-			Hourly:        int(opts.Hourly),
-			Daily:         int(opts.Daily),
-			Weekly:        int(opts.Weekly),
-			Monthly:       int(opts.Monthly),
-			Yearly:        int(opts.Yearly),
-			Within:        opts.Within,
-			WithinHourly:  opts.WithinHourly,
-			WithinDaily:   opts.WithinDaily,
-			WithinWeekly:  opts.WithinWeekly,
-			WithinMonthly: opts.WithinMonthly,
-			WithinYearly:  opts.WithinYearly,
-			Tags:          opts.KeepTags,
-		}
+		policy := opts.expirePolicy()
 
 		if policy.Empty() {
 			if opts.UnsafeAllowRemoveAll {
@@ -289,10 +367,23 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 
 			fg.Reasons = asJSONKeeps(reasons)
 
+			if opts.Simulate {
+				fg.Simulation, err = simulateForget(snapshotGroup, keep, policy, opts.SimulateFor, opts.SimulateInterval, time.Now())
+				if err != nil {
+					return err
+				}
+				if !gopts.Quiet && !gopts.JSON {
+					printForgetSimulation(fg.Simulation)
+				}
+			}
+
 			jsonGroups = append(jsonGroups, &fg)
 
 			for _, sn := range remove {
 				removeSnIDs.Insert(*sn.ID())
+				if sn.Tree != nil {
+					removeTrees[*sn.ID()] = *sn.Tree
+				}
 			}
 		}
 	}
@@ -303,16 +394,15 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 
 	if len(removeSnIDs) > 0 {
 		if !opts.DryRun {
-			bar := printer.NewCounter("files deleted")
-			err := restic.ParallelRemove(ctx, repo, removeSnIDs, restic.WriteableSnapshotFile, func(id restic.ID, err error) error {
-				if err != nil {
-					printer.E("unable to remove %v/%v from the repository\n", restic.SnapshotFile, id)
-				} else {
-					printer.VV("removed %v/%v\n", restic.SnapshotFile, id)
-				}
-				return nil
-			}, bar)
-			bar.Done()
+			approved, err := approveSnapshotRemoval(ctx, repo, gopts, approval.OpForget, removeSnIDs.List())
+			if err != nil {
+				return err
+			}
+			err = removeSnapshots(ctx, repo, removeSnIDs, removeTrees, approvalID(approved), printer)
+			if err != nil {
+				return err
+			}
+			err = consumeApproval(ctx, repo, approved)
 			if err != nil {
 				return err
 			}
@@ -335,12 +425,118 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 			printer.P("%d snapshots have been removed, running prune\n", len(removeSnIDs))
 		}
 		pruneOptions.DryRun = opts.DryRun
+		pruneOptions.snapshots = allSnapshots
 		return runPruneWithRepo(ctx, pruneOptions, gopts, repo, removeSnIDs, term)
 	}
 
 	return nil
 }
 
+// loadForgetSnapshots loads all snapshots of the repository in a single pass
+// and returns them together with the snapshots matching filter. all is nil if
+// some snapshots could not be loaded.
+func loadForgetSnapshots(ctx context.Context, repo restic.ListerLoaderUnpacked, filter *restic.SnapshotFilter) (all, matching restic.Snapshots) {
+	complete := true
+	err := restic.ForAllSnapshots(ctx, repo, repo, nil, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			Warningf("Ignoring %q: %v\n", id, err)
+			complete = false
+			return nil
+		}
+		all = append(all, sn)
+		if filter.Matches(sn) {
+			matching = append(matching, sn)
+		}
+		return nil
+	})
+	if err != nil {
+		Warningf("could not load snapshots: %v\n", err)
+		complete = false
+	}
+	if !complete {
+		all = nil
+	}
+	return all, matching
+}
+
+// forgetBatchSize is the number of snapshots removed before the removal is
+// recorded in the audit and operation logs. This keeps the records small and
+// ensures that the removed snapshots are recorded if forget is interrupted.
+var forgetBatchSize = 1000
+
+// removeSnapshots removes the snapshots in batches of forgetBatchSize, the
+// snapshot files of each batch are removed in parallel. The root trees of the
+// removed snapshots, taken from trees, and the ID of the approval request
+// which authorized the removal are stored in the operation log.
+func removeSnapshots(ctx context.Context, repo *repository.Repository, ids restic.IDSet, trees map[restic.ID]restic.ID, approvalID *restic.ID, printer progress.Printer) error {
+	list := ids.List()
+	sort.Sort(list)
+
+	bar := printer.NewCounter("files deleted")
+	bar.SetMax(uint64(len(list)))
+	defer bar.Done()
+
+	for len(list) > 0 {
+		batch := list[:min(len(list), forgetBatchSize)]
+		list = list[len(batch):]
+
+		var m sync.Mutex
+		var removed restic.IDs
+		err := restic.ParallelRemove(ctx, repo, restic.NewIDSet(batch...), restic.WriteableSnapshotFile, func(id restic.ID, err error) error {
+			if errors.Is(err, backend.ErrImmutable) {
+				printer.P("snapshot %v is protected against deletion and was kept\n", id.Str())
+			} else if err != nil {
+				printer.E("unable to remove %v/%v from the repository\n", restic.SnapshotFile, id)
+			} else {
+				printer.VV("removed %v/%v\n", restic.SnapshotFile, id)
+				m.Lock()
+				removed = append(removed, id)
+				m.Unlock()
+				bar.Add(1)
+			}
+			return nil
+		}, nil)
+
+		if len(removed) > 0 {
+			sort.Sort(removed)
+			names := make([]string, 0, len(removed))
+			for _, id := range removed {
+				names = append(names, id.String())
+			}
+			auditEvent(audit.Event{
+				Type:      "snapshots-forgotten",
+				Name:      "Snapshots forgotten",
+				Severity:  6,
+				Snapshots: names,
+				Count:     len(names),
+			})
+
+			removedTrees := restic.NewIDSet()
+			for _, id := range removed {
+				if tree, ok := trees[id]; ok {
+					removedTrees.Insert(tree)
+				}
+			}
+			treeList := removedTrees.List()
+			sort.Sort(treeList)
+
+			oplogErr := recordOperation(ctx, repo, &oplog.Record{
+				Operation: oplog.OpForget,
+				Snapshots: removed,
+				Trees:     treeList,
+				Approval:  approvalID,
+			})
+			if err == nil {
+				err = oplogErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ForgetGroup helps to print what is forgotten in JSON.
 type ForgetGroup struct {
 	Tags    []string     `json:"tags"`
@@ -349,6 +545,8 @@ type ForgetGroup struct {
 	Keep    []Snapshot   `json:"keep"`
 	Remove  []Snapshot   `json:"remove"`
 	Reasons []KeepReason `json:"reasons"`
+	// Simulation is only set for --simulate.
+	Simulation *ForgetSimulation `json:"simulation,omitempty"`
 }
 
 func asJSONSnapshots(list restic.Snapshots) []Snapshot {
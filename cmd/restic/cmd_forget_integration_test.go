@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/oplog"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 	"github.com/restic/restic/internal/ui/termstatus"
@@ -64,3 +68,77 @@ func TestRunForgetSafetyNet(t *testing.T) {
 	})
 	testListSnapshots(t, env.gopts, 0)
 }
+
+func TestRunForgetBatches(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	defer func(size int) { forgetBatchSize = size }(forgetBatchSize)
+	forgetBatchSize = 2
+
+	testSetupBackupData(t, env)
+	for i := 0; i < 4; i++ {
+		testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	}
+	testListSnapshots(t, env.gopts, 4)
+
+	err := withTermStatus(env.gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runForget(context.TODO(), ForgetOptions{Last: 1, Prune: true}, PruneOptions{MaxUnused: "0"}, env.gopts, term, nil)
+	})
+	rtest.OK(t, err)
+	testListSnapshots(t, env.gopts, 1)
+
+	// each batch is recorded separately, followed by prune
+	records, err := testRunLog(t, env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, len(records))
+	rtest.Equals(t, 2, len(records[0].Snapshots))
+	rtest.Equals(t, 1, len(records[1].Snapshots))
+	rtest.Equals(t, oplog.OpPrune, records[2].Operation)
+	testRunCheck(t, env.gopts)
+}
+
+func TestRunForgetSimulate(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	for i := 0; i < 3; i++ {
+		testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	}
+	testListSnapshots(t, env.gopts, 3)
+
+	policyFile := filepath.Join(env.base, "policy.yml")
+	rtest.OK(t, os.WriteFile(policyFile, []byte("keep-last: 1\n"), 0o600))
+
+	// the policy file cannot be combined with --keep-* options
+	err := testRunForgetMayFail(env.gopts, ForgetOptions{PolicyFile: policyFile, Last: 2})
+	rtest.Assert(t, err != nil, "expected error for --policy-file and --keep-last")
+
+	env.gopts.JSON = true
+	out, err := withCaptureStdout(func() error {
+		return testRunForgetMayFail(env.gopts, ForgetOptions{
+			PolicyFile:       policyFile,
+			Simulate:         true,
+			SimulateFor:      restic.Duration{Days: 3},
+			SimulateInterval: 24 * time.Hour,
+		})
+	})
+	rtest.OK(t, err)
+	env.gopts.JSON = false
+
+	var groups []ForgetGroup
+	rtest.OK(t, json.Unmarshal(out.Bytes(), &groups))
+	rtest.Equals(t, 1, len(groups))
+	rtest.Equals(t, 2, len(groups[0].Remove))
+	sim := groups[0].Simulation
+	rtest.Assert(t, sim != nil, "simulation missing")
+	rtest.Equals(t, "1d", sim.Interval)
+	rtest.Equals(t, 3, len(sim.Snapshots))
+	for _, sn := range sim.Snapshots {
+		rtest.Assert(t, sn.RemovedAt != nil, "snapshot %v is not removed", sn.ShortID)
+	}
+
+	// nothing was removed
+	testListSnapshots(t, env.gopts, 3)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -92,3 +93,82 @@ func TestForgetOptionValues(t *testing.T) {
 		}
 	}
 }
+
+func TestForgetPolicyFile(t *testing.T) {
+	var opts ForgetOptions
+	rtest.OK(t, parseForgetPolicy([]byte(`
+keep-daily: 7
+keep-monthly: 12
+keep-yearly: unlimited
+keep-within: 2y
+keep-tag: [important, "a,b"]
+group-by: host,paths
+`), &opts))
+
+	rtest.Equals(t, ForgetPolicyCount(7), opts.Daily)
+	rtest.Equals(t, ForgetPolicyCount(12), opts.Monthly)
+	rtest.Equals(t, ForgetPolicyCount(-1), opts.Yearly)
+	rtest.Equals(t, restic.Duration{Years: 2}, opts.Within)
+	rtest.Equals(t, restic.TagLists{{"important"}, {"a", "b"}}, opts.KeepTags)
+	rtest.Equals(t, restic.SnapshotGroupByOptions{Host: true, Path: true}, opts.GroupBy)
+
+	for _, policy := range []string{
+		"",
+		"- keep-daily",
+		"keep-dialy: 7",
+		"keep-daily: -2",
+		"keep-daily: [1, 2]",
+		"keep-daily: 1\nkeep-daily: 2",
+	} {
+		var opts ForgetOptions
+		err := parseForgetPolicy([]byte(policy), &opts)
+		rtest.Assert(t, err != nil, "expected error for policy %q", policy)
+	}
+}
+
+func TestSimulateForget(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var group restic.Snapshots
+	for i := 9; i >= 0; i-- {
+		group = append(group, &restic.Snapshot{
+			Time:     now.AddDate(0, 0, -i),
+			Hostname: "host",
+			Paths:    []string{"/data"},
+			Tree:     &restic.ID{},
+		})
+	}
+
+	policy := restic.ExpirePolicy{Daily: 7, Monthly: 3}
+	keep, _, _ := restic.ApplyPolicy(group, policy)
+	// the oldest snapshot is kept as there is no snapshot for a third month
+	rtest.Equals(t, 8, len(keep))
+
+	sim, err := simulateForget(group, keep, policy, restic.Duration{Months: 6}, 0, now)
+	rtest.OK(t, err)
+	rtest.Equals(t, "1d", sim.Interval)
+	rtest.Equals(t, now.AddDate(0, 6, 0), sim.Until)
+	rtest.Equals(t, len(group), len(sim.Snapshots))
+	rtest.Equals(t, 6, len(sim.Schedule))
+
+	removedAt := func(i int) time.Time {
+		rtest.Assert(t, sim.Snapshots[i].RemovedAt != nil, "snapshot %d is not removed", i)
+		return *sim.Snapshots[i].RemovedAt
+	}
+	// the daily snapshots are removed when they are replaced by new ones
+	rtest.Equals(t, now, removedAt(1))
+	rtest.Equals(t, now.AddDate(0, 0, 1), removedAt(3))
+	rtest.Equals(t, now.AddDate(0, 0, 7), removedAt(9))
+	// the oldest snapshot is kept until the first new monthly snapshot
+	rtest.Equals(t, now.AddDate(0, 1, 0), removedAt(0))
+	// the monthly snapshot for December is kept until March has started
+	rtest.Equals(t, now.AddDate(0, 2, 0), removedAt(8))
+
+	final := sim.Schedule[len(sim.Schedule)-1]
+	rtest.Equals(t, sim.Until, final.Time)
+	rtest.Equals(t, 8, final.Snapshots)
+	rtest.Equals(t, 0, final.Existing)
+	rtest.Equals(t, now.AddDate(0, 4, 30), final.Oldest)
+
+	_, err = simulateForget(group, keep, policy, restic.Duration{Years: 100}, time.Minute, now)
+	rtest.Assert(t, err != nil, "expected error for too many simulated snapshots")
+}
@@ -12,11 +12,34 @@ import (
 
 var cmdGenerate = &cobra.Command{
 	Use:   "generate [flags]",
-	Short: "Generate manual pages and auto-completion files (bash, fish, zsh, powershell)",
+	Short: "Generate manual pages, auto-completion files (bash, fish, zsh, powershell) and scheduler definitions",
 	Long: `
 The "generate" command writes automatically generated files (like the man pages
 and the auto-completion files for bash, fish and zsh).
 
+It can also generate a systemd service and timer unit or a Windows Task
+Scheduler definition which run restic periodically. The job is described by a
+JSON profile passed via --profile, for example:
+
+    {
+      "name": "home",
+      "repository": "sftp:backup@server:/srv/restic",
+      "password_file": "/etc/restic/password",
+      "args": ["backup", "--one-file-system", "/home"],
+      "schedule": "daily",
+      "at": "02:30"
+    }
+
+Supported schedules are "hourly", "daily" and "weekly". Other supported fields
+are "binary", "password_command", "environment_file", "log_file" and "user".
+For systemd, the password file is passed to the service as a credential and the
+output is sent to the journal unless "log_file" is set. The files must be given
+as absolute paths, and the user name must not contain whitespace.
+
+Secrets can be read from HashiCorp Vault when the job runs using the fields
+"vault_address", "vault_password" (a reference "path#field") and "vault_env",
+which maps environment variables like AWS_SECRET_ACCESS_KEY to references.
+
 EXIT STATUS
 ===========
 
@@ -35,6 +58,9 @@ type generateOptions struct {
 	FishCompletionFile       string
 	ZSHCompletionFile        string
 	PowerShellCompletionFile string
+	ProfileFile              string
+	SystemdUnitDir           string
+	WindowsTaskFile          string
 }
 
 var genOpts generateOptions
@@ -47,6 +73,9 @@ func init() {
 	fs.StringVar(&genOpts.FishCompletionFile, "fish-completion", "", "write fish completion `file` (`-` for stdout)")
 	fs.StringVar(&genOpts.ZSHCompletionFile, "zsh-completion", "", "write zsh completion `file` (`-` for stdout)")
 	fs.StringVar(&genOpts.PowerShellCompletionFile, "powershell-completion", "", "write powershell completion `file` (`-` for stdout)")
+	fs.StringVar(&genOpts.ProfileFile, "profile", "", "read the scheduled job from the JSON profile `file`")
+	fs.StringVar(&genOpts.SystemdUnitDir, "systemd-units", "", "write systemd service and timer units for the profile to `directory`")
+	fs.StringVar(&genOpts.WindowsTaskFile, "windows-task", "", "write Windows Task Scheduler definition for the profile to `file`")
 }
 
 func writeManpages(dir string) error {
@@ -152,6 +181,32 @@ func runGenerate(opts generateOptions, args []string) error {
 		}
 	}
 
+	if opts.SystemdUnitDir != "" || opts.WindowsTaskFile != "" {
+		if opts.ProfileFile == "" {
+			return errors.Fatal("--systemd-units and --windows-task require a profile, please specify --profile")
+		}
+		profile, err := loadScheduleProfile(opts.ProfileFile)
+		if err != nil {
+			return err
+		}
+
+		if opts.SystemdUnitDir != "" {
+			err := writeSystemdUnits(opts.SystemdUnitDir, profile)
+			if err != nil {
+				return err
+			}
+		}
+
+		if opts.WindowsTaskFile != "" {
+			err := writeWindowsTask(opts.WindowsTaskFile, profile)
+			if err != nil {
+				return err
+			}
+		}
+	} else if opts.ProfileFile != "" {
+		return errors.Fatal("--profile requires --systemd-units or --windows-task")
+	}
+
 	var empty generateOptions
 	if opts == empty {
 		return errors.Fatal("nothing to do, please specify at least one output file/dir")
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/textfile"
+)
+
+// scheduleProfile describes a scheduled restic job. It is read from a JSON
+// file and used to generate systemd units or Windows scheduled tasks.
+type scheduleProfile struct {
+	// Name identifies the job, it is used for the names of the generated
+	// units and tasks.
+	Name string `json:"name"`
+	// Binary is the path to the restic binary, defaults to the currently
+	// running binary.
+	Binary     string `json:"binary"`
+	Repository string `json:"repository"`
+	// PasswordFile and PasswordCommand are mutually exclusive. With systemd,
+	// the password file is passed as a credential to the service.
+	PasswordFile    string `json:"password_file"`
+	PasswordCommand string `json:"password_command"`
+	// VaultAddress, VaultPassword and VaultEnv configure secrets which are
+	// read from HashiCorp Vault when the job runs. VaultPassword is a
+	// reference of the form path#field, VaultEnv maps environment variables
+	// to such references. The Vault credentials themselves are passed via
+	// EnvironmentFile or a Vault agent.
+	VaultAddress  string            `json:"vault_address"`
+	VaultPassword string            `json:"vault_password"`
+	VaultEnv      map[string]string `json:"vault_env"`
+	// EnvironmentFile contains additional environment variables like
+	// credentials for the backend, only supported for systemd.
+	EnvironmentFile string `json:"environment_file"`
+	// Args contains the restic command and its arguments, e.g.
+	// ["backup", "/home"].
+	Args []string `json:"args"`
+	// Schedule is one of hourly, daily or weekly.
+	Schedule string `json:"schedule"`
+	// At specifies the time of day (HH:MM) for daily and weekly schedules.
+	At string `json:"at"`
+	// LogFile receives the output of the job. With systemd, the output is
+	// sent to the journal if no log file is specified.
+	LogFile string `json:"log_file"`
+	// User to run the job as. For Windows tasks, the job runs as SYSTEM by
+	// default.
+	User string `json:"user"`
+}
+
+var validProfileName = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+func loadScheduleProfile(filename string) (scheduleProfile, error) {
+	var p scheduleProfile
+
+	buf, err := textfile.Read(filename)
+	if err != nil {
+		return p, errors.Fatalf("unable to read profile: %v", err)
+	}
+
+	err = json.Unmarshal(buf, &p)
+	if err != nil {
+		return p, errors.Fatalf("unable to parse profile %v: %v", filename, err)
+	}
+
+	if p.Binary == "" {
+		p.Binary, err = os.Executable()
+		if err != nil {
+			return p, errors.Fatalf("unable to determine restic binary: %v", err)
+		}
+	}
+
+	return p, p.validate()
+}
+
+func (p scheduleProfile) validate() error {
+	if !validProfileName.MatchString(p.Name) {
+		return errors.Fatalf("invalid profile name %q, only letters, digits, '_', '.' and '-' are allowed", p.Name)
+	}
+	if p.Repository == "" {
+		return errors.Fatal("profile does not specify a repository")
+	}
+	if p.PasswordFile != "" && p.PasswordCommand != "" {
+		return errors.Fatal("password_file and password_command are mutually exclusive")
+	}
+	if p.VaultPassword != "" && (p.PasswordFile != "" || p.PasswordCommand != "") {
+		return errors.Fatal("vault_password cannot be combined with password_file or password_command")
+	}
+	if len(p.Args) == 0 {
+		return errors.Fatal("profile does not specify a restic command in args")
+	}
+	// the paths are passed quoted to cmd.exe, which cannot escape these
+	// characters within quotes
+	if strings.ContainsAny(p.Binary, `"%`) {
+		return errors.Fatalf("invalid binary %q, must not contain '\"' or '%%'", p.Binary)
+	}
+	if strings.ContainsAny(p.LogFile, `"%`) {
+		return errors.Fatalf("invalid log_file %q, must not contain '\"' or '%%'", p.LogFile)
+	}
+	switch p.Schedule {
+	case "hourly", "daily", "weekly":
+	default:
+		return errors.Fatalf("invalid schedule %q, must be one of hourly, daily or weekly", p.Schedule)
+	}
+	if p.At != "" {
+		if p.Schedule == "hourly" {
+			return errors.Fatal("at is not supported for hourly schedules")
+		}
+		if _, err := time.Parse("15:04", p.At); err != nil {
+			return errors.Fatalf("invalid time %q, expected HH:MM", p.At)
+		}
+	}
+	return nil
+}
+
+// vaultEnv returns the entries of VaultEnv in the format expected by
+// --vault-env, sorted by name.
+func (p scheduleProfile) vaultEnv() []string {
+	entries := make([]string, 0, len(p.VaultEnv))
+	for name, ref := range p.VaultEnv {
+		entries = append(entries, name+"="+ref)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+func (p scheduleProfile) at() string {
+	if p.At == "" {
+		return "00:00"
+	}
+	return p.At
+}
+
+// systemdEscape quotes a single value for use in Environment= and similar
+// settings of systemd units.
+func systemdEscape(s string) string {
+	s = systemdEscapeSpecifiers(s)
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// systemdEscapeSpecifiers escapes the specifiers like "%h" in s, for settings
+// like User= or EnvironmentFile= which take the value verbatim without
+// quoting.
+func systemdEscapeSpecifiers(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// validateSystemd checks the values which are written verbatim to the
+// systemd units.
+func (p scheduleProfile) validateSystemd() error {
+	if strings.ContainsAny(p.User, " \t\n") {
+		return errors.Fatalf("invalid user %q for systemd, must not contain whitespace", p.User)
+	}
+	for _, path := range []struct{ name, value string }{
+		{"password_file", p.PasswordFile},
+		{"environment_file", p.EnvironmentFile},
+		{"log_file", p.LogFile},
+	} {
+		if path.value == "" {
+			continue
+		}
+		if !strings.HasPrefix(path.value, "/") || strings.Contains(path.value, "\n") {
+			return errors.Fatalf("invalid %v %q for systemd, must be an absolute path without line breaks", path.name, path.value)
+		}
+	}
+	return nil
+}
+
+// systemdUnits returns the content of the service and the timer unit for the
+// profile.
+func systemdUnits(p scheduleProfile) (service string, timer string) {
+	var sb strings.Builder
+
+	sb.WriteString("# generated by `restic generate`\n")
+	sb.WriteString("[Unit]\n")
+	fmt.Fprintf(&sb, "Description=restic %s (%s)\n", systemdEscapeSpecifiers(p.Args[0]), p.Name)
+	sb.WriteString("Wants=network-online.target\n")
+	sb.WriteString("After=network-online.target\n\n")
+
+	sb.WriteString("[Service]\n")
+	sb.WriteString("Type=oneshot\n")
+	if p.User != "" {
+		fmt.Fprintf(&sb, "User=%s\n", systemdEscapeSpecifiers(p.User))
+	}
+	fmt.Fprintf(&sb, "Environment=%s\n", systemdEscape("RESTIC_REPOSITORY="+p.Repository))
+	if p.PasswordFile != "" {
+		// credentials are only readable by the service and are not exposed
+		// via the environment
+		fmt.Fprintf(&sb, "LoadCredential=restic-password:%s\n", systemdEscapeSpecifiers(p.PasswordFile))
+		sb.WriteString("Environment=RESTIC_PASSWORD_FILE=%d/restic-password\n")
+	}
+	if p.PasswordCommand != "" {
+		fmt.Fprintf(&sb, "Environment=%s\n", systemdEscape("RESTIC_PASSWORD_COMMAND="+p.PasswordCommand))
+	}
+	if p.VaultAddress != "" {
+		fmt.Fprintf(&sb, "Environment=%s\n", systemdEscape("VAULT_ADDR="+p.VaultAddress))
+	}
+	if p.VaultPassword != "" {
+		fmt.Fprintf(&sb, "Environment=%s\n", systemdEscape("RESTIC_VAULT_PASSWORD="+p.VaultPassword))
+	}
+	if len(p.VaultEnv) > 0 {
+		fmt.Fprintf(&sb, "Environment=%s\n", systemdEscape("RESTIC_VAULT_ENV="+strings.Join(p.vaultEnv(), ",")))
+	}
+	if p.EnvironmentFile != "" {
+		fmt.Fprintf(&sb, "EnvironmentFile=%s\n", systemdEscapeSpecifiers(p.EnvironmentFile))
+	}
+
+	args := make([]string, 0, len(p.Args)+1)
+	for _, arg := range append([]string{p.Binary}, p.Args...) {
+		// ExecStart= additionally expands environment variables
+		args = append(args, systemdEscape(strings.ReplaceAll(arg, "$", "$$")))
+	}
+	fmt.Fprintf(&sb, "ExecStart=%s\n", strings.Join(args, " "))
+
+	if p.LogFile != "" {
+		fmt.Fprintf(&sb, "StandardOutput=append:%s\n", systemdEscapeSpecifiers(p.LogFile))
+		fmt.Fprintf(&sb, "StandardError=append:%s\n", systemdEscapeSpecifiers(p.LogFile))
+	} else {
+		sb.WriteString("StandardOutput=journal\n")
+		sb.WriteString("StandardError=journal\n")
+	}
+	fmt.Fprintf(&sb, "SyslogIdentifier=restic-%s\n", p.Name)
+	sb.WriteString("Nice=10\n")
+	sb.WriteString("IOSchedulingClass=idle\n")
+	service = sb.String()
+
+	sb.Reset()
+	sb.WriteString("# generated by `restic generate`\n")
+	sb.WriteString("[Unit]\n")
+	fmt.Fprintf(&sb, "Description=Run restic %s (%s) %s\n\n", systemdEscapeSpecifiers(p.Args[0]), p.Name, p.Schedule)
+	sb.WriteString("[Timer]\n")
+	switch p.Schedule {
+	case "hourly":
+		sb.WriteString("OnCalendar=hourly\n")
+	case "daily":
+		fmt.Fprintf(&sb, "OnCalendar=*-*-* %s:00\n", p.at())
+	case "weekly":
+		fmt.Fprintf(&sb, "OnCalendar=Mon *-*-* %s:00\n", p.at())
+	}
+	sb.WriteString("Persistent=true\n")
+	sb.WriteString("RandomizedDelaySec=5m\n\n")
+	sb.WriteString("[Install]\n")
+	sb.WriteString("WantedBy=timers.target\n")
+	timer = sb.String()
+
+	return service, timer
+}
+
+func writeSystemdUnits(dir string, p scheduleProfile) error {
+	if err := p.validateSystemd(); err != nil {
+		return err
+	}
+	service, timer := systemdUnits(p)
+	for name, content := range map[string]string{
+		"restic-" + p.Name + ".service": service,
+		"restic-" + p.Name + ".timer":   timer,
+	} {
+		filename := filepath.Join(dir, name)
+		Verbosef("writing systemd unit %v\n", filename)
+		err := os.WriteFile(filename, []byte(content), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// windowsQuote quotes an argument according to the rules used by the
+// Microsoft C runtime to split the command line.
+func windowsQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"") {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	backslashes := 0
+	for _, c := range s {
+		switch c {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			sb.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+		default:
+			sb.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		sb.WriteRune(c)
+	}
+	sb.WriteString(strings.Repeat(`\`, 2*backslashes))
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// cmdEscape escapes the metacharacters of cmd.exe in s with '^'. This includes
+// the quotes, such that cmd.exe does not consider any part of s as quoted text
+// in which escapes are not interpreted. The escaped quotes are still passed to
+// the started program.
+func cmdEscape(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`^&|<>()%!"`, c) {
+			sb.WriteByte('^')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// windowsSystemUser is the SID of the SYSTEM account.
+const windowsSystemUser = "S-1-5-18"
+
+// windowsTaskName returns the name of the scheduled task for the profile.
+func windowsTaskName(p scheduleProfile) string {
+	return "restic-" + p.Name
+}
+
+// windowsTask returns the task definition for the Windows Task Scheduler. The
+// task can be registered using `schtasks /Create /XML file /TN name`. It runs
+// with the highest privileges, which are required for VSS snapshots, wakes the
+// computer and also runs on battery power.
+func windowsTask(p scheduleProfile, start time.Time) string {
+	args := []string{"--repo", p.Repository}
+	if p.PasswordFile != "" {
+		args = append(args, "--password-file", p.PasswordFile)
+	}
+	if p.PasswordCommand != "" {
+		args = append(args, "--password-command", p.PasswordCommand)
+	}
+	if p.VaultAddress != "" {
+		args = append(args, "--vault-addr", p.VaultAddress)
+	}
+	if p.VaultPassword != "" {
+		args = append(args, "--vault-password", p.VaultPassword)
+	}
+	for _, entry := range p.vaultEnv() {
+		args = append(args, "--vault-env", entry)
+	}
+	args = append(args, p.Args...)
+
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, windowsQuote(arg))
+	}
+
+	command := p.Binary
+	arguments := strings.Join(quoted, " ")
+	if p.LogFile != "" {
+		// The task scheduler discards the output, route it through cmd.exe.
+		// With /s, cmd.exe only removes the outer quotes. The program and the
+		// log file must be quoted for cmd.exe to find them, while the
+		// arguments are escaped.
+		command = "cmd.exe"
+		arguments = fmt.Sprintf(`/d /s /c ""%s" %s >> "%s" 2>&1"`, p.Binary, cmdEscape(arguments), p.LogFile)
+	}
+
+	startTime, _ := time.Parse("15:04", p.at())
+	startBoundary := time.Date(start.Year(), start.Month(), start.Day(), startTime.Hour(), startTime.Minute(), 0, 0, time.Local)
+
+	var trigger string
+	switch p.Schedule {
+	case "hourly":
+		trigger = `    <TimeTrigger>
+      <StartBoundary>` + startBoundary.Format("2006-01-02T15:04:05") + `</StartBoundary>
+      <Repetition>
+        <Interval>PT1H</Interval>
+      </Repetition>
+      <Enabled>true</Enabled>
+    </TimeTrigger>
+`
+	case "daily":
+		trigger = `    <CalendarTrigger>
+      <StartBoundary>` + startBoundary.Format("2006-01-02T15:04:05") + `</StartBoundary>
+      <ScheduleByDay>
+        <DaysInterval>1</DaysInterval>
+      </ScheduleByDay>
+      <Enabled>true</Enabled>
+    </CalendarTrigger>
+`
+	case "weekly":
+		trigger = `    <CalendarTrigger>
+      <StartBoundary>` + startBoundary.Format("2006-01-02T15:04:05") + `</StartBoundary>
+      <ScheduleByWeek>
+        <WeeksInterval>1</WeeksInterval>
+        <DaysOfWeek>
+          <Monday />
+        </DaysOfWeek>
+      </ScheduleByWeek>
+      <Enabled>true</Enabled>
+    </CalendarTrigger>
+`
+	}
+
+	// the SYSTEM account does not need a password, other users are logged on
+	// without one, which allows the task to run while they are logged off
+	principal := "      <UserId>" + windowsSystemUser + "</UserId>\n      <LogonType>ServiceAccount</LogonType>\n"
+	if p.User != "" {
+		principal = "      <UserId>" + xmlEscape(p.User) + "</UserId>\n      <LogonType>S4U</LogonType>\n"
+	}
+
+	return `<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Description>` + xmlEscape(fmt.Sprintf("restic %s (%s), generated by `restic generate`", p.Args[0], p.Name)) + `</Description>
+  </RegistrationInfo>
+  <Triggers>
+` + trigger + `  </Triggers>
+  <Principals>
+    <Principal id="Author">
+` + principal + `      <RunLevel>HighestAvailable</RunLevel>
+    </Principal>
+  </Principals>
+  <Settings>
+    <MultipleInstancesPolicy>IgnoreNew</MultipleInstancesPolicy>
+    <DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>
+    <StopIfGoingOnBatteries>false</StopIfGoingOnBatteries>
+    <StartWhenAvailable>true</StartWhenAvailable>
+    <RunOnlyIfNetworkAvailable>true</RunOnlyIfNetworkAvailable>
+    <WakeToRun>true</WakeToRun>
+    <ExecutionTimeLimit>PT0S</ExecutionTimeLimit>
+    <Priority>7</Priority>
+  </Settings>
+  <Actions Context="Author">
+    <Exec>
+      <Command>` + xmlEscape(command) + `</Command>
+      <Arguments>` + xmlEscape(arguments) + `</Arguments>
+    </Exec>
+  </Actions>
+</Task>
+`
+}
+
+// encodeUTF16 converts s to UTF-16LE with a byte order mark, which is the
+// encoding expected by schtasks.
+func encodeUTF16(s string) []byte {
+	s = strings.ReplaceAll(s, "\n", "\r\n")
+	codes := utf16.Encode([]rune(s))
+	buf := make([]byte, 0, 2+2*len(codes))
+	buf = append(buf, 0xff, 0xfe)
+	for _, c := range codes {
+		buf = append(buf, byte(c), byte(c>>8))
+	}
+	return buf
+}
+
+func writeWindowsTask(filename string, p scheduleProfile) error {
+	Verbosef("writing Windows task definition %v, register it using `schtasks /Create /XML %v /TN %v`\n", filename, filename, windowsTaskName(p))
+	return os.WriteFile(filename, encodeUTF16(windowsTask(p, time.Now())), 0644)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testScheduleProfile() scheduleProfile {
+	return scheduleProfile{
+		Name:         "home",
+		Binary:       "/usr/bin/restic",
+		Repository:   "sftp:backup@server:/srv/restic",
+		PasswordFile: "/etc/restic/password",
+		Args:         []string{"backup", "--exclude", "*.tmp", "/home/user/my files"},
+		Schedule:     "daily",
+		At:           "02:30",
+	}
+}
+
+func TestScheduleProfileValidate(t *testing.T) {
+	rtest.OK(t, testScheduleProfile().validate())
+
+	for _, modify := range []func(p *scheduleProfile){
+		func(p *scheduleProfile) { p.Name = "foo bar" },
+		func(p *scheduleProfile) { p.Repository = "" },
+		func(p *scheduleProfile) { p.PasswordCommand = "pass show restic" },
+		func(p *scheduleProfile) { p.VaultPassword = "secret/data/restic#password" },
+		func(p *scheduleProfile) { p.Args = nil },
+		func(p *scheduleProfile) { p.Schedule = "monthly" },
+		func(p *scheduleProfile) { p.At = "25:00" },
+		func(p *scheduleProfile) { p.Schedule = "hourly" },
+		func(p *scheduleProfile) { p.Binary = `C:\%USERNAME%\restic.exe` },
+		func(p *scheduleProfile) { p.LogFile = `C:\logs\"home".log` },
+	} {
+		p := testScheduleProfile()
+		modify(&p)
+		rtest.Assert(t, p.validate() != nil, "expected validation error for %+v", p)
+	}
+}
+
+func TestSystemdUnits(t *testing.T) {
+	service, timer := systemdUnits(testScheduleProfile())
+
+	for _, line := range []string{
+		"Type=oneshot",
+		"Environment=RESTIC_REPOSITORY=sftp:backup@server:/srv/restic",
+		"LoadCredential=restic-password:/etc/restic/password",
+		"Environment=RESTIC_PASSWORD_FILE=%d/restic-password",
+		`ExecStart=/usr/bin/restic backup --exclude *.tmp "/home/user/my files"`,
+		"StandardOutput=journal",
+		"SyslogIdentifier=restic-home",
+	} {
+		rtest.Assert(t, strings.Contains(service, line+"\n"), "service unit is missing %q:\n%s", line, service)
+	}
+
+	rtest.Assert(t, strings.Contains(timer, "OnCalendar=*-*-* 02:30:00\n"), "unexpected timer unit:\n%s", timer)
+	rtest.Assert(t, strings.Contains(timer, "WantedBy=timers.target\n"), "unexpected timer unit:\n%s", timer)
+}
+
+func TestSystemdUnitsVault(t *testing.T) {
+	p := testScheduleProfile()
+	p.PasswordFile = ""
+	p.VaultAddress = "https://vault.example.com:8200"
+	p.VaultPassword = "secret/data/restic#password"
+	p.VaultEnv = map[string]string{
+		"AWS_SECRET_ACCESS_KEY": "secret/data/s3#secret_key",
+		"AWS_ACCESS_KEY_ID":     "secret/data/s3#key_id",
+	}
+	rtest.OK(t, p.validate())
+	service, _ := systemdUnits(p)
+
+	for _, line := range []string{
+		"Environment=VAULT_ADDR=https://vault.example.com:8200",
+		"Environment=RESTIC_VAULT_PASSWORD=secret/data/restic#password",
+		"Environment=RESTIC_VAULT_ENV=AWS_ACCESS_KEY_ID=secret/data/s3#key_id,AWS_SECRET_ACCESS_KEY=secret/data/s3#secret_key",
+	} {
+		rtest.Assert(t, strings.Contains(service, line+"\n"), "service unit is missing %q:\n%s", line, service)
+	}
+	rtest.Assert(t, !strings.Contains(service, "RESTIC_PASSWORD_FILE"), "unexpected password file:\n%s", service)
+}
+
+func TestSystemdUnitsEscape(t *testing.T) {
+	p := testScheduleProfile()
+	p.User = "backup%h"
+	p.PasswordFile = "/etc/restic/%i password"
+	p.EnvironmentFile = "/etc/restic/50%.env"
+	p.LogFile = "/var/log/restic %n.log"
+	rtest.OK(t, p.validateSystemd())
+	service, _ := systemdUnits(p)
+
+	for _, line := range []string{
+		"User=backup%%h",
+		"LoadCredential=restic-password:/etc/restic/%%i password",
+		"EnvironmentFile=/etc/restic/50%%.env",
+		"StandardOutput=append:/var/log/restic %%n.log",
+	} {
+		rtest.Assert(t, strings.Contains(service, line+"\n"), "service unit is missing %q:\n%s", line, service)
+	}
+
+	for _, modify := range []func(p *scheduleProfile){
+		func(p *scheduleProfile) { p.User = "backup user" },
+		func(p *scheduleProfile) { p.PasswordFile = "password" },
+		func(p *scheduleProfile) { p.EnvironmentFile = "/etc/restic/env\nExecStartPre=/bin/false" },
+		func(p *scheduleProfile) { p.LogFile = `C:\logs\restic.log` },
+	} {
+		p := testScheduleProfile()
+		modify(&p)
+		rtest.Assert(t, p.validateSystemd() != nil, "expected validation error for %+v", p)
+	}
+}
+
+func TestSystemdEscape(t *testing.T) {
+	for _, test := range []struct {
+		in, out string
+	}{
+		{"foo", "foo"},
+		{"", `""`},
+		{"50%", "50%%"},
+		{"a b", `"a b"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"a\nb", `"a\nb"`},
+	} {
+		rtest.Equals(t, test.out, systemdEscape(test.in))
+	}
+}
+
+func TestWindowsQuote(t *testing.T) {
+	for _, test := range []struct {
+		in, out string
+	}{
+		{`C:\restic\restic.exe`, `C:\restic\restic.exe`},
+		{`C:\Program Files\restic`, `"C:\Program Files\restic"`},
+		{`C:\my dir\`, `"C:\my dir\\"`},
+		{`a"b`, `"a\"b"`},
+		{"", `""`},
+	} {
+		rtest.Equals(t, test.out, windowsQuote(test.in))
+	}
+}
+
+func TestWindowsTask(t *testing.T) {
+	p := testScheduleProfile()
+	p.Binary = `C:\restic\restic.exe`
+	p.PasswordFile = `C:\restic\password.txt`
+	p.Schedule = "weekly"
+	p.LogFile = `C:\restic\logs\home.log`
+
+	task := windowsTask(p, time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local))
+
+	for _, s := range []string{
+		"<StartBoundary>2024-03-01T02:30:00</StartBoundary>",
+		"<Monday />",
+		"<Command>cmd.exe</Command>",
+		"<UserId>S-1-5-18</UserId>",
+		"<RunLevel>HighestAvailable</RunLevel>",
+		"<WakeToRun>true</WakeToRun>",
+		"<DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>",
+		`<Arguments>/d /s /c &#34;&#34;C:\restic\restic.exe&#34; --repo sftp:backup@server:/srv/restic --password-file C:\restic\password.txt backup --exclude *.tmp ^&#34;/home/user/my files^&#34; &gt;&gt; &#34;C:\restic\logs\home.log&#34; 2&gt;&amp;1&#34;</Arguments>`,
+	} {
+		rtest.Assert(t, strings.Contains(task, s), "task is missing %q:\n%s", s, task)
+	}
+
+	// metacharacters of cmd.exe in the arguments are escaped
+	p.Args = []string{"backup", `C:\a&b`, "%PATH%", `"(x) | y"`}
+	task = windowsTask(p, time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local))
+	def, err := parseWindowsTask([]byte(task))
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.HasSuffix(def.Exec.Arguments, ` backup C:\a^&b ^%PATH^% ^"\^"^(x^) ^| y\^"^" >> "C:\restic\logs\home.log" 2>&1"`),
+		"unexpected arguments %q", def.Exec.Arguments)
+
+	buf := encodeUTF16("a\n")
+	rtest.Equals(t, []byte{0xff, 0xfe}, buf[:2])
+	codes := make([]uint16, 0)
+	for i := 2; i < len(buf); i += 2 {
+		codes = append(codes, uint16(buf[i])|uint16(buf[i+1])<<8)
+	}
+	rtest.Equals(t, "a\r\n", string(utf16.Decode(codes)))
+}
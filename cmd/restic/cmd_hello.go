@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/winhello"
+	"github.com/spf13/cobra"
+)
+
+var cmdHello = &cobra.Command{
+	Use:   "hello",
+	Short: "Unlock the repository using Windows Hello",
+	Long: `
+The "hello" command manages repository passwords which are stored on a Windows
+workstation and unlocked using Windows Hello, e.g. by fingerprint, face
+recognition or PIN. Interactive "mount" and "restore" commands then ask for
+Windows Hello instead of the password.
+
+The password is encrypted using a key which is derived from a Windows Hello
+key credential. The credential is kept in the TPM or the Windows Hello
+container and can only be used after the user was verified, thus the password
+cannot be decrypted without Windows Hello. The encrypted password is
+additionally protected using DPAPI, such that only the same user on the same
+machine can read it. It is stored per repository location.
+	`,
+	DisableAutoGenTag: true,
+	GroupID:           cmdGroupAdvanced,
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdHello)
+}
+
+// helloCredentialFile returns the file which stores the password for the
+// repository at location.
+func helloCredentialFile(location string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	id := sha256.Sum256([]byte(location))
+	return filepath.Join(dir, "restic", "hello", hex.EncodeToString(id[:])), nil
+}
+
+// helloCredentialName returns the name of the Windows Hello key credential
+// which protects the password for the repository at location.
+func helloCredentialName(location string) string {
+	id := sha256.Sum256([]byte(location))
+	return "restic " + hex.EncodeToString(id[:16])
+}
+
+// loadHelloPassword verifies the user using Windows Hello and returns the
+// stored password for the repository at location. An error wrapping
+// os.ErrNotExist is returned if no password is stored.
+func loadHelloPassword(ctx context.Context, location string) (string, error) {
+	filename, err := helloCredentialFile(location)
+	if err != nil {
+		return "", err
+	}
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	pwd, err := winhello.Open(ctx, helloCredentialName(location), buf)
+	if err != nil {
+		return "", err
+	}
+	return string(pwd), nil
+}
+
+// unlockWithHello tries to open the repository using the password stored for
+// Windows Hello. It returns false if no password is stored or the repository
+// could not be unlocked, the caller then asks for the password.
+func unlockWithHello(ctx context.Context, repo *repository.Repository, location string, opts GlobalOptions) bool {
+	pwd, err := loadHelloPassword(ctx, location)
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		Warnf("unlocking using Windows Hello failed: %v\n", err)
+		return false
+	}
+
+	err = repo.SearchKey(ctx, pwd, maxKeys, opts.KeyHint)
+	if err != nil {
+		Warnf("the password stored for Windows Hello does not open the repository, run `restic hello enroll` again: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// helloUnlockCommand reports whether the command may unlock the repository
+// using Windows Hello.
+func helloUnlockCommand(cmd string) bool {
+	switch cmd {
+	case "mount", "restore":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/winhello"
+	"github.com/spf13/cobra"
+)
+
+var cmdHelloEnroll = &cobra.Command{
+	Use:   "enroll",
+	Short: "Store the repository password for unlocking with Windows Hello",
+	Long: `
+The "enroll" sub-command checks that the password opens the repository,
+creates a Windows Hello key credential for the repository and then stores the
+password encrypted using the credential. Windows Hello asks twice to verify the
+user, once to create the credential and once to use it. Enrolling again
+replaces the credential and the stored password, e.g. after the password has
+been changed using "restic key passwd".
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHelloEnroll(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdHello.AddCommand(cmdHelloEnroll)
+}
+
+func runHelloEnroll(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the hello enroll command expects no arguments, only options - please see `restic help hello enroll` for usage and flags")
+	}
+	if runtime.GOOS != "windows" {
+		return errors.Fatalf("%v", winhello.ErrNotSupported)
+	}
+
+	location, err := ReadRepo(gopts)
+	if err != nil {
+		return err
+	}
+
+	// make sure the password which is stored opens the repository
+	gopts.password, err = ReadPassword(ctx, gopts, "enter password for repository: ")
+	if err != nil {
+		return err
+	}
+	_, err = OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	buf, err := winhello.Seal(ctx, helloCredentialName(location), []byte(gopts.password))
+	if err != nil {
+		return errors.Fatalf("%v", err)
+	}
+
+	filename, err := helloCredentialFile(location)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filename, buf, 0600)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("stored password for %v, unlock it using Windows Hello\n", location)
+	return nil
+}
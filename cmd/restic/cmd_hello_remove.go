@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/winhello"
+	"github.com/spf13/cobra"
+)
+
+var cmdHelloRemove = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove the password stored for Windows Hello",
+	Long: `
+The "remove" sub-command deletes the password stored for the repository by
+"restic hello enroll" and the Windows Hello key credential which protects it.
+The repository itself is not modified.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHelloRemove(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdHello.AddCommand(cmdHelloRemove)
+}
+
+func runHelloRemove(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the hello remove command expects no arguments, only options - please see `restic help hello remove` for usage and flags")
+	}
+
+	location, err := ReadRepo(gopts)
+	if err != nil {
+		return err
+	}
+	filename, err := helloCredentialFile(location)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.Fatalf("no password stored for %v", location)
+	}
+	if err != nil {
+		return err
+	}
+	err = winhello.Remove(ctx, helloCredentialName(location))
+	if err != nil {
+		Warnf("unable to remove the Windows Hello credential: %v\n", err)
+	}
+
+	Verbosef("removed stored password for %v\n", location)
+	return nil
+}
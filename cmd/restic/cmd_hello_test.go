@@ -0,0 +1,19 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestHelloCredentialFile(t *testing.T) {
+	a, err := helloCredentialFile("/srv/restic-repo")
+	rtest.OK(t, err)
+	b, err := helloCredentialFile("sftp:user@host:/srv/restic-repo")
+	rtest.OK(t, err)
+
+	rtest.Assert(t, a != b, "same credential file for different repositories: %v", a)
+	rtest.Equals(t, filepath.Dir(a), filepath.Dir(b))
+	rtest.Equals(t, "hello", filepath.Base(filepath.Dir(a)))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/export"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdImportSnapshot = &cobra.Command{
+	Use:   "import-snapshot [flags] file",
+	Short: "Import a snapshot from an encrypted archive",
+	Long: `
+The "import-snapshot" command reads an archive created by "export-snapshot"
+from the given file, or from standard input if the file is "-", and adds the
+snapshot with all trees and file contents to the repository. Data which is
+already stored in the repository is not added again, and a snapshot which was
+already imported is skipped.
+
+The archive password is read from the file given by --archive-password-file or
+requested interactively.
+
+Snapshots can only be imported into repositories which use the same content
+hash as the repository they were exported from (see "restic help init").
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runImportSnapshot(cmd.Context(), importSnapshotOptions, globalOptions, args)
+	},
+}
+
+// ImportSnapshotOptions collects all options for the import-snapshot command.
+type ImportSnapshotOptions struct {
+	ArchivePasswordFile string
+}
+
+var importSnapshotOptions ImportSnapshotOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdImportSnapshot)
+
+	f := cmdImportSnapshot.Flags()
+	f.StringVar(&importSnapshotOptions.ArchivePasswordFile, "archive-password-file", "", "`file` to read the archive password from")
+}
+
+func runImportSnapshot(ctx context.Context, opts ImportSnapshotOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("no archive file specified")
+	}
+	if args[0] == "-" && opts.ArchivePasswordFile == "" {
+		return errors.Fatal("--archive-password-file is required to read the archive from stdin")
+	}
+
+	password, err := readArchivePassword(ctx, gopts, opts.ArchivePasswordFile, false)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return errors.Fatalf("unable to open archive: %v", err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		in = f
+	}
+
+	rd, err := export.Open(in, password)
+	if err != nil {
+		return errors.Fatalf("unable to read archive: %v", err)
+	}
+	sn := rd.Manifest.Snapshot
+	if attrs := rd.UnknownAttributes(); len(attrs) > 0 {
+		Warnf("the archive was created by a newer version of restic, the attributes %v are preserved but not supported by this version\n",
+			strings.Join(attrs, ", "))
+	}
+
+	ctx, repo, unlock, err := openWithAppendLock(ctx, gopts, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// use Original as a persistent snapshot ID, like the copy command
+	sn.Parent = nil
+	if sn.Original == nil {
+		id := rd.Manifest.SnapshotID
+		sn.Original = &id
+	}
+
+	imported := false
+	err = restic.ForAllSnapshots(ctx, repo, repo, nil, func(_ restic.ID, dstSn *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		if dstSn.Original != nil && dstSn.Original.Equal(*sn.Original) && similarSnapshots(dstSn, sn) {
+			imported = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if imported {
+		Verbosef("snapshot %v was already imported\n", rd.Manifest.SnapshotID.Str())
+		return nil
+	}
+
+	if repo.Config().ChunkerPolynomial != rd.Manifest.ChunkerPolynomial {
+		Verbosef("the archive uses different chunker parameters, imported files do not deduplicate against other files in the repository, see `restic help chunker`\n")
+	}
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	if err := repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	Verbosef("importing snapshot %v of %v at %v\n", rd.Manifest.SnapshotID.Str(), sn.Paths, sn.Time)
+	bar = newProgressMax(!gopts.Quiet, 0, "blobs imported")
+	err = rd.Import(ctx, repo, bar)
+	bar.Done()
+	if err != nil {
+		return errors.Fatalf("unable to import archive: %v", err)
+	}
+
+	id, err := restic.SaveSnapshot(ctx, repo, sn)
+	if err != nil {
+		return err
+	}
+	Verbosef("snapshot %v saved\n", id.Str())
+	return nil
+}
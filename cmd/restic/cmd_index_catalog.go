@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdIndexCatalog = &cobra.Command{
+	Use:   "index-catalog [flags]",
+	Short: "Update the local file catalog used by search",
+	Long: `
+The "index-catalog" command maintains an optional, local catalog of the files
+contained in all snapshots of the repository. The "search" command uses the
+catalog to find files without loading any trees from the repository.
+
+Each run adds the snapshots which are missing in the catalog and removes the
+snapshots which no longer exist in the repository, then updates the index of
+all distinct paths used by "search". It is usually run after "backup" and
+"forget". With "--content-ids", the catalog also stores an ID for
+the content of each file, which allows searching for all copies of a file
+using "restic search --content-id".
+
+The catalog is stored in a "catalog" directory in the cache directory, or in
+the directory given by "--catalog-dir". It is not encrypted and reveals the
+names of all files in the repository to anyone who can read it. Use "--drop"
+to delete the catalog of the repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runIndexCatalog(cmd.Context(), indexCatalogOptions, globalOptions, args)
+	},
+}
+
+// IndexCatalogOptions bundles all options for the index-catalog command.
+type IndexCatalogOptions struct {
+	catalogOptions
+	ContentIDs bool
+	Drop       bool
+}
+
+var indexCatalogOptions IndexCatalogOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdIndexCatalog)
+
+	f := cmdIndexCatalog.Flags()
+	initCatalogOptions(f, &indexCatalogOptions.catalogOptions)
+	f.BoolVar(&indexCatalogOptions.ContentIDs, "content-ids", false, "store content IDs of files, required for search --content-id")
+	f.BoolVar(&indexCatalogOptions.Drop, "drop", false, "delete the catalog of the repository")
+}
+
+func runIndexCatalog(ctx context.Context, opts IndexCatalogOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the index-catalog command expects no arguments, only options - please see `restic help index-catalog` for usage and flags")
+	}
+	if opts.Drop && opts.ContentIDs {
+		return errors.Fatal("--drop and --content-ids are mutually exclusive")
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if opts.Drop {
+		dir, err := opts.catalogDir(gopts, repo)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.Fatalf("unable to delete catalog: %v", err)
+		}
+		Verbosef("deleted catalog in %v\n", dir)
+		return nil
+	}
+
+	c, err := opts.openCatalog(gopts, repo)
+	if err != nil {
+		return err
+	}
+
+	var snapshots []*restic.Snapshot
+	for sn := range FindFilteredSnapshots(ctx, repo, repo, &restic.SnapshotFilter{}, nil) {
+		snapshots = append(snapshots, sn)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	if err = repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	added := 0
+	removed, err := c.Update(ctx, repo, snapshots, opts.ContentIDs, func(sn *restic.Snapshot, entries int) {
+		added++
+		Verbosef("added snapshot %v with %d entries\n", sn.ID().Str(), entries)
+	})
+	if err != nil {
+		return err
+	}
+
+	Verbosef("catalog contains %d snapshots, %d added, %d removed\n", len(snapshots), added, removed)
+	return nil
+}
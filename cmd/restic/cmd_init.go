@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/backend/location"
@@ -20,6 +22,31 @@ var cmdInit = &cobra.Command{
 	Long: `
 The "init" command initializes a new repository.
 
+By default, blob IDs are computed using SHA-256. With "--content-hash blake3",
+the repository uses BLAKE3 instead, which is faster than SHA-256 on CPUs with
+SIMD support. This requires repository version 3, which is selected
+automatically. Repositories using BLAKE3 cannot be accessed by older restic
+versions. The content hash cannot be changed after the repository was created.
+When copying the chunker parameters from another repository, its content hash
+is used as well.
+
+Repositories only deduplicate data copied between them if they use the same
+chunker polynomial and content hash. Instead of copying them from another
+repository, these parameters can be supplied by the operator using
+"--chunker-profile" with a file written by "restic chunker export", or using
+"--chunker-polynomial". This allows creating several repositories with the
+same profile without access to a common source repository.
+
+With "--fips", the repository only uses cryptography approved by FIPS 140:
+AES-256-GCM for encryption, PBKDF2 with HMAC-SHA-256 to derive keys from
+passwords and SHA-256 for blob IDs. This requires repository version 3, which
+is selected automatically, and a build of restic using a FIPS 140 validated
+cryptographic module.
+
+By default, the key is derived from the password using scrypt. With
+"--kdf argon2id", Argon2id is used instead, see "restic help key add" for
+details. Existing keys can be switched to Argon2id using "restic key passwd".
+
 EXIT STATUS
 ===========
 
@@ -37,7 +64,11 @@ Exit status is 1 if there was any error.
 type InitOptions struct {
 	secondaryRepoOptions
 	CopyChunkerParameters bool
+	ChunkerProfile        string
+	ChunkerPolynomial     string
 	RepositoryVersion     string
+	ContentHash           string
+	kdfOptions
 }
 
 var initOptions InitOptions
@@ -48,7 +79,11 @@ func init() {
 	f := cmdInit.Flags()
 	initSecondaryRepoOptions(f, &initOptions.secondaryRepoOptions, "secondary", "to copy chunker parameters from")
 	f.BoolVar(&initOptions.CopyChunkerParameters, "copy-chunker-params", false, "copy chunker parameters from the secondary repository (useful with the copy command)")
+	f.StringVar(&initOptions.ChunkerProfile, "chunker-profile", "", "use the chunker parameters from the profile in `file` written by 'restic chunker export'")
+	f.StringVar(&initOptions.ChunkerPolynomial, "chunker-polynomial", "", "use the chunker `polynomial` given in hex")
 	f.StringVar(&initOptions.RepositoryVersion, "repository-version", "stable", "repository format version to use, allowed values are a format version, 'latest' and 'stable'")
+	f.StringVar(&initOptions.ContentHash, "content-hash", "", "`hash` function used for blob IDs, allowed values are 'sha256' and 'blake3' (default: sha256)")
+	initKDFOptions(f, &initOptions.kdfOptions)
 }
 
 func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []string) error {
@@ -58,7 +93,7 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 
 	var version uint
 	if opts.RepositoryVersion == "latest" || opts.RepositoryVersion == "" {
-		version = restic.MaxRepoVersion
+		version = restic.LatestRepoVersion
 	} else if opts.RepositoryVersion == "stable" {
 		version = restic.StableRepoVersion
 	} else {
@@ -71,12 +106,58 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 	if version < restic.MinRepoVersion || version > restic.MaxRepoVersion {
 		return errors.Fatalf("only repository versions between %v and %v are allowed", restic.MinRepoVersion, restic.MaxRepoVersion)
 	}
+	// the version is raised automatically for features which require it,
+	// unless a version number was given
+	versionSelected := opts.RepositoryVersion != "stable" && opts.RepositoryVersion != "latest" && opts.RepositoryVersion != ""
+
+	var chunkerPolynomial *chunker.Pol
+	contentHash := opts.ContentHash
+	profile, source, err := readChunkerProfile(ctx, opts, gopts)
+	if err != nil {
+		return err
+	}
+	if profile != nil {
+		chunkerPolynomial = &profile.ChunkerPolynomial
+		if contentHash == "" {
+			contentHash = profile.ContentHash
+		} else if contentHash != profile.ContentHash {
+			return errors.Fatalf("the %v uses content hash %v, cannot use its chunker parameters for a repository using %v", source, profile.ContentHash, contentHash)
+		}
+	}
 
-	chunkerPolynomial, err := maybeReadChunkerPolynomial(ctx, opts, gopts)
+	if contentHash == restic.ContentHashBLAKE3 && version < restic.ContentHashVersion {
+		if versionSelected {
+			return errors.Fatalf("content hash %v requires repository version %v or later", contentHash, restic.ContentHashVersion)
+		}
+		version = restic.ContentHashVersion
+	}
+	if err := restic.ValidateContentHash(version, contentHash); err != nil {
+		return errors.Fatal(err.Error())
+	}
+
+	kdf, err := opts.kdfOptions.repositoryOptions()
 	if err != nil {
 		return err
 	}
 
+	if gopts.FIPS {
+		if err := checkFIPS(gopts); err != nil {
+			return err
+		}
+		if kdf.KDF != "" && kdf.KDF != repository.KDFScrypt {
+			return errors.Fatalf("KDF %v is not approved in FIPS mode", kdf.KDF)
+		}
+		if contentHash == restic.ContentHashBLAKE3 {
+			return errors.Fatalf("content hash %v is not approved in FIPS mode", contentHash)
+		}
+		if version < restic.CipherVersion {
+			if versionSelected {
+				return errors.Fatalf("FIPS mode requires repository version %v or later", restic.CipherVersion)
+			}
+			version = restic.CipherVersion
+		}
+	}
+
 	gopts.Repo, err = ReadRepo(gopts)
 	if err != nil {
 		return err
@@ -97,20 +178,22 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 	s, err := repository.New(be, repository.Options{
 		Compression: gopts.Compression,
 		PackSize:    gopts.PackSize * 1024 * 1024,
+		FIPS:        gopts.FIPS,
+		KDF:         kdf,
 	})
 	if err != nil {
 		return errors.Fatal(err.Error())
 	}
 
-	err = s.Init(ctx, version, gopts.password, chunkerPolynomial)
+	err = s.Init(ctx, version, gopts.password, chunkerPolynomial, contentHash)
 	if err != nil {
 		return errors.Fatalf("create key in repository at %s failed: %v\n", location.StripPassword(gopts.backends, gopts.Repo), err)
 	}
 
 	if !gopts.JSON {
 		Verbosef("created restic repository %v at %s", s.Config().ID[:10], location.StripPassword(gopts.backends, gopts.Repo))
-		if opts.CopyChunkerParameters && chunkerPolynomial != nil {
-			Verbosef(" with chunker parameters copied from secondary repository\n")
+		if chunkerPolynomial != nil {
+			Verbosef(" with chunker parameters from the %v\n", source)
 		} else {
 			Verbosef("\n")
 		}
@@ -131,7 +214,56 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 	return nil
 }
 
-func maybeReadChunkerPolynomial(ctx context.Context, opts InitOptions, gopts GlobalOptions) (*chunker.Pol, error) {
+// readChunkerProfile returns the chunker profile selected by the options
+// together with a description of its source, or nil if a random polynomial
+// should be used.
+func readChunkerProfile(ctx context.Context, opts InitOptions, gopts GlobalOptions) (*restic.ChunkerProfile, string, error) {
+	sources := 0
+	for _, set := range []bool{opts.CopyChunkerParameters, opts.ChunkerProfile != "", opts.ChunkerPolynomial != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, "", errors.Fatal("--copy-chunker-params, --chunker-profile and --chunker-polynomial are mutually exclusive")
+	}
+
+	switch {
+	case opts.ChunkerProfile != "":
+		buf, err := os.ReadFile(opts.ChunkerProfile)
+		if err != nil {
+			return nil, "", errors.Fatalf("unable to read chunker profile: %v", err)
+		}
+		profile, err := restic.ParseChunkerProfile(buf)
+		if err != nil {
+			return nil, "", errors.Fatalf("invalid chunker profile %v: %v", opts.ChunkerProfile, err)
+		}
+		return &profile, "chunker profile", nil
+
+	case opts.ChunkerPolynomial != "":
+		pol, err := strconv.ParseUint(strings.TrimPrefix(opts.ChunkerPolynomial, "0x"), 16, 64)
+		if err != nil {
+			return nil, "", errors.Fatalf("invalid chunker polynomial %q", opts.ChunkerPolynomial)
+		}
+		profile := restic.ChunkerProfile{ChunkerPolynomial: chunker.Pol(pol), ContentHash: opts.ContentHash}
+		if profile.ContentHash == "" {
+			profile.ContentHash = restic.ContentHashSHA256
+		}
+		if err := profile.Validate(); err != nil {
+			return nil, "", errors.Fatal(err.Error())
+		}
+		return &profile, "given chunker polynomial", nil
+	}
+
+	secondaryCfg, err := maybeReadSecondaryConfig(ctx, opts, gopts)
+	if err != nil || secondaryCfg == nil {
+		return nil, "", err
+	}
+	profile := secondaryCfg.ChunkerProfile()
+	return &profile, "secondary repository", nil
+}
+
+func maybeReadSecondaryConfig(ctx context.Context, opts InitOptions, gopts GlobalOptions) (*restic.Config, error) {
 	if opts.CopyChunkerParameters {
 		otherGopts, _, err := fillSecondaryGlobalOpts(ctx, opts.secondaryRepoOptions, gopts, "secondary")
 		if err != nil {
@@ -143,8 +275,8 @@ func maybeReadChunkerPolynomial(ctx context.Context, opts InitOptions, gopts Glo
 			return nil, err
 		}
 
-		pol := otherRepo.Config().ChunkerPolynomial
-		return &pol, nil
+		cfg := otherRepo.Config()
+		return &cfg, nil
 	}
 
 	if opts.Repo != "" || opts.RepositoryFile != "" || opts.LegacyRepo != "" || opts.LegacyRepositoryFile != "" {
@@ -9,6 +9,7 @@ import (
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
 )
 
 func testRunInit(t testing.TB, opts GlobalOptions) {
@@ -54,3 +55,89 @@ func TestInitCopyChunkerParams(t *testing.T) {
 		"expected equal chunker polynomials, got %v expected %v", repo.Config().ChunkerPolynomial,
 		otherRepo.Config().ChunkerPolynomial)
 }
+
+func TestInitLatestVersion(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+
+	rtest.OK(t, runInit(context.TODO(), InitOptions{RepositoryVersion: "latest"}, env.gopts, nil))
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(restic.LatestRepoVersion), repo.Config().Version)
+}
+
+func TestInitContentHash(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+
+	initOpts := InitOptions{RepositoryVersion: "2", ContentHash: restic.ContentHashBLAKE3}
+	rtest.Assert(t, runInit(context.TODO(), initOpts, env.gopts, nil) != nil, "expected BLAKE3 with repository version 2 to fail")
+
+	initOpts.RepositoryVersion = "stable"
+	rtest.OK(t, runInit(context.TODO(), initOpts, env.gopts, nil))
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(restic.ContentHashVersion), repo.Config().Version)
+	rtest.Equals(t, restic.ContentHashBLAKE3, repo.Config().ContentHashName())
+
+	rtest.SetupTarTestFixture(t, env.testdata, filepath.Join("testdata", "backup-data.tar.gz"))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotID.String())
+	diffs := directoriesContentsDiff(env.testdata, filepath.Join(env.base, "restore", env.testdata))
+	rtest.Assert(t, diffs == "", "directories are not equal %v", diffs)
+
+	// snapshots cannot be copied to a repository using SHA-256
+	testRunInit(t, env2.gopts)
+	gopts := env.gopts
+	gopts.Repo = env2.gopts.Repo
+	copyOpts := CopyOptions{secondaryRepoOptions: secondaryRepoOptions{Repo: env.gopts.Repo, password: env.gopts.password}}
+	err = withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runCopy(ctx, copyOpts, gopts, nil, term)
+	})
+	rtest.Assert(t, err != nil, "expected copy between different content hashes to fail")
+}
+
+func TestInitChunkerProfile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+	env3, cleanup3 := withTestEnvironment(t)
+	defer cleanup3()
+
+	testRunInit(t, env.gopts)
+	profileFile := filepath.Join(env.base, "profile.json")
+	rtest.OK(t, runChunkerExport(context.TODO(), env.gopts, []string{profileFile}))
+
+	initOpts := InitOptions{ChunkerProfile: profileFile, ContentHash: restic.ContentHashBLAKE3}
+	rtest.Assert(t, runInit(context.TODO(), initOpts, env2.gopts, nil) != nil, "expected conflicting content hash to fail")
+	initOpts.ContentHash = ""
+	initOpts.ChunkerPolynomial = "3DA3358B4DC173"
+	rtest.Assert(t, runInit(context.TODO(), initOpts, env2.gopts, nil) != nil, "expected multiple chunker parameter sources to fail")
+	initOpts.ChunkerPolynomial = ""
+	rtest.OK(t, runInit(context.TODO(), initOpts, env2.gopts, nil))
+
+	rtest.Assert(t, runInit(context.TODO(), InitOptions{ChunkerPolynomial: "0x3"}, env3.gopts, nil) != nil, "expected invalid polynomial to fail")
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, runInit(context.TODO(), InitOptions{ChunkerPolynomial: repo.Config().ChunkerPolynomial.String()}, env3.gopts, nil))
+
+	for _, gopts := range []GlobalOptions{env2.gopts, env3.gopts} {
+		otherRepo, err := OpenRepository(context.TODO(), gopts)
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.Config().ChunkerProfile(), otherRepo.Config().ChunkerProfile())
+	}
+}
@@ -2,10 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
 
+	"github.com/restic/restic/internal/audit"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/oplog"
 	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -16,6 +22,18 @@ var cmdKeyAdd = &cobra.Command{
 	Long: `
 The "add" sub-command creates a new key and validates the key. Returns the new key ID.
 
+With --new-token-command, the new key is protected by a hardware token such as
+a PKCS#11 token or a smart card instead of a password. Restic generates a random
+secret for the key and passes it to the command on stdin. The command must print
+the secret wrapped (encrypted) by the token to stdout. To open the repository
+using the key, specify a command via --token-command which reads the wrapped
+secret from stdin and prints the unwrapped secret to stdout.
+
+By default, the new key is derived from the password using scrypt. With
+"--kdf argon2id", Argon2id is used instead. Its parameters are set using
+--argon2-time, --argon2-memory and --argon2-threads. Keys of repositories
+created in FIPS mode are always derived using PBKDF2.
+
 EXIT STATUS
 ===========
 
@@ -31,15 +49,19 @@ Exit status is 12 if the password is incorrect.
 type KeyAddOptions struct {
 	NewPasswordFile    string
 	InsecureNoPassword bool
+	NewTokenCommand    string
 	Username           string
 	Hostname           string
+	kdfOptions
 }
 
 func (opts *KeyAddOptions) Add(flags *pflag.FlagSet) {
 	flags.StringVarP(&opts.NewPasswordFile, "new-password-file", "", "", "`file` from which to read the new password")
 	flags.BoolVar(&opts.InsecureNoPassword, "new-insecure-no-password", false, "add an empty password for the repository (insecure)")
+	flags.StringVarP(&opts.NewTokenCommand, "new-token-command", "", "", "shell `command` which wraps the secret of the new key using a hardware token")
 	flags.StringVarP(&opts.Username, "user", "", "", "the username for new key")
 	flags.StringVarP(&opts.Hostname, "host", "", "", "the hostname for new key")
+	initKDFOptions(flags, &opts.kdfOptions)
 }
 
 func init() {
@@ -67,11 +89,22 @@ func runKeyAdd(ctx context.Context, gopts GlobalOptions, opts KeyAddOptions, arg
 }
 
 func addKey(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, opts KeyAddOptions) error {
+	kdf, err := opts.kdfOptions.repositoryOptions()
+	if err != nil {
+		return err
+	}
+	repo.SetKDFOptions(kdf)
+
+	if opts.NewTokenCommand != "" {
+		return addTokenKey(ctx, repo, opts)
+	}
+
 	pw, err := getNewPassword(ctx, gopts, opts.NewPasswordFile, opts.InsecureNoPassword)
 	if err != nil {
 		return err
 	}
 
+	oldID := repo.KeyID()
 	id, err := repository.AddKey(ctx, repo, pw, opts.Username, opts.Hostname, repo.Key())
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
@@ -83,8 +116,64 @@ func addKey(ctx context.Context, repo *repository.Repository, gopts GlobalOption
 	}
 
 	Verbosef("saved new key with ID %s\n", id.ID())
+	auditEvent(audit.Event{Type: "key-added", Name: "Key added", Severity: 6, KeyID: id.ID().String()})
 
-	return nil
+	return recordKeyAdded(ctx, repo, oldID, id.ID(), "")
+}
+
+func addTokenKey(ctx context.Context, repo *repository.Repository, opts KeyAddOptions) error {
+	if opts.NewPasswordFile != "" || opts.InsecureNoPassword {
+		return errors.Fatal("--new-token-command cannot be combined with --new-password-file or --new-insecure-no-password")
+	}
+
+	buf := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, buf)
+	if err != nil {
+		return errors.Fatalf("unable to generate secret: %v", err)
+	}
+	secret := hex.EncodeToString(buf)
+
+	wrapped, err := runTokenCommand(ctx, opts.NewTokenCommand, []byte(secret))
+	if err != nil {
+		return err
+	}
+	if len(wrapped) == 0 {
+		return errors.Fatal("token command returned no data")
+	}
+
+	oldID := repo.KeyID()
+	id, err := repository.AddTokenKey(ctx, repo, secret, wrapped, opts.Username, opts.Hostname, repo.Key())
+	if err != nil {
+		return errors.Fatalf("creating new key failed: %v\n", err)
+	}
+
+	err = switchToNewKeyAndRemoveIfBroken(ctx, repo, id, secret)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("saved new token-protected key with ID %s\n", id.ID())
+	auditEvent(audit.Event{
+		Type:     "key-added",
+		Name:     "Key added",
+		Severity: 6,
+		KeyID:    id.ID().String(),
+		Message:  "token-protected key",
+	})
+
+	return recordKeyAdded(ctx, repo, oldID, id.ID(), "token-protected key")
+}
+
+// recordKeyAdded records the new key in the operation log. The operation is
+// attributed to the key used to add it, not to the new key the repository
+// switched to.
+func recordKeyAdded(ctx context.Context, repo *repository.Repository, usedKey, newKey restic.ID, details string) error {
+	return recordOperation(ctx, repo, &oplog.Record{
+		Operation: oplog.OpKeyAdd,
+		KeyID:     &usedKey,
+		Key:       &newKey,
+		Details:   details,
+	})
 }
 
 // testKeyNewPassword is used to set a new password during integration testing.
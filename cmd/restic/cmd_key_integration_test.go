@@ -111,6 +111,59 @@ func TestKeyAddRemove(t *testing.T) {
 	testRunKeyAddNewKeyUserHost(t, env.gopts)
 }
 
+func TestKeyPasswdArgon2id(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// must list keys more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	testKeyNewPassword = env.gopts.password
+	defer func() {
+		testKeyNewPassword = ""
+	}()
+	opts := KeyPasswdOptions{KeyAddOptions{kdfOptions: kdfOptions{
+		KDF:           "argon2id",
+		Argon2Time:    1,
+		Argon2Memory:  1,
+		Argon2Threads: 1,
+	}}}
+	rtest.OK(t, runKeyPasswd(context.TODO(), env.gopts, opts, []string{}))
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	key, err := repository.LoadKey(context.TODO(), repo, repo.KeyID())
+	rtest.OK(t, err)
+	rtest.Equals(t, repository.KDFArgon2id, key.KDF)
+	rtest.Equals(t, 1024, key.Memory)
+	testRunCheck(t, env.gopts)
+
+	opts.Argon2Threads = 0
+	err = runKeyPasswd(context.TODO(), env.gopts, opts, []string{})
+	rtest.Assert(t, err != nil, "expected error for invalid argon2id parameters")
+}
+
+func TestKeyAuditLog(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// must list keys more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	env.gopts.AuditLog = filepath.Join(env.base, "audit.log")
+	env.gopts.AuditFormat = "leef"
+	rtest.OK(t, setupAudit(env.gopts, "key add"))
+	testRunKeyAddNewKey(t, "geheim2", env.gopts)
+	closeAudit()
+
+	data, err := os.ReadFile(env.gopts.AuditLog)
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.HasPrefix(string(data), "LEEF:1.0|restic|restic|"+version+"|key-added|"), "unexpected audit log %q", data)
+	rtest.Assert(t, strings.Contains(string(data), "\trepository="+env.gopts.Repo+"\t"), "repository missing in audit log %q", data)
+}
+
 func TestKeyAddInvalid(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -61,6 +61,8 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 		UserName string `json:"userName"`
 		HostName string `json:"hostName"`
 		Created  string `json:"created"`
+		Token    bool   `json:"token"`
+		KDF      string `json:"kdf"`
 	}
 
 	var m sync.Mutex
@@ -80,6 +82,8 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 			UserName: k.Username,
 			HostName: k.Hostname,
 			Created:  k.Created.Local().Format(TimeFormat),
+			Token:    len(k.Token) > 0,
+			KDF:      k.KDF,
 		}
 
 		m.Lock()
@@ -101,6 +105,8 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 	tab.AddColumn("User", "{{ .UserName }}")
 	tab.AddColumn("Host", "{{ .HostName }}")
 	tab.AddColumn("Created", "{{ .Created }}")
+	tab.AddColumn("Token", "{{if .Token}}yes{{end}}")
+	tab.AddColumn("KDF", "{{ .KDF }}")
 
 	for _, key := range keys {
 		tab.AddRow(key)
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/restic/restic/internal/approval"
+	"github.com/restic/restic/internal/audit"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/oplog"
 	"github.com/restic/restic/internal/repository"
 	"github.com/spf13/cobra"
 )
@@ -16,6 +19,9 @@ var cmdKeyPasswd = &cobra.Command{
 The "passwd" sub-command creates a new key, validates the key and remove the old key ID.
 Returns the new key ID. 
 
+To switch an existing key to Argon2id, run "passwd" with "--kdf argon2id". The
+password can be kept unchanged.
+
 EXIT STATUS
 ===========
 
@@ -57,6 +63,19 @@ func runKeyPasswd(ctx context.Context, gopts GlobalOptions, opts KeyPasswdOption
 }
 
 func changePassword(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, opts KeyPasswdOptions) error {
+	kdf, err := opts.kdfOptions.repositoryOptions()
+	if err != nil {
+		return err
+	}
+	repo.SetKDFOptions(kdf)
+
+	// the old key is removed, which requires approval like key remove
+	oldID := repo.KeyID()
+	approved, err := requireApproval(ctx, repo, gopts, &approval.Request{Operation: approval.OpKeyPasswd, Key: &oldID})
+	if err != nil {
+		return err
+	}
+
 	pw, err := getNewPassword(ctx, gopts, opts.NewPasswordFile, opts.InsecureNoPassword)
 	if err != nil {
 		return err
@@ -66,7 +85,6 @@ func changePassword(ctx context.Context, repo *repository.Repository, gopts Glob
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
 	}
-	oldID := repo.KeyID()
 
 	err = switchToNewKeyAndRemoveIfBroken(ctx, repo, id, pw)
 	if err != nil {
@@ -77,8 +95,26 @@ func changePassword(ctx context.Context, repo *repository.Repository, gopts Glob
 	if err != nil {
 		return err
 	}
+	err = consumeApproval(ctx, repo, approved)
+	if err != nil {
+		return err
+	}
 
 	Verbosef("saved new key as %s\n", id)
-
-	return nil
+	auditEvent(audit.Event{
+		Type:     "key-changed",
+		Name:     "Key password changed",
+		Severity: 6,
+		KeyID:    id.ID().String(),
+		Message:  "replaced key " + oldID.String(),
+	})
+
+	newID := id.ID()
+	return recordOperation(ctx, repo, &oplog.Record{
+		Operation: oplog.OpKeyPasswd,
+		KeyID:     &oldID,
+		Key:       &newID,
+		Approval:  approvalID(approved),
+		Details:   "replaced key " + oldID.String(),
+	})
 }
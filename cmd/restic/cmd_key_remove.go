@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/restic/restic/internal/approval"
+	"github.com/restic/restic/internal/audit"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/oplog"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/cobra"
@@ -17,6 +20,9 @@ var cmdKeyRemove = &cobra.Command{
 The "remove" sub-command removes the selected key ID. The "remove" command does not allow
 removing the current key being used to access the repository. 
 
+If the repository has an approval policy, removing a key must be approved by
+two admins, see "restic help approval".
+
 EXIT STATUS
 ===========
 
@@ -47,10 +53,10 @@ func runKeyRemove(ctx context.Context, gopts GlobalOptions, args []string) error
 	}
 	defer unlock()
 
-	return deleteKey(ctx, repo, args[0])
+	return deleteKey(ctx, repo, gopts, args[0])
 }
 
-func deleteKey(ctx context.Context, repo *repository.Repository, idPrefix string) error {
+func deleteKey(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, idPrefix string) error {
 	id, err := restic.Find(ctx, repo, restic.KeyFile, idPrefix)
 	if err != nil {
 		return err
@@ -60,11 +66,21 @@ func deleteKey(ctx context.Context, repo *repository.Repository, idPrefix string
 		return errors.Fatal("refusing to remove key currently used to access repository")
 	}
 
+	approved, err := requireApproval(ctx, repo, gopts, &approval.Request{Operation: approval.OpKeyRemove, Key: &id})
+	if err != nil {
+		return err
+	}
+
 	err = repository.RemoveKey(ctx, repo, id)
 	if err != nil {
 		return err
 	}
+	err = consumeApproval(ctx, repo, approved)
+	if err != nil {
+		return err
+	}
 
 	Verbosef("removed key %v\n", id)
-	return nil
+	auditEvent(audit.Event{Type: "key-removed", Name: "Key removed", Severity: 7, KeyID: id.String()})
+	return recordOperation(ctx, repo, &oplog.Record{Operation: oplog.OpKeyRemove, Key: &id, Approval: approvalID(approved)})
 }
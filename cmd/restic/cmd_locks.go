@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdLocks = &cobra.Command{
+	Use:   "locks",
+	Short: "Inspect and break repository locks",
+	Long: `
+The "locks" command allows inspecting the locks held on the repository and
+safely removing locks which are no longer held by a running restic process.
+	`,
+	DisableAutoGenTag: true,
+	GroupID:           cmdGroupDefault,
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdLocks)
+}
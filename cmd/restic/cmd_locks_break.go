@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/audit"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var cmdLocksBreak = &cobra.Command{
+	Use:   "break [flags] [lockID ...]",
+	Short: "Remove locks which are no longer held",
+	Long: `
+The "break" sub-command removes locks after verifying that they are no longer
+held by a running restic process. If no lock ID is given, all locks are checked.
+
+A lock is only removed if one of the following conditions holds:
+
+ * The lock was created on this host and the process holding it no longer exists.
+ * The lock was not refreshed for at least --min-age. Running restic processes
+   refresh their locks every five minutes.
+
+Locks held by a process which is still running on this host are never removed,
+unless --force is specified together with explicit lock IDs.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 12 if the password is incorrect.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runLocksBreak(cmd.Context(), locksBreakOptions, globalOptions, args)
+	},
+}
+
+// LocksBreakOptions collects all options for the locks break command.
+type LocksBreakOptions struct {
+	MinAge time.Duration
+	Force  bool
+	DryRun bool
+}
+
+// minLockBreakAge is twice the interval in which locks are refreshed by
+// running restic processes.
+const minLockBreakAge = 10 * time.Minute
+
+var locksBreakOptions LocksBreakOptions
+
+func (opts *LocksBreakOptions) AddFlags(f *pflag.FlagSet) {
+	f.DurationVar(&opts.MinAge, "min-age", restic.StaleLockTimeout, "remove locks from other hosts which were not refreshed for at least `duration`")
+	f.BoolVar(&opts.Force, "force", false, "remove the specified locks without any safety checks")
+	f.BoolVarP(&opts.DryRun, "dry-run", "n", false, "do not remove any locks, just print what would be done")
+}
+
+func init() {
+	cmdLocks.AddCommand(cmdLocksBreak)
+	locksBreakOptions.AddFlags(cmdLocksBreak.Flags())
+}
+
+// checkLockBreakable returns an error describing why the lock must not be
+// removed, or nil if it is safe to remove it.
+func checkLockBreakable(lock *restic.Lock, minAge time.Duration, now time.Time) error {
+	reachable, alive := lock.HolderReachable()
+	if reachable {
+		if alive {
+			return errors.Errorf("process %d on this host is still running", lock.PID)
+		}
+		return nil
+	}
+
+	age := now.Sub(lock.Time)
+	if age < minAge {
+		return errors.Errorf("lock held by %v on %v was refreshed %v ago, which is less than %v", lock.PID, lock.Hostname, age.Round(time.Second), minAge)
+	}
+	return nil
+}
+
+func runLocksBreak(ctx context.Context, opts LocksBreakOptions, gopts GlobalOptions, args []string) error {
+	if opts.Force && len(args) == 0 {
+		return errors.Fatal("--force requires explicit lock IDs, use `restic unlock --remove-all` to remove all locks")
+	}
+	if opts.MinAge < minLockBreakAge && !opts.Force {
+		return errors.Fatalf("--min-age must be at least %v, as running restic processes refresh their locks every five minutes", minLockBreakAge)
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	var selected restic.IDSet
+	if len(args) > 0 {
+		selected = restic.NewIDSet()
+		for _, arg := range args {
+			id, err := restic.Find(ctx, repo, restic.LockFile, arg)
+			if err != nil {
+				return errors.Fatalf("unable to find lock %q: %v", arg, err)
+			}
+			selected.Insert(id)
+		}
+	}
+
+	now := time.Now()
+	var removed, kept uint
+	var toRemove restic.IDs
+	err = restic.ForAllLocks(ctx, repo, nil, func(id restic.ID, lock *restic.Lock, err error) error {
+		if selected != nil && !selected.Has(id) {
+			return nil
+		}
+		if err != nil {
+			Warningf("unable to load lock %v, skipping: %v\n", id.Str(), err)
+			kept++
+			return nil
+		}
+
+		if !opts.Force {
+			if err := checkLockBreakable(lock, opts.MinAge, now); err != nil {
+				Printf("keeping lock %v: %v\n", id.Str(), err)
+				kept++
+				return nil
+			}
+		}
+
+		toRemove = append(toRemove, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range toRemove {
+		if opts.DryRun {
+			Printf("would remove lock %v\n", id.Str())
+			continue
+		}
+
+		err := repository.RemoveLock(ctx, repo, id)
+		if err != nil {
+			return fmt.Errorf("removing lock %v failed: %w", id.Str(), err)
+		}
+		Verbosef("removed lock %v\n", id.Str())
+		removed++
+		auditEvent(audit.Event{
+			Type:     "lock-removed",
+			Name:     "Lock removed",
+			Severity: 7,
+			Message:  "lock " + id.String(),
+		})
+	}
+
+	if !opts.DryRun {
+		Verbosef("removed %d locks, kept %d locks\n", removed, kept)
+	}
+	if kept > 0 && selected != nil {
+		return errors.Fatalf("%d of the specified locks were not removed", kept)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunLocksList(t testing.TB, gopts GlobalOptions) []lockInfo {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runLocksList(context.TODO(), gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	var locks []lockInfo
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &locks))
+	return locks
+}
+
+func testCreateLock(t testing.TB, gopts GlobalOptions, hostname string, pid int, age time.Duration) {
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+
+	repository.TestSaveLock(t, repo, &restic.Lock{
+		Time:      time.Now().Add(-age),
+		Hostname:  hostname,
+		PID:       pid,
+		Operation: "backup",
+	})
+}
+
+func TestLocksBreak(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+	restic.TestSetLockTimeout(t, 5*time.Millisecond)
+
+	hostname, err := os.Hostname()
+	rtest.OK(t, err)
+
+	testCreateLock(t, env.gopts, hostname, os.Getpid(), time.Hour)
+	testCreateLock(t, env.gopts, hostname, os.Getpid()+500000, time.Minute)
+	testCreateLock(t, env.gopts, "other-"+hostname, 42, time.Minute)
+	testCreateLock(t, env.gopts, "other-"+hostname, 43, time.Hour)
+
+	locks := testRunLocksList(t, env.gopts)
+	rtest.Equals(t, 4, len(locks))
+
+	rtest.OK(t, runLocksBreak(context.TODO(), LocksBreakOptions{MinAge: restic.StaleLockTimeout, DryRun: true}, env.gopts, nil))
+	rtest.Equals(t, 4, len(testRunLocksList(t, env.gopts)))
+
+	rtest.OK(t, runLocksBreak(context.TODO(), LocksBreakOptions{MinAge: restic.StaleLockTimeout}, env.gopts, nil))
+
+	// only the lock of the running process and the recent lock from the other host remain
+	locks = testRunLocksList(t, env.gopts)
+	rtest.Equals(t, 2, len(locks))
+	for _, lock := range locks {
+		rtest.Assert(t, lock.PID == os.Getpid() || lock.PID == 42, "unexpected remaining lock %v", lock)
+	}
+
+	// breaking a specific active lock requires --force
+	err = runLocksBreak(context.TODO(), LocksBreakOptions{MinAge: restic.StaleLockTimeout}, env.gopts, []string{locks[0].ID})
+	rtest.Assert(t, err != nil, "expected error when breaking an active lock")
+	rtest.OK(t, runLocksBreak(context.TODO(), LocksBreakOptions{Force: true}, env.gopts, []string{locks[0].ID}))
+	rtest.Equals(t, 1, len(testRunLocksList(t, env.gopts)))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
+	"github.com/spf13/cobra"
+)
+
+var cmdLocksList = &cobra.Command{
+	Use:   "list",
+	Short: "List locks held on the repository",
+	Long: `
+The "list" sub-command lists all locks held on the repository. For each lock,
+it shows whether the lock is exclusive, the host, user and process which holds
+the lock, the operation the lock was created for and the time since the lock
+was last refreshed. Locks which are considered stale are marked accordingly.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 12 if the password is incorrect.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runLocksList(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdLocks.AddCommand(cmdLocksList)
+}
+
+type lockInfo struct {
+	ID          string    `json:"id"`
+	ShortID     string    `json:"-"`
+	Exclusive   bool      `json:"exclusive"`
+	Hostname    string    `json:"hostname"`
+	Username    string    `json:"username"`
+	PID         int       `json:"pid"`
+	Operation   string    `json:"operation,omitempty"`
+	Time        time.Time `json:"time"`
+	Age         uint64    `json:"age_seconds"`
+	Stale       bool      `json:"stale"`
+	StaleReason string    `json:"stale_reason,omitempty"`
+}
+
+func newLockInfo(id restic.ID, lock *restic.Lock, now time.Time) lockInfo {
+	reason := lock.StaleReason()
+	age := now.Sub(lock.Time)
+	if age < 0 {
+		age = 0
+	}
+	return lockInfo{
+		ID:          id.String(),
+		ShortID:     id.Str(),
+		Exclusive:   lock.Exclusive,
+		Hostname:    lock.Hostname,
+		Username:    lock.Username,
+		PID:         lock.PID,
+		Operation:   lock.Operation,
+		Time:        lock.Time,
+		Age:         uint64(age / time.Second),
+		Stale:       reason != "",
+		StaleReason: reason,
+	}
+}
+
+func runLocksList(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("the locks list command expects no arguments, only options - please see `restic help locks list` for usage and flags")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	locks := []lockInfo{}
+	err = restic.ForAllLocks(ctx, repo, nil, func(id restic.ID, lock *restic.Lock, err error) error {
+		if err != nil {
+			Warnf("unable to load lock %v: %v\n", id.Str(), err)
+			return nil
+		}
+		locks = append(locks, newLockInfo(id, lock, now))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Time.Before(locks[j].Time)
+	})
+
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(locks)
+	}
+
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ShortID }}")
+	tab.AddColumn("Type", "{{if .Exclusive}}exclusive{{else}}shared{{end}}")
+	tab.AddColumn("Operation", "{{ .Operation }}")
+	tab.AddColumn("Host", "{{ .Hostname }}")
+	tab.AddColumn("PID", "{{ .PID }}")
+	tab.AddColumn("User", "{{ .Username }}")
+	tab.AddColumn("Age", "{{ .AgeString }}")
+	tab.AddColumn("Status", "{{if .Stale}}stale: {{ .StaleReason }}{{else}}active{{end}}")
+
+	for _, lock := range locks {
+		tab.AddRow(struct {
+			lockInfo
+			AgeString string
+		}{lock, ui.FormatSeconds(lock.Age)})
+	}
+
+	return tab.Write(globalOptions.stdout)
+}
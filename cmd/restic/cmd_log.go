@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/oplog"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/table"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdLog = &cobra.Command{
+	Use:   "log [flags]",
+	Short: "Show the log of destructive operations",
+	Long: `
+The "log" command shows the operation log stored in the repository. It records
+all destructive operations, that is removing snapshots using "forget", removing
+data using "prune", and adding, removing or changing keys, together with the
+time, host, user and key used.
+
+Each record references its predecessor by the hash of its content, so removing
+or modifying records breaks the chain. This is detected by "log" and "check".
+Removing the newest records can only be detected by comparing the ID of the
+newest record, which is printed at the end, with a copy kept outside of the
+repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error, including a broken operation log.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runLog(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdLog)
+}
+
+// jsonRecord is a record of the operation log with its ID.
+type jsonRecord struct {
+	*oplog.Record
+	ID restic.ID `json:"id"`
+}
+
+func runLog(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the log command expects no arguments, only options - please see `restic help log` for usage and flags")
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	opLog, err := oplog.Load(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		records := make([]jsonRecord, 0, len(opLog.Records))
+		for _, rec := range opLog.Records {
+			records = append(records, jsonRecord{Record: rec, ID: rec.ID()})
+		}
+		err = json.NewEncoder(globalOptions.stdout).Encode(records)
+		if err != nil {
+			return err
+		}
+	} else {
+		printLog(opLog)
+	}
+
+	problems := opLog.Verify()
+	for _, problem := range problems {
+		Warnf("operation log: %v\n", problem)
+	}
+	if len(problems) > 0 {
+		return errors.Fatalf("the operation log is broken, it was modified outside of restic")
+	}
+	return nil
+}
+
+func printLog(opLog *oplog.Log) {
+	if len(opLog.Records) == 0 {
+		Printf("the operation log is empty\n")
+		return
+	}
+
+	tab := table.New()
+	tab.AddColumn("Seq", "{{ .Sequence }}")
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Host", "{{ .Hostname }}")
+	tab.AddColumn("User", "{{ .Username }}")
+	tab.AddColumn("Key", "{{ .Key }}")
+	tab.AddColumn("Operation", "{{ .Operation }}")
+	tab.AddColumn("Details", "{{ .Details }}")
+
+	type row struct {
+		Sequence  uint64
+		Time      string
+		Hostname  string
+		Username  string
+		Key       string
+		Operation string
+		Details   string
+	}
+	for _, rec := range opLog.Records {
+		r := row{
+			Sequence:  rec.Sequence,
+			Time:      rec.Time.Local().Format(TimeFormat),
+			Hostname:  rec.Hostname,
+			Username:  rec.Username,
+			Operation: rec.Operation,
+			Details:   recordDetails(rec),
+		}
+		if rec.KeyID != nil {
+			r.Key = rec.KeyID.Str()
+		}
+		tab.AddRow(r)
+	}
+
+	err := tab.Write(globalOptions.stdout)
+	if err != nil {
+		Warnf("unable to write table: %v\n", err)
+	}
+	Printf("\nnewest record: %v\n", opLog.Head().ID())
+}
+
+// recordDetails summarizes the changes described by rec.
+func recordDetails(rec *oplog.Record) string {
+	var parts []string
+	if len(rec.Snapshots) > 0 {
+		ids := make([]string, 0, len(rec.Snapshots))
+		for _, id := range rec.Snapshots {
+			ids = append(ids, id.Str())
+		}
+		parts = append(parts, fmt.Sprintf("removed %d snapshots: %v", len(ids), strings.Join(ids, " ")))
+	}
+	if rec.Key != nil {
+		parts = append(parts, "key "+rec.Key.Str())
+	}
+	if rec.Details != "" {
+		parts = append(parts, rec.Details)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/oplog"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunLog(t testing.TB, gopts GlobalOptions) ([]jsonRecord, error) {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runLog(context.TODO(), gopts, nil)
+	})
+	var records []jsonRecord
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &records))
+	return records, err
+}
+
+func TestOperationLog(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshots := testListSnapshots(t, env.gopts, 2)
+
+	records, err := testRunLog(t, env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(records))
+
+	testRunForget(t, env.gopts, ForgetOptions{Last: 1})
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0"})
+
+	records, err = testRunLog(t, env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(records))
+	rtest.Equals(t, oplog.OpForget, records[0].Operation)
+	rtest.Equals(t, 1, len(records[0].Snapshots))
+	rtest.Assert(t, records[0].Snapshots[0] == snapshots[0] || records[0].Snapshots[0] == snapshots[1],
+		"unexpected snapshot %v in record", records[0].Snapshots[0])
+	rtest.Equals(t, oplog.OpPrune, records[1].Operation)
+	rtest.Equals(t, records[0].ID, *records[1].Previous)
+	testRunCheck(t, env.gopts)
+
+	// removing a record must be detected
+	rtest.OK(t, os.Remove(filepath.Join(env.repo, "oplog", records[0].ID.String())))
+	_, err = testRunLog(t, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for broken operation log")
+	_, err = testRunCheckOutput(env.gopts, false)
+	rtest.Assert(t, err != nil, "expected check to detect the broken operation log")
+}
+
+func TestOperationLogRewrite(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	original := createBasicRewriteRepo(t, env)
+
+	testRunRewriteExclude(t, env.gopts, []string{"0"}, true, snapshotMetadataArgs{})
+	records, err := testRunLog(t, env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(records))
+	rtest.Equals(t, oplog.OpRewrite, records[0].Operation)
+	rtest.Equals(t, original, records[0].Snapshots[0])
+	rtest.Equals(t, 1, len(records[0].Trees))
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
 	"github.com/restic/restic/internal/walker"
 )
 
@@ -38,11 +39,17 @@ will be listed. If the --recursive flag is used, then the filter
 will allow traversing into matching directories' subfolders.
 Any directory paths specified must be absolute (starting with
 a path separator); paths use the forward slash '/' as separator.
+Only the trees of the listed directories and the directories
+leading up to them are loaded from the repository.
 
 File listings can be sorted by specifying --sort followed by one of the
 sort specifiers '(name|size|time=mtime|atime|ctime|extension)'.
 The sorting can be reversed by specifying --reverse.
 
+With --format csv, the listing is printed as comma-separated values with a
+header row, which includes size, timestamps, owner and file attributes of
+each item. Use "restic export-catalog" to export several snapshots at once.
+
 EXIT STATUS
 ===========
 
@@ -66,6 +73,7 @@ type LsOptions struct {
 	Recursive     bool
 	HumanReadable bool
 	Ncdu          bool
+	Format        string
 	Sort          SortMode
 	Reverse       bool
 }
@@ -81,6 +89,7 @@ func init() {
 	flags.BoolVar(&lsOptions.Recursive, "recursive", false, "include files in subfolders of the listed directories")
 	flags.BoolVar(&lsOptions.HumanReadable, "human-readable", false, "print sizes in human readable format")
 	flags.BoolVar(&lsOptions.Ncdu, "ncdu", false, "output NCDU export format (pipe into 'ncdu -f -')")
+	flags.StringVar(&lsOptions.Format, "format", "text", "output `format` (text|csv)")
 	flags.VarP(&lsOptions.Sort, "sort", "s", "sort output by (name|size|time=mtime|atime|ctime|extension)")
 	flags.BoolVar(&lsOptions.Reverse, "reverse", false, "reverse sorted output")
 }
@@ -93,7 +102,8 @@ type lsPrinter interface {
 }
 
 type jsonLsPrinter struct {
-	enc *json.Encoder
+	enc   *json.Encoder
+	links *linkTracker
 }
 
 func (p *jsonLsPrinter) Snapshot(sn *restic.Snapshot) error {
@@ -119,10 +129,10 @@ func (p *jsonLsPrinter) Node(path string, node *restic.Node, isPrefixDirectory b
 	if isPrefixDirectory {
 		return nil
 	}
-	return lsNodeJSON(p.enc, path, node)
+	return lsNodeJSON(p.enc, path, node, p.links.kind(path, node))
 }
 
-func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
+func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node, kind linkKind) error {
 	n := &struct {
 		Name        string      `json:"name"`
 		Type        string      `json:"type"`
@@ -136,6 +146,7 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 		AccessTime  time.Time   `json:"atime,omitempty"`
 		ChangeTime  time.Time   `json:"ctime,omitempty"`
 		Inode       uint64      `json:"inode,omitempty"`
+		LinkKind    linkKind    `json:"link_kind,omitempty"`
 		MessageType string      `json:"message_type"` // "node"
 		StructType  string      `json:"struct_type"`  // "node", deprecated
 
@@ -161,6 +172,10 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 	if node.Type == restic.NodeTypeFile {
 		n.Size = &n.size
 	}
+	// the type already identifies plain symlinks
+	if kind == linkKindJunction || kind == linkKindMountPoint {
+		n.LinkKind = kind
+	}
 
 	return enc.Encode(n)
 }
@@ -264,10 +279,32 @@ func (p *ncduLsPrinter) Close() error {
 	return err
 }
 
+// csvLsPrinter prints the listing in the CSV format of "export-catalog".
+type csvLsPrinter struct {
+	w  *csvCatalogWriter
+	sn *restic.Snapshot
+}
+
+func (p *csvLsPrinter) Snapshot(sn *restic.Snapshot) error {
+	p.sn = sn
+	return p.w.Snapshot(sn)
+}
+
+func (p *csvLsPrinter) Node(path string, node *restic.Node, isPrefixDirectory bool) error {
+	if isPrefixDirectory {
+		return nil
+	}
+	return p.w.Node(p.sn, path, node)
+}
+
+func (p *csvLsPrinter) LeaveDir(_ string) error { return nil }
+func (p *csvLsPrinter) Close() error            { return p.w.Close() }
+
 type textLsPrinter struct {
 	dirs          []string
 	ListLong      bool
 	HumanReadable bool
+	links         *linkTracker
 }
 
 func (p *textLsPrinter) Snapshot(sn *restic.Snapshot) error {
@@ -276,7 +313,11 @@ func (p *textLsPrinter) Snapshot(sn *restic.Snapshot) error {
 }
 func (p *textLsPrinter) Node(path string, node *restic.Node, isPrefixDirectory bool) error {
 	if !isPrefixDirectory {
-		Printf("%s\n", formatNode(path, node, p.ListLong, p.HumanReadable))
+		line := formatNode(path, node, p.ListLong, p.HumanReadable)
+		if kind := p.links.kind(path, node); p.ListLong && (kind == linkKindJunction || kind == linkKindMountPoint) {
+			line += fmt.Sprintf(" [%s]", strings.ReplaceAll(string(kind), "-", " "))
+		}
+		Printf("%s\n", line)
 	}
 	return nil
 }
@@ -307,6 +348,15 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 	if opts.Reverse && opts.Ncdu {
 		return errors.Fatal("--reverse and --ncdu are mutually exclusive")
 	}
+	switch opts.Format {
+	case "", "text":
+	case "csv":
+		if gopts.JSON || opts.Ncdu {
+			return errors.Fatal("--format csv cannot be combined with '--json' or '--ncdu'")
+		}
+	default:
+		return errors.Fatalf("invalid format %q, must be text or csv", opts.Format)
+	}
 
 	// extract any specific directories to walk
 	var dirs []string
@@ -364,26 +414,34 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 		return err
 	}
 
-	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
-	if err = repo.LoadIndex(ctx, bar); err != nil {
-		return err
-	}
+	// ls only reads trees, thus only load the corresponding index entries
+	// once the first tree is requested
+	repo.LoadIndexLazy(func() *progress.Counter {
+		return newIndexProgress(gopts.Quiet, gopts.JSON)
+	})
 
 	var printer lsPrinter
+	links := newLinkTracker()
 
 	if gopts.JSON {
 		printer = &jsonLsPrinter{
-			enc: json.NewEncoder(globalOptions.stdout),
+			enc:   json.NewEncoder(globalOptions.stdout),
+			links: links,
 		}
 	} else if opts.Ncdu {
 		printer = &ncduLsPrinter{
 			out: globalOptions.stdout,
 		}
+	} else if opts.Format == "csv" {
+		printer = &csvLsPrinter{
+			w: newCSVCatalogWriter(globalOptions.stdout),
+		}
 	} else {
 		printer = &textLsPrinter{
 			dirs:          dirs,
 			ListLong:      opts.ListLong,
 			HumanReadable: opts.HumanReadable,
+			links:         links,
 		}
 	}
 	if opts.Sort != SortModeName || opts.Reverse {
@@ -419,6 +477,7 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 		if node == nil {
 			return nil
 		}
+		links.enter(nodepath, node)
 
 		printedDir := false
 		if withinDir(nodepath) {
@@ -461,6 +520,10 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 
 	err = walker.Walk(ctx, repo, *sn.Tree, walker.WalkVisitor{
 		ProcessNode: processNode,
+		// only load the trees of directories which processNode descends into
+		SkipTree: func(nodepath string, _ *restic.Node) bool {
+			return !(withinDir(nodepath) && opts.Recursive) && !approachingMatchingTree(nodepath)
+		},
 		LeaveDir: func(path string) error {
 			// the root path `/` has no corresponding node and is thus also skipped by processNode
 			if path != "/" {
@@ -96,7 +96,7 @@ func TestLsNodeJSON(t *testing.T) {
 		c := lsTestNodes[i]
 		buf := new(bytes.Buffer)
 		enc := json.NewEncoder(buf)
-		err := lsNodeJSON(enc, c.path, &c.Node)
+		err := lsNodeJSON(enc, c.path, &c.Node, linkKindNone)
 		rtest.OK(t, err)
 		rtest.Equals(t, expect+"\n", buf.String())
 
@@ -168,3 +168,30 @@ func TestLsNcdu(t *testing.T) {
 ]
 `, buf.String())
 }
+
+func TestLsCSV(t *testing.T) {
+	var buf bytes.Buffer
+	printer := &csvLsPrinter{w: newCSVCatalogWriter(&buf)}
+
+	rtest.OK(t, printer.Snapshot(&restic.Snapshot{Hostname: "host"}))
+	rtest.OK(t, printer.Node("/some", &restic.Node{Name: "some", Type: restic.NodeTypeDir}, true))
+	for _, c := range lsTestNodes[:4] {
+		rtest.OK(t, printer.Node(c.path, &c.Node, false))
+	}
+	rtest.OK(t, printer.Node("/hidden", &restic.Node{
+		Name: "hidden",
+		Type: restic.NodeTypeFile,
+		GenericAttributes: map[restic.GenericAttributeType]json.RawMessage{
+			restic.TypeFileAttributes: json.RawMessage("34"),
+		},
+	}, false))
+	rtest.OK(t, printer.Close())
+
+	rtest.Equals(t, `snapshot,path,type,size,mode,uid,gid,user,group,mtime,atime,ctime,inode,links,attributes
+,/bar/baz,file,12345,----------,10000000,20000000,nobody,nobodies,,,,,1,
+,/foo/empty,file,0,----------,1001,1001,not printed,not printed,,,,,3840,
+,/foo/link,symlink,,Lrwxrwxrwx,0,0,,,,,,,,
+,/some/directory,dir,,drwxr-xr-x,0,0,,,2020-01-02T03:04:05Z,2021-02-03T04:05:06.000000007Z,2022-03-04T05:06:07.000000008Z,,,
+,/hidden,file,0,----------,0,0,,,,,,,,"hidden,archive"
+`, buf.String())
+}
@@ -2,8 +2,14 @@ package main
 
 import (
 	"context"
+	"os"
+	"time"
 
+	"github.com/restic/restic/internal/approval"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/migrations"
+	"github.com/restic/restic/internal/oplog"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui/progress"
 	"github.com/restic/restic/internal/ui/termstatus"
@@ -19,6 +25,14 @@ The "migrate" command checks which migrations can be applied for a repository
 and prints a list with available migration names. If one or more migration
 names are specified, these migrations are applied.
 
+The "rechunk" migration splits the files of all snapshots again using the
+chunker parameters from the profile passed to "--chunker-profile", which is
+written by "restic chunker export". Each snapshot is replaced once its files
+are rechunked. If the migration is interrupted or stopped by "--max-duration",
+running it again without "--chunker-profile" continues with the remaining
+snapshots. Use "--limit-download" and "--limit-upload" to limit the bandwidth
+and run "restic prune" afterwards to remove the old data.
+
 EXIT STATUS
 ===========
 
@@ -39,7 +53,9 @@ Exit status is 12 if the password is incorrect.
 
 // MigrateOptions bundles all options for the 'check' command.
 type MigrateOptions struct {
-	Force bool
+	Force          bool
+	ChunkerProfile string
+	MaxDuration    time.Duration
 }
 
 var migrateOptions MigrateOptions
@@ -48,6 +64,8 @@ func init() {
 	cmdRoot.AddCommand(cmdMigrate)
 	f := cmdMigrate.Flags()
 	f.BoolVarP(&migrateOptions.Force, "force", "f", false, `apply a migration a second time`)
+	f.StringVar(&migrateOptions.ChunkerProfile, "chunker-profile", "", "rechunk: use the chunker parameters from the profile in `file` written by 'restic chunker export'")
+	f.DurationVar(&migrateOptions.MaxDuration, "max-duration", 0, "rechunk: stop after the current snapshot once `duration` has elapsed, run the migration again to continue (default: no limit)")
 }
 
 func checkMigrations(ctx context.Context, repo restic.Repository, printer progress.Printer) error {
@@ -73,13 +91,66 @@ func checkMigrations(ctx context.Context, repo restic.Repository, printer progre
 	return nil
 }
 
-func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptions, repo restic.Repository, args []string, term *termstatus.Terminal, printer progress.Printer) error {
+// configureRechunk passes the options for the rechunk migration to m.
+func configureRechunk(m *migrations.Rechunk, opts MigrateOptions, gopts GlobalOptions, printer progress.Printer) error {
+	if opts.ChunkerProfile != "" {
+		buf, err := os.ReadFile(opts.ChunkerProfile)
+		if err != nil {
+			return errors.Fatalf("unable to read chunker profile: %v", err)
+		}
+		profile, err := restic.ParseChunkerProfile(buf)
+		if err != nil {
+			return errors.Fatalf("invalid chunker profile %v: %v", opts.ChunkerProfile, err)
+		}
+		m.Profile = &profile
+	}
+
+	signingKey, err := loadSigningKey(gopts.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+	m.UpdateSnapshot = func(sn *restic.Snapshot) error {
+		return updateSnapshotSignature(sn, signingKey)
+	}
+	m.MaxDuration = opts.MaxDuration
+	m.Progress = func(sn *restic.Snapshot, index, total int) {
+		printer.P("rechunking snapshot %v from %v (%d/%d)\n", sn.ID().Str(), sn.Time.Format(TimeFormat), index+1, total)
+	}
+	return nil
+}
+
+// approveRechunk enforces the approval policy for the rechunk migration, which
+// replaces all snapshots, and records the removal of the original snapshots
+// in the operation log.
+func approveRechunk(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, m *migrations.Rechunk) (*approval.Request, error) {
+	approved, err := requireApproval(ctx, repo, gopts, &approval.Request{Operation: approval.OpRechunk})
+	if err != nil {
+		return nil, err
+	}
+	m.Removed = func(ctx context.Context, id, tree restic.ID) error {
+		return recordOperation(ctx, repo, &oplog.Record{
+			Operation: oplog.OpRechunk,
+			Snapshots: restic.IDs{id},
+			Trees:     restic.IDs{tree},
+			Approval:  approvalID(approved),
+		})
+	}
+	return approved, nil
+}
+
+func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptions, repo *repository.Repository, args []string, term *termstatus.Terminal, printer progress.Printer) error {
 	var firsterr error
 	for _, name := range args {
 		found := false
 		for _, m := range migrations.All {
 			if m.Name() == name {
 				found = true
+				if rechunk, ok := m.(*migrations.Rechunk); ok {
+					if err := configureRechunk(rechunk, opts, gopts, printer); err != nil {
+						return err
+					}
+				}
+
 				ok, reason, err := m.Check(ctx, repo)
 				if err != nil {
 					return err
@@ -111,8 +182,22 @@ func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptio
 					}
 				}
 
+				var approved *approval.Request
+				if rechunk, ok := m.(*migrations.Rechunk); ok {
+					approved, err = approveRechunk(ctx, repo, gopts, rechunk)
+					if err != nil {
+						return err
+					}
+				}
+
 				printer.P("applying migration %v...\n", m.Name())
-				if err = m.Apply(ctx, repo); err != nil {
+				err = m.Apply(ctx, repo)
+				if errors.Is(err, migrations.ErrIncomplete) {
+					// the approval remains valid to continue the migration
+					printer.P("migration %v: %v\n", m.Name(), err)
+					continue
+				}
+				if err != nil {
 					printer.E("migration %v failed: %v\n", m.Name(), err)
 					if firsterr == nil {
 						firsterr = err
@@ -120,6 +205,9 @@ func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptio
 					continue
 				}
 
+				if err := consumeApproval(ctx, repo, approved); err != nil {
+					return err
+				}
 				printer.P("migration %v: success\n", m.Name())
 			}
 		}
@@ -14,6 +14,7 @@ import (
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 
 	"github.com/restic/restic/internal/fuse"
 
@@ -60,6 +61,36 @@ The default path templates are:
     "hosts/%h/%T"
     "tags/%t/%T"
 
+Subtrees
+========
+
+To browse a single directory of large snapshots, pass its path within the
+snapshots via --subtree, for example "--subtree /home/user/work". Each snapshot
+directory then only contains the content of this directory, which is empty if
+a snapshot does not contain it. Only the trees along the path are loaded from
+the repository, instead of all trees of a snapshot.
+
+Read-Ahead
+==========
+
+With --read-ahead, restic prefetches the given amount of data following the
+current read position in the background when a file is read sequentially, for
+example "--read-ahead 8M". The read-ahead is disabled by default, as it
+downloads data which may never be read. The data is fetched from up to
+--read-ahead-workers pack files in parallel, which defaults to the number of
+backend connections.
+
+Caching
+=======
+
+The contents of snapshots never change. The kernel caches the attributes of
+files and directories for --attr-timeout and the directory entries for
+--entry-timeout, higher values avoid repeated requests, for example when
+running "find" or "du" on the mount. In addition, restic keeps the entries of
+the --dir-cache most recently used directories in memory, such that
+directories which the kernel forgot or which are part of several snapshots
+are not loaded from the repository again.
+
 EXIT STATUS
 ===========
 
@@ -82,8 +113,14 @@ type MountOptions struct {
 	AllowOther           bool
 	NoDefaultPermissions bool
 	restic.SnapshotFilter
-	TimeTemplate  string
-	PathTemplates []string
+	TimeTemplate     string
+	PathTemplates    []string
+	ReadAhead        string
+	ReadAheadWorkers int
+	Subtree          string
+	AttrTimeout      time.Duration
+	EntryTimeout     time.Duration
+	DirCache         int
 }
 
 var mountOptions MountOptions
@@ -102,6 +139,13 @@ func init() {
 	mountFlags.StringVar(&mountOptions.TimeTemplate, "snapshot-template", time.RFC3339, "set `template` to use for snapshot dirs")
 	mountFlags.StringVar(&mountOptions.TimeTemplate, "time-template", time.RFC3339, "set `template` to use for times")
 	_ = mountFlags.MarkDeprecated("snapshot-template", "use --time-template")
+
+	mountFlags.StringVar(&mountOptions.ReadAhead, "read-ahead", "0", "prefetch `size` bytes when reading files sequentially, 0 disables the read-ahead (allowed suffixes: k/K, m/M, g/G, t/T)")
+	mountFlags.IntVar(&mountOptions.ReadAheadWorkers, "read-ahead-workers", 0, "prefetch up to `n` pack files in parallel (default: number of backend connections)")
+	mountFlags.StringVar(&mountOptions.Subtree, "subtree", "", "only show the directory `path` within each snapshot")
+	mountFlags.DurationVar(&mountOptions.AttrTimeout, "attr-timeout", time.Minute, "let the kernel cache file attributes for `duration`")
+	mountFlags.DurationVar(&mountOptions.EntryTimeout, "entry-timeout", time.Minute, "let the kernel cache directory entries for `duration`")
+	mountFlags.IntVar(&mountOptions.DirCache, "dir-cache", 4096, "keep the entries of up to `n` directories in memory, 0 disables the cache")
 }
 
 func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args []string) error {
@@ -117,6 +161,27 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		return errors.Fatal("wrong number of parameters")
 	}
 
+	var readAhead int64
+	if opts.ReadAhead != "" {
+		var err error
+		readAhead, err = ui.ParseBytes(opts.ReadAhead)
+		if err != nil || readAhead < 0 {
+			return errors.Fatalf("invalid value for --read-ahead: %q", opts.ReadAhead)
+		}
+	}
+	if opts.AttrTimeout < 0 || opts.EntryTimeout < 0 {
+		return errors.Fatal("--attr-timeout and --entry-timeout must not be negative")
+	}
+	if opts.DirCache < 0 {
+		return errors.Fatal("--dir-cache must not be negative")
+	}
+	if opts.ReadAheadWorkers < 0 {
+		return errors.Fatal("--read-ahead-workers must not be negative")
+	}
+	if opts.Subtree != "" && !strings.HasPrefix(opts.Subtree, "/") {
+		return errors.Fatal("--subtree must be an absolute path, starting with a forward slash '/'")
+	}
+
 	mountpoint := args[0]
 
 	// Check the existence of the mount point at the earliest stage to
@@ -166,12 +231,18 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 	}
 
 	cfg := fuse.Config{
-		OwnerIsRoot:   opts.OwnerRoot,
-		Filter:        opts.SnapshotFilter,
-		TimeTemplate:  opts.TimeTemplate,
-		PathTemplates: opts.PathTemplates,
+		OwnerIsRoot:      opts.OwnerRoot,
+		Filter:           opts.SnapshotFilter,
+		TimeTemplate:     opts.TimeTemplate,
+		PathTemplates:    opts.PathTemplates,
+		ReadAhead:        uint64(readAhead),
+		ReadAheadWorkers: opts.ReadAheadWorkers,
+		Subtree:          opts.Subtree,
+		AttrTimeout:      opts.AttrTimeout,
+		EntryTimeout:     opts.EntryTimeout,
+		DirCacheSize:     opts.DirCache,
 	}
-	root := fuse.NewRoot(repo, cfg)
+	root := fuse.NewRoot(ctx, repo, cfg)
 
 	Printf("Now serving the repository at %s\n", mountpoint)
 	Printf("Use another terminal or tool to browse the contents of this folder.\n")
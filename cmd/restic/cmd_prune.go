@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"runtime"
 	"strconv"
 	"strings"
 
+	"github.com/restic/restic/internal/audit"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/oplog"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
@@ -59,6 +62,12 @@ type PruneOptions struct {
 	RepackCacheableOnly bool
 	RepackSmall         bool
 	RepackUncompressed  bool
+
+	ReportAge bool
+
+	// snapshots are the snapshots remaining in the repository if they were
+	// already loaded by forget, nil otherwise
+	snapshots restic.Snapshots
 }
 
 var pruneOptions PruneOptions
@@ -68,6 +77,7 @@ func init() {
 	f := cmdPrune.Flags()
 	f.BoolVarP(&pruneOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
 	f.StringVarP(&pruneOptions.UnsafeNoSpaceRecovery, "unsafe-recover-no-free-space", "", "", "UNSAFE, READ THE DOCUMENTATION BEFORE USING! Try to recover a repository stuck with no free space. Do not use without trying out 'prune --max-repack-size 0' first.")
+	f.BoolVar(&pruneOptions.ReportAge, "report-age", false, "report how long the unused data has been unused, per forget operation (requires --dry-run)")
 	addPruneOptions(cmdPrune, &pruneOptions)
 }
 
@@ -153,6 +163,10 @@ func runPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, term
 		return errors.Fatal("--no-lock is only applicable in combination with --dry-run for prune command")
 	}
 
+	if opts.ReportAge && !opts.DryRun {
+		return errors.Fatal("--report-age requires --dry-run")
+	}
+
 	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, opts.DryRun && gopts.NoLock)
 	if err != nil {
 		return err
@@ -171,15 +185,24 @@ func runPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, term
 }
 
 func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo *repository.Repository, ignoreSnapshots restic.IDSet, term *termstatus.Terminal) error {
+	events := newJSONEvents(gopts, term, "prune")
 	if repo.Cache() == nil {
-		Print("warning: running prune without a cache, this may be very slow!\n")
+		if events != nil {
+			events.Warning("", "running prune without a cache, this may be very slow")
+		} else {
+			Print("warning: running prune without a cache, this may be very slow!\n")
+		}
 	}
 
 	printer := newTerminalProgressPrinter(gopts.verbosity, term)
+	if events != nil {
+		printer = events
+	}
 
 	printer.P("loading indexes...\n")
+	events.Phase("load index")
 	// loading the index before the snapshots is ok, as we use an exclusive lock here
-	bar := newIndexTerminalProgress(gopts.Quiet, gopts.JSON, term)
+	bar := newIndexEventsProgress(gopts, events, term)
 	err := repo.LoadIndex(ctx, bar)
 	if err != nil {
 		return err
@@ -197,8 +220,11 @@ func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts GlobalOption
 		RepackUncompressed:  opts.RepackUncompressed,
 	}
 
+	events.Phase("plan")
+	var used restic.FindBlobSet
 	plan, err := repository.PlanPrune(ctx, popts, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
-		return getUsedBlobs(ctx, repo, usedBlobs, ignoreSnapshots, printer)
+		used = usedBlobs
+		return getUsedBlobs(ctx, repo, usedBlobs, ignoreSnapshots, opts.snapshots, printer)
 	}, printer)
 	if err != nil {
 		return err
@@ -216,10 +242,96 @@ func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts GlobalOption
 		return err
 	}
 
+	if opts.ReportAge {
+		err = printGarbageAge(ctx, repo, used, printer)
+		if err != nil {
+			return err
+		}
+	}
+
+	if capacity := repoCapacity(ctx, repo); capacity != nil && !opts.unsafeRecovery {
+		stats := plan.Stats()
+		// repacking writes the used blobs before the old packs are removed,
+		// unreferenced packs are removed first
+		needed := stats.Size.Repack - stats.Size.Repackrm
+		if free := capacity.Free + stats.Size.Unref; free < needed {
+			msg := fmt.Sprintf("repacking writes %v, but only %v are free in the repository storage, use --max-repack-size to repack less data", ui.FormatBytes(needed), ui.FormatBytes(free))
+			if !popts.DryRun {
+				return errors.Fatal(msg)
+			}
+			printer.E("warning: %s\n", msg)
+		}
+	}
+
 	// Trigger GC to reset garbage collection threshold
 	runtime.GC()
 
-	return plan.Execute(ctx, printer)
+	if !popts.DryRun {
+		events.Phase("execute")
+	}
+	err = plan.Execute(ctx, printer)
+	if err != nil {
+		return err
+	}
+	if !popts.DryRun {
+		stats := plan.Stats()
+		auditEvent(audit.Event{
+			Type:     "prune-executed",
+			Name:     "Prune executed",
+			Severity: 6,
+			Count:    int(stats.Blobs.Remove + stats.Blobs.Repackrm),
+			Message:  "removed " + ui.FormatBytes(stats.Size.Remove+stats.Size.Repackrm+stats.Size.Unref),
+		})
+
+		err = recordOperation(ctx, repo, &oplog.Record{
+			Operation: oplog.OpPrune,
+			Details: fmt.Sprintf("removed %d blobs and %d packs, repacked %d blobs, freed %v",
+				stats.Blobs.Remove+stats.Blobs.Repackrm, stats.Packs.Remove+stats.Packs.Unref, stats.Blobs.Repack,
+				ui.FormatBytes(stats.Size.Remove+stats.Size.Repackrm+stats.Size.Unref)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	events.Summary(newPruneSummary(plan.Stats(), popts.DryRun))
+	return nil
+}
+
+// pruneSummary is the summary reported by --json-events.
+type pruneSummary struct {
+	DryRun            bool   `json:"dry_run,omitempty"`
+	BlobsUsed         uint   `json:"blobs_used"`
+	BlobsDuplicate    uint   `json:"blobs_duplicate"`
+	BlobsUnused       uint   `json:"blobs_unused"`
+	BlobsRepacked     uint   `json:"blobs_repacked"`
+	BlobsRemoved      uint   `json:"blobs_removed"`
+	BytesUsed         uint64 `json:"bytes_used"`
+	BytesUnused       uint64 `json:"bytes_unused"`
+	BytesRepacked     uint64 `json:"bytes_repacked"`
+	BytesRemoved      uint64 `json:"bytes_removed"`
+	PacksKept         uint   `json:"packs_kept"`
+	PacksRepacked     uint   `json:"packs_repacked"`
+	PacksRemoved      uint   `json:"packs_removed"`
+	PacksUnreferenced uint   `json:"packs_unreferenced"`
+}
+
+func newPruneSummary(stats repository.PruneStats, dryRun bool) pruneSummary {
+	return pruneSummary{
+		DryRun:            dryRun,
+		BlobsUsed:         stats.Blobs.Used,
+		BlobsDuplicate:    stats.Blobs.Duplicate,
+		BlobsUnused:       stats.Blobs.Unused,
+		BlobsRepacked:     stats.Blobs.Repack,
+		BlobsRemoved:      stats.Blobs.Remove + stats.Blobs.Repackrm,
+		BytesUsed:         stats.Size.Used,
+		BytesUnused:       stats.Size.Duplicate + stats.Size.Unused + stats.Size.Unref,
+		BytesRepacked:     stats.Size.Repack,
+		BytesRemoved:      stats.Size.Remove + stats.Size.Repackrm + stats.Size.Unref,
+		PacksKept:         stats.Packs.Keep,
+		PacksRepacked:     stats.Packs.Repack,
+		PacksRemoved:      stats.Packs.Remove,
+		PacksUnreferenced: stats.Packs.Unref,
+	}
 }
 
 // printPruneStats prints out the statistics
@@ -264,21 +376,30 @@ func printPruneStats(printer progress.Printer, stats repository.PruneStats) erro
 	return nil
 }
 
-func getUsedBlobs(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet, ignoreSnapshots restic.IDSet, printer progress.Printer) error {
+func getUsedBlobs(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet, ignoreSnapshots restic.IDSet, snapshots restic.Snapshots, printer progress.Printer) error {
 	var snapshotTrees restic.IDs
-	printer.P("loading all snapshots...\n")
-	err := restic.ForAllSnapshots(ctx, repo, repo, ignoreSnapshots,
-		func(id restic.ID, sn *restic.Snapshot, err error) error {
-			if err != nil {
-				debug.Log("failed to load snapshot %v (error %v)", id, err)
-				return err
+	if snapshots != nil {
+		// reuse the snapshots loaded by forget
+		for _, sn := range snapshots {
+			if !ignoreSnapshots.Has(*sn.ID()) {
+				snapshotTrees = append(snapshotTrees, sn.TreeIDs()...)
 			}
-			debug.Log("add snapshot %v (tree %v)", id, *sn.Tree)
-			snapshotTrees = append(snapshotTrees, *sn.Tree)
-			return nil
-		})
-	if err != nil {
-		return errors.Fatalf("failed loading snapshot: %v", err)
+		}
+	} else {
+		printer.P("loading all snapshots...\n")
+		err := restic.ForAllSnapshots(ctx, repo, repo, ignoreSnapshots,
+			func(id restic.ID, sn *restic.Snapshot, err error) error {
+				if err != nil {
+					debug.Log("failed to load snapshot %v (error %v)", id, err)
+					return err
+				}
+				debug.Log("add snapshot %v (tree %v)", id, *sn.Tree)
+				snapshotTrees = append(snapshotTrees, sn.TreeIDs()...)
+				return nil
+			})
+		if err != nil {
+			return errors.Fatalf("failed loading snapshot: %v", err)
+		}
 	}
 
 	printer.P("finding data that is still in use for %d snapshots\n", len(snapshotTrees))
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/oplog"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// garbageAge is the unused data which became unused at a certain time.
+type garbageAge struct {
+	// Time is the time of the operation which removed the snapshots, it is
+	// zero if the data cannot be attributed to an operation.
+	Time      time.Time
+	Operation string
+	Snapshots int
+	Blobs     uint
+	Size      uint64
+}
+
+// findGarbageAge attributes the unused blobs to the operations in the
+// operation log which made them unused. A blob becomes unused when the last
+// snapshot referencing it is removed, therefore the log is processed starting
+// with the newest record and each blob is attributed to the first record
+// which references it. The ages are returned newest first, followed by the
+// unused data which is not referenced by any recorded snapshot.
+func findGarbageAge(ctx context.Context, repo restic.Repository, used restic.FindBlobSet, log *oplog.Log) ([]garbageAge, error) {
+	unused := make(map[restic.BlobHandle]uint64)
+	err := repo.ListBlobs(ctx, func(pb restic.PackedBlob) {
+		if !used.Has(pb.BlobHandle) {
+			unused[pb.BlobHandle] += uint64(pb.Length)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ages []garbageAge
+	// take removes bh from the unused blobs and adds it to age
+	take := func(age *garbageAge, bh restic.BlobHandle) bool {
+		size, ok := unused[bh]
+		if !ok {
+			return false
+		}
+		delete(unused, bh)
+		age.Blobs++
+		age.Size += size
+		return true
+	}
+
+	for i := len(log.Records) - 1; i >= 0; i-- {
+		rec := log.Records[i]
+		if len(rec.Trees) == 0 {
+			continue
+		}
+
+		age := garbageAge{Time: rec.Time, Operation: rec.Operation, Snapshots: len(rec.Snapshots)}
+		queue := append(restic.IDs(nil), rec.Trees...)
+		for len(queue) > 0 {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			id := queue[0]
+			queue = queue[1:]
+
+			// trees which are still used, already attributed or removed
+			// do not contain any unused blobs to attribute
+			if !take(&age, restic.BlobHandle{ID: id, Type: restic.TreeBlob}) {
+				continue
+			}
+			tree, err := restic.LoadTree(ctx, repo, id)
+			if err != nil {
+				return nil, err
+			}
+			for _, node := range tree.Nodes {
+				for _, blob := range node.DataBlobs() {
+					take(&age, restic.BlobHandle{ID: blob, Type: restic.DataBlob})
+				}
+				if node.Subtree != nil {
+					queue = append(queue, *node.Subtree)
+				}
+			}
+		}
+
+		if age.Blobs > 0 {
+			ages = append(ages, age)
+		}
+	}
+
+	var unknown garbageAge
+	for _, size := range unused {
+		unknown.Blobs++
+		unknown.Size += size
+	}
+	if unknown.Blobs > 0 {
+		ages = append(ages, unknown)
+	}
+	return ages, nil
+}
+
+// formatAge formats the duration d in days, hours or minutes.
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+}
+
+// printGarbageAge prints how long the unused data in the repository has been
+// unused.
+func printGarbageAge(ctx context.Context, repo restic.Repository, used restic.FindBlobSet, printer progress.Printer) error {
+	log, err := oplog.Load(ctx, repo)
+	if err != nil {
+		return err
+	}
+	ages, err := findGarbageAge(ctx, repo, used, log)
+	if err != nil {
+		return err
+	}
+
+	printer.P("unused data by the time it became unused:\n")
+	if len(ages) == 0 {
+		printer.P("  none\n\n")
+		return nil
+	}
+	now := time.Now()
+	for _, age := range ages {
+		what := "unknown, not referenced by a recorded snapshot removal"
+		if !age.Time.IsZero() {
+			what = fmt.Sprintf("%v (%v ago), %v of %d snapshots", age.Time.Format(TimeFormat), formatAge(now.Sub(age.Time)), age.Operation, age.Snapshots)
+		}
+		printer.P("  %-62s %10d blobs / %s\n", what, age.Blobs, ui.FormatBytes(age.Size))
+	}
+	printer.P("\n")
+	return nil
+}
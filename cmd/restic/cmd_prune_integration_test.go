@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/backend"
@@ -237,3 +239,35 @@ func testEdgeCaseRepo(t *testing.T, tarfile string, optionsCheck CheckOptions, o
 			"prune should have reported an error")
 	}
 }
+
+func TestPruneReportAge(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	firstSnapshot := testListSnapshots(t, env.gopts, 1)[0]
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, BackupOptions{}, env.gopts)
+	testRunForget(t, env.gopts, ForgetOptions{}, firstSnapshot.String())
+
+	// prune loads the index before the snapshots
+	env.gopts.backendTestHook = func(r backend.Backend) (backend.Backend, error) { return newListOnceBackend(r), nil }
+
+	opts := PruneOptions{MaxUnused: "5%", DryRun: true, ReportAge: true}
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.stdout = buf
+	gopts.verbosity = 1
+	rtest.OK(t, withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runPrune(context.TODO(), opts, gopts, term)
+	}))
+	out := buf.String()
+	rtest.Assert(t, strings.Contains(out, "forget of 1 snapshots"), "forget missing in report: %v", out)
+	rtest.Assert(t, !strings.Contains(out, "unknown"), "unexpected unattributed data in report: %v", out)
+
+	opts.DryRun = false
+	err := withTermStatus(env.gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runPrune(context.TODO(), opts, env.gopts, term)
+	})
+	rtest.Assert(t, err != nil, "expected error for --report-age without --dry-run")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/oplog"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/walker"
 
@@ -70,6 +71,11 @@ func init() {
 }
 
 func runRepairSnapshots(ctx context.Context, gopts GlobalOptions, opts RepairOptions, args []string) error {
+	signingKey, err := loadSigningKey(gopts.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+
 	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, opts.DryRun)
 	if err != nil {
 		return err
@@ -100,18 +106,23 @@ func runRepairSnapshots(ctx context.Context, gopts GlobalOptions, opts RepairOpt
 				return node
 			}
 
-			ok := true
-			var newContent restic.IDs = restic.IDs{}
-			var newSize uint64
 			// check all contents and remove if not available
-			for _, id := range node.Content {
-				if size, found := repo.LookupBlobSize(restic.DataBlob, id); !found {
-					ok = false
-				} else {
-					newContent = append(newContent, id)
-					newSize += uint64(size)
+			repairContent := func(content restic.IDs) (restic.IDs, uint64, bool) {
+				ok := true
+				var newContent restic.IDs = restic.IDs{}
+				var newSize uint64
+				for _, id := range content {
+					if size, found := repo.LookupBlobSize(restic.DataBlob, id); !found {
+						ok = false
+					} else {
+						newContent = append(newContent, id)
+						newSize += uint64(size)
+					}
 				}
+				return newContent, newSize, ok
 			}
+
+			newContent, newSize, ok := repairContent(node.Content)
 			if !ok {
 				Verbosef("  file %q: removed missing content\n", path)
 			} else if newSize != node.Size {
@@ -120,6 +131,18 @@ func runRepairSnapshots(ctx context.Context, gopts GlobalOptions, opts RepairOpt
 			// no-ops if already correct
 			node.Content = newContent
 			node.Size = newSize
+
+			for i := range node.AlternateStreams {
+				stream := &node.AlternateStreams[i]
+				newContent, newSize, ok := repairContent(stream.Content)
+				if !ok {
+					Verbosef("  file %q: removed missing content of stream %q\n", path, stream.Name)
+				} else if newSize != stream.Size {
+					Verbosef("  file %q: fixed incorrect size of stream %q\n", path, stream.Name)
+				}
+				stream.Content = newContent
+				stream.Size = newSize
+			}
 			return node
 		},
 		RewriteFailedTree: func(_ restic.ID, path string, _ error) (restic.ID, error) {
@@ -139,26 +162,35 @@ func runRepairSnapshots(ctx context.Context, gopts GlobalOptions, opts RepairOpt
 		AllowUnstableSerialization: true,
 	})
 
-	changedCount := 0
+	filter := func(ctx context.Context, sn *restic.Snapshot) (restic.ID, *restic.SnapshotSummary, error) {
+		id, err := rewriter.RewriteTree(ctx, repo, "/", *sn.Tree)
+		return id, nil, err
+	}
+
+	var filtered []*filteredSnapshot
 	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, &opts.SnapshotFilter, args) {
 		Verbosef("\n%v\n", sn)
-		changed, err := filterAndReplaceSnapshot(ctx, repo, sn,
-			func(ctx context.Context, sn *restic.Snapshot) (restic.ID, *restic.SnapshotSummary, error) {
-				id, err := rewriter.RewriteTree(ctx, repo, "/", *sn.Tree)
-				return id, nil, err
-			}, opts.DryRun, opts.Forget, nil, "repaired")
+		fs, err := filterSnapshot(ctx, repo, sn, filter)
 		if err != nil {
 			return errors.Fatalf("unable to rewrite snapshot ID %q: %v", sn.ID().Str(), err)
 		}
-		if changed {
-			changedCount++
-		}
+		filtered = append(filtered, fs)
 	}
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
 	Verbosef("\n")
+	changedCount, err := replaceSnapshots(ctx, repo, gopts, filtered, &snapshotReplacement{
+		dryRun:     opts.DryRun,
+		forget:     opts.Forget,
+		addTag:     "repaired",
+		operation:  oplog.OpRepairSnapshots,
+		signingKey: signingKey,
+	})
+	if err != nil {
+		return err
+	}
 	if changedCount == 0 {
 		if !opts.DryRun {
 			Verbosef("no snapshots were modified\n")
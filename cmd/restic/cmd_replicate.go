@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdReplicate = &cobra.Command{
+	Use:   "replicate",
+	Short: "Manage hot standby replicas of a repository",
+	Long: `
+The "replicate" command manages repositories which are kept as hot standby
+replicas of a primary repository. A replica is a regular repository which is
+updated by running "copy" from the primary regularly. Once it is marked using
+"replicate demote", all commands which modify the repository except "copy"
+refuse to run, so that clients cannot accidentally write to the standby.
+
+If the primary repository is lost, "replicate promote" validates the replica,
+makes it writable and prints the configuration changes needed to switch the
+clients to the new primary repository.
+	`,
+	DisableAutoGenTag: true,
+	GroupID:           cmdGroupAdvanced,
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdReplicate)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/restic/restic/internal/audit"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdReplicateDemote = &cobra.Command{
+	Use:   "demote [flags]",
+	Short: "Mark the repository as a read-only replica",
+	Long: `
+The "demote" sub-command marks the repository as a replica of the primary
+repository given by "--primary". Afterwards, the repository can only be updated
+using "copy" until it is promoted again using "replicate promote". Reading from
+the repository, for example using "restore" or "check", remains possible.
+
+The command is also used to turn a former primary repository into a replica of
+the new primary after a failover, which prevents clients which still use the
+old location from writing to it.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReplicateDemote(cmd.Context(), replicateDemoteOptions, globalOptions, args)
+	},
+}
+
+// ReplicateDemoteOptions bundles all options for the replicate demote command.
+type ReplicateDemoteOptions struct {
+	Primary string
+}
+
+var replicateDemoteOptions ReplicateDemoteOptions
+
+func init() {
+	cmdReplicate.AddCommand(cmdReplicateDemote)
+
+	f := cmdReplicateDemote.Flags()
+	f.StringVar(&replicateDemoteOptions.Primary, "primary", "", "location of the primary `repository`, it is printed when the replica is promoted")
+}
+
+func runReplicateDemote(ctx context.Context, opts ReplicateDemoteOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the replicate demote command expects no arguments, only options - please see `restic help replicate demote` for usage and flags")
+	}
+
+	gopts.allowReplica = true
+	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if repo.Config().Replica != nil && opts.Primary == "" {
+		Verbosef("repository is already a replica\n")
+		return nil
+	}
+
+	replica := &restic.Replica{Primary: opts.Primary, Since: time.Now()}
+	if err := repository.SetReplica(ctx, repo, replica); err != nil {
+		return err
+	}
+
+	Verbosef("repository is now a read-only replica\n")
+	ev := audit.Event{
+		Type:     "replica-demoted",
+		Name:     "Repository demoted to replica",
+		Severity: 6,
+	}
+	if opts.Primary != "" {
+		ev.Message = "primary " + opts.Primary
+	}
+	auditEvent(ev)
+	return nil
+}
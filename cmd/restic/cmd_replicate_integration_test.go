@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunReplicatePromote(gopts GlobalOptions, opts ReplicatePromoteOptions) (ReplicaPromotion, error) {
+	var result ReplicaPromotion
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runReplicatePromote(context.TODO(), opts, gopts, nil)
+	})
+	if err != nil {
+		return result, err
+	}
+	return result, json.Unmarshal(buf.Bytes(), &result)
+}
+
+func TestReplicatePromote(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+
+	testRunInit(t, env2.gopts)
+	_, err := testRunReplicatePromote(env2.gopts, ReplicatePromoteOptions{})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "not a replica"), "expected error for regular repository, got %v", err)
+
+	rtest.OK(t, runReplicateDemote(context.TODO(), ReplicateDemoteOptions{Primary: env.gopts.Repo}, env2.gopts, nil))
+	testRunCopy(t, env.gopts, env2.gopts)
+	testRunCheck(t, env2.gopts)
+
+	// only copy may write to the replica
+	err = testRunBackupAssumeFailure(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env2.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "read-only replica"), "expected backup to the replica to fail, got %v", err)
+	testListSnapshots(t, env2.gopts, 2)
+
+	result, err := testRunReplicatePromote(env2.gopts, ReplicatePromoteOptions{ReadSample: 2, DryRun: true})
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(2), result.Snapshots)
+	rtest.Equals(t, uint(2), result.PacksRead)
+	rtest.Assert(t, !result.Promoted, "dry run promoted the replica")
+
+	result, err = testRunReplicatePromote(env2.gopts, ReplicatePromoteOptions{ReadSample: 1000})
+	rtest.OK(t, err)
+	rtest.Assert(t, result.Promoted, "replica was not promoted")
+	rtest.Equals(t, result.Packs, result.PacksRead)
+	rtest.Equals(t, env.gopts.Repo, result.PreviousPrimary)
+	rtest.Equals(t, env2.gopts.Repo, result.Environment["RESTIC_REPOSITORY"])
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, opts, env2.gopts)
+	testListSnapshots(t, env2.gopts, 3)
+}
+
+func TestReplicatePromoteIncomplete(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	// simulate pack files which were lost during replication
+	removePacksExcept(env.gopts, t, nil, false)
+	rtest.OK(t, runReplicateDemote(context.TODO(), ReplicateDemoteOptions{}, env.gopts, nil))
+
+	_, err := testRunReplicatePromote(env.gopts, ReplicatePromoteOptions{})
+	rtest.Assert(t, err != nil && errors.IsFatal(err), "expected promotion of incomplete replica to fail, got %v", err)
+	rtest.Assert(t, strings.Contains(err.Error(), "not promoted"), "unexpected error %v", err)
+}
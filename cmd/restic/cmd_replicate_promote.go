@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	"github.com/restic/restic/internal/audit"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdReplicatePromote = &cobra.Command{
+	Use:   "promote [flags]",
+	Short: "Validate a replica and make it the primary repository",
+	Long: `
+The "promote" sub-command turns a replica into the new primary repository, for
+example after the primary repository was lost. Before the repository is made
+writable, the replica is validated:
+
+ * The repository must not be locked by a running command, for example an
+   unfinished "copy" from the old primary. Stale locks are removed.
+ * All pack files referenced by the index must exist and the root trees of all
+   snapshots must be contained in the index.
+ * A random sample of pack files, selected by "--read-sample", is downloaded
+   and verified.
+
+If the validation succeeds, the replica marker is removed from the repository
+config and the configuration changes needed by clients to switch to the new
+primary repository are printed. With "--dry-run", the replica is only
+validated.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReplicatePromote(cmd.Context(), replicatePromoteOptions, globalOptions, args)
+	},
+}
+
+// ReplicatePromoteOptions bundles all options for the replicate promote command.
+type ReplicatePromoteOptions struct {
+	ReadSample uint
+	DryRun     bool
+}
+
+var replicatePromoteOptions ReplicatePromoteOptions
+
+func init() {
+	cmdReplicate.AddCommand(cmdReplicatePromote)
+
+	f := cmdReplicatePromote.Flags()
+	f.UintVar(&replicatePromoteOptions.ReadSample, "read-sample", 20, "number `n` of randomly selected pack files to read and verify")
+	f.BoolVarP(&replicatePromoteOptions.DryRun, "dry-run", "n", false, "only validate the replica, do not promote it")
+}
+
+// ReplicaPromotion is the result of the replicate promote command.
+type ReplicaPromotion struct {
+	Repository      string     `json:"repository"`
+	RepositoryID    string     `json:"repository_id"`
+	PreviousPrimary string     `json:"previous_primary,omitempty"`
+	Snapshots       uint       `json:"snapshots"`
+	LatestSnapshot  *time.Time `json:"latest_snapshot,omitempty"`
+	IndexFiles      uint       `json:"index_files"`
+	Packs           uint       `json:"packs"`
+	PacksRead       uint       `json:"packs_read"`
+	StaleLocks      uint       `json:"stale_locks_removed"`
+	Promoted        bool       `json:"promoted"`
+	// Environment contains the environment variables clients must set to use
+	// the new primary repository.
+	Environment map[string]string `json:"environment,omitempty"`
+}
+
+func runReplicatePromote(ctx context.Context, opts ReplicatePromoteOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the replicate promote command expects no arguments, only options - please see `restic help replicate promote` for usage and flags")
+	}
+
+	gopts.allowReplica = true
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	replica := repo.Config().Replica
+	if replica == nil {
+		return errors.Fatal("repository is not a replica, see `restic help replicate`")
+	}
+
+	loc, err := ReadRepo(gopts)
+	if err != nil {
+		return err
+	}
+	result := ReplicaPromotion{
+		Repository:      location.StripPassword(gopts.backends, loc),
+		RepositoryID:    repo.Config().ID,
+		PreviousPrimary: replica.Primary,
+	}
+
+	Verbosef("check lock state\n")
+	result.StaleLocks, err = checkReplicaLocks(ctx, repo, opts.DryRun)
+	if err != nil {
+		return err
+	}
+
+	// a dry run only needs to prevent concurrent modifications
+	lock, ctx, err := repository.Lock(ctx, repo, !opts.DryRun, gopts.RetryLock, func(msg string) {
+		if !gopts.JSON {
+			Verbosef("%s", msg)
+		}
+	}, Warnf)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := validateReplica(ctx, repo, opts, gopts, &result); err != nil {
+		return err
+	}
+
+	if !opts.DryRun {
+		if err := repository.SetReplica(ctx, repo, nil); err != nil {
+			return err
+		}
+		result.Promoted = true
+		result.Environment = map[string]string{"RESTIC_REPOSITORY": result.Repository}
+
+		ev := audit.Event{
+			Type:     "replica-promoted",
+			Name:     "Replica promoted to primary",
+			Severity: 7,
+		}
+		if replica.Primary != "" {
+			ev.Message = "previous primary " + replica.Primary
+		}
+		auditEvent(ev)
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(result)
+	}
+	printReplicaPromotion(result)
+	return nil
+}
+
+// checkReplicaLocks fails if the repository is locked by a running command
+// and removes stale locks unless dryRun is set. It returns the number of
+// stale locks.
+func checkReplicaLocks(ctx context.Context, repo *repository.Repository, dryRun bool) (uint, error) {
+	var active, stale uint
+	err := restic.ForAllLocks(ctx, repo, nil, func(id restic.ID, lock *restic.Lock, err error) error {
+		if err != nil {
+			return errors.Fatalf("unable to load lock %v: %v", id.Str(), err)
+		}
+		if lock.Stale() {
+			Verbosef("  stale %v\n", lock)
+			stale++
+		} else {
+			Warnf("active %v\n", lock)
+			active++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if active > 0 {
+		return 0, errors.Fatalf("replica is locked by %d active locks, wait until replication has finished or remove the locks of aborted commands using `restic unlock`", active)
+	}
+
+	if stale > 0 && !dryRun {
+		removed, err := repository.RemoveStaleLocks(ctx, repo)
+		if err != nil {
+			return 0, err
+		}
+		Verbosef("  removed %d stale locks\n", removed)
+	}
+	return stale, nil
+}
+
+// validateReplica checks that the replica is complete and reads a sample of
+// its pack files. The counts are stored in result.
+func validateReplica(ctx context.Context, repo *repository.Repository, opts ReplicatePromoteOptions, gopts GlobalOptions, result *ReplicaPromotion) error {
+	failed := 0
+
+	// snapshots must be listed before the index is loaded
+	Verbosef("load snapshots\n")
+	trees := make(map[restic.ID]restic.ID)
+	err := restic.ForAllSnapshots(ctx, repo, repo, nil, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err == nil && sn.Tree == nil {
+			err = errors.New("snapshot has no tree")
+		}
+		if err != nil {
+			Warnf("unable to load snapshot %v: %v\n", id.Str(), err)
+			failed++
+			return nil
+		}
+		result.Snapshots++
+		if result.LatestSnapshot == nil || sn.Time.After(*result.LatestSnapshot) {
+			t := sn.Time
+			result.LatestSnapshot = &t
+		}
+		trees[id] = *sn.Tree
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	chkr := checker.New(repo, false)
+	defer func() {
+		_ = chkr.Close()
+	}()
+
+	Verbosef("load indexes\n")
+	hints, errs := chkr.LoadIndex(ctx, newIndexProgress(gopts.Quiet, gopts.JSON))
+	for _, hint := range hints {
+		Verbosef("  %v\n", hint)
+	}
+	for _, err := range errs {
+		Warnf("error: %v\n", err)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(errs) > 0 {
+		return errors.Fatal("the index of the replica is damaged, the replica cannot be promoted")
+	}
+
+	result.IndexFiles = uint(chkr.CountIndexes())
+	result.Packs = uint(chkr.CountPacks())
+
+	Verbosef("check pack files\n")
+	orphaned := 0
+	errChan := make(chan error)
+	go chkr.Packs(ctx, errChan)
+	for err := range errChan {
+		var packErr *checker.PackError
+		if errors.As(err, &packErr) && packErr.Orphaned {
+			// interrupted copies leave unreferenced packs behind
+			orphaned++
+			continue
+		}
+		Warnf("%v\n", err)
+		failed++
+	}
+	if orphaned > 0 {
+		Verbosef("  %d pack files are not referenced by the index, `restic prune` removes them\n", orphaned)
+	}
+
+	for id, tree := range trees {
+		if len(repo.LookupBlob(restic.TreeBlob, tree)) == 0 {
+			Warnf("snapshot %v is incomplete, its tree is missing from the index\n", id.Str())
+			failed++
+		}
+	}
+
+	packs := selectRandomPacks(chkr.GetPacks(), opts.ReadSample)
+	if len(packs) > 0 {
+		Verbosef("read %d of %d pack files\n", len(packs), result.Packs)
+		bar := newProgressMax(!gopts.Quiet && !gopts.JSON, uint64(len(packs)), "packs read")
+		errChan = make(chan error)
+		go chkr.ReadPacks(ctx, packs, bar, errChan)
+		for err := range errChan {
+			Warnf("%v\n", err)
+			failed++
+		}
+		bar.Done()
+		result.PacksRead = uint(len(packs))
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if failed > 0 {
+		return errors.Fatalf("validation of the replica found %d errors, the replica was not promoted", failed)
+	}
+	return nil
+}
+
+// selectRandomPacks returns up to n randomly selected packs.
+func selectRandomPacks(allPacks map[restic.ID]int64, n uint) map[restic.ID]int64 {
+	ids := make([]restic.ID, 0, len(allPacks))
+	for id := range allPacks {
+		ids = append(ids, id)
+	}
+	rand.Shuffle(len(ids), func(i, j int) {
+		ids[i], ids[j] = ids[j], ids[i]
+	})
+
+	packs := make(map[restic.ID]int64)
+	for _, id := range ids[:min(int(n), len(ids))] {
+		packs[id] = allPacks[id]
+	}
+	return packs
+}
+
+func printReplicaPromotion(result ReplicaPromotion) {
+	Printf("snapshots:   %d", result.Snapshots)
+	if result.LatestSnapshot != nil {
+		Printf(", latest from %v", result.LatestSnapshot.Local().Format(TimeFormat))
+	}
+	Printf("\n")
+	Printf("index files: %d\n", result.IndexFiles)
+	Printf("pack files:  %d, %d read and verified\n", result.Packs, result.PacksRead)
+
+	if !result.Promoted {
+		Printf("\nthe replica is valid and can be promoted\n")
+		return
+	}
+
+	Printf("\nrepository %v is now the primary repository\n\n", result.Repository)
+	Printf("Update the configuration of all clients:\n\n")
+	Printf("  RESTIC_REPOSITORY=%v\n\n", result.Repository)
+	Printf("Clients must use a password of a key of this repository, see `restic key list`.\n")
+	Printf("The repository ID is %v, clients build a new local cache on their next run.\n", result.RepositoryID)
+	if result.PreviousPrimary != "" {
+		Printf("\nStop all copy jobs from %v. Once it is reachable again,\n", result.PreviousPrimary)
+		Printf("prevent writes to it by running\n\n")
+		Printf("  restic -r %v replicate demote --primary %v\n", result.PreviousPrimary, result.Repository)
+	} else {
+		Printf("\nStop all copy jobs to this repository and run `restic replicate demote` for\n")
+		Printf("the previous primary repository once it is reachable again.\n")
+	}
+}
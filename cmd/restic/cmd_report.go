@@ -0,0 +1,581 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdReport = &cobra.Command{
+	Use:   "report [flags]",
+	Short: "Create a backup health report for each host",
+	Long: `
+The "report" command creates a report of the backup health of each host for
+one or many repositories, for example for monthly reporting to customers.
+
+As each snapshot is a full backup, the latest snapshot of a host is all that is
+needed to restore it. For each host, the report lists the latest snapshot, its
+size and the amount of new data added per day during the --period, and
+verifies that all data referenced by the latest snapshot is present in the
+repository. A host is reported as failed if its latest snapshot is older than
+--max-age or is incomplete.
+
+If a retention policy is specified using the --keep-* options, the report also
+checks whether the restore points required by the policy exist and whether
+snapshots which the policy no longer covers have been removed using "forget".
+A host which does not comply with the policy is reported with a warning.
+
+To report on several repositories, list them in the file passed to
+--repos-file, one per line. A password file for the repository can be added on
+the same line, separated by whitespace, otherwise the password options of the
+command are used for all repositories.
+
+The report is printed as text by default, as HTML with --html, for example to
+send it via email, and as JSON with --json.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReport(cmd.Context(), reportOptions, globalOptions, args)
+	},
+}
+
+// ReportOptions collects all options for the report command.
+type ReportOptions struct {
+	restic.SnapshotFilter
+	ReposFile string
+	MaxAge    restic.Duration
+	Period    restic.Duration
+	NoVerify  bool
+	HTML      bool
+	Title     string
+
+	Daily   ForgetPolicyCount
+	Weekly  ForgetPolicyCount
+	Monthly ForgetPolicyCount
+	Yearly  ForgetPolicyCount
+}
+
+var reportOptions ReportOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdReport)
+
+	reportOptions.MaxAge = restic.Duration{Days: 1}
+	reportOptions.Period = restic.Duration{Days: 30}
+
+	f := cmdReport.Flags()
+	initMultiSnapshotFilter(f, &reportOptions.SnapshotFilter, true)
+	f.StringVar(&reportOptions.ReposFile, "repos-file", "", "read the `file` listing the repositories to report on")
+	f.Var(&reportOptions.MaxAge, "max-age", "report hosts as failed if their latest snapshot is older than `duration` (eg. 1d12h)")
+	f.Var(&reportOptions.Period, "period", "compute the change rate over the `duration` (eg. 1m)")
+	f.BoolVar(&reportOptions.NoVerify, "no-verify", false, "do not verify that the latest snapshots are complete")
+	f.BoolVar(&reportOptions.HTML, "html", false, "print the report as HTML")
+	f.StringVar(&reportOptions.Title, "title", "Backup report", "`title` of the report")
+	f.Var(&reportOptions.Daily, "keep-daily", "require `n` daily restore points (use 'unlimited' for all days)")
+	f.Var(&reportOptions.Weekly, "keep-weekly", "require `n` weekly restore points (use 'unlimited' for all weeks)")
+	f.Var(&reportOptions.Monthly, "keep-monthly", "require `n` monthly restore points (use 'unlimited' for all months)")
+	f.Var(&reportOptions.Yearly, "keep-yearly", "require `n` yearly restore points (use 'unlimited' for all years)")
+}
+
+func (opts ReportOptions) policy() restic.ExpirePolicy {
+	return restic.ExpirePolicy{
+		Daily:   int(opts.Daily),
+		Weekly:  int(opts.Weekly),
+		Monthly: int(opts.Monthly),
+		Yearly:  int(opts.Yearly),
+	}
+}
+
+// Host states in the report.
+const (
+	reportStatusOK      = "ok"
+	reportStatusWarning = "warning"
+	reportStatusFailed  = "failed"
+)
+
+// Report is the backup health report.
+type Report struct {
+	Title        string             `json:"title"`
+	Created      time.Time          `json:"created"`
+	Period       string             `json:"period"`
+	MaxAge       string             `json:"max_age"`
+	Policy       string             `json:"retention_policy,omitempty"`
+	Repositories []RepositoryReport `json:"repositories"`
+}
+
+// RepositoryReport contains the hosts of a repository. Error is set if the
+// repository could not be read.
+type RepositoryReport struct {
+	Repository string       `json:"repository"`
+	Error      string       `json:"error,omitempty"`
+	Hosts      []HostReport `json:"hosts"`
+}
+
+// HostReport describes the backup health of a host.
+type HostReport struct {
+	Host     string   `json:"host"`
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+
+	Snapshots    int       `json:"snapshots"`
+	LastSnapshot string    `json:"last_snapshot"`
+	LastTime     time.Time `json:"last_time"`
+	// Size is the size of the files in the latest snapshot.
+	Size uint64 `json:"size"`
+
+	// DataAdded is the amount of new data added during the period, AddedPerDay
+	// the average per day. ChangeRate is the average percentage of the data
+	// which changed compared to the parent snapshot.
+	DataAdded   uint64  `json:"data_added"`
+	AddedPerDay uint64  `json:"added_per_day"`
+	ChangeRate  float64 `json:"change_rate"`
+
+	// Verified is "ok", "failed" or "skipped". MissingBlobs counts the blobs
+	// referenced by the latest snapshot which are not in the repository.
+	Verified     string `json:"verified"`
+	MissingBlobs int    `json:"missing_blobs,omitempty"`
+
+	Retention *RetentionReport `json:"retention,omitempty"`
+}
+
+// RetentionReport describes whether the snapshots of a host comply with the
+// retention policy.
+type RetentionReport struct {
+	Compliant     bool            `json:"compliant"`
+	RestorePoints []RestorePoints `json:"restore_points"`
+	// Excess is the number of snapshots not covered by the policy.
+	Excess int `json:"excess"`
+}
+
+// RestorePoints counts the restore points of one kind, e.g. daily, which are
+// required by the policy and which are available.
+type RestorePoints struct {
+	Kind      string `json:"kind"`
+	Required  int    `json:"required"`
+	Available int    `json:"available"`
+}
+
+// durationBefore returns the time d before t.
+func durationBefore(t time.Time, d restic.Duration) time.Time {
+	return t.AddDate(-d.Years, -d.Months, -d.Days).Add(-time.Duration(d.Hours) * time.Hour)
+}
+
+// retentionPeriods are the kinds of restore points which can be required.
+var retentionPeriods = []struct {
+	kind string
+	// key returns a number identifying the period containing t, it
+	// increases with t.
+	key func(t time.Time) int
+	// prev returns a time in the period before the one containing t.
+	prev func(t time.Time) time.Time
+}{
+	{"daily",
+		func(t time.Time) int { return t.Year()*10000 + int(t.Month())*100 + t.Day() },
+		func(t time.Time) time.Time { return t.AddDate(0, 0, -1) }},
+	{"weekly",
+		func(t time.Time) int { y, w := t.ISOWeek(); return y*100 + w },
+		func(t time.Time) time.Time { return t.AddDate(0, 0, -7) }},
+	{"monthly",
+		func(t time.Time) int { return t.Year()*100 + int(t.Month()) },
+		func(t time.Time) time.Time { return time.Date(t.Year(), t.Month()-1, 1, 12, 0, 0, 0, t.Location()) }},
+	{"yearly",
+		func(t time.Time) int { return t.Year() },
+		func(t time.Time) time.Time { return time.Date(t.Year()-1, 6, 1, 12, 0, 0, 0, t.Location()) }},
+}
+
+// countRestorePoints returns how many of the last count periods, starting
+// with the period of the latest snapshot, are expected to contain a snapshot
+// and how many actually do. Periods before the first snapshot are not
+// expected. A count of -1 requires all periods. snapshots must be sorted
+// newest first.
+func countRestorePoints(snapshots restic.Snapshots, count int, key func(time.Time) int, prev func(time.Time) time.Time) (required, available int) {
+	have := make(map[int]struct{})
+	for _, sn := range snapshots {
+		have[key(sn.Time)] = struct{}{}
+	}
+	first := key(snapshots[len(snapshots)-1].Time)
+	t := snapshots[0].Time
+	for i := 0; count == -1 || i < count; i++ {
+		if key(t) < first {
+			break
+		}
+		required++
+		if _, ok := have[key(t)]; ok {
+			available++
+		}
+		t = prev(t)
+	}
+	return required, available
+}
+
+// checkRetention checks the snapshots of a host against the policy. As
+// "forget" groups snapshots by host and paths by default, the snapshots not
+// covered by the policy are determined for each set of paths separately.
+func checkRetention(snapshots restic.Snapshots, opts ReportOptions) *RetentionReport {
+	policy := opts.policy()
+	if policy.Empty() {
+		return nil
+	}
+
+	r := &RetentionReport{Compliant: true}
+	for i, p := range retentionPeriods {
+		count := []int{policy.Daily, policy.Weekly, policy.Monthly, policy.Yearly}[i]
+		if count == 0 {
+			continue
+		}
+		required, available := countRestorePoints(snapshots, count, p.key, p.prev)
+		r.RestorePoints = append(r.RestorePoints, RestorePoints{Kind: p.kind, Required: required, Available: available})
+		if available < required {
+			r.Compliant = false
+		}
+	}
+
+	byPaths := make(map[string]restic.Snapshots)
+	for _, sn := range snapshots {
+		paths := strings.Join(sn.Paths, "\x00")
+		byPaths[paths] = append(byPaths[paths], sn)
+	}
+	for _, list := range byPaths {
+		_, remove, _ := restic.ApplyPolicy(list, policy)
+		r.Excess += len(remove)
+	}
+	if r.Excess > 0 {
+		r.Compliant = false
+	}
+	return r
+}
+
+// newHostReport summarizes the snapshots of a host, which must be sorted
+// newest first.
+func newHostReport(host string, snapshots restic.Snapshots, opts ReportOptions, now time.Time) HostReport {
+	latest := snapshots[0]
+	hr := HostReport{
+		Host:         host,
+		Status:       reportStatusOK,
+		Snapshots:    len(snapshots),
+		LastSnapshot: latest.ID().Str(),
+		LastTime:     latest.Time,
+		Verified:     "skipped",
+	}
+	if latest.Summary != nil {
+		hr.Size = latest.Summary.TotalBytesProcessed
+	}
+
+	start := durationBefore(now, opts.Period)
+	var rates []float64
+	for _, sn := range snapshots {
+		if sn.Time.Before(start) || sn.Summary == nil {
+			continue
+		}
+		hr.DataAdded += sn.Summary.DataAdded
+		// the first backup adds all data, it says nothing about the changes
+		if sn.Parent != nil && sn.Summary.TotalBytesProcessed > 0 {
+			rates = append(rates, float64(sn.Summary.DataAdded)/float64(sn.Summary.TotalBytesProcessed)*100)
+		}
+	}
+	if days := now.Sub(start).Hours() / 24; days > 0 {
+		hr.AddedPerDay = uint64(float64(hr.DataAdded) / days)
+	}
+	for _, rate := range rates {
+		hr.ChangeRate += rate / float64(len(rates))
+	}
+
+	if latest.Time.Before(durationBefore(now, opts.MaxAge)) {
+		hr.Status = reportStatusFailed
+		hr.Problems = append(hr.Problems, fmt.Sprintf("no snapshot within %v", opts.MaxAge))
+	}
+
+	hr.Retention = checkRetention(snapshots, opts)
+	if hr.Retention != nil && !hr.Retention.Compliant {
+		if hr.Status == reportStatusOK {
+			hr.Status = reportStatusWarning
+		}
+		for _, rp := range hr.Retention.RestorePoints {
+			if rp.Available < rp.Required {
+				hr.Problems = append(hr.Problems, fmt.Sprintf("%d of %d %v restore points missing", rp.Required-rp.Available, rp.Required, rp.Kind))
+			}
+		}
+		if hr.Retention.Excess > 0 {
+			hr.Problems = append(hr.Problems, fmt.Sprintf("%d snapshots exceed the retention policy", hr.Retention.Excess))
+		}
+	}
+	return hr
+}
+
+// verifySnapshot checks that all blobs referenced by sn are in the index.
+func verifySnapshot(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, hr *HostReport) error {
+	blobs := restic.NewBlobSet()
+	err := restic.FindUsedBlobs(ctx, repo, sn.TreeIDs(), blobs, nil)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	hr.Verified = "ok"
+	if err != nil {
+		hr.Verified = "failed"
+		hr.Problems = append(hr.Problems, fmt.Sprintf("latest snapshot is damaged: %v", err))
+	} else {
+		for h := range blobs {
+			if _, ok := repo.LookupBlobSize(h.Type, h.ID); !ok {
+				hr.MissingBlobs++
+			}
+		}
+		if hr.MissingBlobs > 0 {
+			hr.Verified = "failed"
+			hr.Problems = append(hr.Problems, fmt.Sprintf("latest snapshot references %d missing blobs", hr.MissingBlobs))
+		}
+	}
+	if hr.Verified == "failed" {
+		hr.Status = reportStatusFailed
+	}
+	return nil
+}
+
+// reportRepository creates the report for the hosts in a repository.
+func reportRepository(ctx context.Context, opts ReportOptions, gopts GlobalOptions, now time.Time) ([]HostReport, error) {
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	byHost := make(map[string]restic.Snapshots)
+	for sn := range FindFilteredSnapshots(ctx, repo, repo, &opts.SnapshotFilter, nil) {
+		byHost[sn.Hostname] = append(byHost[sn.Hostname], sn)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if !opts.NoVerify && len(byHost) > 0 {
+		bar := newIndexProgress(gopts.Quiet, gopts.JSON || opts.HTML)
+		if err := repo.LoadIndex(ctx, bar); err != nil {
+			return nil, err
+		}
+	}
+
+	hosts := make([]HostReport, 0, len(byHost))
+	for host, snapshots := range byHost {
+		sort.Sort(snapshots)
+		hr := newHostReport(host, snapshots, opts, now)
+		if !opts.NoVerify {
+			if err := verifySnapshot(ctx, repo, snapshots[0], &hr); err != nil {
+				return nil, err
+			}
+		}
+		hosts = append(hosts, hr)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Host < hosts[j].Host })
+	return hosts, nil
+}
+
+// reportRepositories returns the options used to open each repository listed
+// in opts.ReposFile, or the repository given by gopts.
+func reportRepositories(opts ReportOptions, gopts GlobalOptions) ([]GlobalOptions, error) {
+	if opts.ReposFile == "" {
+		return []GlobalOptions{gopts}, nil
+	}
+
+	lines, err := readLines(opts.ReposFile)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read --repos-file: %v", err)
+	}
+	var repos []GlobalOptions
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, errors.Fatalf("invalid line in --repos-file: %q", line)
+		}
+		repoOpts := gopts
+		repoOpts.Repo = fields[0]
+		repoOpts.RepositoryFile = ""
+		if len(fields) == 2 {
+			repoOpts.PasswordFile = fields[1]
+			repoOpts.PasswordCommand = ""
+			repoOpts.password, err = loadPasswordFromFile(fields[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		repos = append(repos, repoOpts)
+	}
+	if len(repos) == 0 {
+		return nil, errors.Fatal("--repos-file does not list any repositories")
+	}
+	return repos, nil
+}
+
+func runReport(ctx context.Context, opts ReportOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the report command expects no arguments, only options - please see `restic help report` for usage and flags")
+	}
+	if opts.HTML && gopts.JSON {
+		return errors.Fatal("--html and --json cannot be used together")
+	}
+	if err := verifyForgetOptions(&ForgetOptions{Daily: opts.Daily, Weekly: opts.Weekly, Monthly: opts.Monthly, Yearly: opts.Yearly}); err != nil {
+		return err
+	}
+
+	repos, err := reportRepositories(opts, gopts)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	report := Report{
+		Title:   opts.Title,
+		Created: now,
+		Period:  opts.Period.String(),
+		MaxAge:  opts.MaxAge.String(),
+	}
+	if policy := opts.policy(); !policy.Empty() {
+		report.Policy = policy.String()
+	}
+
+	for _, repoOpts := range repos {
+		loc := repoOpts.Repo
+		if loc == "" {
+			loc = repoOpts.RepositoryFile
+		}
+		rr := RepositoryReport{Repository: location.StripPassword(gopts.backends, loc)}
+		rr.Hosts, err = reportRepository(ctx, opts, repoOpts, now)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if len(repos) == 1 {
+				return err
+			}
+			// report the remaining repositories
+			Warnf("unable to read repository %v: %v\n", rr.Repository, err)
+			rr.Error = err.Error()
+		}
+		report.Repositories = append(report.Repositories, rr)
+	}
+
+	switch {
+	case gopts.JSON:
+		return json.NewEncoder(globalOptions.stdout).Encode(report)
+	case opts.HTML:
+		return reportHTML.Execute(globalOptions.stdout, report)
+	}
+	return printReport(globalOptions.stdout, report)
+}
+
+func printReport(w io.Writer, report Report) error {
+	_, _ = fmt.Fprintf(w, "%v, created %v\n", report.Title, report.Created.Format(TimeFormat))
+	_, _ = fmt.Fprintf(w, "change rate over %v, maximum age %v\n", report.Period, report.MaxAge)
+	if report.Policy != "" {
+		_, _ = fmt.Fprintf(w, "retention policy: %v\n", report.Policy)
+	}
+
+	type row struct {
+		Host, Status, Last, Size, PerDay, Change, Verified string
+		Problems                                           []string
+	}
+
+	for _, rr := range report.Repositories {
+		_, _ = fmt.Fprintf(w, "\nrepository %v\n", rr.Repository)
+		if rr.Error != "" {
+			_, _ = fmt.Fprintf(w, "  error: %v\n", rr.Error)
+			continue
+		}
+		if len(rr.Hosts) == 0 {
+			_, _ = fmt.Fprintf(w, "  no snapshots\n")
+			continue
+		}
+
+		tab := table.New()
+		tab.AddColumn("Host", "{{ .Host }}")
+		tab.AddColumn("Status", "{{ .Status }}")
+		tab.AddColumn("Last Snapshot", "{{ .Last }}")
+		tab.AddColumn("Size", "{{ .Size }}")
+		tab.AddColumn("Added/Day", "{{ .PerDay }}")
+		tab.AddColumn("Change", "{{ .Change }}")
+		tab.AddColumn("Verified", "{{ .Verified }}")
+		tab.AddColumn("Problems", `{{ join .Problems "\n" }}`)
+		for _, hr := range rr.Hosts {
+			tab.AddRow(row{
+				Host:     hr.Host,
+				Status:   hr.Status,
+				Last:     hr.LastTime.Format(TimeFormat),
+				Size:     ui.FormatBytes(hr.Size),
+				PerDay:   ui.FormatBytes(hr.AddedPerDay),
+				Change:   fmt.Sprintf("%.1f%%", hr.ChangeRate),
+				Verified: hr.Verified,
+				Problems: hr.Problems,
+			})
+		}
+		if err := tab.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": ui.FormatBytes,
+	"time":  func(t time.Time) string { return t.Format(TimeFormat) },
+	"color": func(status string) string {
+		switch status {
+		case reportStatusOK:
+			return "#2e7d32"
+		case reportStatusWarning:
+			return "#ef6c00"
+		}
+		return "#c62828"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+</head>
+<body style="font-family: sans-serif; font-size: 14px;">
+<h1 style="font-size: 20px;">{{ .Title }}</h1>
+<p>Created {{ time .Created }}, change rate over {{ .Period }}, maximum age {{ .MaxAge }}{{ if .Policy }}<br>
+Retention policy: {{ .Policy }}{{ end }}</p>
+{{- range .Repositories }}
+<h2 style="font-size: 16px;">Repository {{ .Repository }}</h2>
+{{- if .Error }}
+<p style="color: #c62828;">Error: {{ .Error }}</p>
+{{- else if not .Hosts }}
+<p>No snapshots</p>
+{{- else }}
+<table style="border-collapse: collapse;" cellpadding="4" border="1">
+<tr><th>Host</th><th>Status</th><th>Last Snapshot</th><th>Size</th><th>Added/Day</th><th>Change</th><th>Verified</th><th>Problems</th></tr>
+{{- range .Hosts }}
+<tr><td>{{ .Host }}</td><td style="color: {{ color .Status }}; font-weight: bold;">{{ .Status }}</td><td>{{ time .LastTime }} ({{ .LastSnapshot }})</td><td>{{ bytes .Size }}</td><td>{{ bytes .AddedPerDay }}</td><td>{{ printf "%.1f%%" .ChangeRate }}</td><td>{{ .Verified }}</td><td>{{ range $i, $p := .Problems }}{{ if $i }}<br>{{ end }}{{ $p }}{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunReport(t testing.TB, opts ReportOptions, gopts GlobalOptions) Report {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runReport(context.TODO(), opts, gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	var report Report
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &report))
+	return report
+}
+
+func TestReport(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{Host: "fileserver"}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+
+	reportOpts := ReportOptions{MaxAge: reportOptions.MaxAge, Period: reportOptions.Period, Title: "Monthly report"}
+	report := testRunReport(t, reportOpts, env.gopts)
+	rtest.Equals(t, "Monthly report", report.Title)
+	rtest.Equals(t, 1, len(report.Repositories))
+	hosts := report.Repositories[0].Hosts
+	rtest.Equals(t, 1, len(hosts))
+	rtest.Equals(t, "fileserver", hosts[0].Host)
+	rtest.Equals(t, reportStatusOK, hosts[0].Status)
+	rtest.Equals(t, 2, hosts[0].Snapshots)
+	rtest.Equals(t, "ok", hosts[0].Verified)
+	rtest.Assert(t, hosts[0].Size > 0, "missing size")
+
+	// the same repository listed twice, once with an explicit password file
+	pwFile := filepath.Join(env.base, "password")
+	rtest.OK(t, os.WriteFile(pwFile, []byte(env.gopts.password), 0600))
+	reposFile := filepath.Join(env.base, "repos")
+	rtest.OK(t, os.WriteFile(reposFile, []byte("# customers\n"+env.repo+"\n"+env.repo+" "+pwFile+"\n"), 0600))
+	reportOpts.ReposFile = reposFile
+	report = testRunReport(t, reportOpts, env.gopts)
+	rtest.Equals(t, 2, len(report.Repositories))
+	rtest.Equals(t, hosts, report.Repositories[1].Hosts)
+
+	reportOpts.HTML = true
+	buf, err := withCaptureStdout(func() error {
+		return runReport(context.TODO(), reportOpts, env.gopts, nil)
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), "<td>fileserver</td>"), "host missing in HTML report: %q", buf.String())
+}
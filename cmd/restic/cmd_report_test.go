@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func reportTestSnapshots(t *testing.T, times ...string) restic.Snapshots {
+	var snapshots restic.Snapshots
+	for _, ts := range times {
+		tm, err := time.Parse(TimeFormat, ts)
+		rtest.OK(t, err)
+		sn, err := restic.NewSnapshot([]string{"/data"}, nil, "host", tm)
+		rtest.OK(t, err)
+		sn.Summary = &restic.SnapshotSummary{DataAdded: 100, TotalBytesProcessed: 1000}
+		if len(snapshots) > 0 {
+			// snapshots are listed newest first
+			snapshots[len(snapshots)-1].Parent = &restic.ID{}
+		}
+		snapshots = append(snapshots, sn)
+	}
+	return snapshots
+}
+
+func TestReportRestorePoints(t *testing.T) {
+	// newest first, 2024-06-07 is missing
+	snapshots := reportTestSnapshots(t,
+		"2024-06-10 22:00:00", "2024-06-09 22:00:00", "2024-06-08 22:00:00",
+		"2024-06-06 22:00:00", "2024-06-05 22:00:00")
+	daily := retentionPeriods[0]
+
+	required, available := countRestorePoints(snapshots, 3, daily.key, daily.prev)
+	rtest.Equals(t, 3, required)
+	rtest.Equals(t, 3, available)
+
+	required, available = countRestorePoints(snapshots, 7, daily.key, daily.prev)
+	rtest.Equals(t, 6, required)
+	rtest.Equals(t, 5, available)
+
+	required, available = countRestorePoints(snapshots, -1, daily.key, daily.prev)
+	rtest.Equals(t, 6, required)
+	rtest.Equals(t, 5, available)
+
+	monthly := retentionPeriods[2]
+	required, available = countRestorePoints(reportTestSnapshots(t, "2024-03-31 10:00:00", "2024-01-31 10:00:00"), 12, monthly.key, monthly.prev)
+	rtest.Equals(t, 3, required)
+	rtest.Equals(t, 2, available)
+}
+
+func TestReportHost(t *testing.T) {
+	now, err := time.Parse(TimeFormat, "2024-06-11 08:00:00")
+	rtest.OK(t, err)
+	snapshots := reportTestSnapshots(t,
+		"2024-06-10 22:00:00", "2024-06-09 22:00:00", "2024-06-08 22:00:00",
+		"2024-06-06 22:00:00", "2024-06-05 22:00:00")
+	opts := ReportOptions{MaxAge: restic.Duration{Days: 1}, Period: restic.Duration{Days: 5}}
+
+	hr := newHostReport("host", snapshots, opts, now)
+	rtest.Equals(t, reportStatusOK, hr.Status)
+	rtest.Equals(t, 5, hr.Snapshots)
+	rtest.Equals(t, uint64(1000), hr.Size)
+	// the snapshot of 2024-06-05 is outside of the period
+	rtest.Equals(t, uint64(400), hr.DataAdded)
+	rtest.Equals(t, uint64(80), hr.AddedPerDay)
+	rtest.Equals(t, 10.0, hr.ChangeRate)
+	rtest.Assert(t, hr.Retention == nil, "unexpected retention report %v", hr.Retention)
+
+	opts.Daily = 7
+	opts.Weekly = 1
+	hr = newHostReport("host", snapshots, opts, now)
+	rtest.Equals(t, reportStatusWarning, hr.Status)
+	rtest.Equals(t, []RestorePoints{
+		{Kind: "daily", Required: 6, Available: 5},
+		{Kind: "weekly", Required: 1, Available: 1},
+	}, hr.Retention.RestorePoints)
+	rtest.Equals(t, 0, hr.Retention.Excess)
+	rtest.Equals(t, []string{"1 of 6 daily restore points missing"}, hr.Problems)
+
+	opts.Daily = 2
+	opts.Weekly = 0
+	hr = newHostReport("host", snapshots, opts, now.Add(48*time.Hour))
+	rtest.Equals(t, reportStatusFailed, hr.Status)
+	rtest.Equals(t, []string{"no snapshot within 1d", "3 snapshots exceed the retention policy"}, hr.Problems)
+}
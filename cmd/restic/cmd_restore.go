@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/restic/restic/internal/audit"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/metrics"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/restorer"
 	"github.com/restic/restic/internal/ui"
@@ -30,6 +37,25 @@ repository.
 To only restore a specific subfolder, you can use the "snapshotID:subfolder"
 syntax, where "subfolder" is a path within the snapshot.
 
+With --auxiliary, the documents which were stored alongside the backed up data
+are restored instead, for example the VSS metadata documents of backups created
+with --use-fs-snapshot on Windows.
+
+With --staging, the snapshot is restored into a temporary directory next to the
+target, which then replaces the target. Applications either see the previous or
+the fully restored content of the target, but never a partially restored
+directory. On Linux, both directories are exchanged atomically. On Windows,
+the target is replaced atomically if it is a junction, which is then redirected
+to the restored directory. Otherwise, the target is replaced using renames and
+does not exist for a short moment. The previous content of the target is
+deleted afterwards. As the target is replaced as a whole, --staging cannot be
+combined with include or exclude patterns or --interactive.
+
+With --interactive, restic presents a shell to browse the snapshot. Files and
+directories can be marked for restore using the "mark" command. The "done"
+command then restores all marked items in a single pass, type "help" to list
+all available commands.
+
 EXIT STATUS
 ===========
 
@@ -56,15 +82,31 @@ type RestoreOptions struct {
 	restic.SnapshotFilter
 	DryRun              bool
 	Sparse              bool
+	BlockClone          bool
 	Verify              bool
 	Overwrite           restorer.OverwriteBehavior
 	Delete              bool
+	Staging             bool
+	RestoreOwner        bool
+	MapSIDsByName       bool
+	CaseCollision       restorer.CaseCollisionBehavior
+	NormalizeNames      restorer.NormalizationForm
+	MaxPathLength       int
+	RemapReport         string
+	SpecialFiles        string
+	RewriteSymlinks     restorer.SymlinkRewrites
+	IOPriority          fs.IOPriority
 	ExcludeXattrPattern []string
 	IncludeXattrPattern []string
+	Interactive         bool
+	Auxiliary           bool
 }
 
 var restoreOptions RestoreOptions
 
+// restoreInput is read by the interactive file picker, it is replaced during testing.
+var restoreInput io.Reader = os.Stdin
+
 func init() {
 	cmdRoot.AddCommand(cmdRestore)
 
@@ -80,9 +122,22 @@ func init() {
 	initSingleSnapshotFilter(flags, &restoreOptions.SnapshotFilter)
 	flags.BoolVar(&restoreOptions.DryRun, "dry-run", false, "do not write any data, just show what would be done")
 	flags.BoolVar(&restoreOptions.Sparse, "sparse", false, "restore files as sparse")
+	flags.BoolVar(&restoreOptions.BlockClone, "block-clone", false, "restore files with identical content only once and clone the others, sharing data on filesystems with block cloning support")
 	flags.BoolVar(&restoreOptions.Verify, "verify", false, "verify restored files content")
 	flags.Var(&restoreOptions.Overwrite, "overwrite", "overwrite behavior, one of (always|if-changed|if-newer|never) (default: always)")
+	flags.BoolVar(&restoreOptions.Interactive, "interactive", false, "interactively select the files and directories to restore")
+	flags.BoolVar(&restoreOptions.Auxiliary, "auxiliary", false, "restore the auxiliary documents stored with the snapshot, like the VSS metadata, instead of the backed up data")
 	flags.BoolVar(&restoreOptions.Delete, "delete", false, "delete files from target directory if they do not exist in snapshot. Use '--dry-run -vv' to check what would be deleted")
+	flags.BoolVar(&restoreOptions.Staging, "staging", false, "restore into a temporary directory which then replaces the target directory as a whole")
+	flags.BoolVar(&restoreOptions.RestoreOwner, "restore-owner", false, "only restore the owner and group of Windows security descriptors, translating them by account name (Windows only)")
+	flags.BoolVar(&restoreOptions.MapSIDsByName, "map-sids-by-name", false, "translate the SIDs of Windows security descriptors to the accounts with the same name on this computer (Windows only)")
+	flags.Var(&restoreOptions.CaseCollision, "case-collision", "how to restore files whose names collide on the target, for example as they only differ in case, one of (rename|skip|fail) (default: rename)")
+	flags.Var(&restoreOptions.NormalizeNames, "normalize-names", "Unicode normalization of restored file names, one of (nfc|nfd|preserve) (default: preserve)")
+	flags.IntVar(&restoreOptions.MaxPathLength, "max-path-length", 0, "restore entries whose target path is longer than `n` characters below a remapping directory in the target (default: no limit)")
+	flags.StringVar(&restoreOptions.RemapReport, "remap-report", "", "write the paths remapped due to --max-path-length as JSON to `file`")
+	flags.StringVar(&restoreOptions.SpecialFiles, "special-files", "", "`policy` for restoring device nodes, FIFOs and sockets: store, skip or fail (default: restore devices and FIFOs, skip sockets)")
+	flags.Var(&restoreOptions.RewriteSymlinks, "rewrite-symlinks", "rewrite the targets of restored symlinks using the sed style `expression` 's|regexp|replacement|' (can be specified multiple times)")
+	flags.Var(&restoreOptions.IOPriority, "io-priority", "disk I/O priority of the restore, one of (low|normal|high) (default: normal)")
 }
 
 func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
@@ -116,14 +171,49 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		return errors.Fatal("exclude and include patterns are mutually exclusive")
 	}
 
+	if opts.Interactive && (hasExcludes || hasIncludes) {
+		return errors.Fatal("--interactive cannot be combined with include or exclude patterns")
+	}
+
+	if opts.Interactive && gopts.JSON {
+		return errors.Fatal("--interactive cannot be used with --json")
+	}
+
 	if opts.DryRun && opts.Verify {
 		return errors.Fatal("--dry-run and --verify are mutually exclusive")
 	}
 
-	if opts.Delete && filepath.Clean(opts.Target) == "/" && !hasExcludes && !hasIncludes {
+	if opts.Delete && filepath.Clean(opts.Target) == "/" && !hasExcludes && !hasIncludes && !opts.Interactive {
 		return errors.Fatal("'--target / --delete' must be combined with an include or exclude filter")
 	}
 
+	if opts.Staging && opts.DryRun {
+		return errors.Fatal("--staging and --dry-run are mutually exclusive")
+	}
+
+	if opts.Staging && filepath.Dir(filepath.Clean(opts.Target)) == filepath.Clean(opts.Target) {
+		return errors.Fatal("--staging cannot be used to restore to the root directory")
+	}
+
+	// the target is replaced as a whole, files which are not selected would
+	// be lost
+	if opts.Staging && (hasExcludes || hasIncludes || opts.Interactive) {
+		return errors.Fatal("--staging cannot be combined with include or exclude patterns or --interactive")
+	}
+
+	if opts.MaxPathLength < 0 {
+		return errors.Fatal("--max-path-length must not be negative")
+	}
+
+	if opts.RemapReport != "" && opts.MaxPathLength == 0 {
+		return errors.Fatal("--remap-report requires --max-path-length")
+	}
+
+	specialFiles, err := restic.ParseSpecialFilesPolicy(opts.SpecialFiles)
+	if err != nil {
+		return errors.Fatal(err.Error())
+	}
+
 	snapshotIDString := args[0]
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
@@ -143,32 +233,60 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		return errors.Fatalf("failed to find snapshot: %v", err)
 	}
 
-	bar := newIndexTerminalProgress(gopts.Quiet, gopts.JSON, term)
+	events := newJSONEvents(gopts, term, "restore")
+	events.Phase("load index")
+	bar := newIndexEventsProgress(gopts, events, term)
 	err = repo.LoadIndex(ctx, bar)
 	if err != nil {
 		return err
 	}
 
+	if opts.Auxiliary {
+		if sn.Auxiliary == nil {
+			return errors.Fatalf("snapshot %s has no auxiliary documents", sn.ID().Str())
+		}
+		sn.Tree = sn.Auxiliary
+	}
+
 	sn.Tree, err = restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
 	if err != nil {
 		return err
 	}
 
+	var marked []string
+	if opts.Interactive {
+		marked, err = newRestorePicker(repo, *sn.Tree, gopts.stdout).Run(ctx, restoreInput)
+		if err != nil {
+			return err
+		}
+	}
+
 	msg := ui.NewMessage(term, gopts.verbosity)
 	var printer restoreui.ProgressPrinter
-	if gopts.JSON {
+	switch {
+	case events != nil:
+		printer = restoreui.NewJSONEventsProgress(events)
+	case gopts.JSON:
 		printer = restoreui.NewJSONProgress(term, gopts.verbosity)
-	} else {
+	default:
 		printer = restoreui.NewTextProgress(term, gopts.verbosity)
 	}
 
 	progress := restoreui.NewProgress(printer, calculateProgressInterval(!gopts.Quiet, gopts.JSON))
 	res := restorer.NewRestorer(repo, sn, restorer.Options{
-		DryRun:    opts.DryRun,
-		Sparse:    opts.Sparse,
-		Progress:  progress,
-		Overwrite: opts.Overwrite,
-		Delete:    opts.Delete,
+		DryRun:          opts.DryRun,
+		Sparse:          opts.Sparse,
+		Progress:        progress,
+		Overwrite:       opts.Overwrite,
+		Delete:          opts.Delete,
+		CaseCollision:   opts.CaseCollision,
+		NormalizeNames:  opts.NormalizeNames,
+		MaxPathLength:   opts.MaxPathLength,
+		SpecialFiles:    specialFiles,
+		RewriteSymlinks: opts.RewriteSymlinks,
+		BlockClone:      opts.BlockClone,
+		RestoreOwner:    opts.RestoreOwner,
+		MapSIDsByName:   opts.MapSIDsByName,
 	})
 
 	totalErrors := 0
@@ -177,6 +295,10 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		return progress.Error(location, err)
 	}
 	res.Warn = func(message string) {
+		if events != nil {
+			events.Warning("", message)
+			return
+		}
 		msg.E("Warning: %s\n", message)
 	}
 	res.Info = func(message string) {
@@ -229,6 +351,8 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		res.SelectFilter = selectExcludeFilter
 	} else if hasIncludes {
 		res.SelectFilter = selectIncludeFilter
+	} else if opts.Interactive {
+		res.SelectFilter = selectMarkedFilter(marked)
 	}
 
 	res.XattrSelectFilter, err = getXattrSelectFilter(opts)
@@ -236,29 +360,145 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		return err
 	}
 
+	if !opts.DryRun {
+		if err := fs.SetIOPriority(opts.IOPriority); err != nil {
+			Warnf("unable to set I/O priority %v: %v\n", opts.IOPriority.String(), err)
+		}
+	}
+
 	if !gopts.JSON {
 		msg.P("restoring %s to %s\n", res.Snapshot(), opts.Target)
 	}
+	events.Phase("restore")
+
+	restoreTarget := opts.Target
+	if opts.Staging {
+		restoreTarget, err = fs.StagingDir(opts.Target)
+		if err != nil {
+			return errors.Fatalf("cannot create staging directory: %v", err)
+		}
+		debug.Log("restoring to staging directory %v", restoreTarget)
+		defer func() {
+			// the staging directory is only left over if the restore failed
+			if restoreTarget == "" {
+				return
+			}
+			if err := os.RemoveAll(restoreTarget); err != nil {
+				Warnf("unable to remove staging directory %v: %v\n", restoreTarget, err)
+			}
+		}()
+	}
 
-	countRestoredFiles, err := res.RestoreTo(ctx, opts.Target)
+	token := &checkpointToken{Operation: "restore", Snapshot: sn.ID().String(), Target: opts.Target}
+	restoreCtx := ctx
+	var checkpoint <-chan struct{}
+	// a restore to a staging directory cannot be resumed, as the directory
+	// is removed when the restore is interrupted
+	if !opts.DryRun && !opts.Staging {
+		var done func()
+		checkpoint, done = registerCheckpoint()
+		defer done()
+
+		var cancel context.CancelFunc
+		restoreCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-checkpoint:
+				cancel()
+			case <-restoreCtx.Done():
+			}
+		}()
+
+		if saved := token.load(repo); saved != nil && !gopts.JSON {
+			msg.P("resuming restore interrupted at %v, %d files (%v) were already restored\n",
+				saved.Time.Format(TimeFormat), saved.Files, ui.FormatBytes(saved.Bytes))
+			if opts.Overwrite == restorer.OverwriteIfNewer || opts.Overwrite == restorer.OverwriteNever {
+				Warnf("partially restored files are only repaired with --overwrite always or if-changed\n")
+			}
+		}
+	}
+
+	countRestoredFiles, err := res.RestoreTo(restoreCtx, restoreTarget)
+	if err != nil && checkpointRequested(checkpoint) && ctx.Err() == nil {
+		state := progress.State()
+		token.Time = time.Now()
+		token.Files = state.FilesFinished
+		token.Bytes = state.AllBytesWritten
+		if err := token.save(repo); err != nil {
+			Warnf("unable to record checkpoint: %v\n", err)
+		}
+		Warnf("restore interrupted, %d files (%v) were restored so far\n", token.Files, ui.FormatBytes(token.Bytes))
+		return ErrCheckpoint
+	}
 	if err != nil {
 		return err
 	}
+	for _, c := range res.NameCollisions() {
+		if c.Target == "" {
+			res.Warn(fmt.Sprintf("%v: skipped, name collides with %v on the target", c.Location, c.Other))
+		} else {
+			res.Warn(fmt.Sprintf("%v: restored as %v, name collides with %v on the target", c.Location, c.Target, c.Other))
+		}
+	}
+	if n := res.RewrittenSymlinks(); n > 0 && !gopts.JSON {
+		Verbosef("rewrote the targets of %d symlinks\n", n)
+	}
+	if special := res.SpecialFiles(); !special.Empty() && !gopts.JSON {
+		Verbosef("special files: %s\n", special.Format("restored"))
+	}
+	if remapped := res.RemappedPaths(); len(remapped) > 0 {
+		if opts.RemapReport != "" {
+			err = writeRemapReport(opts.RemapReport, sn, opts.MaxPathLength, remapped)
+			if err != nil {
+				return err
+			}
+			res.Warn(fmt.Sprintf("%d paths exceed %d characters and were restored to a different path, see %v",
+				len(remapped), opts.MaxPathLength, opts.RemapReport))
+		} else {
+			for _, r := range remapped {
+				res.Warn(fmt.Sprintf("%v: restored as %v, path exceeds %d characters", r.Location, r.Target, opts.MaxPathLength))
+			}
+		}
+	}
 
 	progress.Finish()
+	state := progress.State()
+	recordMetrics(metrics.Stats{Files: state.FilesFinished, Bytes: state.AllBytesWritten}, uint64(totalErrors), "")
+
+	if !opts.DryRun {
+		ev := audit.Event{
+			Type:      "restore-performed",
+			Name:      "Restore performed",
+			Severity:  5,
+			Snapshots: []string{sn.ID().String()},
+			Target:    opts.Target,
+			Count:     int(countRestoredFiles),
+		}
+		if totalErrors > 0 {
+			ev.Outcome = audit.Failure
+			ev.Message = fmt.Sprintf("%d errors", totalErrors)
+		}
+		auditEvent(ev)
+	}
 
 	if totalErrors > 0 {
 		return errors.Fatalf("There were %d errors\n", totalErrors)
 	}
+	token.remove(repo)
 
 	if opts.Verify {
 		if !gopts.JSON {
 			msg.P("verifying files in %s\n", opts.Target)
 		}
+		events.Phase("verify")
 		var count int
 		t0 := time.Now()
 		bar := newTerminalProgressMax(!gopts.Quiet && !gopts.JSON && stdoutIsTerminal(), 0, "files verified", term)
-		count, err = res.VerifyFiles(ctx, opts.Target, countRestoredFiles, bar)
+		if events != nil {
+			bar = events.NewCounter("files verified")
+		}
+		count, err = res.VerifyFiles(ctx, restoreTarget, countRestoredFiles, bar)
 		if err != nil {
 			return err
 		}
@@ -272,6 +512,22 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		}
 	}
 
+	if opts.Staging {
+		old, err := fs.SwapDirectories(opts.Target, restoreTarget)
+		if err != nil {
+			return errors.Fatalf("cannot replace %v with the restored directory: %v", opts.Target, err)
+		}
+		restoreTarget = ""
+		if old != "" {
+			if err := os.RemoveAll(old); err != nil {
+				Warnf("unable to remove the previous content of %v in %v: %v\n", opts.Target, old, err)
+			}
+		}
+		if !gopts.JSON {
+			msg.P("replaced %s with the restored directory\n", opts.Target)
+		}
+	}
+
 	return nil
 }
 
@@ -309,3 +565,26 @@ func getXattrSelectFilter(opts RestoreOptions) (func(xattrName string) bool, err
 	// default to including all xattrs
 	return func(_ string) bool { return true }, nil
 }
+
+// remapReport is the format of the report written by --remap-report.
+type remapReport struct {
+	SnapshotID    string                  `json:"snapshot_id"`
+	MaxPathLength int                     `json:"max_path_length"`
+	Remapped      []restorer.RemappedPath `json:"remapped"`
+}
+
+func writeRemapReport(filename string, sn *restic.Snapshot, maxPathLength int, remapped []restorer.RemappedPath) error {
+	buf, err := json.MarshalIndent(remapReport{
+		SnapshotID:    sn.ID().String(),
+		MaxPathLength: maxPathLength,
+		Remapped:      remapped,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filename, append(buf, '\n'), 0600)
+	if err != nil {
+		return errors.Fatalf("unable to write remap report: %v", err)
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
@@ -12,9 +14,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 	"github.com/restic/restic/internal/ui/termstatus"
+	"golang.org/x/sync/errgroup"
 )
 
 func testRunRestore(t testing.TB, opts GlobalOptions, dir string, snapshotID string) {
@@ -420,3 +426,189 @@ func TestRestoreDefaultLayout(t *testing.T) {
 	rtest.RemoveAll(t, filepath.Join(env.base, "repo"))
 	rtest.RemoveAll(t, target)
 }
+
+func TestRestoreInteractive(t *testing.T) {
+	testfiles := []struct {
+		name     string
+		restored bool
+	}{
+		{"testfile1.c", false},
+		{"testfile2.exe", true},
+		{"subdir1/subdir2/testfile3.docx", true},
+		{"subdir1/subdir2/testfile4.c", true},
+		{"subdir1/testfile5.c", false},
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for _, testFile := range testfiles {
+		p := filepath.Join(env.testdata, testFile.name)
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, 100))
+	}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	defer func(in io.Reader) {
+		restoreInput = in
+	}(restoreInput)
+
+	// aborting the selection must not restore anything
+	restoreInput = strings.NewReader("cd testdata\nmark *.exe\nquit\n")
+	restoredir := filepath.Join(env.base, "restore-aborted")
+	err := testRunRestoreAssumeFailure(snapshotID.String(), RestoreOptions{Target: restoredir, Interactive: true}, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for aborted restore")
+	_, err = os.Stat(restoredir)
+	rtest.Assert(t, os.IsNotExist(err), "restore directory must not exist after abort")
+
+	restoreInput = strings.NewReader(strings.Join([]string{
+		"cd testdata",
+		"ls",
+		"mark *.exe",
+		"cd subdir1",
+		"mark subdir2",
+		"mark subdir2/testfile4.c",
+		"mark missing",
+		"cd /",
+		"marked",
+		"done",
+	}, "\n"))
+	restoredir = filepath.Join(env.base, "restore-interactive")
+	rtest.OK(t, testRunRestoreAssumeFailure(snapshotID.String(), RestoreOptions{Target: restoredir, Interactive: true}, env.gopts))
+
+	for _, testFile := range testfiles {
+		_, err := os.Stat(filepath.Join(restoredir, "testdata", testFile.name))
+		if testFile.restored {
+			rtest.OK(t, err)
+		} else {
+			rtest.Assert(t, os.IsNotExist(err), "file %s should not have been restored", testFile.name)
+		}
+	}
+}
+
+func TestRestoreRemapReport(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	p := filepath.Join(env.testdata, "a-directory-with-a-long-name", "file-with-a-long-name")
+	rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+	rtest.OK(t, appendRandomData(p, 100))
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	reportFile := filepath.Join(env.base, "remap.json")
+	opts := RestoreOptions{
+		Target:        restoredir,
+		MaxPathLength: len(restoredir) + 50,
+		RemapReport:   reportFile,
+	}
+	rtest.OK(t, testRunRestoreAssumeFailure("latest", opts, env.gopts))
+
+	buf, err := os.ReadFile(reportFile)
+	rtest.OK(t, err)
+	var report remapReport
+	rtest.OK(t, json.Unmarshal(buf, &report))
+	rtest.Equals(t, opts.MaxPathLength, report.MaxPathLength)
+	rtest.Equals(t, 1, len(report.Remapped))
+	rtest.Equals(t, filepath.Join(restoredir, "testdata", "a-directory-with-a-long-name", "file-with-a-long-name"), report.Remapped[0].Original)
+	rtest.Assert(t, len(report.Remapped[0].Target) <= opts.MaxPathLength, "remapped path %v is too long", report.Remapped[0].Target)
+
+	restored, err := os.ReadFile(report.Remapped[0].Target)
+	rtest.OK(t, err)
+	original, err := os.ReadFile(p)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(original, restored), "remapped file has wrong content")
+}
+
+func TestRestoreAuxiliary(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	p := filepath.Join(env.testdata, "file")
+	rtest.OK(t, appendRandomData(p, 100))
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	snapshots := testListSnapshots(t, env.gopts, 1)
+
+	opts := RestoreOptions{Target: filepath.Join(env.base, "restore"), Auxiliary: true}
+	err := testRunRestoreAssumeFailure("latest", opts, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "has no auxiliary documents"), "unexpected error %v", err)
+
+	// attach documents to the snapshot
+	ctx, repo, unlock, err := openWithExclusiveLock(context.TODO(), env.gopts, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(ctx, nil))
+	sn, err := restic.LoadSnapshot(ctx, repo, snapshots[0])
+	rtest.OK(t, err)
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+	docs := []restic.AuxiliaryDocument{{Path: "vss/c/backup_components.xml", Data: []byte("<BACKUP/>")}}
+	id, err := archiver.SaveAuxiliaryDocuments(ctx, repo, repo.Config().ChunkerPolynomial, docs, time.Now())
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(ctx))
+	sn.Auxiliary = &id
+	rtest.OK(t, repo.RemoveUnpacked(ctx, restic.WriteableSnapshotFile, snapshots[0]))
+	_, err = restic.SaveSnapshot(ctx, repo, sn)
+	rtest.OK(t, err)
+	unlock()
+
+	// the documents must survive a prune
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0"})
+	testRunCheck(t, env.gopts)
+
+	rtest.OK(t, testRunRestoreAssumeFailure("latest", opts, env.gopts))
+	buf, err := os.ReadFile(filepath.Join(opts.Target, "vss", "c", "backup_components.xml"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "<BACKUP/>", string(buf))
+	_, err = os.Stat(filepath.Join(opts.Target, "testdata"))
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "backed up data was restored: %v", err)
+}
+
+func TestRestoreStaging(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	p := filepath.Join(env.testdata, "file")
+	rtest.OK(t, appendRandomData(p, 100))
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+
+	parent := filepath.Join(env.base, "restore")
+	target := filepath.Join(parent, "target")
+	rtest.OK(t, os.MkdirAll(target, 0700))
+	rtest.OK(t, os.WriteFile(filepath.Join(target, "stale"), []byte("stale"), 0600))
+
+	opts := RestoreOptions{Target: target, Staging: true}
+	rtest.OK(t, testRunRestoreAssumeFailure("latest", opts, env.gopts))
+
+	original, err := os.ReadFile(p)
+	rtest.OK(t, err)
+	restored, err := os.ReadFile(filepath.Join(target, "testdata", "file"))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(original, restored), "restored file has wrong content")
+
+	_, err = os.Stat(filepath.Join(target, "stale"))
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "stale file was not removed: %v", err)
+
+	// neither the staging directory nor the previous content may be left over
+	entries, err := os.ReadDir(parent)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+	rtest.Equals(t, "target", entries[0].Name())
+
+	// a partial restore would lose the files which are not selected
+	for _, opts := range []RestoreOptions{
+		{Target: target, Staging: true, IncludePatternOptions: filter.IncludePatternOptions{Includes: []string{"file"}}},
+		{Target: target, Staging: true, ExcludePatternOptions: filter.ExcludePatternOptions{Excludes: []string{"file"}}},
+		{Target: target, Staging: true, Interactive: true},
+	} {
+		err := testRunRestoreAssumeFailure("latest", opts, env.gopts)
+		rtest.Assert(t, err != nil, "expected error for --staging with %+v", opts)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/restic/restic/internal/dump"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/winshares"
+	"github.com/spf13/cobra"
+)
+
+var cmdRestoreShares = &cobra.Command{
+	Use:   "restore-shares [flags] snapshotID",
+	Short: "Recreate the SMB shares stored by backup --windows-shares",
+	Long: `
+The "restore-shares" command recreates the SMB shares of a Windows file server
+from a snapshot created by "backup --windows-shares". The shares are created
+with their original path, description, user limit, offline caching mode and
+share-level permissions. Restore the shared directories first, as shares can
+only be created for existing directories.
+
+If no --tag is given, only snapshots with the tag "windows-shares" are
+considered. Shares which already exist are skipped unless --overwrite is
+specified. Use --share to select individual shares.
+
+With --dry-run, no shares are created and the command prints a report of the
+stored shares instead, which lists the share-level permissions and the NTFS
+permissions of the shared directories at the time of the backup in SDDL form.
+The report can also be created on other operating systems.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRestoreShares(cmd.Context(), restoreSharesOptions, globalOptions, args)
+	},
+}
+
+// RestoreSharesOptions collects all options for the restore-shares command.
+type RestoreSharesOptions struct {
+	restic.SnapshotFilter
+	Shares    []string
+	Overwrite bool
+	DryRun    bool
+}
+
+var restoreSharesOptions RestoreSharesOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdRestoreShares)
+
+	f := cmdRestoreShares.Flags()
+	initSingleSnapshotFilter(f, &restoreSharesOptions.SnapshotFilter)
+	f.StringSliceVar(&restoreSharesOptions.Shares, "share", nil, "only restore the shares with the given `names` (comma separated, can be specified multiple times)")
+	f.BoolVar(&restoreSharesOptions.Overwrite, "overwrite", false, "replace existing shares with the same name")
+	f.BoolVarP(&restoreSharesOptions.DryRun, "dry-run", "n", false, "do not create any shares, print a report of the stored shares")
+}
+
+// restoredShare is printed for each share with --json.
+type restoredShare struct {
+	MessageType string `json:"message_type"` // "share"
+	winshares.Share
+	// Action is "created", "replaced", "skipped", "failed" or "none" for --dry-run.
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// loadShareDefinitions reads the share definitions from the snapshot.
+func loadShareDefinitions(ctx context.Context, repo restic.Loader, sn *restic.Snapshot) (winshares.Definitions, error) {
+	dir, file := path.Split(windowsSharesFilename)
+	treeID, err := restic.FindTreeDirectory(ctx, repo, sn.Tree, dir)
+	if err != nil {
+		return winshares.Definitions{}, errors.Fatalf("snapshot %v does not contain share definitions: %v", sn.ID().Str(), err)
+	}
+	tree, err := restic.LoadTree(ctx, repo, *treeID)
+	if err != nil {
+		return winshares.Definitions{}, err
+	}
+	node := tree.Find(file)
+	if node == nil || node.Type != restic.NodeTypeFile {
+		return winshares.Definitions{}, errors.Fatalf("snapshot %v does not contain share definitions", sn.ID().Str())
+	}
+
+	var buf bytes.Buffer
+	if err := dump.New("tar", repo, &buf).WriteNode(ctx, node); err != nil {
+		return winshares.Definitions{}, err
+	}
+	return winshares.Unmarshal(buf.Bytes())
+}
+
+// selectShares returns the shares whose names are listed in names, or all
+// shares if names is empty. Share names are not case sensitive.
+func selectShares(shares []winshares.Share, names []string) ([]winshares.Share, error) {
+	if len(names) == 0 {
+		return shares, nil
+	}
+	var selected []winshares.Share
+	for _, name := range names {
+		found := false
+		for _, share := range shares {
+			if strings.EqualFold(share.Name, name) {
+				selected = append(selected, share)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Fatalf("share %q not found in snapshot", name)
+		}
+	}
+	return selected, nil
+}
+
+// restoreShare creates the share and returns the action taken.
+func restoreShare(share winshares.Share, overwrite bool) (string, error) {
+	err := winshares.Create(share)
+	if err != winshares.ErrShareExists {
+		if err != nil {
+			return "failed", err
+		}
+		return "created", nil
+	}
+	if !overwrite {
+		return "skipped", nil
+	}
+	if err := winshares.Delete(share.Name); err != nil {
+		return "failed", err
+	}
+	if err := winshares.Create(share); err != nil {
+		return "failed", err
+	}
+	return "replaced", nil
+}
+
+func printShareReport(share winshares.Share) {
+	Printf("share %v: %v\n", share.Name, share.Path)
+	if share.Remark != "" {
+		Printf("  description:       %v\n", share.Remark)
+	}
+	if share.MaxUses != winshares.UnlimitedUses {
+		Printf("  user limit:        %d\n", share.MaxUses)
+	}
+	security := share.Security
+	if security == "" {
+		security = "(default)"
+	}
+	Printf("  share permissions: %v\n", security)
+	pathSecurity := share.PathSecurity
+	if pathSecurity == "" {
+		pathSecurity = "(unknown)"
+	}
+	Printf("  NTFS permissions:  %v\n", pathSecurity)
+}
+
+func runRestoreShares(ctx context.Context, opts RestoreSharesOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("specify exactly one snapshot ID")
+	}
+	if !opts.DryRun && runtime.GOOS != "windows" {
+		return errors.Fatal("restoring shares is only supported on Windows, use --dry-run to print a report")
+	}
+	if len(opts.Tags) == 0 {
+		opts.Tags = restic.TagLists{restic.TagList{windowsSharesTag}}
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sn, _, err := opts.SnapshotFilter.FindLatest(ctx, repo, repo, args[0])
+	if err != nil {
+		return errors.Fatalf("failed to find snapshot: %v", err)
+	}
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	if err := repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	defs, err := loadShareDefinitions(ctx, repo, sn)
+	if err != nil {
+		return err
+	}
+	shares, err := selectShares(defs.Shares, opts.Shares)
+	if err != nil {
+		return err
+	}
+	if !gopts.JSON {
+		Verbosef("snapshot %v contains %d shares of host %v\n", sn.ID().Str(), len(defs.Shares), defs.Hostname)
+	}
+
+	enc := json.NewEncoder(globalOptions.stdout)
+	failed := 0
+	for _, share := range shares {
+		result := restoredShare{MessageType: "share", Share: share, Action: "none"}
+		if !opts.DryRun {
+			action, err := restoreShare(share, opts.Overwrite)
+			result.Action = action
+			if err != nil {
+				result.Error = err.Error()
+				failed++
+			}
+		}
+
+		if gopts.JSON {
+			if err := enc.Encode(result); err != nil {
+				return err
+			}
+			continue
+		}
+		switch result.Action {
+		case "none":
+			printShareReport(share)
+		case "failed":
+			Warnf("%v\n", result.Error)
+		case "skipped":
+			Warnf("share %v already exists, skipped\n", share.Name)
+		default:
+			Verbosef("%v share %v: %v\n", result.Action, share.Name, share.Path)
+		}
+	}
+
+	if failed > 0 {
+		return errors.Fatalf("failed to restore %d of %d shares", failed, len(shares))
+	}
+	return nil
+}
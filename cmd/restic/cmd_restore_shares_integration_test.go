@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/winshares"
+)
+
+func TestRestoreSharesReport(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	defs := winshares.Definitions{
+		Hostname: "fileserver",
+		Shares: []winshares.Share{
+			{Name: "Data", Path: `D:\Data`, Remark: "Department data", MaxUses: winshares.UnlimitedUses,
+				Security: "O:BAG:SYD:(A;;FA;;;WD)", PathSecurity: "O:BAG:SYD:(A;OICI;FA;;;BA)"},
+			{Name: "Scans", Path: `D:\Scans`, MaxUses: 5},
+		},
+	}
+	buf, err := defs.Marshal()
+	rtest.OK(t, err)
+	rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, "windows"), 0700))
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, filepath.FromSlash(windowsSharesFilename)), buf, 0600))
+	testRunBackup(t, env.testdata, []string{"windows"}, BackupOptions{Tags: restic.TagLists{{windowsSharesTag}}}, env.gopts)
+
+	opts := RestoreSharesOptions{DryRun: true}
+	out, err := withCaptureStdout(func() error {
+		return runRestoreShares(context.TODO(), opts, env.gopts, []string{"latest"})
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(out.String(), "share Data: D:\\Data\n  description:       Department data\n  share permissions: O:BAG:SYD:(A;;FA;;;WD)\n  NTFS permissions:  O:BAG:SYD:(A;OICI;FA;;;BA)\n"),
+		"unexpected report %q", out.String())
+	rtest.Assert(t, strings.Contains(out.String(), "share Scans: D:\\Scans\n  user limit:        5\n  share permissions: (default)\n"),
+		"unexpected report %q", out.String())
+
+	opts.Shares = []string{"scans"}
+	out, err = withCaptureStdout(func() error {
+		gopts := env.gopts
+		gopts.JSON = true
+		return runRestoreShares(context.TODO(), opts, gopts, []string{"latest"})
+	})
+	rtest.OK(t, err)
+	var result restoredShare
+	rtest.OK(t, json.Unmarshal(out.Bytes(), &result))
+	rtest.Equals(t, "Scans", result.Name)
+	rtest.Equals(t, "none", result.Action)
+
+	opts.Shares = []string{"missing"}
+	err = runRestoreShares(context.TODO(), opts, env.gopts, []string{"latest"})
+	rtest.Assert(t, err != nil, "missing error for unknown share")
+}
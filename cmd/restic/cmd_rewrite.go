@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"reflect"
 	"time"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/restic/restic/internal/approval"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/oplog"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/walker"
@@ -119,96 +123,157 @@ func init() {
 // be updated accordingly.
 type rewriteFilterFunc func(ctx context.Context, sn *restic.Snapshot) (restic.ID, *restic.SnapshotSummary, error)
 
-func rewriteSnapshot(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, opts RewriteOptions) (bool, error) {
-	if sn.Tree == nil {
-		return false, errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
-	}
-
+// filterRewrite returns the filter which excludes the files selected by opts
+// from a snapshot.
+func filterRewrite(repo *repository.Repository, opts RewriteOptions) (rewriteFilterFunc, error) {
 	rejectByNameFuncs, err := opts.ExcludePatternOptions.CollectPatterns(Warnf)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	metadata, err := opts.Metadata.convert()
-
-	if err != nil {
-		return false, err
+	if len(rejectByNameFuncs) == 0 && !opts.SnapshotSummary {
+		return func(_ context.Context, sn *restic.Snapshot) (restic.ID, *restic.SnapshotSummary, error) {
+			return *sn.Tree, nil, nil
+		}, nil
 	}
 
-	var filter rewriteFilterFunc
-
-	if len(rejectByNameFuncs) > 0 || opts.SnapshotSummary {
-		selectByName := func(nodepath string) bool {
-			for _, reject := range rejectByNameFuncs {
-				if reject(nodepath) {
-					return false
-				}
+	selectByName := func(nodepath string) bool {
+		for _, reject := range rejectByNameFuncs {
+			if reject(nodepath) {
+				return false
 			}
-			return true
 		}
+		return true
+	}
 
-		rewriteNode := func(node *restic.Node, path string) *restic.Node {
-			if selectByName(path) {
-				return node
-			}
-			Verbosef("excluding %s\n", path)
-			return nil
+	rewriteNode := func(node *restic.Node, path string) *restic.Node {
+		if selectByName(path) {
+			return node
 		}
+		Verbosef("excluding %s\n", path)
+		return nil
+	}
 
+	return func(ctx context.Context, sn *restic.Snapshot) (restic.ID, *restic.SnapshotSummary, error) {
 		rewriter, querySize := walker.NewSnapshotSizeRewriter(rewriteNode)
-
-		filter = func(ctx context.Context, sn *restic.Snapshot) (restic.ID, *restic.SnapshotSummary, error) {
-			id, err := rewriter.RewriteTree(ctx, repo, "/", *sn.Tree)
-			if err != nil {
-				return restic.ID{}, nil, err
-			}
-			ss := querySize()
-			summary := &restic.SnapshotSummary{}
-			if sn.Summary != nil {
-				*summary = *sn.Summary
-			}
-			summary.TotalFilesProcessed = ss.FileCount
-			summary.TotalBytesProcessed = ss.FileSize
-			return id, summary, err
+		id, err := rewriter.RewriteTree(ctx, repo, "/", *sn.Tree)
+		if err != nil {
+			return restic.ID{}, nil, err
 		}
-
-	} else {
-		filter = func(_ context.Context, sn *restic.Snapshot) (restic.ID, *restic.SnapshotSummary, error) {
-			return *sn.Tree, nil, nil
+		ss := querySize()
+		summary := &restic.SnapshotSummary{}
+		if sn.Summary != nil {
+			*summary = *sn.Summary
 		}
-	}
+		summary.TotalFilesProcessed = ss.FileCount
+		summary.TotalBytesProcessed = ss.FileSize
+		return id, summary, err
+	}, nil
+}
 
-	return filterAndReplaceSnapshot(ctx, repo, sn,
-		filter, opts.DryRun, opts.Forget, metadata, "rewrite")
+// filteredSnapshot is a snapshot together with the tree and summary returned
+// by a rewriteFilterFunc.
+type filteredSnapshot struct {
+	sn      *restic.Snapshot
+	tree    restic.ID
+	summary *restic.SnapshotSummary
 }
 
-func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *restic.Snapshot,
-	filter rewriteFilterFunc, dryRun bool, forget bool, newMetadata *snapshotMetadata, addTag string) (bool, error) {
+// filterSnapshot applies filter to sn and saves the new trees.
+func filterSnapshot(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, filter rewriteFilterFunc) (*filteredSnapshot, error) {
+	if sn.Tree == nil {
+		return nil, errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
 
 	wg, wgCtx := errgroup.WithContext(ctx)
 	repo.StartPackUploader(wgCtx, wg)
 
-	var filteredTree restic.ID
-	var summary *restic.SnapshotSummary
+	fs := &filteredSnapshot{sn: sn}
 	wg.Go(func() error {
 		var err error
-		filteredTree, summary, err = filter(ctx, sn)
+		fs.tree, fs.summary, err = filter(ctx, sn)
 		if err != nil {
 			return err
 		}
 
 		return repo.Flush(wgCtx)
 	})
-	err := wg.Wait()
-	if err != nil {
-		return false, err
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// modified returns true if the snapshot must be replaced.
+func (fs *filteredSnapshot) modified(newMetadata *snapshotMetadata) bool {
+	matchingSummary := true
+	if fs.summary != nil {
+		matchingSummary = fs.sn.Summary != nil && reflect.DeepEqual(*fs.summary, *fs.sn.Summary)
+	}
+	return fs.tree != *fs.sn.Tree || newMetadata != nil || !matchingSummary
+}
+
+// snapshotReplacement describes how the filtered snapshots are replaced.
+type snapshotReplacement struct {
+	dryRun bool
+	// forget removes the original snapshots after saving the new ones
+	forget   bool
+	metadata *snapshotMetadata
+	// addTag is added to the new snapshots unless forget is set
+	addTag string
+	// operation is the operation used for the approval requests and the
+	// operation log, see approval.OpRewrite and oplog.OpRewrite
+	operation  string
+	signingKey ed25519.PrivateKey
+}
+
+// removes returns true if replacing fs removes the original snapshot.
+func (r *snapshotReplacement) removes(fs *filteredSnapshot) bool {
+	return fs.tree.IsNull() || (r.forget && fs.modified(r.metadata))
+}
+
+// replaceSnapshots replaces the filtered snapshots and returns the number of
+// modified snapshots. Removing the original snapshots is subject to the
+// approval policy of the repository, it is counted towards the forget
+// threshold like the snapshots removed by forget.
+func replaceSnapshots(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, filtered []*filteredSnapshot, r *snapshotReplacement) (int, error) {
+	var approved *approval.Request
+	if !r.dryRun {
+		var remove restic.IDs
+		for _, fs := range filtered {
+			if r.removes(fs) {
+				remove = append(remove, *fs.sn.ID())
+			}
+		}
+		var err error
+		approved, err = approveSnapshotRemoval(ctx, repo, gopts, r.operation, remove)
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	if filteredTree.IsNull() {
-		if dryRun {
-			Verbosef("would delete empty snapshot\n")
+	changedCount := 0
+	for _, fs := range filtered {
+		changed, err := replaceSnapshot(ctx, repo, fs, r, approvalID(approved))
+		if err != nil {
+			return changedCount, errors.Fatalf("unable to rewrite snapshot ID %q: %v", fs.sn.ID().Str(), err)
+		}
+		if changed {
+			changedCount++
+		}
+	}
+	return changedCount, consumeApproval(ctx, repo, approved)
+}
+
+// replaceSnapshot replaces the snapshot of fs by a snapshot with the filtered
+// tree. The removal of the original snapshot is recorded in the operation log.
+func replaceSnapshot(ctx context.Context, repo *repository.Repository, fs *filteredSnapshot, r *snapshotReplacement, approvedBy *restic.ID) (bool, error) {
+	sn := fs.sn
+	if fs.tree.IsNull() {
+		if r.dryRun {
+			Verbosef("would delete empty snapshot %v\n", sn.ID().Str())
 		} else {
-			if err = repo.RemoveUnpacked(ctx, restic.WriteableSnapshotFile, *sn.ID()); err != nil {
+			if err := removeReplacedSnapshot(ctx, repo, sn, r.operation, approvedBy); err != nil {
 				return false, err
 			}
 			debug.Log("removed empty snapshot %v", sn.ID())
@@ -217,22 +282,18 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *r
 		return true, nil
 	}
 
-	matchingSummary := true
-	if summary != nil {
-		matchingSummary = sn.Summary != nil && *summary == *sn.Summary
-	}
-
-	if filteredTree == *sn.Tree && newMetadata == nil && matchingSummary {
+	if !fs.modified(r.metadata) {
 		debug.Log("Snapshot %v not modified", sn)
 		return false, nil
 	}
 
 	debug.Log("Snapshot %v modified", sn)
-	if dryRun {
-		Verbosef("would save new snapshot\n")
+	newMetadata := r.metadata
+	if r.dryRun {
+		Verbosef("would save new snapshot for %v\n", sn.ID().Str())
 
-		if forget {
-			Verbosef("would remove old snapshot\n")
+		if r.forget {
+			Verbosef("would remove old snapshot %v\n", sn.ID().Str())
 		}
 
 		if newMetadata != nil && newMetadata.Time != nil {
@@ -246,15 +307,18 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *r
 		return true, nil
 	}
 
+	// keep the original snapshot to remove it once the new one is saved
+	original := *sn
+
 	// Always set the original snapshot id as this essentially a new snapshot.
 	sn.Original = sn.ID()
-	sn.Tree = &filteredTree
-	if summary != nil {
-		sn.Summary = summary
+	sn.Tree = &fs.tree
+	if fs.summary != nil {
+		sn.Summary = fs.summary
 	}
 
-	if !forget {
-		sn.AddTags([]string{addTag})
+	if !r.forget {
+		sn.AddTags([]string{r.addTag})
 	}
 
 	if newMetadata != nil && newMetadata.Time != nil {
@@ -267,32 +331,54 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *r
 		sn.Hostname = newMetadata.Hostname
 	}
 
+	err := updateSnapshotSignature(sn, r.signingKey)
+	if err != nil {
+		return false, err
+	}
+
 	// Save the new snapshot.
 	id, err := restic.SaveSnapshot(ctx, repo, sn)
 	if err != nil {
 		return false, err
 	}
-	Verbosef("saved new snapshot %v\n", id.Str())
+	Verbosef("saved new snapshot %v for %v\n", id.Str(), original.ID().Str())
 
-	if forget {
-		if err = repo.RemoveUnpacked(ctx, restic.WriteableSnapshotFile, *sn.ID()); err != nil {
+	if r.forget {
+		if err = removeReplacedSnapshot(ctx, repo, &original, r.operation, approvedBy); err != nil {
 			return false, err
 		}
-		debug.Log("removed old snapshot %v", sn.ID())
-		Verbosef("removed old snapshot %v\n", sn.ID().Str())
+		debug.Log("removed old snapshot %v", original.ID())
+		Verbosef("removed old snapshot %v\n", original.ID().Str())
 	}
 	return true, nil
 }
 
+// removeReplacedSnapshot removes the snapshot sn and records the removal in the
+// operation log.
+func removeReplacedSnapshot(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, operation string, approvedBy *restic.ID) error {
+	if err := repo.RemoveUnpacked(ctx, restic.WriteableSnapshotFile, *sn.ID()); err != nil {
+		return err
+	}
+	rec := &oplog.Record{Operation: operation, Snapshots: restic.IDs{*sn.ID()}, Approval: approvedBy}
+	if sn.Tree != nil {
+		rec.Trees = restic.IDs{*sn.Tree}
+	}
+	return recordOperation(ctx, repo, rec)
+}
+
 func runRewrite(ctx context.Context, opts RewriteOptions, gopts GlobalOptions, args []string) error {
 	if !opts.SnapshotSummary && opts.ExcludePatternOptions.Empty() && opts.Metadata.empty() {
 		return errors.Fatal("Nothing to do: no excludes provided and no new metadata provided")
 	}
 
+	signingKey, err := loadSigningKey(gopts.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+
 	var (
 		repo   *repository.Repository
 		unlock func()
-		err    error
 	)
 
 	if opts.Forget {
@@ -316,22 +402,40 @@ func runRewrite(ctx context.Context, opts RewriteOptions, gopts GlobalOptions, a
 		return err
 	}
 
-	changedCount := 0
+	filter, err := filterRewrite(repo, opts)
+	if err != nil {
+		return err
+	}
+	metadata, err := opts.Metadata.convert()
+	if err != nil {
+		return err
+	}
+
+	var filtered []*filteredSnapshot
 	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, &opts.SnapshotFilter, args) {
 		Verbosef("\n%v\n", sn)
-		changed, err := rewriteSnapshot(ctx, repo, sn, opts)
+		fs, err := filterSnapshot(ctx, repo, sn, filter)
 		if err != nil {
 			return errors.Fatalf("unable to rewrite snapshot ID %q: %v", sn.ID().Str(), err)
 		}
-		if changed {
-			changedCount++
-		}
+		filtered = append(filtered, fs)
 	}
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
 	Verbosef("\n")
+	changedCount, err := replaceSnapshots(ctx, repo, gopts, filtered, &snapshotReplacement{
+		dryRun:     opts.DryRun,
+		forget:     opts.Forget,
+		metadata:   metadata,
+		addTag:     "rewrite",
+		operation:  oplog.OpRewrite,
+		signingKey: signingKey,
+	})
+	if err != nil {
+		return err
+	}
 	if changedCount == 0 {
 		if !opts.DryRun {
 			Verbosef("no snapshots were modified\n")
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/spf13/cobra"
+)
+
+var cmdSchedule = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage scheduled tasks running restic on Windows",
+	Long: `
+The "schedule" command installs, verifies and removes tasks in the Windows Task
+Scheduler which run restic periodically. The job is described by a JSON profile,
+see "restic help generate" for the format.
+
+The tasks run with the highest privileges, which allows backups using
+--use-fs-snapshot, wake the computer and also run on battery power.
+	`,
+	DisableAutoGenTag: true,
+}
+
+// scheduleOptions bundles the options shared by the schedule subcommands.
+type scheduleOptions struct {
+	ProfileFile string
+}
+
+func (opts *scheduleOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&opts.ProfileFile, "profile", "", "read the scheduled job from the JSON profile `file` (required)")
+}
+
+func (opts scheduleOptions) loadProfile() (scheduleProfile, error) {
+	if runtime.GOOS != "windows" {
+		return scheduleProfile{}, errors.Fatal("the schedule command is only supported on Windows, use `restic generate --systemd-units` on other systems")
+	}
+	if opts.ProfileFile == "" {
+		return scheduleProfile{}, errors.Fatal("please specify the profile using --profile")
+	}
+	return loadScheduleProfile(opts.ProfileFile)
+}
+
+// scheduleTaskOptions additionally allow overriding the schedule of the
+// profile. `schedule status` must be called with the same options as
+// `schedule install`.
+type scheduleTaskOptions struct {
+	scheduleOptions
+	Hourly bool
+	Daily  string
+	Weekly string
+}
+
+func (opts *scheduleTaskOptions) AddFlags(cmd *cobra.Command) {
+	opts.scheduleOptions.AddFlags(cmd)
+
+	f := cmd.Flags()
+	f.BoolVar(&opts.Hourly, "hourly", false, "run the task every hour")
+	f.StringVar(&opts.Daily, "daily", "", "run the task every day at `time` (HH:MM)")
+	f.StringVar(&opts.Weekly, "weekly", "", "run the task every Monday at `time` (HH:MM)")
+	cmd.MarkFlagsMutuallyExclusive("hourly", "daily", "weekly")
+}
+
+// loadProfile loads the profile, overrides its schedule and sets the default
+// log file.
+func (opts scheduleTaskOptions) loadProfile() (scheduleProfile, error) {
+	p, err := opts.scheduleOptions.loadProfile()
+	if err != nil {
+		return p, err
+	}
+
+	switch {
+	case opts.Hourly:
+		p.Schedule, p.At = "hourly", ""
+	case opts.Daily != "":
+		p.Schedule, p.At = "daily", opts.Daily
+	case opts.Weekly != "":
+		p.Schedule, p.At = "weekly", opts.Weekly
+	}
+	setDefaultWindowsLogFile(&p)
+	return p, p.validate()
+}
+
+// setDefaultWindowsLogFile sets the log file of the profile if it is not
+// specified, the task scheduler discards the output of tasks.
+func setDefaultWindowsLogFile(p *scheduleProfile) {
+	if p.LogFile != "" {
+		return
+	}
+	programData := os.Getenv("ProgramData")
+	if programData == "" {
+		programData = `C:\ProgramData`
+	}
+	p.LogFile = filepath.Join(programData, "restic", "logs", p.Name+".log")
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdSchedule)
+}
+
+// runWindowsTool runs a command line tool and returns its output. The output
+// on stderr is included in the error message.
+func runWindowsTool(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Fatalf("%v failed: %v: %v", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// runPowerShell runs script and returns its output as UTF-8.
+func runPowerShell(ctx context.Context, script string) ([]byte, error) {
+	script = "[Console]::OutputEncoding = [System.Text.Encoding]::UTF8; " + script
+	return runWindowsTool(ctx, "powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script)
+}
+
+// windowsTaskDefinition contains the parts of a task definition which are
+// verified by `schedule status`.
+type windowsTaskDefinition struct {
+	Triggers struct {
+		Calendar []struct {
+			StartBoundary string    `xml:"StartBoundary"`
+			ByDay         *struct{} `xml:"ScheduleByDay"`
+			ByWeek        *struct{} `xml:"ScheduleByWeek"`
+		} `xml:"CalendarTrigger"`
+		Time []struct {
+			StartBoundary string `xml:"StartBoundary"`
+			Interval      string `xml:"Repetition>Interval"`
+		} `xml:"TimeTrigger"`
+	} `xml:"Triggers"`
+	Principal struct {
+		RunLevel string `xml:"RunLevel"`
+	} `xml:"Principals>Principal"`
+	// Settings which are missing use the default value of the task
+	// scheduler, see settingEnabled.
+	Settings struct {
+		DisallowStartIfOnBatteries *bool  `xml:"DisallowStartIfOnBatteries"`
+		StopIfGoingOnBatteries     *bool  `xml:"StopIfGoingOnBatteries"`
+		WakeToRun                  *bool  `xml:"WakeToRun"`
+		StartWhenAvailable         *bool  `xml:"StartWhenAvailable"`
+		MultipleInstancesPolicy    string `xml:"MultipleInstancesPolicy"`
+	} `xml:"Settings"`
+	Exec struct {
+		Command   string `xml:"Command"`
+		Arguments string `xml:"Arguments"`
+	} `xml:"Actions>Exec"`
+}
+
+func parseWindowsTask(data []byte) (windowsTaskDefinition, error) {
+	var def windowsTaskDefinition
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	// the declaration claims UTF-16 even if the text has been converted
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) {
+		return r, nil
+	}
+	err := dec.Decode(&def)
+	if err != nil {
+		return def, errors.Fatalf("unable to parse task definition: %v", err)
+	}
+	return def, nil
+}
+
+// settingEnabled returns the value of a setting of a task definition, or def
+// if the setting is not specified.
+func settingEnabled(setting *bool, def bool) bool {
+	if setting == nil {
+		return def
+	}
+	return *setting
+}
+
+// timeOfDay returns the time of day (HH:MM) of a start boundary like
+// 2024-03-01T02:30:00 or 2024-03-01T02:30:00+01:00.
+func timeOfDay(boundary string) string {
+	t, err := time.Parse("2006-01-02T15:04", boundary[:min(len(boundary), 16)])
+	if err != nil {
+		return boundary
+	}
+	return t.Format("15:04")
+}
+
+// schedule returns a description of the triggers of the task.
+func (def windowsTaskDefinition) schedule() string {
+	var triggers []string
+	for _, t := range def.Triggers.Time {
+		if t.Interval == "PT1H" {
+			triggers = append(triggers, "hourly")
+		} else {
+			triggers = append(triggers, fmt.Sprintf("at %v every %v", timeOfDay(t.StartBoundary), t.Interval))
+		}
+	}
+	for _, t := range def.Triggers.Calendar {
+		switch {
+		case t.ByDay != nil:
+			triggers = append(triggers, "daily at "+timeOfDay(t.StartBoundary))
+		case t.ByWeek != nil:
+			triggers = append(triggers, "weekly at "+timeOfDay(t.StartBoundary))
+		default:
+			triggers = append(triggers, "at "+timeOfDay(t.StartBoundary))
+		}
+	}
+	if len(triggers) == 0 {
+		return "never"
+	}
+	return strings.Join(triggers, ", ")
+}
+
+// compareWindowsTasks returns a list of the differences between the installed
+// task and the expected task definition.
+func compareWindowsTasks(installed, expected windowsTaskDefinition) []string {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(installed.schedule() == expected.schedule(), "runs %v instead of %v", installed.schedule(), expected.schedule())
+	check(installed.Principal.RunLevel == expected.Principal.RunLevel, "does not run with highest privileges, VSS snapshots will fail")
+	check(!settingEnabled(installed.Settings.DisallowStartIfOnBatteries, true), "does not start on battery power")
+	check(!settingEnabled(installed.Settings.StopIfGoingOnBatteries, true), "stops when switching to battery power")
+	check(settingEnabled(installed.Settings.WakeToRun, false), "does not wake the computer to run")
+	check(settingEnabled(installed.Settings.StartWhenAvailable, false), "does not run after a missed start")
+	check(installed.Settings.MultipleInstancesPolicy == "" || installed.Settings.MultipleInstancesPolicy == expected.Settings.MultipleInstancesPolicy,
+		"multiple instances policy is %q instead of %q", installed.Settings.MultipleInstancesPolicy, expected.Settings.MultipleInstancesPolicy)
+	check(strings.EqualFold(installed.Exec.Command, expected.Exec.Command), "runs %q instead of %q", installed.Exec.Command, expected.Exec.Command)
+	check(installed.Exec.Arguments == expected.Exec.Arguments, "arguments differ from the profile: %v", installed.Exec.Arguments)
+
+	return problems
+}
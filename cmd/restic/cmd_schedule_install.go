@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/spf13/cobra"
+)
+
+var cmdScheduleInstall = &cobra.Command{
+	Use:   "install [flags]",
+	Short: "Create or update the scheduled task for a profile",
+	Long: `
+The "install" sub-command creates the scheduled task for the profile in the
+Windows Task Scheduler, or updates it if it already exists. The task is called
+"restic-" followed by the name of the profile. It runs as SYSTEM unless the
+profile specifies a user. The schedule of the profile can be overridden using
+--hourly, --daily or --weekly.
+
+The output of the task is appended to the "log_file" of the profile. By default
+it is written to %ProgramData%\restic\logs\<name>.log.
+
+The command must be run from an elevated prompt.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runScheduleInstall(cmd.Context(), scheduleInstallOpts, args)
+	},
+}
+
+var scheduleInstallOpts scheduleTaskOptions
+
+func init() {
+	cmdSchedule.AddCommand(cmdScheduleInstall)
+	scheduleInstallOpts.AddFlags(cmdScheduleInstall)
+}
+
+func runScheduleInstall(ctx context.Context, opts scheduleTaskOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the schedule install command expects no arguments, only options - please see `restic help schedule install` for usage and flags")
+	}
+
+	p, err := opts.loadProfile()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(p.LogFile), 0700)
+	if err != nil {
+		return errors.Fatalf("unable to create log directory: %v", err)
+	}
+
+	task := windowsTask(p, time.Now())
+	def, err := parseWindowsTask([]byte(task))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "restic-task-*.xml")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	_, err = f.Write(encodeUTF16(task))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	name := windowsTaskName(p)
+	_, err = runWindowsTool(ctx, "schtasks.exe", "/Create", "/F", "/TN", name, "/XML", f.Name())
+	if err != nil {
+		return errors.Fatalf("unable to install scheduled task %v: %v", name, err)
+	}
+
+	Printf("installed scheduled task %v, runs %v, logs to %v\n", name, def.schedule(), p.LogFile)
+	return nil
+}
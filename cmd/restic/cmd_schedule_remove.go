@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/spf13/cobra"
+)
+
+var cmdScheduleRemove = &cobra.Command{
+	Use:   "remove [flags]",
+	Short: "Remove the scheduled task for a profile",
+	Long: `
+The "remove" sub-command deletes the scheduled task for the profile from the
+Windows Task Scheduler. The log file is kept.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runScheduleRemove(cmd.Context(), scheduleRemoveOpts, args)
+	},
+}
+
+var scheduleRemoveOpts scheduleOptions
+
+func init() {
+	cmdSchedule.AddCommand(cmdScheduleRemove)
+	scheduleRemoveOpts.AddFlags(cmdScheduleRemove)
+}
+
+func runScheduleRemove(ctx context.Context, opts scheduleOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the schedule remove command expects no arguments, only options - please see `restic help schedule remove` for usage and flags")
+	}
+
+	p, err := opts.loadProfile()
+	if err != nil {
+		return err
+	}
+
+	name := windowsTaskName(p)
+	_, err = runWindowsTool(ctx, "schtasks.exe", "/Delete", "/F", "/TN", name)
+	if err != nil {
+		return errors.Fatalf("unable to remove scheduled task %v: %v", name, err)
+	}
+
+	Printf("removed scheduled task %v\n", name)
+	return nil
+}
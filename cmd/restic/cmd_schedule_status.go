@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/spf13/cobra"
+)
+
+var cmdScheduleStatus = &cobra.Command{
+	Use:   "status [flags]",
+	Short: "Verify the scheduled task for a profile",
+	Long: `
+The "status" sub-command checks that the scheduled task for the profile exists
+and matches the profile, and shows when it ran last and its result. It must be
+called with the same options as "schedule install".
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the task is installed correctly and its last run succeeded.
+Exit status is 1 if the task is missing, does not match the profile or there was any error.
+Exit status is 4 if the last run of the task failed.
+	`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runScheduleStatus(cmd.Context(), scheduleStatusOpts, globalOptions, args)
+	},
+}
+
+var scheduleStatusOpts scheduleTaskOptions
+
+func init() {
+	cmdSchedule.AddCommand(cmdScheduleStatus)
+	scheduleStatusOpts.AddFlags(cmdScheduleStatus)
+}
+
+// Results of scheduled tasks which do not indicate a failure.
+const (
+	windowsTaskRunning  = 0x41301
+	windowsTaskNeverRun = 0x41303
+)
+
+// scheduleStatus is the status of a scheduled task.
+type scheduleStatus struct {
+	Task       string     `json:"task"`
+	Schedule   string     `json:"schedule"`
+	LogFile    string     `json:"log_file"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	LastResult int64      `json:"last_result"`
+	Problems   []string   `json:"problems"`
+}
+
+// lastResult describes the result of the last run of the task.
+func (s scheduleStatus) lastResult() string {
+	switch s.LastResult {
+	case 0:
+		return "success"
+	case windowsTaskRunning:
+		return "running"
+	case windowsTaskNeverRun:
+		return "never run"
+	}
+	return fmt.Sprintf("failed with 0x%x", s.LastResult)
+}
+
+func (s scheduleStatus) failed() bool {
+	return s.LastResult != 0 && s.LastResult != windowsTaskRunning && s.LastResult != windowsTaskNeverRun
+}
+
+// parseWindowsTaskInfo parses the output of the PowerShell script in
+// runScheduleStatus, which contains the last run time, the last result and
+// the next run time separated by "|".
+func parseWindowsTaskInfo(s *scheduleStatus, info string) error {
+	fields := strings.Split(strings.TrimSpace(info), "|")
+	if len(fields) != 3 {
+		return fmt.Errorf("unexpected task info %q", info)
+	}
+
+	var err error
+	s.LastResult, err = strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid task result %q: %v", fields[1], err)
+	}
+
+	for _, t := range []struct {
+		field string
+		dst   **time.Time
+	}{
+		{fields[0], &s.LastRun},
+		{fields[2], &s.NextRun},
+	} {
+		if t.field == "" {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339Nano, t.field)
+		if err != nil {
+			// the offset is missing for times without a time zone
+			ts, err = time.ParseInLocation("2006-01-02T15:04:05.9999999", t.field, time.Local)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid time %q: %v", t.field, err)
+		}
+		*t.dst = &ts
+	}
+
+	if s.LastResult == windowsTaskNeverRun {
+		// the task scheduler reports a time in 1999 instead
+		s.LastRun = nil
+	}
+	return nil
+}
+
+func runScheduleStatus(ctx context.Context, opts scheduleTaskOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the schedule status command expects no arguments, only options - please see `restic help schedule status` for usage and flags")
+	}
+
+	p, err := opts.loadProfile()
+	if err != nil {
+		return err
+	}
+	expected, err := parseWindowsTask([]byte(windowsTask(p, time.Now())))
+	if err != nil {
+		return err
+	}
+
+	name := windowsTaskName(p)
+	out, err := runPowerShell(ctx, fmt.Sprintf("Export-ScheduledTask -TaskName '%s'", name))
+	if err != nil {
+		return errors.Fatalf("scheduled task %v is not installed, use `restic schedule install`: %v", name, err)
+	}
+	installed, err := parseWindowsTask(out)
+	if err != nil {
+		return err
+	}
+
+	out, err = runPowerShell(ctx, fmt.Sprintf("$i = Get-ScheduledTaskInfo -TaskName '%s'; '{0:o}|{1}|{2:o}' -f $i.LastRunTime, $i.LastTaskResult, $i.NextRunTime", name))
+	if err != nil {
+		return err
+	}
+
+	status := scheduleStatus{
+		Task:     name,
+		Schedule: installed.schedule(),
+		LogFile:  p.LogFile,
+		Problems: compareWindowsTasks(installed, expected),
+	}
+	err = parseWindowsTaskInfo(&status, string(out))
+	if err != nil {
+		return errors.Fatalf("unable to query scheduled task %v: %v", name, err)
+	}
+
+	if gopts.JSON {
+		err = json.NewEncoder(globalOptions.stdout).Encode(status)
+		if err != nil {
+			return err
+		}
+	} else {
+		Printf("task:       %v\n", status.Task)
+		Printf("schedule:   %v\n", status.Schedule)
+		if status.NextRun != nil {
+			Printf("next run:   %v\n", status.NextRun.Format(TimeFormat))
+		}
+		if status.LastRun != nil {
+			Printf("last run:   %v\n", status.LastRun.Format(TimeFormat))
+		}
+		Printf("result:     %v\n", status.lastResult())
+		Printf("log file:   %v\n", status.LogFile)
+		for _, problem := range status.Problems {
+			Warnf("the task %v\n", problem)
+		}
+	}
+
+	if len(status.Problems) > 0 {
+		return errors.Fatalf("scheduled task %v does not match the profile, use `restic schedule install` to update it", name)
+	}
+	if status.failed() {
+		warningsReported.Store(true)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestWindowsTaskDefinition(t *testing.T) {
+	p := testScheduleProfile()
+	p.Binary = `C:\restic\restic.exe`
+	p.LogFile = `C:\ProgramData\restic\logs\home.log`
+	task := windowsTask(p, time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local))
+
+	expected, err := parseWindowsTask([]byte(task))
+	rtest.OK(t, err)
+	rtest.Equals(t, "daily at 02:30", expected.schedule())
+	rtest.Equals(t, "cmd.exe", expected.Exec.Command)
+	rtest.Equals(t, 0, len(compareWindowsTasks(expected, expected)))
+
+	// a task created by hand, the schedule and the settings differ
+	installed, err := parseWindowsTask([]byte(`<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <Triggers>
+    <CalendarTrigger>
+      <StartBoundary>2024-03-01T03:00:00+01:00</StartBoundary>
+      <ScheduleByDay><DaysInterval>1</DaysInterval></ScheduleByDay>
+    </CalendarTrigger>
+  </Triggers>
+  <Principals>
+    <Principal id="Author">
+      <RunLevel>LeastPrivilege</RunLevel>
+    </Principal>
+  </Principals>
+  <Settings>
+    <StartWhenAvailable>true</StartWhenAvailable>
+  </Settings>
+  <Actions Context="Author">
+    <Exec>
+      <Command>CMD.EXE</Command>
+      <Arguments>` + xmlEscape(expected.Exec.Arguments) + `</Arguments>
+    </Exec>
+  </Actions>
+</Task>
+`))
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{
+		"runs daily at 03:00 instead of daily at 02:30",
+		"does not run with highest privileges, VSS snapshots will fail",
+		"does not start on battery power",
+		"stops when switching to battery power",
+		"does not wake the computer to run",
+	}, compareWindowsTasks(installed, expected))
+}
+
+func TestWindowsTaskSchedule(t *testing.T) {
+	p := testScheduleProfile()
+	for _, test := range []struct {
+		schedule, at string
+		result       string
+	}{
+		{"hourly", "", "hourly"},
+		{"daily", "", "daily at 00:00"},
+		{"weekly", "18:15", "weekly at 18:15"},
+	} {
+		p.Schedule, p.At = test.schedule, test.at
+		def, err := parseWindowsTask([]byte(windowsTask(p, time.Now())))
+		rtest.OK(t, err)
+		rtest.Equals(t, test.result, def.schedule())
+	}
+}
+
+func TestParseWindowsTaskInfo(t *testing.T) {
+	var s scheduleStatus
+	rtest.OK(t, parseWindowsTaskInfo(&s, "2024-03-01T02:30:00.0000000+01:00|1|2024-03-02T02:30:00.0000000+01:00\r\n"))
+	rtest.Equals(t, int64(1), s.LastResult)
+	rtest.Assert(t, s.failed(), "result 1 should be a failure")
+	rtest.Equals(t, "failed with 0x1", s.lastResult())
+	rtest.Equals(t, time.Date(2024, 3, 1, 1, 30, 0, 0, time.UTC), s.LastRun.UTC())
+	rtest.Equals(t, time.Date(2024, 3, 2, 1, 30, 0, 0, time.UTC), s.NextRun.UTC())
+
+	s = scheduleStatus{}
+	rtest.OK(t, parseWindowsTaskInfo(&s, "1999-11-30T00:00:00.0000000|267011|"))
+	rtest.Assert(t, !s.failed(), "never run task should not be a failure")
+	rtest.Equals(t, "never run", s.lastResult())
+	rtest.Assert(t, s.LastRun == nil && s.NextRun == nil, "unexpected times %v %v", s.LastRun, s.NextRun)
+
+	err := parseWindowsTaskInfo(&s, "foo")
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "unexpected task info"), "unexpected error %v", err)
+}
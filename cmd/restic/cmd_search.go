@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/restic/restic/internal/catalog"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var cmdSearch = &cobra.Command{
+	Use:   "search [flags] [PATTERN...]",
+	Short: "Search for files using the local file catalog",
+	Long: `
+The "search" command finds files and directories in all snapshots using the
+local file catalog maintained by "restic index-catalog". Unlike "find", it does
+not load any trees from the repository. The catalog contains an index of all
+distinct paths, so each path is only matched once, no matter in how many
+snapshots it is contained. Snapshots which were created after the catalog was
+last updated are not searched. Matches are sorted by path, and matches for the
+same path by the time of the snapshot.
+
+Patterns are matched against the full path of each item, using the same syntax
+as "find". A pattern without a slash, such as "*.docx", matches the name of
+the item in any directory. With "--content-id", only files with the given
+content are listed, which requires a catalog created using
+"index-catalog --content-ids".`,
+	Example: `restic search "*.docx" --host fileserver --until 2024-06
+restic search --long "/home/*/Documents/*.xlsx"
+restic search --content-id 2dd93e5c...
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSearch(cmd.Context(), searchOptions, globalOptions, args)
+	},
+}
+
+// SearchOptions bundles all options for the search command.
+type SearchOptions struct {
+	catalogOptions
+	restic.SnapshotFilter
+	ContentID       string
+	CaseInsensitive bool
+	ListLong        bool
+}
+
+var searchOptions SearchOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdSearch)
+
+	f := cmdSearch.Flags()
+	initCatalogOptions(f, &searchOptions.catalogOptions)
+	initMultiSnapshotFilter(f, &searchOptions.SnapshotFilter, true)
+	f.StringVar(&searchOptions.ContentID, "content-id", "", "only list files with the given content `id`")
+	f.BoolVarP(&searchOptions.CaseInsensitive, "ignore-case", "i", false, "ignore case for pattern")
+	f.BoolVarP(&searchOptions.ListLong, "long", "l", false, "use a long listing format showing type, size and modification time")
+}
+
+// searchMatch is a match printed by search in JSON mode.
+type searchMatch struct {
+	Snapshot string    `json:"snapshot"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	catalog.Entry
+}
+
+func runSearch(ctx context.Context, opts SearchOptions, gopts GlobalOptions, args []string) error {
+	if len(args) == 0 && opts.ContentID == "" {
+		return errors.Fatal("specify a pattern or --content-id")
+	}
+
+	q := catalog.Query{
+		Patterns:        args,
+		CaseInsensitive: opts.CaseInsensitive,
+		Snapshots:       opts.SnapshotFilter,
+	}
+	if opts.ContentID != "" {
+		id, err := restic.ParseID(opts.ContentID)
+		if err != nil {
+			return errors.Fatalf("invalid content ID %q", opts.ContentID)
+		}
+		q.ContentID = &id
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c, err := opts.openCatalog(gopts, repo)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := c.Snapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return errors.Fatal("the catalog is empty, create it using `restic index-catalog`")
+	}
+	known := restic.NewIDSet()
+	withoutContentIDs := 0
+	for _, sn := range snapshots {
+		known.Insert(sn.ID())
+		if !sn.ContentIDs {
+			withoutContentIDs++
+		}
+	}
+	if q.ContentID != nil && withoutContentIDs > 0 {
+		Warnf("%d snapshots were added to the catalog without content IDs and are not searched, run `restic index-catalog --content-ids`\n", withoutContentIDs)
+	}
+	missing := 0
+	err = repo.List(ctx, restic.SnapshotFile, func(id restic.ID, _ int64) error {
+		if !known.Has(id) {
+			missing++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		Warnf("%d snapshots are missing in the catalog, run `restic index-catalog` to add them\n", missing)
+	}
+
+	enc := json.NewEncoder(globalOptions.stdout)
+	matches := 0
+	err = c.Search(ctx, q, func(sn catalog.Snapshot, e catalog.Entry) error {
+		matches++
+		id := sn.ID()
+		switch {
+		case gopts.JSON:
+			return enc.Encode(searchMatch{Snapshot: id.String(), Time: sn.Time, Hostname: sn.Hostname, Entry: e})
+		case opts.ListLong:
+			size := ""
+			if e.Type == restic.NodeTypeFile {
+				size = ui.FormatBytes(e.Size)
+			}
+			Printf("%v %v %-12v %-6v %12v %v %v\n", id.Str(), sn.Time.Local().Format(TimeFormat), sn.Hostname,
+				e.Type, size, e.ModTime.Local().Format(TimeFormat), e.Path)
+		default:
+			Printf("%v %v %v %v\n", id.Str(), sn.Time.Local().Format(TimeFormat), sn.Hostname, e.Path)
+		}
+		return nil
+	})
+	if errors.Is(err, catalog.ErrIndexOutdated) {
+		return errors.Fatal("the catalog index is outdated, update it using `restic index-catalog`")
+	}
+	if err != nil {
+		return err
+	}
+
+	if !gopts.JSON {
+		Verbosef("found %d matches\n", matches)
+	}
+	return nil
+}
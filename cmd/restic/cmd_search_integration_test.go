@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunSearch(t testing.TB, gopts GlobalOptions, opts SearchOptions, args ...string) []searchMatch {
+	gopts.JSON = true
+	buf, err := withCaptureStdout(func() error {
+		return runSearch(context.TODO(), opts, gopts, args)
+	})
+	rtest.OK(t, err)
+
+	var matches []searchMatch
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var m searchMatch
+		rtest.OK(t, dec.Decode(&m))
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+func TestSearch(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	datadir := filepath.Join(env.testdata, "0", "0", "9")
+	testRunBackup(t, "", []string{datadir}, BackupOptions{}, env.gopts)
+
+	catalogOpts := catalogOptions{CatalogDir: filepath.Join(env.base, "catalog")}
+	err := runSearch(context.TODO(), SearchOptions{catalogOptions: catalogOpts}, env.gopts, []string{"*"})
+	rtest.Assert(t, err != nil, "expected error for missing catalog")
+
+	rtest.OK(t, runIndexCatalog(context.TODO(), IndexCatalogOptions{catalogOptions: catalogOpts, ContentIDs: true}, env.gopts, nil))
+
+	entries, err := os.ReadDir(datadir)
+	rtest.OK(t, err)
+	var name string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			name = entry.Name()
+			break
+		}
+	}
+	rtest.Assert(t, name != "", "no file found in %v", datadir)
+
+	opts := SearchOptions{catalogOptions: catalogOpts, CaseInsensitive: true}
+	filename := filepath.ToSlash(filepath.Join(datadir, name))
+	matches := testRunSearch(t, env.gopts, opts, strings.ToUpper(filename))
+	rtest.Equals(t, 1, len(matches))
+	rtest.Equals(t, filename, matches[0].Path)
+	rtest.Assert(t, matches[0].ContentID != nil, "match has no content ID")
+
+	opts = SearchOptions{catalogOptions: catalogOpts, ContentID: matches[0].ContentID.String()}
+	byContent := testRunSearch(t, env.gopts, opts)
+	rtest.Assert(t, len(byContent) >= 1, "file not found by content ID")
+
+	until, err := parseTime("2000-01")
+	rtest.OK(t, err)
+	opts = SearchOptions{catalogOptions: catalogOpts, SnapshotFilter: restic.SnapshotFilter{Until: until}}
+	rtest.Equals(t, 0, len(testRunSearch(t, env.gopts, opts, filename)))
+
+	// forgotten snapshots are removed from the catalog
+	testRunForget(t, env.gopts, ForgetOptions{}, testListSnapshots(t, env.gopts, 1)[0].String())
+	rtest.OK(t, runIndexCatalog(context.TODO(), IndexCatalogOptions{catalogOptions: catalogOpts}, env.gopts, nil))
+	opts = SearchOptions{catalogOptions: catalogOpts}
+	err = runSearch(context.TODO(), opts, env.gopts, []string{filename})
+	rtest.Assert(t, err != nil, "expected error for empty catalog")
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdServe = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve snapshots or repositories to other programs",
+	Long: `
+The "serve" command makes the files of a snapshot available to other programs
+via a network protocol, without restoring them first, or acts as a server for
+repositories of other restic instances.
+	`,
+	DisableAutoGenTag: true,
+	GroupID:           cmdGroupDefault,
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdServe)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/access"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/nfsserver"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdServeNFS = &cobra.Command{
+	Use:   "nfs [flags] [snapshotID ...]",
+	Short: "Serve snapshots via NFS",
+	Long: `
+The "serve nfs" command exports snapshots via an embedded NFSv3 server. Unlike
+the "mount" command, this works without FUSE or WinFsp on the client: any
+machine with an NFS client, like appliances or ESXi hosts, can browse the
+backups using a plain mount. The export is read-only.
+
+The snapshots given as arguments are exported, by default all snapshots which
+match the filter options. The root directory of the export contains one
+directory per snapshot, named after the time of the snapshot formatted using
+--time-template, and a symlink "latest" to the newest snapshot. The list of
+snapshots is read when the command starts.
+
+The server handles both the MOUNT and NFS protocol on the same port and does
+not register with a portmapper, so clients must specify the port. On Linux, the
+export can be mounted as follows:
+
+    mount -t nfs -o port=2049,mountport=2049,nfsvers=3,tcp,nolock host:/ /mnt
+
+Clients are not authenticated, anyone who can connect can read the snapshots.
+Therefore the server listens on localhost by default. To restrict which files
+each client can access based on its address, use --access-policy, see the
+documentation for the format of the policy file.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runServeNFS(cmd.Context(), serveNFSOptions, globalOptions, args)
+	},
+}
+
+// ServeNFSOptions collects all options for the serve nfs command.
+type ServeNFSOptions struct {
+	restic.SnapshotFilter
+	Listen       string
+	TimeTemplate string
+	AccessPolicy string
+}
+
+var serveNFSOptions ServeNFSOptions
+
+func init() {
+	cmdServe.AddCommand(cmdServeNFS)
+
+	flags := cmdServeNFS.Flags()
+	initMultiSnapshotFilter(flags, &serveNFSOptions.SnapshotFilter, true)
+	flags.StringVar(&serveNFSOptions.Listen, "listen", "localhost:2049", "listen on `address`")
+	flags.StringVar(&serveNFSOptions.TimeTemplate, "time-template", time.RFC3339, "set `template` to use for the names of snapshot directories")
+	flags.StringVar(&serveNFSOptions.AccessPolicy, "access-policy", "", "restrict access using the policy in `file`")
+}
+
+func runServeNFS(ctx context.Context, opts ServeNFSOptions, gopts GlobalOptions, args []string) error {
+	if opts.TimeTemplate == "" {
+		return errors.Fatal("time template string cannot be empty")
+	}
+	if strings.Contains(opts.TimeTemplate, "/") {
+		return errors.Fatal("time template string cannot contain '/'")
+	}
+
+	var policy *access.Policy
+	if opts.AccessPolicy != "" {
+		var err error
+		policy, err = access.Load(opts.AccessPolicy)
+		if err != nil {
+			return errors.Fatalf("unable to load access policy: %v", err)
+		}
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var snapshots restic.Snapshots
+	for sn := range FindFilteredSnapshots(ctx, repo, repo, &opts.SnapshotFilter, args) {
+		snapshots = append(snapshots, sn)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(snapshots) == 0 {
+		return errors.Fatal("no matching snapshots found")
+	}
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	err = repo.LoadIndex(ctx, bar)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return errors.Fatalf("unable to listen: %v", err)
+	}
+
+	Printf("Now serving %d snapshots via NFS at %v\n", len(snapshots), listener.Addr())
+	if policy == nil {
+		Printf("Requests are not authenticated, anyone who can connect can read the snapshots.\n")
+	}
+	Printf("When finished, quit with Ctrl-c here.\n")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- nfsserver.Serve(listener, nfsserver.New(ctx, repo, snapshots, opts.TimeTemplate), policy)
+	}()
+
+	select {
+	case <-ctx.Done():
+		debug.Log("shutting down NFS server")
+		_ = listener.Close()
+		return ErrOK
+	case err := <-done:
+		return err
+	}
+}
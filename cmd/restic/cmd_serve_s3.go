@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/restic/restic/internal/access"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/s3gateway"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdServeS3 = &cobra.Command{
+	Use:   "s3 [flags]",
+	Short: "Serve a snapshot as a read-only S3 bucket",
+	Long: `
+The "serve s3" command serves the files of a snapshot as a read-only bucket via
+the S3 API. S3 clients can list and download the files, which allows tools for
+data analysis or the validation of backups to read them without a restore.
+
+The snapshot is selected using --snapshot, which defaults to "latest". To serve
+a subfolder of the snapshot, use the "snapshotID:subfolder" syntax. The key of
+each file is its path within the snapshot without the leading slash. Only
+regular files are served, symlinks and other special files are omitted.
+
+Clients must use path-style requests and sign them using AWS signature
+version 4, including the host header. Set the credentials using the
+environment variables RESTIC_SERVE_ACCESS_KEY_ID and
+RESTIC_SERVE_SECRET_ACCESS_KEY. The key ID is used as the name of the user.
+To serve multiple users, pass a file to --credentials-file which contains one
+line per user with the access key ID, the secret access key, the name of the
+user and optionally a comma-separated list of groups. To serve the files
+without authentication, pass --no-auth.
+
+Which files each user can list and download can be restricted using
+--access-policy, see the documentation for the format of the policy file.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return runServeS3(cmd.Context(), serveS3Options, globalOptions)
+	},
+}
+
+// ServeS3Options collects all options for the serve s3 command.
+type ServeS3Options struct {
+	restic.SnapshotFilter
+	Snapshot        string
+	Listen          string
+	Bucket          string
+	CredentialsFile string
+	AccessPolicy    string
+	NoAuth          bool
+}
+
+var serveS3Options ServeS3Options
+
+func init() {
+	cmdServe.AddCommand(cmdServeS3)
+
+	flags := cmdServeS3.Flags()
+	initSingleSnapshotFilter(flags, &serveS3Options.SnapshotFilter)
+	flags.StringVar(&serveS3Options.Snapshot, "snapshot", "latest", "serve the snapshot with `ID`")
+	flags.StringVar(&serveS3Options.Listen, "listen", "localhost:8000", "listen on `address`")
+	flags.StringVar(&serveS3Options.Bucket, "bucket", "restic", "serve the snapshot as bucket `name`")
+	flags.StringVar(&serveS3Options.CredentialsFile, "credentials-file", "", "read the credentials of the users from `file`")
+	flags.StringVar(&serveS3Options.AccessPolicy, "access-policy", "", "restrict access using the policy in `file`")
+	flags.BoolVar(&serveS3Options.NoAuth, "no-auth", false, "do not authenticate clients")
+}
+
+func runServeS3(ctx context.Context, opts ServeS3Options, gopts GlobalOptions) error {
+	if opts.Bucket == "" {
+		return errors.Fatal("the bucket name must not be empty")
+	}
+
+	cfg := s3gateway.Config{
+		Bucket:      opts.Bucket,
+		Credentials: make(map[string]s3gateway.Credential),
+	}
+	if opts.CredentialsFile != "" {
+		creds, err := s3gateway.LoadCredentials(opts.CredentialsFile)
+		if err != nil {
+			return errors.Fatalf("unable to load credentials: %v", err)
+		}
+		cfg.Credentials = creds
+	}
+
+	keyID, secret := os.Getenv("RESTIC_SERVE_ACCESS_KEY_ID"), os.Getenv("RESTIC_SERVE_SECRET_ACCESS_KEY")
+	if (keyID == "") != (secret == "") {
+		return errors.Fatal("RESTIC_SERVE_ACCESS_KEY_ID and RESTIC_SERVE_SECRET_ACCESS_KEY must be set together")
+	}
+	if keyID != "" {
+		cfg.Credentials[keyID] = s3gateway.Credential{
+			SecretAccessKey: secret,
+			Identity:        access.Identity{User: keyID},
+		}
+	}
+
+	switch {
+	case len(cfg.Credentials) > 0 && opts.NoAuth:
+		return errors.Fatal("--no-auth cannot be combined with --credentials-file or RESTIC_SERVE_ACCESS_KEY_ID")
+	case len(cfg.Credentials) == 0 && !opts.NoAuth:
+		return errors.Fatal("please configure credentials using --credentials-file or RESTIC_SERVE_ACCESS_KEY_ID and RESTIC_SERVE_SECRET_ACCESS_KEY, or pass --no-auth")
+	}
+
+	if opts.AccessPolicy != "" {
+		policy, err := access.Load(opts.AccessPolicy)
+		if err != nil {
+			return errors.Fatalf("unable to load access policy: %v", err)
+		}
+		cfg.Policy = policy
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sn, subfolder, err := opts.SnapshotFilter.FindLatest(ctx, repo, repo, opts.Snapshot)
+	if err != nil {
+		return errors.Fatalf("failed to find snapshot: %v", err)
+	}
+	cfg.Path = subfolder
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	err = repo.LoadIndex(ctx, bar)
+	if err != nil {
+		return err
+	}
+
+	tree, err := restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return errors.Fatalf("unable to listen: %v", err)
+	}
+
+	srv := &http.Server{
+		Handler:           s3gateway.New(repo, *tree, sn.Time, cfg),
+		ReadHeaderTimeout: time.Minute,
+	}
+
+	Printf("Now serving snapshot %v as bucket %q at http://%v\n", sn.ID().Str(), opts.Bucket, listener.Addr())
+	if opts.NoAuth {
+		Printf("Requests are not authenticated, anyone who can connect can read the files.\n")
+	}
+	Printf("When finished, quit with Ctrl-c here.\n")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+		debug.Log("shutting down S3 gateway")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+		return ErrOK
+	case err := <-done:
+		return err
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"container/heap"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/table"
@@ -20,6 +22,15 @@ var cmdSnapshots = &cobra.Command{
 	Long: `
 The "snapshots" command lists all snapshots stored in the repository.
 
+The snapshots can be filtered by host, tag, path and time using --host, --tag,
+--path, --since and --until. The filters are applied while the snapshots are loaded, so only
+matching snapshots are kept in memory. Use --limit and --offset to page
+through the newest matching snapshots in large repositories.
+
+With --json and without --group-by, --latest, --limit or --offset, each
+snapshot is printed as soon as it is loaded, in no particular order, and no
+snapshots are kept in memory.
+
 EXIT STATUS
 ===========
 
@@ -43,6 +54,8 @@ type SnapshotOptions struct {
 	Last    bool // This option should be removed in favour of Latest.
 	Latest  int
 	GroupBy restic.SnapshotGroupByOptions
+	Limit   int
+	Offset  int
 }
 
 var snapshotOptions SnapshotOptions
@@ -61,22 +74,46 @@ func init() {
 	}
 	f.IntVar(&snapshotOptions.Latest, "latest", 0, "only show the last `n` snapshots for each host and path")
 	f.VarP(&snapshotOptions.GroupBy, "group-by", "g", "`group` snapshots by host, paths and/or tags, separated by comma")
+	f.IntVar(&snapshotOptions.Limit, "limit", 0, "only show the `n` newest snapshots which match the filters (default: all)")
+	f.IntVar(&snapshotOptions.Offset, "offset", 0, "skip the `n` newest snapshots which match the filters")
 }
 
 func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions, args []string) error {
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return errors.Fatal("--limit and --offset must not be negative")
+	}
+	if (opts.Limit > 0 || opts.Offset > 0) && (opts.Last || opts.Latest > 0) {
+		return errors.Fatal("--limit and --offset cannot be combined with --latest")
+	}
 	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
 	if err != nil {
 		return err
 	}
 	defer unlock()
 
-	var snapshots restic.Snapshots
+	var stream *snapshotJSONStream
+	if opts.streamable(gopts) {
+		stream = newSnapshotJSONStream(globalOptions.stdout)
+	}
+
+	page := newSnapshotPage(opts.Offset, opts.Limit)
 	for sn := range FindFilteredSnapshots(ctx, repo, repo, &opts.SnapshotFilter, args) {
-		snapshots = append(snapshots, sn)
+		if stream != nil {
+			stream.Add(sn)
+			continue
+		}
+		page.Add(sn)
+	}
+	if stream != nil {
+		if err := stream.Close(); err != nil {
+			Warnf("error printing snapshots: %v\n", err)
+		}
+		return ctx.Err()
 	}
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
+	snapshots := page.Snapshots()
 	snapshotGroups, grouped, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
 	if err != nil {
 		return err
@@ -124,6 +161,124 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions
 	return nil
 }
 
+// streamable reports whether the snapshots can be printed while they are
+// loaded. The text table needs all snapshots to determine the column widths,
+// grouping, --latest and paging need all snapshots to select them.
+func (opts SnapshotOptions) streamable(gopts GlobalOptions) bool {
+	return gopts.JSON && opts.GroupBy == (restic.SnapshotGroupByOptions{}) &&
+		!opts.Last && opts.Latest == 0 && opts.Limit == 0 && opts.Offset == 0
+}
+
+// snapshotJSONStream prints snapshots as the elements of a JSON array, in the
+// same format as printSnapshotGroupJSON without grouping.
+type snapshotJSONStream struct {
+	w     io.Writer
+	count int
+	err   error
+}
+
+func newSnapshotJSONStream(w io.Writer) *snapshotJSONStream {
+	return &snapshotJSONStream{w: w}
+}
+
+func (s *snapshotJSONStream) write(buf []byte) {
+	if s.err == nil {
+		_, s.err = s.w.Write(buf)
+	}
+}
+
+// Add prints sn.
+func (s *snapshotJSONStream) Add(sn *restic.Snapshot) {
+	if s.err != nil {
+		return
+	}
+	buf, err := json.Marshal(Snapshot{
+		Snapshot: sn,
+		ID:       sn.ID(),
+		ShortID:  sn.ID().Str(),
+	})
+	if err != nil {
+		s.err = err
+		return
+	}
+	if s.count == 0 {
+		s.write([]byte("["))
+	} else {
+		s.write([]byte(","))
+	}
+	s.write(buf)
+	s.count++
+}
+
+// Close terminates the JSON array.
+func (s *snapshotJSONStream) Close() error {
+	if s.count == 0 {
+		s.write([]byte("["))
+	}
+	s.write([]byte("]\n"))
+	return s.err
+}
+
+// snapshotPage collects the newest snapshots after skipping offset snapshots.
+// If limit is positive, at most offset+limit snapshots are kept in memory
+// while the snapshots are loaded.
+type snapshotPage struct {
+	offset, limit int
+	list          snapshotHeap
+}
+
+func newSnapshotPage(offset, limit int) *snapshotPage {
+	return &snapshotPage{offset: offset, limit: limit}
+}
+
+// Add adds sn to the page, possibly discarding the oldest snapshot.
+func (p *snapshotPage) Add(sn *restic.Snapshot) {
+	heap.Push(&p.list, sn)
+	if p.limit > 0 && p.list.Len() > p.offset+p.limit {
+		heap.Pop(&p.list)
+	}
+}
+
+// Snapshots returns the snapshots of the page.
+func (p *snapshotPage) Snapshots() restic.Snapshots {
+	list := p.list
+	// newest snapshots first
+	sort.Slice(list, func(i, j int) bool {
+		return list.Less(j, i)
+	})
+	if p.offset >= len(list) {
+		return nil
+	}
+	return restic.Snapshots(list[p.offset:])
+}
+
+// snapshotHeap is a min-heap which keeps the oldest snapshot on top.
+// Snapshots with the same timestamp are ordered by their ID, such that pages
+// do not overlap.
+type snapshotHeap restic.Snapshots
+
+func (h snapshotHeap) Len() int      { return len(h) }
+func (h snapshotHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h snapshotHeap) Less(i, j int) bool {
+	if h[i].Time.Equal(h[j].Time) {
+		return h[i].ID().String() < h[j].ID().String()
+	}
+	return h[i].Time.Before(h[j].Time)
+}
+
+func (h *snapshotHeap) Push(x any) {
+	*h = append(*h, x.(*restic.Snapshot))
+}
+
+func (h *snapshotHeap) Pop() any {
+	old := *h
+	sn := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return sn
+}
+
 // filterLastSnapshotsKey is used by FilterLastSnapshots.
 type filterLastSnapshotsKey struct {
 	Hostname    string
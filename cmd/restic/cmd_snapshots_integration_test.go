@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"sort"
 	"testing"
 
 	"github.com/restic/restic/internal/restic"
@@ -10,23 +11,62 @@ import (
 )
 
 func testRunSnapshots(t testing.TB, gopts GlobalOptions) (newest *Snapshot, snapmap map[restic.ID]Snapshot) {
+	snapshots := testRunSnapshotsOpts(t, SnapshotOptions{}, gopts)
+
+	snapmap = make(map[restic.ID]Snapshot, len(snapshots))
+	for _, sn := range snapshots {
+		snapmap[*sn.ID] = sn
+		if newest == nil || sn.Time.After(newest.Time) {
+			newest = &sn
+		}
+	}
+	return
+}
+
+func testRunSnapshotsOpts(t testing.TB, opts SnapshotOptions, gopts GlobalOptions) []Snapshot {
 	buf, err := withCaptureStdout(func() error {
 		gopts.JSON = true
-
-		opts := SnapshotOptions{}
 		return runSnapshots(context.TODO(), opts, gopts, []string{})
 	})
 	rtest.OK(t, err)
 
 	snapshots := []Snapshot{}
 	rtest.OK(t, json.Unmarshal(buf.Bytes(), &snapshots))
+	return snapshots
+}
 
-	snapmap = make(map[restic.ID]Snapshot, len(snapshots))
-	for _, sn := range snapshots {
-		snapmap[*sn.ID] = sn
-		if newest == nil || sn.Time.After(newest.Time) {
-			newest = &sn
+func TestSnapshotsTimeFilterAndPage(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	times := []string{"2024-01-01 10:00:00", "2024-01-02 10:00:00", "2024-01-03 10:00:00", "2024-01-04 10:00:00"}
+	for _, ts := range times {
+		testRunBackup(t, "", []string{env.testdata}, BackupOptions{TimeStamp: ts}, env.gopts)
+	}
+
+	timesOf := func(snapshots []Snapshot) []string {
+		var result []string
+		for _, sn := range snapshots {
+			result = append(result, sn.Time.Local().Format(TimeFormat))
 		}
+		sort.Strings(result)
+		return result
 	}
-	return
+
+	since, err := parseTime("2024-01-02")
+	rtest.OK(t, err)
+	until, err := parseTime("2024-01-03 12:00:00")
+	rtest.OK(t, err)
+	snapshots := testRunSnapshotsOpts(t, SnapshotOptions{SnapshotFilter: restic.SnapshotFilter{Since: since, Until: until}}, env.gopts)
+	rtest.Equals(t, times[1:3], timesOf(snapshots))
+
+	snapshots = testRunSnapshotsOpts(t, SnapshotOptions{Limit: 2, Offset: 1}, env.gopts)
+	rtest.Equals(t, times[1:3], timesOf(snapshots))
+
+	snapshots = testRunSnapshotsOpts(t, SnapshotOptions{Offset: 3}, env.gopts)
+	rtest.Equals(t, times[:1], timesOf(snapshots))
+
+	snapshots = testRunSnapshotsOpts(t, SnapshotOptions{SnapshotFilter: restic.SnapshotFilter{Since: since}, Limit: 1}, env.gopts)
+	rtest.Equals(t, times[3:], timesOf(snapshots))
 }
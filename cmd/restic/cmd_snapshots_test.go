@@ -3,7 +3,9 @@ package main
 import (
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -17,3 +19,28 @@ func TestEmptySnapshotGroupJSON(t *testing.T) {
 		rtest.Equals(t, "[]", strings.TrimSpace(w.String()))
 	}
 }
+
+func TestSnapshotJSONStream(t *testing.T) {
+	var w strings.Builder
+	rtest.OK(t, newSnapshotJSONStream(&w).Close())
+	rtest.Equals(t, "[]", strings.TrimSpace(w.String()))
+
+	var list restic.Snapshots
+	for i := 0; i < 3; i++ {
+		sn, err := restic.NewSnapshot([]string{"/home"}, nil, "host", time.Unix(int64(i), 0))
+		rtest.OK(t, err)
+		list = append(list, sn)
+	}
+
+	w.Reset()
+	stream := newSnapshotJSONStream(&w)
+	for _, sn := range list {
+		stream.Add(sn)
+	}
+	rtest.OK(t, stream.Close())
+
+	// the output matches the ungrouped output of printSnapshotGroupJSON
+	var expected strings.Builder
+	rtest.OK(t, printSnapshotGroupJSON(&expected, map[string]restic.Snapshots{"": list}, false))
+	rtest.Equals(t, expected.String(), w.String())
+}
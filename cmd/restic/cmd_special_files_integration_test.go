@@ -0,0 +1,79 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func lsContains(items []string, name string) bool {
+	for _, item := range items {
+		if strings.HasSuffix(item, "/"+name) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBackupRestoreSpecialFiles(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "file"), []byte("content"), 0600))
+	rtest.OK(t, syscall.Mkfifo(filepath.Join(env.testdata, "fifo"), 0600))
+	rtest.OK(t, syscall.Mknod(filepath.Join(env.testdata, "socket"), syscall.S_IFSOCK|0600, 0))
+
+	for _, test := range []struct {
+		policy       string
+		fifo, socket bool
+	}{
+		{"", true, false},
+		{"skip", false, false},
+		{"store", true, true},
+	} {
+		testRunBackup(t, env.testdata, []string{"."}, BackupOptions{SpecialFiles: test.policy}, env.gopts)
+		items := testRunLs(t, env.gopts, "latest")
+		rtest.Assert(t, lsContains(items, "file"), "policy %q: file missing", test.policy)
+		rtest.Assert(t, lsContains(items, "fifo") == test.fifo, "policy %q: wrong fifo in snapshot", test.policy)
+		rtest.Assert(t, lsContains(items, "socket") == test.socket, "policy %q: wrong socket in snapshot", test.policy)
+	}
+
+	err := testRunBackupAssumeFailure(t, env.testdata, []string{"."}, BackupOptions{SpecialFiles: "fail"}, env.gopts)
+	rtest.Assert(t, err != nil, "backup with --special-files=fail succeeded")
+	rtest.Assert(t, strings.Contains(err.Error(), restic.ErrSpecialFile.Error()), "unexpected error %v", err)
+
+	// the latest snapshot contains all special files
+	for _, test := range []struct {
+		policy       string
+		fifo, socket os.FileMode
+	}{
+		{"", os.ModeNamedPipe, 0},
+		{"skip", 0, 0},
+		{"store", os.ModeNamedPipe, os.ModeSocket},
+	} {
+		target := filepath.Join(env.base, "restore-"+test.policy)
+		rtest.OK(t, testRunRestoreAssumeFailure("latest", RestoreOptions{Target: target, SpecialFiles: test.policy}, env.gopts))
+
+		for name, mode := range map[string]os.FileMode{"fifo": test.fifo, "socket": test.socket} {
+			fi, err := os.Lstat(filepath.Join(target, name))
+			if mode == 0 {
+				rtest.Assert(t, os.IsNotExist(err), "policy %q: %v was restored", test.policy, name)
+				continue
+			}
+			rtest.OK(t, err)
+			rtest.Assert(t, fi.Mode().Type() == mode, "policy %q: wrong type %v of %v", test.policy, fi.Mode().Type(), name)
+		}
+	}
+
+	err = testRunRestoreAssumeFailure("latest", RestoreOptions{Target: filepath.Join(env.base, "restore-fail"), SpecialFiles: "fail"}, env.gopts)
+	rtest.Assert(t, err != nil, "restore with --special-files=fail succeeded")
+}
@@ -5,11 +5,17 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/restorer"
@@ -43,6 +49,26 @@ The modes are:
 * raw-data: Counts the size of blobs in the repository, regardless of
   how many files reference them.
 * blobs-per-file: A combination of files-by-contents and raw-data.
+* history: Lists the statistics recorded by "backup" in each snapshot, such
+  as the number of files, their size, the amount of new data and how long the
+  backup took. This mode does not walk any trees and returns immediately.
+  Snapshots created before restic 0.17.0 contain no statistics.
+
+In restore-size mode, --link-mode selects how symlinks, junctions and mount
+points are accounted:
+
+* file: (default) Counts them as files of size zero, the contents of mounted
+  file systems are included.
+* separate: Counts them separately instead of as files. The size of the
+  contents of mounted file systems is included and also reported separately.
+* one-file-system: Like separate, but excludes the contents of mounted file
+  systems, like "du -x".
+
+With --shared-with, the command compares the latest snapshot selected by the
+snapshot filter with the latest snapshot of another host. It reports how many
+blobs and bytes of the first snapshot are also referenced by the snapshot of
+the other host, like raw-data mode does for a single snapshot. If no --host is
+given, the snapshot of the local host is compared.
 
 Refer to the online manual for more details about each mode.
 
@@ -66,6 +92,10 @@ Exit status is 12 if the password is incorrect.
 type StatsOptions struct {
 	// the mode of counting to perform (see consts for available modes)
 	countMode string
+	// how links and mount points are accounted in restore-size mode
+	linkMode string
+	// host whose latest snapshot is compared with the selected snapshot
+	sharedWith string
 
 	restic.SnapshotFilter
 }
@@ -81,11 +111,18 @@ func must(err error) {
 func init() {
 	cmdRoot.AddCommand(cmdStats)
 	f := cmdStats.Flags()
-	f.StringVar(&statsOptions.countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file or raw-data")
+	f.StringVar(&statsOptions.countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file, raw-data or history")
 	must(cmdStats.RegisterFlagCompletionFunc("mode", func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
-		return []string{countModeRestoreSize, countModeUniqueFilesByContents, countModeBlobsPerFile, countModeRawData}, cobra.ShellCompDirectiveDefault
+		return []string{countModeRestoreSize, countModeUniqueFilesByContents, countModeBlobsPerFile, countModeRawData, countModeHistory}, cobra.ShellCompDirectiveDefault
 	}))
 
+	f.StringVar(&statsOptions.linkMode, "link-mode", linkModeFile, "accounting of symlinks, junctions and mount points in restore-size mode: file (default), separate or one-file-system")
+	must(cmdStats.RegisterFlagCompletionFunc("link-mode", func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return []string{linkModeFile, linkModeSeparate, linkModeOneFileSystem}, cobra.ShellCompDirectiveDefault
+	}))
+
+	f.StringVar(&statsOptions.sharedWith, "shared-with", "", "show the blobs the latest snapshot shares with the latest snapshot of `host`")
+
 	initMultiSnapshotFilter(f, &statsOptions.SnapshotFilter, true)
 }
 
@@ -105,6 +142,11 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 	if err != nil {
 		return err
 	}
+	if opts.countMode == countModeHistory {
+		// the statistics are stored in the snapshots, the index is not needed
+		return statsPrintHistory(ctx, snapshotLister, repo, opts, gopts, args)
+	}
+
 	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
 	if err = repo.LoadIndex(ctx, bar); err != nil {
 		return err
@@ -113,6 +155,9 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 	if opts.countMode == countModeDebug {
 		return statsDebug(ctx, repo)
 	}
+	if opts.sharedWith != "" {
+		return statsPrintShared(ctx, snapshotLister, repo, opts, gopts, args)
+	}
 
 	if !gopts.JSON {
 		Printf("scanning...\n")
@@ -125,6 +170,9 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 		blobs:          restic.NewBlobSet(),
 		SnapshotsCount: 0,
 	}
+	if opts.linkMode == linkModeSeparate || opts.linkMode == linkModeOneFileSystem {
+		stats.Links = &statsLinks{}
+	}
 
 	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, &opts.SnapshotFilter, args) {
 		err = statsWalkSnapshot(ctx, sn, repo, opts, stats)
@@ -162,6 +210,11 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 		}
 	}
 
+	if capacity := repoCapacity(ctx, repo); capacity != nil {
+		stats.FreeSpace = capacity.Free
+		stats.TotalSpace = capacity.Total
+	}
+
 	if gopts.JSON {
 		err = json.NewEncoder(globalOptions.stdout).Encode(stats)
 		if err != nil {
@@ -182,6 +235,18 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 		Printf(" Total Uncompressed Size:  %-5s\n", ui.FormatBytes(stats.TotalUncompressedSize))
 	}
 	Printf("              Total Size:  %-5s\n", ui.FormatBytes(stats.TotalSize))
+	if stats.Links != nil {
+		Printf("                Symlinks:  %d\n", stats.Links.Symlinks)
+		Printf("               Junctions:  %d\n", stats.Links.Junctions)
+		Printf("            Mount Points:  %d\n", stats.Links.MountPoints)
+		if stats.Links.MountPoints > 0 {
+			verb := "included"
+			if opts.linkMode == linkModeOneFileSystem {
+				verb = "excluded"
+			}
+			Printf("       Size Below Mounts:  %-5s (%s)\n", ui.FormatBytes(stats.Links.MountedSize), verb)
+		}
+	}
 	if stats.CompressionProgress > 0 {
 		Printf("    Compression Progress:  %.2f%%\n", stats.CompressionProgress)
 	}
@@ -191,6 +256,9 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 	if stats.CompressionSpaceSaving > 0 {
 		Printf("Compression Space Saving:  %.2f%%\n", stats.CompressionSpaceSaving)
 	}
+	if stats.TotalSpace > 0 {
+		Printf("              Free Space:  %s\n", formatCapacity(backend.Capacity{Free: stats.FreeSpace, Total: stats.TotalSpace}))
+	}
 
 	return nil
 }
@@ -205,12 +273,13 @@ func statsWalkSnapshot(ctx context.Context, snapshot *restic.Snapshot, repo rest
 	if opts.countMode == countModeRawData {
 		// count just the sizes of unique blobs; we don't need to walk the tree
 		// ourselves in this case, since a nifty function does it for us
-		return restic.FindUsedBlobs(ctx, repo, restic.IDs{*snapshot.Tree}, stats.blobs, nil)
+		return restic.FindUsedBlobs(ctx, repo, snapshot.TreeIDs(), stats.blobs, nil)
 	}
 
 	hardLinkIndex := restorer.NewHardlinkIndex[struct{}]()
+	links := newLinkTracker()
 	err := walker.Walk(ctx, repo, *snapshot.Tree, walker.WalkVisitor{
-		ProcessNode: statsWalkTree(repo, opts, stats, hardLinkIndex),
+		ProcessNode: statsWalkTree(repo, opts, stats, hardLinkIndex, links),
 	})
 	if err != nil {
 		return fmt.Errorf("walking tree %s: %v", *snapshot.Tree, err)
@@ -219,7 +288,10 @@ func statsWalkSnapshot(ctx context.Context, snapshot *restic.Snapshot, repo rest
 	return nil
 }
 
-func statsWalkTree(repo restic.Loader, opts StatsOptions, stats *statsContainer, hardLinkIndex *restorer.HardlinkIndex[struct{}]) walker.WalkFunc {
+func statsWalkTree(repo restic.Loader, opts StatsOptions, stats *statsContainer, hardLinkIndex *restorer.HardlinkIndex[struct{}], links *linkTracker) walker.WalkFunc {
+	// mounted contains the directories on a mounted file system
+	mounted := make(map[string]struct{})
+
 	return func(parentTreeID restic.ID, npath string, node *restic.Node, nodeErr error) error {
 		if nodeErr != nil {
 			return nodeErr
@@ -228,6 +300,35 @@ func statsWalkTree(repo restic.Loader, opts StatsOptions, stats *statsContainer,
 			return nil
 		}
 
+		if stats.Links != nil {
+			kind := links.kind(npath, node)
+			links.enter(npath, node)
+			_, isMounted := mounted[path.Dir(npath)]
+			switch kind {
+			case linkKindSymlink:
+				stats.Links.Symlinks++
+				return nil
+			case linkKindJunction:
+				stats.Links.Junctions++
+				return nil
+			case linkKindMountPoint:
+				stats.Links.MountPoints++
+				if node.Type != restic.NodeTypeDir {
+					return nil
+				}
+				if opts.linkMode == linkModeOneFileSystem {
+					return walker.ErrSkipNode
+				}
+				isMounted = true
+			}
+			if isMounted {
+				if node.Type == restic.NodeTypeDir {
+					mounted[npath] = struct{}{}
+				}
+				stats.Links.MountedSize += node.Size
+			}
+		}
+
 		if opts.countMode == countModeUniqueFilesByContents || opts.countMode == countModeBlobsPerFile {
 			// only count this file if we haven't visited it before
 			fid := makeFileIDByContents(node)
@@ -243,7 +344,7 @@ func statsWalkTree(repo restic.Loader, opts StatsOptions, stats *statsContainer,
 				if opts.countMode == countModeBlobsPerFile {
 					// count the size of each unique blob reference, which is
 					// by unique file (unique by contents and file path)
-					for _, blobID := range node.Content {
+					for _, blobID := range node.DataBlobs() {
 						// ensure we have this file (by path) in our map; in this
 						// mode, a file is unique by both contents and path
 						nodePath := filepath.Join(npath, node.Name)
@@ -252,7 +353,7 @@ func statsWalkTree(repo restic.Loader, opts StatsOptions, stats *statsContainer,
 							stats.TotalFileCount++
 						}
 						if _, ok := stats.fileBlobs[nodePath][blobID]; !ok {
-							// is always a data blob since we're accessing it via a file's Content array
+							// is always a data blob since we're accessing it via a file's content
 							blobSize, found := repo.LookupBlobSize(restic.DataBlob, blobID)
 							if !found {
 								return fmt.Errorf("blob %s not found for tree %s", blobID, parentTreeID)
@@ -308,11 +409,33 @@ func verifyStatsInput(opts StatsOptions) error {
 	case countModeUniqueFilesByContents:
 	case countModeBlobsPerFile:
 	case countModeRawData:
+	case countModeHistory:
 	case countModeDebug:
 	default:
 		return fmt.Errorf("unknown counting mode: %s (use the -h flag to get a list of supported modes)", opts.countMode)
 	}
 
+	switch opts.linkMode {
+	case "", linkModeFile:
+	case linkModeSeparate, linkModeOneFileSystem:
+		if opts.countMode != countModeRestoreSize {
+			return fmt.Errorf("--link-mode %s is only supported in %s mode", opts.linkMode, countModeRestoreSize)
+		}
+	default:
+		return fmt.Errorf("unknown link mode: %s, must be one of file, separate or one-file-system", opts.linkMode)
+	}
+
+	if opts.sharedWith != "" {
+		switch opts.countMode {
+		case countModeRestoreSize, countModeRawData:
+		default:
+			return fmt.Errorf("--shared-with cannot be used in %s mode", opts.countMode)
+		}
+		if opts.linkMode != "" && opts.linkMode != linkModeFile {
+			return errors.New("--shared-with cannot be combined with --link-mode")
+		}
+	}
+
 	return nil
 }
 
@@ -331,6 +454,12 @@ type statsContainer struct {
 	TotalBlobCount                       uint64  `json:"total_blob_count,omitempty"`
 	// holds count of all considered snapshots
 	SnapshotsCount int `json:"snapshots_count"`
+	// Links is only set if links are accounted separately
+	Links *statsLinks `json:"links,omitempty"`
+	// FreeSpace and TotalSpace describe the repository storage, they are only
+	// set if the backend can determine them.
+	FreeSpace  uint64 `json:"free_space,omitempty"`
+	TotalSpace uint64 `json:"total_space,omitempty"`
 
 	// uniqueFiles marks visited files according to their
 	// contents (hashed sequence of content blob IDs)
@@ -345,6 +474,15 @@ type statsContainer struct {
 	blobs restic.BlobSet
 }
 
+// statsLinks counts the symlinks, junctions and mount points.
+type statsLinks struct {
+	Symlinks    uint64 `json:"symlinks"`
+	Junctions   uint64 `json:"junctions"`
+	MountPoints uint64 `json:"mount_points"`
+	// MountedSize is the size of the files on mounted file systems.
+	MountedSize uint64 `json:"mounted_size"`
+}
+
 // fileID is a 256-bit hash that distinguishes unique files.
 type fileID [32]byte
 
@@ -353,9 +491,243 @@ const (
 	countModeUniqueFilesByContents = "files-by-contents"
 	countModeBlobsPerFile          = "blobs-per-file"
 	countModeRawData               = "raw-data"
+	countModeHistory               = "history"
 	countModeDebug                 = "debug"
 )
 
+const (
+	linkModeFile          = "file"
+	linkModeSeparate      = "separate"
+	linkModeOneFileSystem = "one-file-system"
+)
+
+// statsHistorySnapshot contains the statistics recorded in a snapshot.
+type statsHistorySnapshot struct {
+	ID                  string    `json:"id"`
+	ShortID             string    `json:"short_id"`
+	Time                time.Time `json:"time"`
+	Hostname            string    `json:"hostname"`
+	Paths               []string  `json:"paths"`
+	TotalFilesProcessed uint      `json:"total_files_processed"`
+	TotalBytesProcessed uint64    `json:"total_bytes_processed"`
+	DataAdded           uint64    `json:"data_added"`
+	DataAddedPacked     uint64    `json:"data_added_packed"`
+	DedupRatio          float64   `json:"dedup_ratio,omitempty"`
+	Duration            float64   `json:"duration_seconds"`
+}
+
+// statsHistory is the output of the history mode.
+type statsHistory struct {
+	Snapshots            []statsHistorySnapshot `json:"snapshots"`
+	SnapshotsCount       int                    `json:"snapshots_count"`
+	WithoutStatistics    int                    `json:"snapshots_without_statistics"`
+	TotalDataAdded       uint64                 `json:"total_data_added"`
+	TotalDataAddedPacked uint64                 `json:"total_data_added_packed"`
+}
+
+func statsPrintHistory(ctx context.Context, be restic.Lister, repo restic.LoaderUnpacked, opts StatsOptions, gopts GlobalOptions, args []string) error {
+	history := statsHistory{Snapshots: []statsHistorySnapshot{}}
+	for sn := range FindFilteredSnapshots(ctx, be, repo, &opts.SnapshotFilter, args) {
+		history.SnapshotsCount++
+		if sn.Summary == nil {
+			history.WithoutStatistics++
+			continue
+		}
+
+		summary := sn.Summary
+		dedup := summary.DedupRatio
+		if dedup == 0 {
+			// snapshots created by older versions only contain the sizes
+			dedup = restic.DedupRatio(summary.TotalBytesProcessed, summary.DataAdded)
+		}
+		history.Snapshots = append(history.Snapshots, statsHistorySnapshot{
+			ID:                  sn.ID().String(),
+			ShortID:             sn.ID().Str(),
+			Time:                sn.Time,
+			Hostname:            sn.Hostname,
+			Paths:               sn.Paths,
+			TotalFilesProcessed: summary.TotalFilesProcessed,
+			TotalBytesProcessed: summary.TotalBytesProcessed,
+			DataAdded:           summary.DataAdded,
+			DataAddedPacked:     summary.DataAddedPacked,
+			DedupRatio:          dedup,
+			Duration:            summary.Duration().Seconds(),
+		})
+		history.TotalDataAdded += summary.DataAdded
+		history.TotalDataAddedPacked += summary.DataAddedPacked
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	sort.Slice(history.Snapshots, func(i, j int) bool {
+		return history.Snapshots[i].Time.Before(history.Snapshots[j].Time)
+	})
+
+	if gopts.JSON {
+		err := json.NewEncoder(globalOptions.stdout).Encode(history)
+		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	}
+
+	Printf("Stats in %s mode:\n", opts.countMode)
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ShortID }}")
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Host", "{{ .Hostname }}")
+	tab.AddColumn("Files", "{{ .Files }}")
+	tab.AddColumn("Size", "{{ .Size }}")
+	tab.AddColumn("Added", "{{ .Added }}")
+	tab.AddColumn("Stored", "{{ .Stored }}")
+	tab.AddColumn("Dedup", "{{ .Dedup }}")
+	tab.AddColumn("Duration", "{{ .Duration }}")
+
+	type line struct {
+		ShortID, Time, Hostname              string
+		Files                                uint
+		Size, Added, Stored, Dedup, Duration string
+	}
+	for _, sn := range history.Snapshots {
+		dedup := "-"
+		if sn.DedupRatio > 0 {
+			dedup = fmt.Sprintf("%.1fx", sn.DedupRatio)
+		}
+		tab.AddRow(line{
+			ShortID:  sn.ShortID,
+			Time:     sn.Time.Local().Format(TimeFormat),
+			Hostname: sn.Hostname,
+			Files:    sn.TotalFilesProcessed,
+			Size:     ui.FormatBytes(sn.TotalBytesProcessed),
+			Added:    ui.FormatBytes(sn.DataAdded),
+			Stored:   ui.FormatBytes(sn.DataAddedPacked),
+			Dedup:    dedup,
+			Duration: ui.FormatDuration(time.Duration(sn.Duration * float64(time.Second))),
+		})
+	}
+	tab.AddFooter(fmt.Sprintf("%d snapshots, %v added, %v stored", len(history.Snapshots),
+		ui.FormatBytes(history.TotalDataAdded), ui.FormatBytes(history.TotalDataAddedPacked)))
+	if err := tab.Write(globalOptions.stdout); err != nil {
+		return err
+	}
+
+	if history.WithoutStatistics > 0 {
+		Printf("%d snapshots contain no statistics\n", history.WithoutStatistics)
+	}
+	return nil
+}
+
+// statsSharedSnapshot describes the blobs referenced by one of the compared
+// snapshots.
+type statsSharedSnapshot struct {
+	ID        string `json:"id"`
+	ShortID   string `json:"short_id"`
+	Hostname  string `json:"hostname"`
+	BlobCount uint64 `json:"blob_count"`
+	Size      uint64 `json:"size"`
+}
+
+// statsShared is the output of the stats command with --shared-with.
+type statsShared struct {
+	Snapshot        statsSharedSnapshot `json:"snapshot"`
+	SharedWith      statsSharedSnapshot `json:"shared_with"`
+	SharedBlobCount uint64              `json:"shared_blob_count"`
+	SharedSize      uint64              `json:"shared_size"`
+}
+
+func statsPrintShared(ctx context.Context, be restic.Lister, repo restic.Repository, opts StatsOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 1 {
+		return errors.New("--shared-with only supports a single snapshot")
+	}
+	snapshotID := "latest"
+	if len(args) == 1 {
+		snapshotID = args[0]
+	}
+	filter := opts.SnapshotFilter
+	if len(filter.Hosts) == 0 && snapshotID == "latest" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		filter.Hosts = []string{hostname}
+	}
+
+	sn, subfolder, err := filter.FindLatest(ctx, be, repo, snapshotID)
+	if err != nil {
+		return err
+	}
+	if subfolder != "" {
+		return restic.ErrInvalidSnapshotSyntax
+	}
+	otherFilter := restic.SnapshotFilter{Hosts: []string{opts.sharedWith}}
+	other, _, err := otherFilter.FindLatest(ctx, be, repo, "latest")
+	if err != nil {
+		return err
+	}
+
+	if !gopts.JSON {
+		Printf("scanning...\n")
+	}
+	blobs := restic.NewBlobSet()
+	if err := restic.FindUsedBlobs(ctx, repo, sn.TreeIDs(), blobs, nil); err != nil {
+		return fmt.Errorf("error walking snapshot: %v", err)
+	}
+	otherBlobs := restic.NewBlobSet()
+	if err := restic.FindUsedBlobs(ctx, repo, other.TreeIDs(), otherBlobs, nil); err != nil {
+		return fmt.Errorf("error walking snapshot: %v", err)
+	}
+
+	// blobSize returns the size of the blob in the repository
+	blobSize := func(h restic.BlobHandle) (uint64, error) {
+		pbs := repo.LookupBlob(h.Type, h.ID)
+		if len(pbs) == 0 {
+			return 0, fmt.Errorf("blob %v not found", h)
+		}
+		return uint64(pbs[0].Length), nil
+	}
+
+	stats := statsShared{
+		Snapshot:   statsSharedSnapshot{ID: sn.ID().String(), ShortID: sn.ID().Str(), Hostname: sn.Hostname},
+		SharedWith: statsSharedSnapshot{ID: other.ID().String(), ShortID: other.ID().Str(), Hostname: other.Hostname},
+	}
+	for h := range blobs {
+		size, err := blobSize(h)
+		if err != nil {
+			return err
+		}
+		stats.Snapshot.BlobCount++
+		stats.Snapshot.Size += size
+		if otherBlobs.Has(h) {
+			stats.SharedBlobCount++
+			stats.SharedSize += size
+		}
+	}
+	for h := range otherBlobs {
+		size, err := blobSize(h)
+		if err != nil {
+			return err
+		}
+		stats.SharedWith.BlobCount++
+		stats.SharedWith.Size += size
+	}
+
+	if gopts.JSON {
+		err := json.NewEncoder(globalOptions.stdout).Encode(stats)
+		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	}
+
+	Printf("Blobs shared between snapshot %s of %s and snapshot %s of %s:\n",
+		stats.Snapshot.ShortID, stats.Snapshot.Hostname, stats.SharedWith.ShortID, stats.SharedWith.Hostname)
+	Printf("%20s:  %d blobs, %-5s\n", stats.Snapshot.Hostname, stats.Snapshot.BlobCount, ui.FormatBytes(stats.Snapshot.Size))
+	Printf("%20s:  %d blobs, %-5s\n", stats.SharedWith.Hostname, stats.SharedWith.BlobCount, ui.FormatBytes(stats.SharedWith.Size))
+	Printf("%20s:  %d blobs, %-5s (%s of %s)\n", "Shared", stats.SharedBlobCount, ui.FormatBytes(stats.SharedSize),
+		percent(stats.SharedSize, stats.Snapshot.Size), stats.Snapshot.Hostname)
+	return nil
+}
+
 func statsDebug(ctx context.Context, repo restic.Repository) error {
 	Warnf("Collecting size statistics\n\n")
 	for _, t := range []restic.FileType{restic.KeyFile, restic.LockFile, restic.IndexFile, restic.PackFile} {
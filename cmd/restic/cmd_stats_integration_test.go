@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestStatsHistory(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	gopts := env.gopts
+	gopts.JSON = true
+	buf, err := withCaptureStdout(func() error {
+		return runStats(context.TODO(), StatsOptions{countMode: countModeHistory}, gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	var history statsHistory
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &history))
+	rtest.Equals(t, 2, history.SnapshotsCount)
+	rtest.Equals(t, 0, history.WithoutStatistics)
+	rtest.Equals(t, 2, len(history.Snapshots))
+
+	first, second := history.Snapshots[0], history.Snapshots[1]
+	rtest.Assert(t, first.TotalFilesProcessed > 0, "no files recorded")
+	rtest.Equals(t, first.TotalFilesProcessed, second.TotalFilesProcessed)
+	rtest.Equals(t, first.TotalBytesProcessed, second.TotalBytesProcessed)
+	rtest.Assert(t, first.DataAdded > 0 && first.DedupRatio > 0, "unexpected statistics for first backup: %+v", first)
+	// the second backup only adds modified directory metadata
+	rtest.Assert(t, second.DataAdded < first.DataAdded, "second backup added %d bytes", second.DataAdded)
+	rtest.Equals(t, first.DataAdded+second.DataAdded, history.TotalDataAdded)
+
+	_, err = withCaptureStdout(func() error {
+		return runStats(context.TODO(), StatsOptions{countMode: countModeHistory}, env.gopts, []string{"latest"})
+	})
+	rtest.OK(t, err)
+}
+
+func TestStatsSharedWith(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{Host: "host1"}, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0")}, BackupOptions{Host: "host2"}, env.gopts)
+
+	gopts := env.gopts
+	gopts.JSON = true
+	opts := StatsOptions{countMode: countModeRestoreSize, sharedWith: "host2"}
+	opts.Hosts = []string{"host1"}
+	buf, err := withCaptureStdout(func() error {
+		return runStats(context.TODO(), opts, gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	var stats statsShared
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &stats))
+	rtest.Equals(t, "host1", stats.Snapshot.Hostname)
+	rtest.Equals(t, "host2", stats.SharedWith.Hostname)
+	rtest.Assert(t, stats.SharedBlobCount > 0, "no shared blobs: %+v", stats)
+	// the data of host2 is a subset of that of host1
+	rtest.Assert(t, stats.SharedBlobCount < stats.Snapshot.BlobCount, "unexpected statistics: %+v", stats)
+	rtest.Assert(t, stats.SharedSize < stats.Snapshot.Size, "unexpected statistics: %+v", stats)
+	rtest.Assert(t, stats.SharedSize <= stats.SharedWith.Size, "unexpected statistics: %+v", stats)
+
+	opts.countMode = countModeHistory
+	rtest.Assert(t, runStats(context.TODO(), opts, env.gopts, nil) != nil, "expected error for history mode")
+}
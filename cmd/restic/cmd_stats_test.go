@@ -1,9 +1,14 @@
 package main
 
 import (
+	"path"
+	"strings"
 	"testing"
 
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/restorer"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/walker"
 )
 
 func TestSizeHistogramNew(t *testing.T) {
@@ -60,3 +65,62 @@ func TestSizeHistogramString(t *testing.T) {
 		rtest.Equals(t, "Count: 3\nTotal Size: 11 B\nSize          Count\n-------------------\n  0 - 0 Byte  1\n  1 - 9 Byte  1\n10 - 42 Byte  1\n-------------------\n", h.String())
 	})
 }
+
+func TestStatsLinkModes(t *testing.T) {
+	type entry struct {
+		path string
+		node restic.Node
+	}
+	// the nodes in the order they are visited by the walker
+	entries := []entry{
+		{"/data", restic.Node{Type: restic.NodeTypeDir, DeviceID: 1}},
+		{"/data/file", restic.Node{Type: restic.NodeTypeFile, Size: 100, Links: 1, DeviceID: 1}},
+		{"/data/link", restic.Node{Type: restic.NodeTypeSymlink, LinkTarget: "file", Links: 1}},
+		{"/data/usb", restic.Node{Type: restic.NodeTypeDir, DeviceID: 2}},
+		{"/data/usb/sub", restic.Node{Type: restic.NodeTypeDir, DeviceID: 2}},
+		{"/data/usb/sub/big", restic.Node{Type: restic.NodeTypeFile, Size: 1000, Links: 1, DeviceID: 2}},
+	}
+
+	for _, test := range []struct {
+		mode  string
+		files uint64
+		size  uint64
+		links *statsLinks
+	}{
+		{linkModeFile, 6, 1100, nil},
+		{linkModeSeparate, 5, 1100, &statsLinks{Symlinks: 1, MountPoints: 1, MountedSize: 1000}},
+		{linkModeOneFileSystem, 2, 100, &statsLinks{Symlinks: 1, MountPoints: 1}},
+	} {
+		t.Run(test.mode, func(t *testing.T) {
+			opts := StatsOptions{countMode: countModeRestoreSize, linkMode: test.mode}
+			rtest.OK(t, verifyStatsInput(opts))
+			stats := &statsContainer{}
+			if test.mode != linkModeFile {
+				stats.Links = &statsLinks{}
+			}
+
+			walk := statsWalkTree(nil, opts, stats, restorer.NewHardlinkIndex[struct{}](), newLinkTracker())
+			var skipped string
+			for _, e := range entries {
+				if skipped != "" && strings.HasPrefix(e.path, skipped+"/") {
+					continue
+				}
+				node := e.node
+				node.Name = path.Base(e.path)
+				err := walk(restic.ID{}, e.path, &node, nil)
+				if err == walker.ErrSkipNode {
+					skipped = e.path
+					continue
+				}
+				rtest.OK(t, err)
+			}
+
+			rtest.Equals(t, test.files, stats.TotalFileCount)
+			rtest.Equals(t, test.size, stats.TotalSize)
+			rtest.Equals(t, test.links, stats.Links)
+		})
+	}
+
+	err := verifyStatsInput(StatsOptions{countMode: countModeRawData, linkMode: linkModeSeparate})
+	rtest.Assert(t, err != nil, "expected error for link mode in raw-data mode")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 
 	"github.com/spf13/cobra"
 
@@ -73,7 +74,7 @@ type changedSnapshotsSummary struct {
 	ChangedSnapshots int    `json:"changed_snapshots"`
 }
 
-func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string, printFunc func(changedSnapshot)) (bool, error) {
+func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string, signingKey ed25519.PrivateKey, printFunc func(changedSnapshot)) (bool, error) {
 	var changed bool
 
 	if len(setTags) != 0 {
@@ -96,6 +97,11 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 			sn.Original = sn.ID()
 		}
 
+		err := updateSnapshotSignature(sn, signingKey)
+		if err != nil {
+			return false, err
+		}
+
 		// Save the new snapshot.
 		id, err := restic.SaveSnapshot(ctx, repo, sn)
 		if err != nil {
@@ -124,6 +130,11 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, term *ter
 		return errors.Fatal("--set and --add/--remove cannot be given at the same time")
 	}
 
+	signingKey, err := loadSigningKey(gopts.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+
 	Verbosef("create exclusive lock for repository\n")
 	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, false)
 	if err != nil {
@@ -154,9 +165,9 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, term *ter
 	}
 
 	for sn := range FindFilteredSnapshots(ctx, repo, repo, &opts.SnapshotFilter, args) {
-		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten(), printFunc)
+		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten(), signingKey, printFunc)
 		if err != nil {
-			Warnf("unable to modify the tags for snapshot ID %q, ignoring: %v\n", sn.ID(), err)
+			Warningf("unable to modify the tags for snapshot ID %q, ignoring: %v\n", sn.ID(), err)
 			continue
 		}
 		if changed {
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 
+	"github.com/restic/restic/internal/audit"
 	"github.com/restic/restic/internal/repository"
 	"github.com/spf13/cobra"
 )
@@ -13,6 +14,9 @@ var unlockCmd = &cobra.Command{
 	Long: `
 The "unlock" command removes stale locks that have been created by other restic processes.
 
+Use "restic locks list" to inspect the locks held on the repository and
+"restic locks break" to remove specific locks after additional safety checks.
+
 EXIT STATUS
 ===========
 
@@ -58,5 +62,17 @@ func runUnlock(ctx context.Context, opts UnlockOptions, gopts GlobalOptions) err
 	if processed > 0 {
 		Verbosef("successfully removed %d locks\n", processed)
 	}
+
+	ev := audit.Event{
+		Type:     "repository-unlocked",
+		Name:     "Repository unlocked",
+		Severity: 5,
+		Count:    int(processed),
+	}
+	if opts.RemoveAll {
+		ev.Severity = 7
+		ev.Message = "all locks removed"
+	}
+	auditEvent(ev)
 	return nil
 }
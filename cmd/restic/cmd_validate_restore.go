@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/restic/restic/internal/audit"
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/sandbox"
+	"github.com/restic/restic/internal/ui/termstatus"
+	"github.com/spf13/cobra"
+)
+
+var cmdValidateRestore = &cobra.Command{
+	Use:   "validate-restore [flags] snapshotID",
+	Short: "Restore a snapshot into a disposable sandbox and run health checks",
+	Long: `
+The "validate-restore" command tests that a snapshot can be restored and used.
+It restores the snapshot to a temporary directory, starts the restored data in
+a disposable container or virtual machine without network access, runs a
+health probe and reports whether all checks passed. The sandbox and the
+restored data are removed afterwards, unless --keep is specified.
+
+With "--sandbox container" (the default), the probe given by --probe runs in a
+container of the --image with the restored data mounted read-only at
+/restore. With --rootfs, the restored data is used as root file system of the
+container instead, e.g. to start a service from a system backup; this requires
+podman. Without --probe, the check only verifies that the restored data is not
+empty. The path of the restored data is available in $RESTIC_RESTORE_DIR.
+
+With "--sandbox hyperv", only the virtual disk selected by --disk is restored
+and booted in a new Hyper-V virtual machine. The boot check passes once the
+integration services of the guest report a heartbeat. The optional --probe
+then runs on the host with the name of the virtual machine in
+$RESTIC_SANDBOX_VM, for example to check services via PowerShell Direct.
+
+To only restore a specific subfolder, you can use the "snapshotID:subfolder"
+syntax, where "subfolder" is a path within the snapshot.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if all checks passed.
+Exit status is 1 if a check failed or there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		term, cancel := setupTermstatus()
+		defer cancel()
+		return runValidateRestore(cmd.Context(), validateRestoreOptions, globalOptions, term, args)
+	},
+}
+
+// ValidateRestoreOptions collects all options for the validate-restore command.
+type ValidateRestoreOptions struct {
+	restic.SnapshotFilter
+	Sandbox    string
+	Target     string
+	Keep       bool
+	Probe      string
+	Timeout    time.Duration
+	Runtime    string
+	Image      string
+	RootFS     bool
+	Disk       string
+	Generation int
+	MemoryMB   int
+	Switch     string
+}
+
+var validateRestoreOptions ValidateRestoreOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdValidateRestore)
+
+	f := cmdValidateRestore.Flags()
+	initSingleSnapshotFilter(f, &validateRestoreOptions.SnapshotFilter)
+	f.StringVar(&validateRestoreOptions.Sandbox, "sandbox", "container", "`type` of the sandbox, container or hyperv")
+	f.StringVarP(&validateRestoreOptions.Target, "target", "t", "", "`directory` to restore to (default: a temporary directory)")
+	f.BoolVar(&validateRestoreOptions.Keep, "keep", false, "keep the restored data after the checks")
+	f.StringVar(&validateRestoreOptions.Probe, "probe", "", "health probe `command`, the check passes if it exits with status zero")
+	f.DurationVar(&validateRestoreOptions.Timeout, "timeout", 10*time.Minute, "abort the checks after `duration`")
+	f.StringVar(&validateRestoreOptions.Runtime, "container-runtime", "docker", "container `runtime`, docker or podman")
+	f.StringVar(&validateRestoreOptions.Image, "image", "alpine", "container `image` the probe runs in")
+	f.BoolVar(&validateRestoreOptions.RootFS, "rootfs", false, "use the restored data as root file system of the container (requires podman)")
+	f.StringVar(&validateRestoreOptions.Disk, "disk", "", "`path` of the .vhd or .vhdx file in the snapshot to boot with Hyper-V")
+	f.IntVar(&validateRestoreOptions.Generation, "generation", 2, "`generation` of the Hyper-V virtual machine")
+	f.IntVar(&validateRestoreOptions.MemoryMB, "memory", 2048, "memory of the Hyper-V virtual machine in `MiB`")
+	f.StringVar(&validateRestoreOptions.Switch, "switch", "", "connect the Hyper-V virtual machine to the virtual `switch` (default: no network)")
+}
+
+// ValidateRestoreSummary is printed with --json.
+type ValidateRestoreSummary struct {
+	MessageType string          `json:"message_type"` // "summary"
+	Snapshot    string          `json:"snapshot"`
+	Sandbox     string          `json:"sandbox"`
+	Passed      bool            `json:"passed"`
+	Checks      []sandbox.Check `json:"checks"`
+	Duration    time.Duration   `json:"duration"`
+}
+
+func (opts ValidateRestoreOptions) sandbox(target string) (sandbox.Sandbox, error) {
+	var probe []string
+	if opts.Probe != "" {
+		var err error
+		probe, err = backend.SplitShellStrings(opts.Probe)
+		if err != nil {
+			return nil, errors.Fatalf("invalid --probe: %v", err)
+		}
+	}
+
+	switch opts.Sandbox {
+	case "container":
+		if opts.Runtime != "docker" && opts.Runtime != "podman" {
+			return nil, errors.Fatalf("invalid --container-runtime %q, must be docker or podman", opts.Runtime)
+		}
+		if opts.RootFS && opts.Runtime != "podman" {
+			return nil, errors.Fatal("--rootfs requires --container-runtime podman")
+		}
+		return &sandbox.Container{
+			Runtime:    opts.Runtime,
+			Image:      opts.Image,
+			MountPoint: "/restore",
+			RootFS:     opts.RootFS,
+			Probe:      probe,
+		}, nil
+	case "hyperv":
+		if opts.Disk == "" {
+			return nil, errors.Fatal("--sandbox hyperv requires --disk")
+		}
+		return &sandbox.HyperV{
+			Disk:        filepath.Join(target, filepath.FromSlash(opts.Disk)),
+			Generation:  opts.Generation,
+			MemoryMB:    opts.MemoryMB,
+			Switch:      opts.Switch,
+			BootTimeout: opts.Timeout,
+			Probe:       probe,
+		}, nil
+	}
+	return nil, errors.Fatalf("invalid --sandbox %q, must be container or hyperv", opts.Sandbox)
+}
+
+func runValidateRestore(ctx context.Context, opts ValidateRestoreOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("specify exactly one snapshot ID")
+	}
+
+	target := opts.Target
+	if target == "" {
+		dir, err := os.MkdirTemp("", "restic-validate-")
+		if err != nil {
+			return err
+		}
+		target = dir
+		if !opts.Keep {
+			defer func() {
+				if err := os.RemoveAll(dir); err != nil {
+					Warnf("unable to remove %v: %v\n", dir, err)
+				}
+			}()
+		}
+	}
+
+	sb, err := opts.sandbox(target)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	restoreOpts := RestoreOptions{Target: target, SnapshotFilter: opts.SnapshotFilter}
+	if opts.Sandbox == "hyperv" {
+		// only the virtual disk is needed
+		restoreOpts.Includes = []string{opts.Disk}
+	}
+	if err := runRestore(ctx, restoreOpts, gopts, term, args); err != nil {
+		return err
+	}
+
+	if !gopts.JSON {
+		Verbosef("running checks in %v sandbox\n", opts.Sandbox)
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	result, err := sb.Validate(checkCtx, target)
+	if err != nil {
+		return errors.Fatalf("unable to set up sandbox: %v", err)
+	}
+
+	summary := ValidateRestoreSummary{
+		MessageType: "summary",
+		Snapshot:    args[0],
+		Sandbox:     opts.Sandbox,
+		Passed:      result.Passed(),
+		Checks:      result.Checks,
+		Duration:    time.Since(start),
+	}
+	if gopts.JSON {
+		if err := json.NewEncoder(globalOptions.stdout).Encode(summary); err != nil {
+			Warnf("JSON encode failed: %v\n", err)
+		}
+	} else {
+		for _, c := range summary.Checks {
+			status := "passed"
+			if !c.Passed {
+				status = "FAILED"
+			}
+			Printf("%-8s %v (%v)\n", c.Name, status, c.Duration.Round(time.Millisecond))
+			if c.Output != "" && (!c.Passed || gopts.verbosity >= 2) {
+				Printf("%v\n", c.Output)
+			}
+		}
+	}
+
+	ev := audit.Event{
+		Type:     "restore-validated",
+		Name:     "Restore validated",
+		Severity: 3,
+		Target:   target,
+		Message:  fmt.Sprintf("%v sandbox, %d checks", opts.Sandbox, len(summary.Checks)),
+	}
+	if !summary.Passed {
+		ev.Outcome = audit.Failure
+		ev.Severity = 6
+	}
+	auditEvent(ev)
+
+	if !summary.Passed {
+		return errors.Fatal("restore validation failed")
+	}
+	if !gopts.JSON {
+		Printf("restore validation passed\n")
+	}
+	return nil
+}
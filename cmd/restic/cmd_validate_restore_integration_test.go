@@ -0,0 +1,65 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+func testRunValidateRestore(opts ValidateRestoreOptions, gopts GlobalOptions, snapshotID string) error {
+	return withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runValidateRestore(ctx, opts, gopts, term, []string{snapshotID})
+	})
+}
+
+func TestValidateRestore(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "file"), []byte("content"), 0600))
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+
+	// the fake docker runs the probe on the host against the mounted directory
+	bin := filepath.Join(env.base, "bin")
+	rtest.OK(t, os.MkdirAll(bin, 0700))
+	script := `#!/bin/sh
+while [ "$1" != "alpine" ]; do
+	case "$1" in --mount) dir=${2#*,source=}; dir=${dir%%,*}; shift;; esac
+	shift
+done
+shift
+RESTIC_RESTORE_DIR=$dir exec "$@"
+`
+	rtest.OK(t, os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0700))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	opts := ValidateRestoreOptions{Sandbox: "container", Runtime: "docker", Image: "alpine", Timeout: time.Minute}
+	rtest.OK(t, testRunValidateRestore(opts, env.gopts, "latest"))
+
+	opts.Probe = `sh -c 'grep -q content "$RESTIC_RESTORE_DIR/file"'`
+	rtest.OK(t, testRunValidateRestore(opts, env.gopts, "latest"))
+
+	opts.Probe = `sh -c 'test -f "$RESTIC_RESTORE_DIR/missing"'`
+	err := testRunValidateRestore(opts, env.gopts, "latest")
+	rtest.Assert(t, err != nil, "validation with failing probe succeeded")
+
+	// the restored data is kept with --keep
+	target := filepath.Join(env.base, "kept")
+	opts = ValidateRestoreOptions{Sandbox: "container", Runtime: "docker", Image: "alpine", Timeout: time.Minute, Target: target, Keep: true}
+	rtest.OK(t, testRunValidateRestore(opts, env.gopts, "latest"))
+	_, err = os.Stat(filepath.Join(target, "file"))
+	rtest.OK(t, err)
+
+	opts.Sandbox = "vm"
+	err = testRunValidateRestore(opts, env.gopts, "latest")
+	rtest.Assert(t, err != nil, "invalid sandbox type was accepted")
+}
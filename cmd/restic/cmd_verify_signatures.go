@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+)
+
+var cmdVerifySignatures = &cobra.Command{
+	Use:   "verify-signatures [flags] [snapshotID ...]",
+	Short: "Verify the signatures of snapshots",
+	Long: `
+The "verify-signatures" command checks that snapshots were signed using the
+signing key belonging to one of the given public keys. Snapshots are signed
+when the signing key is passed to "backup", "tag" or "rewrite" via
+--signing-key.
+
+As the signing key is kept separately from the repository password, this
+detects snapshots which were created or modified by someone who only knows the
+repository password.
+
+When no snapshotID is given, all snapshots matching the host, tag and path
+filter criteria are verified.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the signatures of all snapshots are valid.
+Exit status is 1 if there was any error, or a snapshot is unsigned or its
+signature is invalid.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+	GroupID:           cmdGroupDefault,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVerifySignatures(cmd.Context(), verifySignaturesOptions, globalOptions, args)
+	},
+}
+
+// VerifySignaturesOptions bundles all options for the verify-signatures command.
+type VerifySignaturesOptions struct {
+	restic.SnapshotFilter
+	PublicKeyFiles []string
+}
+
+var verifySignaturesOptions VerifySignaturesOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdVerifySignatures)
+
+	f := cmdVerifySignatures.Flags()
+	f.StringArrayVar(&verifySignaturesOptions.PublicKeyFiles, "public-key", nil, "`file` containing a PEM encoded Ed25519 public key (can be specified multiple times)")
+	initMultiSnapshotFilter(f, &verifySignaturesOptions.SnapshotFilter, true)
+}
+
+type verifySignatureResult struct {
+	MessageType string    `json:"message_type"` // verify
+	SnapshotID  restic.ID `json:"snapshot_id"`
+	KeyID       string    `json:"key_id,omitempty"`
+	Valid       bool      `json:"valid"`
+	Error       string    `json:"error,omitempty"`
+}
+
+func runVerifySignatures(ctx context.Context, opts VerifySignaturesOptions, gopts GlobalOptions, args []string) error {
+	if len(opts.PublicKeyFiles) == 0 {
+		return errors.Fatal("no public key specified, please use --public-key")
+	}
+
+	keys := make([]ed25519.PublicKey, 0, len(opts.PublicKeyFiles))
+	for _, filename := range opts.PublicKeyFiles {
+		key, err := loadVerifyKey(filename)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	failed := 0
+	for sn := range FindFilteredSnapshots(ctx, repo, repo, &opts.SnapshotFilter, args) {
+		res := verifySignatureResult{
+			MessageType: "verify",
+			SnapshotID:  *sn.ID(),
+		}
+		if sn.Signature != nil {
+			res.KeyID = sn.Signature.KeyID
+		}
+
+		// verify the stored snapshot, which may contain fields unknown to
+		// this version
+		buf, err := repo.LoadUnpacked(ctx, restic.SnapshotFile, *sn.ID())
+		if err == nil {
+			err = restic.VerifySnapshotSignature(buf, keys)
+		}
+		if err != nil {
+			failed++
+			res.Error = err.Error()
+		} else {
+			res.Valid = true
+		}
+
+		if gopts.JSON {
+			Println(ui.ToJSONString(res))
+		} else if err != nil {
+			Warnf("snapshot %v: %v\n", sn.ID().Str(), err)
+		} else {
+			Verbosef("snapshot %v: valid signature by key %v\n", sn.ID().Str(), res.KeyID)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if failed > 0 {
+		return errors.Fatalf("%d snapshots failed the signature verification", failed)
+	}
+	if !gopts.JSON {
+		Verbosef("all snapshot signatures are valid\n")
+	}
+	return nil
+}
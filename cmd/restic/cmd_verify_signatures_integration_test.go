@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testWriteSigningKeys(t testing.TB, dir string) (privFile, pubFile string) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	rtest.OK(t, err)
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	rtest.OK(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	rtest.OK(t, err)
+
+	privFile = filepath.Join(dir, "signing.pem")
+	pubFile = filepath.Join(dir, "signing.pub")
+	rtest.OK(t, os.WriteFile(privFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600))
+	rtest.OK(t, os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644))
+	return privFile, pubFile
+}
+
+func testRunVerifySignatures(gopts GlobalOptions, pubFile string) error {
+	return runVerifySignatures(context.TODO(), VerifySignaturesOptions{PublicKeyFiles: []string{pubFile}}, gopts, nil)
+}
+
+func TestVerifySignatures(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	privFile, pubFile := testWriteSigningKeys(t, env.base)
+	_, otherPubFile := testWriteSigningKeys(t, t.TempDir())
+
+	testSetupBackupData(t, env)
+	signedOpts := env.gopts
+	signedOpts.SigningKeyFile = privFile
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, signedOpts)
+
+	rtest.OK(t, testRunVerifySignatures(env.gopts, pubFile))
+	rtest.Assert(t, testRunVerifySignatures(env.gopts, otherPubFile) != nil, "expected error for unknown key")
+
+	// modifying the snapshot with the signing key keeps it signed
+	testRunTag(t, TagOptions{AddTags: restic.TagLists{[]string{"foo"}}}, signedOpts)
+	rtest.OK(t, testRunVerifySignatures(env.gopts, pubFile))
+
+	// without the signing key the signature is removed
+	testRunTag(t, TagOptions{AddTags: restic.TagLists{[]string{"bar"}}}, env.gopts)
+	rtest.Assert(t, testRunVerifySignatures(env.gopts, pubFile) != nil, "expected error for unsigned snapshot")
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"runtime"
 
+	"github.com/restic/restic/internal/crypto"
+
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +32,7 @@ Exit status is 1 if there was any error.
 				GoVersion   string `json:"go_version"`
 				GoOS        string `json:"go_os"`
 				GoArch      string `json:"go_arch"`
+				FIPSModule  bool   `json:"fips_module"`
 			}
 
 			jsonS := jsonVersion{
@@ -38,6 +41,7 @@ Exit status is 1 if there was any error.
 				GoVersion:   runtime.Version(),
 				GoOS:        runtime.GOOS,
 				GoArch:      runtime.GOARCH,
+				FIPSModule:  crypto.FIPSModule(),
 			}
 
 			err := json.NewEncoder(globalOptions.stdout).Encode(jsonS)
@@ -46,8 +50,12 @@ Exit status is 1 if there was any error.
 				return
 			}
 		} else {
-			fmt.Printf("restic %s compiled with %v on %v/%v\n",
-				version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+			fips := ""
+			if crypto.FIPSModule() {
+				fips = " using a FIPS 140 validated module"
+			}
+			fmt.Printf("restic %s compiled with %v on %v/%v%s\n",
+				version, runtime.Version(), runtime.GOOS, runtime.GOARCH, fips)
 		}
 
 	},
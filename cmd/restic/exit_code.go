@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Exit codes returned by restic. The values are stable, see the "Exit codes"
+// section in doc/075_scripting.rst.
+const (
+	exitCodeSuccess           = 0
+	exitCodeFailure           = 1
+	exitCodeInvalidSourceData = 3
+	exitCodeWarnings          = 4
+	exitCodeNoRepository      = 10
+	exitCodeLocked            = 11
+	exitCodeWrongPassword     = 12
+	exitCodeRepositoryDamaged = 13
+	exitCodeBackend           = 14
+	exitCodeInterrupted       = 130
+)
+
+// Error categories reported in the final JSON error object. They allow
+// schedulers to decide whether to retry, alert or page.
+const (
+	categoryWarnings          = "warnings"
+	categoryFailure           = "failure"
+	categoryInvalidSourceData = "source_data"
+	categoryNoRepository      = "no_repository"
+	categoryLocked            = "locked"
+	categoryWrongPassword     = "authentication"
+	categoryRepositoryDamaged = "repository_damaged"
+	categoryBackend           = "backend"
+	categoryInterrupted       = "interrupted"
+)
+
+// ErrRepositoryDamaged is returned if a command found damaged data in the
+// repository.
+var ErrRepositoryDamaged = errors.Fatal("repository contains errors")
+
+// warningsReported is set by Warningf.
+var warningsReported atomic.Bool
+
+// Warningf writes the message to stderr like Warnf. It also records that the
+// command completed with warnings, such that restic exits with
+// exitCodeWarnings unless the command failed.
+func Warningf(format string, args ...interface{}) {
+	warningsReported.Store(true)
+	Warnf(format, args...)
+}
+
+// backendErrors records the final errors of backend operations which failed
+// after all retries.
+var backendErrors struct {
+	sync.Mutex
+	errs []error
+}
+
+func recordBackendError(err error) {
+	backendErrors.Lock()
+	defer backendErrors.Unlock()
+	backendErrors.errs = append(backendErrors.errs, err)
+}
+
+// isBackendError returns true if err was caused by a failed backend
+// operation.
+func isBackendError(err error) bool {
+	backendErrors.Lock()
+	defer backendErrors.Unlock()
+	for _, berr := range backendErrors.errs {
+		if errors.Is(err, berr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRepositoryDamaged returns true if err reports damaged repository data.
+func isRepositoryDamaged(err error) bool {
+	var packErr *repository.ErrPackData
+	return errors.Is(err, ErrRepositoryDamaged) ||
+		errors.Is(err, restic.ErrInvalidData) ||
+		errors.Is(err, restic.ErrTreeNotOrdered) ||
+		errors.As(err, &packErr)
+}
+
+// exitCode returns the exit code and error category for the result of a
+// command. The category is empty if the command was successful.
+func exitCode(err error, warnings bool) (int, string) {
+	switch {
+	case err == nil && warnings:
+		return exitCodeWarnings, categoryWarnings
+	case err == nil:
+		return exitCodeSuccess, ""
+	case err == ErrInvalidSourceData:
+		return exitCodeInvalidSourceData, categoryInvalidSourceData
+	case errors.Is(err, ErrNoRepository):
+		return exitCodeNoRepository, categoryNoRepository
+	case restic.IsAlreadyLocked(err):
+		return exitCodeLocked, categoryLocked
+	case errors.Is(err, repository.ErrNoKeyFound):
+		return exitCodeWrongPassword, categoryWrongPassword
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrCheckpoint):
+		return exitCodeInterrupted, categoryInterrupted
+	case isRepositoryDamaged(err):
+		return exitCodeRepositoryDamaged, categoryRepositoryDamaged
+	case isBackendError(err):
+		return exitCodeBackend, categoryBackend
+	default:
+		return exitCodeFailure, categoryFailure
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestExitCode(t *testing.T) {
+	backendErr := errors.New("backend failed")
+	recordBackendError(backendErr)
+
+	for _, test := range []struct {
+		err      error
+		warnings bool
+		code     int
+		category string
+	}{
+		{nil, false, exitCodeSuccess, ""},
+		{nil, true, exitCodeWarnings, categoryWarnings},
+		{ErrInvalidSourceData, false, exitCodeInvalidSourceData, categoryInvalidSourceData},
+		{errors.Wrap(ErrNoRepository, "open"), false, exitCodeNoRepository, categoryNoRepository},
+		{ErrRepositoryDamaged, true, exitCodeRepositoryDamaged, categoryRepositoryDamaged},
+		{errors.Wrap(restic.ErrInvalidData, "load"), false, exitCodeRepositoryDamaged, categoryRepositoryDamaged},
+		{errors.Wrap(backendErr, "save"), false, exitCodeBackend, categoryBackend},
+		{context.Canceled, false, exitCodeInterrupted, categoryInterrupted},
+		{errors.New("other"), true, exitCodeFailure, categoryFailure},
+	} {
+		code, category := exitCode(test.err, test.warnings)
+		rtest.Equals(t, test.code, code)
+		rtest.Equals(t, test.category, category)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"os"
+	"time"
 
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/pflag"
@@ -18,6 +19,8 @@ func initMultiSnapshotFilter(flags *pflag.FlagSet, filt *restic.SnapshotFilter,
 	flags.StringArrayVarP(&filt.Hosts, "host", hostShorthand, nil, "only consider snapshots for this `host` (can be specified multiple times) (default: $RESTIC_HOST)")
 	flags.Var(&filt.Tags, "tag", "only consider snapshots including `tag[,tag,...]` (can be specified multiple times)")
 	flags.StringArrayVar(&filt.Paths, "path", nil, "only consider snapshots including this (absolute) `path` (can be specified multiple times, snapshots must include all specified paths)")
+	flags.Var(timeValue{&filt.Since}, "since", "only consider snapshots created at or after `time`")
+	flags.Var(timeValue{&filt.Until}, "until", "only consider snapshots created at or before `time`")
 
 	// set default based on env if set
 	if host := os.Getenv("RESTIC_HOST"); host != "" {
@@ -25,6 +28,31 @@ func initMultiSnapshotFilter(flags *pflag.FlagSet, filt *restic.SnapshotFilter,
 	}
 }
 
+// timeValue is a flag which accepts a date or a date and time, see parseTime.
+type timeValue struct {
+	t *time.Time
+}
+
+func (v timeValue) String() string {
+	if v.t == nil || v.t.IsZero() {
+		return ""
+	}
+	return v.t.Format(TimeFormat)
+}
+
+func (v timeValue) Set(s string) error {
+	t, err := parseTime(s)
+	if err != nil {
+		return err
+	}
+	*v.t = t
+	return nil
+}
+
+func (v timeValue) Type() string {
+	return "time"
+}
+
 // initSingleSnapshotFilter is used for commands that work on a single snapshot
 // MUST be combined with restic.FindFilteredSnapshot
 func initSingleSnapshotFilter(flags *pflag.FlagSet, filt *restic.SnapshotFilter) {
@@ -45,13 +73,13 @@ func FindFilteredSnapshots(ctx context.Context, be restic.Lister, loader restic.
 		defer close(out)
 		be, err := restic.MemorizeList(ctx, be, restic.SnapshotFile)
 		if err != nil {
-			Warnf("could not load snapshots: %v\n", err)
+			Warningf("could not load snapshots: %v\n", err)
 			return
 		}
 
 		err = f.FindAll(ctx, be, loader, snapshotIDs, func(id string, sn *restic.Snapshot, err error) error {
 			if err != nil {
-				Warnf("Ignoring %q: %v\n", id, err)
+				Warningf("Ignoring %q: %v\n", id, err)
 			} else {
 				select {
 				case <-ctx.Done():
@@ -62,7 +90,7 @@ func FindFilteredSnapshots(ctx context.Context, be restic.Lister, loader restic.
 			return nil
 		})
 		if err != nil {
-			Warnf("could not load snapshots: %v\n", err)
+			Warningf("could not load snapshots: %v\n", err)
 		}
 	}()
 	return out
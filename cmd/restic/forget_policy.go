@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/textfile"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// loadForgetPolicyFile sets the retention policy in opts from a YAML file.
+// The keys are the names of the --keep-* options and "group-by", the values
+// use the same syntax as the options, for example:
+//
+//	keep-daily: 7
+//	keep-monthly: 12
+//	keep-yearly: unlimited
+//	keep-tag: [important]
+//	group-by: host,paths
+func loadForgetPolicyFile(filename string, opts *ForgetOptions) error {
+	data, err := textfile.Read(filename)
+	if err != nil {
+		return errors.Fatalf("unable to read policy file: %v", err)
+	}
+
+	err = parseForgetPolicy(data, opts)
+	if err != nil {
+		return errors.Fatalf("invalid policy file %v: %v", filename, err)
+	}
+	return nil
+}
+
+func parseForgetPolicy(data []byte, opts *ForgetOptions) error {
+	values := map[string]pflag.Value{
+		"keep-last":           &opts.Last,
+		"keep-hourly":         &opts.Hourly,
+		"keep-daily":          &opts.Daily,
+		"keep-weekly":         &opts.Weekly,
+		"keep-monthly":        &opts.Monthly,
+		"keep-yearly":         &opts.Yearly,
+		"keep-within":         &opts.Within,
+		"keep-within-hourly":  &opts.WithinHourly,
+		"keep-within-daily":   &opts.WithinDaily,
+		"keep-within-weekly":  &opts.WithinWeekly,
+		"keep-within-monthly": &opts.WithinMonthly,
+		"keep-within-yearly":  &opts.WithinYearly,
+		"keep-tag":            &opts.KeepTags,
+		"group-by":            &opts.GroupBy,
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return errors.New("policy is empty")
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.Errorf("line %d: expected a mapping of options to values", root.Line)
+	}
+
+	seen := make(map[string]struct{})
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, node := root.Content[i], root.Content[i+1]
+		value, ok := values[key.Value]
+		if !ok {
+			return errors.Errorf("line %d: unknown option %q", key.Line, key.Value)
+		}
+		if _, ok := seen[key.Value]; ok {
+			return errors.Errorf("line %d: option %q is set more than once", key.Line, key.Value)
+		}
+		seen[key.Value] = struct{}{}
+
+		items := []*yaml.Node{node}
+		if node.Kind == yaml.SequenceNode && key.Value == "keep-tag" {
+			items = node.Content
+		}
+		for _, item := range items {
+			if item.Kind != yaml.ScalarNode {
+				return errors.Errorf("line %d: invalid value for %q", item.Line, key.Value)
+			}
+			if err := value.Set(item.Value); err != nil {
+				return errors.Errorf("line %d: invalid value for %q: %v", item.Line, key.Value, err)
+			}
+		}
+	}
+	return nil
+}
+
+// maxSimulatedSnapshots limits the number of future snapshots created by a
+// simulation.
+const maxSimulatedSnapshots = 100000
+
+// ForgetSimulation is the projected effect of a retention policy on a group of
+// snapshots, assuming that a new snapshot is created every Interval.
+type ForgetSimulation struct {
+	Interval string    `json:"interval"`
+	Until    time.Time `json:"until"`
+	// Snapshots lists the existing snapshots and when they are removed.
+	Snapshots []SimulatedSnapshot `json:"snapshots"`
+	// Schedule contains the state of the group at monthly intervals.
+	Schedule []SimulationStep `json:"schedule"`
+}
+
+// SimulatedSnapshot is an existing snapshot in a simulation.
+type SimulatedSnapshot struct {
+	ID      *restic.ID `json:"id"`
+	ShortID string     `json:"short_id"`
+	Time    time.Time  `json:"time"`
+	// RemovedAt is the time at which the snapshot is removed, or nil if it is
+	// kept until the end of the simulation.
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+}
+
+// SimulationStep is the state of a snapshot group at a point in time.
+type SimulationStep struct {
+	Time time.Time `json:"time"`
+	// Snapshots is the number of kept snapshots, Existing counts those which
+	// already exist.
+	Snapshots int       `json:"snapshots"`
+	Existing  int       `json:"existing"`
+	Oldest    time.Time `json:"oldest"`
+}
+
+// simulateForget applies policy to the snapshots in group, keep are the
+// snapshots which are kept now. Afterwards, a snapshot is added every
+// interval, starting at now, and the policy is applied again, until the
+// duration period has passed. If interval is zero, the median interval between
+// the existing snapshots is used.
+func simulateForget(group, keep restic.Snapshots, policy restic.ExpirePolicy, period restic.Duration, interval time.Duration, now time.Time) (*ForgetSimulation, error) {
+	if interval == 0 {
+		interval = typicalSnapshotInterval(group)
+	}
+
+	latest := now
+	for _, sn := range group {
+		if sn.Time.After(latest) {
+			latest = sn.Time
+		}
+	}
+	until := latest.AddDate(period.Years, period.Months, period.Days).Add(time.Duration(period.Hours) * time.Hour)
+	if until.Sub(latest)/interval > maxSimulatedSnapshots {
+		return nil, errors.Fatalf("the simulation would create more than %d snapshots, use a larger --simulate-interval", maxSimulatedSnapshots)
+	}
+
+	sim := &ForgetSimulation{Interval: formatInterval(interval), Until: until}
+
+	sorted := append(restic.Snapshots{}, group...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	// existing maps the snapshots in group to their index in sim.Snapshots
+	existing := make(map[*restic.Snapshot]int, len(group))
+	for _, sn := range sorted {
+		existing[sn] = len(sim.Snapshots)
+		sim.Snapshots = append(sim.Snapshots, SimulatedSnapshot{ID: sn.ID(), ShortID: sn.ID().Str(), Time: sn.Time})
+	}
+
+	removed := func(list restic.Snapshots, t time.Time) {
+		for _, sn := range list {
+			if i, ok := existing[sn]; ok && sim.Snapshots[i].RemovedAt == nil {
+				removedAt := t
+				sim.Snapshots[i].RemovedAt = &removedAt
+			}
+		}
+	}
+
+	kept := make(map[*restic.Snapshot]struct{}, len(keep))
+	for _, sn := range keep {
+		kept[sn] = struct{}{}
+	}
+	for _, sn := range group {
+		if _, ok := kept[sn]; !ok {
+			removed(restic.Snapshots{sn}, now)
+		}
+	}
+
+	current := append(restic.Snapshots{}, keep...)
+	var hostname string
+	var paths, tags []string
+	if len(group) > 0 {
+		hostname, paths, tags = group[0].Hostname, group[0].Paths, group[0].Tags
+	}
+
+	record := func(t time.Time) {
+		step := SimulationStep{Time: t, Snapshots: len(current)}
+		for _, sn := range current {
+			if _, ok := existing[sn]; ok {
+				step.Existing++
+			}
+			if step.Oldest.IsZero() || sn.Time.Before(step.Oldest) {
+				step.Oldest = sn.Time
+			}
+		}
+		sim.Schedule = append(sim.Schedule, step)
+	}
+
+	checkpoint := latest.AddDate(0, 1, 0)
+	last := latest
+	for t := latest.Add(interval); !t.After(until); t = t.Add(interval) {
+		// future snapshots are part of the same group
+		sn := &restic.Snapshot{Time: t, Hostname: hostname, Paths: paths, Tags: tags}
+		var remove restic.Snapshots
+		current, remove, _ = restic.ApplyPolicy(append(current, sn), policy)
+		removed(remove, t)
+		last = t
+
+		if !t.Before(checkpoint) {
+			record(t)
+			for !t.Before(checkpoint) {
+				checkpoint = checkpoint.AddDate(0, 1, 0)
+			}
+		}
+	}
+	if len(sim.Schedule) == 0 || !sim.Schedule[len(sim.Schedule)-1].Time.Equal(last) {
+		record(last)
+	}
+	return sim, nil
+}
+
+// typicalSnapshotInterval returns the median interval between the snapshots
+// in list, but at least one hour. If the interval cannot be determined, one
+// day is returned.
+func typicalSnapshotInterval(list restic.Snapshots) time.Duration {
+	times := make([]time.Time, 0, len(list))
+	for _, sn := range list {
+		times = append(times, sn.Time)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	var intervals []time.Duration
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d > 0 {
+			intervals = append(intervals, d)
+		}
+	}
+	if len(intervals) == 0 {
+		return 24 * time.Hour
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	median := intervals[len(intervals)/2]
+	if median < time.Hour {
+		return time.Hour
+	}
+	return median.Round(time.Minute)
+}
+
+// formatInterval formats d using days if it is a multiple of a day.
+func formatInterval(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d >= day && d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return d.String()
+}
+
+func printForgetSimulation(sim *ForgetSimulation) {
+	Printf("simulation with a new snapshot every %v until %v:\n", sim.Interval, sim.Until.Local().Format(TimeFormat))
+	for _, step := range sim.Schedule {
+		Printf("  %v  %4d snapshots (%d existing), oldest from %v\n", step.Time.Local().Format("2006-01-02"),
+			step.Snapshots, step.Existing, step.Oldest.Local().Format(TimeFormat))
+	}
+	Printf("\nexisting snapshots:\n")
+	for _, sn := range sim.Snapshots {
+		state := "kept"
+		if sn.RemovedAt != nil {
+			state = "removed " + sn.RemovedAt.Local().Format("2006-01-02")
+		}
+		Printf("  %v  %v  %v\n", sn.ShortID, sn.Time.Local().Format(TimeFormat), state)
+	}
+	Printf("\n")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -13,21 +14,11 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/backend"
-	"github.com/restic/restic/internal/backend/azure"
-	"github.com/restic/restic/internal/backend/b2"
 	"github.com/restic/restic/internal/backend/cache"
-	"github.com/restic/restic/internal/backend/gs"
 	"github.com/restic/restic/internal/backend/limiter"
-	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/location"
-	"github.com/restic/restic/internal/backend/logger"
-	"github.com/restic/restic/internal/backend/rclone"
-	"github.com/restic/restic/internal/backend/rest"
-	"github.com/restic/restic/internal/backend/retry"
-	"github.com/restic/restic/internal/backend/s3"
-	"github.com/restic/restic/internal/backend/sema"
-	"github.com/restic/restic/internal/backend/sftp"
-	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/backend/setup"
+	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/repository"
@@ -59,26 +50,50 @@ type GlobalOptions struct {
 	RepositoryFile     string
 	PasswordFile       string
 	PasswordCommand    string
+	VaultAddress       string
+	VaultPassword      string
+	VaultEnv           []string
+	TokenCommand       string
+	SigningKeyFile     string
 	KeyHint            string
 	Quiet              bool
 	Verbose            int
 	NoLock             bool
 	RetryLock          time.Duration
 	JSON               bool
+	JSONEvents         bool
+	LogTarget          string
+	AuditLog           string
+	AuditFormat        string
+	MetricsFile        string
+	MetricsPushgateway string
+	MetricsJob         string
 	CacheDir           string
 	NoCache            bool
 	CleanupCache       bool
 	Compression        repository.CompressionMode
 	PackSize           uint
+	MaxConnections     uint
 	NoExtraVerify      bool
 	InsecureNoPassword bool
+	FIPS               bool
+	LimitUpload        limiter.ScheduledRate
+	LimitDownload      limiter.ScheduledRate
+	LimitSchedule      string
 
 	backend.TransportOptions
-	limiter.Limits
 
 	password string
-	stdout   io.Writer
-	stderr   io.Writer
+	// helloUnlock allows unlocking the repository using Windows Hello.
+	helloUnlock bool
+	stdout      io.Writer
+	stderr      io.Writer
+	// allowReplica permits modifying a repository which is marked as a
+	// replica, for commands which replicate to or manage replicas.
+	allowReplica bool
+	// bandwidthShare, if set, is the share of the bandwidth limits available
+	// to this process, see backup --job.
+	bandwidthShare *limiter.Share
 
 	backends                              *location.Registry
 	backendTestHook, backendInnerTestHook backendWrapper
@@ -101,17 +116,7 @@ var globalOptions = GlobalOptions{
 }
 
 func init() {
-	backends := location.NewRegistry()
-	backends.Register(azure.NewFactory())
-	backends.Register(b2.NewFactory())
-	backends.Register(gs.NewFactory())
-	backends.Register(local.NewFactory())
-	backends.Register(rclone.NewFactory())
-	backends.Register(rest.NewFactory())
-	backends.Register(s3.NewFactory())
-	backends.Register(sftp.NewFactory())
-	backends.Register(swift.NewFactory())
-	globalOptions.backends = backends
+	globalOptions.backends = setup.Backends()
 
 	f := cmdRoot.PersistentFlags()
 	f.StringVarP(&globalOptions.Repo, "repo", "r", "", "`repository` to backup to or restore from (default: $RESTIC_REPOSITORY)")
@@ -119,12 +124,24 @@ func init() {
 	f.StringVarP(&globalOptions.PasswordFile, "password-file", "p", "", "`file` to read the repository password from (default: $RESTIC_PASSWORD_FILE)")
 	f.StringVarP(&globalOptions.KeyHint, "key-hint", "", "", "`key` ID of key to try decrypting first (default: $RESTIC_KEY_HINT)")
 	f.StringVarP(&globalOptions.PasswordCommand, "password-command", "", "", "shell `command` to obtain the repository password from (default: $RESTIC_PASSWORD_COMMAND)")
+	f.StringVar(&globalOptions.VaultAddress, "vault-addr", "", "`address` of the HashiCorp Vault server or agent (default: $VAULT_AGENT_ADDR or $VAULT_ADDR)")
+	f.StringVar(&globalOptions.VaultPassword, "vault-password", "", "read the repository password from the Vault secret `path#field` (default: $RESTIC_VAULT_PASSWORD)")
+	f.StringSliceVar(&globalOptions.VaultEnv, "vault-env", nil, "set environment variable from the Vault secret `NAME=path#field`, e.g. for backend credentials (can be specified multiple times, default: $RESTIC_VAULT_ENV)")
+	f.StringVarP(&globalOptions.TokenCommand, "token-command", "", "", "shell `command` to unwrap the secret of token-protected keys, e.g. using a PKCS#11 token or smart card (default: $RESTIC_TOKEN_COMMAND)")
+	f.StringVar(&globalOptions.SigningKeyFile, "signing-key", "", "`file` containing a PEM encoded Ed25519 private key to sign new or modified snapshots (default: $RESTIC_SIGNING_KEY_FILE)")
 	f.BoolVarP(&globalOptions.Quiet, "quiet", "q", false, "do not output comprehensive progress report")
 	// use empty parameter name as `-v, --verbose n` instead of the correct `--verbose=n` is confusing
 	f.CountVarP(&globalOptions.Verbose, "verbose", "v", "be verbose (specify multiple times or a level using --verbose=n``, max level/times is 2)")
 	f.BoolVar(&globalOptions.NoLock, "no-lock", false, "do not lock the repository, this allows some operations on read-only repositories")
 	f.DurationVar(&globalOptions.RetryLock, "retry-lock", 0, "retry to lock the repository if it is already locked, takes a value like 5m or 2h (default: no retries)")
 	f.BoolVarP(&globalOptions.JSON, "json", "", false, "set output mode to JSON for commands that support it")
+	f.BoolVar(&globalOptions.JSONEvents, "json-events", false, "print a stream of JSON events for the backup, restore, check, prune and copy commands (implies --json)")
+	f.StringVar(&globalOptions.LogTarget, "log-target", "", "also send messages to `target`: journald, syslog or syslog+(unix|udp|tcp)://address (default: $RESTIC_LOG_TARGET)")
+	f.StringVar(&globalOptions.AuditLog, "audit-log", "", "record security-relevant events in `target`: a file, journald, syslog or syslog+(unix|udp|tcp)://address (default: $RESTIC_AUDIT_LOG)")
+	f.StringVar(&globalOptions.AuditFormat, "audit-format", "", "`format` of audit events: cef or leef (default: $RESTIC_AUDIT_FORMAT or cef)")
+	f.StringVar(&globalOptions.MetricsFile, "metrics-file", "", "write metrics about the outcome of the command to `file` for the node exporter textfile collector (default: $RESTIC_METRICS_FILE)")
+	f.StringVar(&globalOptions.MetricsPushgateway, "metrics-pushgateway", "", "push metrics about the outcome of the command to the Prometheus Pushgateway at `url` (default: $RESTIC_METRICS_PUSHGATEWAY)")
+	f.StringVar(&globalOptions.MetricsJob, "metrics-job", "", "`name` of the job in metrics (default: $RESTIC_METRICS_JOB or restic)")
 	f.StringVar(&globalOptions.CacheDir, "cache-dir", "", "set the cache `directory`. (default: use system default cache directory)")
 	f.BoolVar(&globalOptions.NoCache, "no-cache", false, "do not use a local cache")
 	f.StringSliceVar(&globalOptions.RootCertFilenames, "cacert", nil, "`file` to load root certificates from (default: use system certificates or $RESTIC_CACERT)")
@@ -134,9 +151,14 @@ func init() {
 	f.BoolVar(&globalOptions.CleanupCache, "cleanup-cache", false, "auto remove old cache directories")
 	f.Var(&globalOptions.Compression, "compression", "compression mode (only available for repository format version 2), one of (auto|off|max) (default: $RESTIC_COMPRESSION)")
 	f.BoolVar(&globalOptions.NoExtraVerify, "no-extra-verify", false, "skip additional verification of data before upload (see documentation)")
-	f.IntVar(&globalOptions.Limits.UploadKb, "limit-upload", 0, "limits uploads to a maximum `rate` in KiB/s. (default: unlimited)")
-	f.IntVar(&globalOptions.Limits.DownloadKb, "limit-download", 0, "limits downloads to a maximum `rate` in KiB/s. (default: unlimited)")
+	f.BoolVar(&globalOptions.FIPS, "fips", crypto.FIPSModule(), "only use cryptography approved by FIPS 140, requires a build with a FIPS 140 validated module (default: true for such builds)")
+	globalOptions.LimitUpload = limiter.NewUploadRate()
+	globalOptions.LimitDownload = limiter.NewDownloadRate()
+	f.Var(&globalOptions.LimitUpload, "limit-upload", "limits uploads to a maximum `rate` in KiB/s, optionally depending on the time of day, e.g. 'mon-fri 08:00-18:00 10240' (default: unlimited)")
+	f.Var(&globalOptions.LimitDownload, "limit-download", "limits downloads to a maximum `rate` in KiB/s, optionally depending on the time of day, e.g. 'mon-fri 08:00-18:00 10240' (default: unlimited)")
+	f.StringVar(&globalOptions.LimitSchedule, "limit-schedule", "", "vary the limits by time of day according to `schedule`, e.g. 'mon-fri 08:00-18:00 upload=10240' (default: $RESTIC_LIMIT_SCHEDULE)")
 	f.UintVar(&globalOptions.PackSize, "pack-size", 0, "set target pack `size` in MiB, created pack files may be larger (default: $RESTIC_PACK_SIZE)")
+	f.UintVar(&globalOptions.MaxConnections, "max-connections", 0, "dynamically adjust the number of concurrent backend connections up to `n` based on throughput, latency and throttling (default: use a fixed number of connections)")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
 	f.StringVar(&globalOptions.HTTPUserAgent, "http-user-agent", "", "set a http user agent for outgoing http requests")
 	f.DurationVar(&globalOptions.StuckRequestTimeout, "stuck-request-timeout", 5*time.Minute, "`duration` after which to retry stuck requests")
@@ -148,6 +170,19 @@ func init() {
 	globalOptions.PasswordFile = os.Getenv("RESTIC_PASSWORD_FILE")
 	globalOptions.KeyHint = os.Getenv("RESTIC_KEY_HINT")
 	globalOptions.PasswordCommand = os.Getenv("RESTIC_PASSWORD_COMMAND")
+	globalOptions.VaultPassword = os.Getenv("RESTIC_VAULT_PASSWORD")
+	if os.Getenv("RESTIC_VAULT_ENV") != "" {
+		globalOptions.VaultEnv = strings.Split(os.Getenv("RESTIC_VAULT_ENV"), ",")
+	}
+	globalOptions.TokenCommand = os.Getenv("RESTIC_TOKEN_COMMAND")
+	globalOptions.SigningKeyFile = os.Getenv("RESTIC_SIGNING_KEY_FILE")
+	globalOptions.LogTarget = os.Getenv("RESTIC_LOG_TARGET")
+	globalOptions.AuditLog = os.Getenv("RESTIC_AUDIT_LOG")
+	globalOptions.AuditFormat = os.Getenv("RESTIC_AUDIT_FORMAT")
+	globalOptions.MetricsFile = os.Getenv("RESTIC_METRICS_FILE")
+	globalOptions.MetricsPushgateway = os.Getenv("RESTIC_METRICS_PUSHGATEWAY")
+	globalOptions.MetricsJob = os.Getenv("RESTIC_METRICS_JOB")
+	globalOptions.LimitSchedule = os.Getenv("RESTIC_LIMIT_SCHEDULE")
 	if os.Getenv("RESTIC_CACERT") != "" {
 		globalOptions.RootCertFilenames = strings.Split(os.Getenv("RESTIC_CACERT"), ",")
 	}
@@ -258,6 +293,12 @@ func resolvePassword(opts GlobalOptions, envStr string) (string, error) {
 	if opts.PasswordFile != "" && opts.PasswordCommand != "" {
 		return "", errors.Fatalf("Password file and command are mutually exclusive options")
 	}
+	if opts.VaultPassword != "" {
+		if opts.PasswordFile != "" || opts.PasswordCommand != "" {
+			return "", errors.Fatalf("--vault-password cannot be combined with a password file or command")
+		}
+		return readVaultSecret(context.Background(), opts, opts.VaultPassword)
+	}
 	if opts.PasswordCommand != "" {
 		args, err := backend.SplitShellStrings(opts.PasswordCommand)
 		if err != nil {
@@ -282,6 +323,39 @@ func resolvePassword(opts GlobalOptions, envStr string) (string, error) {
 	return "", nil
 }
 
+// runTokenCommand runs the shell command, passes data on stdin and returns
+// the output of the command. It is used to wrap and unwrap the secrets of
+// token-protected keys, the command is responsible for talking to the token.
+func runTokenCommand(ctx context.Context, command string, data []byte) ([]byte, error) {
+	args, err := backend.SplitShellStrings(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.Fatal("token command is empty")
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Fatalf("token command %q failed: %v", args[0], err)
+	}
+	return output, nil
+}
+
+// tokenUnwrapper returns a function which unwraps the secret of a
+// token-protected key using the given command.
+func tokenUnwrapper(command string) repository.KeyUnwrapFunc {
+	return func(ctx context.Context, wrapped []byte) (string, error) {
+		output, err := runTokenCommand(ctx, command, wrapped)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+}
+
 // loadPasswordFromFile loads a password from a file while stripping a BOM and
 // converting the password to UTF-8.
 func loadPasswordFromFile(pwdFile string) (string, error) {
@@ -433,6 +507,16 @@ func ReadRepo(opts GlobalOptions) (string, error) {
 
 const maxKeys = 20
 
+// checkFIPS returns an error if FIPS mode was requested, but the cryptography
+// is not provided by a FIPS 140 validated module.
+func checkFIPS(opts GlobalOptions) error {
+	if opts.FIPS && !crypto.FIPSModule() {
+		return errors.Fatal("--fips requires a build with a FIPS 140 validated cryptographic module, " +
+			"e.g. built with GOEXPERIMENT=boringcrypto or run with GODEBUG=fips140=on")
+	}
+	return nil
+}
+
 // OpenRepository reads the password and opens the repository.
 func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Repository, error) {
 	repo, err := ReadRepo(opts)
@@ -440,6 +524,11 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 		return nil, err
 	}
 
+	err = checkFIPS(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	be, err := open(ctx, repo, opts, opts.extended)
 	if err != nil {
 		return nil, err
@@ -449,15 +538,29 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 		Compression:   opts.Compression,
 		PackSize:      opts.PackSize * 1024 * 1024,
 		NoExtraVerify: opts.NoExtraVerify,
+		FIPS:          opts.FIPS,
 	})
 	if err != nil {
 		return nil, errors.Fatal(err.Error())
 	}
 
+	helloUnlocked := false
+	if opts.helloUnlock && stdinIsTerminal() && opts.password == "" && !opts.InsecureNoPassword && opts.TokenCommand == "" {
+		helloUnlocked = unlockWithHello(ctx, s, repo, opts)
+	}
+
 	passwordTriesLeft := 1
 	if stdinIsTerminal() && opts.password == "" && !opts.InsecureNoPassword {
 		passwordTriesLeft = 3
 	}
+	if helloUnlocked {
+		passwordTriesLeft = 0
+	}
+	if opts.TokenCommand != "" {
+		// the token command handles any interaction with the user
+		passwordTriesLeft = 0
+		err = s.SearchTokenKey(ctx, tokenUnwrapper(opts.TokenCommand), maxKeys, opts.KeyHint)
+	}
 
 	for ; passwordTriesLeft > 0; passwordTriesLeft-- {
 		opts.password, err = ReadPassword(ctx, opts, "enter password for repository: ")
@@ -473,6 +576,10 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 		}
 
 		err = s.SearchKey(ctx, opts.password, maxKeys, opts.KeyHint)
+		if errors.Is(err, repository.ErrNotFIPS) {
+			// retrying with another password does not help
+			break
+		}
 		if err != nil && passwordTriesLeft > 1 {
 			opts.password = ""
 			fmt.Fprintf(os.Stderr, "%s. Try again\n", err)
@@ -495,6 +602,9 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 			if s.Config().Version >= 2 {
 				extra = ", compression level " + opts.Compression.String()
 			}
+			if s.Config().FIPS() {
+				extra += ", FIPS mode"
+			}
 			Verbosef("repository %v opened (version %v%s)\n", id, s.Config().Version, extra)
 		}
 	}
@@ -548,94 +658,52 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 	return s, nil
 }
 
-func parseConfig(loc location.Location, opts options.Options) (interface{}, error) {
-	cfg := loc.Config
-	if cfg, ok := cfg.(backend.ApplyEnvironmenter); ok {
-		cfg.ApplyEnvironment("")
-	}
-
-	// only apply options for a particular backend here
-	opts = opts.Extract(loc.Scheme)
-	if err := opts.Apply(loc.Scheme, cfg); err != nil {
-		return nil, err
+// bandwidthLimits returns the default upload and download limits and the
+// schedule which varies them. The rules from --limit-schedule take precedence
+// over those passed to --limit-upload and --limit-download.
+func bandwidthLimits(gopts GlobalOptions) (limiter.Limits, limiter.Schedule, error) {
+	schedule, err := limiter.ParseSchedule(gopts.LimitSchedule)
+	if err != nil {
+		return limiter.Limits{}, nil, errors.Fatalf("invalid --limit-schedule: %v", err)
 	}
+	schedule = append(schedule, gopts.LimitUpload.Schedule...)
+	schedule = append(schedule, gopts.LimitDownload.Schedule...)
 
-	debug.Log("opening %v repository at %#v", loc.Scheme, cfg)
-	return cfg, nil
+	limits := limiter.Limits{UploadKb: gopts.LimitUpload.Kb, DownloadKb: gopts.LimitDownload.Kb}
+	return limits, schedule, nil
 }
 
 func innerOpen(ctx context.Context, s string, gopts GlobalOptions, opts options.Options, create bool) (backend.Backend, error) {
-	debug.Log("parsing location %v", location.StripPassword(gopts.backends, s))
-	loc, err := location.Parse(gopts.backends, s)
-	if err != nil {
-		return nil, errors.Fatalf("parsing repository location failed: %v", err)
-	}
-
-	cfg, err := parseConfig(loc, opts)
+	limits, schedule, err := bandwidthLimits(gopts)
 	if err != nil {
 		return nil, err
 	}
 
-	rt, err := backend.Transport(globalOptions.TransportOptions)
-	if err != nil {
+	be, err := setup.Open(ctx, s, setup.Options{
+		Backends:       gopts.backends,
+		Extended:       opts,
+		Transport:      globalOptions.TransportOptions,
+		Limits:         limits,
+		Schedule:       schedule,
+		Share:          gopts.bandwidthShare,
+		MaxConnections: gopts.MaxConnections,
+		Warnf:          Warnf,
+		Failed:         recordBackendError,
+		InnerHook:      gopts.backendInnerTestHook,
+		Hook:           gopts.backendTestHook,
+	}, create)
+
+	var openErr *setup.OpenError
+	switch {
+	case err == nil:
+		return be, nil
+	case errors.As(err, &openErr) && errors.Is(openErr.Err, backend.ErrNoRepository):
+		return nil, fmt.Errorf("Fatal: %w at %v: %v", ErrNoRepository, openErr.Location, openErr.Err)
+	case errors.IsFatal(err):
+		return nil, err
+	default:
 		return nil, errors.Fatal(err.Error())
 	}
-
-	// wrap the transport so that the throughput via HTTP is limited
-	lim := limiter.NewStaticLimiter(gopts.Limits)
-	rt = lim.Transport(rt)
-
-	factory := gopts.backends.Lookup(loc.Scheme)
-	if factory == nil {
-		return nil, errors.Fatalf("invalid backend: %q", loc.Scheme)
-	}
-
-	var be backend.Backend
-	if create {
-		be, err = factory.Create(ctx, cfg, rt, lim)
-	} else {
-		be, err = factory.Open(ctx, cfg, rt, lim)
-	}
-
-	if errors.Is(err, backend.ErrNoRepository) {
-		return nil, fmt.Errorf("Fatal: %w at %v: %v", ErrNoRepository, location.StripPassword(gopts.backends, s), err)
-	}
-	if err != nil {
-		return nil, errors.Fatalf("unable to open repository at %v: %v", location.StripPassword(gopts.backends, s), err)
-	}
-
-	// wrap with debug logging and connection limiting
-	be = logger.New(sema.NewBackend(be))
-
-	// wrap backend if a test specified an inner hook
-	if gopts.backendInnerTestHook != nil {
-		be, err = gopts.backendInnerTestHook(be)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	report := func(msg string, err error, d time.Duration) {
-		if d >= 0 {
-			Warnf("%v returned error, retrying after %v: %v\n", msg, d, err)
-		} else {
-			Warnf("%v failed: %v\n", msg, err)
-		}
-	}
-	success := func(msg string, retries int) {
-		Warnf("%v operation successful after %d retries\n", msg, retries)
-	}
-	be = retry.New(be, 15*time.Minute, report, success)
-
-	// wrap backend if a test specified a hook
-	if gopts.backendTestHook != nil {
-		be, err = gopts.backendTestHook(be)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return be, nil
 }
 
 // Open the backend specified by a location config.
@@ -222,3 +222,20 @@ func TestBackendRetryConfig(t *testing.T) {
 	rtest.Assert(t, wrappedBackend != nil, "backend not wrapped on backup")
 	rtest.Assert(t, wrappedBackend != nil && wrappedBackend.failedOnce, "config loading was not retried on init")
 }
+
+func TestBackendMaxConnections(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	var connections uint
+	env.gopts.backendInnerTestHook = func(r backend.Backend) (backend.Backend, error) {
+		connections = r.Connections()
+		return r, nil
+	}
+	env.gopts.MaxConnections = 7
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	rtest.Equals(t, uint(7), connections)
+	testRunCheck(t, env.gopts)
+}
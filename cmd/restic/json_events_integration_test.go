@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/jsonevents"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+func parseJSONEvents(t testing.TB, buf *bytes.Buffer, command string) []jsonevents.Event {
+	var events []jsonevents.Event
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		var e jsonevents.Event
+		rtest.OK(t, json.Unmarshal(sc.Bytes(), &e))
+		rtest.Equals(t, command, e.Command)
+		events = append(events, e)
+	}
+	rtest.OK(t, sc.Err())
+	rtest.Assert(t, len(events) > 0, "no events found")
+	return events
+}
+
+func TestJSONEvents(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunInit(t, env2.gopts)
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.JSON = true
+	gopts.JSONEvents = true
+	gopts.stdout = buf
+
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+	events := parseJSONEvents(t, buf, "backup")
+	rtest.Equals(t, jsonevents.Event{Event: jsonevents.TypePhase, Command: "backup", Phase: "load index"},
+		jsonevents.Event{Event: events[0].Event, Command: events[0].Command, Phase: events[0].Phase})
+	summary := events[len(events)-1]
+	rtest.Equals(t, jsonevents.TypeSummary, summary.Event)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+	rtest.Equals(t, snapshotID.String(), summary.Summary.(map[string]interface{})["snapshot_id"])
+
+	copyGopts := gopts
+	copyGopts.Repo = env2.gopts.Repo
+	copyGopts.password = env2.gopts.password
+	copyOpts := CopyOptions{secondaryRepoOptions: secondaryRepoOptions{Repo: env.gopts.Repo, password: env.gopts.password}}
+	rtest.OK(t, withTermStatus(copyGopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runCopy(ctx, copyOpts, copyGopts, nil, term)
+	}))
+	events = parseJSONEvents(t, buf, "copy")
+	summary = events[len(events)-1]
+	rtest.Equals(t, jsonevents.TypeSummary, summary.Event)
+	rtest.Equals(t, map[string]interface{}{"snapshots_copied": float64(1), "snapshots_skipped": float64(0)}, summary.Summary)
+}
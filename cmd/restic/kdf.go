@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/spf13/pflag"
+)
+
+// kdfOptions select the key derivation function for new keys.
+type kdfOptions struct {
+	KDF           string
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+func initKDFOptions(f *pflag.FlagSet, opts *kdfOptions) {
+	f.StringVar(&opts.KDF, "kdf", "", "key derivation `function` for the new key, allowed values are 'scrypt' and 'argon2id' (default: $RESTIC_KDF or scrypt)")
+	f.Uint32Var(&opts.Argon2Time, "argon2-time", crypto.DefaultArgon2Params.Time, "number of passes over the memory for argon2id")
+	f.Uint32Var(&opts.Argon2Memory, "argon2-memory", crypto.DefaultArgon2Params.Memory/1024, "memory used by argon2id in `MiB`")
+	f.Uint8Var(&opts.Argon2Threads, "argon2-threads", crypto.DefaultArgon2Params.Threads, "number of threads used by argon2id")
+
+	opts.KDF = os.Getenv("RESTIC_KDF")
+}
+
+// repositoryOptions returns the options for the repository package.
+func (opts kdfOptions) repositoryOptions() (repository.KDFOptions, error) {
+	kdf := repository.KDFOptions{
+		KDF: opts.KDF,
+		Argon2: crypto.Argon2Params{
+			Time:    opts.Argon2Time,
+			Memory:  opts.Argon2Memory * 1024,
+			Threads: opts.Argon2Threads,
+		},
+	}
+	if opts.Argon2Memory > (1<<32-1)/1024 {
+		return repository.KDFOptions{}, errors.Fatalf("--argon2-memory %d MiB is too large", opts.Argon2Memory)
+	}
+	if err := kdf.Check(); err != nil {
+		return repository.KDFOptions{}, errors.Fatalf("invalid key derivation options: %v", err)
+	}
+	return kdf, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// linkKind distinguishes the entries of a snapshot which refer to data stored
+// elsewhere: symlinks, directory junctions and mount points.
+type linkKind string
+
+const (
+	linkKindNone       linkKind = ""
+	linkKindSymlink    linkKind = "symlink"
+	linkKindJunction   linkKind = "junction"
+	linkKindMountPoint linkKind = "mount-point"
+)
+
+// fileAttributeDirectory is FILE_ATTRIBUTE_DIRECTORY, which Windows sets for
+// directory junctions and directory symlinks.
+const fileAttributeDirectory = 0x10
+
+// nodeFileAttributes returns the Windows file attributes stored for node.
+func nodeFileAttributes(node *restic.Node) (uint32, bool) {
+	raw, ok := node.GenericAttributes[restic.TypeFileAttributes]
+	if !ok {
+		return 0, false
+	}
+	var attrs uint32
+	if err := json.Unmarshal(raw, &attrs); err != nil {
+		return 0, false
+	}
+	return attrs, true
+}
+
+// isVolumeTarget reports whether target refers to a volume GUID path, which
+// is the target of a volume mounted into a folder on Windows.
+func isVolumeTarget(target string) bool {
+	for _, prefix := range []string{`\\?\Volume{`, `\??\Volume{`, `Volume{`} {
+		if strings.HasPrefix(target, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkTracker determines the linkKind of the nodes of a snapshot. Directories
+// are detected as mount points if they are stored on a different device than
+// their parent directory, which requires that all directories are passed to
+// enter before their children are passed to kind.
+type linkTracker struct {
+	devices map[string]uint64
+}
+
+func newLinkTracker() *linkTracker {
+	return &linkTracker{devices: make(map[string]uint64)}
+}
+
+// enter records the device of a directory.
+func (t *linkTracker) enter(nodepath string, node *restic.Node) {
+	if node != nil && node.Type == restic.NodeTypeDir {
+		t.devices[nodepath] = node.DeviceID
+	}
+}
+
+// kind returns the linkKind of the node at nodepath.
+func (t *linkTracker) kind(nodepath string, node *restic.Node) linkKind {
+	switch node.Type {
+	case restic.NodeTypeSymlink:
+		if isVolumeTarget(node.LinkTarget) {
+			return linkKindMountPoint
+		}
+		if attrs, ok := nodeFileAttributes(node); ok && attrs&fileAttributeDirectory != 0 {
+			return linkKindJunction
+		}
+		return linkKindSymlink
+	case restic.NodeTypeDir:
+		parent, ok := t.devices[path.Dir(nodepath)]
+		if ok && parent != 0 && node.DeviceID != 0 && parent != node.DeviceID {
+			return linkKindMountPoint
+		}
+	}
+	return linkKindNone
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func withFileAttributes(node restic.Node, attrs uint32) *restic.Node {
+	raw, _ := json.Marshal(attrs)
+	node.GenericAttributes = map[restic.GenericAttributeType]json.RawMessage{restic.TypeFileAttributes: raw}
+	return &node
+}
+
+func TestLinkTracker(t *testing.T) {
+	links := newLinkTracker()
+	links.enter("/home", &restic.Node{Type: restic.NodeTypeDir, DeviceID: 1})
+	links.enter("/unknown", &restic.Node{Type: restic.NodeTypeDir})
+
+	for _, test := range []struct {
+		path string
+		node *restic.Node
+		kind linkKind
+	}{
+		{"/home/file", &restic.Node{Type: restic.NodeTypeFile, DeviceID: 1}, linkKindNone},
+		{"/home/dir", &restic.Node{Type: restic.NodeTypeDir, DeviceID: 1}, linkKindNone},
+		{"/home/usb", &restic.Node{Type: restic.NodeTypeDir, DeviceID: 2}, linkKindMountPoint},
+		{"/unknown/dir", &restic.Node{Type: restic.NodeTypeDir, DeviceID: 2}, linkKindNone},
+		{"/other/dir", &restic.Node{Type: restic.NodeTypeDir, DeviceID: 2}, linkKindNone},
+		{"/home/link", &restic.Node{Type: restic.NodeTypeSymlink, LinkTarget: "/tmp"}, linkKindSymlink},
+		{"/home/file-link", withFileAttributes(restic.Node{Type: restic.NodeTypeSymlink, LinkTarget: `C:\data\file`}, 0x420), linkKindSymlink},
+		{"/home/junction", withFileAttributes(restic.Node{Type: restic.NodeTypeSymlink, LinkTarget: `C:\data`}, 0x410), linkKindJunction},
+		{"/home/volume", &restic.Node{Type: restic.NodeTypeSymlink, LinkTarget: `\\?\Volume{2eca078d-5cbc-43d3-aff8-7e8511f60d0e}\`}, linkKindMountPoint},
+	} {
+		rtest.Equals(t, test.kind, links.kind(test.path, test.node), test.path)
+	}
+}
@@ -3,15 +3,24 @@ package main
 import (
 	"context"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 )
 
-func internalOpenWithLocked(ctx context.Context, gopts GlobalOptions, dryRun bool, exclusive bool) (context.Context, *repository.Repository, func(), error) {
+func internalOpenWithLocked(ctx context.Context, gopts GlobalOptions, dryRun bool, exclusive bool, write bool) (context.Context, *repository.Repository, func(), error) {
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
+	if replica := repo.Config().Replica; write && !dryRun && replica != nil && !gopts.allowReplica {
+		primary := replica.Primary
+		if primary == "" {
+			primary = "another repository"
+		}
+		return nil, nil, nil, errors.Fatalf("repository is a read-only replica of %v, run `restic replicate promote` to make it the primary repository", primary)
+	}
+
 	unlock := func() {}
 	if !dryRun {
 		var lock *repository.Unlocker
@@ -26,23 +35,34 @@ func internalOpenWithLocked(ctx context.Context, gopts GlobalOptions, dryRun boo
 		}
 
 		unlock = lock.Unlock
+
+		// let the key reject the configs replaced in the meantime
+		if write {
+			if err := repo.RecordConfigRevision(ctx); err != nil {
+				Warnf("unable to record the config revision: %v\n", err)
+			}
+		}
 	} else {
 		repo.SetDryRun()
 	}
 
-	return ctx, repo, unlock, nil
+	release := func() {
+		unlock()
+		releaseOpLog(repo)
+	}
+	return ctx, repo, release, nil
 }
 
 func openWithReadLock(ctx context.Context, gopts GlobalOptions, noLock bool) (context.Context, *repository.Repository, func(), error) {
 	// TODO enforce read-only operations once the locking code has moved to the repository
-	return internalOpenWithLocked(ctx, gopts, noLock, false)
+	return internalOpenWithLocked(ctx, gopts, noLock, false, false)
 }
 
 func openWithAppendLock(ctx context.Context, gopts GlobalOptions, dryRun bool) (context.Context, *repository.Repository, func(), error) {
 	// TODO enforce non-exclusive operations once the locking code has moved to the repository
-	return internalOpenWithLocked(ctx, gopts, dryRun, false)
+	return internalOpenWithLocked(ctx, gopts, dryRun, false, true)
 }
 
 func openWithExclusiveLock(ctx context.Context, gopts GlobalOptions, dryRun bool) (context.Context, *repository.Repository, func(), error) {
-	return internalOpenWithLocked(ctx, gopts, dryRun, true)
+	return internalOpenWithLocked(ctx, gopts, dryRun, true, true)
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/logging"
+)
+
+// logSink receives the messages of the running command if --log-target is
+// set.
+var logSink logging.Sink
+
+// logCommand is the name of the running command.
+var logCommand string
+
+// setupLogging opens the log target. Afterwards, all messages written to
+// stderr are logged as warnings. The messages of commands which use the
+// termstatus are logged via logTerminalMessage.
+func setupLogging(gopts *GlobalOptions, command string) error {
+	if gopts.LogTarget == "" {
+		return nil
+	}
+
+	sink, err := logging.Open(gopts.LogTarget, "restic", command)
+	if err != nil {
+		return errors.Fatalf("%v", err)
+	}
+	logSink = sink
+	logCommand = command
+
+	gopts.stderr = logging.NewWriter(gopts.stderr, func(line string) {
+		logMessage(logging.Warning, line)
+	})
+
+	logMessage(logging.Info, fmt.Sprintf("restic %v %v started", version, command))
+	return nil
+}
+
+func logMessage(severity logging.Severity, msg string) {
+	if logSink == nil {
+		return
+	}
+	err := logSink.Log(severity, msg)
+	if err != nil {
+		debug.Log("unable to log message: %v", err)
+	}
+}
+
+// logTerminalMessage logs a message printed via the termstatus. Errors are
+// logged as warnings, as fatal errors are logged by closeLogging. With --json,
+// only errors are logged.
+func logTerminalMessage(json bool) func(line string, isErr bool) {
+	return func(msg string, isErr bool) {
+		if !isErr && json {
+			return
+		}
+		severity := logging.Info
+		if isErr {
+			severity = logging.Warning
+		}
+		for _, line := range strings.Split(msg, "\n") {
+			line = strings.TrimRight(line, "\r")
+			if line != "" {
+				logMessage(severity, line)
+			}
+		}
+	}
+}
+
+// unwrapLogWriter returns the writer wrapped by setupLogging.
+func unwrapLogWriter(wr io.Writer) io.Writer {
+	if lw, ok := wr.(*logging.Writer); ok {
+		return lw.Unwrap()
+	}
+	return wr
+}
+
+// closeLogging logs the result of the command and closes the log target.
+// Messages written afterwards are not logged.
+func closeLogging(code int, message string) {
+	if logSink == nil {
+		return
+	}
+
+	switch code {
+	case exitCodeSuccess:
+		logMessage(logging.Notice, fmt.Sprintf("restic %v completed successfully", logCommand))
+	case exitCodeWarnings:
+		logMessage(logging.Warning, fmt.Sprintf("restic %v completed with warnings (exit status %d)", logCommand, code))
+	case exitCodeInvalidSourceData:
+		logMessage(logging.Warning, fmt.Sprintf("restic %v completed with warnings (exit status %d): %v", logCommand, code, strings.TrimPrefix(message, "Warning: ")))
+	default:
+		logMessage(logging.Error, fmt.Sprintf("restic %v failed (exit status %d): %v", logCommand, code, message))
+	}
+
+	sink := logSink
+	logSink = nil
+	err := sink.Close()
+	if err != nil {
+		debug.Log("unable to close log target: %v", err)
+	}
+}
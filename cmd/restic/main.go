@@ -3,13 +3,13 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
 	godebug "runtime/debug"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/automaxprocs/maxprocs"
@@ -59,15 +59,39 @@ The full documentation can be found at https://restic.readthedocs.io/ .
 			globalOptions.verbosity = 0
 		}
 
+		if globalOptions.JSONEvents {
+			globalOptions.JSON = true
+		}
+
+		// record the running command in the locks created by this process
+		restic.LockOperation = strings.TrimPrefix(c.CommandPath(), c.Root().Name()+" ")
+
+		err := setupLogging(&globalOptions, restic.LockOperation)
+		if err != nil {
+			return err
+		}
+
+		err = setupAudit(globalOptions, restic.LockOperation)
+		if err != nil {
+			return err
+		}
+
+		setupMetrics(globalOptions, restic.LockOperation)
+
 		// parse extended options
 		opts, err := options.Parse(globalOptions.Options)
 		if err != nil {
 			return err
 		}
 		globalOptions.extended = opts
+		globalOptions.helloUnlock = runtime.GOOS == "windows" && helloUnlockCommand(c.Name())
 		if !needsPassword(c.Name()) {
 			return nil
 		}
+		err = applyVaultEnv(c.Context(), globalOptions)
+		if err != nil {
+			return err
+		}
 		pwd, err := resolvePassword(globalOptions, "RESTIC_PASSWORD")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Resolving password failed: %v\n", err)
@@ -80,6 +104,7 @@ The full documentation can be found at https://restic.readthedocs.io/ .
 		return runDebug()
 	},
 	PersistentPostRun: func(_ *cobra.Command, _ []string) {
+		closeVault()
 		stopDebug()
 	},
 }
@@ -105,7 +130,7 @@ func init() {
 // user for authentication).
 func needsPassword(cmd string) bool {
 	switch cmd {
-	case "cache", "generate", "help", "options", "self-update", "version", "__complete":
+	case "cache", "generate", "help", "options", "rest", "self-update", "version", "__complete":
 		return false
 	default:
 		return true
@@ -120,17 +145,19 @@ func tweakGoGC() {
 	}
 }
 
-func printExitError(code int, message string) {
+func printExitError(code int, category string, message string) {
 	if globalOptions.JSON {
 		type jsonExitError struct {
 			MessageType string `json:"message_type"` // exit_error
 			Code        int    `json:"code"`
+			Category    string `json:"category"`
 			Message     string `json:"message"`
 		}
 
 		jsonS := jsonExitError{
 			MessageType: "exit_error",
 			Code:        code,
+			Category:    category,
 			Message:     message,
 		}
 
@@ -179,6 +206,8 @@ func main() {
 		exitMessage = fmt.Sprintf("%v\nthe `unlock` command can be used to remove stale locks", err)
 	case err == ErrInvalidSourceData:
 		exitMessage = fmt.Sprintf("Warning: %v", err)
+	case err == ErrCheckpoint:
+		exitMessage = err.Error()
 	case errors.IsFatal(err):
 		exitMessage = err.Error()
 	case errors.Is(err, repository.ErrNoKeyFound):
@@ -195,26 +224,15 @@ func main() {
 		}
 	}
 
-	var exitCode int
-	switch {
-	case err == nil:
-		exitCode = 0
-	case err == ErrInvalidSourceData:
-		exitCode = 3
-	case errors.Is(err, ErrNoRepository):
-		exitCode = 10
-	case restic.IsAlreadyLocked(err):
-		exitCode = 11
-	case errors.Is(err, repository.ErrNoKeyFound):
-		exitCode = 12
-	case errors.Is(err, context.Canceled):
-		exitCode = 130
-	default:
-		exitCode = 1
+	code, category := exitCode(err, warningsReported.Load())
+	if code == exitCodeWarnings {
+		exitMessage = "Warning: the command completed with warnings"
 	}
-
-	if exitCode != 0 {
-		printExitError(exitCode, exitMessage)
+	closeAudit()
+	writeMetrics(code)
+	closeLogging(code, exitMessage)
+	if code != exitCodeSuccess {
+		printExitError(code, category, exitMessage)
 	}
-	Exit(exitCode)
+	Exit(code)
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/restic/restic/internal/metrics"
+)
+
+// jobMetrics collects the outcome of the command if --metrics-file or
+// --metrics-pushgateway is set.
+var jobMetrics *metrics.Job
+
+// pushTimeout limits the time spent pushing metrics.
+const pushTimeout = 30 * time.Second
+
+// setupMetrics starts collecting metrics about command.
+func setupMetrics(gopts GlobalOptions, command string) {
+	if gopts.MetricsFile == "" && gopts.MetricsPushgateway == "" {
+		return
+	}
+
+	jobMetrics = &metrics.Job{Command: command, Start: time.Now()}
+}
+
+// recordMetrics records the data processed by the command and the number of
+// files which could not be processed. snapshotID is the ID of the snapshot
+// created by the command, if any.
+func recordMetrics(stats metrics.Stats, errors uint64, snapshotID string) {
+	if jobMetrics == nil {
+		return
+	}
+	jobMetrics.Stats = &stats
+	jobMetrics.Errors = errors
+	jobMetrics.SnapshotID = snapshotID
+}
+
+// writeMetrics writes the metrics to the file and pushes them to the
+// Pushgateway. Failures are reported as warnings.
+func writeMetrics(exitCode int) {
+	if jobMetrics == nil {
+		return
+	}
+
+	job := jobMetrics
+	jobMetrics = nil
+	job.End = time.Now()
+	job.ExitCode = exitCode
+
+	name := globalOptions.MetricsJob
+	if name == "" {
+		name = "restic"
+	}
+
+	if globalOptions.MetricsFile != "" {
+		// the job label is set by Prometheus when scraping the node exporter
+		err := job.WriteFile(globalOptions.MetricsFile, []metrics.Label{{Name: "job_name", Value: name}})
+		if err != nil {
+			Warnf("unable to write metrics: %v\n", err)
+		}
+	}
+
+	if globalOptions.MetricsPushgateway != "" {
+		var labels []metrics.Label
+		if host, err := os.Hostname(); err == nil {
+			labels = append(labels, metrics.Label{Name: "host", Value: host})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+		defer cancel()
+		err := job.Push(ctx, globalOptions.MetricsPushgateway, name, labels)
+		if err != nil {
+			Warnf("unable to push metrics: %v\n", err)
+		}
+	}
+}
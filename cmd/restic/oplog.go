@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/oplog"
+	"github.com/restic/restic/internal/repository"
+)
+
+// loadedOpLogs keeps the operation logs already loaded by recordOperation, so
+// that commands which record several operations, like forget with --prune,
+// list the operation log only once. A log is only valid while the repository
+// is locked, it is dropped by releaseOpLog once the lock is released.
+var loadedOpLogs = struct {
+	sync.Mutex
+	logs map[*repository.Repository]*oplog.Log
+}{logs: make(map[*repository.Repository]*oplog.Log)}
+
+// recordOperation appends rec to the operation log of the repository. Unless
+// already set, the key ID of the record is set to the key currently used to
+// access the repository.
+func recordOperation(ctx context.Context, repo *repository.Repository, rec *oplog.Record) error {
+	if rec.KeyID == nil {
+		keyID := repo.KeyID()
+		rec.KeyID = &keyID
+	}
+
+	loadedOpLogs.Lock()
+	defer loadedOpLogs.Unlock()
+
+	log, err := loadOpLog(ctx, repo)
+	if err != nil {
+		return fmt.Errorf("unable to record %v in the operation log: %w", rec.Operation, err)
+	}
+
+	_, err = log.Append(ctx, repo, rec)
+	if err != nil {
+		delete(loadedOpLogs.logs, repo)
+		return fmt.Errorf("unable to record %v in the operation log: %w", rec.Operation, err)
+	}
+	return nil
+}
+
+// loadOpLog returns the operation log of the repository, which is only listed
+// once. The caller must hold the lock of loadedOpLogs.
+func loadOpLog(ctx context.Context, repo *repository.Repository) (*oplog.Log, error) {
+	if log, ok := loadedOpLogs.logs[repo]; ok {
+		return log, nil
+	}
+	log, err := oplog.Load(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	loadedOpLogs.logs[repo] = log
+	return log, nil
+}
+
+// releaseOpLog drops the cached operation log of the repository.
+func releaseOpLog(repo *repository.Repository) {
+	loadedOpLogs.Lock()
+	defer loadedOpLogs.Unlock()
+	delete(loadedOpLogs.logs, repo)
+}
+
+// removedSince returns the number of snapshots removed without approval after
+// since, according to the operation log.
+func removedSince(ctx context.Context, repo *repository.Repository, since time.Time) (uint, error) {
+	loadedOpLogs.Lock()
+	defer loadedOpLogs.Unlock()
+
+	log, err := loadOpLog(ctx, repo)
+	if err != nil {
+		return 0, fmt.Errorf("unable to load the operation log: %w", err)
+	}
+	return log.Removed(since), nil
+}
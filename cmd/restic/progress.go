@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/jsonevents"
 	"github.com/restic/restic/internal/ui/progress"
 	"github.com/restic/restic/internal/ui/termstatus"
 )
@@ -102,6 +103,24 @@ func printProgress(status string, final bool) {
 	}
 }
 
+// newJSONEvents returns the event stream for command if --json-events is set,
+// and nil otherwise.
+func newJSONEvents(gopts GlobalOptions, term ui.Terminal, command string) *jsonevents.Stream {
+	if !gopts.JSONEvents {
+		return nil
+	}
+	return jsonevents.New(term, command, calculateProgressInterval(!gopts.Quiet, true))
+}
+
+// newIndexEventsProgress returns a counter for loading the index. It reports
+// to events if set, otherwise it works like newIndexTerminalProgress.
+func newIndexEventsProgress(gopts GlobalOptions, events *jsonevents.Stream, term *termstatus.Terminal) *progress.Counter {
+	if events != nil {
+		return events.NewCounter("index files loaded")
+	}
+	return newIndexTerminalProgress(gopts.Quiet, gopts.JSON, term)
+}
+
 func newIndexProgress(quiet bool, json bool) *progress.Counter {
 	return newProgressMax(!quiet && !json && stdoutIsTerminal(), 0, "index files loaded")
 }
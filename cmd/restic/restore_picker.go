@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+const restorePickerHelp = `commands:
+  ls [dir]          list the contents of the current or the given directory
+  cd dir            change the current directory
+  pwd               print the current directory
+  mark pattern...   mark files or directories for restore, supports wildcards
+  unmark pattern... remove marks from files or directories
+  marked            list all marked files and directories
+  done              finish the selection and start the restore
+  quit              abort without restoring anything
+`
+
+// restorePicker implements a small shell which allows navigating the tree of a
+// snapshot and marking files and directories for restore. All paths are
+// slash-separated and relative to the root of the restored tree.
+type restorePicker struct {
+	repo   restic.BlobLoader
+	root   restic.ID
+	cwd    string
+	trees  map[string]*restic.Tree
+	marked map[string]struct{}
+	out    io.Writer
+}
+
+func newRestorePicker(repo restic.BlobLoader, root restic.ID, out io.Writer) *restorePicker {
+	return &restorePicker{
+		repo:   repo,
+		root:   root,
+		cwd:    "/",
+		trees:  make(map[string]*restic.Tree),
+		marked: make(map[string]struct{}),
+		out:    out,
+	}
+}
+
+// Run reads commands from in until the selection is finished and returns the
+// marked paths in sorted order.
+func (p *restorePicker) Run(ctx context.Context, in io.Reader) ([]string, error) {
+	p.printf("%s", restorePickerHelp)
+
+	sc := bufio.NewScanner(in)
+	for {
+		p.printf("%s> ", p.cwd)
+		if !sc.Scan() {
+			if sc.Err() != nil {
+				return nil, errors.Wrap(sc.Err(), "read command")
+			}
+			p.printf("\n")
+			return nil, errors.Fatal("restore aborted")
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		args := strings.Fields(sc.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		var err error
+		switch args[0] {
+		case "ls":
+			err = p.ls(ctx, args[1:])
+		case "cd":
+			err = p.cd(ctx, args[1:])
+		case "pwd":
+			p.printf("%s\n", p.cwd)
+		case "mark":
+			err = p.mark(ctx, args[1:])
+		case "unmark":
+			err = p.unmark(ctx, args[1:])
+		case "marked":
+			for _, item := range p.Marked() {
+				p.printf("%s\n", item)
+			}
+		case "done":
+			if len(p.marked) == 0 {
+				p.printf("nothing is marked for restore, use \"mark\" to select files or \"quit\" to abort\n")
+				continue
+			}
+			return p.Marked(), nil
+		case "quit", "exit":
+			return nil, errors.Fatal("restore aborted")
+		case "help", "?":
+			p.printf("%s", restorePickerHelp)
+		default:
+			err = errors.Errorf("unknown command %q, type \"help\" for a list of commands", args[0])
+		}
+
+		if err != nil {
+			p.printf("error: %v\n", err)
+		}
+	}
+}
+
+func (p *restorePicker) printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(p.out, format, args...)
+}
+
+// Marked returns the marked paths in sorted order.
+func (p *restorePicker) Marked() []string {
+	items := make([]string, 0, len(p.marked))
+	for item := range p.marked {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return items
+}
+
+func (p *restorePicker) abs(dir string) string {
+	if path.IsAbs(dir) {
+		return path.Clean(dir)
+	}
+	return path.Join(p.cwd, dir)
+}
+
+// loadDir returns the tree for the directory at the absolute path dir.
+func (p *restorePicker) loadDir(ctx context.Context, dir string) (*restic.Tree, error) {
+	if tree, ok := p.trees[dir]; ok {
+		return tree, nil
+	}
+
+	var id restic.ID
+	if dir == "/" {
+		id = p.root
+	} else {
+		parent, err := p.loadDir(ctx, path.Dir(dir))
+		if err != nil {
+			return nil, err
+		}
+		node := parent.Find(path.Base(dir))
+		if node == nil {
+			return nil, errors.Errorf("%v: no such file or directory", dir)
+		}
+		if node.Type != restic.NodeTypeDir || node.Subtree == nil {
+			return nil, errors.Errorf("%v: not a directory", dir)
+		}
+		id = *node.Subtree
+	}
+
+	tree, err := restic.LoadTree(ctx, p.repo, id)
+	if err != nil {
+		return nil, err
+	}
+	p.trees[dir] = tree
+	return tree, nil
+}
+
+// markedAncestor returns the marked path which contains item, if any.
+func (p *restorePicker) markedAncestor(item string) (string, bool) {
+	for dir := item; ; dir = path.Dir(dir) {
+		if _, ok := p.marked[dir]; ok {
+			return dir, true
+		}
+		if dir == "/" {
+			return "", false
+		}
+	}
+}
+
+// hasMarkedChild reports whether any path below dir is marked.
+func (p *restorePicker) hasMarkedChild(dir string) bool {
+	for item := range p.marked {
+		if item != dir && strings.HasPrefix(item, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *restorePicker) ls(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("ls expects at most one directory")
+	}
+	dir := p.cwd
+	if len(args) == 1 {
+		dir = p.abs(args[0])
+	}
+
+	tree, err := p.loadDir(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		item := path.Join(dir, node.Name)
+		mark := " "
+		if _, ok := p.markedAncestor(item); ok {
+			mark = "*"
+		} else if node.Type == restic.NodeTypeDir && p.hasMarkedChild(item) {
+			mark = "+"
+		}
+		name := node.Name
+		if node.Type == restic.NodeTypeDir {
+			name += "/"
+		}
+		p.printf("%s %s\n", mark, name)
+	}
+	return nil
+}
+
+func (p *restorePicker) cd(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("cd expects exactly one directory")
+	}
+	dir := p.abs(args[0])
+	if _, err := p.loadDir(ctx, dir); err != nil {
+		return err
+	}
+	p.cwd = dir
+	return nil
+}
+
+// match returns the absolute paths of all nodes matching the pattern. Only
+// the last path component may contain wildcards.
+func (p *restorePicker) match(ctx context.Context, pattern string) ([]string, error) {
+	pattern = p.abs(pattern)
+	if pattern == "/" {
+		return []string{"/"}, nil
+	}
+
+	dir, name := path.Split(pattern)
+	tree, err := p.loadDir(ctx, path.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []string
+	for _, node := range tree.Nodes {
+		ok, err := path.Match(name, node.Name)
+		if err != nil {
+			return nil, errors.Errorf("invalid pattern %q: %v", name, err)
+		}
+		if ok {
+			items = append(items, path.Join(dir, node.Name))
+		}
+	}
+	if len(items) == 0 {
+		return nil, errors.Errorf("%v: no such file or directory", pattern)
+	}
+	return items, nil
+}
+
+func (p *restorePicker) mark(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("mark expects at least one pattern")
+	}
+	for _, pattern := range args {
+		items, err := p.match(ctx, pattern)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if _, ok := p.markedAncestor(item); ok {
+				continue
+			}
+			// the new mark replaces all marks below it
+			for marked := range p.marked {
+				if strings.HasPrefix(marked, strings.TrimSuffix(item, "/")+"/") {
+					delete(p.marked, marked)
+				}
+			}
+			p.marked[item] = struct{}{}
+			p.printf("marked %s\n", item)
+		}
+	}
+	return nil
+}
+
+func (p *restorePicker) unmark(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("unmark expects at least one pattern")
+	}
+	for _, pattern := range args {
+		items, err := p.match(ctx, pattern)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if _, ok := p.marked[item]; ok {
+				delete(p.marked, item)
+				p.printf("unmarked %s\n", item)
+				continue
+			}
+			if ancestor, ok := p.markedAncestor(item); ok {
+				return errors.Errorf("%v is marked via %v, unmark the directory and mark its contents individually instead", item, ancestor)
+			}
+		}
+	}
+	return nil
+}
+
+// selectMarkedFilter returns a restore filter which selects the marked paths
+// and everything below them.
+func selectMarkedFilter(marked []string) func(item string, isDir bool) (selectedForRestore bool, childMayBeSelected bool) {
+	paths := make([]string, 0, len(marked))
+	for _, item := range marked {
+		paths = append(paths, filepath.FromSlash(item))
+	}
+
+	return func(item string, isDir bool) (selectedForRestore bool, childMayBeSelected bool) {
+		for _, p := range paths {
+			if fs.HasPathPrefix(p, item) {
+				return true, isDir
+			}
+			if isDir && fs.HasPathPrefix(item, p) {
+				childMayBeSelected = true
+			}
+		}
+		return false, childMayBeSelected
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSelectMarkedFilter(t *testing.T) {
+	filter := selectMarkedFilter([]string{"/home/user/docs", "/etc/hosts"})
+
+	for _, test := range []struct {
+		item               string
+		isDir              bool
+		selected, children bool
+	}{
+		{"/home", true, false, true},
+		{"/home/user", true, false, true},
+		{"/home/user/docs", true, true, true},
+		{"/home/user/docs/file", false, true, false},
+		{"/home/user/music", true, false, false},
+		{"/home/user/docs2", false, false, false},
+		{"/etc", true, false, true},
+		{"/etc/hosts", false, true, false},
+		{"/etc/passwd", false, false, false},
+		{"/var", true, false, false},
+	} {
+		selected, children := filter(filepath.FromSlash(test.item), test.isDir)
+		rtest.Equals(t, test.selected, selected, test.item)
+		rtest.Equals(t, test.children, children, test.item)
+	}
+}
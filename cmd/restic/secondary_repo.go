@@ -75,6 +75,8 @@ func fillSecondaryGlobalOpts(ctx context.Context, opts secondaryRepoOptions, gop
 
 	var err error
 	dstGopts := gopts
+	// the vault password only applies to the primary repository
+	dstGopts.VaultPassword = ""
 	var pwdEnv string
 
 	if hasFromRepo {
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// loadSigningKey loads the Ed25519 private key used to sign snapshots from a
+// PEM encoded PKCS#8 file, as created by `openssl genpkey -algorithm ed25519`.
+// If no file is specified, nil is returned.
+func loadSigningKey(filename string) (ed25519.PrivateKey, error) {
+	if filename == "" {
+		return nil, nil
+	}
+
+	block, err := readPEMFile(filename, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Fatalf("unable to parse signing key %v: %v", filename, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Fatalf("signing key %v is not an Ed25519 key", filename)
+	}
+	return priv, nil
+}
+
+// loadVerifyKey loads an Ed25519 public key from a PEM encoded PKIX file, as
+// created by `openssl pkey -pubout`.
+func loadVerifyKey(filename string) (ed25519.PublicKey, error) {
+	block, err := readPEMFile(filename, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Fatalf("unable to parse public key %v: %v", filename, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.Fatalf("public key %v is not an Ed25519 key", filename)
+	}
+	return pub, nil
+}
+
+func readPEMFile(filename string, blockType string) (*pem.Block, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read key: %v", err)
+	}
+
+	block, _ := pem.Decode(buf)
+	if block == nil || block.Type != blockType {
+		return nil, errors.Fatalf("%v does not contain a PEM encoded %v", filename, blockType)
+	}
+	return block, nil
+}
+
+// updateSnapshotSignature must be called before saving a modified snapshot.
+// It signs the snapshot if a signing key is available, otherwise an existing
+// signature is removed as it is no longer valid.
+func updateSnapshotSignature(sn *restic.Snapshot, key ed25519.PrivateKey) error {
+	if key == nil {
+		if sn.Signature != nil {
+			Verbosef("removing signature of modified snapshot %v, use --signing-key to sign it again\n", sn.ID().Str())
+		}
+		sn.Signature = nil
+		return nil
+	}
+	return sn.Sign(key)
+}
@@ -21,7 +21,11 @@ func setupTermstatus() (*termstatus.Terminal, func()) {
 	// only shutdown once cancel is called to ensure that no output is lost
 	cancelCtx, cancel := context.WithCancel(context.Background())
 
-	term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+	// messages are logged by the terminal, not when writing them to stderr
+	term := termstatus.New(globalOptions.stdout, unwrapLogWriter(globalOptions.stderr), globalOptions.Quiet)
+	if logSink != nil {
+		term.SetLogger(logTerminalMessage(globalOptions.JSON))
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
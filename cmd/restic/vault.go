@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/vault"
+)
+
+var (
+	vaultClientOnce sync.Once
+	vaultClientInst *vault.Client
+	vaultClientErr  error
+)
+
+// vaultClient returns the client used for all secrets read from Vault during
+// this run, such that the token and the secrets are only fetched once.
+func vaultClient(opts GlobalOptions) (*vault.Client, error) {
+	vaultClientOnce.Do(func() {
+		cfg := vault.ConfigFromEnv()
+		if opts.VaultAddress != "" {
+			cfg.Address = opts.VaultAddress
+		}
+		vaultClientInst, vaultClientErr = vault.New(cfg)
+	})
+	return vaultClientInst, vaultClientErr
+}
+
+// readVaultSecret returns the value of the secret referenced by s, which has
+// the form "path#field".
+func readVaultSecret(ctx context.Context, opts GlobalOptions, s string) (string, error) {
+	ref, err := vault.ParseRef(s)
+	if err != nil {
+		return "", errors.Fatalf("%v", err)
+	}
+	client, err := vaultClient(opts)
+	if err != nil {
+		return "", errors.Fatalf("%v", err)
+	}
+	value, err := client.Get(ctx, ref)
+	if err != nil {
+		return "", errors.Fatalf("unable to read %v from vault: %v", ref, err)
+	}
+	return value, nil
+}
+
+// applyVaultEnv reads the secrets listed in opts.VaultEnv and sets the
+// corresponding environment variables, before they are read by the
+// backends. Each entry has the form "NAME=path#field".
+func applyVaultEnv(ctx context.Context, opts GlobalOptions) error {
+	for _, entry := range opts.VaultEnv {
+		name, ref, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			return errors.Fatalf("invalid --vault-env %q, expected NAME=path#field", entry)
+		}
+		value, err := readVaultSecret(ctx, opts, ref)
+		if err != nil {
+			return err
+		}
+		err = os.Setenv(name, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeVault stops the renewal of the Vault token.
+func closeVault() {
+	if vaultClientInst != nil {
+		vaultClientInst.Close()
+	}
+}
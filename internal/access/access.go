@@ -0,0 +1,282 @@
+// Package access restricts which files of a snapshot users may browse and
+// restore when snapshots are served to other programs. A policy maps users,
+// groups and client hosts to the subtrees of the snapshots they may access,
+// and can additionally require that the stored Windows security descriptor of
+// a file grants read access to the user.
+package access
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// Identity describes who sent a request.
+type Identity struct {
+	// User is the name of the authenticated user, it is empty for anonymous
+	// requests.
+	User string
+	// Groups are the groups the user belongs to.
+	Groups []string
+	// Host is the address of the client, if known.
+	Host net.IP
+}
+
+// principal matches identities.
+type principal struct {
+	kind  string
+	name  string
+	hosts *net.IPNet
+}
+
+func parsePrincipal(s string) (principal, error) {
+	if s == "*" {
+		return principal{kind: "*"}, nil
+	}
+
+	kind, name, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return principal{}, fmt.Errorf("invalid principal %q", s)
+	}
+
+	switch kind {
+	case "user", "group":
+		return principal{kind: kind, name: name}, nil
+	case "host":
+		if !strings.Contains(name, "/") {
+			ip := net.ParseIP(name)
+			if ip == nil {
+				return principal{}, fmt.Errorf("invalid host %q", name)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			return principal{kind: kind, hosts: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}}, nil
+		}
+		_, hosts, err := net.ParseCIDR(name)
+		if err != nil {
+			return principal{}, fmt.Errorf("invalid host %q", name)
+		}
+		return principal{kind: kind, hosts: hosts}, nil
+	}
+	return principal{}, fmt.Errorf("invalid principal %q", s)
+}
+
+func (p principal) matches(id Identity) bool {
+	switch p.kind {
+	case "*":
+		return true
+	case "user":
+		return id.User != "" && id.User == p.name
+	case "group":
+		for _, group := range id.Groups {
+			if group == p.name {
+				return true
+			}
+		}
+	case "host":
+		return id.Host != nil && p.hosts.Contains(id.Host)
+	}
+	return false
+}
+
+type rule struct {
+	principal principal
+	path      string
+}
+
+type sidMapping struct {
+	principal principal
+	sid       string
+}
+
+// Policy describes which parts of the snapshots may be accessed.
+type Policy struct {
+	rules              []rule
+	sids               []sidMapping
+	enforceDescriptors bool
+}
+
+// Load reads a policy from a file.
+func Load(filename string) (*Policy, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return Parse(f, filename)
+}
+
+// Parse reads a policy, filename is only used in error messages. Each line
+// contains one of the following statements, empty lines and lines starting
+// with # are ignored:
+//
+//	allow <principal> <path>   allow access to the subtree at path
+//	sid <principal> <SID>      add the Windows SID to matching identities
+//	enforce-descriptors        also check stored security descriptors
+//
+// A principal is "user:<name>", "group:<name>", "host:<address or CIDR>" or
+// "*" for everyone. Paths are absolute paths within the snapshots, they extend
+// to the end of the line and may contain spaces.
+func Parse(rd io.Reader, filename string) (*Policy, error) {
+	p := &Policy{}
+
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		fields := splitFields(sc.Text(), 3)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var err error
+		switch {
+		case fields[0] == "allow" && len(fields) == 3:
+			err = p.addRule(fields[1], fields[2])
+		case fields[0] == "sid" && len(fields) == 3:
+			err = p.addSID(fields[1], fields[2])
+		case fields[0] == "enforce-descriptors" && len(fields) == 1:
+			p.enforceDescriptors = true
+		default:
+			err = fmt.Errorf("invalid statement %q", fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: line %d: %w", filename, line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// splitFields splits s into at most n fields separated by white space. The
+// last field contains the remainder of s without trailing white space.
+func splitFields(s string, n int) []string {
+	var fields []string
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return fields
+		}
+		i := strings.IndexFunc(s, unicode.IsSpace)
+		if len(fields) == n-1 || i < 0 {
+			return append(fields, s)
+		}
+		fields = append(fields, s[:i])
+		s = s[i:]
+	}
+}
+
+func (p *Policy) addRule(who, dir string) error {
+	pr, err := parsePrincipal(who)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(dir, "/") {
+		return fmt.Errorf("path %q is not absolute", dir)
+	}
+	p.rules = append(p.rules, rule{principal: pr, path: path.Clean(dir)})
+	return nil
+}
+
+func (p *Policy) addSID(who, sid string) error {
+	pr, err := parsePrincipal(who)
+	if err != nil {
+		return err
+	}
+	sid, err = parseSIDString(sid)
+	if err != nil {
+		return err
+	}
+	p.sids = append(p.sids, sidMapping{principal: pr, sid: sid})
+	return nil
+}
+
+// Access describes how a file or directory may be accessed.
+type Access int
+
+const (
+	// Denied files and directories are hidden.
+	Denied Access = iota
+	// Traverse is granted for directories which contain an allowed subtree.
+	// Only the entries leading to allowed subtrees are visible.
+	Traverse
+	// Granted files may be read, all entries of granted directories are
+	// visible unless they are denied by their security descriptors.
+	Granted
+)
+
+// Checker decides which files an identity may access.
+type Checker struct {
+	paths       []string
+	sids        map[string]struct{}
+	descriptors bool
+}
+
+// For returns the checker for id. For a nil policy, it returns nil, which
+// grants access to everything.
+func (p *Policy) For(id Identity) *Checker {
+	if p == nil {
+		return nil
+	}
+
+	c := &Checker{descriptors: p.enforceDescriptors, sids: make(map[string]struct{})}
+	for _, r := range p.rules {
+		if r.principal.matches(id) {
+			c.paths = append(c.paths, r.path)
+		}
+	}
+
+	c.sids[sidEveryone] = struct{}{}
+	if id.User != "" {
+		c.sids[sidAuthenticatedUsers] = struct{}{}
+	}
+	for _, m := range p.sids {
+		if m.principal.matches(id) {
+			c.sids[m.sid] = struct{}{}
+		}
+	}
+	return c
+}
+
+// within reports whether p is dir or contained in it.
+func within(p, dir string) bool {
+	return dir == "/" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// Check returns how the file or directory node at path p may be accessed. The
+// path is the absolute path within the snapshot, node is nil for the root
+// directory of a snapshot. Security descriptors of parent directories are not
+// considered, callers must check each directory on the path.
+func (c *Checker) Check(p string, node *restic.Node) Access {
+	if c == nil {
+		return Granted
+	}
+	p = path.Clean("/" + p)
+
+	access := Denied
+	for _, dir := range c.paths {
+		if within(p, dir) {
+			access = Granted
+			break
+		}
+		if within(dir, p) && (node == nil || node.Type == restic.NodeTypeDir) {
+			access = Traverse
+		}
+	}
+
+	if access == Granted && c.descriptors && node != nil && !c.descriptorAllows(node) {
+		return Denied
+	}
+	return access
+}
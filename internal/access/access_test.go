@@ -0,0 +1,174 @@
+package access
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+const testPolicy = `
+# users see their home directory
+allow user:alice /home/alice
+allow group:finance /srv/finance/
+allow host:10.0.0.0/24 /srv/public
+allow * /pub
+allow user:alice /srv/shared files
+
+sid user:alice S-1-5-21-1-2-3-1001
+sid group:finance s-1-5-21-1-2-3-2001
+`
+
+var (
+	dir  = &restic.Node{Type: restic.NodeTypeDir}
+	file = &restic.Node{Type: restic.NodeTypeFile}
+)
+
+func TestCheck(t *testing.T) {
+	p, err := Parse(strings.NewReader(testPolicy), "policy")
+	rtest.OK(t, err)
+
+	alice := p.For(Identity{User: "alice"})
+	bob := p.For(Identity{User: "bob", Groups: []string{"finance"}, Host: net.ParseIP("10.0.0.5")})
+	anonymous := p.For(Identity{})
+
+	for _, test := range []struct {
+		checker *Checker
+		path    string
+		node    *restic.Node
+		access  Access
+	}{
+		{alice, "/", nil, Traverse},
+		{alice, "/home", dir, Traverse},
+		{alice, "/home", file, Denied},
+		{alice, "/home/alice", dir, Granted},
+		{alice, "/home/alice/doc", file, Granted},
+		{alice, "/home/alice2", dir, Denied},
+		{alice, "/home/bob", dir, Denied},
+		{alice, "/home/alice/../bob", dir, Denied},
+		{alice, "/pub/x", file, Granted},
+		{alice, "/srv/shared files/x", file, Granted},
+		{bob, "/srv", dir, Traverse},
+		{bob, "/srv/finance/report", file, Granted},
+		{bob, "/srv/public/x", file, Granted},
+		{bob, "/home/alice", dir, Denied},
+		{anonymous, "/srv", dir, Denied},
+		{anonymous, "/pub", dir, Granted},
+		{nil, "/home/alice", dir, Granted},
+	} {
+		rtest.Equals(t, test.access, test.checker.Check(test.path, test.node), fmt.Sprintf("path %v", test.path))
+	}
+
+	var nilPolicy *Policy
+	rtest.Equals(t, Granted, nilPolicy.For(Identity{}).Check("/secret", file))
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, policy := range []string{
+		"allow user:alice home",
+		"allow alice /home",
+		"allow host:10.0.0.300 /",
+		"sid user:alice X-1-5",
+		"deny user:alice /",
+		"allow user:alice",
+	} {
+		_, err := Parse(strings.NewReader(policy), "policy")
+		rtest.Assert(t, err != nil, "expected error for %q", policy)
+	}
+}
+
+// binarySID encodes a SID of the form S-1-<authority>-<sub>...
+func binarySID(authority byte, subs ...uint32) []byte {
+	buf := []byte{1, byte(len(subs)), 0, 0, 0, 0, 0, authority}
+	for _, sub := range subs {
+		buf = binary.LittleEndian.AppendUint32(buf, sub)
+	}
+	return buf
+}
+
+type testACE struct {
+	typ   byte
+	flags byte
+	mask  uint32
+	sid   []byte
+}
+
+// securityDescriptor returns a self-relative security descriptor with a DACL
+// containing the entries.
+func securityDescriptor(aces ...testACE) []byte {
+	var body []byte
+	for _, ace := range aces {
+		size := 8 + len(ace.sid)
+		body = append(body, ace.typ, ace.flags)
+		body = binary.LittleEndian.AppendUint16(body, uint16(size))
+		body = binary.LittleEndian.AppendUint32(body, ace.mask)
+		body = append(body, ace.sid...)
+	}
+
+	acl := []byte{2, 0}
+	acl = binary.LittleEndian.AppendUint16(acl, uint16(8+len(body)))
+	acl = binary.LittleEndian.AppendUint16(acl, uint16(len(aces)))
+	acl = append(acl, 0, 0)
+	acl = append(acl, body...)
+
+	sd := []byte{1, 0}
+	sd = binary.LittleEndian.AppendUint16(sd, 0x8000|seDACLPresent)
+	sd = append(sd, make([]byte, 12)...)
+	sd = binary.LittleEndian.AppendUint32(sd, 20)
+	return append(sd, acl...)
+}
+
+func nodeWithDescriptor(t *testing.T, sd []byte) *restic.Node {
+	raw, err := json.Marshal(sd)
+	rtest.OK(t, err)
+	return &restic.Node{
+		Type:              restic.NodeTypeFile,
+		GenericAttributes: map[restic.GenericAttributeType]json.RawMessage{restic.TypeSecurityDescriptor: raw},
+	}
+}
+
+func TestDescriptors(t *testing.T) {
+	p, err := Parse(strings.NewReader(testPolicy+"\nenforce-descriptors\n"), "policy")
+	rtest.OK(t, err)
+	alice := p.For(Identity{User: "alice"})
+	bob := p.For(Identity{User: "bob"})
+
+	aliceSID := binarySID(5, 21, 1, 2, 3, 1001)
+	everyone := binarySID(1, 0)
+	allowAlice := testACE{aceTypeAccessAllowed, 0, 0x1f01ff, aliceSID}
+
+	for _, test := range []struct {
+		sd    []byte
+		alice bool
+		bob   bool
+	}{
+		{securityDescriptor(allowAlice), true, false},
+		{securityDescriptor(testACE{aceTypeAccessAllowed, 0, 0x80000000, everyone}), true, true},
+		// write access only
+		{securityDescriptor(testACE{aceTypeAccessAllowed, 0, 0x2, aliceSID}), false, false},
+		// deny entries come first
+		{securityDescriptor(testACE{aceTypeAccessDenied, 0, 0x1, aliceSID}, testACE{aceTypeAccessAllowed, 0, 0x1, everyone}), false, true},
+		// inherit-only entries do not apply to the object itself
+		{securityDescriptor(testACE{aceTypeAccessAllowed, aceFlagInheritOnly, 0x1, aliceSID}), false, false},
+		// an empty DACL denies all access
+		{securityDescriptor(), false, false},
+		// malformed descriptors deny access
+		{[]byte{1, 0, 4}, false, false},
+	} {
+		node := nodeWithDescriptor(t, test.sd)
+		rtest.Equals(t, test.alice, alice.Check("/pub/file", node) == Granted, fmt.Sprintf("alice, descriptor %x", test.sd))
+		rtest.Equals(t, test.bob, bob.Check("/pub/file", node) == Granted, fmt.Sprintf("bob, descriptor %x", test.sd))
+	}
+
+	// nodes without a descriptor are allowed
+	rtest.Equals(t, Granted, bob.Check("/pub/file", file))
+
+	sid, _, err := formatSID(aliceSID)
+	rtest.OK(t, err)
+	rtest.Equals(t, "S-1-5-21-1-2-3-1001", sid)
+}
@@ -0,0 +1,155 @@
+package access
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Well-known SIDs every identity is a member of.
+const (
+	sidEveryone           = "S-1-1-0"
+	sidAuthenticatedUsers = "S-1-5-11"
+)
+
+const (
+	seDACLPresent = 0x0004
+
+	aceTypeAccessAllowed = 0
+	aceTypeAccessDenied  = 1
+	aceFlagInheritOnly   = 0x08
+
+	// readAccess contains the access rights which allow reading a file or
+	// listing a directory: FILE_READ_DATA (FILE_LIST_DIRECTORY), GENERIC_ALL
+	// and GENERIC_READ.
+	readAccess = 0x00000001 | 0x10000000 | 0x80000000
+)
+
+var errInvalidDescriptor = errors.New("invalid security descriptor")
+
+// parseSIDString validates the string representation of a SID.
+func parseSIDString(s string) (string, error) {
+	parts := strings.Split(strings.ToUpper(s), "-")
+	if len(parts) < 3 || parts[0] != "S" || parts[1] != "1" {
+		return "", fmt.Errorf("invalid SID %q", s)
+	}
+	for _, part := range parts[2:] {
+		if _, err := strconv.ParseUint(part, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid SID %q", s)
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// formatSID returns the string representation of the binary SID at the start
+// of buf and its length.
+func formatSID(buf []byte) (string, int, error) {
+	if len(buf) < 8 || buf[0] != 1 {
+		return "", 0, errInvalidDescriptor
+	}
+	count := int(buf[1])
+	size := 8 + 4*count
+	if len(buf) < size {
+		return "", 0, errInvalidDescriptor
+	}
+
+	var authority uint64
+	for _, b := range buf[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "S-1-%d", authority)
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&sb, "-%d", binary.LittleEndian.Uint32(buf[8+4*i:]))
+	}
+	return sb.String(), size, nil
+}
+
+// readAllowed evaluates the discretionary access control list of the
+// self-relative security descriptor sd and reports whether it grants read
+// access to any of sids.
+func readAllowed(sd []byte, sids map[string]struct{}) (bool, error) {
+	if len(sd) < 20 || sd[0] != 1 {
+		return false, errInvalidDescriptor
+	}
+	control := binary.LittleEndian.Uint16(sd[2:])
+	offset := int(binary.LittleEndian.Uint32(sd[16:]))
+	// without a DACL, everyone has full access
+	if control&seDACLPresent == 0 || offset == 0 {
+		return true, nil
+	}
+
+	if offset+8 > len(sd) {
+		return false, errInvalidDescriptor
+	}
+	acl := sd[offset:]
+	size := int(binary.LittleEndian.Uint16(acl[2:]))
+	count := int(binary.LittleEndian.Uint16(acl[4:]))
+	if size < 8 || size > len(acl) {
+		return false, errInvalidDescriptor
+	}
+	acl = acl[:size]
+
+	pos := 8
+	for i := 0; i < count; i++ {
+		if pos+4 > len(acl) {
+			return false, errInvalidDescriptor
+		}
+		aceType, aceFlags := acl[pos], acl[pos+1]
+		aceSize := int(binary.LittleEndian.Uint16(acl[pos+2:]))
+		if aceSize < 4 || pos+aceSize > len(acl) {
+			return false, errInvalidDescriptor
+		}
+		ace := acl[pos : pos+aceSize]
+		pos += aceSize
+
+		if aceFlags&aceFlagInheritOnly != 0 || (aceType != aceTypeAccessAllowed && aceType != aceTypeAccessDenied) {
+			continue
+		}
+		if len(ace) < 8 {
+			return false, errInvalidDescriptor
+		}
+		mask := binary.LittleEndian.Uint32(ace[4:])
+		sid, _, err := formatSID(ace[8:])
+		if err != nil {
+			return false, err
+		}
+		if _, ok := sids[sid]; !ok || mask&readAccess == 0 {
+			continue
+		}
+
+		// access control entries are evaluated in order, the first one
+		// which matches decides
+		return aceType == aceTypeAccessAllowed, nil
+	}
+
+	return false, nil
+}
+
+// descriptorAllows reports whether the security descriptor stored for node
+// grants read access. Nodes without a security descriptor are allowed.
+func (c *Checker) descriptorAllows(node *restic.Node) bool {
+	raw, ok := node.GenericAttributes[restic.TypeSecurityDescriptor]
+	if !ok {
+		return true
+	}
+
+	var sd []byte
+	if err := json.Unmarshal(raw, &sd); err != nil {
+		debug.Log("unable to decode security descriptor of %v: %v", node.Name, err)
+		return false
+	}
+	allowed, err := readAllowed(sd, c.sids)
+	if err != nil {
+		debug.Log("unable to check security descriptor of %v: %v", node.Name, err)
+		return false
+	}
+	return allowed
+}
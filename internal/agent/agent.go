@@ -0,0 +1,441 @@
+// Package agent implements a local API for a repository which is kept open
+// in memory. Programs like graphical frontends can query the agent instead of
+// opening the repository and loading the index for each operation.
+//
+// The API uses HTTP with JSON responses and is served via a Unix socket or a
+// named pipe on Windows. Requests must carry the token of the agent as bearer
+// token in the Authorization header.
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/dump"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/restorer"
+)
+
+// Config configures the agent.
+type Config struct {
+	// Token must be sent by clients as bearer token.
+	Token string
+	// Lock is called for each request to lock the repository, the returned
+	// function releases the lock. The returned context is cancelled when the
+	// lock is lost. If Lock is nil, the repository is not locked.
+	Lock func(ctx context.Context) (context.Context, func(), error)
+}
+
+// Server handles requests to the API.
+type Server struct {
+	repo restic.Repository
+	cfg  Config
+	mux  *http.ServeMux
+
+	// mu is held for reading while requests use the index and for writing
+	// while it is reloaded.
+	mu sync.RWMutex
+	// refreshMu serializes index refreshes.
+	refreshMu sync.Mutex
+	// indexes contains the IDs of the loaded index files.
+	indexes restic.IDSet
+}
+
+// New returns a server for repo, whose index must already be loaded.
+func New(ctx context.Context, repo restic.Repository, cfg Config) (*Server, error) {
+	s := &Server{repo: repo, cfg: cfg, mux: http.NewServeMux()}
+
+	indexes, err := s.listIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.indexes = indexes
+
+	s.mux.HandleFunc("GET /v1/status", s.status)
+	s.mux.HandleFunc("GET /v1/snapshots", s.snapshots)
+	s.mux.HandleFunc("GET /v1/snapshots/{id}/ls", s.ls)
+	s.mux.HandleFunc("GET /v1/snapshots/{id}/dump", s.dump)
+	s.mux.HandleFunc("POST /v1/restore", s.restore)
+	return s, nil
+}
+
+func (s *Server) listIndexes(ctx context.Context) (restic.IDSet, error) {
+	ids := restic.NewIDSet()
+	err := s.repo.List(ctx, restic.IndexFile, func(id restic.ID, _ int64) error {
+		ids.Insert(id)
+		return nil
+	})
+	return ids, err
+}
+
+// refreshIndex reloads the index if index files were added or removed since
+// it was loaded, for example by a backup or prune run.
+func (s *Server) refreshIndex(ctx context.Context) error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	indexes, err := s.listIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	if indexes.Equals(s.indexes) {
+		return nil
+	}
+
+	debug.Log("index files changed, reloading index")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.repo.LoadIndex(ctx, nil)
+	if err != nil {
+		// force a reload on the next request
+		s.indexes = nil
+		return err
+	}
+	s.indexes = indexes
+	return nil
+}
+
+// ServeHTTP authenticates the request, locks the repository and refreshes
+// the index before handling the request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+		writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	ctx := r.Context()
+	if s.cfg.Lock != nil {
+		lockCtx, unlock, err := s.cfg.Lock(ctx)
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		defer unlock()
+		ctx = lockCtx
+	}
+
+	err := s.refreshIndex(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("unable to load index: %w", err))
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		debug.Log("unable to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	debug.Log("request failed: %v", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+	}{err.Error()})
+}
+
+// errorStatus returns the status code for err.
+func errorStatus(err error) int {
+	var noID *restic.NoIDByPrefixError
+	var multipleIDs *restic.MultipleIDMatchesError
+	switch {
+	case errors.Is(err, restic.ErrNoSnapshotFound), errors.Is(err, errNotFound), errors.As(err, &noID):
+		return http.StatusNotFound
+	case errors.As(err, &multipleIDs):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+var errNotFound = errors.New("not found")
+
+func (s *Server) status(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, struct {
+		RepositoryID string `json:"repository_id"`
+		IndexFiles   int    `json:"index_files"`
+	}{s.repo.Config().ID, len(s.indexes)})
+}
+
+// Snapshot is a snapshot with its ID included.
+type Snapshot struct {
+	*restic.Snapshot
+
+	ID      *restic.ID `json:"id"`
+	ShortID string     `json:"short_id"`
+}
+
+// snapshots returns the snapshots matching the host, tag and path parameters.
+func (s *Server) snapshots(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := restic.SnapshotFilter{
+		Hosts: query["host"],
+		Paths: query["path"],
+	}
+	for _, tags := range query["tag"] {
+		var l restic.TagList
+		if err := l.Set(tags); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.Tags = append(filter.Tags, l)
+	}
+
+	list := []Snapshot{}
+	err := filter.FindAll(r.Context(), s.repo, s.repo, nil, func(_ string, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		list = append(list, Snapshot{Snapshot: sn, ID: sn.ID(), ShortID: sn.ID().Str()})
+		return nil
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, list)
+}
+
+// findNode returns the node at the path parameter of the request within the
+// snapshot given by the id path value. The root directory of the snapshot
+// is returned as a directory node named "/".
+func (s *Server) findNode(r *http.Request) (*restic.Node, string, error) {
+	ctx := r.Context()
+	sn, subfolder, err := (&restic.SnapshotFilter{}).FindLatest(ctx, s.repo, s.repo, r.PathValue("id"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	p := path.Join("/", subfolder, r.URL.Query().Get("path"))
+	node := &restic.Node{Name: "/", Type: restic.NodeTypeDir, Subtree: sn.Tree}
+	for _, name := range strings.Split(strings.Trim(p, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if node.Type != restic.NodeTypeDir || node.Subtree == nil {
+			return nil, "", fmt.Errorf("%v: %w", p, errNotFound)
+		}
+		tree, err := restic.LoadTree(ctx, s.repo, *node.Subtree)
+		if err != nil {
+			return nil, "", err
+		}
+		node = tree.Find(name)
+		if node == nil {
+			return nil, "", fmt.Errorf("%v: %w", p, errNotFound)
+		}
+	}
+	return node, p, nil
+}
+
+// Node is an entry of a directory listing.
+type Node struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Path        string      `json:"path"`
+	UID         uint32      `json:"uid"`
+	GID         uint32      `json:"gid"`
+	Size        *uint64     `json:"size,omitempty"`
+	Mode        os.FileMode `json:"mode,omitempty"`
+	Permissions string      `json:"permissions,omitempty"`
+	LinkTarget  string      `json:"linktarget,omitempty"`
+	ModTime     time.Time   `json:"mtime,omitempty"`
+	AccessTime  time.Time   `json:"atime,omitempty"`
+	ChangeTime  time.Time   `json:"ctime,omitempty"`
+}
+
+func newNode(p string, node *restic.Node) Node {
+	n := Node{
+		Name:        node.Name,
+		Type:        string(node.Type),
+		Path:        p,
+		UID:         node.UID,
+		GID:         node.GID,
+		Mode:        node.Mode,
+		Permissions: node.Mode.String(),
+		LinkTarget:  node.LinkTarget,
+		ModTime:     node.ModTime,
+		AccessTime:  node.AccessTime,
+		ChangeTime:  node.ChangeTime,
+	}
+	// the size is only set for regular files, even when they are empty
+	if node.Type == restic.NodeTypeFile {
+		size := node.Size
+		n.Size = &size
+	}
+	return n
+}
+
+// ls returns the entries of the directory at path, or the file itself.
+func (s *Server) ls(w http.ResponseWriter, r *http.Request) {
+	node, p, err := s.findNode(r)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	if node.Type != restic.NodeTypeDir {
+		writeJSON(w, []Node{newNode(p, node)})
+		return
+	}
+
+	tree, err := restic.LoadTree(r.Context(), s.repo, *node.Subtree)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	list := make([]Node, 0, len(tree.Nodes))
+	for _, child := range tree.Nodes {
+		list = append(list, newNode(path.Join(p, child.Name), child))
+	}
+	writeJSON(w, list)
+}
+
+// dump returns the content of the file at path, or an archive of the
+// directory at path in the format given by the archive parameter.
+func (s *Server) dump(w http.ResponseWriter, r *http.Request) {
+	node, p, err := s.findNode(r)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	format := r.URL.Query().Get("archive")
+	if format == "" {
+		format = "tar"
+	}
+	if format != "tar" && format != "zip" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown archive format %q", format))
+		return
+	}
+
+	d := dump.New(format, s.repo, w)
+	switch node.Type {
+	case restic.NodeTypeFile:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		err = d.WriteNode(r.Context(), node)
+	case restic.NodeTypeDir:
+		var tree *restic.Tree
+		tree, err = restic.LoadTree(r.Context(), s.repo, *node.Subtree)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/"+format)
+		err = d.DumpTree(r.Context(), tree, p)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%v is neither a file nor a directory", p))
+		return
+	}
+	if err != nil {
+		// the status was already sent, abort the response
+		debug.Log("dump of %v failed: %v", p, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// RestoreRequest is the body of a restore request.
+type RestoreRequest struct {
+	// Snapshot is the ID of the snapshot, "latest" or "ID:subfolder".
+	Snapshot string `json:"snapshot"`
+	// Target is the directory to restore to.
+	Target string `json:"target"`
+	// Paths limits the restore to these files and directories in the
+	// snapshot, all files are restored if it is empty.
+	Paths []string `json:"paths"`
+}
+
+// RestoreResponse is the result of a restore request.
+type RestoreResponse struct {
+	SnapshotID    string   `json:"snapshot_id"`
+	FilesRestored uint64   `json:"files_restored"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// restore restores files of a snapshot to a directory.
+func (s *Server) restore(w http.ResponseWriter, r *http.Request) {
+	var req RestoreRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Snapshot == "" || req.Target == "" {
+		writeError(w, http.StatusBadRequest, errors.New("snapshot and target are required"))
+		return
+	}
+
+	ctx := r.Context()
+	sn, subfolder, err := (&restic.SnapshotFilter{}).FindLatest(ctx, s.repo, s.repo, req.Snapshot)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	if subfolder != "" {
+		sn.Tree, err = restic.FindTreeDirectory(ctx, s.repo, sn.Tree, subfolder)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+	}
+
+	res := restorer.NewRestorer(s.repo, sn, restorer.Options{})
+	resp := RestoreResponse{SnapshotID: sn.ID().String()}
+	var errMu sync.Mutex
+	res.Error = func(location string, err error) error {
+		errMu.Lock()
+		defer errMu.Unlock()
+		resp.Errors = append(resp.Errors, fmt.Sprintf("%v: %v", location, err))
+		return nil
+	}
+	res.Warn = func(message string) { debug.Log("restore: %v", message) }
+	res.Info = func(message string) { debug.Log("restore: %v", message) }
+	if len(req.Paths) > 0 {
+		res.SelectFilter = selectPaths(req.Paths)
+	}
+
+	resp.FilesRestored, err = res.RestoreTo(ctx, req.Target)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// selectPaths returns a filter for the restorer which selects the paths and
+// everything below them.
+func selectPaths(paths []string) func(item string, isDir bool) (bool, bool) {
+	cleaned := make([]string, 0, len(paths))
+	for _, p := range paths {
+		cleaned = append(cleaned, path.Clean("/"+p))
+	}
+
+	return func(item string, isDir bool) (bool, bool) {
+		item = path.Clean("/" + item)
+		parent := false
+		for _, p := range cleaned {
+			if item == p || p == "/" || strings.HasPrefix(item, p+"/") {
+				return true, isDir
+			}
+			// parent directories of the selected paths are traversed
+			parent = parent || item == "/" || strings.HasPrefix(p, item+"/")
+		}
+		return false, parent && isDir
+	}
+}
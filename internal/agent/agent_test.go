@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testFiles = archiver.TestDir{
+	"a": archiver.TestDir{
+		"x": archiver.TestFile{Content: "x"},
+		"y": archiver.TestFile{Content: strings.Repeat("restic", 1000)},
+	},
+	"b": archiver.TestFile{Content: "b"},
+}
+
+func testSnapshot(t *testing.T, repo restic.Repository, files archiver.TestDir, ts time.Time) *restic.Snapshot {
+	tempdir := rtest.TempDir(t)
+	archiver.TestCreateFiles(t, tempdir, files)
+
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+	arch := archiver.New(repo, fs.Track{FS: fs.Local{}}, archiver.Options{})
+	sn, _, _, err := arch.Snapshot(context.TODO(), []string{"."}, archiver.SnapshotOptions{Time: ts, Hostname: "host"})
+	rtest.OK(t, err)
+	return sn
+}
+
+type testClient struct {
+	t     *testing.T
+	url   string
+	token string
+}
+
+func (c *testClient) do(method, path string, body io.Reader) *http.Response {
+	req, err := http.NewRequest(method, c.url+path, body)
+	rtest.OK(c.t, err)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	res, err := http.DefaultClient.Do(req)
+	rtest.OK(c.t, err)
+	c.t.Cleanup(func() { _ = res.Body.Close() })
+	return res
+}
+
+func (c *testClient) get(path string, status int, v interface{}) {
+	res := c.do("GET", path, nil)
+	rtest.Equals(c.t, status, res.StatusCode, path)
+	rtest.OK(c.t, json.NewDecoder(res.Body).Decode(v))
+}
+
+// testServer returns a client for an agent and another instance of the
+// repository used by the agent.
+func testServer(t *testing.T) (*testClient, *repository.Repository) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, 0)
+	testSnapshot(t, repo, testFiles, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	agentRepo := repository.TestOpenBackend(t, be)
+	rtest.OK(t, agentRepo.LoadIndex(context.TODO(), nil))
+	s, err := New(context.TODO(), agentRepo, Config{Token: "secret"})
+	rtest.OK(t, err)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return &testClient{t: t, url: srv.URL, token: "secret"}, repo
+}
+
+func TestAuthentication(t *testing.T) {
+	c, _ := testServer(t)
+
+	for _, token := range []string{"", "wrong"} {
+		c.token = token
+		res := c.do("GET", "/v1/snapshots", nil)
+		rtest.Equals(t, http.StatusUnauthorized, res.StatusCode)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	c, _ := testServer(t)
+
+	var snapshots []Snapshot
+	c.get("/v1/snapshots", http.StatusOK, &snapshots)
+	rtest.Equals(t, 1, len(snapshots))
+	c.get("/v1/snapshots?host=other", http.StatusOK, &snapshots)
+	rtest.Equals(t, 0, len(snapshots))
+
+	var nodes []Node
+	c.get("/v1/snapshots/latest/ls", http.StatusOK, &nodes)
+	rtest.Equals(t, []string{"/a", "/b"}, nodePaths(nodes))
+	c.get("/v1/snapshots/latest/ls?path=/a", http.StatusOK, &nodes)
+	rtest.Equals(t, []string{"/a/x", "/a/y"}, nodePaths(nodes))
+	c.get("/v1/snapshots/latest:a/ls?path=y", http.StatusOK, &nodes)
+	rtest.Equals(t, []string{"/a/y"}, nodePaths(nodes))
+	rtest.Equals(t, uint64(6000), *nodes[0].Size)
+
+	res := c.do("GET", "/v1/snapshots/latest/dump?path=/a/y", nil)
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	data, err := io.ReadAll(res.Body)
+	rtest.OK(t, err)
+	rtest.Equals(t, strings.Repeat("restic", 1000), string(data))
+
+	res = c.do("GET", "/v1/snapshots/latest/dump?path=/a", nil)
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	rtest.Equals(t, "application/tar", res.Header.Get("Content-Type"))
+
+	for _, path := range []string{"/v1/snapshots/latest/ls?path=/missing", "/v1/snapshots/latest/ls?path=/b/x", "/v1/snapshots/abcdef/ls"} {
+		var msg struct{ Message string }
+		c.get(path, http.StatusNotFound, &msg)
+		rtest.Assert(t, msg.Message != "", "missing error message for %v", path)
+	}
+}
+
+func nodePaths(nodes []Node) []string {
+	var paths []string
+	for _, node := range nodes {
+		paths = append(paths, node.Path)
+	}
+	return paths
+}
+
+func TestRestore(t *testing.T) {
+	c, _ := testServer(t)
+	target := rtest.TempDir(t)
+
+	body := fmt.Sprintf(`{"snapshot": "latest", "target": %q, "paths": ["/a/x"]}`, target)
+	res := c.do("POST", "/v1/restore", strings.NewReader(body))
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	var resp RestoreResponse
+	rtest.OK(t, json.NewDecoder(res.Body).Decode(&resp))
+	rtest.Equals(t, 0, len(resp.Errors))
+
+	data, err := os.ReadFile(filepath.Join(target, "a", "x"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "x", string(data))
+	_, err = os.Stat(filepath.Join(target, "a", "y"))
+	rtest.Assert(t, os.IsNotExist(err), "unexpected file a/y, error %v", err)
+	_, err = os.Stat(filepath.Join(target, "b"))
+	rtest.Assert(t, os.IsNotExist(err), "unexpected file b, error %v", err)
+
+	res = c.do("POST", "/v1/restore", strings.NewReader(`{"snapshot": "latest"}`))
+	rtest.Equals(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestRefreshIndex(t *testing.T) {
+	c, repo := testServer(t)
+
+	// the new snapshot contains new blobs which are stored in a new index
+	testSnapshot(t, repo, archiver.TestDir{"new": archiver.TestFile{Content: "new data"}}, time.Date(2024, 2, 2, 3, 4, 5, 0, time.UTC))
+
+	res := c.do("GET", "/v1/snapshots/latest/dump?path=/new", nil)
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	data, err := io.ReadAll(res.Body)
+	rtest.OK(t, err)
+	rtest.Equals(t, "new data", string(data))
+}
+
+func TestSelectPaths(t *testing.T) {
+	filter := selectPaths([]string{"/a/b", "/a", "/c/d/"})
+	for _, test := range []struct {
+		item     string
+		isDir    bool
+		selected bool
+		children bool
+	}{
+		{"/", true, false, true},
+		{"/a", true, true, true},
+		{"/a/b/c", false, true, false},
+		{"/c", true, false, true},
+		{"/c/d", true, true, true},
+		{"/c/e", true, false, false},
+		{"/ca", true, false, false},
+	} {
+		selected, children := filter(test.item, test.isDir)
+		rtest.Equals(t, test.selected, selected, test.item)
+		rtest.Equals(t, test.children, children, test.item)
+	}
+}
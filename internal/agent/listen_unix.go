@@ -0,0 +1,92 @@
+//go:build !windows
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// runtimeDir returns the directory for the socket and the token file.
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "restic")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("restic-%d", os.Getuid()))
+}
+
+// DefaultAddress returns the default path of the socket.
+func DefaultAddress() string {
+	return filepath.Join(runtimeDir(), "agent.sock")
+}
+
+// DefaultTokenFile returns the default path of the token file.
+func DefaultTokenFile() string {
+	return filepath.Join(runtimeDir(), "agent.token")
+}
+
+// privateDir creates the directory dir if it does not exist and checks that
+// only the current user can access it.
+func privateDir(dir string) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.IsDir() || !ok || int(st.Uid) != os.Getuid() || fi.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%v must be a directory which only the current user can access", dir)
+	}
+	return nil
+}
+
+// Listen listens on the Unix socket at address. The directory containing the
+// socket is created if it does not exist, it must only be accessible by the
+// current user. A stale socket left by an agent which has terminated is
+// removed.
+func Listen(address string) (net.Listener, error) {
+	err := privateDir(filepath.Dir(address))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Lstat(address); err == nil {
+		conn, err := net.Dial("unix", address)
+		if err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("an agent is already listening on %v", address)
+		}
+		err = os.Remove(address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(address, 0600)
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// WriteTokenFile writes token to filename, which only the current user can
+// read.
+func WriteTokenFile(filename, token string) error {
+	err := privateDir(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	return writeToken(filename, token)
+}
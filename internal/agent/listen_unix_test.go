@@ -0,0 +1,51 @@
+//go:build !windows
+
+package agent
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestListen(t *testing.T) {
+	dir := filepath.Join(rtest.TempDir(t), "agent")
+	address := filepath.Join(dir, "agent.sock")
+
+	listener, err := Listen(address)
+	rtest.OK(t, err)
+	fi, err := os.Stat(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, os.FileMode(0700), fi.Mode().Perm())
+
+	_, err = Listen(address)
+	rtest.Assert(t, err != nil, "listening twice must fail")
+	rtest.OK(t, listener.Close())
+
+	// stale sockets are removed
+	unixListener, err := net.ListenUnix("unix", &net.UnixAddr{Name: address, Net: "unix"})
+	rtest.OK(t, err)
+	unixListener.SetUnlinkOnClose(false)
+	rtest.OK(t, unixListener.Close())
+	listener, err = Listen(address)
+	rtest.OK(t, err)
+	rtest.OK(t, listener.Close())
+
+	// directories others can access are rejected
+	rtest.OK(t, os.Chmod(dir, 0755))
+	_, err = Listen(address)
+	rtest.Assert(t, err != nil, "directories others can access must be rejected")
+
+	tokenFile := filepath.Join(rtest.TempDir(t), "token", "agent.token")
+	rtest.OK(t, WriteTokenFile(tokenFile, "secret"))
+	rtest.OK(t, WriteTokenFile(tokenFile, "secret2"))
+	fi, err = os.Stat(tokenFile)
+	rtest.OK(t, err)
+	rtest.Equals(t, os.FileMode(0600), fi.Mode().Perm())
+	data, err := os.ReadFile(tokenFile)
+	rtest.OK(t, err)
+	rtest.Equals(t, "secret2\n", string(data))
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/Microsoft/go-winio"
+	"golang.org/x/sys/windows"
+)
+
+// DefaultAddress returns the default name of the named pipe.
+func DefaultAddress() string {
+	return `\\.\pipe\restic-agent-` + os.Getenv("USERNAME")
+}
+
+// DefaultTokenFile returns the default path of the token file.
+func DefaultTokenFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "restic", "agent.token")
+}
+
+// Listen listens on the named pipe at address, which only the current user
+// can connect to.
+func Listen(address string) (net.Listener, error) {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, err
+	}
+
+	// grant full access to the current user only
+	sd := "D:P(A;;GA;;;" + user.User.Sid.String() + ")"
+	return winio.ListenPipe(address, &winio.PipeConfig{SecurityDescriptor: sd})
+}
+
+// WriteTokenFile writes token to filename. The file inherits the permissions
+// of the user's local application data directory.
+func WriteTokenFile(filename, token string) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	return writeToken(filename, token)
+}
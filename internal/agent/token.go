@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+)
+
+// NewToken returns a random token.
+func NewToken() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// writeToken replaces filename with a file containing token, which is only
+// readable by the current user.
+func writeToken(filename, token string) error {
+	err := os.Remove(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(token + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
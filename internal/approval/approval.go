@@ -0,0 +1,368 @@
+// Package approval implements the two-person rule for destructive operations.
+// If the repository config contains an approval policy, removing many
+// snapshots, removing or replacing a key, rechunking all snapshots or changing
+// the policy requires a request signed by one admin key and an approval signed
+// by a second, distinct admin key.
+// Both are stored in the repository until the operation is carried out.
+//
+// Requests and approvals are signed using Ed25519 keys which are kept
+// separately from the repository password, so knowing the password is not
+// sufficient to authorize a destructive operation. A request is only valid
+// until it expires at the end of the approval window.
+package approval
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Operations which require approval.
+const (
+	OpForget    = "forget"
+	OpKeyRemove = "key remove"
+	OpKeyPasswd = "key passwd"
+	OpPolicy    = "policy"
+	// OpRewrite and OpRepairSnapshots remove the original snapshots which
+	// were replaced by new snapshots or became empty.
+	OpRewrite         = "rewrite"
+	OpRepairSnapshots = "repair snapshots"
+	// OpRechunk replaces all snapshots by rechunked ones.
+	OpRechunk = "rechunk"
+)
+
+var (
+	// ErrNotAdmin is returned when signing with a key which is not an admin
+	// key of the policy.
+	ErrNotAdmin = errors.New("signing key is not an admin key of the approval policy")
+	// ErrExpired is returned when approving an expired request.
+	ErrExpired = errors.New("request has expired")
+)
+
+// Prefixes separate the signatures of requests and approvals from other uses
+// of the keys.
+const (
+	requestSignaturePrefix  = "restic approval request v1\n"
+	approvalSignaturePrefix = "restic approval v1\n"
+)
+
+// Request describes a destructive operation waiting for approval.
+type Request struct {
+	Operation string `json:"operation"`
+	// Snapshots are the IDs of the snapshots removed by forget.
+	Snapshots restic.IDs `json:"snapshots,omitempty"`
+	// Key is the ID of the key removed by key remove.
+	Key *restic.ID `json:"key,omitempty"`
+	// Policy is the new approval policy, it is nil if the policy is removed.
+	Policy *restic.ApprovalPolicy `json:"policy,omitempty"`
+
+	Time     time.Time `json:"time"`
+	Expires  time.Time `json:"expires"`
+	Hostname string    `json:"hostname"`
+	Username string    `json:"username"`
+
+	// Signer is the ID of the admin key which signed the request.
+	Signer    string `json:"signer"`
+	Signature []byte `json:"signature"`
+
+	// Approvals are the approvals of the request found in the repository.
+	Approvals []*Approval `json:"-"`
+
+	id restic.ID
+}
+
+// Approval is the countersignature of a request by a second admin.
+type Approval struct {
+	Request  restic.ID `json:"request"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	Username string    `json:"username"`
+
+	Signer    string `json:"signer"`
+	Signature []byte `json:"signature"`
+
+	id restic.ID
+}
+
+// file is the format of the files stored in the repository, exactly one of
+// the fields is set.
+type file struct {
+	Request  *Request  `json:"request,omitempty"`
+	Approval *Approval `json:"approval,omitempty"`
+}
+
+// ID returns the ID of the request.
+func (r *Request) ID() restic.ID {
+	return r.id
+}
+
+func (r *Request) signedData() ([]byte, error) {
+	tmp := *r
+	tmp.Signature = nil
+	buf, err := json.Marshal(&tmp)
+	if err != nil {
+		return nil, errors.Wrap(err, "Marshal")
+	}
+	return append([]byte(requestSignaturePrefix), buf...), nil
+}
+
+func (a *Approval) signedData() ([]byte, error) {
+	tmp := *a
+	tmp.Signature = nil
+	buf, err := json.Marshal(&tmp)
+	if err != nil {
+		return nil, errors.Wrap(err, "Marshal")
+	}
+	return append([]byte(approvalSignaturePrefix), buf...), nil
+}
+
+// verify checks that data was signed by the admin key signer.
+func verify(policy *restic.ApprovalPolicy, signer string, data, signature []byte) bool {
+	key := policy.AdminKey(signer)
+	return key != nil && ed25519.Verify(key, data, signature)
+}
+
+// Signers returns the IDs of the distinct admin keys which validly signed the
+// request or one of its approvals.
+func (r *Request) Signers(policy *restic.ApprovalPolicy) []string {
+	data, err := r.signedData()
+	if err != nil || !verify(policy, r.Signer, data, r.Signature) {
+		debug.Log("request %v has no valid signature", r.id.Str())
+		return nil
+	}
+	// requests created with a longer window than allowed are invalid
+	if r.Expires.Sub(r.Time) > policy.ApprovalWindow() {
+		debug.Log("request %v exceeds the approval window", r.id.Str())
+		return nil
+	}
+
+	signers := []string{r.Signer}
+	for _, a := range r.Approvals {
+		data, err := a.signedData()
+		if err != nil || a.Request != r.id || !verify(policy, a.Signer, data, a.Signature) {
+			debug.Log("approval %v of request %v is invalid", a.id.Str(), r.id.Str())
+			continue
+		}
+		known := false
+		for _, s := range signers {
+			known = known || s == a.Signer
+		}
+		if !known {
+			signers = append(signers, a.Signer)
+		}
+	}
+	return signers
+}
+
+// Approved returns true if the request is signed by two distinct admins and
+// has not expired at time now.
+func (r *Request) Approved(policy *restic.ApprovalPolicy, now time.Time) bool {
+	return now.Before(r.Expires) && len(r.Signers(policy)) >= 2
+}
+
+// Matches returns true if r describes the same operation as other.
+func (r *Request) Matches(other *Request) bool {
+	if r.Operation != other.Operation {
+		return false
+	}
+	if (r.Key == nil) != (other.Key == nil) || (r.Key != nil && !r.Key.Equal(*other.Key)) {
+		return false
+	}
+
+	a := append(restic.IDs(nil), r.Snapshots...)
+	b := append(restic.IDs(nil), other.Snapshots...)
+	sort.Sort(a)
+	sort.Sort(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+
+	pa, erra := json.Marshal(r.Policy)
+	pb, errb := json.Marshal(other.Policy)
+	return erra == nil && errb == nil && bytes.Equal(pa, pb)
+}
+
+func setOrigin(t *time.Time, hostname, username *string) {
+	*t = time.Now()
+	*hostname, _ = os.Hostname()
+	if usr, err := user.Current(); err == nil {
+		*username = usr.Username
+	}
+}
+
+// checkAdmin returns the ID of key, or ErrNotAdmin if it is not an admin key.
+func checkAdmin(policy *restic.ApprovalPolicy, key ed25519.PrivateKey) (string, error) {
+	keyID := restic.SigningKeyID(key.Public().(ed25519.PublicKey))
+	if policy.AdminKey(keyID) == nil {
+		return "", ErrNotAdmin
+	}
+	return keyID, nil
+}
+
+// Create signs req using key and saves it in the repository. The time, origin
+// and expiry of the request are set by Create.
+func Create(ctx context.Context, repo restic.SaverUnpacked[restic.WriteableFileType], policy *restic.ApprovalPolicy, req *Request, key ed25519.PrivateKey) (restic.ID, error) {
+	keyID, err := checkAdmin(policy, key)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	setOrigin(&req.Time, &req.Hostname, &req.Username)
+	req.Expires = req.Time.Add(policy.ApprovalWindow())
+	req.Signer = keyID
+	data, err := req.signedData()
+	if err != nil {
+		return restic.ID{}, err
+	}
+	req.Signature = ed25519.Sign(key, data)
+
+	id, err := restic.SaveJSONUnpacked(ctx, repo, restic.WriteableApprovalFile, &file{Request: req})
+	if err != nil {
+		return restic.ID{}, err
+	}
+	req.id = id
+	debug.Log("created request %v for %v", id, req.Operation)
+	return id, nil
+}
+
+// Approve countersigns req using key and saves the approval in the
+// repository. The key must be an admin key which has not yet signed the
+// request.
+func Approve(ctx context.Context, repo restic.SaverUnpacked[restic.WriteableFileType], policy *restic.ApprovalPolicy, req *Request, key ed25519.PrivateKey) error {
+	keyID, err := checkAdmin(policy, key)
+	if err != nil {
+		return err
+	}
+	if !time.Now().Before(req.Expires) {
+		return ErrExpired
+	}
+	for _, signer := range req.Signers(policy) {
+		if signer == keyID {
+			return errors.Errorf("request %v is already signed by key %v, it must be approved by a different admin", req.id.Str(), keyID)
+		}
+	}
+
+	a := &Approval{Request: req.id, Signer: keyID}
+	setOrigin(&a.Time, &a.Hostname, &a.Username)
+	data, err := a.signedData()
+	if err != nil {
+		return err
+	}
+	a.Signature = ed25519.Sign(key, data)
+
+	id, err := restic.SaveJSONUnpacked(ctx, repo, restic.WriteableApprovalFile, &file{Approval: a})
+	if err != nil {
+		return err
+	}
+	a.id = id
+	req.Approvals = append(req.Approvals, a)
+	debug.Log("approved request %v with %v", req.id, id)
+	return nil
+}
+
+// Load returns all requests stored in the repository together with their
+// approvals, sorted by creation time. Approvals of requests which no longer
+// exist are ignored.
+func Load(ctx context.Context, repo restic.ListerLoaderUnpacked) ([]*Request, error) {
+	var m sync.Mutex
+	var requests []*Request
+	var approvals []*Approval
+
+	err := restic.ParallelList(ctx, repo, restic.ApprovalFile, repo.Connections(), func(ctx context.Context, id restic.ID, _ int64) error {
+		var f file
+		err := restic.LoadJSONUnpacked(ctx, repo, restic.ApprovalFile, id, &f)
+		if err != nil {
+			return fmt.Errorf("approval file %v: %w", id.Str(), err)
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		switch {
+		case f.Request != nil:
+			f.Request.id = id
+			requests = append(requests, f.Request)
+		case f.Approval != nil:
+			f.Approval.id = id
+			approvals = append(approvals, f.Approval)
+		default:
+			debug.Log("ignoring empty approval file %v", id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[restic.ID]*Request, len(requests))
+	for _, req := range requests {
+		byID[req.id] = req
+	}
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].Time.Before(approvals[j].Time)
+	})
+	for _, a := range approvals {
+		if req, ok := byID[a.Request]; ok {
+			req.Approvals = append(req.Approvals, a)
+		}
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Time.Before(requests[j].Time)
+	})
+	return requests, nil
+}
+
+// Find returns the approved request which matches want, or nil if there is
+// none.
+func Find(requests []*Request, policy *restic.ApprovalPolicy, want *Request) *Request {
+	now := time.Now()
+	for _, req := range requests {
+		if req.Matches(want) && req.Approved(policy, now) {
+			return req
+		}
+	}
+	return nil
+}
+
+// Remove deletes the request and its approvals from the repository. This
+// must be done once the operation was carried out, such that the approval
+// cannot be used again.
+func Remove(ctx context.Context, repo restic.RemoverUnpacked[restic.WriteableFileType], req *Request) error {
+	for _, a := range req.Approvals {
+		err := repo.RemoveUnpacked(ctx, restic.WriteableApprovalFile, a.id)
+		if err != nil {
+			return err
+		}
+	}
+	return repo.RemoveUnpacked(ctx, restic.WriteableApprovalFile, req.id)
+}
+
+// RemoveExpired deletes all requests which have expired at time now.
+func RemoveExpired(ctx context.Context, repo restic.RemoverUnpacked[restic.WriteableFileType], requests []*Request, now time.Time) error {
+	for _, req := range requests {
+		if now.Before(req.Expires) {
+			continue
+		}
+		err := Remove(ctx, repo, req)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package approval_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/approval"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func generateKey(t testing.TB) (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	rtest.OK(t, err)
+	return pub, priv
+}
+
+func TestApproval(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.TODO()
+
+	pubA, privA := generateKey(t)
+	pubB, privB := generateKey(t)
+	_, privOther := generateKey(t)
+	policy := &restic.ApprovalPolicy{AdminKeys: []ed25519.PublicKey{pubA, pubB}, Window: time.Hour}
+
+	snapshots := restic.IDs{restic.NewRandomID(), restic.NewRandomID()}
+	want := &approval.Request{Operation: approval.OpForget, Snapshots: snapshots}
+
+	_, err := approval.Create(ctx, repo, policy, &approval.Request{Operation: approval.OpForget}, privOther)
+	rtest.Equals(t, approval.ErrNotAdmin, err)
+
+	req := &approval.Request{Operation: approval.OpForget, Snapshots: restic.IDs{snapshots[1], snapshots[0]}}
+	_, err = approval.Create(ctx, repo, policy, req, privA)
+	rtest.OK(t, err)
+
+	requests, err := approval.Load(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(requests))
+	rtest.Assert(t, approval.Find(requests, policy, want) == nil, "request must not be approved by a single admin")
+
+	// the requester and other keys cannot approve the request
+	rtest.Assert(t, approval.Approve(ctx, repo, policy, requests[0], privA) != nil, "expected error for approval by requester")
+	rtest.Equals(t, approval.ErrNotAdmin, approval.Approve(ctx, repo, policy, requests[0], privOther))
+	rtest.OK(t, approval.Approve(ctx, repo, policy, requests[0], privB))
+
+	requests, err = approval.Load(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(requests))
+	rtest.Equals(t, 1, len(requests[0].Approvals))
+	found := approval.Find(requests, policy, want)
+	rtest.Assert(t, found != nil, "approved request not found")
+	rtest.Equals(t, req.ID(), found.ID())
+
+	other := &approval.Request{Operation: approval.OpForget, Snapshots: snapshots[:1]}
+	rtest.Assert(t, approval.Find(requests, policy, other) == nil, "request for different snapshots must not match")
+	rtest.Assert(t, !found.Approved(policy, found.Expires), "request must expire")
+
+	// a policy with different admins does not accept the signatures
+	pubC, _ := generateKey(t)
+	changed := &restic.ApprovalPolicy{AdminKeys: []ed25519.PublicKey{pubA, pubC}, Window: time.Hour}
+	rtest.Assert(t, approval.Find(requests, changed, want) == nil, "approval by removed admin must not be accepted")
+
+	rtest.OK(t, approval.Remove(ctx, repo, found))
+	requests, err = approval.Load(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(requests))
+}
+
+func TestApprovalWindow(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.TODO()
+
+	pubA, privA := generateKey(t)
+	pubB, privB := generateKey(t)
+	policy := &restic.ApprovalPolicy{AdminKeys: []ed25519.PublicKey{pubA, pubB}, Window: time.Hour}
+
+	req := &approval.Request{Operation: approval.OpKeyRemove, Key: &restic.ID{}}
+	_, err := approval.Create(ctx, repo, policy, req, privA)
+	rtest.OK(t, err)
+	rtest.OK(t, approval.Approve(ctx, repo, policy, req, privB))
+	rtest.Assert(t, req.Approved(policy, time.Now()), "request not approved")
+
+	// shrinking the window invalidates requests created with a longer one
+	shorter := &restic.ApprovalPolicy{AdminKeys: policy.AdminKeys, Window: time.Minute}
+	rtest.Assert(t, !req.Approved(shorter, time.Now()), "request exceeding the window must not be approved")
+
+	requests, err := approval.Load(ctx, repo)
+	rtest.OK(t, err)
+	rtest.OK(t, approval.RemoveExpired(ctx, repo, requests, time.Now()))
+	requests, err = approval.Load(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(requests))
+	rtest.OK(t, approval.RemoveExpired(ctx, repo, requests, req.Expires))
+	requests, err = approval.Load(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(requests))
+}
@@ -0,0 +1,299 @@
+package archiver
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// AnomalyPolicy determines what happens if suspicious changes compared to the
+// parent snapshot are detected during a backup.
+type AnomalyPolicy string
+
+// Supported anomaly policies.
+const (
+	// AnomalyPolicyOff disables the detection.
+	AnomalyPolicyOff AnomalyPolicy = "off"
+	// AnomalyPolicyWarn reports the anomalies, the snapshot is saved as usual.
+	AnomalyPolicyWarn AnomalyPolicy = "warn"
+	// AnomalyPolicyTag adds SuspectTag to the snapshot.
+	AnomalyPolicyTag AnomalyPolicy = "tag"
+	// AnomalyPolicyAbort refuses to save the snapshot.
+	AnomalyPolicyAbort AnomalyPolicy = "abort"
+)
+
+// SuspectTag is added to snapshots with anomalies if the policy is
+// AnomalyPolicyTag.
+const SuspectTag = "suspect"
+
+// ErrAnomalyDetected is returned by Snapshot if anomalies were detected and
+// the policy is AnomalyPolicyAbort.
+var ErrAnomalyDetected = errors.New("suspicious changes detected")
+
+// ParseAnomalyPolicy parses s as an anomaly policy.
+func ParseAnomalyPolicy(s string) (AnomalyPolicy, error) {
+	switch p := AnomalyPolicy(s); p {
+	case AnomalyPolicyOff, AnomalyPolicyWarn, AnomalyPolicyTag, AnomalyPolicyAbort:
+		return p, nil
+	case "":
+		return AnomalyPolicyOff, nil
+	}
+	return "", errors.Errorf("invalid anomaly policy %q, must be one of off, warn, tag or abort", s)
+}
+
+// AnomalyOptions configures the thresholds of the anomaly detection. A
+// heuristic only triggers if at least MinFiles files are affected and the
+// affected fraction exceeds the respective ratio.
+type AnomalyOptions struct {
+	Policy AnomalyPolicy
+
+	MinFiles     uint
+	DeleteRatio  float64
+	RenameRatio  float64
+	EntropyRatio float64
+}
+
+// ApplyDefaults returns a copy of o with the default options set for all
+// unset fields.
+func (o AnomalyOptions) ApplyDefaults() AnomalyOptions {
+	if o.Policy == "" {
+		o.Policy = AnomalyPolicyOff
+	}
+	if o.MinFiles == 0 {
+		o.MinFiles = 50
+	}
+	if o.DeleteRatio == 0 {
+		o.DeleteRatio = 0.5
+	}
+	if o.RenameRatio == 0 {
+		o.RenameRatio = 0.3
+	}
+	if o.EntropyRatio == 0 {
+		o.EntropyRatio = 0.5
+	}
+	return o
+}
+
+// Anomaly describes a suspicious change pattern.
+type Anomaly struct {
+	// Kind is one of "deletions", "renames" or "entropy".
+	Kind    string
+	Count   uint
+	Total   uint
+	Message string
+}
+
+func (a Anomaly) String() string {
+	return a.Message
+}
+
+// entropyThreshold is the Shannon entropy in bits per byte above which the
+// start of a file is considered to be encrypted or random data. Compressed
+// formats usually stay slightly below this value.
+const entropyThreshold = 7.95
+
+// entropySampleSize is the number of bytes at the start of a file used to
+// estimate the entropy.
+const entropySampleSize = 64 * 1024
+
+// AnomalyDetector collects statistics about the changes compared to the
+// parent snapshot and flags patterns typical for ransomware: many files
+// deleted, many files renamed to a new extension or the contents of many
+// modified files replaced by random looking data.
+//
+// The methods are safe for concurrent use.
+type AnomalyDetector struct {
+	opts AnomalyOptions
+
+	mu sync.Mutex
+	// previousFiles is the number of files in the parent snapshot within the
+	// directories visited so far.
+	previousFiles uint
+	deleted       uint
+	renamed       map[string]uint
+	modified      uint
+	highEntropy   map[string]struct{}
+	encrypted     uint
+}
+
+// NewAnomalyDetector returns a new detector.
+func NewAnomalyDetector(opts AnomalyOptions) *AnomalyDetector {
+	return &AnomalyDetector{
+		opts:        opts.ApplyDefaults(),
+		renamed:     make(map[string]uint),
+		highEntropy: make(map[string]struct{}),
+	}
+}
+
+// Policy returns the configured policy.
+func (d *AnomalyDetector) Policy() AnomalyPolicy {
+	return d.opts.Policy
+}
+
+// observeDir compares the entries of a directory with the directory in the
+// parent snapshot.
+func (d *AnomalyDetector) observeDir(previous *restic.Tree, names []string) {
+	if previous == nil {
+		return
+	}
+
+	current := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		current[name] = struct{}{}
+	}
+
+	// names of vanished files, with and without extension
+	var files, deleted uint
+	gone := make(map[string]struct{})
+	for _, node := range previous.Nodes {
+		if node.Type != restic.NodeTypeFile {
+			continue
+		}
+		files++
+		if _, ok := current[node.Name]; !ok {
+			deleted++
+			gone[node.Name] = struct{}{}
+			gone[stripExt(node.Name)] = struct{}{}
+		}
+	}
+
+	renamed := make(map[string]uint)
+	for _, name := range names {
+		if previous.Find(name) != nil {
+			continue
+		}
+		ext := path.Ext(name)
+		if ext == "" {
+			continue
+		}
+		// either "file.txt" -> "file.txt.locked" or "file.txt" -> "file.locked"
+		stem := strings.TrimSuffix(name, ext)
+		_, appended := gone[stem]
+		_, replaced := gone[stripExt(stem)]
+		if appended || replaced {
+			renamed[strings.ToLower(ext)]++
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.previousFiles += files
+	for ext, n := range renamed {
+		d.renamed[ext] += n
+		// a renamed file is not deleted
+		deleted -= min(deleted, n)
+	}
+	d.deleted += deleted
+}
+
+// observeData estimates the entropy of the start of the file at snPath.
+func (d *AnomalyDetector) observeData(snPath string, data []byte) {
+	if len(data) > entropySampleSize {
+		data = data[:entropySampleSize]
+	}
+	// small files never reach the threshold
+	if len(data) < 4096 || shannonEntropy(data) < entropyThreshold {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.highEntropy[snPath] = struct{}{}
+}
+
+// observeItem records a completed file.
+func (d *AnomalyDetector) observeItem(snPath string, previous, current *restic.Node) {
+	if current == nil || current.Type != restic.NodeTypeFile {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, high := d.highEntropy[snPath]
+	delete(d.highEntropy, snPath)
+
+	if previous == nil || previous.Equals(*current) || previous.Size == 0 {
+		return
+	}
+	d.modified++
+	if high {
+		d.encrypted++
+	}
+}
+
+// Anomalies returns the anomalies detected so far.
+func (d *AnomalyDetector) Anomalies() []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var res []Anomaly
+	exceeds := func(count, total uint, ratio float64) bool {
+		return count >= d.opts.MinFiles && total > 0 && float64(count)/float64(total) >= ratio
+	}
+
+	if exceeds(d.deleted, d.previousFiles, d.opts.DeleteRatio) {
+		res = append(res, Anomaly{
+			Kind:    "deletions",
+			Count:   d.deleted,
+			Total:   d.previousFiles,
+			Message: fmt.Sprintf("%d of %d files in the parent snapshot were deleted", d.deleted, d.previousFiles),
+		})
+	}
+
+	var ext string
+	var renamed uint
+	for e, n := range d.renamed {
+		if n > renamed || (n == renamed && e < ext) {
+			ext, renamed = e, n
+		}
+	}
+	if exceeds(renamed, d.previousFiles, d.opts.RenameRatio) {
+		res = append(res, Anomaly{
+			Kind:    "renames",
+			Count:   renamed,
+			Total:   d.previousFiles,
+			Message: fmt.Sprintf("%d of %d files in the parent snapshot were renamed to the extension %q", renamed, d.previousFiles, ext),
+		})
+	}
+
+	if exceeds(d.encrypted, d.modified, d.opts.EntropyRatio) {
+		res = append(res, Anomaly{
+			Kind:    "entropy",
+			Count:   d.encrypted,
+			Total:   d.modified,
+			Message: fmt.Sprintf("%d of %d modified files now contain random-looking data", d.encrypted, d.modified),
+		})
+	}
+
+	return res
+}
+
+// stripExt removes the last extension from name.
+func stripExt(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// shannonEntropy returns the entropy of data in bits per byte.
+func shannonEntropy(data []byte) float64 {
+	var counts [256]uint
+	for _, b := range data {
+		counts[b]++
+	}
+
+	var h float64
+	n := float64(len(data))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,145 @@
+package archiver
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseAnomalyPolicy(t *testing.T) {
+	for _, s := range []string{"off", "warn", "tag", "abort"} {
+		p, err := ParseAnomalyPolicy(s)
+		rtest.OK(t, err)
+		rtest.Equals(t, AnomalyPolicy(s), p)
+	}
+
+	p, err := ParseAnomalyPolicy("")
+	rtest.OK(t, err)
+	rtest.Equals(t, AnomalyPolicyOff, p)
+
+	_, err = ParseAnomalyPolicy("foo")
+	rtest.Assert(t, err != nil, "expected error for invalid policy")
+}
+
+func TestShannonEntropy(t *testing.T) {
+	zeros := make([]byte, 4096)
+	rtest.Assert(t, shannonEntropy(zeros) == 0, "entropy of zeros is %v", shannonEntropy(zeros))
+
+	random := make([]byte, 64*1024)
+	_, err := rand.Read(random)
+	rtest.OK(t, err)
+	rtest.Assert(t, shannonEntropy(random) > entropyThreshold, "entropy of random data is %v", shannonEntropy(random))
+}
+
+func anomalyKinds(anomalies []Anomaly) []string {
+	var kinds []string
+	for _, a := range anomalies {
+		kinds = append(kinds, a.Kind)
+	}
+	return kinds
+}
+
+func TestAnomalyDetectorDir(t *testing.T) {
+	previous := restic.NewTree(10)
+	for i := 0; i < 10; i++ {
+		rtest.OK(t, previous.Insert(&restic.Node{Name: fmt.Sprintf("file%02d.txt", i), Type: restic.NodeTypeFile}))
+	}
+
+	var tests = []struct {
+		names []string
+		kinds []string
+	}{
+		{
+			names: []string{"file00.txt", "file01.txt", "file02.txt", "file03.txt", "file04.txt",
+				"file05.txt", "file06.txt", "file07.txt", "file08.txt", "file09.txt"},
+		},
+		{
+			names: []string{"file00.txt", "file01.txt"},
+			kinds: []string{"deletions"},
+		},
+		{
+			names: []string{"file00.txt.locked", "file01.txt.locked", "file02.txt.locked", "file03.txt.locked",
+				"file04.locked", "file05.locked", "file06.txt", "file07.txt", "file08.txt", "file09.txt"},
+			kinds: []string{"renames"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			d := NewAnomalyDetector(AnomalyOptions{Policy: AnomalyPolicyWarn, MinFiles: 5})
+			d.observeDir(previous, test.names)
+			rtest.Equals(t, test.kinds, anomalyKinds(d.Anomalies()))
+		})
+	}
+}
+
+func TestAnomalyDetectorEntropy(t *testing.T) {
+	random := make([]byte, 8192)
+	_, err := rand.Read(random)
+	rtest.OK(t, err)
+
+	d := NewAnomalyDetector(AnomalyOptions{Policy: AnomalyPolicyWarn, MinFiles: 3})
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("/file%d", i)
+		previous := &restic.Node{Name: name, Type: restic.NodeTypeFile, Size: 10}
+		current := &restic.Node{Name: name, Type: restic.NodeTypeFile, Size: 8192}
+		if i < 3 {
+			d.observeData(name, random)
+		}
+		d.observeItem(name, previous, current)
+	}
+	rtest.Equals(t, []string{"entropy"}, anomalyKinds(d.Anomalies()))
+}
+
+func TestArchiverAnomalyPolicy(t *testing.T) {
+	src := TestDir{}
+	for i := 0; i < 10; i++ {
+		src[fmt.Sprintf("file%02d.txt", i)] = TestFile{Content: fmt.Sprintf("content %d", i)}
+	}
+
+	for _, policy := range []AnomalyPolicy{AnomalyPolicyWarn, AnomalyPolicyTag, AnomalyPolicyAbort} {
+		t.Run(string(policy), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tempdir, repo := prepareTempdirRepoSrc(t, src)
+			back := rtest.Chdir(t, tempdir)
+			defer back()
+
+			arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+			arch.Anomalies = NewAnomalyDetector(AnomalyOptions{Policy: policy, MinFiles: 5})
+			parent, _, summary, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+			rtest.OK(t, err)
+			rtest.Equals(t, 0, len(summary.Anomalies))
+
+			for i := 0; i < 8; i++ {
+				rtest.OK(t, os.Remove(filepath.Join(tempdir, fmt.Sprintf("file%02d.txt", i))))
+			}
+
+			arch.Anomalies = NewAnomalyDetector(AnomalyOptions{Policy: policy, MinFiles: 5})
+			sn, _, summary, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: parent})
+			rtest.Equals(t, []string{"deletions"}, anomalyKinds(summary.Anomalies))
+
+			switch policy {
+			case AnomalyPolicyAbort:
+				rtest.Assert(t, errors.Is(err, ErrAnomalyDetected), "expected ErrAnomalyDetected, got %v", err)
+				rtest.Assert(t, sn == nil, "snapshot was created")
+			case AnomalyPolicyTag:
+				rtest.OK(t, err)
+				rtest.Assert(t, sn.HasTags([]string{SuspectTag}), "snapshot is not tagged: %v", sn.Tags)
+			default:
+				rtest.OK(t, err)
+				rtest.Assert(t, !sn.HasTags([]string{SuspectTag}), "snapshot is tagged: %v", sn.Tags)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package archiver
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"runtime"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/events"
 	"github.com/restic/restic/internal/feature"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
@@ -54,6 +57,15 @@ type Summary struct {
 	Files, Dirs    ChangeStats
 	ProcessedBytes uint64
 	ItemStats
+	// Anomalies lists the suspicious changes found by the anomaly detector.
+	Anomalies []Anomaly
+	// Classification lists the files per content class if a classifier is
+	// set.
+	Classification map[string]restic.ContentClassStats
+	// SpecialFiles counts the device nodes, FIFOs and sockets.
+	SpecialFiles restic.SpecialFileStats
+	// SlowFiles lists the slowest files if a SlowFileTracker is set.
+	SlowFiles []FileTiming
 }
 
 // Add adds other to the current ItemStats.
@@ -102,6 +114,7 @@ type Archiver struct {
 	treeSaver *treeSaver
 	mu        sync.Mutex
 	summary   *Summary
+	events    events.Sink
 
 	// Error is called for all errors that occur during backup.
 	Error ErrorFunc
@@ -131,6 +144,27 @@ type Archiver struct {
 
 	// Flags controlling change detection. See doc/040_backup.rst for details.
 	ChangeIgnoreFlags uint
+
+	// Anomalies, if set, is used to detect suspicious changes compared to the
+	// parent snapshot. The configured policy is applied in Snapshot.
+	Anomalies *AnomalyDetector
+
+	// Classifier, if set, assigns the files to content classes. The
+	// statistics are stored in the snapshot summary and the snapshot is
+	// tagged with the class holding most of the data.
+	Classifier *Classifier
+
+	// SpecialFiles determines whether device nodes, FIFOs and sockets are
+	// stored.
+	SpecialFiles restic.SpecialFilesPolicy
+
+	// LimitRead, if set, wraps the readers for file contents, e.g. to limit
+	// the rate at which files are read from disk.
+	LimitRead func(io.Reader) io.Reader
+
+	// SlowFiles, if set, records the time spent saving each file. The
+	// slowest files are stored in the summary.
+	SlowFiles *SlowFileTracker
 }
 
 // Flags for the ChangeIgnoreFlags bitfield.
@@ -207,7 +241,8 @@ func (arch *Archiver) error(item string, err error) error {
 		return err
 	}
 
-	if err == context.Canceled {
+	if err == context.Canceled || errors.Is(err, restic.ErrSpecialFile) {
+		// abort the backup as requested
 		return err
 	}
 
@@ -225,6 +260,12 @@ func (arch *Archiver) error(item string, err error) error {
 
 func (arch *Archiver) trackItem(item string, previous, current *restic.Node, s ItemStats, d time.Duration) {
 	arch.CompleteItem(item, previous, current, s, d)
+	if arch.Anomalies != nil {
+		arch.Anomalies.observeItem(item, previous, current)
+	}
+	if arch.Classifier != nil {
+		arch.Classifier.observeItem(item, current)
+	}
 
 	arch.mu.Lock()
 	defer arch.mu.Unlock()
@@ -320,6 +361,9 @@ func (arch *Archiver) saveDir(ctx context.Context, snPath string, dir string, me
 	if err != nil {
 		return futureNode{}, err
 	}
+	if arch.Anomalies != nil {
+		arch.Anomalies.observeDir(previous, names)
+	}
 
 	nodes := make([]futureNode, 0, len(names))
 
@@ -377,6 +421,7 @@ func (arch *Archiver) dirToNodeAndEntries(snPath, dir string, meta fs.File) (nod
 		return nil, nil, fmt.Errorf("readdirnames %v failed: %w", dir, err)
 	}
 	sort.Strings(names)
+	fs.PrefetchMetadata(meta, names)
 
 	return node, names, nil
 }
@@ -433,7 +478,7 @@ func (fn *futureNode) take(ctx context.Context) futureNodeResult {
 // present in the index.
 func (arch *Archiver) allBlobsPresent(previous *restic.Node) bool {
 	// check if all blobs are contained in index
-	for _, id := range previous.Content {
+	for _, id := range previous.DataBlobs() {
 		if _, ok := arch.Repo.LookupBlobSize(restic.DataBlob, id); !ok {
 			return false
 		}
@@ -441,6 +486,28 @@ func (arch *Archiver) allBlobsPresent(previous *restic.Node) bool {
 	return true
 }
 
+// classifyUnchanged reads the start of an unchanged file, which is not read
+// otherwise, to classify it by its content. Errors are ignored, the file is
+// then counted as ClassOther.
+func (arch *Archiver) classifyUnchanged(snPath, target string) {
+	f, err := arch.FS.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, false)
+	if err != nil {
+		debug.Log("unable to open %v for classification: %v", target, err)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	buf := make([]byte, classifyHeaderSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		debug.Log("unable to read %v for classification: %v", target, err)
+		return
+	}
+	arch.Classifier.observeData(snPath, buf[:n])
+}
+
 // save saves a target (file or directory) to the repo. If the item is
 // excluded, this function returns a nil node and error, with excluded set to
 // true.
@@ -513,6 +580,9 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 		if previous != nil && !fileChanged(fi, previous, arch.ChangeIgnoreFlags) {
 			if arch.allBlobsPresent(previous) {
 				debug.Log("%v hasn't changed, using old list of blobs", target)
+				if arch.Classifier != nil && arch.Classifier.needsData(snPath) {
+					arch.classifyUnchanged(snPath, target)
+				}
 				arch.trackItem(snPath, previous, previous, ItemStats{}, time.Since(start))
 				arch.CompleteBlob(previous.Size)
 				node, err := arch.nodeFromFileInfo(snPath, target, meta, false)
@@ -522,6 +592,7 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 
 				// copy list of blobs
 				node.Content = previous.Content
+				node.AlternateStreams = previous.AlternateStreams
 
 				fn = newFutureNodeWithResult(futureNodeResult{
 					snPath: snPath,
@@ -592,10 +663,6 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 			return futureNode{}, false, err
 		}
 
-	case fi.Mode&os.ModeSocket > 0:
-		debug.Log("  %v is a socket, ignoring", target)
-		return futureNode{}, true, nil
-
 	default:
 		debug.Log("  %v other", target)
 
@@ -603,6 +670,19 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 		if err != nil {
 			return futureNode{}, false, err
 		}
+		if node.Type.IsSpecial() {
+			include, err := arch.SpecialFiles.Include(node.Type)
+			if err != nil {
+				return futureNode{}, false, fmt.Errorf("%v: %w", target, err)
+			}
+			arch.mu.Lock()
+			arch.summary.SpecialFiles.Add(node.Type, include)
+			arch.mu.Unlock()
+			if !include {
+				debug.Log("  %v is a %v, skipping", target, node.Type)
+				return futureNode{}, true, nil
+			}
+		}
 		fn = newFutureNodeWithResult(futureNodeResult{
 			snPath: snPath,
 			target: target,
@@ -672,6 +752,10 @@ func (arch *Archiver) saveTree(ctx context.Context, snPath string, atree *tree,
 	debug.Log("%v (%v nodes), parent %v", snPath, len(atree.Nodes), previous)
 	nodeNames := atree.NodeNames()
 	nodes := make([]futureNode, 0, len(nodeNames))
+	if arch.Anomalies != nil {
+		// targets such as "." are expanded to the directory contents
+		arch.Anomalies.observeDir(previous, nodeNames)
+	}
 
 	// iterate over the nodes of atree in lexicographic (=deterministic) order
 	for _, name := range nodeNames {
@@ -802,8 +886,31 @@ type SnapshotOptions struct {
 	ProgramVersion string
 	// SkipIfUnchanged omits the snapshot creation if it is identical to the parent snapshot.
 	SkipIfUnchanged bool
+	// SigningKey is used to sign the snapshot if set.
+	SigningKey ed25519.PrivateKey
+	// ExtraTags is called after all data was read, the returned tags are
+	// added to the snapshot.
+	ExtraTags func() restic.TagList
+	// VSSWriters is called after all data was read, the returned writers are
+	// stored in the snapshot.
+	VSSWriters func() []restic.VSSWriter
+	// AuxiliaryDocuments is called after all data was read, the returned
+	// documents are stored in a separate tree which is referenced by the
+	// snapshot.
+	AuxiliaryDocuments func() []restic.AuxiliaryDocument
+	// AccountNames is called after all data was read, the returned mapping
+	// of SIDs to account names is stored in the snapshot.
+	AccountNames func() map[string]string
+	// Checkpoint stops the backup once it is closed. The data saved so far is
+	// uploaded and indexed, such that the next backup does not upload it
+	// again, and Snapshot returns ErrCheckpoint.
+	Checkpoint <-chan struct{}
 }
 
+// ErrCheckpoint is returned by Snapshot if the backup was stopped by closing
+// SnapshotOptions.Checkpoint.
+var ErrCheckpoint = errors.New("backup interrupted, data saved so far was uploaded")
+
 // loadParentTree loads a tree referenced by snapshot id. If id is null, nil is returned.
 func (arch *Archiver) loadParentTree(ctx context.Context, sn *restic.Snapshot) *restic.Tree {
 	if sn == nil {
@@ -828,6 +935,9 @@ func (arch *Archiver) loadParentTree(ctx context.Context, sn *restic.Snapshot) *
 // runWorkers starts the worker pools, which are stopped when the context is cancelled.
 func (arch *Archiver) runWorkers(ctx context.Context, wg *errgroup.Group) {
 	arch.blobSaver = newBlobSaver(ctx, wg, arch.Repo, arch.Options.SaveBlobConcurrency)
+	if arch.SlowFiles != nil {
+		arch.blobSaver.hash = arch.Repo.Config().BlobHash
+	}
 
 	arch.fileSaver = newFileSaver(ctx, wg,
 		arch.blobSaver.Save,
@@ -835,6 +945,21 @@ func (arch *Archiver) runWorkers(ctx context.Context, wg *errgroup.Group) {
 		arch.Options.ReadConcurrency, arch.Options.SaveBlobConcurrency)
 	arch.fileSaver.CompleteBlob = arch.CompleteBlob
 	arch.fileSaver.NodeFromFileInfo = arch.nodeFromFileInfo
+	arch.fileSaver.LimitRead = arch.LimitRead
+	if arch.SlowFiles != nil {
+		arch.fileSaver.Timing = arch.SlowFiles.observe
+	}
+	switch {
+	case arch.Anomalies != nil && arch.Classifier != nil:
+		arch.fileSaver.ObserveData = func(snPath string, data []byte) {
+			arch.Anomalies.observeData(snPath, data)
+			arch.Classifier.observeData(snPath, data)
+		}
+	case arch.Anomalies != nil:
+		arch.fileSaver.ObserveData = arch.Anomalies.observeData
+	case arch.Classifier != nil:
+		arch.fileSaver.ObserveData = arch.Classifier.observeData
+	}
 
 	arch.treeSaver = newTreeSaver(ctx, wg, arch.Options.SaveTreeConcurrency, arch.blobSaver.Save, arch.Error)
 }
@@ -865,12 +990,36 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 	}
 
 	var rootTreeID restic.ID
+	var auxiliaryTreeID *restic.ID
 
 	wgUp, wgUpCtx := errgroup.WithContext(ctx)
 	arch.Repo.StartPackUploader(wgUpCtx, wgUp)
 
+	// a checkpoint only stops reading files, the uploader must keep running
+	// to save the data read so far
+	readCtx, stopReading := context.WithCancel(wgUpCtx)
+	defer stopReading()
+	if opts.Checkpoint != nil {
+		go func() {
+			select {
+			case <-opts.Checkpoint:
+				debug.Log("checkpoint requested")
+				stopReading()
+			case <-readCtx.Done():
+			}
+		}()
+	}
+	checkpointRequested := func() bool {
+		select {
+		case <-opts.Checkpoint:
+			return true
+		default:
+			return false
+		}
+	}
+
 	wgUp.Go(func() error {
-		wg, wgCtx := errgroup.WithContext(wgUpCtx)
+		wg, wgCtx := errgroup.WithContext(readCtx)
 		start := time.Now()
 
 		wg.Go(func() error {
@@ -905,14 +1054,38 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		err = wg.Wait()
 		debug.Log("err is %v", err)
 
+		if err != nil && checkpointRequested() && errors.Is(err, context.Canceled) && wgUpCtx.Err() == nil {
+			debug.Log("saving checkpoint")
+			if err := arch.Repo.Flush(ctx); err != nil {
+				return err
+			}
+			return ErrCheckpoint
+		}
 		if err != nil {
 			debug.Log("error while saving tree: %v", err)
 			return err
 		}
 
+		if opts.AuxiliaryDocuments != nil {
+			if docs := opts.AuxiliaryDocuments(); len(docs) > 0 {
+				id, err := SaveAuxiliaryDocuments(wgUpCtx, arch.Repo, arch.Repo.Config().ChunkerPolynomial, docs, time.Now())
+				if err != nil {
+					return fmt.Errorf("saving auxiliary documents failed: %w", err)
+				}
+				auxiliaryTreeID = &id
+			}
+		}
+
 		return arch.Repo.Flush(ctx)
 	})
 	err = wgUp.Wait()
+	if arch.SlowFiles != nil {
+		arch.summary.SlowFiles = arch.SlowFiles.Slowest()
+	}
+	if errors.Is(err, ErrCheckpoint) {
+		arch.summary.BackupEnd = time.Now()
+		return nil, restic.ID{}, arch.summary, err
+	}
 	if err != nil {
 		return nil, restic.ID{}, nil, err
 	}
@@ -920,17 +1093,50 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 	if opts.ParentSnapshot != nil && opts.SkipIfUnchanged {
 		ps := opts.ParentSnapshot
 		if ps.Tree != nil && rootTreeID.Equal(*ps.Tree) {
+			arch.summary.BackupEnd = time.Now()
+			arch.reportSummary(restic.ID{})
 			return nil, restic.ID{}, arch.summary, nil
 		}
 	}
 
-	sn, err := restic.NewSnapshot(targets, opts.Tags, opts.Hostname, opts.Time)
+	tags := opts.Tags
+	if opts.ExtraTags != nil {
+		tags = append(append(restic.TagList{}, tags...), opts.ExtraTags()...)
+	}
+	if arch.Anomalies != nil && arch.Anomalies.Policy() != AnomalyPolicyOff {
+		arch.summary.Anomalies = arch.Anomalies.Anomalies()
+		if len(arch.summary.Anomalies) > 0 {
+			switch arch.Anomalies.Policy() {
+			case AnomalyPolicyAbort:
+				arch.summary.BackupEnd = time.Now()
+				return nil, restic.ID{}, arch.summary, fmt.Errorf("%w, refusing to create snapshot: %v", ErrAnomalyDetected, arch.summary.Anomalies[0])
+			case AnomalyPolicyTag:
+				tags = append(append(restic.TagList{}, tags...), SuspectTag)
+			}
+		}
+	}
+
+	if arch.Classifier != nil {
+		arch.summary.Classification = arch.Classifier.Stats()
+		if class := DominantClass(arch.summary.Classification); class != "" {
+			tags = append(append(restic.TagList{}, tags...), ContentTagPrefix+class)
+		}
+	}
+
+	sn, err := restic.NewSnapshot(targets, tags, opts.Hostname, opts.Time)
 	if err != nil {
 		return nil, restic.ID{}, nil, err
 	}
 
 	sn.ProgramVersion = opts.ProgramVersion
 	sn.Excludes = opts.Excludes
+	if opts.VSSWriters != nil {
+		sn.VSSWriters = opts.VSSWriters()
+	}
+	sn.Auxiliary = auxiliaryTreeID
+	if opts.AccountNames != nil {
+		sn.AccountNames = opts.AccountNames()
+	}
 	if opts.ParentSnapshot != nil {
 		sn.Parent = opts.ParentSnapshot.ID()
 	}
@@ -953,11 +1159,21 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		TotalFilesProcessed: arch.summary.Files.New + arch.summary.Files.Changed + arch.summary.Files.Unchanged,
 		TotalBytesProcessed: arch.summary.ProcessedBytes,
 	}
+	sn.Summary.DedupRatio = restic.DedupRatio(sn.Summary.TotalBytesProcessed, sn.Summary.DataAdded)
+	sn.Summary.Classification = arch.summary.Classification
+
+	if opts.SigningKey != nil {
+		err = sn.Sign(opts.SigningKey)
+		if err != nil {
+			return nil, restic.ID{}, nil, err
+		}
+	}
 
 	id, err := restic.SaveSnapshot(ctx, arch.Repo, sn)
 	if err != nil {
 		return nil, restic.ID{}, nil, err
 	}
 
+	arch.reportSummary(id)
 	return sn, id, arch.summary, nil
 }
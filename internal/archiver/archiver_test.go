@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -2037,6 +2038,56 @@ func TestArchiverContextCanceled(t *testing.T) {
 	t.Fatalf("expected error not returned by archiver")
 }
 
+// checkpointFS closes the checkpoint channel when the file "z" is opened, once
+// the file "a" has been saved.
+type checkpointFS struct {
+	fs.FS
+	saved      <-chan struct{}
+	checkpoint chan<- struct{}
+	once       sync.Once
+}
+
+func (f *checkpointFS) OpenFile(name string, flag int, metadataOnly bool) (fs.File, error) {
+	if filepath.Base(name) == "z" {
+		f.once.Do(func() {
+			<-f.saved
+			close(f.checkpoint)
+		})
+		return nil, context.Canceled
+	}
+	return f.FS.OpenFile(name, flag, metadataOnly)
+}
+
+func TestArchiverCheckpoint(t *testing.T) {
+	const content = "data saved before the checkpoint"
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"a": TestFile{Content: content},
+		"z": TestFile{Content: "not read"},
+	})
+
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	saved := make(chan struct{})
+	checkpoint := make(chan struct{})
+	arch := New(repo, &checkpointFS{FS: fs.Local{}, saved: saved, checkpoint: checkpoint}, Options{ReadConcurrency: 1})
+	var once sync.Once
+	arch.CompleteItem = func(item string, _, current *restic.Node, _ ItemStats, _ time.Duration) {
+		if current != nil && current.Type == restic.NodeTypeFile && path.Base(item) == "a" {
+			once.Do(func() { close(saved) })
+		}
+	}
+
+	_, id, summary, err := arch.Snapshot(context.TODO(), []string{"."}, SnapshotOptions{Time: time.Now(), Checkpoint: checkpoint})
+	rtest.Assert(t, errors.Is(err, ErrCheckpoint), "expected ErrCheckpoint, got %v", err)
+	rtest.Assert(t, id.IsNull(), "snapshot %v was saved", id)
+	rtest.Assert(t, summary != nil, "summary missing")
+
+	// the data read before the checkpoint must be uploaded and indexed
+	blobs := repo.LookupBlob(restic.DataBlob, restic.Hash([]byte(content)))
+	rtest.Assert(t, len(blobs) == 1, "data blob of file a was not saved, found %v", blobs)
+}
+
 // TrackFS keeps track which files are opened. For some files, an error is injected.
 type TrackFS struct {
 	fs.FS
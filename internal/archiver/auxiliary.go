@@ -0,0 +1,136 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// auxiliaryDir is a directory in the tree of the auxiliary documents.
+type auxiliaryDir struct {
+	dirs  map[string]*auxiliaryDir
+	files map[string][]byte
+}
+
+func newAuxiliaryDir() *auxiliaryDir {
+	return &auxiliaryDir{dirs: make(map[string]*auxiliaryDir), files: make(map[string][]byte)}
+}
+
+// add inserts the document at the slash separated path below dir.
+func (dir *auxiliaryDir) add(p string, data []byte) error {
+	if p == "" || path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") {
+		return errors.Errorf("invalid document path %q", p)
+	}
+
+	parts := strings.Split(p, "/")
+	for _, name := range parts[:len(parts)-1] {
+		if _, ok := dir.files[name]; ok {
+			return errors.Errorf("document path %q conflicts with another document", p)
+		}
+		sub, ok := dir.dirs[name]
+		if !ok {
+			sub = newAuxiliaryDir()
+			dir.dirs[name] = sub
+		}
+		dir = sub
+	}
+
+	name := parts[len(parts)-1]
+	if _, ok := dir.files[name]; ok {
+		return errors.Errorf("duplicate document path %q", p)
+	}
+	if _, ok := dir.dirs[name]; ok {
+		return errors.Errorf("document path %q conflicts with another document", p)
+	}
+	dir.files[name] = data
+	return nil
+}
+
+// SaveAuxiliaryDocuments stores the documents as files in a new tree and
+// returns its ID. The content of the documents is split into chunks using the
+// polynomial pol, mtime is used as the modification time of all files and
+// directories.
+func SaveAuxiliaryDocuments(ctx context.Context, repo restic.BlobSaver, pol chunker.Pol, docs []restic.AuxiliaryDocument, mtime time.Time) (restic.ID, error) {
+	root := newAuxiliaryDir()
+	for _, doc := range docs {
+		if err := root.add(doc.Path, doc.Data); err != nil {
+			return restic.ID{}, err
+		}
+	}
+	return saveAuxiliaryDir(ctx, repo, pol, root, mtime)
+}
+
+func saveAuxiliaryDir(ctx context.Context, repo restic.BlobSaver, pol chunker.Pol, dir *auxiliaryDir, mtime time.Time) (restic.ID, error) {
+	names := make([]string, 0, len(dir.dirs)+len(dir.files))
+	for name := range dir.dirs {
+		names = append(names, name)
+	}
+	for name := range dir.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tree := restic.NewTree(len(names))
+	for _, name := range names {
+		node := &restic.Node{
+			Name:       name,
+			ModTime:    mtime,
+			AccessTime: mtime,
+			ChangeTime: mtime,
+		}
+
+		if sub, ok := dir.dirs[name]; ok {
+			id, err := saveAuxiliaryDir(ctx, repo, pol, sub, mtime)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			node.Type = restic.NodeTypeDir
+			node.Mode = os.ModeDir | 0755
+			node.Subtree = &id
+		} else {
+			data := dir.files[name]
+			content, err := saveAuxiliaryContent(ctx, repo, pol, data)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			node.Type = restic.NodeTypeFile
+			node.Mode = 0644
+			node.Size = uint64(len(data))
+			node.Content = content
+		}
+
+		if err := tree.Insert(node); err != nil {
+			return restic.ID{}, err
+		}
+	}
+	return restic.SaveTree(ctx, repo, tree)
+}
+
+func saveAuxiliaryContent(ctx context.Context, repo restic.BlobSaver, pol chunker.Pol, data []byte) (restic.IDs, error) {
+	content := restic.IDs{}
+	chnker := chunker.New(bytes.NewReader(data), pol)
+	for {
+		chunk, err := chnker.Next(nil)
+		if err == io.EOF {
+			return content, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		id, _, _, err := repo.SaveBlob(ctx, restic.DataBlob, chunk.Data, restic.ID{}, false)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, id)
+	}
+}
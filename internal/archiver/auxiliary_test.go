@@ -0,0 +1,88 @@
+package archiver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestArchiverAuxiliaryDocuments(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{"foo": TestFile{Content: "foo"}}
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	// large enough to be split into several chunks
+	large := strings.Repeat("<component name=\"data\"/>\n", 200000)
+	docs := []restic.AuxiliaryDocument{
+		{Path: "vss/c/writers/{a}.xml", Data: []byte("<writer/>")},
+		{Path: "vss/c/backup_components.xml", Data: []byte(large)},
+		{Path: "empty", Data: nil},
+	}
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	sn, id, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{
+		Time:               time.Now(),
+		AuxiliaryDocuments: func() []restic.AuxiliaryDocument { return docs },
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, sn.Auxiliary != nil, "snapshot has no auxiliary tree")
+
+	TestEnsureSnapshot(t, repo, id, src)
+	TestEnsureTree(ctx, t, "/", repo, *sn.Auxiliary, TestDir{
+		"vss": TestDir{
+			"c": TestDir{
+				"backup_components.xml": TestFile{Content: large},
+				"writers": TestDir{
+					"{a}.xml": TestFile{Content: "<writer/>"},
+				},
+			},
+		},
+		"empty": TestFile{Content: ""},
+	})
+	rtest.Equals(t, restic.IDs{*sn.Tree, *sn.Auxiliary}, sn.TreeIDs())
+
+	// the blobs of the auxiliary tree must not be reported as unused
+	checker.TestCheckRepo(t, repo, false)
+}
+
+func TestArchiverNoAuxiliaryDocuments(t *testing.T) {
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{"foo": TestFile{Content: "foo"}})
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	sn, _, _, err := arch.Snapshot(context.TODO(), []string{"."}, SnapshotOptions{
+		Time:               time.Now(),
+		AuxiliaryDocuments: func() []restic.AuxiliaryDocument { return nil },
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, sn.Auxiliary == nil, "unexpected auxiliary tree %v", sn.Auxiliary)
+}
+
+func TestAuxiliaryDocumentPaths(t *testing.T) {
+	for _, p := range []string{"", "/abs", "a//b", "a/../b", "..", "../a", "a/", "./a"} {
+		err := newAuxiliaryDir().add(p, nil)
+		rtest.Assert(t, err != nil, "expected error for path %q", p)
+	}
+
+	for _, paths := range [][]string{
+		{"a", "a"},
+		{"a", "a/b"},
+		{"a/b", "a"},
+	} {
+		dir := newAuxiliaryDir()
+		rtest.OK(t, dir.add(paths[0], nil))
+		err := dir.add(paths[1], nil)
+		rtest.Assert(t, err != nil, "expected conflict for %v", paths)
+	}
+}
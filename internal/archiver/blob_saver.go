@@ -3,7 +3,9 @@ package archiver
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sync/errgroup"
@@ -18,6 +20,10 @@ type saver interface {
 type blobSaver struct {
 	repo saver
 	ch   chan<- saveBlobJob
+
+	// hash, if set, is used to calculate the blob ID before passing the blob
+	// to the repository, such that the time spent hashing can be measured.
+	hash func(data []byte) restic.ID
 }
 
 // newBlobSaver returns a new blob. A worker pool is started, it is stopped
@@ -64,10 +70,21 @@ type saveBlobResponse struct {
 	length     int
 	sizeInRepo int
 	known      bool
+
+	hashDuration time.Duration
+	saveDuration time.Duration
 }
 
 func (s *blobSaver) saveBlob(ctx context.Context, t restic.BlobType, buf []byte) (saveBlobResponse, error) {
-	id, known, sizeInRepo, err := s.repo.SaveBlob(ctx, t, buf, restic.ID{}, false)
+	start := time.Now()
+	var id restic.ID
+	// all zero chunks are special cased by the repository
+	if s.hash != nil && (len(buf) != chunker.MinSize || restic.ZeroPrefixLen(buf) != chunker.MinSize) {
+		id = s.hash(buf)
+	}
+	hashed := time.Now()
+
+	id, known, sizeInRepo, err := s.repo.SaveBlob(ctx, t, buf, id, false)
 
 	if err != nil {
 		return saveBlobResponse{}, err
@@ -78,6 +95,9 @@ func (s *blobSaver) saveBlob(ctx context.Context, t restic.BlobType, buf []byte)
 		length:     len(buf),
 		sizeInRepo: sizeInRepo,
 		known:      known,
+
+		hashDuration: hashed.Sub(start),
+		saveDuration: time.Since(hashed),
 	}, nil
 }
 
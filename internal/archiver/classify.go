@@ -0,0 +1,278 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Content classes assigned by the built-in rules.
+const (
+	ClassDocuments = "documents"
+	ClassMedia     = "media"
+	ClassVMImages  = "vm-images"
+	ClassArchives  = "archives"
+	ClassDatabases = "databases"
+	ClassOther     = "other"
+)
+
+// ContentTagPrefix is prepended to the class holding most of the data of a
+// snapshot to form the tag added by the classifier, e.g. "content:media".
+const ContentTagPrefix = "content:"
+
+// classifyHeaderSize is the number of bytes at the start of a file which are
+// available to magic byte rules.
+const classifyHeaderSize = 64 * 1024
+
+// ClassRule assigns Class to files either by their extension or by the bytes
+// Magic at Offset within the file.
+type ClassRule struct {
+	Class string
+	// Ext is the lower case file extension including the dot, e.g. ".pdf".
+	Ext    string
+	Magic  []byte
+	Offset int
+}
+
+func (r ClassRule) matches(data []byte) bool {
+	return len(r.Magic) > 0 && len(data) >= r.Offset+len(r.Magic) &&
+		bytes.Equal(data[r.Offset:r.Offset+len(r.Magic)], r.Magic)
+}
+
+func extRules(class string, exts ...string) []ClassRule {
+	rules := make([]ClassRule, 0, len(exts))
+	for _, ext := range exts {
+		rules = append(rules, ClassRule{Class: class, Ext: ext})
+	}
+	return rules
+}
+
+// DefaultClassRules are the built-in rules, rules passed to NewClassifier take
+// precedence.
+var DefaultClassRules = slices.Concat(
+	extRules(ClassDocuments, ".pdf", ".doc", ".docx", ".odt", ".rtf", ".txt", ".md",
+		".xls", ".xlsx", ".ods", ".csv", ".ppt", ".pptx", ".odp", ".htm", ".html", ".epub", ".eml", ".msg"),
+	extRules(ClassMedia, ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp", ".heic",
+		".cr2", ".nef", ".dng", ".psd", ".mp3", ".flac", ".wav", ".ogg", ".m4a", ".aac",
+		".mp4", ".m4v", ".mkv", ".avi", ".mov", ".wmv", ".webm", ".mpg", ".mpeg"),
+	extRules(ClassVMImages, ".vmdk", ".vhd", ".vhdx", ".avhdx", ".qcow2", ".vdi", ".iso", ".ova"),
+	extRules(ClassArchives, ".zip", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".7z", ".rar"),
+	extRules(ClassDatabases, ".db", ".sqlite", ".sqlite3", ".mdf", ".ndf", ".ldf", ".ibd", ".accdb", ".mdb"),
+	[]ClassRule{
+		{Class: ClassDocuments, Magic: []byte("%PDF-")},
+		{Class: ClassDocuments, Magic: []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}},
+		{Class: ClassMedia, Magic: []byte{0xff, 0xd8, 0xff}},
+		{Class: ClassMedia, Magic: []byte("\x89PNG\r\n\x1a\n")},
+		{Class: ClassMedia, Magic: []byte("GIF8")},
+		{Class: ClassMedia, Magic: []byte("ID3")},
+		{Class: ClassMedia, Magic: []byte("fLaC")},
+		{Class: ClassMedia, Magic: []byte("OggS")},
+		{Class: ClassMedia, Magic: []byte("RIFF")},
+		{Class: ClassMedia, Magic: []byte("ftyp"), Offset: 4},
+		{Class: ClassMedia, Magic: []byte{0x1a, 0x45, 0xdf, 0xa3}},
+		{Class: ClassVMImages, Magic: []byte("KDMV")},
+		{Class: ClassVMImages, Magic: []byte("vhdxfile")},
+		{Class: ClassVMImages, Magic: []byte("conectix")},
+		{Class: ClassVMImages, Magic: []byte("QFI\xfb")},
+		{Class: ClassVMImages, Magic: []byte("<<< Oracle VM VirtualBox Disk Image >>>")},
+		{Class: ClassVMImages, Magic: []byte("CD001"), Offset: 0x8001},
+		{Class: ClassArchives, Magic: []byte("PK\x03\x04")},
+		{Class: ClassArchives, Magic: []byte{0x1f, 0x8b}},
+		{Class: ClassArchives, Magic: []byte("BZh")},
+		{Class: ClassArchives, Magic: []byte("\xfd7zXZ\x00")},
+		{Class: ClassArchives, Magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+		{Class: ClassArchives, Magic: []byte("7z\xbc\xaf\x27\x1c")},
+		{Class: ClassArchives, Magic: []byte("Rar!")},
+		{Class: ClassArchives, Magic: []byte("ustar"), Offset: 257},
+		{Class: ClassDatabases, Magic: []byte("SQLite format 3\x00")},
+	},
+)
+
+// ParseClassRules reads classification rules, one per line in the format
+// "class pattern". The pattern is either "*.ext" to match the extension of
+// the file name or "magic:offset:hex" to match the hex encoded bytes at the
+// given offset. Empty lines and lines starting with # are ignored.
+func ParseClassRules(rd io.Reader) ([]ClassRule, error) {
+	var rules []ClassRule
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("line %d: expected class and pattern, got %q", line, text)
+		}
+		rule, err := parseClassPattern(fields[0], fields[1])
+		if err != nil {
+			return nil, errors.Errorf("line %d: %v", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, sc.Err()
+}
+
+func parseClassPattern(class, pattern string) (ClassRule, error) {
+	rule := ClassRule{Class: class}
+	if ext, ok := strings.CutPrefix(pattern, "*."); ok && ext != "" && !strings.ContainsAny(ext, "*?/") {
+		rule.Ext = "." + strings.ToLower(ext)
+		return rule, nil
+	}
+
+	spec, ok := strings.CutPrefix(pattern, "magic:")
+	if !ok {
+		return rule, errors.Errorf("invalid pattern %q, must be *.ext or magic:offset:hex", pattern)
+	}
+	offset, magic, ok := strings.Cut(spec, ":")
+	if !ok {
+		return rule, errors.Errorf("invalid magic pattern %q, must be magic:offset:hex", pattern)
+	}
+	var err error
+	rule.Offset, err = strconv.Atoi(offset)
+	if err != nil || rule.Offset < 0 {
+		return rule, errors.Errorf("invalid offset %q", offset)
+	}
+	rule.Magic, err = hex.DecodeString(magic)
+	if err != nil || len(rule.Magic) == 0 {
+		return rule, errors.Errorf("invalid magic bytes %q", magic)
+	}
+	if rule.Offset+len(rule.Magic) > classifyHeaderSize {
+		return rule, errors.Errorf("magic bytes must be within the first %d bytes", classifyHeaderSize)
+	}
+	return rule, nil
+}
+
+// Classifier assigns each file of a backup to a content class, first by its
+// extension and otherwise by the magic bytes at the start of its content,
+// and collects the number and size of the files per class.
+//
+// The methods are safe for concurrent use.
+type Classifier struct {
+	byExt map[string]string
+	magic []ClassRule
+
+	mu sync.Mutex
+	// byContent stores the class of files read during the backup until the
+	// file is completed.
+	byContent map[string]string
+	stats     map[string]restic.ContentClassStats
+}
+
+// NewClassifier returns a classifier using rules in addition to
+// DefaultClassRules.
+func NewClassifier(rules []ClassRule) *Classifier {
+	c := &Classifier{
+		byExt:     make(map[string]string),
+		byContent: make(map[string]string),
+		stats:     make(map[string]restic.ContentClassStats),
+	}
+	for _, r := range slices.Concat(rules, DefaultClassRules) {
+		if r.Ext == "" {
+			c.magic = append(c.magic, r)
+		} else if _, ok := c.byExt[r.Ext]; !ok {
+			c.byExt[r.Ext] = r.Class
+		}
+	}
+	return c
+}
+
+// classifyName returns the class for the extension of name.
+func (c *Classifier) classifyName(name string) (string, bool) {
+	class, ok := c.byExt[strings.ToLower(path.Ext(name))]
+	return class, ok
+}
+
+// classifyData returns the class for the start of the content of a file.
+func (c *Classifier) classifyData(data []byte) string {
+	for _, r := range c.magic {
+		if r.matches(data) {
+			return r.Class
+		}
+	}
+	return ClassOther
+}
+
+// needsData reports whether the file at snPath can only be classified by its
+// content.
+func (c *Classifier) needsData(snPath string) bool {
+	_, ok := c.classifyName(snPath)
+	return !ok
+}
+
+// observeData classifies the file at snPath by the start of its content.
+func (c *Classifier) observeData(snPath string, data []byte) {
+	if !c.needsData(snPath) {
+		return
+	}
+	class := c.classifyData(data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byContent[snPath] = class
+}
+
+// observeItem records a completed file.
+func (c *Classifier) observeItem(snPath string, current *restic.Node) {
+	if current == nil || current.Type != restic.NodeTypeFile {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	class, ok := c.classifyName(snPath)
+	if !ok {
+		class, ok = c.byContent[snPath]
+		delete(c.byContent, snPath)
+	}
+	if !ok {
+		class = ClassOther
+	}
+
+	s := c.stats[class]
+	s.Files++
+	s.Bytes += current.Size
+	c.stats[class] = s
+}
+
+// Stats returns the number and size of the files per class.
+func (c *Classifier) Stats() map[string]restic.ContentClassStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := make(map[string]restic.ContentClassStats, len(c.stats))
+	for class, s := range c.stats {
+		res[class] = s
+	}
+	return res
+}
+
+// DominantClass returns the class holding most of the data in stats, or an
+// empty string if stats is empty.
+func DominantClass(stats map[string]restic.ContentClassStats) string {
+	classes := make([]string, 0, len(stats))
+	for class := range stats {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	var best string
+	for _, class := range classes {
+		s, b := stats[class], stats[best]
+		if best == "" || s.Bytes > b.Bytes || (s.Bytes == b.Bytes && s.Files > b.Files) {
+			best = class
+		}
+	}
+	return best
+}
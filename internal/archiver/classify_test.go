@@ -0,0 +1,113 @@
+package archiver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseClassRules(t *testing.T) {
+	rules, err := ParseClassRules(strings.NewReader(`
+# custom rules
+cad        *.DWG
+databases  magic:4:cafe
+`))
+	rtest.OK(t, err)
+	rtest.Equals(t, []ClassRule{
+		{Class: "cad", Ext: ".dwg"},
+		{Class: ClassDatabases, Magic: []byte{0xca, 0xfe}, Offset: 4},
+	}, rules)
+
+	for _, line := range []string{
+		"cad",
+		"cad dwg",
+		"cad *.",
+		"cad magic:cafe",
+		"cad magic:-1:cafe",
+		"cad magic:0:xyz",
+		"cad magic:70000:cafe",
+	} {
+		_, err := ParseClassRules(strings.NewReader(line))
+		rtest.Assert(t, err != nil, "expected error for %q", line)
+	}
+}
+
+func TestClassifier(t *testing.T) {
+	c := NewClassifier([]ClassRule{
+		{Class: "cad", Ext: ".dwg"},
+		{Class: "custom", Magic: []byte("%PDF")},
+	})
+
+	for _, test := range []struct {
+		name  string
+		data  string
+		class string
+	}{
+		{"/report.PDF", "", ClassDocuments},
+		{"/drawing.dwg", "", "cad"},
+		{"/vm/disk", "KDMV\x01\x00\x00\x00", ClassVMImages},
+		{"/backup", strings.Repeat("\x00", 257) + "ustar\x00", ClassArchives},
+		{"/scan", "%PDF-1.7", "custom"},
+		{"/random", "abcdef", ClassOther},
+		{"/empty", "", ClassOther},
+	} {
+		if test.data != "" {
+			c.observeData(test.name, []byte(test.data))
+		}
+		c.observeItem(test.name, &restic.Node{Type: restic.NodeTypeFile, Size: uint64(len(test.name))})
+	}
+	c.observeItem("/dir/", &restic.Node{Type: restic.NodeTypeDir})
+
+	rtest.Equals(t, map[string]restic.ContentClassStats{
+		ClassDocuments: {Files: 1, Bytes: 11},
+		ClassVMImages:  {Files: 1, Bytes: 8},
+		ClassArchives:  {Files: 1, Bytes: 7},
+		ClassOther:     {Files: 2, Bytes: 13},
+		"cad":          {Files: 1, Bytes: 12},
+		"custom":       {Files: 1, Bytes: 5},
+	}, c.Stats())
+	rtest.Equals(t, ClassOther, DominantClass(c.Stats()))
+	rtest.Equals(t, "", DominantClass(nil))
+}
+
+func TestArchiverClassifier(t *testing.T) {
+	src := TestDir{
+		"doc.txt":  TestFile{Content: "some text"},
+		"image":    TestFile{Content: "\x89PNG\r\n\x1a\n" + strings.Repeat("x", 100)},
+		"disk.img": TestFile{Content: "conectix" + strings.Repeat("\x00", 200)},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	expected := map[string]restic.ContentClassStats{
+		ClassDocuments: {Files: 1, Bytes: 9},
+		ClassMedia:     {Files: 1, Bytes: 108},
+		ClassVMImages:  {Files: 1, Bytes: 208},
+	}
+
+	var parent *restic.Snapshot
+	// the second backup must classify the unchanged files the same way
+	for i := 0; i < 2; i++ {
+		arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+		arch.Classifier = NewClassifier(nil)
+		sn, _, summary, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: parent})
+		rtest.OK(t, err)
+		rtest.Equals(t, expected, summary.Classification)
+		rtest.Equals(t, expected, sn.Summary.Classification)
+		rtest.Assert(t, sn.HasTags([]string{ContentTagPrefix + ClassVMImages}), "snapshot is not tagged: %v", sn.Tags)
+		if i == 1 {
+			rtest.Equals(t, uint(3), summary.Files.Unchanged)
+		}
+		parent = sn
+	}
+}
@@ -0,0 +1,80 @@
+package archiver
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/events"
+	"github.com/restic/restic/internal/restic"
+)
+
+// SetEventSink reports the progress of the archiver to sink. It replaces the
+// Error, StartFile, CompleteItem and CompleteBlob callbacks, which can be
+// overwritten afterwards to wrap the calls to sink. Once a snapshot has been
+// saved, the summary is passed to sink.
+func (arch *Archiver) SetEventSink(sink events.Sink) {
+	arch.events = sink
+	arch.Error = sink.Error
+	arch.StartFile = sink.FileStarted
+	arch.CompleteBlob = sink.BlobUploaded
+	arch.CompleteItem = func(item string, previous, current *restic.Node, s ItemStats, d time.Duration) {
+		if current == nil {
+			// only reading the file has finished
+			return
+		}
+
+		var tpe events.ItemType
+		switch current.Type {
+		case restic.NodeTypeDir:
+			tpe = events.TypeDir
+		case restic.NodeTypeFile:
+			tpe = events.TypeFile
+		default:
+			tpe = events.TypeOther
+		}
+
+		action := events.ActionModified
+		switch {
+		case previous == nil:
+			action = events.ActionNew
+		case previous.Equals(*current):
+			action = events.ActionUnchanged
+		}
+
+		sink.FileFinished(events.Item{
+			Path:               item,
+			Type:               tpe,
+			Action:             action,
+			Duration:           d,
+			Size:               s.DataSize,
+			SizeInRepo:         s.DataSizeInRepo,
+			MetadataSize:       s.TreeSize,
+			MetadataSizeInRepo: s.TreeSizeInRepo,
+		})
+	}
+}
+
+// reportSummary passes the summary of the current backup to the event sink.
+// The id is null if no snapshot was created.
+func (arch *Archiver) reportSummary(id restic.ID) {
+	if arch.events == nil {
+		return
+	}
+
+	var snapshotID string
+	if !id.IsNull() {
+		snapshotID = id.String()
+	}
+	arch.events.Summary(events.Summary{
+		SnapshotID:     snapshotID,
+		FilesNew:       arch.summary.Files.New,
+		FilesModified:  arch.summary.Files.Changed,
+		FilesUnchanged: arch.summary.Files.Unchanged,
+		DirsNew:        arch.summary.Dirs.New,
+		DirsModified:   arch.summary.Dirs.Changed,
+		DirsUnchanged:  arch.summary.Dirs.Unchanged,
+		BytesProcessed: arch.summary.ProcessedBytes,
+		BytesAdded:     arch.summary.ItemStats.DataSize + arch.summary.ItemStats.TreeSize,
+		Start:          arch.summary.BackupStart,
+		End:            arch.summary.BackupEnd,
+	})
+}
@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/events"
+	"github.com/restic/restic/internal/fs"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type testSink struct {
+	events.NopSink
+
+	m       sync.Mutex
+	items   map[string]events.Item
+	blobs   uint64
+	summary *events.Summary
+}
+
+func (s *testSink) FileFinished(item events.Item) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.items[item.Path] = item
+}
+
+func (s *testSink) BlobUploaded(size uint64) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.blobs += size
+}
+
+func (s *testSink) Summary(summary events.Summary) {
+	s.summary = &summary
+}
+
+func TestArchiverEventSink(t *testing.T) {
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"dir": TestDir{
+			"file": TestFile{Content: "foobar"},
+		},
+	})
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	sink := &testSink{items: make(map[string]events.Item)}
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.SetEventSink(sink)
+
+	_, id, _, err := arch.Snapshot(context.TODO(), []string{"dir"}, SnapshotOptions{Time: time.Now()})
+	rtest.OK(t, err)
+
+	rtest.Equals(t, events.Item{
+		Path:   "/dir/",
+		Type:   events.TypeDir,
+		Action: events.ActionNew,
+	}, clearItemStats(sink.items["/dir/"]))
+	rtest.Equals(t, events.Item{
+		Path:   "/dir/file",
+		Type:   events.TypeFile,
+		Action: events.ActionNew,
+		Size:   6,
+	}, clearItemStats(sink.items["/dir/file"]))
+	rtest.Equals(t, uint64(6), sink.blobs)
+
+	rtest.Assert(t, sink.summary != nil, "summary was not reported")
+	rtest.Equals(t, id.String(), sink.summary.SnapshotID)
+	rtest.Equals(t, uint(1), sink.summary.FilesNew)
+	rtest.Equals(t, uint(1), sink.summary.DirsNew)
+	rtest.Equals(t, uint64(6), sink.summary.BytesProcessed)
+}
+
+// clearItemStats removes the fields of item which depend on timing or the
+// repository format.
+func clearItemStats(item events.Item) events.Item {
+	item.Duration = 0
+	item.SizeInRepo = 0
+	item.MetadataSize = 0
+	item.MetadataSizeInRepo = 0
+	return item
+}
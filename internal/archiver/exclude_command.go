@@ -0,0 +1,197 @@
+package archiver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// excludeCommandCacheSize is the number of directories for which the verdicts
+// of the exclude command are kept. The scanner and the archiver both ask for
+// the same items, usually only a few directories apart.
+const excludeCommandCacheSize = 1024
+
+// ExcludeCommandRequest is a batch of paths sent to the exclude command as a
+// single line of JSON.
+type ExcludeCommandRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// ExcludeCommandResponse is the answer of the exclude command to a request,
+// also a single line of JSON. Exclude must contain one entry for each path of
+// the request, in the same order.
+type ExcludeCommandResponse struct {
+	Exclude []bool `json:"exclude"`
+}
+
+// ExcludeCommand consults an external process whether items should be
+// excluded from the backup. The process is started once and then receives
+// batches of absolute paths on stdin, one ExcludeCommandRequest per line, and
+// must answer each of them with an ExcludeCommandResponse on stdout. When an
+// item is checked, all entries of its directory are sent in the same batch.
+//
+// If the command fails, all remaining items are rejected and OnError is
+// called once.
+type ExcludeCommand struct {
+	// OnError is called with the first error returned by the command.
+	OnError func(err error)
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+
+	m      sync.Mutex
+	cache  *simplelru.LRU[string, map[string]bool]
+	err    error
+	closed bool
+}
+
+// NewExcludeCommand starts the exclude command args. The output of the
+// command on stderr is written to stderr.
+func NewExcludeCommand(ctx context.Context, args []string, stderr io.Writer) (*ExcludeCommand, error) {
+	if len(args) == 0 {
+		return nil, errors.New("exclude command is empty")
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start exclude command: %w", err)
+	}
+
+	cache, err := simplelru.NewLRU[string, map[string]bool](excludeCommandCacheSize, nil)
+	if err != nil {
+		panic(err) // only happens for a size <= 0
+	}
+
+	return &ExcludeCommand{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		cache:  cache,
+	}, nil
+}
+
+// Reject is a RejectFunc which returns the verdict of the exclude command for
+// item.
+func (c *ExcludeCommand) Reject(item string, _ *fs.ExtendedFileInfo, filesys fs.FS) bool {
+	abs, err := filesys.Abs(item)
+	if err != nil {
+		abs = item
+	}
+	abs = filesys.Clean(abs)
+	dir := filesys.Dir(abs)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.err != nil || c.closed {
+		// if in doubt, reject
+		return true
+	}
+
+	verdicts, ok := c.cache.Get(dir)
+	if ok {
+		if reject, ok := verdicts[abs]; ok {
+			return reject
+		}
+	} else {
+		verdicts = make(map[string]bool)
+		c.cache.Add(dir, verdicts)
+	}
+
+	// ask for all entries of the directory at once, the siblings of item are
+	// usually checked next
+	paths := []string{abs}
+	if !ok && dir != abs {
+		names, err := fs.Readdirnames(filesys, dir, fs.O_NOFOLLOW)
+		if err != nil {
+			debug.Log("unable to list %v: %v", dir, err)
+		}
+		for _, name := range names {
+			if p := filesys.Join(dir, name); p != abs {
+				paths = append(paths, p)
+			}
+		}
+	}
+
+	excludes, err := c.query(paths)
+	if err != nil {
+		c.err = err
+		if c.OnError != nil {
+			c.OnError(err)
+		}
+		return true
+	}
+
+	for i, p := range paths {
+		verdicts[p] = excludes[i]
+	}
+	debug.Log("exclude command verdict for %v: %v", abs, excludes[0])
+	return excludes[0]
+}
+
+func (c *ExcludeCommand) query(paths []string) ([]bool, error) {
+	buf, err := json.Marshal(ExcludeCommandRequest{Paths: paths})
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, '\n')
+	if _, err := c.stdin.Write(buf); err != nil {
+		return nil, fmt.Errorf("exclude command: %w", err)
+	}
+
+	line, err := c.stdout.ReadBytes('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("unexpected end of output")
+		}
+		return nil, fmt.Errorf("exclude command: %w", err)
+	}
+
+	var resp ExcludeCommandResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("exclude command returned invalid response: %w", err)
+	}
+	if len(resp.Exclude) != len(paths) {
+		return nil, fmt.Errorf("exclude command returned %d verdicts for %d paths", len(resp.Exclude), len(paths))
+	}
+	return resp.Exclude, nil
+}
+
+// Close stops the exclude command and returns the first error, if any. Items
+// checked after Close are rejected. Calling Close again returns the same error.
+func (c *ExcludeCommand) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed {
+		return c.err
+	}
+	c.closed = true
+
+	_ = c.stdin.Close()
+	werr := c.cmd.Wait()
+	if c.err == nil && werr != nil {
+		c.err = fmt.Errorf("exclude command: %w", werr)
+	}
+	return c.err
+}
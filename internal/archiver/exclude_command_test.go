@@ -0,0 +1,108 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// TestExcludeCommandHelper is not a real test, it implements the exclude
+// command run by the other tests. It excludes all paths containing "secret"
+// and prints a line to stderr for each request.
+func TestExcludeCommandHelper(_ *testing.T) {
+	mode := os.Getenv("RESTIC_TEST_EXCLUDE_COMMAND")
+	if mode == "" {
+		return
+	}
+
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		if mode == "fail" {
+			os.Exit(1)
+		}
+
+		var req ExcludeCommandRequest
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			panic(err)
+		}
+		var resp ExcludeCommandResponse
+		for _, p := range req.Paths {
+			resp.Exclude = append(resp.Exclude, strings.Contains(filepath.Base(p), "secret"))
+		}
+		buf, err := json.Marshal(resp)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(buf))
+		fmt.Fprintln(os.Stderr, "request")
+	}
+	os.Exit(0)
+}
+
+func startExcludeCommand(t *testing.T, mode string) (*ExcludeCommand, *bytes.Buffer) {
+	t.Setenv("RESTIC_TEST_EXCLUDE_COMMAND", mode)
+	stderr := &bytes.Buffer{}
+	cmd, err := NewExcludeCommand(context.TODO(), []string{os.Args[0], "-test.run=^TestExcludeCommandHelper$"}, stderr)
+	rtest.OK(t, err)
+	return cmd, stderr
+}
+
+func TestExcludeCommand(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	TestCreateFiles(t, tempdir, TestDir{
+		"dir": TestDir{
+			"file":        TestFile{Content: "foo"},
+			"secret":      TestFile{Content: "bar"},
+			"other-file":  TestFile{Content: "baz"},
+			"secret-file": TestFile{Content: "qux"},
+		},
+	})
+
+	cmd, stderr := startExcludeCommand(t, "filter")
+	filesys := fs.Local{}
+	for _, test := range []struct {
+		name   string
+		reject bool
+	}{
+		{"dir", false},
+		{"dir/file", false},
+		{"dir/secret", true},
+		{"dir/other-file", false},
+		{"dir/secret-file", true},
+		// checked twice, as the scanner and the archiver do
+		{"dir/secret", true},
+	} {
+		item := filepath.Join(tempdir, test.name)
+		rtest.Equals(t, test.reject, cmd.Reject(item, nil, filesys), "wrong verdict for %v", test.name)
+	}
+	rtest.OK(t, cmd.Close())
+
+	// one request for the directory and one for its content
+	rtest.Equals(t, 2, strings.Count(stderr.String(), "request"))
+
+	// items are rejected once the command has stopped
+	rtest.Assert(t, cmd.Reject(filepath.Join(tempdir, "dir", "file"), nil, filesys), "item not rejected after close")
+}
+
+func TestExcludeCommandFail(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	cmd, _ := startExcludeCommand(t, "fail")
+
+	var reported error
+	cmd.OnError = func(err error) {
+		reported = err
+	}
+
+	rtest.Assert(t, cmd.Reject(filepath.Join(tempdir, "file"), nil, fs.Local{}), "item not rejected")
+	rtest.Assert(t, reported != nil, "error was not reported")
+	rtest.Equals(t, reported, cmd.Close())
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/debug"
@@ -28,7 +29,17 @@ type fileSaver struct {
 
 	CompleteBlob func(bytes uint64)
 
+	// ObserveData is called with the first chunk of each file.
+	ObserveData func(snPath string, data []byte)
+
+	// LimitRead, if set, wraps the reader for the content of each file.
+	LimitRead func(io.Reader) io.Reader
+
 	NodeFromFileInfo func(snPath, filename string, meta ToNoder, ignoreXattrListError bool) (*restic.Node, error)
+
+	// Timing, if set, is called with the timing of each file which was saved
+	// successfully.
+	Timing func(FileTiming)
 }
 
 // newFileSaver returns a new file saver. A worker pool with fileWorkers is
@@ -47,6 +58,7 @@ func newFileSaver(ctx context.Context, wg *errgroup.Group, save saveBlobFn, pol
 		ch:           ch,
 
 		CompleteBlob: func(uint64) {},
+		ObserveData:  func(string, []byte) {},
 	}
 
 	for i := uint(0); i < fileWorkers; i++ {
@@ -105,6 +117,19 @@ type saveFileJob struct {
 	complete        fileCompleteFunc
 }
 
+// timedReader records the time spent in Read.
+type timedReader struct {
+	rd       io.Reader
+	duration time.Duration
+}
+
+func (rd *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := rd.rd.Read(p)
+	rd.duration += time.Since(start)
+	return n, err
+}
+
 // saveFile stores the file f in the repo, then closes it.
 func (s *fileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPath string, target string, f fs.File, start func(), finishReading func(), finish func(res futureNodeResult)) {
 	start()
@@ -113,6 +138,9 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 		snPath: snPath,
 		target: target,
 	}
+	timing := FileTiming{Path: snPath}
+	startTime := time.Now()
+
 	var lock sync.Mutex
 	remaining := 0
 	isCompleted := false
@@ -126,12 +154,17 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 			if isCompleted {
 				panic("completed twice")
 			}
-			for _, id := range fnr.node.Content {
+			for _, id := range fnr.node.DataBlobs() {
 				if id.IsNull() {
 					panic("completed file with null ID")
 				}
 			}
 			isCompleted = true
+			if s.Timing != nil {
+				timing.Size = fnr.node.Size
+				timing.Duration = time.Since(startTime)
+				s.Timing(timing)
+			}
 			finish(fnr)
 		}
 	}
@@ -154,6 +187,7 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 	debug.Log("%v", snPath)
 
 	node, err := s.NodeFromFileInfo(snPath, target, f, false)
+	timing.Metadata = time.Since(startTime)
 	if err != nil {
 		_ = f.Close()
 		completeError(err)
@@ -166,65 +200,117 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 		return
 	}
 
-	// reuse the chunker
-	chnker.Reset(f, s.pol)
-
-	node.Content = []restic.ID{}
-	node.Size = 0
+	// the number of blobs of the file content and all streams
 	var idx int
-	for {
-		buf := s.saveFilePool.Get()
-		chunk, err := chnker.Next(buf.Data)
-		if err == io.EOF {
-			buf.Release()
-			break
-		}
 
-		buf.Data = chunk.Data
-		node.Size += uint64(chunk.Length)
-
-		if err != nil {
-			_ = f.Close()
-			completeError(err)
-			return
-		}
-		// test if the context has been cancelled, return the error
-		if ctx.Err() != nil {
-			_ = f.Close()
-			completeError(ctx.Err())
-			return
+	// read the content into the list of blobs at content, which must not be
+	// changed until the file is complete
+	readContent := func(rd io.Reader, content *restic.IDs, observe bool) (uint64, error) {
+		if s.LimitRead != nil {
+			rd = s.LimitRead(rd)
 		}
+		trd := &timedReader{rd: rd}
+		defer func() {
+			timing.Read += trd.duration
+		}()
+
+		// reuse the chunker
+		chnker.Reset(trd, s.pol)
+
+		var size uint64
+		for {
+			buf := s.saveFilePool.Get()
+			chunkStart := time.Now()
+			chunk, err := chnker.Next(buf.Data)
+			timing.Chunk += time.Since(chunkStart)
+			if err == io.EOF {
+				buf.Release()
+				return size, nil
+			}
 
-		// add a place to store the saveBlob result
-		pos := idx
+			buf.Data = chunk.Data
+			size += uint64(chunk.Length)
 
-		lock.Lock()
-		node.Content = append(node.Content, restic.ID{})
-		lock.Unlock()
+			if err != nil {
+				return size, err
+			}
+			// test if the context has been cancelled, return the error
+			if ctx.Err() != nil {
+				return size, ctx.Err()
+			}
 
-		s.saveBlob(ctx, restic.DataBlob, buf, target, func(sbr saveBlobResponse) {
-			lock.Lock()
-			if !sbr.known {
-				fnr.stats.DataBlobs++
-				fnr.stats.DataSize += uint64(sbr.length)
-				fnr.stats.DataSizeInRepo += uint64(sbr.sizeInRepo)
+			if observe && idx == 0 {
+				s.ObserveData(snPath, buf.Data)
 			}
 
-			node.Content[pos] = sbr.id
+			// add a place to store the saveBlob result
+			lock.Lock()
+			pos := len(*content)
+			*content = append(*content, restic.ID{})
 			lock.Unlock()
 
-			completeBlob()
-		})
-		idx++
+			s.saveBlob(ctx, restic.DataBlob, buf, target, func(sbr saveBlobResponse) {
+				lock.Lock()
+				if !sbr.known {
+					fnr.stats.DataBlobs++
+					fnr.stats.DataSize += uint64(sbr.length)
+					fnr.stats.DataSizeInRepo += uint64(sbr.sizeInRepo)
+				}
+
+				(*content)[pos] = sbr.id
+				timing.Hash += sbr.hashDuration
+				timing.Upload += sbr.saveDuration
+				lock.Unlock()
+
+				completeBlob()
+			})
+			idx++
+
+			// test if the context has been cancelled, return the error
+			if ctx.Err() != nil {
+				return size, ctx.Err()
+			}
+
+			s.CompleteBlob(uint64(len(chunk.Data)))
+		}
+	}
+
+	node.Content = []restic.ID{}
+	node.Size, err = readContent(f, &node.Content, true)
+	if err != nil {
+		_ = f.Close()
+		completeError(err)
+		return
+	}
 
-		// test if the context has been cancelled, return the error
-		if ctx.Err() != nil {
+	// the alternate data streams are saved together with the file, such
+	// that they are deduplicated like any other content
+	streams, err := fs.AlternateStreams(f)
+	if err != nil {
+		_ = f.Close()
+		completeError(err)
+		return
+	}
+	if len(streams) > 0 {
+		node.AlternateStreams = make([]restic.AlternateStream, len(streams))
+	}
+	for i, name := range streams {
+		stream := &node.AlternateStreams[i]
+		stream.Name = name
+		stream.Content = []restic.ID{}
+
+		rd, err := fs.OpenAlternateStream(f, name)
+		if err == nil {
+			stream.Size, err = readContent(rd, &stream.Content, false)
+			if closeErr := rd.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
 			_ = f.Close()
-			completeError(ctx.Err())
+			completeError(fmt.Errorf("stream %v: %w", name, err))
 			return
 		}
-
-		s.CompleteBlob(uint64(len(chunk.Data)))
 	}
 
 	err = f.Close()
@@ -235,6 +321,8 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 
 	fnr.node = node
 	lock.Lock()
+	// the time spent in the chunker includes reading the file
+	timing.Chunk -= timing.Read
 	// require one additional completeFuture() call to ensure that the future only completes
 	// after reaching the end of this method
 	remaining += idx + 1
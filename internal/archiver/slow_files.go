@@ -0,0 +1,94 @@
+package archiver
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileTiming records how long saving a file took and how the time was spent.
+// The phases of a file overlap, as the blobs of a file are hashed and
+// uploaded concurrently while the file is read. Hash and Upload are the sum
+// of the time spent for all blobs of the file.
+type FileTiming struct {
+	Path string
+	Size uint64
+
+	// Duration is the time from opening the file until all of its blobs
+	// were saved.
+	Duration time.Duration
+
+	// Metadata is the time spent reading the metadata of the file.
+	Metadata time.Duration
+	// Read is the time spent reading the content of the file.
+	Read time.Duration
+	// Chunk is the time spent splitting the content into blobs.
+	Chunk time.Duration
+	// Hash is the time spent calculating the IDs of the blobs.
+	Hash time.Duration
+	// Upload is the time spent compressing, encrypting and handing the blobs
+	// to the pack uploader, including waiting for slow uploads.
+	Upload time.Duration
+}
+
+func (t FileTiming) String() string {
+	return fmt.Sprintf("%v took %.3fs (metadata %.3fs, read %.3fs, chunk %.3fs, hash %.3fs, upload %.3fs)",
+		t.Path, t.Duration.Seconds(), t.Metadata.Seconds(), t.Read.Seconds(),
+		t.Chunk.Seconds(), t.Hash.Seconds(), t.Upload.Seconds())
+}
+
+// SlowFileTracker reports files which take longer than a threshold to save
+// and collects the slowest files of a backup.
+type SlowFileTracker struct {
+	threshold time.Duration
+	n         int
+	report    func(FileTiming)
+
+	mu      sync.Mutex
+	slowest []FileTiming
+}
+
+// NewSlowFileTracker returns a tracker which calls report for each file that
+// took at least threshold to save and keeps the n slowest files. A zero
+// threshold disables the reports. The function report may be called
+// concurrently.
+func NewSlowFileTracker(threshold time.Duration, n int, report func(FileTiming)) *SlowFileTracker {
+	return &SlowFileTracker{
+		threshold: threshold,
+		n:         n,
+		report:    report,
+	}
+}
+
+func (t *SlowFileTracker) observe(ft FileTiming) {
+	if t.threshold > 0 && ft.Duration >= t.threshold && t.report != nil {
+		t.report(ft)
+	}
+	if t.n <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.slowest) == t.n && ft.Duration <= t.slowest[len(t.slowest)-1].Duration {
+		return
+	}
+	i := sort.Search(len(t.slowest), func(i int) bool {
+		return t.slowest[i].Duration < ft.Duration
+	})
+	if len(t.slowest) < t.n {
+		t.slowest = append(t.slowest, FileTiming{})
+	}
+	copy(t.slowest[i+1:], t.slowest[i:])
+	t.slowest[i] = ft
+}
+
+// Slowest returns the slowest files ordered by decreasing duration.
+func (t *SlowFileTracker) Slowest() []FileTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]FileTiming(nil), t.slowest...)
+}
@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSlowFileTracker(t *testing.T) {
+	var reported []string
+	tracker := NewSlowFileTracker(5*time.Second, 3, func(ft FileTiming) {
+		reported = append(reported, ft.Path)
+	})
+
+	for _, ft := range []FileTiming{
+		{Path: "a", Duration: 1 * time.Second},
+		{Path: "b", Duration: 7 * time.Second},
+		{Path: "c", Duration: 3 * time.Second},
+		{Path: "d", Duration: 5 * time.Second},
+		{Path: "e", Duration: 2 * time.Second},
+		{Path: "f", Duration: 4 * time.Second},
+	} {
+		tracker.observe(ft)
+	}
+
+	rtest.Equals(t, []string{"b", "d"}, reported)
+
+	var slowest []string
+	for _, ft := range tracker.Slowest() {
+		slowest = append(slowest, ft.Path)
+	}
+	rtest.Equals(t, []string{"b", "d", "f"}, slowest)
+}
+
+func TestFileSaverTiming(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	files := createTestFiles(t, 5)
+
+	testFs := fs.Local{}
+	s, ctx, wg := startFileSaver(ctx, t, testFs)
+
+	var m sync.Mutex
+	timings := make(map[string]FileTiming)
+	s.Timing = func(ft FileTiming) {
+		m.Lock()
+		defer m.Unlock()
+		timings[ft.Path] = ft
+	}
+
+	var results []futureNode
+	for _, filename := range files {
+		f, err := testFs.OpenFile(filename, os.O_RDONLY, false)
+		rtest.OK(t, err)
+		results = append(results, s.Save(ctx, filename, filename, f, func() {}, func() {}, func(*restic.Node, ItemStats) {}))
+	}
+	for _, file := range results {
+		fnr := file.take(ctx)
+		rtest.OK(t, fnr.err)
+	}
+
+	s.TriggerShutdown()
+	rtest.OK(t, wg.Wait())
+
+	rtest.Equals(t, len(files), len(timings))
+	for _, filename := range files {
+		ft, ok := timings[filename]
+		rtest.Assert(t, ok, "no timing for %v", filename)
+		rtest.Equals(t, uint64(len("testfile-0")), ft.Size)
+		rtest.Assert(t, ft.Duration > 0, "duration of %v is zero", filename)
+	}
+}
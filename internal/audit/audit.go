@@ -0,0 +1,232 @@
+// Package audit records security-relevant operations, such as removing locks,
+// keys or snapshots, in the Common Event Format (CEF) or the Log Event
+// Extended Format (LEEF) understood by most SIEM systems.
+package audit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/logging"
+)
+
+// Outcomes of an event.
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// Event describes a single security-relevant operation.
+type Event struct {
+	// Type identifies the kind of event, e.g. "key-removed".
+	Type string
+	// Name is a human-readable description of the event type.
+	Name string
+	// Severity ranges from 0 (lowest) to 10 (highest).
+	Severity int
+	Outcome  string
+	Time     time.Time
+
+	// User and Host identify who performed the operation.
+	User string
+	Host string
+
+	// Repository is the location of the repository, without passwords.
+	Repository string
+	Snapshots  []string
+	KeyID      string
+	// Target is the path restored to.
+	Target string
+	// Count is the number of affected objects, it is omitted if zero.
+	Count   int
+	Message string
+}
+
+// Format is an output format for events.
+type Format string
+
+// Supported formats.
+const (
+	CEF  Format = "cef"
+	LEEF Format = "leef"
+)
+
+// ParseFormat returns the format for s.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case CEF, LEEF:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid audit format %q, must be cef or leef", s)
+}
+
+// Format returns ev as a single line in format f.
+func (f Format) Format(ev Event, version string) string {
+	if f == LEEF {
+		return FormatLEEF(ev, version)
+	}
+	return FormatCEF(ev, version)
+}
+
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+// FormatCEF returns ev in the Common Event Format.
+func FormatCEF(ev Event, version string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|restic|restic|%s|%s|%s|%d|",
+		cefHeaderEscaper.Replace(version), cefHeaderEscaper.Replace(ev.Type),
+		cefHeaderEscaper.Replace(ev.Name), min(max(ev.Severity, 0), 10))
+
+	var ext []string
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefValueEscaper.Replace(value))
+		}
+	}
+
+	if !ev.Time.IsZero() {
+		add("rt", strconv.FormatInt(ev.Time.UnixMilli(), 10))
+	}
+	add("suser", ev.User)
+	add("shost", ev.Host)
+	add("outcome", ev.Outcome)
+	if ev.Count > 0 {
+		add("cnt", strconv.Itoa(ev.Count))
+	}
+	add("filePath", ev.Target)
+	if ev.Repository != "" {
+		add("cs1Label", "repository")
+		add("cs1", ev.Repository)
+	}
+	if len(ev.Snapshots) > 0 {
+		add("cs2Label", "snapshots")
+		add("cs2", strings.Join(ev.Snapshots, ","))
+	}
+	if ev.KeyID != "" {
+		add("cs3Label", "keyId")
+		add("cs3", ev.KeyID)
+	}
+	add("msg", ev.Message)
+
+	b.WriteString(strings.Join(ext, " "))
+	return b.String()
+}
+
+var leefHeaderEscaper = strings.NewReplacer(`|`, `\|`, "\n", " ", "\r", " ", "\t", " ")
+var leefValueEscaper = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// leefTimeFormat is the time format used for devTime, described by
+// devTimeFormat in the event.
+const (
+	leefTimeFormat     = "Jan 02 2006 15:04:05.000 MST"
+	leefTimeFormatAttr = "MMM dd yyyy HH:mm:ss.SSS z"
+)
+
+// FormatLEEF returns ev in the Log Event Extended Format version 1.0.
+func FormatLEEF(ev Event, version string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:1.0|restic|restic|%s|%s|",
+		leefHeaderEscaper.Replace(version), leefHeaderEscaper.Replace(ev.Type))
+
+	var attrs []string
+	add := func(key, value string) {
+		if value != "" {
+			attrs = append(attrs, key+"="+leefValueEscaper.Replace(value))
+		}
+	}
+
+	add("cat", ev.Name)
+	add("sev", strconv.Itoa(min(max(ev.Severity, 0), 10)))
+	if !ev.Time.IsZero() {
+		add("devTime", ev.Time.UTC().Format(leefTimeFormat))
+		add("devTimeFormat", leefTimeFormatAttr)
+	}
+	add("usrName", ev.User)
+	add("identHostName", ev.Host)
+	add("outcome", ev.Outcome)
+	if ev.Count > 0 {
+		add("count", strconv.Itoa(ev.Count))
+	}
+	add("filePath", ev.Target)
+	add("repository", ev.Repository)
+	add("snapshots", strings.Join(ev.Snapshots, ","))
+	add("keyId", ev.KeyID)
+	add("msg", ev.Message)
+
+	b.WriteString(strings.Join(attrs, "\t"))
+	return b.String()
+}
+
+// Logger writes events to a file or sends them to syslog or the journal.
+type Logger struct {
+	format  Format
+	version string
+
+	m    sync.Mutex
+	file *os.File
+	sink logging.Sink
+}
+
+// Open returns a logger which writes events in format to target. The target
+// is either one of the targets supported by logging.Open or the path of a
+// file, to which the events are appended. The version is the restic version
+// reported in the events.
+func Open(target string, format Format, version, command string) (*Logger, error) {
+	l := &Logger{format: format, version: version}
+
+	if target == "journald" || target == "syslog" || strings.HasPrefix(target, "syslog+") {
+		sink, err := logging.Open(target, "restic", command)
+		if err != nil {
+			return nil, err
+		}
+		l.sink = sink
+		return l, nil
+	}
+
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit log: %w", err)
+	}
+	l.file = f
+	return l, nil
+}
+
+// severity maps the severity of an event to a syslog severity.
+func severity(ev Event) logging.Severity {
+	switch {
+	case ev.Outcome == Failure || ev.Severity >= 7:
+		return logging.Warning
+	default:
+		return logging.Notice
+	}
+}
+
+// Log records ev.
+func (l *Logger) Log(ev Event) error {
+	line := l.format.Format(ev, l.version)
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.sink != nil {
+		return l.sink.Log(severity(ev), line)
+	}
+	_, err := l.file.WriteString(line + "\n")
+	return err
+}
+
+// Close closes the file or the connection to the logging system.
+func (l *Logger) Close() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.sink != nil {
+		return l.sink.Close()
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testEvent = Event{
+	Type:       "snapshots-forgotten",
+	Name:       "Snapshots forgotten",
+	Severity:   6,
+	Outcome:    Success,
+	Time:       time.Date(2024, 3, 1, 2, 30, 0, 0, time.UTC),
+	User:       "alice",
+	Host:       "host",
+	Repository: "sftp:backup@host:/srv/repo",
+	Snapshots:  []string{"1a2b3c4d", "5e6f7a8b"},
+	Count:      2,
+}
+
+func TestFormatCEF(t *testing.T) {
+	rtest.Equals(t, "CEF:0|restic|restic|0.17.0|snapshots-forgotten|Snapshots forgotten|6|"+
+		"rt=1709260200000 suser=alice shost=host outcome=success cnt=2 "+
+		"cs1Label=repository cs1=sftp:backup@host:/srv/repo cs2Label=snapshots cs2=1a2b3c4d,5e6f7a8b",
+		FormatCEF(testEvent, "0.17.0"))
+}
+
+func TestFormatCEFEscape(t *testing.T) {
+	ev := Event{
+		Type:     "a|b",
+		Name:     `c\d`,
+		Severity: 42,
+		Target:   `C:\restore`,
+		Message:  "x=y\nz",
+	}
+	rtest.Equals(t, `CEF:0|restic|restic|1|a\|b|c\\d|10|filePath=C:\\restore msg=x\=y\nz`, FormatCEF(ev, "1"))
+}
+
+func TestFormatLEEF(t *testing.T) {
+	rtest.Equals(t, "LEEF:1.0|restic|restic|0.17.0|snapshots-forgotten|"+
+		"cat=Snapshots forgotten\tsev=6\tdevTime=Mar 01 2024 02:30:00.000 UTC\t"+
+		"devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z\tusrName=alice\tidentHostName=host\t"+
+		"outcome=success\tcount=2\trepository=sftp:backup@host:/srv/repo\tsnapshots=1a2b3c4d,5e6f7a8b",
+		FormatLEEF(testEvent, "0.17.0"))
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("LEEF")
+	rtest.OK(t, err)
+	rtest.Equals(t, LEEF, f)
+
+	_, err = ParseFormat("json")
+	rtest.Assert(t, err != nil, "expected error for invalid format")
+}
+
+func TestLoggerFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+
+	for i := 0; i < 2; i++ {
+		l, err := Open(filename, CEF, "1", "forget")
+		rtest.OK(t, err)
+		rtest.OK(t, l.Log(Event{Type: "key-added", Name: "Key added", Severity: 5}))
+		rtest.OK(t, l.Close())
+	}
+
+	data, err := os.ReadFile(filename)
+	rtest.OK(t, err)
+	line := "CEF:0|restic|restic|1|key-added|Key added|5|\n"
+	rtest.Equals(t, line+line, string(data))
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/layout"
@@ -39,6 +40,10 @@ type Backend struct {
 	layout.Layout
 
 	accessTier blob.AccessTier
+
+	immutability     map[backend.FileType]time.Duration
+	immutabilityMode blob.ImmutabilityPolicySetting
+	legalHold        map[backend.FileType]bool
 }
 
 const saveLargeSize = 256 * 1024 * 1024
@@ -142,13 +147,36 @@ func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 		}
 	}
 
+	immutability, err := parseImmutability(cfg.Immutability)
+	if err != nil {
+		return nil, errors.Fatalf("unable to open Azure backend: %v", err)
+	}
+
+	var immutabilityMode blob.ImmutabilityPolicySetting
+	switch strings.ToLower(cfg.ImmutabilityMode) {
+	case "", "unlocked":
+		immutabilityMode = blob.ImmutabilityPolicySettingUnlocked
+	case "locked":
+		immutabilityMode = blob.ImmutabilityPolicySettingLocked
+	default:
+		return nil, errors.Fatalf("unable to open Azure backend: invalid immutability mode %q", cfg.ImmutabilityMode)
+	}
+
+	legalHold, err := parseLegalHold(cfg.LegalHold)
+	if err != nil {
+		return nil, errors.Fatalf("unable to open Azure backend: %v", err)
+	}
+
 	be := &Backend{
-		container:    client,
-		cfg:          cfg,
-		connections:  cfg.Connections,
-		Layout:       layout.NewDefaultLayout(cfg.Prefix, path.Join),
-		listMaxItems: defaultListMaxItems,
-		accessTier:   accessTier,
+		container:        client,
+		cfg:              cfg,
+		connections:      cfg.Connections,
+		Layout:           layout.NewDefaultLayout(cfg.Prefix, path.Join),
+		listMaxItems:     defaultListMaxItems,
+		accessTier:       accessTier,
+		immutability:     immutability,
+		immutabilityMode: immutabilityMode,
+		legalHold:        legalHold,
 	}
 
 	return be, nil
@@ -204,7 +232,7 @@ func (be *Backend) IsNotExist(err error) bool {
 }
 
 func (be *Backend) IsPermanentError(err error) bool {
-	if be.IsNotExist(err) {
+	if be.IsNotExist(err) || errors.Is(err, backend.ErrImmutable) {
 		return true
 	}
 
@@ -245,30 +273,52 @@ func (be *Backend) useAccessTier(h backend.Handle) bool {
 	return isDataFile || notArchiveClass
 }
 
+// commitOptions returns the options for committing the blob for the given
+// file, including the immutability policy and legal hold configured for its type.
+func (be *Backend) commitOptions(h backend.Handle) *blockblob.CommitBlockListOptions {
+	var accessTier blob.AccessTier
+	if be.useAccessTier(h) {
+		accessTier = be.accessTier
+	}
+
+	opts := &blockblob.CommitBlockListOptions{
+		Tier: &accessTier,
+	}
+
+	if period, ok := be.immutability[h.Type]; ok {
+		expiry := time.Now().Add(period)
+		opts.ImmutabilityPolicyExpiryTime = &expiry
+		opts.ImmutabilityPolicyMode = &be.immutabilityMode
+	}
+
+	if be.legalHold[h.Type] {
+		legalHold := true
+		opts.LegalHold = &legalHold
+	}
+	return opts
+}
+
 // Save stores data in the backend at the handle.
 func (be *Backend) Save(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
 	objName := be.Filename(h)
 
 	debug.Log("InsertObject(%v, %v)", be.cfg.AccountName, objName)
 
-	var accessTier blob.AccessTier
-	if be.useAccessTier(h) {
-		accessTier = be.accessTier
-	}
+	opts := be.commitOptions(h)
 
 	var err error
 	if rd.Length() < saveLargeSize {
 		// if it's smaller than 256miB, then just create the file directly from the reader
-		err = be.saveSmall(ctx, objName, rd, accessTier)
+		err = be.saveSmall(ctx, objName, rd, opts)
 	} else {
 		// otherwise use the more complicated method
-		err = be.saveLarge(ctx, objName, rd, accessTier)
+		err = be.saveLarge(ctx, objName, rd, opts)
 	}
 
 	return err
 }
 
-func (be *Backend) saveSmall(ctx context.Context, objName string, rd backend.RewindReader, accessTier blob.AccessTier) error {
+func (be *Backend) saveSmall(ctx context.Context, objName string, rd backend.RewindReader, opts *blockblob.CommitBlockListOptions) error {
 	blockBlobClient := be.container.NewBlockBlobClient(objName)
 
 	// upload it as a new "block", use the base64 hash for the ID
@@ -289,13 +339,11 @@ func (be *Backend) saveSmall(ctx context.Context, objName string, rd backend.Rew
 	}
 
 	blocks := []string{id}
-	_, err = blockBlobClient.CommitBlockList(ctx, blocks, &blockblob.CommitBlockListOptions{
-		Tier: &accessTier,
-	})
+	_, err = blockBlobClient.CommitBlockList(ctx, blocks, opts)
 	return errors.Wrap(err, "CommitBlockList")
 }
 
-func (be *Backend) saveLarge(ctx context.Context, objName string, rd backend.RewindReader, accessTier blob.AccessTier) error {
+func (be *Backend) saveLarge(ctx context.Context, objName string, rd backend.RewindReader, opts *blockblob.CommitBlockListOptions) error {
 	blockBlobClient := be.container.NewBlockBlobClient(objName)
 
 	buf := make([]byte, 100*1024*1024)
@@ -342,9 +390,7 @@ func (be *Backend) saveLarge(ctx context.Context, objName string, rd backend.Rew
 		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", uploadedBytes, rd.Length())
 	}
 
-	_, err := blockBlobClient.CommitBlockList(ctx, blocks, &blockblob.CommitBlockListOptions{
-		Tier: &accessTier,
-	})
+	_, err := blockBlobClient.CommitBlockList(ctx, blocks, opts)
 
 	debug.Log("uploaded %d parts: %v", len(blocks), blocks)
 	return errors.Wrap(err, "CommitBlockList")
@@ -407,6 +453,10 @@ func (be *Backend) Remove(ctx context.Context, h backend.Handle) error {
 	if be.IsNotExist(err) {
 		return nil
 	}
+	if bloberror.HasCode(err, bloberror.BlobImmutableDueToPolicy) {
+		debug.Log("blob %v is immutable: %v", objName, err)
+		return fmt.Errorf("%v: %w", objName, backend.ErrImmutable)
+	}
 
 	return errors.Wrap(err, "client.RemoveObject")
 }
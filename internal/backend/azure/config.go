@@ -5,6 +5,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
@@ -24,6 +25,10 @@ type Config struct {
 
 	Connections uint   `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
 	AccessTier  string `option:"access-tier" help:"set the access tier for the blob storage (default: inferred from the storage account defaults)"`
+
+	Immutability     string `option:"immutability"      help:"set an immutability policy on uploaded files per file type, e.g. data=30d,snapshot=90d"`
+	ImmutabilityMode string `option:"immutability-mode" help:"mode of the immutability policy: unlocked or locked (default: unlocked)"`
+	LegalHold        string `option:"legal-hold"        help:"comma-separated list of file types to place a legal hold on, e.g. snapshot,index"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -85,3 +90,86 @@ func (cfg *Config) ApplyEnvironment(prefix string) {
 		cfg.EndpointSuffix = os.Getenv(prefix + "AZURE_ENDPOINT_SUFFIX")
 	}
 }
+
+// immutableFileTypes lists the file types which can be protected against
+// deletion. Lock files must always be removable.
+var immutableFileTypes = []backend.FileType{
+	backend.PackFile,
+	backend.KeyFile,
+	backend.SnapshotFile,
+	backend.IndexFile,
+	backend.ConfigFile,
+	backend.OpLogFile,
+	backend.ApprovalFile,
+}
+
+func parseFileType(s string) (backend.FileType, error) {
+	for _, t := range immutableFileTypes {
+		if s == t.String() {
+			return t, nil
+		}
+	}
+	return 0, errors.Errorf("invalid file type %q", s)
+}
+
+// parseRetention parses a retention period. In addition to the units
+// supported by time.ParseDuration, the unit "d" for days is accepted.
+func parseRetention(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.Errorf("invalid retention period %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("invalid retention period %q", s)
+	}
+	return d, nil
+}
+
+// parseImmutability parses the value of the immutability option, a
+// comma-separated list of type=period pairs.
+func parseImmutability(s string) (map[backend.FileType]time.Duration, error) {
+	periods := make(map[backend.FileType]time.Duration)
+	if s == "" {
+		return periods, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		name, period, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, errors.Errorf("invalid immutability policy %q, expected type=period", item)
+		}
+		t, err := parseFileType(name)
+		if err != nil {
+			return nil, err
+		}
+		d, err := parseRetention(period)
+		if err != nil {
+			return nil, err
+		}
+		periods[t] = d
+	}
+	return periods, nil
+}
+
+// parseLegalHold parses the value of the legal-hold option, a comma-separated
+// list of file types.
+func parseLegalHold(s string) (map[backend.FileType]bool, error) {
+	types := make(map[backend.FileType]bool)
+	if s == "" {
+		return types, nil
+	}
+
+	for _, name := range strings.Split(s, ",") {
+		t, err := parseFileType(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		types[t] = true
+	}
+	return types, nil
+}
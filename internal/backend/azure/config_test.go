@@ -2,8 +2,11 @@ package azure
 
 import (
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/test"
+	rtest "github.com/restic/restic/internal/test"
 )
 
 var configTests = []test.ConfigTestData[Config]{
@@ -27,3 +30,30 @@ var configTests = []test.ConfigTestData[Config]{
 func TestParseConfig(t *testing.T) {
 	test.ParseConfigTester(t, ParseConfig, configTests)
 }
+
+func TestParseImmutability(t *testing.T) {
+	periods, err := parseImmutability("data=30d, snapshot=12h,index=1d")
+	rtest.OK(t, err)
+	rtest.Equals(t, map[backend.FileType]time.Duration{
+		backend.PackFile:     30 * 24 * time.Hour,
+		backend.SnapshotFile: 12 * time.Hour,
+		backend.IndexFile:    24 * time.Hour,
+	}, periods)
+
+	for _, s := range []string{"data", "lock=30d", "data=", "data=-1d", "data=30x", "foo=1d"} {
+		_, err := parseImmutability(s)
+		rtest.Assert(t, err != nil, "expected error for %q", s)
+	}
+}
+
+func TestParseLegalHold(t *testing.T) {
+	types, err := parseLegalHold("snapshot, key")
+	rtest.OK(t, err)
+	rtest.Equals(t, map[backend.FileType]bool{
+		backend.SnapshotFile: true,
+		backend.KeyFile:      true,
+	}, types)
+
+	_, err = parseLegalHold("lock")
+	rtest.Assert(t, err != nil, "expected error for lock files")
+}
@@ -9,6 +9,10 @@ import (
 
 var ErrNoRepository = fmt.Errorf("repository does not exist")
 
+// ErrImmutable is returned by Remove if a file cannot be deleted because it is
+// protected by an immutability policy or a legal hold.
+var ErrImmutable = fmt.Errorf("file is protected against deletion")
+
 // Backend is used to store and access data.
 //
 // Backend operations that return an error will be retried when a Backend is
@@ -122,6 +126,23 @@ type FreezeBackend interface {
 	Unfreeze()
 }
 
+// Capacity is the storage space of a backend in bytes.
+type Capacity struct {
+	// Free is the space available for new files.
+	Free uint64
+	// Total is the size of the storage.
+	Total uint64
+}
+
+// CapacityBackend is implemented by backends which can determine how much
+// space is left on the underlying storage, for example the file system of a
+// mounted network share.
+type CapacityBackend interface {
+	Backend
+	// Capacity returns the free and total space of the storage.
+	Capacity(ctx context.Context) (Capacity, error)
+}
+
 // FileInfo is contains information about a file in the backend.
 type FileInfo struct {
 	Size int64
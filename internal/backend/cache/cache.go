@@ -245,3 +245,8 @@ func (c *Cache) Wrap(be backend.Backend) backend.Backend {
 func (c *Cache) BaseDir() string {
 	return c.Base
 }
+
+// Path returns the cache directory of the repository.
+func (c *Cache) Path() string {
+	return c.path
+}
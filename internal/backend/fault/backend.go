@@ -0,0 +1,251 @@
+// Package fault implements a backend wrapper which injects latency and errors
+// into the operations of another backend. The injected faults only depend on
+// the configured seed and the sequence of operations for each file, such that
+// a run can be reproduced deterministically.
+package fault
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// ErrDropped is returned for operations which fail with an injected dropped
+// connection.
+var ErrDropped = errors.New("connection dropped (injected fault)")
+
+// ErrThrottled is returned for operations which are rejected by an injected
+// throttling response.
+var ErrThrottled = errors.New("too many requests (injected fault)")
+
+type fault int
+
+const (
+	faultNone fault = iota
+	faultThrottle
+	faultDrop
+	faultPartial
+)
+
+// Backend injects faults into the operations of the wrapped backend.
+type Backend struct {
+	backend.Backend
+	cfg Config
+
+	m        sync.Mutex
+	attempts map[string]uint64
+}
+
+// statically ensure that Backend implements backend.Backend.
+var _ backend.Backend = &Backend{}
+
+// New returns a backend which injects the faults configured in cfg into the
+// operations of be.
+func New(be backend.Backend, cfg Config) *Backend {
+	return &Backend{
+		Backend:  be,
+		cfg:      cfg,
+		attempts: make(map[string]uint64),
+	}
+}
+
+// roll returns a pseudo-random value for the next attempt of the operation op
+// on the file name. The value only depends on the seed and on how often the
+// operation was called for the file before.
+func (be *Backend) roll(op, name string) uint64 {
+	key := op + " " + name
+	be.m.Lock()
+	attempt := be.attempts[key]
+	be.attempts[key]++
+	be.m.Unlock()
+
+	h := fnv.New64a()
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(be.cfg.Seed))
+	binary.LittleEndian.PutUint64(buf[8:], attempt)
+	_, _ = h.Write(buf[:])
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// inject delays the operation and selects the fault to inject. partial is the
+// percentage of operations which are aborted midway.
+func (be *Backend) inject(ctx context.Context, op, name string, partial uint) (fault, uint64, error) {
+	r := be.roll(op, name)
+
+	delay := be.cfg.Latency
+	if be.cfg.Jitter > 0 {
+		delay += time.Duration((r >> 8) % uint64(be.cfg.Jitter))
+	}
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return faultNone, r, ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	p := uint(r % 100)
+	var f fault
+	switch {
+	case p < be.cfg.Throttle:
+		f = faultThrottle
+	case p < be.cfg.Throttle+be.cfg.Drop:
+		f = faultDrop
+	case p < be.cfg.Throttle+be.cfg.Drop+partial:
+		f = faultPartial
+	}
+	if f != faultNone {
+		debug.Log("injecting fault %v into %v(%v)", f, op, name)
+	}
+
+	switch f {
+	case faultThrottle:
+		return f, r, ErrThrottled
+	case faultDrop:
+		return f, r, ErrDropped
+	}
+	return f, r, nil
+}
+
+// Save stores the data in the backend under the given handle.
+func (be *Backend) Save(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
+	f, _, err := be.inject(ctx, "Save", h.String(), be.cfg.PartialWrite)
+	if err != nil {
+		return err
+	}
+	if f == faultPartial {
+		rd = &partialRewindReader{RewindReader: rd, remaining: rd.Length() / 2}
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (be *Backend) Load(ctx context.Context, h backend.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	f, _, err := be.inject(ctx, "Load", h.String(), be.cfg.PartialRead)
+	if err != nil {
+		return err
+	}
+	if f != faultPartial {
+		return be.Backend.Load(ctx, h, length, offset, fn)
+	}
+
+	return be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		// the connection drops before the end of the data if the length is unknown
+		remaining := int64(-1)
+		if length > 0 {
+			remaining = int64(length / 2)
+		}
+		return fn(&partialReader{rd: rd, remaining: remaining})
+	})
+}
+
+// Stat returns information about the file identified by h.
+func (be *Backend) Stat(ctx context.Context, h backend.Handle) (backend.FileInfo, error) {
+	if _, _, err := be.inject(ctx, "Stat", h.String(), 0); err != nil {
+		return backend.FileInfo{}, err
+	}
+	return be.Backend.Stat(ctx, h)
+}
+
+// Remove removes the file identified by h.
+func (be *Backend) Remove(ctx context.Context, h backend.Handle) error {
+	if _, _, err := be.inject(ctx, "Remove", h.String(), 0); err != nil {
+		return err
+	}
+	return be.Backend.Remove(ctx, h)
+}
+
+// List runs fn for each file in the backend which has the type t.
+func (be *Backend) List(ctx context.Context, t backend.FileType, fn func(backend.FileInfo) error) error {
+	f, r, err := be.inject(ctx, "List", t.String(), be.cfg.PartialRead)
+	if err != nil {
+		return err
+	}
+	if f != faultPartial {
+		return be.Backend.List(ctx, t, fn)
+	}
+
+	// the connection drops after a few entries
+	remaining := (r >> 32) % 16
+	err = be.Backend.List(ctx, t, func(fi backend.FileInfo) error {
+		if remaining == 0 {
+			return ErrDropped
+		}
+		remaining--
+		return fn(fi)
+	})
+	if err == nil {
+		err = ErrDropped
+	}
+	return err
+}
+
+func (be *Backend) Unwrap() backend.Backend { return be.Backend }
+
+func (f fault) String() string {
+	switch f {
+	case faultThrottle:
+		return "throttle"
+	case faultDrop:
+		return "drop"
+	case faultPartial:
+		return "partial"
+	}
+	return "none"
+}
+
+// partialReader returns ErrDropped after remaining bytes were read. If
+// remaining is negative, the error replaces the end of the data.
+type partialReader struct {
+	rd        io.Reader
+	remaining int64
+}
+
+func (rd *partialReader) Read(p []byte) (int, error) {
+	if rd.remaining == 0 {
+		return 0, ErrDropped
+	}
+	if rd.remaining > 0 && int64(len(p)) > rd.remaining {
+		p = p[:rd.remaining]
+	}
+
+	n, err := rd.rd.Read(p)
+	if rd.remaining > 0 {
+		rd.remaining -= int64(n)
+	}
+	if err == io.EOF {
+		err = ErrDropped
+	}
+	return n, err
+}
+
+// partialRewindReader aborts an upload with ErrDropped after remaining bytes
+// were read.
+type partialRewindReader struct {
+	backend.RewindReader
+	remaining int64
+}
+
+func (rd *partialRewindReader) Read(p []byte) (int, error) {
+	if rd.remaining <= 0 {
+		return 0, ErrDropped
+	}
+	if int64(len(p)) > rd.remaining {
+		p = p[:rd.remaining]
+	}
+
+	n, err := rd.RewindReader.Read(p)
+	rd.remaining -= int64(n)
+	return n, err
+}
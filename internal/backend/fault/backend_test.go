@@ -0,0 +1,151 @@
+package fault_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/fault"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/retry"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := fault.ParseConfig(options.Options{
+		"fault.latency":       "10ms",
+		"fault.drop":          "5",
+		"fault.partial-write": "10",
+		"fault.throttle":      "20",
+		"fault.seed":          "42",
+		"s3.region":           "eu",
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, fault.Config{
+		Latency:      10 * time.Millisecond,
+		Drop:         5,
+		PartialWrite: 10,
+		Throttle:     20,
+		Seed:         42,
+	}, cfg)
+	rtest.Assert(t, cfg.Enabled(), "config should inject faults")
+
+	cfg, err = fault.ParseConfig(options.Options{"fault.seed": "42"})
+	rtest.OK(t, err)
+	rtest.Assert(t, !cfg.Enabled(), "config should not inject faults")
+
+	_, err = fault.ParseConfig(options.Options{"fault.drop": "60", "fault.throttle": "50"})
+	rtest.Assert(t, err != nil, "expected error for percentages exceeding 100")
+	_, err = fault.ParseConfig(options.Options{"fault.unknown": "1"})
+	rtest.Assert(t, err != nil, "expected error for unknown option")
+}
+
+// saveErrors saves a sequence of files and returns the errors returned by be.
+func saveErrors(t *testing.T, be backend.Backend) []error {
+	var errs []error
+	for i := 0; i < 50; i++ {
+		data := rtest.Random(i, 100)
+		h := backend.Handle{Type: backend.PackFile, Name: fmt.Sprintf("file%02d", i)}
+		errs = append(errs, be.Save(context.TODO(), h, backend.NewByteReader(data, be.Hasher())))
+	}
+	return errs
+}
+
+func TestFaultsDeterministic(t *testing.T) {
+	cfg := fault.Config{Drop: 20, PartialWrite: 20, Throttle: 20, Seed: 1}
+
+	errs := saveErrors(t, fault.New(mem.New(), cfg))
+	rtest.Equals(t, errs, saveErrors(t, fault.New(mem.New(), cfg)))
+
+	var dropped, throttled int
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, fault.ErrDropped):
+			dropped++
+		case errors.Is(err, fault.ErrThrottled):
+			throttled++
+		case err != nil:
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	rtest.Assert(t, dropped > 0 && throttled > 0 && dropped+throttled < len(errs),
+		"unexpected fault distribution, %v dropped, %v throttled", dropped, throttled)
+
+	cfg.Seed = 2
+	rtest.Assert(t, !reflect.DeepEqual(errs, saveErrors(t, fault.New(mem.New(), cfg))),
+		"different seeds should inject different faults")
+}
+
+func TestPartialRead(t *testing.T) {
+	be := mem.New()
+	data := rtest.Random(23, 1000)
+	h := backend.Handle{Type: backend.PackFile, Name: "partial"}
+	rtest.OK(t, be.Save(context.TODO(), h, backend.NewByteReader(data, be.Hasher())))
+
+	fbe := fault.New(be, fault.Config{PartialRead: 100})
+	var buf []byte
+	err := fbe.Load(context.TODO(), h, 0, 0, func(rd io.Reader) error {
+		var err error
+		buf, err = io.ReadAll(rd)
+		return err
+	})
+	rtest.Assert(t, errors.Is(err, fault.ErrDropped), "unexpected error %v", err)
+	rtest.Equals(t, data, buf)
+
+	err = fbe.Load(context.TODO(), h, 100, 10, func(rd io.Reader) error {
+		buf = make([]byte, 100)
+		_, err := io.ReadFull(rd, buf)
+		return err
+	})
+	rtest.Assert(t, errors.Is(err, fault.ErrDropped), "unexpected error %v", err)
+
+	err = fbe.List(context.TODO(), backend.PackFile, func(backend.FileInfo) error { return nil })
+	rtest.Assert(t, errors.Is(err, fault.ErrDropped), "unexpected error %v", err)
+}
+
+func TestLatency(t *testing.T) {
+	be := fault.New(mem.New(), fault.Config{Latency: time.Hour})
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := be.Stat(ctx, backend.Handle{Type: backend.ConfigFile})
+	rtest.Assert(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+}
+
+// TestRetryFaults checks that retrying failed operations hides the injected
+// faults.
+func TestRetryFaults(t *testing.T) {
+	retry.TestFastRetries(t)
+	cfg := fault.Config{Drop: 10, PartialWrite: 10, PartialRead: 10, Throttle: 10, Seed: 3}
+	be := retry.New(fault.New(mem.New(), cfg), time.Minute, nil, nil)
+
+	files := make(map[string][]byte)
+	for i := 0; i < 50; i++ {
+		data := rtest.Random(i, 1000+i)
+		h := backend.Handle{Type: backend.PackFile, Name: fmt.Sprintf("file%02d", i)}
+		rtest.OK(t, be.Save(context.TODO(), h, backend.NewByteReader(data, be.Hasher())))
+		files[h.Name] = data
+	}
+
+	listed := 0
+	rtest.OK(t, be.List(context.TODO(), backend.PackFile, func(fi backend.FileInfo) error {
+		listed++
+		rtest.Equals(t, int64(len(files[fi.Name])), fi.Size)
+		return nil
+	}))
+	rtest.Equals(t, len(files), listed)
+
+	for name, data := range files {
+		h := backend.Handle{Type: backend.PackFile, Name: name}
+		buf, err := test.LoadAll(context.TODO(), be, h)
+		rtest.OK(t, err)
+		rtest.Equals(t, data, buf)
+	}
+}
@@ -0,0 +1,48 @@
+package fault
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+)
+
+// Config holds the faults which are injected into backend operations. The
+// percentages select the share of operations which fail, each operation fails
+// with at most one fault.
+type Config struct {
+	Latency      time.Duration `option:"latency" help:"delay each backend operation by this duration"`
+	Jitter       time.Duration `option:"jitter" help:"delay each backend operation additionally by a random duration up to this value"`
+	Drop         uint          `option:"drop" help:"percentage of backend operations which fail with a dropped connection"`
+	PartialWrite uint          `option:"partial-write" help:"percentage of uploads which are aborted after half of the data"`
+	PartialRead  uint          `option:"partial-read" help:"percentage of downloads and listings which are aborted midway"`
+	Throttle     uint          `option:"throttle" help:"percentage of backend operations which are rejected as throttled"`
+	Seed         int           `option:"seed" help:"select the failing operations based on this value, the same seed injects the same faults"`
+}
+
+func init() {
+	options.Register("fault", Config{})
+}
+
+// ParseConfig parses the fault extended options to a Config struct.
+func ParseConfig(o options.Options) (Config, error) {
+	var cfg Config
+	o = o.Extract("fault")
+	if err := o.Apply("fault", &cfg); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Drop+cfg.Throttle+max(cfg.PartialRead, cfg.PartialWrite) > 100 {
+		return Config{}, errors.Fatal("fault: the percentages of failing operations must not exceed 100 in total")
+	}
+	if cfg.Latency < 0 || cfg.Jitter < 0 {
+		return Config{}, errors.Fatal("fault: latency and jitter must not be negative")
+	}
+	return cfg, nil
+}
+
+// Enabled returns true if the config injects any faults.
+func (cfg Config) Enabled() bool {
+	return cfg.Latency > 0 || cfg.Jitter > 0 || cfg.Drop > 0 || cfg.PartialWrite > 0 ||
+		cfg.PartialRead > 0 || cfg.Throttle > 0
+}
@@ -17,6 +17,8 @@ const (
 	SnapshotFile
 	IndexFile
 	ConfigFile
+	OpLogFile
+	ApprovalFile
 )
 
 func (t FileType) String() string {
@@ -35,6 +37,10 @@ func (t FileType) String() string {
 		s = "index"
 	case ConfigFile:
 		s = "config"
+	case OpLogFile:
+		s = "oplog"
+	case ApprovalFile:
+		s = "approvals"
 	}
 	return s
 }
@@ -63,6 +69,8 @@ func (h Handle) Valid() error {
 	case SnapshotFile:
 	case IndexFile:
 	case ConfigFile:
+	case OpLogFile:
+	case ApprovalFile:
 	default:
 		return errors.Errorf("invalid Type %d", h.Type)
 	}
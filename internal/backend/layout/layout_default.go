@@ -21,6 +21,8 @@ var defaultLayoutPaths = map[backend.FileType]string{
 	backend.IndexFile:    "index",
 	backend.LockFile:     "locks",
 	backend.KeyFile:      "keys",
+	backend.OpLogFile:    "oplog",
+	backend.ApprovalFile: "approvals",
 }
 
 func NewDefaultLayout(path string, join func(...string) string) *DefaultLayout {
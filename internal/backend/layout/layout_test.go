@@ -110,6 +110,8 @@ func TestDefaultLayout(t *testing.T) {
 			filepath.Join(tempdir, "index"),
 			filepath.Join(tempdir, "locks"),
 			filepath.Join(tempdir, "keys"),
+			filepath.Join(tempdir, "oplog"),
+			filepath.Join(tempdir, "approvals"),
 		}
 
 		for i := 0; i < 256; i++ {
@@ -185,6 +187,8 @@ func TestRESTLayout(t *testing.T) {
 			strings.Join([]string{url, "index"}, "/"),
 			strings.Join([]string{url, "locks"}, "/"),
 			strings.Join([]string{url, "keys"}, "/"),
+			strings.Join([]string{url, "oplog"}, "/"),
+			strings.Join([]string{url, "approvals"}, "/"),
 		}
 
 		sort.Strings(want)
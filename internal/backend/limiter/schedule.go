@@ -0,0 +1,497 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/time/rate"
+)
+
+// Schedule varies the limits depending on the time of day and the weekday.
+// For each limit, the first rule matching the current local time which sets
+// the limit applies.
+type Schedule []ScheduleRule
+
+// ScheduleRule sets limits during a daily time window.
+type ScheduleRule struct {
+	// Days contains the weekdays on which the time window starts, indexed
+	// by time.Weekday.
+	Days [7]bool
+	// Start and End of the time window as offset since midnight. If End is
+	// not after Start, the window ends on the following day.
+	Start, End time.Duration
+	// UploadKb, DownloadKb and ReadKb are the limits in KiB/s during the
+	// time window. Zero means unlimited, -1 keeps the default limit.
+	UploadKb, DownloadKb, ReadKb int
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseSchedule parses a schedule consisting of rules separated by ";". Each
+// rule has the form "[days] HH:MM-HH:MM key=value...", for example
+// "mon-fri 08:00-18:00 upload=10240". Days are given as a comma separated
+// list of weekdays or ranges like "mon-fri", the rule applies to all days if
+// they are omitted. The keys "upload", "download" and "read" set the limits
+// in KiB/s, zero means unlimited.
+func ParseSchedule(s string) (Schedule, error) {
+	var schedule Schedule
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		rule, err := parseScheduleRule(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule rule %q: %w", part, err)
+		}
+		schedule = append(schedule, rule)
+	}
+	return schedule, nil
+}
+
+func parseScheduleRule(s string) (ScheduleRule, error) {
+	rule := ScheduleRule{UploadKb: -1, DownloadKb: -1, ReadKb: -1}
+	fields := strings.Fields(s)
+
+	if len(fields) > 0 && !strings.Contains(fields[0], ":") {
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return ScheduleRule{}, err
+		}
+		rule.Days = days
+		fields = fields[1:]
+	} else {
+		for i := range rule.Days {
+			rule.Days[i] = true
+		}
+	}
+
+	if len(fields) == 0 {
+		return ScheduleRule{}, errors.New("time window missing")
+	}
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return ScheduleRule{}, errors.Errorf("invalid time window %q, expected HH:MM-HH:MM", fields[0])
+	}
+	var err error
+	rule.Start, err = parseClock(start, false)
+	if err != nil {
+		return ScheduleRule{}, err
+	}
+	rule.End, err = parseClock(end, true)
+	if err != nil {
+		return ScheduleRule{}, err
+	}
+	if rule.Start == rule.End {
+		return ScheduleRule{}, errors.Errorf("empty time window %q", fields[0])
+	}
+
+	if len(fields) == 1 {
+		return ScheduleRule{}, errors.New("no limits given")
+	}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return ScheduleRule{}, errors.Errorf("invalid limit %q, expected key=value", field)
+		}
+		kb, err := parseRate(value)
+		if err != nil {
+			return ScheduleRule{}, fmt.Errorf("%w for %v", err, key)
+		}
+		switch key {
+		case "upload":
+			rule.UploadKb = kb
+		case "download":
+			rule.DownloadKb = kb
+		case "read":
+			rule.ReadKb = kb
+		default:
+			return ScheduleRule{}, errors.Errorf("unknown limit %q, must be one of upload, download or read", key)
+		}
+	}
+	return rule, nil
+}
+
+// parseRate parses a rate in KiB/s.
+func parseRate(s string) (int, error) {
+	kb, err := strconv.Atoi(s)
+	if err != nil || kb < 0 {
+		return 0, errors.Errorf("invalid rate %q", s)
+	}
+	return kb, nil
+}
+
+func parseWeekday(s string) (int, error) {
+	for i, day := range weekdays {
+		if strings.EqualFold(s, day) {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("invalid weekday %q", s)
+}
+
+func parseDays(s string) (days [7]bool, err error) {
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := parseWeekday(first)
+		if err != nil {
+			return days, err
+		}
+		end := start
+		if isRange {
+			end, err = parseWeekday(last)
+			if err != nil {
+				return days, err
+			}
+		}
+		// ranges like "fri-mon" wrap around the end of the week
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses a time of day in the form HH:MM. The value 24:00 is only
+// accepted for the end of a time window.
+func parseClock(s string, isEnd bool) (time.Duration, error) {
+	if isEnd && s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// matches returns true if t is within the time window of the rule.
+func (r ScheduleRule) matches(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+	if r.Start < r.End {
+		return r.Days[day] && offset >= r.Start && offset < r.End
+	}
+	previous := (day + 6) % 7
+	return (r.Days[day] && offset >= r.Start) || (r.Days[previous] && offset < r.End)
+}
+
+// LimitsAt returns the upload and download limits and the read limit in KiB/s
+// at time t. Limits which are not set by any matching rule are taken from def
+// and defReadKb.
+func (s Schedule) LimitsAt(t time.Time, def Limits, defReadKb int) (Limits, int) {
+	t = t.Local()
+	uploadKb, downloadKb, readKb := -1, -1, -1
+	for _, rule := range s {
+		if !rule.matches(t) {
+			continue
+		}
+		if uploadKb < 0 {
+			uploadKb = rule.UploadKb
+		}
+		if downloadKb < 0 {
+			downloadKb = rule.DownloadKb
+		}
+		if readKb < 0 {
+			readKb = rule.ReadKb
+		}
+	}
+
+	if uploadKb >= 0 {
+		def.UploadKb = uploadKb
+	}
+	if downloadKb >= 0 {
+		def.DownloadKb = downloadKb
+	}
+	if readKb >= 0 {
+		defReadKb = readKb
+	}
+	return def, defReadKb
+}
+
+// ScheduledRate is the rate limit in KiB/s for either uploads or downloads,
+// which may vary depending on the time of day. It implements pflag.Value and
+// accepts either a single rate or rules separated by ";" in the form
+// "[days] HH:MM-HH:MM rate", for example "mon-fri 08:00-18:00 10240; 0". A
+// rate without time window applies outside of the time windows of the rules.
+type ScheduledRate struct {
+	// Kb is the rate outside of the time windows of the schedule.
+	Kb int
+	// Schedule contains the rules, which only set the limit for the
+	// direction of the rate.
+	Schedule Schedule
+
+	key string
+	s   string
+}
+
+// NewUploadRate returns an unlimited rate for uploads.
+func NewUploadRate() ScheduledRate {
+	return ScheduledRate{key: "upload"}
+}
+
+// NewDownloadRate returns an unlimited rate for downloads.
+func NewDownloadRate() ScheduledRate {
+	return ScheduledRate{key: "download"}
+}
+
+// Set parses s and updates r.
+func (r *ScheduledRate) Set(s string) error {
+	kb := 0
+	var schedule Schedule
+	hasDefault := false
+
+	for _, part := range strings.Split(s, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) == 1 {
+			if hasDefault {
+				return errors.Errorf("more than one rate without time window in %q", s)
+			}
+			var err error
+			kb, err = parseRate(fields[0])
+			if err != nil {
+				return err
+			}
+			hasDefault = true
+			continue
+		}
+
+		last := len(fields) - 1
+		fields[last] = r.key + "=" + fields[last]
+		rule, err := parseScheduleRule(strings.Join(fields, " "))
+		if err != nil {
+			return fmt.Errorf("invalid schedule rule %q: %w", strings.TrimSpace(part), err)
+		}
+		schedule = append(schedule, rule)
+	}
+
+	r.Kb, r.Schedule, r.s = kb, schedule, s
+	return nil
+}
+
+func (r *ScheduledRate) String() string {
+	return r.s
+}
+
+// Type returns the type of ScheduledRate, usable within
+// github.com/spf13/pflag and in help texts.
+func (r *ScheduledRate) Type() string {
+	return "rate"
+}
+
+// ScheduledLimiter is a Limiter whose limits follow a Schedule. The limits
+// are re-evaluated each minute while data is transferred, such that long
+// running operations pick up changes of the schedule.
+type ScheduledLimiter struct {
+	schedule  Schedule
+	defaults  Limits
+	defReadKb int
+	now       func() time.Time
+
+	share *Share
+
+	mu           sync.Mutex
+	nextCheck    time.Time
+	current      Limits
+	readKb       int
+	currentShare float64
+
+	upstream   *rate.Limiter
+	downstream *rate.Limiter
+	read       *rate.Limiter
+}
+
+// NewScheduledLimiter returns a limiter following the schedule. The limits
+// in def and defReadKb apply outside of the time windows of the schedule.
+func NewScheduledLimiter(schedule Schedule, def Limits, defReadKb int) *ScheduledLimiter {
+	return newScheduledLimiter(schedule, def, defReadKb, time.Now)
+}
+
+func newScheduledLimiter(schedule Schedule, def Limits, defReadKb int, now func() time.Time) *ScheduledLimiter {
+	l := &ScheduledLimiter{
+		schedule:     schedule,
+		defaults:     def,
+		defReadKb:    defReadKb,
+		now:          now,
+		readKb:       -1,
+		currentShare: 1,
+		upstream:     rate.NewLimiter(rate.Inf, 0),
+		downstream:   rate.NewLimiter(rate.Inf, 0),
+		read:         rate.NewLimiter(rate.Inf, 0),
+	}
+	l.update()
+	return l
+}
+
+// update applies the limits of the schedule for the current time.
+func (l *ScheduledLimiter) update() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	share := l.share.Get()
+	if now.Before(l.nextCheck) && share == l.currentShare {
+		return
+	}
+	l.nextCheck = now.Truncate(time.Minute).Add(time.Minute)
+
+	limits, readKb := l.schedule.LimitsAt(now, l.defaults, l.defReadKb)
+	if limits == l.current && readKb == l.readKb && share == l.currentShare {
+		return
+	}
+	debug.Log("limits changed to upload %d KiB/s, download %d KiB/s, read %d KiB/s, share %.2f", limits.UploadKb, limits.DownloadKb, readKb, share)
+	l.current, l.readKb, l.currentShare = limits, readKb, share
+	setRate(l.upstream, scaleRate(limits.UploadKb, share))
+	setRate(l.downstream, scaleRate(limits.DownloadKb, share))
+	setRate(l.read, scaleRate(readKb, share))
+}
+
+// SetShare makes the limiter only use the given share of its limits. Changes
+// of the share take effect immediately.
+func (l *ScheduledLimiter) SetShare(share *Share) {
+	l.mu.Lock()
+	l.share = share
+	l.mu.Unlock()
+	l.update()
+}
+
+// scaleRate returns the share of the rate kb, a rate of zero stays unlimited.
+func scaleRate(kb int, share float64) int {
+	if kb <= 0 {
+		return kb
+	}
+	return max(1, int(math.Round(float64(kb)*share)))
+}
+
+// Share is the fraction of the limits which a limiter may use, such that
+// several processes can divide the limits among them. It can be changed while
+// data is transferred.
+type Share struct {
+	bits atomic.Uint64
+}
+
+// NewShare returns a share of the full limits.
+func NewShare() *Share {
+	s := &Share{}
+	s.Set(1)
+	return s
+}
+
+// Set changes the share to f, which must be between zero and one.
+func (s *Share) Set(f float64) {
+	s.bits.Store(math.Float64bits(f))
+}
+
+// Get returns the share, a nil Share is the full share.
+func (s *Share) Get() float64 {
+	if s == nil {
+		return 1
+	}
+	return math.Float64frombits(s.bits.Load())
+}
+
+func setRate(bucket *rate.Limiter, kb int) {
+	if kb <= 0 {
+		bucket.SetLimit(rate.Inf)
+		return
+	}
+	r := toByteRate(kb)
+	bucket.SetBurst(int(r))
+	bucket.SetLimit(rate.Limit(r))
+}
+
+// wait blocks until the bucket allows to transfer n bytes.
+func (l *ScheduledLimiter) wait(bucket *rate.Limiter, n int) error {
+	for n > 0 {
+		l.update()
+		if bucket.Limit() == rate.Inf {
+			return nil
+		}
+
+		tokens := min(n, bucket.Burst())
+		if err := bucket.WaitN(context.Background(), tokens); err != nil {
+			if tokens > bucket.Burst() {
+				// the limit was lowered concurrently, try again
+				continue
+			}
+			return err
+		}
+		n -= tokens
+	}
+	return nil
+}
+
+type scheduledReader struct {
+	io.Reader
+	limiter *ScheduledLimiter
+	bucket  *rate.Limiter
+}
+
+func (r *scheduledReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if werr := r.limiter.wait(r.bucket, n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+type scheduledWriter struct {
+	io.Writer
+	limiter *ScheduledLimiter
+	bucket  *rate.Limiter
+}
+
+func (w *scheduledWriter) Write(buf []byte) (int, error) {
+	if err := w.limiter.wait(w.bucket, len(buf)); err != nil {
+		return 0, err
+	}
+	return w.Writer.Write(buf)
+}
+
+// Upstream returns a reader limited by the upload rate.
+func (l *ScheduledLimiter) Upstream(r io.Reader) io.Reader {
+	return &scheduledReader{r, l, l.upstream}
+}
+
+// UpstreamWriter returns a writer limited by the upload rate.
+func (l *ScheduledLimiter) UpstreamWriter(w io.Writer) io.Writer {
+	return &scheduledWriter{w, l, l.upstream}
+}
+
+// Downstream returns a reader limited by the download rate.
+func (l *ScheduledLimiter) Downstream(r io.Reader) io.Reader {
+	return &scheduledReader{r, l, l.downstream}
+}
+
+// DownstreamWriter returns a writer limited by the download rate.
+func (l *ScheduledLimiter) DownstreamWriter(w io.Writer) io.Writer {
+	return &scheduledWriter{w, l, l.downstream}
+}
+
+// Transport returns an HTTP transport limited with the limiter l.
+func (l *ScheduledLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
+	return limitTransport(l, rt)
+}
+
+// DiskReader returns a reader limited by the read rate, which is used for
+// reading files from the local disk.
+func (l *ScheduledLimiter) DiskReader(r io.Reader) io.Reader {
+	return &scheduledReader{r, l, l.read}
+}
@@ -0,0 +1,204 @@
+package limiter
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/test"
+	"golang.org/x/time/rate"
+)
+
+func TestParseSchedule(t *testing.T) {
+	weekdays := [7]bool{false, true, true, true, true, true, false}
+	all := [7]bool{true, true, true, true, true, true, true}
+
+	for _, test := range []struct {
+		input string
+		want  Schedule
+	}{
+		{"", nil},
+		{
+			"mon-fri 08:00-18:00 upload=10240",
+			Schedule{{Days: weekdays, Start: 8 * time.Hour, End: 18 * time.Hour, UploadKb: 10240, DownloadKb: -1, ReadKb: -1}},
+		},
+		{
+			"22:30-06:00 upload=0 download=0; sat,sun 00:00-24:00 read=100",
+			Schedule{
+				{Days: all, Start: 22*time.Hour + 30*time.Minute, End: 6 * time.Hour, UploadKb: 0, DownloadKb: 0, ReadKb: -1},
+				{Days: [7]bool{true, false, false, false, false, false, true}, Start: 0, End: 24 * time.Hour, UploadKb: -1, DownloadKb: -1, ReadKb: 100},
+			},
+		},
+		{
+			"Fri-Mon 00:00-12:00 read=5",
+			Schedule{{Days: [7]bool{true, true, false, false, false, true, true}, Start: 0, End: 12 * time.Hour, UploadKb: -1, DownloadKb: -1, ReadKb: 5}},
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			schedule, err := ParseSchedule(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(schedule) != len(test.want) {
+				t.Fatalf("wrong number of rules, want %d, got %d", len(test.want), len(schedule))
+			}
+			for i := range schedule {
+				if schedule[i] != test.want[i] {
+					t.Errorf("rule %d: want %+v, got %+v", i, test.want[i], schedule[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, input := range []string{
+		"mon-fri",
+		"08:00-18:00",
+		"mon-fry 08:00-18:00 upload=10",
+		"08:00 upload=10",
+		"08:00-25:00 upload=10",
+		"24:00-08:00 upload=10",
+		"08:00-08:00 upload=10",
+		"08:00-18:00 upload",
+		"08:00-18:00 upload=-1",
+		"08:00-18:00 write=10",
+	} {
+		_, err := ParseSchedule(input)
+		if err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestScheduleLimitsAt(t *testing.T) {
+	schedule, err := ParseSchedule("mon-fri 08:00-18:00 upload=100 read=50; fri 22:00-06:00 download=0")
+	test.OK(t, err)
+
+	def := Limits{UploadKb: 1000, DownloadKb: 2000}
+	for _, tc := range []struct {
+		time   time.Time
+		limits Limits
+		readKb int
+	}{
+		// Monday
+		{time.Date(2024, 6, 3, 7, 59, 59, 0, time.Local), def, 300},
+		{time.Date(2024, 6, 3, 8, 0, 0, 0, time.Local), Limits{UploadKb: 100, DownloadKb: 2000}, 50},
+		{time.Date(2024, 6, 3, 18, 0, 0, 0, time.Local), def, 300},
+		// Friday evening until Saturday morning
+		{time.Date(2024, 6, 7, 23, 0, 0, 0, time.Local), Limits{UploadKb: 1000, DownloadKb: 0}, 300},
+		{time.Date(2024, 6, 8, 5, 59, 0, 0, time.Local), Limits{UploadKb: 1000, DownloadKb: 0}, 300},
+		{time.Date(2024, 6, 8, 6, 0, 0, 0, time.Local), def, 300},
+		// Friday morning does not belong to the window starting on Thursday
+		{time.Date(2024, 6, 7, 5, 0, 0, 0, time.Local), def, 300},
+	} {
+		limits, readKb := schedule.LimitsAt(tc.time, def, 300)
+		test.Equals(t, tc.limits, limits, tc.time.String())
+		test.Equals(t, tc.readKb, readKb, tc.time.String())
+	}
+}
+
+func TestScheduledLimiterUpdate(t *testing.T) {
+	schedule, err := ParseSchedule("08:00-18:00 upload=100")
+	test.OK(t, err)
+
+	now := time.Date(2024, 6, 3, 7, 59, 0, 0, time.Local)
+	l := newScheduledLimiter(schedule, Limits{}, 0, func() time.Time { return now })
+	test.Equals(t, rate.Inf, l.upstream.Limit())
+
+	// the limits are only re-evaluated once per minute
+	now = now.Add(30 * time.Second)
+	l.update()
+	test.Equals(t, rate.Inf, l.upstream.Limit())
+
+	now = now.Add(30 * time.Second)
+	l.update()
+	test.Equals(t, rate.Limit(100*1024), l.upstream.Limit())
+	test.Equals(t, 100*1024, l.upstream.Burst())
+	test.Equals(t, rate.Inf, l.downstream.Limit())
+
+	now = time.Date(2024, 6, 3, 18, 0, 0, 0, time.Local)
+	l.update()
+	test.Equals(t, rate.Inf, l.upstream.Limit())
+}
+
+func TestScheduledLimiterShare(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.Local)
+	l := newScheduledLimiter(nil, Limits{UploadKb: 100}, 0, func() time.Time { return now })
+	test.Equals(t, rate.Limit(100*1024), l.upstream.Limit())
+
+	share := NewShare()
+	share.Set(0.25)
+	l.SetShare(share)
+	test.Equals(t, rate.Limit(25*1024), l.upstream.Limit())
+	test.Equals(t, rate.Inf, l.downstream.Limit())
+
+	// changes of the share apply without waiting for the next minute
+	share.Set(0.5)
+	l.update()
+	test.Equals(t, rate.Limit(50*1024), l.upstream.Limit())
+}
+
+func TestScheduledLimiterReadWrite(t *testing.T) {
+	schedule, err := ParseSchedule("00:00-24:00 upload=64")
+	test.OK(t, err)
+	l := NewScheduledLimiter(schedule, Limits{}, 0)
+
+	data := make([]byte, 3000)
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, l.Upstream(bytes.NewReader(data)))
+	test.OK(t, err)
+	test.Equals(t, int64(len(data)), n)
+
+	n, err = io.Copy(l.DownstreamWriter(&buf), bytes.NewReader(data))
+	test.OK(t, err)
+	test.Equals(t, int64(len(data)), n)
+	test.Equals(t, 2*len(data), buf.Len())
+}
+
+func TestScheduleLimitsAtOverlapping(t *testing.T) {
+	// the second rule sets the download limit, which the first one leaves unset
+	schedule, err := ParseSchedule("08:00-18:00 upload=100; 00:00-24:00 upload=200 download=300")
+	test.OK(t, err)
+
+	limits, _ := schedule.LimitsAt(time.Date(2024, 6, 3, 12, 0, 0, 0, time.Local), Limits{}, 0)
+	test.Equals(t, Limits{UploadKb: 100, DownloadKb: 300}, limits)
+	limits, _ = schedule.LimitsAt(time.Date(2024, 6, 3, 20, 0, 0, 0, time.Local), Limits{}, 0)
+	test.Equals(t, Limits{UploadKb: 200, DownloadKb: 300}, limits)
+}
+
+func TestScheduledRate(t *testing.T) {
+	r := NewUploadRate()
+	test.OK(t, r.Set("1024"))
+	test.Equals(t, 1024, r.Kb)
+	test.Equals(t, 0, len(r.Schedule))
+
+	d := NewDownloadRate()
+	test.OK(t, d.Set("mon-fri 08:00-18:00 10240; 22:00-06:00 0; 500"))
+	test.Equals(t, 500, d.Kb)
+	test.Equals(t, 2, len(d.Schedule))
+	test.Equals(t, [7]bool{false, true, true, true, true, true, false}, d.Schedule[0].Days)
+	test.Equals(t, 10240, d.Schedule[0].DownloadKb)
+	test.Equals(t, -1, d.Schedule[0].UploadKb)
+	test.Equals(t, 0, d.Schedule[1].DownloadKb)
+
+	// the schedules for both directions can be combined
+	schedule := append(append(Schedule{}, r.Schedule...), d.Schedule...)
+	limits, _ := schedule.LimitsAt(time.Date(2024, 6, 3, 12, 0, 0, 0, time.Local), Limits{UploadKb: r.Kb, DownloadKb: d.Kb}, 0)
+	test.Equals(t, Limits{UploadKb: 1024, DownloadKb: 10240}, limits)
+
+	for _, input := range []string{
+		"-1",
+		"fast",
+		"1; 2",
+		"08:00-18:00",
+		"08:00-18:00 upload=10",
+		"mon-fry 08:00-18:00 10",
+	} {
+		r := NewUploadRate()
+		if err := r.Set(input); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
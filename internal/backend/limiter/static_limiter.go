@@ -64,7 +64,7 @@ func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return rt(req)
 }
 
-func (l staticLimiter) roundTripper(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+func limitRoundTrip(l Limiter, rt http.RoundTripper, req *http.Request) (*http.Response, error) {
 	type readCloser struct {
 		io.Reader
 		io.Closer
@@ -89,13 +89,18 @@ func (l staticLimiter) roundTripper(rt http.RoundTripper, req *http.Request) (*h
 	return res, err
 }
 
-// Transport returns an HTTP transport limited with the limiter l.
-func (l staticLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
+// limitTransport returns an HTTP transport limited with the limiter l.
+func limitTransport(l Limiter, rt http.RoundTripper) http.RoundTripper {
 	return roundTripper(func(req *http.Request) (*http.Response, error) {
-		return l.roundTripper(rt, req)
+		return limitRoundTrip(l, rt, req)
 	})
 }
 
+// Transport returns an HTTP transport limited with the limiter l.
+func (l staticLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
+	return limitTransport(l, rt)
+}
+
 func (l staticLimiter) limitReader(r io.Reader, b *rate.Limiter) io.Reader {
 	if b == nil {
 		return r
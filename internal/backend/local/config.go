@@ -12,6 +12,7 @@ type Config struct {
 	Path string
 
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent operations (default: 2)"`
+	Mmap        bool `option:"mmap" help:"read files via memory mapping instead of buffered reads (default: false)"`
 }
 
 // NewConfig returns a new config with default options applied.
@@ -28,8 +28,8 @@ type Local struct {
 	util.Modes
 }
 
-// ensure statically that *Local implements backend.Backend.
-var _ backend.Backend = &Local{}
+// ensure statically that *Local implements backend.CapacityBackend.
+var _ backend.CapacityBackend = &Local{}
 
 var errTooShort = fmt.Errorf("file is too short")
 
@@ -228,6 +228,22 @@ func (b *Local) openReader(_ context.Context, h backend.Handle, length int, offs
 		return nil, errTooShort
 	}
 
+	if b.Config.Mmap && mmapSupported {
+		n := int64(length)
+		if n == 0 {
+			n = size - offset
+		}
+		if n >= 0 {
+			rd, err := mmapFile(f, offset, int(n))
+			if err == nil {
+				// the mapping remains valid after the file is closed
+				_ = f.Close()
+				return rd, nil
+			}
+			debug.Log("mmap of %v failed, falling back to regular reads: %v", h, err)
+		}
+	}
+
 	if offset > 0 {
 		_, err = f.Seek(offset, 0)
 		if err != nil {
@@ -253,6 +269,16 @@ func (b *Local) Stat(_ context.Context, h backend.Handle) (backend.FileInfo, err
 	return backend.FileInfo{Size: fi.Size(), Name: h.Name}, nil
 }
 
+// Capacity returns the free and total space of the file system containing the
+// repository.
+func (b *Local) Capacity(_ context.Context) (backend.Capacity, error) {
+	capacity, err := diskCapacity(b.Path)
+	if err != nil {
+		return backend.Capacity{}, errors.WithStack(err)
+	}
+	return capacity, nil
+}
+
 // Remove removes the blob with the given name and type.
 func (b *Local) Remove(_ context.Context, h backend.Handle) error {
 	fn := b.Filename(h)
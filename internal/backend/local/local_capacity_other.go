@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || windows)
+// +build !darwin,!dragonfly,!freebsd,!linux,!windows
+
+package local
+
+import (
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+)
+
+// diskCapacity is not supported on this platform.
+func diskCapacity(_ string) (backend.Capacity, error) {
+	return backend.Capacity{}, errors.New("determining the free space is not supported on this platform")
+}
@@ -0,0 +1,19 @@
+//go:build darwin || dragonfly || freebsd || linux
+// +build darwin dragonfly freebsd linux
+
+package local
+
+import (
+	"github.com/restic/restic/internal/backend"
+	"golang.org/x/sys/unix"
+)
+
+// diskCapacity returns the space of the file system containing path.
+func diskCapacity(path string) (backend.Capacity, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return backend.Capacity{}, err
+	}
+	bsize := uint64(st.Bsize)
+	return backend.Capacity{Free: uint64(st.Bavail) * bsize, Total: uint64(st.Blocks) * bsize}, nil
+}
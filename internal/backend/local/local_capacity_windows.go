@@ -0,0 +1,20 @@
+package local
+
+import (
+	"github.com/restic/restic/internal/backend"
+	"golang.org/x/sys/windows"
+)
+
+// diskCapacity returns the space of the volume containing path, which may be
+// a UNC path of an SMB share.
+func diskCapacity(path string) (backend.Capacity, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return backend.Capacity{}, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return backend.Capacity{}, err
+	}
+	return backend.Capacity{Free: free, Total: total}, nil
+}
@@ -40,3 +40,20 @@ func TestNoSpacePermanent(t *testing.T) {
 	rtest.Assert(t, errors.Is(err, syscall.ENOSPC),
 		"could not recover original ENOSPC error")
 }
+
+func TestCapacity(t *testing.T) {
+	dir := rtest.TempDir(t)
+
+	be, err := Open(context.Background(), Config{Path: dir, Connections: 2})
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be.Close())
+	}()
+
+	capacity, err := be.Capacity(context.Background())
+	if err != nil {
+		t.Skipf("capacity not supported: %v", err)
+	}
+	rtest.Assert(t, capacity.Total > 0, "total space is zero")
+	rtest.Assert(t, capacity.Free <= capacity.Total, "free space %d exceeds total space %d", capacity.Free, capacity.Total)
+}
@@ -0,0 +1,17 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package local
+
+import (
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+const mmapSupported = false
+
+func mmapFile(_ *os.File, _ int64, _ int) (io.ReadCloser, error) {
+	return nil, errors.New("mmap is not supported on this platform")
+}
@@ -0,0 +1,62 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package local
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/debug"
+	"golang.org/x/sys/unix"
+)
+
+const mmapSupported = true
+
+// mmapReader reads from a memory-mapped region of a file.
+type mmapReader struct {
+	*bytes.Reader
+	data []byte
+}
+
+func (r *mmapReader) Close() error {
+	if r.data == nil {
+		return nil
+	}
+	err := unix.Munmap(r.data)
+	r.data = nil
+	r.Reader = bytes.NewReader(nil)
+	return err
+}
+
+// mmapFile maps length bytes starting at offset of the file f into memory.
+// The file can be closed afterwards, the mapping stays valid until the reader
+// is closed.
+func mmapFile(f *os.File, offset int64, length int) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	// the offset of a mapping must be a multiple of the page size
+	pageOffset := int(offset % int64(os.Getpagesize()))
+	data, err := unix.Mmap(int(f.Fd()), offset-int64(pageOffset), length+pageOffset, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	// the data is usually read once from start to end
+	advice := unix.MADV_SEQUENTIAL
+	if offset > 0 || length < 4*os.Getpagesize() {
+		// partial reads of pack files are used to load single blobs
+		advice = unix.MADV_WILLNEED
+	}
+	if err := unix.Madvise(data, advice); err != nil {
+		debug.Log("madvise failed: %v", err)
+	}
+
+	return &mmapReader{
+		Reader: bytes.NewReader(data[pageOffset:]),
+		data:   data,
+	}, nil
+}
@@ -11,7 +11,7 @@ import (
 	rtest "github.com/restic/restic/internal/test"
 )
 
-func newTestSuite(t testing.TB) *test.Suite[local.Config] {
+func newTestSuite(t testing.TB, mmap bool) *test.Suite[local.Config] {
 	return &test.Suite[local.Config]{
 		// NewConfig returns a config for a new temporary backend that will be used in tests.
 		NewConfig: func() (*local.Config, error) {
@@ -21,6 +21,7 @@ func newTestSuite(t testing.TB) *test.Suite[local.Config] {
 			cfg := &local.Config{
 				Path:        dir,
 				Connections: 2,
+				Mmap:        mmap,
 			}
 			return cfg, nil
 		},
@@ -30,11 +31,19 @@ func newTestSuite(t testing.TB) *test.Suite[local.Config] {
 }
 
 func TestBackend(t *testing.T) {
-	newTestSuite(t).RunTests(t)
+	newTestSuite(t, false).RunTests(t)
+}
+
+func TestBackendMmap(t *testing.T) {
+	newTestSuite(t, true).RunTests(t)
 }
 
 func BenchmarkBackend(t *testing.B) {
-	newTestSuite(t).RunBenchmarks(t)
+	newTestSuite(t, false).RunBenchmarks(t)
+}
+
+func BenchmarkBackendMmap(t *testing.B) {
+	newTestSuite(t, true).RunBenchmarks(t)
 }
 
 func readdirnames(t testing.TB, dir string) []string {
@@ -0,0 +1,240 @@
+package sema
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+const (
+	// adaptiveWindow is the minimal duration of a measurement window.
+	adaptiveWindow = 2 * time.Second
+	// adaptiveGain is the minimal relative throughput improvement which is
+	// required to keep an additional connection.
+	adaptiveGain = 0.05
+	// adaptiveLatency is the factor by which the average latency may grow
+	// compared to the window after the last change of the limit before a
+	// connection is removed.
+	adaptiveLatency = 2.0
+	// adaptiveHold is the number of windows to wait before adding connections
+	// again after the limit was reduced.
+	adaptiveHold = 15
+)
+
+// AdaptiveLimiter dynamically adjusts the number of concurrent backend
+// operations. It adds connections as long as the throughput increases and
+// removes them again if the throughput stagnates, the latency increases or
+// the backend responds with throttling errors.
+type AdaptiveLimiter struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	now  func() time.Time
+
+	limit int
+	max   int
+	inUse int
+
+	window        adaptiveWindowStats
+	prevScore     float64
+	prevBytes     bool
+	steadyLatency time.Duration
+	probing       bool
+	hold          int
+	lastThrottle  time.Time
+}
+
+type adaptiveWindowStats struct {
+	start     time.Time
+	requests  int
+	bytes     int64
+	latency   time.Duration
+	saturated bool
+}
+
+// NewAdaptiveLimiter returns a limiter which uses at most max concurrent
+// operations. The initial limit is set by NewAdaptiveBackend.
+func NewAdaptiveLimiter(max uint) *AdaptiveLimiter {
+	l := &AdaptiveLimiter{
+		now:   time.Now,
+		limit: 1,
+		max:   int(max),
+	}
+	if l.max < 1 {
+		l.max = 1
+	}
+	l.cond = sync.NewCond(&l.mu)
+	l.window.start = l.now()
+	return l
+}
+
+// Limit returns the current number of allowed concurrent operations.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *AdaptiveLimiter) setInitial(n uint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = int(n)
+	if l.limit > l.max {
+		l.limit = l.max
+	}
+	if l.limit < 1 {
+		l.limit = 1
+	}
+	l.resetWindow()
+}
+
+// GetToken blocks until an operation is allowed to start.
+func (l *AdaptiveLimiter) GetToken() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.inUse >= l.limit {
+		// all connections are busy, so the limit is a bottleneck
+		l.window.saturated = true
+		l.cond.Wait()
+	}
+	l.inUse++
+	if l.inUse == l.limit {
+		l.window.saturated = true
+	}
+	debug.Log("acquired token, %d/%d in use", l.inUse, l.limit)
+}
+
+// ReleaseToken returns a token.
+func (l *AdaptiveLimiter) ReleaseToken() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inUse--
+	l.cond.Broadcast()
+}
+
+// Report records a finished operation which took latency and transferred
+// the given number of bytes.
+func (l *AdaptiveLimiter) Report(latency time.Duration, bytes int64, err error) {
+	if err != nil {
+		// failed operations say little about the throughput, throttling is
+		// detected using the HTTP status codes instead
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.window.requests++
+	l.window.bytes += bytes
+	l.window.latency += latency
+
+	elapsed := l.now().Sub(l.window.start)
+	if elapsed < adaptiveWindow || l.window.requests < l.limit {
+		return
+	}
+	l.adjust(elapsed)
+	l.resetWindow()
+}
+
+// adjust updates the limit based on the statistics of the current window.
+func (l *AdaptiveLimiter) adjust(elapsed time.Duration) {
+	w := l.window
+	avgLatency := w.latency / time.Duration(w.requests)
+
+	// compare the data rate if possible, fall back to the request rate for
+	// windows which only contain small operations like Stat or Remove
+	hasBytes := w.bytes > 0
+	score := float64(w.requests) / elapsed.Seconds()
+	if hasBytes {
+		score = float64(w.bytes) / elapsed.Seconds()
+	}
+	comparable := l.prevScore > 0 && hasBytes == l.prevBytes
+	prevScore := l.prevScore
+	l.prevScore, l.prevBytes = score, hasBytes
+
+	if l.steadyLatency == 0 {
+		l.steadyLatency = avgLatency
+	}
+
+	switch {
+	case !w.saturated:
+		// the operations did not use all connections, more would not help
+		l.probing = false
+	case l.probing && comparable && score < prevScore*(1+adaptiveGain):
+		// the last additional connection did not increase the throughput
+		l.decrease(l.limit-1, "throughput did not increase")
+	case !l.probing && comparable && avgLatency > time.Duration(float64(l.steadyLatency)*adaptiveLatency) && score < prevScore*(1+adaptiveGain):
+		// operations take longer without an increase in throughput, the
+		// backend is likely overloaded
+		l.decrease(l.limit-1, "latency increased")
+	case l.hold > 0:
+		l.hold--
+	case l.limit < l.max:
+		l.limit++
+		l.probing = true
+		l.steadyLatency = 0
+		l.cond.Broadcast()
+		debug.Log("increased connection limit to %d", l.limit)
+	default:
+		l.probing = false
+	}
+}
+
+func (l *AdaptiveLimiter) decrease(limit int, reason string) {
+	if limit < 1 {
+		limit = 1
+	}
+	if limit != l.limit {
+		debug.Log("decreased connection limit from %d to %d: %v", l.limit, limit, reason)
+	}
+	l.limit = limit
+	l.probing = false
+	l.hold = adaptiveHold
+	l.steadyLatency = 0
+}
+
+func (l *AdaptiveLimiter) resetWindow() {
+	l.window = adaptiveWindowStats{
+		start:     l.now(),
+		saturated: l.inUse >= l.limit,
+	}
+}
+
+// Throttled halves the limit as the backend asked to slow down. Further
+// throttling responses within the same window are ignored, as these usually
+// belong to operations which were started before the limit was reduced.
+func (l *AdaptiveLimiter) Throttled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !l.lastThrottle.IsZero() && now.Sub(l.lastThrottle) < adaptiveWindow {
+		return
+	}
+	l.lastThrottle = now
+	l.decrease(l.limit/2, "backend is throttling requests")
+	l.prevScore = 0
+	l.resetWindow()
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt(req)
+}
+
+// Transport returns an HTTP transport which reports throttling responses
+// to the limiter.
+func (l *AdaptiveLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		res, err := rt.RoundTrip(req)
+		if err == nil && (res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable) {
+			l.Throttled()
+		}
+		return res, err
+	})
+}
@@ -0,0 +1,157 @@
+package sema
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/mock"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newTestAdaptiveLimiter(initial, max uint) (*AdaptiveLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	l := NewAdaptiveLimiter(max)
+	l.now = clock.now
+	l.setInitial(initial)
+	return l, clock
+}
+
+// runWindow simulates one measurement window in which all connections are
+// used and the given number of bytes is transferred.
+func runWindow(l *AdaptiveLimiter, clock *fakeClock, bytes int64) {
+	limit := l.Limit()
+	for i := 0; i < limit; i++ {
+		l.GetToken()
+	}
+	clock.t = clock.t.Add(adaptiveWindow)
+	for i := 0; i < limit; i++ {
+		l.ReleaseToken()
+		l.Report(time.Second, bytes/int64(limit), nil)
+	}
+}
+
+func TestAdaptiveLimiterInitial(t *testing.T) {
+	l, _ := newTestAdaptiveLimiter(5, 3)
+	rtest.Equals(t, 3, l.Limit())
+
+	l, _ = newTestAdaptiveLimiter(0, 3)
+	rtest.Equals(t, 1, l.Limit())
+}
+
+func TestAdaptiveLimiterIncrease(t *testing.T) {
+	l, clock := newTestAdaptiveLimiter(2, 8)
+
+	// the throughput scales with the number of connections
+	for i := 0; i < 20; i++ {
+		runWindow(l, clock, int64(l.Limit())*1000)
+	}
+	rtest.Equals(t, 8, l.Limit())
+}
+
+func TestAdaptiveLimiterPlateau(t *testing.T) {
+	l, clock := newTestAdaptiveLimiter(2, 16)
+
+	// the throughput does not increase beyond four connections
+	throughput := func() int64 {
+		if l.Limit() > 4 {
+			return 4000
+		}
+		return int64(l.Limit()) * 1000
+	}
+	// 2 -> 3 -> 4 -> 5, then back to 4 as the fifth connection did not help
+	for i := 0; i < 4; i++ {
+		runWindow(l, clock, throughput())
+	}
+	rtest.Equals(t, 4, l.Limit())
+
+	// the limit is probed again once the hold time is over
+	for i := 0; i < adaptiveHold; i++ {
+		runWindow(l, clock, throughput())
+		rtest.Equals(t, 4, l.Limit())
+	}
+	runWindow(l, clock, throughput())
+	rtest.Equals(t, 5, l.Limit())
+	runWindow(l, clock, throughput())
+	rtest.Equals(t, 4, l.Limit())
+}
+
+func TestAdaptiveLimiterUnsaturated(t *testing.T) {
+	l, clock := newTestAdaptiveLimiter(2, 8)
+
+	// only a single connection is used, additional ones would not help
+	for i := 0; i < 10; i++ {
+		l.GetToken()
+		clock.t = clock.t.Add(adaptiveWindow)
+		l.ReleaseToken()
+		l.Report(time.Second, 1000, nil)
+		l.Report(time.Second, 1000, nil)
+	}
+	rtest.Equals(t, 2, l.Limit())
+}
+
+func TestAdaptiveLimiterThrottled(t *testing.T) {
+	l, clock := newTestAdaptiveLimiter(8, 8)
+
+	l.Throttled()
+	rtest.Equals(t, 4, l.Limit())
+	// responses for requests which were already running are ignored
+	l.Throttled()
+	rtest.Equals(t, 4, l.Limit())
+
+	clock.t = clock.t.Add(adaptiveWindow)
+	l.Throttled()
+	rtest.Equals(t, 2, l.Limit())
+	clock.t = clock.t.Add(adaptiveWindow)
+	l.Throttled()
+	rtest.Equals(t, 1, l.Limit())
+	clock.t = clock.t.Add(adaptiveWindow)
+	l.Throttled()
+	rtest.Equals(t, 1, l.Limit())
+
+	// connections are only added again after the hold time
+	for i := 0; i < adaptiveHold; i++ {
+		runWindow(l, clock, 1000)
+	}
+	rtest.Equals(t, 1, l.Limit())
+	runWindow(l, clock, 1000)
+	rtest.Equals(t, 2, l.Limit())
+}
+
+func TestAdaptiveLimiterTransport(t *testing.T) {
+	l, _ := newTestAdaptiveLimiter(4, 4)
+
+	status := http.StatusOK
+	rt := l.Transport(roundTripper(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status}, nil
+	}))
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	rtest.OK(t, err)
+
+	_, err = rt.RoundTrip(req)
+	rtest.OK(t, err)
+	rtest.Equals(t, 4, l.Limit())
+
+	status = http.StatusTooManyRequests
+	_, err = rt.RoundTrip(req)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, l.Limit())
+}
+
+func TestAdaptiveBackendConnections(t *testing.T) {
+	m := mock.NewBackend()
+	m.ConnectionsFn = func() uint { return 3 }
+
+	l := NewAdaptiveLimiter(10)
+	be := NewAdaptiveBackend(m, l)
+	rtest.Equals(t, uint(10), be.Connections())
+	rtest.Equals(t, 3, l.Limit())
+}
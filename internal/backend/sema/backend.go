@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/restic/restic/internal/backend"
@@ -13,10 +14,17 @@ import (
 // make sure that connectionLimitedBackend implements backend.Backend
 var _ backend.Backend = &connectionLimitedBackend{}
 
+// tokenPool hands out tokens for backend operations.
+type tokenPool interface {
+	GetToken()
+	ReleaseToken()
+}
+
 // connectionLimitedBackend limits the number of concurrent operations.
 type connectionLimitedBackend struct {
 	backend.Backend
-	sem        semaphore
+	sem        tokenPool
+	adaptive   *AdaptiveLimiter
 	freezeLock sync.Mutex
 }
 
@@ -33,6 +41,28 @@ func NewBackend(be backend.Backend) backend.Backend {
 	}
 }
 
+// NewAdaptiveBackend creates a backend that dynamically adjusts the number of
+// concurrent operations on the underlying backend using lim. The number of
+// connections configured for the underlying backend is used as initial limit.
+func NewAdaptiveBackend(be backend.Backend, lim *AdaptiveLimiter) backend.Backend {
+	lim.setInitial(be.Connections())
+
+	return &connectionLimitedBackend{
+		Backend:  be,
+		sem:      lim,
+		adaptive: lim,
+	}
+}
+
+// Connections returns the maximum number of concurrent operations, such that
+// callers start enough workers to make use of all connections.
+func (be *connectionLimitedBackend) Connections() uint {
+	if be.adaptive != nil {
+		return uint(be.adaptive.max)
+	}
+	return be.Backend.Connections()
+}
+
 // typeDependentLimit acquire a token unless the FileType is a lock file. The returned function
 // must be called to release the token.
 func (be *connectionLimitedBackend) typeDependentLimit(t backend.FileType) func() {
@@ -48,6 +78,14 @@ func (be *connectionLimitedBackend) typeDependentLimit(t backend.FileType) func(
 	return be.sem.ReleaseToken
 }
 
+// report passes the outcome of an operation to the adaptive limiter.
+func (be *connectionLimitedBackend) report(t backend.FileType, start time.Time, bytes int64, err error) {
+	if be.adaptive == nil || t == backend.LockFile {
+		return
+	}
+	be.adaptive.Report(time.Since(start), bytes, err)
+}
+
 // Freeze blocks all backend operations except those on lock files
 func (be *connectionLimitedBackend) Freeze() {
 	be.freezeLock.Lock()
@@ -70,7 +108,14 @@ func (be *connectionLimitedBackend) Save(ctx context.Context, h backend.Handle,
 		return ctx.Err()
 	}
 
-	return be.Backend.Save(ctx, h, rd)
+	if be.adaptive == nil {
+		return be.Backend.Save(ctx, h, rd)
+	}
+
+	start := time.Now()
+	err := be.Backend.Save(ctx, h, rd)
+	be.report(h.Type, start, rd.Length(), err)
+	return err
 }
 
 // Load runs fn with a reader that yields the contents of the file at h at the
@@ -92,7 +137,17 @@ func (be *connectionLimitedBackend) Load(ctx context.Context, h backend.Handle,
 		return ctx.Err()
 	}
 
-	return be.Backend.Load(ctx, h, length, offset, fn)
+	if be.adaptive == nil {
+		return be.Backend.Load(ctx, h, length, offset, fn)
+	}
+
+	start := time.Now()
+	var n int64
+	err := be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		return fn(&countingReader{rd: rd, n: &n})
+	})
+	be.report(h.Type, start, n, err)
+	return err
 }
 
 // Stat returns information about a file in the backend.
@@ -107,7 +162,10 @@ func (be *connectionLimitedBackend) Stat(ctx context.Context, h backend.Handle)
 		return backend.FileInfo{}, ctx.Err()
 	}
 
-	return be.Backend.Stat(ctx, h)
+	start := time.Now()
+	fi, err := be.Backend.Stat(ctx, h)
+	be.report(h.Type, start, 0, err)
+	return fi, err
 }
 
 // Remove deletes a file from the backend.
@@ -122,9 +180,24 @@ func (be *connectionLimitedBackend) Remove(ctx context.Context, h backend.Handle
 		return ctx.Err()
 	}
 
-	return be.Backend.Remove(ctx, h)
+	start := time.Now()
+	err := be.Backend.Remove(ctx, h)
+	be.report(h.Type, start, 0, err)
+	return err
 }
 
 func (be *connectionLimitedBackend) Unwrap() backend.Backend {
 	return be.Backend
 }
+
+// countingReader counts the number of bytes read.
+type countingReader struct {
+	rd io.Reader
+	n  *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,235 @@
+// Package setup opens the backend of a repository. It registers all backends
+// and wraps the opened backend with the bandwidth and connection limits,
+// retries and logging, such that the command line and the library access
+// repositories in the same way.
+package setup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/azure"
+	"github.com/restic/restic/internal/backend/b2"
+	"github.com/restic/restic/internal/backend/fault"
+	"github.com/restic/restic/internal/backend/gs"
+	"github.com/restic/restic/internal/backend/limiter"
+	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/logger"
+	"github.com/restic/restic/internal/backend/rclone"
+	"github.com/restic/restic/internal/backend/rest"
+	"github.com/restic/restic/internal/backend/retry"
+	"github.com/restic/restic/internal/backend/s3"
+	"github.com/restic/restic/internal/backend/sema"
+	"github.com/restic/restic/internal/backend/sftp"
+	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/backend/tier"
+	"github.com/restic/restic/internal/backend/webdav"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+)
+
+// Backends returns a registry which contains all backends.
+func Backends() *location.Registry {
+	backends := location.NewRegistry()
+	backends.Register(azure.NewFactory())
+	backends.Register(b2.NewFactory())
+	backends.Register(gs.NewFactory())
+	backends.Register(local.NewFactory())
+	backends.Register(rclone.NewFactory())
+	backends.Register(rest.NewFactory())
+	backends.Register(s3.NewFactory())
+	backends.Register(sftp.NewFactory())
+	backends.Register(swift.NewFactory())
+	backends.Register(webdav.NewFactory())
+	backends.Register(tier.NewFactory(backends))
+	return backends
+}
+
+// ParseConfig applies the environment and the options for the backend to the
+// config of loc.
+func ParseConfig(loc location.Location, opts options.Options) (interface{}, error) {
+	cfg := loc.Config
+	if cfg, ok := cfg.(*tier.Config); ok {
+		// apply environment and options to both sub-backends
+		var err error
+		if cfg.Meta.Config, err = ParseConfig(cfg.Meta, opts); err != nil {
+			return nil, err
+		}
+		if cfg.Data.Config, err = ParseConfig(cfg.Data, opts); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+	if cfg, ok := cfg.(backend.ApplyEnvironmenter); ok {
+		cfg.ApplyEnvironment("")
+	}
+
+	// only apply options for a particular backend here
+	opts = opts.Extract(loc.Scheme)
+	if err := opts.Apply(loc.Scheme, cfg); err != nil {
+		return nil, err
+	}
+
+	debug.Log("opening %v repository at %#v", loc.Scheme, cfg)
+	return cfg, nil
+}
+
+// Options configures how a backend is accessed.
+type Options struct {
+	// Backends is used to look up the backend, Backends() if nil.
+	Backends *location.Registry
+	// Extended holds the backend specific options passed via -o.
+	Extended  options.Options
+	Transport backend.TransportOptions
+
+	// Limits are the default bandwidth limits, which are varied by the
+	// rules of Schedule.
+	Limits   limiter.Limits
+	Schedule limiter.Schedule
+	// Share, if set, is the share of the bandwidth limits available to this
+	// process.
+	Share *limiter.Share
+	// MaxConnections enables the adaptive connection limit if it is
+	// positive, otherwise the backend uses a fixed number of connections.
+	MaxConnections uint
+
+	// Warnf is called for warnings, for example failed requests which are
+	// retried. It may be nil.
+	Warnf func(format string, args ...interface{})
+	// Failed is called for operations which failed after all retries. It
+	// may be nil.
+	Failed func(err error)
+
+	// InnerHook and Hook can wrap the backend before and after the retries
+	// are added, they are used by tests.
+	InnerHook func(backend.Backend) (backend.Backend, error)
+	Hook      func(backend.Backend) (backend.Backend, error)
+}
+
+// OpenError is returned by Open if the backend could not be opened or
+// created.
+type OpenError struct {
+	// Location is the location of the repository without password.
+	Location string
+	Err      error
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("unable to open repository at %v: %v", e.Location, e.Err)
+}
+
+func (e *OpenError) Unwrap() error {
+	return e.Err
+}
+
+// Open opens the backend at the location s, or creates it if create is set.
+func Open(ctx context.Context, s string, opts Options, create bool) (backend.Backend, error) {
+	backends := opts.Backends
+	if backends == nil {
+		backends = Backends()
+	}
+	warnf := opts.Warnf
+	if warnf == nil {
+		warnf = func(string, ...interface{}) {}
+	}
+
+	debug.Log("parsing location %v", location.StripPassword(backends, s))
+	loc, err := location.Parse(backends, s)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing repository location failed")
+	}
+
+	cfg, err := ParseConfig(loc, opts.Extended)
+	if err != nil {
+		return nil, err
+	}
+
+	faultCfg, err := fault.ParseConfig(opts.Extended)
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := backend.Transport(opts.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	// wrap the transport so that the throughput via HTTP is limited
+	lim := limiter.NewStaticLimiter(opts.Limits)
+	if len(opts.Schedule) > 0 || opts.Share != nil {
+		scheduled := limiter.NewScheduledLimiter(opts.Schedule, opts.Limits, 0)
+		scheduled.SetShare(opts.Share)
+		lim = scheduled
+	}
+	rt = lim.Transport(rt)
+
+	// report throttling responses to the adaptive connection limit
+	var adaptive *sema.AdaptiveLimiter
+	if opts.MaxConnections > 0 {
+		adaptive = sema.NewAdaptiveLimiter(opts.MaxConnections)
+		rt = adaptive.Transport(rt)
+	}
+
+	factory := backends.Lookup(loc.Scheme)
+	if factory == nil {
+		return nil, errors.Errorf("invalid backend: %q", loc.Scheme)
+	}
+
+	var be backend.Backend
+	if create {
+		be, err = factory.Create(ctx, cfg, rt, lim)
+	} else {
+		be, err = factory.Open(ctx, cfg, rt, lim)
+	}
+	if err != nil {
+		return nil, &OpenError{Location: location.StripPassword(backends, s), Err: err}
+	}
+
+	// inject faults for testing the error handling
+	if faultCfg.Enabled() {
+		warnf("injecting faults into backend operations\n")
+		be = fault.New(be, faultCfg)
+	}
+
+	// wrap with debug logging and connection limiting
+	if adaptive != nil {
+		be = logger.New(sema.NewAdaptiveBackend(be, adaptive))
+	} else {
+		be = logger.New(sema.NewBackend(be))
+	}
+
+	if opts.InnerHook != nil {
+		be, err = opts.InnerHook(be)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := func(msg string, err error, d time.Duration) {
+		if d >= 0 {
+			warnf("%v returned error, retrying after %v: %v\n", msg, d, err)
+		} else {
+			if opts.Failed != nil {
+				opts.Failed(err)
+			}
+			warnf("%v failed: %v\n", msg, err)
+		}
+	}
+	success := func(msg string, retries int) {
+		warnf("%v operation successful after %d retries\n", msg, retries)
+	}
+	be = retry.New(be, 15*time.Minute, report, success)
+
+	if opts.Hook != nil {
+		be, err = opts.Hook(be)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return be, nil
+}
@@ -0,0 +1,45 @@
+package setup_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/setup"
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestOpen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "repo")
+	ctx := context.Background()
+
+	var hooked int
+	hook := func(be backend.Backend) (backend.Backend, error) {
+		hooked++
+		return be, nil
+	}
+	be, err := setup.Open(ctx, "local:"+dir, setup.Options{MaxConnections: 2, InnerHook: hook, Hook: hook}, true)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, hooked)
+	rtest.OK(t, be.Close())
+
+	be, err = setup.Open(ctx, "local:"+dir, setup.Options{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, be.Save(ctx, backend.Handle{Type: backend.ConfigFile}, backend.NewByteReader([]byte("config"), nil)))
+	rtest.OK(t, be.Close())
+
+	// creating the repository again fails
+	_, err = setup.Open(ctx, "local:"+dir, setup.Options{}, true)
+	var openErr *setup.OpenError
+	rtest.Assert(t, errors.As(err, &openErr), "expected OpenError, got %v", err)
+	rtest.Equals(t, "local:"+dir, openErr.Location)
+}
+
+func TestOpenInvalidLocation(t *testing.T) {
+	_, err := setup.Open(context.Background(), "foo:bar", setup.Options{}, false)
+	rtest.Assert(t, err != nil, "expected error for invalid location")
+	var openErr *setup.OpenError
+	rtest.Assert(t, !errors.As(err, &openErr), "unexpected OpenError %v", err)
+}
@@ -42,7 +42,7 @@ type SFTP struct {
 	util.Modes
 }
 
-var _ backend.Backend = &SFTP{}
+var _ backend.CapacityBackend = &SFTP{}
 
 var errTooShort = fmt.Errorf("file is too short")
 
@@ -452,6 +452,23 @@ func (r *SFTP) Stat(_ context.Context, h backend.Handle) (backend.FileInfo, erro
 	return backend.FileInfo{Size: fi.Size(), Name: h.Name}, nil
 }
 
+// Capacity returns the free and total space of the file system containing the
+// repository. It requires the statvfs@openssh.com extension.
+func (r *SFTP) Capacity(_ context.Context) (backend.Capacity, error) {
+	if err := r.clientError(); err != nil {
+		return backend.Capacity{}, err
+	}
+	if _, ok := r.c.HasExtension("statvfs@openssh.com"); !ok {
+		return backend.Capacity{}, errors.New("sftp: server does not support statvfs")
+	}
+
+	fsinfo, err := r.c.StatVFS(r.p)
+	if err != nil {
+		return backend.Capacity{}, errors.Wrap(err, "StatVFS")
+	}
+	return backend.Capacity{Free: fsinfo.Frsize * fsinfo.Bavail, Total: fsinfo.TotalSpace()}, nil
+}
+
 // Remove removes the content stored at name.
 func (r *SFTP) Remove(_ context.Context, h backend.Handle) error {
 	if err := r.clientError(); err != nil {
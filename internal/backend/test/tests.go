@@ -785,7 +785,7 @@ func (s *Suite[C]) TestBackend(t *testing.T) {
 
 	for _, tpe := range []backend.FileType{
 		backend.PackFile, backend.KeyFile, backend.LockFile,
-		backend.SnapshotFile, backend.IndexFile,
+		backend.SnapshotFile, backend.IndexFile, backend.OpLogFile, backend.ApprovalFile,
 	} {
 		// detect non-existing files
 		for _, ts := range testStrings {
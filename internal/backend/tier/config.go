@@ -0,0 +1,85 @@
+package tier
+
+import (
+	"strings"
+
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Config contains the locations of the two backends used by the tier
+// backend. Data packs are stored in Data, all other files in Meta.
+type Config struct {
+	Meta location.Location
+	Data location.Location
+}
+
+// splitConfig splits the string s into the meta and data locations. Both
+// locations may contain commas, therefore the string is only split at
+// ",meta=" or ",data=".
+func splitConfig(s string) (meta, data string, err error) {
+	if !strings.HasPrefix(s, "tier:") {
+		return "", "", errors.New("invalid tier backend specification")
+	}
+	s = s[5:]
+
+	var first, second string
+	switch {
+	case strings.HasPrefix(s, "meta="):
+		var ok bool
+		first, second, ok = strings.Cut(s[5:], ",data=")
+		if !ok {
+			return "", "", errors.New("tier: data location missing")
+		}
+		meta, data = first, second
+	case strings.HasPrefix(s, "data="):
+		var ok bool
+		first, second, ok = strings.Cut(s[5:], ",meta=")
+		if !ok {
+			return "", "", errors.New("tier: meta location missing")
+		}
+		data, meta = first, second
+	default:
+		return "", "", errors.New("invalid tier backend specification, expected tier:meta=<location>,data=<location>")
+	}
+
+	if meta == "" || data == "" {
+		return "", "", errors.New("tier: empty location")
+	}
+	return meta, data, nil
+}
+
+// parseConfig parses the string s and extracts the meta and data locations
+// using the backends in registry.
+func parseConfig(registry *location.Registry, s string) (*Config, error) {
+	meta, data, err := splitConfig(s)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range []string{meta, data} {
+		if strings.HasPrefix(sub, "tier:") {
+			return nil, errors.New("tier: nested tier backends are not supported")
+		}
+	}
+
+	cfg := &Config{}
+	cfg.Meta, err = location.Parse(registry, meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "meta location")
+	}
+	cfg.Data, err = location.Parse(registry, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "data location")
+	}
+	return cfg, nil
+}
+
+// stripPassword removes the passwords from both locations in s.
+func stripPassword(registry *location.Registry, s string) string {
+	meta, data, err := splitConfig(s)
+	if err != nil {
+		return s
+	}
+	return "tier:meta=" + location.StripPassword(registry, meta) + ",data=" + location.StripPassword(registry, data)
+}
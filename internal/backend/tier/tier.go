@@ -0,0 +1,284 @@
+// Package tier implements a backend which stores data packs and metadata in
+// two different backends.
+package tier
+
+import (
+	"context"
+	"hash"
+	"io"
+	"net/http"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/limiter"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/sema"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Backend stores pack files containing data blobs in the data backend and all
+// other files, including pack files containing tree blobs, in the meta
+// backend. This allows keeping the files which are read by most operations
+// on fast storage, while the bulk of the data is stored on cheap storage.
+type Backend struct {
+	meta backend.Backend
+	data backend.Backend
+}
+
+// make sure that *Backend implements backend.Backend
+var _ backend.Backend = &Backend{}
+
+// New returns a backend which routes files to meta and data.
+func New(meta, data backend.Backend) *Backend {
+	return &Backend{
+		meta: meta,
+		data: data,
+	}
+}
+
+type factory struct {
+	registry *location.Registry
+}
+
+// NewFactory returns the factory for the tier backend. The sub-backends are
+// looked up in registry.
+func NewFactory(registry *location.Registry) location.Factory {
+	return &factory{registry: registry}
+}
+
+func (f *factory) Scheme() string {
+	return "tier"
+}
+
+func (f *factory) ParseConfig(s string) (interface{}, error) {
+	return parseConfig(f.registry, s)
+}
+
+func (f *factory) StripPassword(s string) string {
+	return stripPassword(f.registry, s)
+}
+
+func (f *factory) Create(ctx context.Context, cfg interface{}, rt http.RoundTripper, lim limiter.Limiter) (backend.Backend, error) {
+	return f.open(ctx, *cfg.(*Config), rt, lim, true)
+}
+
+func (f *factory) Open(ctx context.Context, cfg interface{}, rt http.RoundTripper, lim limiter.Limiter) (backend.Backend, error) {
+	return f.open(ctx, *cfg.(*Config), rt, lim, false)
+}
+
+func (f *factory) open(ctx context.Context, cfg Config, rt http.RoundTripper, lim limiter.Limiter, create bool) (backend.Backend, error) {
+	openSub := func(loc location.Location) (backend.Backend, error) {
+		sub := f.registry.Lookup(loc.Scheme)
+		if sub == nil {
+			return nil, errors.Errorf("invalid backend: %q", loc.Scheme)
+		}
+		var be backend.Backend
+		var err error
+		if create {
+			be, err = sub.Create(ctx, loc.Config, rt, lim)
+		} else {
+			be, err = sub.Open(ctx, loc.Config, rt, lim)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// each backend keeps its own connection limit
+		return sema.NewBackend(be), nil
+	}
+
+	meta, err := openSub(cfg.Meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "meta")
+	}
+	data, err := openSub(cfg.Data)
+	if err != nil {
+		_ = meta.Close()
+		return nil, errors.Wrap(err, "data")
+	}
+
+	debug.Log("opened tier backend with meta %v and data %v", cfg.Meta.Scheme, cfg.Data.Scheme)
+	return New(meta, data), nil
+}
+
+// isData returns true if the file h is stored in the data backend.
+func isData(h backend.Handle) bool {
+	return h.Type == backend.PackFile && !h.IsMetadata
+}
+
+// route returns the backend which is expected to contain the file h, followed
+// by the backend which may contain it as well. Pack files are not always
+// marked correctly as containing metadata, for example when they are only
+// listed or removed, so they are searched in both backends.
+func (be *Backend) route(h backend.Handle) (backend.Backend, backend.Backend) {
+	if h.Type != backend.PackFile {
+		return be.meta, nil
+	}
+	if h.IsMetadata {
+		return be.meta, be.data
+	}
+	return be.data, be.meta
+}
+
+// Connections returns the maximum number of concurrent backend operations.
+func (be *Backend) Connections() uint {
+	return be.meta.Connections() + be.data.Connections()
+}
+
+// Hasher returns nil, the hash required by a sub-backend is calculated in
+// Save.
+func (be *Backend) Hasher() hash.Hash {
+	return nil
+}
+
+// HasAtomicReplace returns whether Save() can atomically replace files.
+func (be *Backend) HasAtomicReplace() bool {
+	return be.meta.HasAtomicReplace() && be.data.HasAtomicReplace()
+}
+
+// hashedReader adds the hash required by a backend to a RewindReader.
+type hashedReader struct {
+	backend.RewindReader
+	hash []byte
+}
+
+func (rd *hashedReader) Hash() []byte {
+	return rd.hash
+}
+
+// Save stores the data from rd under the given handle.
+func (be *Backend) Save(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
+	target := be.meta
+	if isData(h) {
+		target = be.data
+	}
+
+	if hasher := target.Hasher(); hasher != nil {
+		if err := rd.Rewind(); err != nil {
+			return err
+		}
+		if _, err := io.Copy(hasher, rd); err != nil {
+			return errors.Wrap(err, "hash")
+		}
+		if err := rd.Rewind(); err != nil {
+			return err
+		}
+		rd = &hashedReader{RewindReader: rd, hash: hasher.Sum(nil)}
+	}
+
+	return target.Save(ctx, h, rd)
+}
+
+// Load runs fn with a reader that yields the contents of the file at h.
+func (be *Backend) Load(ctx context.Context, h backend.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	first, second := be.route(h)
+	err := first.Load(ctx, h, length, offset, fn)
+	if second != nil && first.IsNotExist(err) {
+		debug.Log("%v not found, trying other backend", h)
+		return second.Load(ctx, h, length, offset, fn)
+	}
+	return err
+}
+
+// Stat returns information about the file identified by h.
+func (be *Backend) Stat(ctx context.Context, h backend.Handle) (backend.FileInfo, error) {
+	first, second := be.route(h)
+	fi, err := first.Stat(ctx, h)
+	if second != nil && first.IsNotExist(err) {
+		return second.Stat(ctx, h)
+	}
+	return fi, err
+}
+
+// Remove removes the file h.
+func (be *Backend) Remove(ctx context.Context, h backend.Handle) error {
+	first, second := be.route(h)
+	err := first.Remove(ctx, h)
+	if second != nil && first.IsNotExist(err) {
+		return second.Remove(ctx, h)
+	}
+	return err
+}
+
+// List runs fn for each file of type t. Pack files are listed from both
+// backends.
+func (be *Backend) List(ctx context.Context, t backend.FileType, fn func(backend.FileInfo) error) error {
+	if err := be.meta.List(ctx, t, fn); err != nil {
+		return err
+	}
+	if t != backend.PackFile {
+		return nil
+	}
+	return be.data.List(ctx, t, fn)
+}
+
+// IsNotExist returns true if the error was caused by a non-existing file.
+func (be *Backend) IsNotExist(err error) bool {
+	return be.meta.IsNotExist(err) || be.data.IsNotExist(err)
+}
+
+// IsPermanentError returns true if the error can very likely not be resolved
+// by retrying the operation.
+func (be *Backend) IsPermanentError(err error) bool {
+	return be.meta.IsPermanentError(err) || be.data.IsPermanentError(err)
+}
+
+// Delete removes all data in both backends.
+func (be *Backend) Delete(ctx context.Context) error {
+	if err := be.data.Delete(ctx); err != nil {
+		return err
+	}
+	return be.meta.Delete(ctx)
+}
+
+// Close closes both backends.
+func (be *Backend) Close() error {
+	return errors.Join(be.meta.Close(), be.data.Close())
+}
+
+// split returns the handles stored in the meta and the data backend.
+func split(handles []backend.Handle) (meta, data []backend.Handle) {
+	for _, h := range handles {
+		if isData(h) {
+			data = append(data, h)
+		} else {
+			meta = append(meta, h)
+		}
+	}
+	return meta, data
+}
+
+// Warmup passes the handles on to the backend which stores them.
+func (be *Backend) Warmup(ctx context.Context, handles []backend.Handle) ([]backend.Handle, error) {
+	meta, data := split(handles)
+
+	var warming []backend.Handle
+	if len(meta) > 0 {
+		hs, err := be.meta.Warmup(ctx, meta)
+		warming = append(warming, hs...)
+		if err != nil {
+			return warming, err
+		}
+	}
+	if len(data) > 0 {
+		hs, err := be.data.Warmup(ctx, data)
+		warming = append(warming, hs...)
+		if err != nil {
+			return warming, err
+		}
+	}
+	return warming, nil
+}
+
+// WarmupWait waits until all given handles are warm.
+func (be *Backend) WarmupWait(ctx context.Context, handles []backend.Handle) error {
+	meta, data := split(handles)
+	if len(meta) > 0 {
+		if err := be.meta.WarmupWait(ctx, meta); err != nil {
+			return err
+		}
+	}
+	if len(data) > 0 {
+		return be.data.WarmupWait(ctx, data)
+	}
+	return nil
+}
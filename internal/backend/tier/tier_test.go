@@ -0,0 +1,91 @@
+package tier_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/backend/tier"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func newTestSuite(t testing.TB) *test.Suite[tier.Config] {
+	registry := location.NewRegistry()
+	registry.Register(local.NewFactory())
+
+	return &test.Suite[tier.Config]{
+		// NewConfig returns a config for a new temporary backend that will be used in tests.
+		NewConfig: func() (*tier.Config, error) {
+			meta := local.NewConfig()
+			meta.Path = rtest.TempDir(t)
+			data := local.NewConfig()
+			data.Path = rtest.TempDir(t)
+			t.Logf("create new backend at %v and %v", meta.Path, data.Path)
+
+			return &tier.Config{
+				Meta: location.Location{Scheme: "local", Config: &meta},
+				Data: location.Location{Scheme: "local", Config: &data},
+			}, nil
+		},
+
+		Factory: tier.NewFactory(registry),
+	}
+}
+
+func TestBackend(t *testing.T) {
+	newTestSuite(t).RunTests(t)
+}
+
+func TestRouting(t *testing.T) {
+	ctx := context.TODO()
+	meta := mem.New()
+	data := mem.New()
+	be := tier.New(meta, data)
+
+	files := []struct {
+		h      backend.Handle
+		isData bool
+	}{
+		{backend.Handle{Type: backend.ConfigFile}, false},
+		{backend.Handle{Type: backend.SnapshotFile, Name: "0001"}, false},
+		{backend.Handle{Type: backend.IndexFile, Name: "0002"}, false},
+		{backend.Handle{Type: backend.PackFile, Name: "0003", IsMetadata: true}, false},
+		{backend.Handle{Type: backend.PackFile, Name: "0004"}, true},
+	}
+
+	for _, f := range files {
+		buf := []byte(f.h.String())
+		// the mem backend requires the hash calculated by the tier backend
+		rtest.OK(t, be.Save(ctx, f.h, backend.NewByteReader(buf, be.Hasher())))
+
+		target, other := meta, data
+		if f.isData {
+			target, other = data, meta
+		}
+		_, err := target.Stat(ctx, f.h)
+		rtest.OK(t, err)
+		_, err = other.Stat(ctx, f.h)
+		rtest.Assert(t, other.IsNotExist(err), "%v stored in wrong backend", f.h)
+	}
+
+	// pack files are found even if the metadata flag is missing
+	h := backend.Handle{Type: backend.PackFile, Name: "0003"}
+	fi, err := be.Stat(ctx, h)
+	rtest.OK(t, err)
+	rtest.Equals(t, "0003", fi.Name)
+
+	var packs []string
+	rtest.OK(t, be.List(ctx, backend.PackFile, func(fi backend.FileInfo) error {
+		packs = append(packs, fi.Name)
+		return nil
+	}))
+	rtest.Equals(t, 2, len(packs))
+
+	rtest.OK(t, be.Remove(ctx, h))
+	_, err = be.Stat(ctx, h)
+	rtest.Assert(t, be.IsNotExist(err), "pack file was not removed")
+}
@@ -0,0 +1,332 @@
+package webdav
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// authTransport adds HTTP basic or digest authentication to requests. In the
+// "auto" mode, the first request is sent without credentials and the method is
+// chosen based on the challenge returned by the server. Afterwards all
+// requests are authenticated preemptively.
+type authTransport struct {
+	rt                 http.RoundTripper
+	username, password string
+	mode               string
+
+	m      sync.Mutex
+	scheme string
+	digest *digestChallenge
+	nc     uint32
+}
+
+func newAuthTransport(rt http.RoundTripper, username, password, mode string) (*authTransport, error) {
+	t := &authTransport{
+		rt:       rt,
+		username: username,
+		password: password,
+		mode:     mode,
+	}
+
+	switch mode {
+	case "", "auto":
+		t.mode = "auto"
+	case "basic":
+		t.scheme = "basic"
+	case "digest":
+	default:
+		return nil, errors.Fatalf("invalid WebDAV authentication method %q", mode)
+	}
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	authReq, err := t.authorize(req, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.rt.RoundTrip(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if !t.challenge(resp.Header.Values("WWW-Authenticate")) {
+		return resp, nil
+	}
+
+	// resend the request with the new credentials
+	body := req.Body
+	if body != nil && body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		body, err = req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	authReq, err = t.authorize(req, body)
+	if err != nil {
+		return nil, err
+	}
+	return t.rt.RoundTrip(authReq)
+}
+
+// authorize returns a copy of req with body and the authorization header for
+// the current authentication scheme.
+func (t *authTransport) authorize(req *http.Request, body io.ReadCloser) (*http.Request, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	r := req.Clone(req.Context())
+	r.Body = body
+
+	switch t.scheme {
+	case "basic":
+		r.SetBasicAuth(t.username, t.password)
+	case "digest":
+		t.nc++
+		auth, err := t.digest.authorization(t.username, t.password, r.Method, r.URL.RequestURI(), t.nc)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Authorization", auth)
+	}
+	return r, nil
+}
+
+// challenge updates the authentication scheme based on the challenges sent
+// by the server. It returns false if the request should not be retried.
+func (t *authTransport) challenge(values []string) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	challenges := parseChallenges(values)
+
+	if t.mode != "basic" {
+		var digest *digestChallenge
+		for _, c := range challenges {
+			if c.scheme != "digest" {
+				continue
+			}
+			d, err := newDigestChallenge(c.params)
+			if err != nil {
+				debug.Log("ignoring digest challenge: %v", err)
+				continue
+			}
+			// prefer SHA-256 if the server offers multiple algorithms
+			if digest == nil || strings.HasPrefix(d.algorithm, "SHA-256") {
+				digest = d
+			}
+		}
+
+		if digest != nil {
+			// a new challenge for a stale nonce is retried, otherwise the
+			// credentials are wrong
+			if t.scheme == "digest" && !digest.stale {
+				return false
+			}
+			debug.Log("using digest authentication with algorithm %v", digest.algorithm)
+			t.scheme = "digest"
+			t.digest = digest
+			t.nc = 0
+			return true
+		}
+	}
+
+	if t.mode == "auto" && t.scheme == "" {
+		for _, c := range challenges {
+			if c.scheme == "basic" {
+				debug.Log("using basic authentication")
+				t.scheme = "basic"
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type authChallenge struct {
+	scheme string
+	params map[string]string
+}
+
+// parseChallenges parses the values of WWW-Authenticate headers as described
+// in RFC 7235. A single value can contain multiple challenges.
+func parseChallenges(values []string) []authChallenge {
+	var challenges []authChallenge
+	for _, v := range values {
+		var cur *authChallenge
+		s := v
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			if s == "" {
+				break
+			}
+
+			tok := s
+			if i := strings.IndexAny(s, " \t,="); i >= 0 {
+				tok = s[:i]
+			}
+			s = strings.TrimLeft(s[len(tok):], " \t")
+
+			if !strings.HasPrefix(s, "=") || cur == nil {
+				// a token which is not followed by "=" starts a new challenge
+				challenges = append(challenges, authChallenge{
+					scheme: strings.ToLower(tok),
+					params: make(map[string]string),
+				})
+				cur = &challenges[len(challenges)-1]
+				continue
+			}
+
+			var value string
+			s = strings.TrimLeft(s[1:], " \t")
+			if strings.HasPrefix(s, `"`) {
+				var b strings.Builder
+				i := 1
+				for ; i < len(s) && s[i] != '"'; i++ {
+					if s[i] == '\\' && i+1 < len(s) {
+						i++
+					}
+					b.WriteByte(s[i])
+				}
+				value = b.String()
+				s = s[min(i+1, len(s)):]
+			} else {
+				i := strings.IndexAny(s, " \t,")
+				if i < 0 {
+					i = len(s)
+				}
+				value, s = s[:i], s[i:]
+			}
+			cur.params[strings.ToLower(tok)] = value
+		}
+	}
+	return challenges
+}
+
+// digestChallenge contains the parameters for HTTP digest authentication as
+// described in RFC 7616.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+
+	newHash func() hash.Hash
+	session bool
+}
+
+func newDigestChallenge(params map[string]string) (*digestChallenge, error) {
+	c := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+		stale:     strings.EqualFold(params["stale"], "true"),
+	}
+	if c.nonce == "" {
+		return nil, errors.New("nonce missing")
+	}
+
+	if c.algorithm == "" {
+		c.algorithm = "MD5"
+	}
+	switch strings.ToUpper(c.algorithm) {
+	case "MD5":
+		c.newHash = md5.New
+	case "MD5-SESS":
+		c.newHash, c.session = md5.New, true
+	case "SHA-256":
+		c.newHash = sha256.New
+	case "SHA-256-SESS":
+		c.newHash, c.session = sha256.New, true
+	default:
+		return nil, errors.Errorf("unsupported algorithm %q", c.algorithm)
+	}
+	c.algorithm = strings.ToUpper(c.algorithm)
+	if c.session {
+		c.algorithm = strings.TrimSuffix(c.algorithm, "-SESS") + "-sess"
+	}
+
+	if qop, ok := params["qop"]; ok {
+		for _, q := range strings.Split(qop, ",") {
+			if strings.TrimSpace(q) == "auth" {
+				c.qop = "auth"
+			}
+		}
+		if c.qop == "" {
+			return nil, errors.Errorf("unsupported qop %q", qop)
+		}
+	}
+	return c, nil
+}
+
+func (c *digestChallenge) h(s string) string {
+	h := c.newHash()
+	_, _ = h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorization returns the value of the Authorization header for a request.
+func (c *digestChallenge) authorization(username, password, method, uri string, nc uint32) (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", errors.Wrap(err, "cnonce")
+	}
+	cnonce := hex.EncodeToString(buf[:])
+
+	ha1 := c.h(username + ":" + c.realm + ":" + password)
+	if c.session {
+		ha1 = c.h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := c.h(method + ":" + uri)
+
+	var response string
+	if c.qop != "" {
+		response = c.h(fmt.Sprintf("%s:%s:%08x:%s:%s:%s", ha1, c.nonce, nc, cnonce, c.qop, ha2))
+	} else {
+		response = c.h(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+
+	fields := []string{
+		"username=" + quote(username),
+		"realm=" + quote(c.realm),
+		"nonce=" + quote(c.nonce),
+		"uri=" + quote(uri),
+		"algorithm=" + c.algorithm,
+		"response=" + quote(response),
+	}
+	if c.opaque != "" {
+		fields = append(fields, "opaque="+quote(c.opaque))
+	}
+	if c.qop != "" {
+		fields = append(fields, "qop="+c.qop, fmt.Sprintf("nc=%08x", nc), "cnonce="+quote(cnonce))
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+// quote returns s as an HTTP quoted-string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
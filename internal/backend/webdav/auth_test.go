@@ -0,0 +1,161 @@
+package webdav
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseChallenges(t *testing.T) {
+	challenges := parseChallenges([]string{
+		`Digest realm="test \"realm\"", qop="auth,auth-int", nonce=abc, algorithm=SHA-256, Basic realm="x"`,
+		`Negotiate`,
+	})
+	rtest.Equals(t, []authChallenge{
+		{scheme: "digest", params: map[string]string{"realm": `test "realm"`, "qop": "auth,auth-int", "nonce": "abc", "algorithm": "SHA-256"}},
+		{scheme: "basic", params: map[string]string{"realm": "x"}},
+		{scheme: "negotiate", params: map[string]string{}},
+	}, challenges)
+}
+
+// digestServer implements a minimal server for HTTP digest authentication,
+// which rotates the nonce after a number of requests.
+type digestServer struct {
+	username, password string
+	algorithm          string
+	newHash            func() hash.Hash
+	rotateAfter        int
+
+	m        sync.Mutex
+	nonce    int
+	requests int
+	bodies   []string
+}
+
+func (s *digestServer) h(v string) string {
+	h := s.newHash()
+	_, _ = h.Write([]byte(v))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	nonce := fmt.Sprintf("nonce-%d", s.nonce)
+	challenge := func(stale bool) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="restic", qop="auth", nonce=%q, algorithm=%s, stale=%v`, nonce, s.algorithm, stale))
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Digest ") {
+		challenge(false)
+		return
+	}
+	params := parseChallenges([]string{auth})[0].params
+
+	ha1 := s.h(s.username + ":restic:" + s.password)
+	ha2 := s.h(r.Method + ":" + r.URL.RequestURI())
+	expected := s.h(strings.Join([]string{ha1, params["nonce"], params["nc"], params["cnonce"], "auth", ha2}, ":"))
+	if params["response"] != expected || params["uri"] != r.URL.RequestURI() {
+		challenge(false)
+		return
+	}
+	if params["nonce"] != nonce {
+		challenge(true)
+		return
+	}
+
+	s.requests++
+	if s.requests%s.rotateAfter == 0 {
+		s.nonce++
+	}
+	body, _ := io.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(body))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func TestDigestAuth(t *testing.T) {
+	for _, test := range []struct {
+		algorithm string
+		newHash   func() hash.Hash
+	}{
+		{"MD5", md5.New},
+		{"SHA-256", sha256.New},
+	} {
+		t.Run(test.algorithm, func(t *testing.T) {
+			srv := &digestServer{username: "user", password: "secret", algorithm: test.algorithm, newHash: test.newHash, rotateAfter: 3}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			for _, mode := range []string{"auto", "digest"} {
+				rt, err := newAuthTransport(http.DefaultTransport, "user", "secret", mode)
+				rtest.OK(t, err)
+				client := http.Client{Transport: rt}
+
+				for i := 0; i < 10; i++ {
+					body := fmt.Sprintf("request %d", i)
+					req, err := http.NewRequest(http.MethodPut, ts.URL+"/data/file", strings.NewReader(body))
+					rtest.OK(t, err)
+					resp, err := client.Do(req)
+					rtest.OK(t, err)
+					rtest.OK(t, resp.Body.Close())
+					rtest.Equals(t, http.StatusCreated, resp.StatusCode)
+					rtest.Equals(t, body, srv.bodies[len(srv.bodies)-1])
+				}
+			}
+		})
+	}
+}
+
+func TestDigestAuthWrongPassword(t *testing.T) {
+	srv := &digestServer{username: "user", password: "secret", algorithm: "MD5", newHash: md5.New, rotateAfter: 3}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	rt, err := newAuthTransport(http.DefaultTransport, "user", "wrong", "auto")
+	rtest.OK(t, err)
+	client := http.Client{Transport: rt}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ts.URL + "/config")
+		rtest.OK(t, err)
+		rtest.OK(t, resp.Body.Close())
+		rtest.Equals(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestBasicAuthPreemptive(t *testing.T) {
+	var unauthorized int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); !ok {
+			unauthorized++
+			w.Header().Set("WWW-Authenticate", `Basic realm="restic"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	rt, err := newAuthTransport(http.DefaultTransport, "user", "secret", "basic")
+	rtest.OK(t, err)
+	client := http.Client{Transport: rt}
+	resp, err := client.Get(ts.URL + "/config")
+	rtest.OK(t, err)
+	rtest.OK(t, resp.Body.Close())
+	rtest.Equals(t, http.StatusOK, resp.StatusCode)
+	rtest.Equals(t, 0, unauthorized)
+
+	_, err = newAuthTransport(http.DefaultTransport, "user", "secret", "ntlm")
+	rtest.Assert(t, err != nil, "expected error for unsupported authentication method")
+}
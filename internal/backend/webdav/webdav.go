@@ -0,0 +1,538 @@
+// Package webdav implements a restic backend which stores the repository on a
+// WebDAV server, for example Nextcloud or ownCloud.
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/layout"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/util"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/feature"
+	"golang.org/x/sync/errgroup"
+)
+
+// make sure the webdav backend implements backend.Backend
+var _ backend.Backend = &Backend{}
+
+// Backend stores data on a WebDAV server.
+type Backend struct {
+	url         *url.URL
+	basePath    string
+	connections uint
+	client      http.Client
+	layout.Layout
+}
+
+// webdavError is returned whenever the server returns a non-successful HTTP status.
+type webdavError struct {
+	backend.Handle
+	StatusCode int
+	Status     string
+}
+
+func (e *webdavError) Error() string {
+	if e.StatusCode == http.StatusNotFound && e.Handle.Type.String() != "invalid" {
+		return fmt.Sprintf("%v does not exist", e.Handle)
+	}
+	return fmt.Sprintf("unexpected HTTP response (%v): %v", e.StatusCode, e.Status)
+}
+
+func NewFactory() location.Factory {
+	return location.NewHTTPBackendFactory("webdav", ParseConfig, StripPassword, Create, Open)
+}
+
+// Open opens the WebDAV backend with the given config.
+func Open(_ context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
+	u := *cfg.URL
+	// credentials are added by the authTransport, do not leak them to the
+	// server via basic authentication
+	u.User = nil
+
+	if cfg.URL.User != nil {
+		password, _ := cfg.URL.User.Password()
+		auth, err := newAuthTransport(rt, cfg.URL.User.Username(), password, cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+		rt = auth
+	}
+
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if basePath == "" {
+		basePath = "/"
+	}
+	be := &Backend{
+		url:         &u,
+		basePath:    basePath,
+		client:      http.Client{Transport: rt},
+		Layout:      layout.NewDefaultLayout(basePath, path.Join),
+		connections: cfg.Connections,
+	}
+
+	return be, nil
+}
+
+// Create creates all collections of the repository on the WebDAV server.
+func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
+	be, err := Open(ctx, cfg, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = be.Stat(ctx, backend.Handle{Type: backend.ConfigFile})
+	if err == nil {
+		return nil, errors.New("config file already exists")
+	}
+
+	if be.basePath != "/" {
+		if err := be.mkcolAll(ctx, be.basePath); err != nil {
+			return nil, err
+		}
+	}
+
+	// Run multiple MKCOL requests concurrently, creating 256 data
+	// subdirectories one by one is slow on high-latency links.
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(int(cfg.Connections))
+	for _, d := range be.Paths() {
+		d := d
+		g.Go(func() error {
+			return be.mkcolAll(gctx, d)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return be, nil
+}
+
+func drainAndClose(resp *http.Response) error {
+	_, err := io.Copy(io.Discard, resp.Body)
+	cerr := resp.Body.Close()
+
+	// return first error
+	if err != nil {
+		return errors.Errorf("drain: %w", err)
+	}
+	return cerr
+}
+
+// urlFor returns the URL for the path p on the server.
+func (b *Backend) urlFor(p string) string {
+	u := *b.url
+	u.Path = p
+	u.RawPath = ""
+	return u.String()
+}
+
+func (b *Backend) do(ctx context.Context, method, p string, body io.Reader, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.urlFor(p), body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "client.Do")
+	}
+	return resp, nil
+}
+
+// mkcol creates the collection at p. It is not an error if the collection
+// already exists.
+func (b *Backend) mkcol(ctx context.Context, p string) error {
+	resp, err := b.do(ctx, "MKCOL", p+"/", nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := drainAndClose(resp); err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+		return nil
+	case http.StatusMethodNotAllowed:
+		// MKCOL is not allowed on existing resources
+		return nil
+	default:
+		return &webdavError{backend.Handle{}, resp.StatusCode, resp.Status}
+	}
+}
+
+// mkcolAll creates the collection at p and all missing parents.
+func (b *Backend) mkcolAll(ctx context.Context, p string) error {
+	err := b.mkcol(ctx, p)
+	if !isStatus(err, http.StatusConflict) {
+		return err
+	}
+
+	// the parent collection is missing
+	parent := path.Dir(p)
+	if parent == p || parent == "/" || parent == "." {
+		return err
+	}
+	if err := b.mkcolAll(ctx, parent); err != nil {
+		return err
+	}
+	return b.mkcol(ctx, p)
+}
+
+func isStatus(err error, code int) bool {
+	var e *webdavError
+	return errors.As(err, &e) && e.StatusCode == code
+}
+
+func (b *Backend) Connections() uint {
+	return b.connections
+}
+
+// Hasher may return a hash function for calculating a content hash for the backend
+func (b *Backend) Hasher() hash.Hash {
+	return nil
+}
+
+// HasAtomicReplace returns whether Save() can atomically replace files
+func (b *Backend) HasAtomicReplace() bool {
+	// not guaranteed by the WebDAV protocol
+	return false
+}
+
+// Save stores data in the backend at the handle.
+func (b *Backend) Save(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
+	err := b.put(ctx, h, rd)
+	if isStatus(err, http.StatusConflict) {
+		// the collection was removed, recreate it
+		debug.Log("recreating collection for %v", h)
+		if err := b.mkcolAll(ctx, path.Dir(b.Filename(h))); err != nil {
+			return err
+		}
+		if err := rd.Rewind(); err != nil {
+			return err
+		}
+		err = b.put(ctx, h, rd)
+	}
+	return err
+}
+
+func (b *Backend) put(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// make sure that client.Do() cannot close the reader by wrapping it
+	req, err := http.NewRequestWithContext(ctx,
+		http.MethodPut, b.urlFor(b.Filename(h)), io.NopCloser(rd))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		if err := rd.Rewind(); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(rd), nil
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	// explicitly set the content length, this prevents chunked encoding and
+	// let's the server know what's coming.
+	req.ContentLength = rd.Length()
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := drainAndClose(resp); err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	default:
+		return &webdavError{h, resp.StatusCode, resp.Status}
+	}
+}
+
+// IsNotExist returns true if the error was caused by a non-existing file.
+func (b *Backend) IsNotExist(err error) bool {
+	return isStatus(err, http.StatusNotFound)
+}
+
+func (b *Backend) IsPermanentError(err error) bool {
+	if b.IsNotExist(err) {
+		return true
+	}
+
+	var e *webdavError
+	if errors.As(err, &e) {
+		if e.StatusCode == http.StatusRequestedRangeNotSatisfiable || e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (b *Backend) Load(ctx context.Context, h backend.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	return util.DefaultLoad(ctx, h, length, offset, b.openReader, fn)
+}
+
+func (b *Backend) openReader(ctx context.Context, h backend.Handle, length int, offset int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+int64(length)-1)
+	}
+
+	resp, err := b.do(ctx, http.MethodGet, b.Filename(h), nil, map[string]string{"Range": byteRange})
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the server ignored the range header and returns the whole file
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+				_ = resp.Body.Close()
+				return nil, errors.Wrap(err, "skip")
+			}
+		}
+		if resp.ContentLength >= 0 {
+			resp.ContentLength -= offset
+		}
+	default:
+		_ = drainAndClose(resp)
+		return nil, &webdavError{h, resp.StatusCode, resp.Status}
+	}
+
+	if length > 0 {
+		if feature.Flag.Enabled(feature.BackendErrorRedesign) && resp.ContentLength >= 0 && resp.ContentLength < int64(length) {
+			_ = resp.Body.Close()
+			return nil, &webdavError{h, http.StatusRequestedRangeNotSatisfiable, "partial out of bounds read"}
+		}
+		return util.LimitReadCloser(resp.Body, int64(length)), nil
+	}
+
+	return resp.Body, nil
+}
+
+// Stat returns information about a blob.
+func (b *Backend) Stat(ctx context.Context, h backend.Handle) (backend.FileInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, b.Filename(h), nil, nil)
+	if err != nil {
+		return backend.FileInfo{}, err
+	}
+
+	if err = drainAndClose(resp); err != nil {
+		return backend.FileInfo{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return backend.FileInfo{}, &webdavError{h, resp.StatusCode, resp.Status}
+	}
+
+	if resp.ContentLength < 0 {
+		return backend.FileInfo{}, errors.New("negative content length")
+	}
+
+	bi := backend.FileInfo{
+		Size: resp.ContentLength,
+		Name: h.Name,
+	}
+
+	return bi, nil
+}
+
+// Remove removes the blob with the given name and type.
+func (b *Backend) Remove(ctx context.Context, h backend.Handle) error {
+	resp, err := b.do(ctx, http.MethodDelete, b.Filename(h), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = drainAndClose(resp); err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	default:
+		return &webdavError{h, resp.StatusCode, resp.Status}
+	}
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:resourcetype/>
+    <d:getcontentlength/>
+  </d:prop>
+</d:propfind>`
+
+// multistatus is the response to a PROPFIND request as described in RFC 4918.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ContentLength string `xml:"getcontentlength"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+type davEntry struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+// propfind lists the members of the collection at dir.
+func (b *Backend) propfind(ctx context.Context, t backend.FileType, dir string) ([]davEntry, error) {
+	resp, err := b.do(ctx, "PROPFIND", dir, strings.NewReader(propfindBody), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		// ignore missing collections
+		return nil, drainAndClose(resp)
+	}
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		_ = drainAndClose(resp)
+		return nil, &webdavError{backend.Handle{Type: t}, resp.StatusCode, resp.Status}
+	}
+
+	var ms multistatus
+	err = xml.NewDecoder(resp.Body).Decode(&ms)
+	if cerr := drainAndClose(resp); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Decode")
+	}
+
+	var entries []davEntry
+	for _, r := range ms.Responses {
+		u, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid href")
+		}
+		p := strings.TrimSuffix(u.Path, "/")
+		if p == strings.TrimSuffix(dir, "/") {
+			// the collection itself
+			continue
+		}
+
+		entry := davEntry{name: path.Base(p)}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				entry.isDir = true
+			}
+			if ps.Prop.ContentLength != "" {
+				entry.size, err = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+				if err != nil {
+					return nil, errors.Wrap(err, "invalid content length")
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// List runs fn for each file in the backend which has the type t. When an
+// error occurs (or fn returns an error), List stops and returns it.
+func (b *Backend) List(ctx context.Context, t backend.FileType, fn func(backend.FileInfo) error) error {
+	dir := b.Dirname(backend.Handle{Type: t})
+	entries, err := b.propfind(ctx, t, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !entry.isDir {
+			if err := fn(backend.FileInfo{Name: entry.name, Size: entry.size}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// pack files are stored in subdirectories
+		if t != backend.PackFile {
+			continue
+		}
+		subentries, err := b.propfind(ctx, t, path.Join(dir, entry.name)+"/")
+		if err != nil {
+			return err
+		}
+		for _, sub := range subentries {
+			if sub.isDir {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := fn(backend.FileInfo{Name: sub.name, Size: sub.size}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Close closes all open files.
+func (b *Backend) Close() error {
+	// this does not need to do anything, all open files are closed within the
+	// same function.
+	return nil
+}
+
+// Delete removes all data in the backend.
+func (b *Backend) Delete(ctx context.Context) error {
+	return util.DefaultDelete(ctx, b)
+}
+
+// Warmup not implemented
+func (b *Backend) Warmup(_ context.Context, _ []backend.Handle) ([]backend.Handle, error) {
+	return []backend.Handle{}, nil
+}
+func (b *Backend) WarmupWait(_ context.Context, _ []backend.Handle) error { return nil }
@@ -0,0 +1,65 @@
+package webdav_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/backend/webdav"
+	dav "golang.org/x/net/webdav"
+)
+
+func runWebDAVServer(t testing.TB, username, password string) *url.URL {
+	handler := &dav.Handler{
+		FileSystem: dav.NewMemFS(),
+		LockSystem: dav.NewMemLS(),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != username || pass != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="restic"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.User = url.UserPassword(username, password)
+	return u
+}
+
+func newTestSuite(t testing.TB) *test.Suite[webdav.Config] {
+	u := runWebDAVServer(t, "user", "secret")
+	var repos atomic.Int32
+
+	return &test.Suite[webdav.Config]{
+		// NewConfig returns a config for a new temporary backend that will be used in tests.
+		NewConfig: func() (*webdav.Config, error) {
+			cfg, err := webdav.ParseConfig(fmt.Sprintf("webdav:%s/backup/repo-%d", u, repos.Add(1)))
+			if err != nil {
+				return nil, err
+			}
+			cfg.Connections = 2
+			return cfg, nil
+		},
+
+		Factory: webdav.NewFactory(),
+	}
+}
+
+func TestBackendWebDAV(t *testing.T) {
+	newTestSuite(t).RunTests(t)
+}
+
+func BenchmarkBackendWebDAV(t *testing.B) {
+	newTestSuite(t).RunBenchmarks(t)
+}
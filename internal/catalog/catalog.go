@@ -0,0 +1,364 @@
+// Package catalog maintains a local, searchable listing of the files contained
+// in the snapshots of a repository. Searching the catalog does not require
+// loading any trees from the repository, which makes it much faster than
+// walking all snapshots for large repositories.
+//
+// The catalog stores one file per snapshot in a local directory. Each file is
+// compressed using gzip and contains a header describing the snapshot,
+// followed by one JSON object per line for each file, directory or other item
+// in the snapshot. Searches use a path index built from these files, which
+// lists each distinct path once with the snapshots containing it. The catalog
+// is not encrypted, it reveals the names of all files in the repository to
+// anyone who can read the directory.
+package catalog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+)
+
+// fileExt is the extension of the files in the catalog directory.
+const fileExt = ".catalog"
+
+// formatVersion is incremented for incompatible changes of the file format.
+// Files with a different version are rebuilt by Update.
+const formatVersion = 1
+
+// header is the first line of each catalog file.
+type header struct {
+	Version    int              `json:"version"`
+	ID         restic.ID        `json:"id"`
+	Snapshot   *restic.Snapshot `json:"snapshot"`
+	ContentIDs bool             `json:"content_ids"`
+}
+
+// Snapshot is a snapshot contained in the catalog.
+type Snapshot struct {
+	*restic.Snapshot
+	// ContentIDs is set if the entries of the snapshot contain content IDs.
+	ContentIDs bool
+	id         restic.ID
+}
+
+// ID returns the ID of the snapshot.
+func (sn Snapshot) ID() restic.ID {
+	return sn.id
+}
+
+// Entry describes an item of a snapshot.
+type Entry struct {
+	Path    string          `json:"path"`
+	Type    restic.NodeType `json:"type"`
+	Size    uint64          `json:"size,omitempty"`
+	ModTime time.Time       `json:"mtime"`
+	// ContentID identifies the content of a file, see ContentID.
+	ContentID *restic.ID `json:"content_id,omitempty"`
+}
+
+// ContentID returns an ID identifying the content of a file consisting of the
+// given blobs. Files with the same content ID within a repository contain the
+// same data.
+func ContentID(content restic.IDs) restic.ID {
+	h := sha256.New()
+	for _, id := range content {
+		_, _ = h.Write(id[:])
+	}
+	var id restic.ID
+	h.Sum(id[:0])
+	return id
+}
+
+// Catalog is the catalog of a repository stored in a local directory.
+type Catalog struct {
+	dir string
+}
+
+// Open opens the catalog in dir, which is created if it does not exist yet.
+func Open(dir string) (*Catalog, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create catalog directory: %w", err)
+	}
+	return &Catalog{dir: dir}, nil
+}
+
+func (c *Catalog) filename(id restic.ID) string {
+	return filepath.Join(c.dir, id.String()+fileExt)
+}
+
+// reader reads a catalog file.
+type reader struct {
+	f   *os.File
+	gz  *gzip.Reader
+	dec *json.Decoder
+}
+
+func (c *Catalog) open(id restic.ID) (*reader, header, error) {
+	f, err := os.Open(c.filename(id))
+	if err != nil {
+		return nil, header{}, err
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		_ = f.Close()
+		return nil, header{}, fmt.Errorf("catalog file for snapshot %v: %w", id.Str(), err)
+	}
+
+	r := &reader{f: f, gz: gz, dec: json.NewDecoder(gz)}
+	var h header
+	err = r.dec.Decode(&h)
+	if err == nil && h.Snapshot == nil {
+		err = errors.New("header contains no snapshot")
+	}
+	if err != nil {
+		_ = r.Close()
+		return nil, header{}, fmt.Errorf("catalog file for snapshot %v: %w", id.Str(), err)
+	}
+	return r, h, nil
+}
+
+// Next returns the next entry, or io.EOF at the end of the file.
+func (r *reader) Next() (Entry, error) {
+	var e Entry
+	err := r.dec.Decode(&e)
+	return e, err
+}
+
+func (r *reader) Close() error {
+	err := r.gz.Close()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Snapshots returns the snapshots contained in the catalog, sorted by time.
+func (c *Catalog) Snapshots() ([]Snapshot, error) {
+	ids, err := c.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Snapshot
+	for _, id := range ids {
+		r, h, err := c.open(id)
+		if err != nil {
+			// Update replaces damaged files
+			debug.Log("ignoring catalog file: %v", err)
+			continue
+		}
+		_ = r.Close()
+		if h.Version != formatVersion {
+			debug.Log("ignoring catalog file %v with version %d", id, h.Version)
+			continue
+		}
+		list = append(list, Snapshot{Snapshot: h.Snapshot, ContentIDs: h.ContentIDs, id: id})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+	return list, nil
+}
+
+// list returns the IDs of all snapshots in the catalog directory.
+func (c *Catalog) list() (restic.IDs, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids restic.IDs
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), fileExt)
+		if !ok {
+			continue
+		}
+		id, err := restic.ParseID(name)
+		if err != nil {
+			debug.Log("ignoring file %v in catalog", entry.Name())
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// add walks the tree of the snapshot and adds all its entries to the
+// catalog. If contentIDs is set, the content ID of each file is stored as
+// well. It returns the number of entries.
+func (c *Catalog) add(ctx context.Context, repo restic.BlobLoader, sn *restic.Snapshot, contentIDs bool) (int, error) {
+	if sn.Tree == nil {
+		return 0, errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+
+	f, err := os.CreateTemp(c.dir, "tmp-")
+	if err != nil {
+		return 0, err
+	}
+	// ignore error, the file does not exist after a successful rename
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	bw := bufio.NewWriter(f)
+	gz := gzip.NewWriter(bw)
+	enc := json.NewEncoder(gz)
+
+	err = enc.Encode(header{Version: formatVersion, ID: *sn.ID(), Snapshot: sn, ContentIDs: contentIDs})
+	if err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+
+	count := 0
+	err = walker.Walk(ctx, repo, *sn.Tree, walker.WalkVisitor{
+		ProcessNode: func(_ restic.ID, nodepath string, node *restic.Node, err error) error {
+			if err != nil {
+				return err
+			}
+			if node == nil {
+				return nil
+			}
+
+			e := Entry{Path: nodepath, Type: node.Type, ModTime: node.ModTime}
+			if node.Type == restic.NodeTypeFile {
+				e.Size = node.Size
+				if contentIDs {
+					id := ContentID(node.Content)
+					e.ContentID = &id
+				}
+			}
+			count++
+			return enc.Encode(e)
+		},
+	})
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Rename(f.Name(), c.filename(*sn.ID()))
+	if err != nil {
+		return 0, err
+	}
+	debug.Log("added snapshot %v with %d entries", sn.ID(), count)
+	return count, nil
+}
+
+// remove deletes a snapshot from the catalog.
+func (c *Catalog) remove(id restic.ID) error {
+	err := os.Remove(c.filename(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Query selects the entries returned by Search. Empty fields match all
+// entries.
+type Query struct {
+	// Patterns are matched against the paths of the entries, see
+	// filter.Match. An entry is selected if it matches any pattern.
+	Patterns        []string
+	CaseInsensitive bool
+	// ContentID selects files with the given content.
+	ContentID *restic.ID
+
+	// Snapshots selects the snapshots which are searched.
+	Snapshots restic.SnapshotFilter
+}
+
+func (q *Query) matchesPath(p string) (bool, error) {
+	if len(q.Patterns) == 0 {
+		return true, nil
+	}
+
+	if q.CaseInsensitive {
+		p = strings.ToLower(p)
+	}
+	for _, pattern := range q.Patterns {
+		matched, err := filter.Match(pattern, p)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+// Update synchronizes the catalog with the snapshots of the repository:
+// snapshots missing in the catalog are added and snapshots which no longer
+// exist are removed. Snapshots are also added again if content IDs are
+// requested but missing, or if their catalog file uses an outdated format.
+// The callback added is called after adding each snapshot.
+func (c *Catalog) Update(ctx context.Context, repo restic.BlobLoader, snapshots []*restic.Snapshot, contentIDs bool, added func(sn *restic.Snapshot, entries int)) (removed int, err error) {
+	current, err := c.Snapshots()
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[restic.ID]Snapshot, len(current))
+	for _, sn := range current {
+		known[sn.id] = sn
+	}
+
+	wanted := restic.NewIDSet()
+	for _, sn := range snapshots {
+		id := *sn.ID()
+		wanted.Insert(id)
+		if existing, ok := known[id]; ok && (existing.ContentIDs || !contentIDs) {
+			continue
+		}
+
+		entries, err := c.add(ctx, repo, sn, contentIDs)
+		if err != nil {
+			return removed, fmt.Errorf("adding snapshot %v to the catalog failed: %w", id.Str(), err)
+		}
+		if added != nil {
+			added(sn, entries)
+		}
+	}
+
+	ids, err := c.list()
+	if err != nil {
+		return removed, err
+	}
+	for _, id := range ids {
+		if wanted.Has(id) {
+			continue
+		}
+		if err := c.remove(id); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	current, err = c.Snapshots()
+	if err != nil {
+		return removed, err
+	}
+	if err := c.updateIndex(ctx, current); err != nil {
+		return removed, fmt.Errorf("updating the catalog index failed: %w", err)
+	}
+	return removed, nil
+}
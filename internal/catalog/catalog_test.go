@@ -0,0 +1,174 @@
+package catalog_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/catalog"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/walker"
+)
+
+// listFiles returns the paths of all files in the snapshot.
+func listFiles(t *testing.T, repo restic.BlobLoader, sn *restic.Snapshot) []string {
+	var files []string
+	rtest.OK(t, walker.Walk(context.TODO(), repo, *sn.Tree, walker.WalkVisitor{
+		ProcessNode: func(_ restic.ID, nodepath string, node *restic.Node, err error) error {
+			if err != nil {
+				return err
+			}
+			if node != nil && node.Type == restic.NodeTypeFile {
+				files = append(files, nodepath)
+			}
+			return nil
+		},
+	}))
+	sort.Strings(files)
+	return files
+}
+
+func search(t *testing.T, c *catalog.Catalog, q catalog.Query) map[restic.ID][]string {
+	result := make(map[restic.ID][]string)
+	rtest.OK(t, c.Search(context.TODO(), q, func(sn catalog.Snapshot, e catalog.Entry) error {
+		result[sn.ID()] = append(result[sn.ID()], e.Path)
+		return nil
+	}))
+	for _, paths := range result {
+		sort.Strings(paths)
+	}
+	return result
+}
+
+func TestCatalog(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.TODO()
+
+	sn1 := restic.TestCreateSnapshot(t, repo, time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC), 3)
+	sn2 := restic.TestCreateSnapshot(t, repo, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), 3)
+	files1 := listFiles(t, repo, sn1)
+	files2 := listFiles(t, repo, sn2)
+	rtest.Assert(t, len(files1) > 0 && len(files2) > 0, "test snapshots contain no files")
+
+	dir := filepath.Join(rtest.TempDir(t), "catalog")
+	c, err := catalog.Open(dir)
+	rtest.OK(t, err)
+
+	var added []restic.ID
+	removed, err := c.Update(ctx, repo, []*restic.Snapshot{sn1, sn2}, false, func(sn *restic.Snapshot, _ int) {
+		added = append(added, *sn.ID())
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, removed)
+	rtest.Equals(t, []restic.ID{*sn1.ID(), *sn2.ID()}, added)
+
+	snapshots, err := c.Snapshots()
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(snapshots))
+	rtest.Equals(t, *sn1.ID(), snapshots[0].ID())
+	rtest.Equals(t, "foo", snapshots[0].Hostname)
+
+	result := search(t, c, catalog.Query{Patterns: []string{"file-*"}})
+	rtest.Equals(t, map[restic.ID][]string{*sn1.ID(): files1, *sn2.ID(): files2}, result)
+
+	result = search(t, c, catalog.Query{Patterns: []string{"FILE-*"}, CaseInsensitive: true,
+		Snapshots: restic.SnapshotFilter{Until: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}})
+	rtest.Equals(t, map[restic.ID][]string{*sn1.ID(): files1}, result)
+
+	result = search(t, c, catalog.Query{Patterns: []string{"file-*"}, Snapshots: restic.SnapshotFilter{Hosts: []string{"other"}}})
+	rtest.Equals(t, 0, len(result))
+
+	// content IDs are only available after updating the catalog
+	result = search(t, c, catalog.Query{ContentID: &restic.ID{}})
+	rtest.Equals(t, 0, len(result))
+
+	added = nil
+	removed, err = c.Update(ctx, repo, []*restic.Snapshot{sn2}, true, func(sn *restic.Snapshot, _ int) {
+		added = append(added, *sn.ID())
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, removed)
+	rtest.Equals(t, []restic.ID{*sn2.ID()}, added)
+
+	var contentID *restic.ID
+	var path string
+	rtest.OK(t, c.Search(ctx, catalog.Query{Patterns: []string{files2[0]}}, func(_ catalog.Snapshot, e catalog.Entry) error {
+		contentID, path = e.ContentID, e.Path
+		return nil
+	}))
+	rtest.Assert(t, contentID != nil, "entry has no content ID")
+	result = search(t, c, catalog.Query{ContentID: contentID})
+	rtest.Assert(t, slices.Contains(result[*sn2.ID()], path), "file %v not found by its content ID, got %v", path, result)
+
+	// damaged files are replaced
+	rtest.OK(t, os.WriteFile(filepath.Join(dir, sn2.ID().String()+".catalog"), []byte("damaged"), 0600))
+	added = nil
+	_, err = c.Update(ctx, repo, []*restic.Snapshot{sn2}, true, func(sn *restic.Snapshot, _ int) {
+		added = append(added, *sn.ID())
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, []restic.ID{*sn2.ID()}, added)
+}
+
+func TestCatalogIndex(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.TODO()
+
+	sn1 := restic.TestCreateSnapshot(t, repo, time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC), 3)
+	// the second snapshot contains the same files
+	sn, err := restic.NewSnapshot([]string{"/"}, nil, "foo", time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC))
+	rtest.OK(t, err)
+	sn.Tree = sn1.Tree
+	id2, err := restic.SaveSnapshot(ctx, repo, sn)
+	rtest.OK(t, err)
+	sn2, err := restic.LoadSnapshot(ctx, repo, id2)
+	rtest.OK(t, err)
+	files := listFiles(t, repo, sn1)
+
+	dir := filepath.Join(rtest.TempDir(t), "catalog")
+	c, err := catalog.Open(dir)
+	rtest.OK(t, err)
+
+	// the second snapshot is merged into the existing index
+	_, err = c.Update(ctx, repo, []*restic.Snapshot{sn1}, false, nil)
+	rtest.OK(t, err)
+	_, err = c.Update(ctx, repo, []*restic.Snapshot{sn2, sn1}, false, nil)
+	rtest.OK(t, err)
+
+	type match struct {
+		sn   restic.ID
+		path string
+	}
+	var matches []match
+	rtest.OK(t, c.Search(ctx, catalog.Query{Patterns: []string{"file-*"}}, func(sn catalog.Snapshot, e catalog.Entry) error {
+		matches = append(matches, match{sn.ID(), e.Path})
+		return nil
+	}))
+	var expected []match
+	for _, file := range files {
+		expected = append(expected, match{*sn1.ID(), file}, match{*sn2.ID(), file})
+	}
+	rtest.Equals(t, expected, matches)
+
+	// removed snapshots are dropped from the index
+	_, err = c.Update(ctx, repo, []*restic.Snapshot{sn2}, false, nil)
+	rtest.OK(t, err)
+	result := search(t, c, catalog.Query{Patterns: []string{"file-*"}})
+	rtest.Equals(t, map[restic.ID][]string{*sn2.ID(): files}, result)
+
+	// a missing index is rebuilt
+	rtest.OK(t, os.Remove(filepath.Join(dir, "paths.index")))
+	err = c.Search(ctx, catalog.Query{}, func(catalog.Snapshot, catalog.Entry) error { return nil })
+	rtest.Assert(t, errors.Is(err, catalog.ErrIndexOutdated), "unexpected error %v", err)
+	_, err = c.Update(ctx, repo, []*restic.Snapshot{sn2}, false, nil)
+	rtest.OK(t, err)
+	result = search(t, c, catalog.Query{Patterns: []string{"file-*"}})
+	rtest.Equals(t, map[restic.ID][]string{*sn2.ID(): files}, result)
+}
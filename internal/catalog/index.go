@@ -0,0 +1,531 @@
+package catalog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// indexFile is the name of the path index in the catalog directory.
+const indexFile = "paths.index"
+
+// indexFormatVersion is incremented for incompatible changes of the index format.
+// An index with a different version is rebuilt by Update.
+const indexFormatVersion = 1
+
+// maxBatchEntries is the number of entries of new snapshots which are sorted
+// in memory before they are merged into the index.
+const maxBatchEntries = 1 << 20
+
+// ErrIndexOutdated is returned by Search if the index does not match the
+// snapshots in the catalog, for example because Update was interrupted.
+var ErrIndexOutdated = errors.New("the catalog index is missing or outdated")
+
+// The path index contains each distinct path of all snapshots in the catalog
+// exactly once. It is a gzip-compressed file starting with indexHeader,
+// followed by one indexRecord per line, sorted by path. Each record lists the
+// versions of the item at that path, and for each version the snapshots
+// which contain it. As most items do not change between snapshots, the index
+// grows with the number of distinct paths and versions instead of the number
+// of snapshots, and Search matches each path only once.
+
+// indexHeader is the first line of the index.
+type indexHeader struct {
+	Version int `json:"version"`
+	// Snapshots are sorted by time, versions refer to them by position.
+	Snapshots []indexSnapshot `json:"snapshots"`
+}
+
+type indexSnapshot struct {
+	ID         restic.ID        `json:"id"`
+	Snapshot   *restic.Snapshot `json:"snapshot"`
+	ContentIDs bool             `json:"content_ids"`
+}
+
+// indexRecord contains all versions of the item at Path.
+type indexRecord struct {
+	Path     string         `json:"path"`
+	Versions []indexVersion `json:"versions"`
+}
+
+// indexVersion is an item which is identical in all listed snapshots.
+type indexVersion struct {
+	Type      restic.NodeType `json:"type"`
+	Size      uint64          `json:"size,omitempty"`
+	ModTime   time.Time       `json:"mtime"`
+	ContentID *restic.ID      `json:"content_id,omitempty"`
+	// Snapshots are positions in indexHeader.Snapshots in ascending order.
+	Snapshots []int `json:"snapshots"`
+}
+
+func (v *indexVersion) entry(path string) Entry {
+	return Entry{Path: path, Type: v.Type, Size: v.Size, ModTime: v.ModTime, ContentID: v.ContentID}
+}
+
+func (v *indexVersion) matches(e Entry) bool {
+	if v.Type != e.Type || v.Size != e.Size || !v.ModTime.Equal(e.ModTime) {
+		return false
+	}
+	if v.ContentID == nil || e.ContentID == nil {
+		return v.ContentID == nil && e.ContentID == nil
+	}
+	return v.ContentID.Equal(*e.ContentID)
+}
+
+// indexReader reads the records of the index. Versions are only decoded for
+// the records requested by the caller.
+type indexReader struct {
+	f   *os.File
+	gz  *gzip.Reader
+	dec *json.Decoder
+}
+
+// rawRecord is an indexRecord with undecoded versions.
+type rawRecord struct {
+	Path     string          `json:"path"`
+	Versions json.RawMessage `json:"versions"`
+}
+
+func (r rawRecord) decode() (indexRecord, error) {
+	rec := indexRecord{Path: r.Path}
+	err := json.Unmarshal(r.Versions, &rec.Versions)
+	return rec, err
+}
+
+// openIndex opens the index. It returns os.ErrNotExist if there is no index
+// and ErrIndexOutdated if the index uses a different format.
+func (c *Catalog) openIndex() (*indexReader, indexHeader, error) {
+	f, err := os.Open(filepath.Join(c.dir, indexFile))
+	if err != nil {
+		return nil, indexHeader{}, err
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		_ = f.Close()
+		return nil, indexHeader{}, fmt.Errorf("catalog index: %w", err)
+	}
+
+	r := &indexReader{f: f, gz: gz, dec: json.NewDecoder(gz)}
+	var h indexHeader
+	err = r.dec.Decode(&h)
+	if err == nil && h.Version != indexFormatVersion {
+		err = ErrIndexOutdated
+	}
+	if err != nil {
+		_ = r.Close()
+		return nil, indexHeader{}, fmt.Errorf("catalog index: %w", err)
+	}
+	return r, h, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the index.
+func (r *indexReader) Next() (rawRecord, error) {
+	var rec rawRecord
+	err := r.dec.Decode(&rec)
+	return rec, err
+}
+
+func (r *indexReader) Close() error {
+	err := r.gz.Close()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// indexWriter writes a new index, which replaces the current one on Close.
+type indexWriter struct {
+	dir string
+	f   *os.File
+	bw  *bufio.Writer
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+func (c *Catalog) createIndex(h indexHeader) (*indexWriter, error) {
+	f, err := os.CreateTemp(c.dir, "tmp-")
+	if err != nil {
+		return nil, err
+	}
+	w := &indexWriter{dir: c.dir, f: f, bw: bufio.NewWriter(f)}
+	w.gz = gzip.NewWriter(w.bw)
+	w.enc = json.NewEncoder(w.gz)
+
+	h.Version = indexFormatVersion
+	if err := w.enc.Encode(h); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *indexWriter) Write(rec indexRecord) error {
+	return w.enc.Encode(rec)
+}
+
+// Abort removes the unfinished index.
+func (w *indexWriter) Abort() {
+	_ = w.f.Close()
+	_ = os.Remove(w.f.Name())
+}
+
+// Close finishes the index and replaces the current one.
+func (w *indexWriter) Close() error {
+	err := w.gz.Close()
+	if err == nil {
+		err = w.bw.Flush()
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(w.f.Name(), filepath.Join(w.dir, indexFile))
+	}
+	if err != nil {
+		_ = os.Remove(w.f.Name())
+	}
+	return err
+}
+
+// batchEntry is an entry of a snapshot which is added to the index.
+type batchEntry struct {
+	Entry
+	// sn is the position of the snapshot in the new index header.
+	sn int
+}
+
+// updateIndex brings the index up to date with the snapshots in the catalog.
+// Snapshots which are already contained in the current index are kept,
+// snapshots which no longer exist are dropped and all others are read from
+// their catalog files and merged into the index in batches.
+func (c *Catalog) updateIndex(ctx context.Context, snapshots []Snapshot) error {
+	h := indexHeader{Snapshots: make([]indexSnapshot, 0, len(snapshots))}
+	for _, sn := range snapshots {
+		h.Snapshots = append(h.Snapshots, indexSnapshot{ID: sn.id, Snapshot: sn.Snapshot, ContentIDs: sn.ContentIDs})
+	}
+	pos := make(map[restic.ID]int, len(snapshots))
+	for i, sn := range h.Snapshots {
+		pos[sn.ID] = i
+	}
+
+	// remap[i] is the new position of snapshot i of the current index, or -1
+	// if it is dropped
+	var remap []int
+	kept := restic.NewIDSet()
+	r, old, err := c.openIndex()
+	switch {
+	case err == nil:
+		_ = r.Close()
+		remap = make([]int, len(old.Snapshots))
+		for i, sn := range old.Snapshots {
+			remap[i] = -1
+			// snapshots added again to store content IDs are replaced
+			if p, ok := pos[sn.ID]; ok && h.Snapshots[p].ContentIDs == sn.ContentIDs {
+				remap[i] = p
+				kept.Insert(sn.ID)
+			}
+		}
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		debug.Log("rebuilding catalog index: %v", err)
+	}
+
+	unchanged := remap != nil && len(old.Snapshots) == len(h.Snapshots)
+	for i, p := range remap {
+		unchanged = unchanged && p == i
+	}
+	if unchanged {
+		return nil
+	}
+
+	var batch []batchEntry
+	first := true
+	for _, sn := range snapshots {
+		if kept.Has(sn.id) {
+			continue
+		}
+		batch, err = c.appendEntries(ctx, batch, sn, pos[sn.id])
+		if err != nil {
+			return err
+		}
+		if len(batch) >= maxBatchEntries {
+			if err := c.mergeIndex(ctx, h, remap, batch); err != nil {
+				return err
+			}
+			// the written index already uses the new positions
+			remap = identity(len(h.Snapshots))
+			batch = batch[:0]
+			first = false
+		}
+	}
+	if len(batch) > 0 || first {
+		return c.mergeIndex(ctx, h, remap, batch)
+	}
+	return nil
+}
+
+func identity(n int) []int {
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = i
+	}
+	return ids
+}
+
+// appendEntries appends the entries of the catalog file of the snapshot.
+func (c *Catalog) appendEntries(ctx context.Context, batch []batchEntry, sn Snapshot, pos int) ([]batchEntry, error) {
+	r, _, err := c.open(sn.id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		e, err := r.Next()
+		if err == io.EOF {
+			return batch, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("catalog file for snapshot %v: %w", sn.id.Str(), err)
+		}
+		batch = append(batch, batchEntry{Entry: e, sn: pos})
+	}
+}
+
+// mergeIndex writes a new index with the header h, which contains the
+// records of the current index and the entries in batch. Positions of
+// snapshots in the current index are translated using remap, if remap is
+// nil the current index is ignored.
+func (c *Catalog) mergeIndex(ctx context.Context, h indexHeader, remap []int, batch []batchEntry) error {
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].Path < batch[j].Path
+	})
+
+	var r *indexReader
+	if remap != nil {
+		var err error
+		r, _, err = c.openIndex()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = r.Close() }()
+	}
+
+	w, err := c.createIndex(h)
+	if err != nil {
+		return err
+	}
+
+	next := func() (indexRecord, bool, error) {
+		if r == nil {
+			return indexRecord{}, false, nil
+		}
+		for {
+			raw, err := r.Next()
+			if err == io.EOF {
+				return indexRecord{}, false, nil
+			}
+			if err != nil {
+				return indexRecord{}, false, fmt.Errorf("catalog index: %w", err)
+			}
+			rec, err := raw.decode()
+			if err != nil {
+				return indexRecord{}, false, fmt.Errorf("catalog index: %w", err)
+			}
+			if rec.remap(remap) {
+				return rec, true, nil
+			}
+		}
+	}
+
+	err = func() error {
+		rec, ok, err := next()
+		for err == nil && (ok || len(batch) > 0) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			var out indexRecord
+			switch {
+			case ok && (len(batch) == 0 || rec.Path < batch[0].Path):
+				out = rec
+				rec, ok, err = next()
+			case ok && rec.Path == batch[0].Path:
+				out = rec
+				batch = out.add(batch)
+				rec, ok, err = next()
+			default:
+				out = indexRecord{Path: batch[0].Path}
+				batch = out.add(batch)
+			}
+			if err == nil {
+				err = w.Write(out)
+			}
+		}
+		return err
+	}()
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	debug.Log("wrote catalog index with %d snapshots", len(h.Snapshots))
+	return w.Close()
+}
+
+// remap translates the snapshot positions of all versions and drops versions
+// without snapshots. It returns false if no version remains.
+func (rec *indexRecord) remap(remap []int) bool {
+	versions := rec.Versions[:0]
+	for _, v := range rec.Versions {
+		snapshots := v.Snapshots[:0]
+		for _, sn := range v.Snapshots {
+			if remap[sn] >= 0 {
+				snapshots = append(snapshots, remap[sn])
+			}
+		}
+		if len(snapshots) > 0 {
+			v.Snapshots = snapshots
+			versions = append(versions, v)
+		}
+	}
+	rec.Versions = versions
+	return len(versions) > 0
+}
+
+// add adds the leading entries of batch with the path of rec and returns the
+// remaining entries.
+func (rec *indexRecord) add(batch []batchEntry) []batchEntry {
+	for len(batch) > 0 && batch[0].Path == rec.Path {
+		e := batch[0]
+		batch = batch[1:]
+
+		found := false
+		for i := range rec.Versions {
+			if rec.Versions[i].matches(e.Entry) {
+				rec.Versions[i].Snapshots = append(rec.Versions[i].Snapshots, e.sn)
+				found = true
+				break
+			}
+		}
+		if !found {
+			rec.Versions = append(rec.Versions, indexVersion{Type: e.Type, Size: e.Size,
+				ModTime: e.ModTime, ContentID: e.ContentID, Snapshots: []int{e.sn}})
+		}
+	}
+	for _, v := range rec.Versions {
+		sort.Ints(v.Snapshots)
+	}
+	return batch
+}
+
+// Search calls fn for all entries matching the query. The entries are
+// ordered by path, and entries with the same path by the time of their
+// snapshots. Search returns ErrIndexOutdated if the index does not contain
+// exactly the snapshots of the catalog.
+func (c *Catalog) Search(ctx context.Context, q Query, fn func(sn Snapshot, e Entry) error) error {
+	if q.CaseInsensitive {
+		patterns := make([]string, 0, len(q.Patterns))
+		for _, pattern := range q.Patterns {
+			patterns = append(patterns, strings.ToLower(pattern))
+		}
+		q.Patterns = patterns
+	}
+
+	r, h, err := c.openIndex()
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrIndexOutdated) {
+		return ErrIndexOutdated
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	ids, err := c.list()
+	if err != nil {
+		return err
+	}
+	if len(ids) != len(h.Snapshots) {
+		return ErrIndexOutdated
+	}
+	known := restic.NewIDSet(ids...)
+
+	// selected[i] is set if the i-th snapshot is searched
+	selected := make([]bool, len(h.Snapshots))
+	snapshots := make([]Snapshot, len(h.Snapshots))
+	for i, sn := range h.Snapshots {
+		if !known.Has(sn.ID) {
+			return ErrIndexOutdated
+		}
+		snapshots[i] = Snapshot{Snapshot: sn.Snapshot, ContentIDs: sn.ContentIDs, id: sn.ID}
+		selected[i] = q.Snapshots.Matches(sn.Snapshot) && (q.ContentID == nil || sn.ContentIDs)
+	}
+
+	type match struct {
+		sn int
+		v  *indexVersion
+	}
+	var matches []match
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		raw, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("catalog index: %w", err)
+		}
+
+		// each path is only matched once for all snapshots
+		matched, err := q.matchesPath(raw.Path)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		rec, err := raw.decode()
+		if err != nil {
+			return fmt.Errorf("catalog index: %w", err)
+		}
+
+		matches = matches[:0]
+		for i := range rec.Versions {
+			v := &rec.Versions[i]
+			if q.ContentID != nil && (v.ContentID == nil || !v.ContentID.Equal(*q.ContentID)) {
+				continue
+			}
+			for _, sn := range v.Snapshots {
+				if selected[sn] {
+					matches = append(matches, match{sn: sn, v: v})
+				}
+			}
+		}
+		// snapshots are sorted by time in the header
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].sn < matches[j].sn
+		})
+		for _, m := range matches {
+			if err := fn(snapshots[m.sn], m.v.entry(rec.Path)); err != nil {
+				return err
+			}
+		}
+	}
+}
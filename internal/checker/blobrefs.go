@@ -0,0 +1,522 @@
+package checker
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// blobRefSet records which blobs are referenced by the snapshots. It is safe
+// for concurrent use.
+type blobRefSet interface {
+	Has(h restic.BlobHandle) bool
+	Insert(h restic.BlobHandle)
+	// HasOrInsert inserts h and reports whether it was already contained.
+	HasOrInsert(h restic.BlobHandle) bool
+	// Missing returns the handles which are not contained in the set.
+	Missing(handles restic.BlobHandles) restic.BlobHandles
+	Len() int
+	// Err returns the first error that occurred while accessing the set.
+	Err() error
+	Close() error
+}
+
+// memBlobRefs keeps the referenced blobs in memory.
+type memBlobRefs struct {
+	m     sync.Mutex
+	blobs restic.BlobSet
+}
+
+func newMemBlobRefs() *memBlobRefs {
+	return &memBlobRefs{blobs: restic.NewBlobSet()}
+}
+
+func (s *memBlobRefs) Has(h restic.BlobHandle) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.blobs.Has(h)
+}
+
+func (s *memBlobRefs) Insert(h restic.BlobHandle) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.blobs.Insert(h)
+}
+
+func (s *memBlobRefs) HasOrInsert(h restic.BlobHandle) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.blobs.Has(h) {
+		return true
+	}
+	s.blobs.Insert(h)
+	return false
+}
+
+func (s *memBlobRefs) Missing(handles restic.BlobHandles) restic.BlobHandles {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var missing restic.BlobHandles
+	for _, h := range handles {
+		if !s.blobs.Has(h) {
+			missing = append(missing, h)
+		}
+	}
+	return missing
+}
+
+func (s *memBlobRefs) Len() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return len(s.blobs)
+}
+
+func (s *memBlobRefs) Err() error {
+	return nil
+}
+
+func (s *memBlobRefs) Close() error {
+	return nil
+}
+
+const (
+	// slot layout: one byte blob type + 1 (zero marks an empty slot), followed by the blob ID
+	diskBlobRefSlotSize = 1 + len(restic.ID{})
+	diskBlobRefMinSlots = 1 << 16
+	// diskBlobRefPageSlots is the number of slots which are read and written
+	// at once while inserting blobs.
+	diskBlobRefPageSlots = 1024
+	// diskBlobRefCachedPages is the number of pages kept in memory while
+	// inserting blobs.
+	diskBlobRefCachedPages = 16
+	// diskBlobRefMaxPending is the number of inserted blobs which are
+	// buffered in memory before they are written to the file.
+	diskBlobRefMaxPending = 1 << 16
+)
+
+// diskBlobRefs is a hash set of blob handles which is stored in a temporary
+// file instead of in memory. It uses open addressing with linear probing,
+// blob IDs are already uniformly distributed and can be used as hash directly.
+//
+// Inserted blobs are buffered in memory and written to the file sorted by
+// their slot, such that the pages of the file are read and written only once
+// for each batch instead of once for each blob. Lookups read the file
+// concurrently, it is only locked exclusively while a batch is written.
+type diskBlobRefs struct {
+	dir string
+
+	// m protects the file, which is only modified while m is locked
+	// exclusively
+	m     sync.RWMutex
+	f     *os.File
+	slots uint64
+	count int
+
+	// pendingM protects pending and err
+	pendingM sync.Mutex
+	pending  restic.BlobSet
+	err      error
+}
+
+func newDiskBlobRefs(dir string) (*diskBlobRefs, error) {
+	s := &diskBlobRefs{dir: dir, pending: restic.NewBlobSet()}
+	f, err := s.createFile(diskBlobRefMinSlots)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+	s.slots = diskBlobRefMinSlots
+	return s, nil
+}
+
+func (s *diskBlobRefs) createFile(slots uint64) (*os.File, error) {
+	f, err := fs.TempFile(s.dir, "restic-check-blobrefs-")
+	if err != nil {
+		return nil, errors.Wrap(err, "TempFile")
+	}
+	// a sparse file reads as zeros, which marks all slots as empty
+	err = f.Truncate(int64(slots) * int64(diskBlobRefSlotSize))
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "Truncate")
+	}
+	return f, nil
+}
+
+func encodeBlobRef(buf []byte, h restic.BlobHandle) {
+	buf[0] = byte(h.Type) + 1
+	copy(buf[1:], h.ID[:])
+}
+
+// homeSlot returns the first slot of the probe sequence of h.
+func homeSlot(slots uint64, h restic.BlobHandle) uint64 {
+	return binary.LittleEndian.Uint64(h.ID[:8]) & (slots - 1)
+}
+
+// find returns the slot which contains h or the empty slot where h should be
+// inserted. The second return value reports whether h was found.
+func find(f *os.File, slots uint64, h restic.BlobHandle) (uint64, bool, error) {
+	var want, buf [diskBlobRefSlotSize]byte
+	encodeBlobRef(want[:], h)
+
+	pos := homeSlot(slots, h)
+	for {
+		_, err := f.ReadAt(buf[:], int64(pos)*int64(diskBlobRefSlotSize))
+		if err != nil {
+			return 0, false, errors.Wrap(err, "ReadAt")
+		}
+		if buf[0] == 0 {
+			return pos, false, nil
+		}
+		if buf == want {
+			return pos, true, nil
+		}
+		pos = (pos + 1) & (slots - 1)
+	}
+}
+
+// blobRefPage is a page of slots which is cached in memory.
+type blobRefPage struct {
+	index uint64
+	buf   []byte
+	dirty bool
+	elem  *list.Element
+}
+
+// blobRefPages caches the most recently used pages of a blob ref file.
+// Changed pages are written back when they are evicted or on flush.
+type blobRefPages struct {
+	f     *os.File
+	slots uint64
+	pages map[uint64]*blobRefPage
+	// lru contains the cached pages, the most recently used page first
+	lru *list.List
+}
+
+func newBlobRefPages(f *os.File, slots uint64) *blobRefPages {
+	return &blobRefPages{
+		f:     f,
+		slots: slots,
+		pages: make(map[uint64]*blobRefPage),
+		lru:   list.New(),
+	}
+}
+
+func (c *blobRefPages) page(index uint64) (*blobRefPage, error) {
+	if p, ok := c.pages[index]; ok {
+		c.lru.MoveToFront(p.elem)
+		return p, nil
+	}
+
+	var p *blobRefPage
+	if c.lru.Len() >= diskBlobRefCachedPages {
+		// reuse the buffer of the least recently used page
+		p = c.lru.Remove(c.lru.Back()).(*blobRefPage)
+		delete(c.pages, p.index)
+		if err := c.writeBack(p); err != nil {
+			return nil, err
+		}
+	} else {
+		p = &blobRefPage{buf: make([]byte, diskBlobRefPageSlots*diskBlobRefSlotSize)}
+	}
+
+	p.index = index
+	_, err := c.f.ReadAt(p.buf, int64(index)*int64(len(p.buf)))
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadAt")
+	}
+	p.elem = c.lru.PushFront(p)
+	c.pages[index] = p
+	return p, nil
+}
+
+func (c *blobRefPages) writeBack(p *blobRefPage) error {
+	if !p.dirty {
+		return nil
+	}
+	_, err := c.f.WriteAt(p.buf, int64(p.index)*int64(len(p.buf)))
+	if err != nil {
+		return errors.Wrap(err, "WriteAt")
+	}
+	p.dirty = false
+	return nil
+}
+
+// insert stores the encoded blob ref in the first free slot of its probe
+// sequence. It reports whether the blob ref was added, that is it was not
+// already contained in the file.
+func (c *blobRefPages) insert(ref []byte, home uint64) (bool, error) {
+	pos := home
+	for {
+		p, err := c.page(pos / diskBlobRefPageSlots)
+		if err != nil {
+			return false, err
+		}
+		offset := int(pos%diskBlobRefPageSlots) * diskBlobRefSlotSize
+		slot := p.buf[offset : offset+diskBlobRefSlotSize]
+		if slot[0] == 0 {
+			copy(slot, ref)
+			p.dirty = true
+			return true, nil
+		}
+		if bytes.Equal(slot, ref) {
+			return false, nil
+		}
+		pos = (pos + 1) & (c.slots - 1)
+	}
+}
+
+// contains reports whether the encoded blob ref is stored in its probe
+// sequence.
+func (c *blobRefPages) contains(ref []byte, home uint64) (bool, error) {
+	pos := home
+	for {
+		p, err := c.page(pos / diskBlobRefPageSlots)
+		if err != nil {
+			return false, err
+		}
+		offset := int(pos%diskBlobRefPageSlots) * diskBlobRefSlotSize
+		slot := p.buf[offset : offset+diskBlobRefSlotSize]
+		if slot[0] == 0 {
+			return false, nil
+		}
+		if bytes.Equal(slot, ref) {
+			return true, nil
+		}
+		pos = (pos + 1) & (c.slots - 1)
+	}
+}
+
+// flush writes back all changed pages.
+func (c *blobRefPages) flush() error {
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		if err := c.writeBack(e.Value.(*blobRefPage)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *diskBlobRefs) setErr(err error) {
+	s.pendingM.Lock()
+	defer s.pendingM.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// lookup reports whether h is contained in the file. It must be called with
+// s.m locked.
+func (s *diskBlobRefs) lookup(h restic.BlobHandle) bool {
+	_, found, err := find(s.f, s.slots, h)
+	if err != nil {
+		s.setErr(err)
+		return false
+	}
+	return found
+}
+
+func (s *diskBlobRefs) Has(h restic.BlobHandle) bool {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	s.pendingM.Lock()
+	pending, failed := s.pending.Has(h), s.err != nil
+	s.pendingM.Unlock()
+	if failed {
+		return false
+	}
+	return pending || s.lookup(h)
+}
+
+func (s *diskBlobRefs) Insert(h restic.BlobHandle) {
+	s.pendingM.Lock()
+	s.pending.Insert(h)
+	full := len(s.pending) >= diskBlobRefMaxPending
+	s.pendingM.Unlock()
+
+	if full {
+		s.flushPending()
+	}
+}
+
+func (s *diskBlobRefs) HasOrInsert(h restic.BlobHandle) bool {
+	s.m.RLock()
+	// the file cannot change while s.m is locked, thus h is inserted at most
+	// once into pending
+	found := s.lookup(h)
+	full := false
+	if !found {
+		s.pendingM.Lock()
+		found = s.pending.Has(h)
+		s.pending.Insert(h)
+		full = len(s.pending) >= diskBlobRefMaxPending
+		s.pendingM.Unlock()
+	}
+	s.m.RUnlock()
+
+	if full {
+		s.flushPending()
+	}
+	return found
+}
+
+// Missing looks up the handles sorted by their slot, such that the file is
+// read sequentially.
+func (s *diskBlobRefs) Missing(handles restic.BlobHandles) restic.BlobHandles {
+	s.flushPending()
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if s.Err() != nil {
+		return nil
+	}
+
+	sorted := make(restic.BlobHandles, len(handles))
+	copy(sorted, handles)
+	sort.Slice(sorted, func(i, j int) bool {
+		return homeSlot(s.slots, sorted[i]) < homeSlot(s.slots, sorted[j])
+	})
+
+	pages := newBlobRefPages(s.f, s.slots)
+	var missing restic.BlobHandles
+	var buf [diskBlobRefSlotSize]byte
+	for _, h := range sorted {
+		encodeBlobRef(buf[:], h)
+		found, err := pages.contains(buf[:], homeSlot(s.slots, h))
+		if err != nil {
+			s.setErr(err)
+			return nil
+		}
+		if !found {
+			missing = append(missing, h)
+		}
+	}
+	return missing
+}
+
+// flushPending writes the pending blobs to the file.
+func (s *diskBlobRefs) flushPending() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if err := s.flush(); err != nil {
+		s.setErr(err)
+	}
+}
+
+// flush writes the pending blobs to the file. The blobs are sorted by their
+// slot, such that the file is accessed sequentially. It must be called with
+// s.m locked exclusively.
+func (s *diskBlobRefs) flush() error {
+	s.pendingM.Lock()
+	handles := s.pending.List()
+	failed := s.err != nil
+	s.pending = restic.NewBlobSet()
+	s.pendingM.Unlock()
+	if len(handles) == 0 || failed {
+		return nil
+	}
+
+	// keep the load factor below 3/4 to keep the probe sequences short
+	for uint64(s.count+len(handles))*4 > s.slots*3 {
+		if err := s.grow(); err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(handles, func(i, j int) bool {
+		return homeSlot(s.slots, handles[i]) < homeSlot(s.slots, handles[j])
+	})
+
+	pages := newBlobRefPages(s.f, s.slots)
+	var buf [diskBlobRefSlotSize]byte
+	for _, h := range handles {
+		encodeBlobRef(buf[:], h)
+		added, err := pages.insert(buf[:], homeSlot(s.slots, h))
+		if err != nil {
+			return err
+		}
+		if added {
+			s.count++
+		}
+	}
+	return pages.flush()
+}
+
+// grow moves all entries into a new file with twice the number of slots.
+func (s *diskBlobRefs) grow() error {
+	slots := s.slots * 2
+	f, err := s.createFile(slots)
+	if err != nil {
+		return err
+	}
+
+	// Read the old file sequentially in larger chunks. The entries of a slot
+	// of the old file move to the same slot or the slot in the second half
+	// of the new file, thus the new file is also written sequentially.
+	pages := newBlobRefPages(f, slots)
+	buf := make([]byte, 4096*diskBlobRefSlotSize)
+	var offset int64
+	for {
+		n, err := s.f.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			_ = f.Close()
+			return errors.Wrap(err, "ReadAt")
+		}
+		offset += int64(n)
+
+		for i := 0; i+diskBlobRefSlotSize <= n; i += diskBlobRefSlotSize {
+			slot := buf[i : i+diskBlobRefSlotSize]
+			if slot[0] == 0 {
+				continue
+			}
+			var h restic.BlobHandle
+			copy(h.ID[:], slot[1:])
+
+			if _, ierr := pages.insert(slot, homeSlot(slots, h)); ierr != nil {
+				_ = f.Close()
+				return ierr
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := pages.flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	_ = s.f.Close()
+	s.f = f
+	s.slots = slots
+	return nil
+}
+
+func (s *diskBlobRefs) Len() int {
+	// duplicates of already stored blobs are only detected when flushing
+	s.flushPending()
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.count
+}
+
+func (s *diskBlobRefs) Err() error {
+	s.pendingM.Lock()
+	defer s.pendingM.Unlock()
+	return s.err
+}
+
+func (s *diskBlobRefs) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.f.Close()
+}
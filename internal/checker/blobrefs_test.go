@@ -0,0 +1,120 @@
+package checker
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestDiskBlobRefs(t *testing.T) {
+	s, err := newDiskBlobRefs(t.TempDir())
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, s.Close())
+	}()
+
+	// insert enough blobs to force the set to grow several times
+	var handles []restic.BlobHandle
+	for i := 0; i < 4*diskBlobRefMinSlots; i++ {
+		tpe := restic.DataBlob
+		if i%3 == 0 {
+			tpe = restic.TreeBlob
+		}
+		h := restic.BlobHandle{ID: restic.NewRandomID(), Type: tpe}
+		handles = append(handles, h)
+		s.Insert(h)
+	}
+	// pending blobs are found before they are written to the file
+	rtest.Assert(t, s.Has(handles[len(handles)-1]), "pending blob missing")
+	// inserting again must be a noop
+	for _, h := range handles[:100] {
+		s.Insert(h)
+	}
+	rtest.OK(t, s.Err())
+	rtest.Equals(t, len(handles), s.Len())
+
+	for _, h := range handles {
+		rtest.Assert(t, s.Has(h), "blob %v missing", h)
+	}
+
+	// the same ID with a different type is a different blob
+	other := handles[1]
+	other.Type = restic.TreeBlob
+	rtest.Assert(t, !s.Has(other), "unexpected blob %v", other)
+	rtest.Assert(t, !s.Has(restic.BlobHandle{ID: restic.NewRandomID(), Type: restic.DataBlob}), "unexpected random blob")
+	rtest.OK(t, s.Err())
+}
+
+func TestDiskBlobRefsConcurrent(t *testing.T) {
+	s, err := newDiskBlobRefs(t.TempDir())
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, s.Close())
+	}()
+
+	handles := make(restic.BlobHandles, 2*diskBlobRefMaxPending)
+	for i := range handles {
+		handles[i] = restic.BlobHandle{ID: restic.NewRandomID(), Type: restic.TreeBlob}
+	}
+
+	// each blob must be reported as new exactly once, also while the pending
+	// blobs are written to the file
+	var m sync.Mutex
+	added := restic.NewBlobSet()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, h := range handles {
+				if !s.HasOrInsert(h) {
+					m.Lock()
+					rtest.Assert(t, !added.Has(h), "blob %v added twice", h)
+					added.Insert(h)
+					m.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	rtest.OK(t, s.Err())
+	rtest.Equals(t, len(handles), len(added))
+	rtest.Equals(t, len(handles), s.Len())
+
+	other := restic.BlobHandles{
+		{ID: restic.NewRandomID(), Type: restic.DataBlob},
+		{ID: restic.NewRandomID(), Type: restic.TreeBlob},
+	}
+	missing := s.Missing(append(append(restic.BlobHandles{}, handles[:1000]...), other...))
+	sort.Sort(missing)
+	sort.Sort(other)
+	rtest.Equals(t, other, missing)
+	rtest.OK(t, s.Err())
+}
+
+func BenchmarkDiskBlobRefs(b *testing.B) {
+	handles := make([]restic.BlobHandle, 4*diskBlobRefMinSlots)
+	for i := range handles {
+		handles[i] = restic.BlobHandle{ID: restic.NewRandomID(), Type: restic.DataBlob}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, err := newDiskBlobRefs(b.TempDir())
+		rtest.OK(b, err)
+		for _, h := range handles {
+			s.Insert(h)
+		}
+		rtest.Equals(b, len(handles), s.Len())
+		for _, h := range handles {
+			if !s.Has(h) {
+				b.Fatalf("blob %v missing", h)
+			}
+		}
+		rtest.OK(b, s.Err())
+		rtest.OK(b, s.Close())
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"runtime"
-	"sync"
 
 	"github.com/klauspost/compress/zstd"
 	"github.com/restic/restic/internal/debug"
@@ -24,11 +23,9 @@ import (
 // A Checker only tests for internal errors within the data structures of the
 // repository (e.g. missing blobs), and needs a valid Repository to work on.
 type Checker struct {
-	packs    map[restic.ID]int64
-	blobRefs struct {
-		sync.Mutex
-		M restic.BlobSet
-	}
+	packs map[restic.ID]int64
+	// blobRefs may be accessed in parallel by checkTree
+	blobRefs    blobRefSet
 	trackUnused bool
 
 	masterIndex *index.MasterIndex
@@ -46,11 +43,33 @@ func New(repo restic.Repository, trackUnused bool) *Checker {
 		trackUnused: trackUnused,
 	}
 
-	c.blobRefs.M = restic.NewBlobSet()
+	c.blobRefs = newMemBlobRefs()
 
 	return c
 }
 
+// SpillBlobRefs makes the checker keep the set of referenced blobs in a
+// temporary file in dir instead of in memory. This considerably reduces the
+// memory usage for large repositories at the cost of additional disk IO. The
+// index and the list of pack files are still kept in memory, which requires
+// roughly 80 bytes per blob and 100 bytes per pack file. It must be called
+// before Structure.
+func (c *Checker) SpillBlobRefs(dir string) error {
+	refs, err := newDiskBlobRefs(dir)
+	if err != nil {
+		return err
+	}
+
+	_ = c.blobRefs.Close()
+	c.blobRefs = refs
+	return nil
+}
+
+// Close releases the resources used by the checker.
+func (c *Checker) Close() error {
+	return c.blobRefs.Close()
+}
+
 // ErrDuplicatePacks is returned when a pack is found in more than one index.
 type ErrDuplicatePacks struct {
 	PackID  restic.ID
@@ -281,9 +300,8 @@ func loadSnapshotTreeIDs(ctx context.Context, lister restic.Lister, repo restic.
 			errs = append(errs, err)
 			return nil
 		}
-		treeID := *sn.Tree
-		debug.Log("snapshot %v has tree %v", id, treeID)
-		ids = append(ids, treeID)
+		debug.Log("snapshot %v has trees %v", id, sn.TreeIDs())
+		ids = append(ids, sn.TreeIDs()...)
 		return nil
 	})
 	if err != nil {
@@ -311,14 +329,7 @@ func (c *Checker) Structure(ctx context.Context, p *progress.Counter, errChan ch
 
 	wg, ctx := errgroup.WithContext(ctx)
 	treeStream := restic.StreamTrees(ctx, wg, c.repo, trees, func(treeID restic.ID) bool {
-		// blobRefs may be accessed in parallel by checkTree
-		c.blobRefs.Lock()
-		h := restic.BlobHandle{ID: treeID, Type: restic.TreeBlob}
-		blobReferenced := c.blobRefs.M.Has(h)
-		// noop if already referenced
-		c.blobRefs.M.Insert(h)
-		c.blobRefs.Unlock()
-		return blobReferenced
+		return c.blobRefs.HasOrInsert(restic.BlobHandle{ID: treeID, Type: restic.TreeBlob})
 	}, p)
 
 	defer close(errChan)
@@ -337,6 +348,14 @@ func (c *Checker) Structure(ctx context.Context, p *progress.Counter, errChan ch
 	if err != nil {
 		panic(err)
 	}
+
+	err = c.blobRefs.Err()
+	if err != nil {
+		select {
+		case <-ctx.Done():
+		case errChan <- errors.Wrap(err, "tracking referenced blobs"):
+		}
+	}
 }
 
 func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
@@ -349,7 +368,8 @@ func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
 				errs = append(errs, &Error{TreeID: id, Err: errors.Errorf("file %q has nil blob list", node.Name)})
 			}
 
-			for b, blobID := range node.Content {
+			blobs := node.DataBlobs()
+			for b, blobID := range blobs {
 				if blobID.IsNull() {
 					errs = append(errs, &Error{TreeID: id, Err: errors.Errorf("file %q blob %d has null ID", node.Name, b)})
 					continue
@@ -367,17 +387,14 @@ func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
 			}
 
 			if c.trackUnused {
-				// loop a second time to keep the locked section as short as possible
-				c.blobRefs.Lock()
-				for _, blobID := range node.Content {
+				for _, blobID := range blobs {
 					if blobID.IsNull() {
 						continue
 					}
 					h := restic.BlobHandle{ID: blobID, Type: restic.DataBlob}
-					c.blobRefs.M.Insert(h)
+					c.blobRefs.Insert(h)
 					debug.Log("blob %v is referenced", blobID)
 				}
-				c.blobRefs.Unlock()
 			}
 
 		case restic.NodeTypeDir:
@@ -406,25 +423,38 @@ func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
 	return errs
 }
 
+// unusedBlobsBatchSize is the number of blobs looked up at once by UnusedBlobs.
+const unusedBlobsBatchSize = 1 << 16
+
 // UnusedBlobs returns all blobs that have never been referenced.
 func (c *Checker) UnusedBlobs(ctx context.Context) (blobs restic.BlobHandles, err error) {
 	if !c.trackUnused {
 		panic("only works when tracking blob references")
 	}
-	c.blobRefs.Lock()
-	defer c.blobRefs.Unlock()
-
-	debug.Log("checking %d blobs", len(c.blobRefs.M))
+	debug.Log("checking %d blobs", c.blobRefs.Len())
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	err = c.repo.ListBlobs(ctx, func(blob restic.PackedBlob) {
-		h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
-		if !c.blobRefs.M.Has(h) {
+	// look up the blobs in batches, which the set on disk can process
+	// sequentially
+	var batch restic.BlobHandles
+	checkBatch := func() {
+		for _, h := range c.blobRefs.Missing(batch) {
 			debug.Log("blob %v not referenced", h)
 			blobs = append(blobs, h)
 		}
+		batch = batch[:0]
+	}
+	err = c.repo.ListBlobs(ctx, func(blob restic.PackedBlob) {
+		batch = append(batch, restic.BlobHandle{ID: blob.ID, Type: blob.Type})
+		if len(batch) >= unusedBlobsBatchSize {
+			checkBatch()
+		}
 	})
+	checkBatch()
+	if err == nil {
+		err = c.blobRefs.Err()
+	}
 
 	return blobs, err
 }
@@ -434,6 +464,11 @@ func (c *Checker) CountPacks() uint64 {
 	return uint64(len(c.packs))
 }
 
+// CountIndexes returns the number of index files in the repository.
+func (c *Checker) CountIndexes() uint64 {
+	return uint64(len(c.masterIndex.IDs()))
+}
+
 // GetPacks returns IDSet of packs in the repository
 func (c *Checker) GetPacks() map[restic.ID]int64 {
 	return c.packs
@@ -145,6 +145,14 @@ func TestUnreferencedPack(t *testing.T) {
 }
 
 func TestUnreferencedBlobs(t *testing.T) {
+	testUnreferencedBlobs(t, false)
+}
+
+func TestUnreferencedBlobsSpilled(t *testing.T) {
+	testUnreferencedBlobs(t, true)
+}
+
+func testUnreferencedBlobs(t *testing.T, spill bool) {
 	repo, be, cleanup := repository.TestFromFixture(t, checkerTestData)
 	defer cleanup()
 
@@ -163,6 +171,12 @@ func TestUnreferencedBlobs(t *testing.T) {
 	sort.Sort(unusedBlobsBySnapshot)
 
 	chkr := checker.New(repo, true)
+	if spill {
+		test.OK(t, chkr.SpillBlobRefs(t.TempDir()))
+	}
+	defer func() {
+		test.OK(t, chkr.Close())
+	}()
 	hints, errs := chkr.LoadIndex(context.TODO(), nil)
 	if len(errs) > 0 {
 		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
@@ -0,0 +1,63 @@
+// Package cluster queries the state of Windows failover clusters, so a backup
+// scheduled on every node of a cluster only runs on the node which currently
+// owns a clustered role.
+package cluster
+
+import (
+	"strings"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// Role states, see the documentation of GetClusterGroupState.
+const (
+	StateOnline        = 0
+	StateOffline       = 1
+	StateFailed        = 2
+	StatePartialOnline = 3
+	StatePending       = 4
+)
+
+var stateNames = map[int]string{
+	StateOnline:        "online",
+	StateOffline:       "offline",
+	StateFailed:        "failed",
+	StatePartialOnline: "partially online",
+	StatePending:       "pending",
+}
+
+// Role is a clustered role (cluster group) and the node which owns it.
+type Role struct {
+	Cluster   string
+	Name      string
+	OwnerNode string
+	State     int
+}
+
+// StateString returns a description of the state of the role.
+func (r Role) StateString() string {
+	if s, ok := stateNames[r.State]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// OwnedBy returns true if node is the owner of the role. Node names are
+// compared case-insensitively, a DNS domain is ignored.
+func (r Role) OwnedBy(node string) bool {
+	short := func(s string) string {
+		name, _, _ := strings.Cut(s, ".")
+		return name
+	}
+	return r.OwnerNode != "" && strings.EqualFold(short(r.OwnerNode), short(node))
+}
+
+// Tags returns the tags which record the role, the node which created the
+// snapshot and the cluster shared volumes contained in it.
+func (r Role) Tags(sharedVolumes []string) restic.TagList {
+	tags := restic.TagList{"cluster:" + r.Cluster, "cluster-role:" + r.Name, "cluster-node:" + r.OwnerNode}
+	for _, v := range sharedVolumes {
+		tags = append(tags, "cluster-csv:"+v)
+	}
+	return tags
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package cluster
+
+import "github.com/restic/restic/internal/errors"
+
+var errNotSupported = errors.New("failover clusters are only supported on Windows")
+
+// LookupRole returns the clustered role with the given name from the cluster
+// the local host is a node of.
+func LookupRole(_ string) (Role, error) {
+	return Role{}, errNotSupported
+}
+
+// LocalNode returns the name of the local host as used for cluster nodes.
+func LocalNode() (string, error) {
+	return "", errNotSupported
+}
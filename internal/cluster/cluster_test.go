@@ -0,0 +1,23 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestOwnedBy(t *testing.T) {
+	role := Role{Cluster: "FSCLUSTER", Name: "FileServer", OwnerNode: "NODE1"}
+	rtest.Assert(t, role.OwnedBy("NODE1"), "node not recognized")
+	rtest.Assert(t, role.OwnedBy("node1.example.com"), "node with domain not recognized")
+	rtest.Assert(t, !role.OwnedBy("NODE2"), "wrong node recognized")
+	rtest.Assert(t, !(Role{}).OwnedBy(""), "role without owner is owned")
+}
+
+func TestTags(t *testing.T) {
+	role := Role{Cluster: "FSCLUSTER", Name: "FileServer", OwnerNode: "NODE1", State: StatePending}
+	rtest.Equals(t, restic.TagList{"cluster:FSCLUSTER", "cluster-role:FileServer", "cluster-node:NODE1", "cluster-csv:Volume1"},
+		role.Tags([]string{"Volume1"}))
+	rtest.Equals(t, "pending", role.StateString())
+}
@@ -0,0 +1,105 @@
+//go:build windows
+// +build windows
+
+package cluster
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modclusapi               = windows.NewLazySystemDLL("clusapi.dll")
+	procOpenCluster          = modclusapi.NewProc("OpenCluster")
+	procCloseCluster         = modclusapi.NewProc("CloseCluster")
+	procGetClusterInfo       = modclusapi.NewProc("GetClusterInformation")
+	procOpenClusterGroup     = modclusapi.NewProc("OpenClusterGroup")
+	procCloseClusterGroup    = modclusapi.NewProc("CloseClusterGroup")
+	procGetClusterGroupState = modclusapi.NewProc("GetClusterGroupState")
+)
+
+// clusterGroupStateUnknown is returned by GetClusterGroupState on errors.
+const clusterGroupStateUnknown = -1
+
+// LookupRole returns the clustered role with the given name from the cluster
+// the local host is a node of.
+func LookupRole(name string) (Role, error) {
+	if err := modclusapi.Load(); err != nil {
+		return Role{}, fmt.Errorf("failover clustering is not installed: %w", err)
+	}
+
+	cluster, _, err := procOpenCluster.Call(0)
+	if cluster == 0 {
+		return Role{}, fmt.Errorf("unable to open the local cluster: %w", err)
+	}
+	defer func() { _, _, _ = procCloseCluster.Call(cluster) }()
+
+	role := Role{Name: name}
+	role.Cluster, err = readString(func(buf *uint16, n *uint32) uintptr {
+		ret, _, _ := procGetClusterInfo.Call(cluster, uintptr(unsafe.Pointer(buf)), uintptr(unsafe.Pointer(n)), 0)
+		return ret
+	})
+	if err != nil {
+		return Role{}, fmt.Errorf("unable to query the cluster name: %w", err)
+	}
+
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return Role{}, err
+	}
+	group, _, err := procOpenClusterGroup.Call(cluster, uintptr(unsafe.Pointer(namePtr)))
+	if group == 0 {
+		return Role{}, fmt.Errorf("unable to open the clustered role %q: %w", name, err)
+	}
+	defer func() { _, _, _ = procCloseClusterGroup.Call(group) }()
+
+	role.OwnerNode, err = readString(func(buf *uint16, n *uint32) uintptr {
+		state, _, err := procGetClusterGroupState.Call(group, uintptr(unsafe.Pointer(buf)), uintptr(unsafe.Pointer(n)))
+		// the return value is a 32 bit enum
+		if int32(state) == clusterGroupStateUnknown {
+			if errno, ok := err.(syscall.Errno); ok && errno != 0 {
+				return uintptr(errno)
+			}
+			return uintptr(windows.ERROR_GEN_FAILURE)
+		}
+		role.State = int(int32(state))
+		return 0
+	})
+	if err != nil {
+		return Role{}, fmt.Errorf("unable to query the state of the clustered role %q: %w", name, err)
+	}
+
+	return role, nil
+}
+
+// readString calls fn with a buffer until it is large enough to contain the
+// result. fn returns a Windows error code.
+func readString(fn func(buf *uint16, n *uint32) uintptr) (string, error) {
+	n := uint32(256)
+	for {
+		buf := make([]uint16, n)
+		size := n
+		ret := fn(&buf[0], &size)
+		switch syscall.Errno(ret) {
+		case 0:
+			return syscall.UTF16ToString(buf), nil
+		case windows.ERROR_MORE_DATA:
+			n = size + 1
+		default:
+			return "", syscall.Errno(ret)
+		}
+	}
+}
+
+// LocalNode returns the name of the local host as used for cluster nodes.
+func LocalNode() (string, error) {
+	n := uint32(windows.MAX_COMPUTERNAME_LENGTH + 1)
+	buf := make([]uint16, n)
+	if err := windows.GetComputerNameEx(windows.ComputerNamePhysicalNetBIOS, &buf[0], &n); err != nil {
+		return "", err
+	}
+	return syscall.UTF16ToString(buf[:n]), nil
+}
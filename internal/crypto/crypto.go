@@ -23,6 +23,19 @@ const (
 
 	// Extension is the number of bytes a plaintext is enlarged by encrypting it.
 	Extension = ivSize + macSize
+
+	// gcmNonceSize is the part of the IV used as nonce for AES-GCM.
+	gcmNonceSize = 12
+)
+
+// Supported ciphers.
+const (
+	// CipherAES256Poly1305 is AES-256 in counter mode authenticated with
+	// Poly1305-AES. It is used unless another cipher is selected.
+	CipherAES256Poly1305 = "aes-256-poly1305"
+	// CipherAES256GCM is AES-256 in Galois/Counter Mode, which is approved
+	// by FIPS 140.
+	CipherAES256GCM = "aes-256-gcm"
 )
 
 var (
@@ -36,6 +49,52 @@ var (
 type Key struct {
 	MACKey        `json:"mac"`
 	EncryptionKey `json:"encrypt"`
+
+	// Cipher selects the cipher used with this key, an empty value selects
+	// CipherAES256Poly1305. The MAC key is not used with AES-GCM.
+	Cipher string `json:"cipher,omitempty"`
+
+	// SignedConfig records that the config of the repository is signed, a
+	// config without signature is then rejected. As the key is stored
+	// encrypted, the flag cannot be removed without the password.
+	SignedConfig bool `json:"signed_config,omitempty"`
+
+	// ConfigRevision is the highest revision of the repository config seen
+	// using this key, configs with a lower revision are rejected as rolled
+	// back. As the key is stored encrypted, the revision cannot be lowered
+	// without the password.
+	ConfigRevision uint64 `json:"config_revision,omitempty"`
+}
+
+// CipherName returns the name of the cipher used with the key.
+func (k *Key) CipherName() string {
+	if k.Cipher == "" {
+		return CipherAES256Poly1305
+	}
+	return k.Cipher
+}
+
+// ValidCipher reports whether cipher is empty or a supported cipher.
+func ValidCipher(cipher string) bool {
+	switch cipher {
+	case "", CipherAES256Poly1305, CipherAES256GCM:
+		return true
+	}
+	return false
+}
+
+// gcm returns the AES-GCM instance for the key. The nonce is formed by the
+// first 12 bytes of the IV, the remaining bytes are ignored.
+func (k *Key) gcm() cipher.AEAD {
+	c, err := aes.NewCipher(k.EncryptionKey[:])
+	if err != nil {
+		panic(fmt.Sprintf("unable to create cipher: %v", err))
+	}
+	aead, err := cipher.NewGCM(c)
+	if err != nil {
+		panic(fmt.Sprintf("unable to create GCM: %v", err))
+	}
+	return aead
 }
 
 // EncryptionKey is key used for encryption
@@ -257,6 +316,13 @@ func (k *Key) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 		panic("nonce is invalid")
 	}
 
+	if k.Cipher == CipherAES256GCM {
+		return k.gcm().Seal(dst, nonce[:gcmNonceSize], plaintext, nil)
+	}
+	if k.Cipher != "" && k.Cipher != CipherAES256Poly1305 {
+		panic(fmt.Sprintf("unsupported cipher %q", k.Cipher))
+	}
+
 	ret, out := sliceForAppend(dst, len(plaintext)+k.Overhead())
 
 	c, err := aes.NewCipher(k.EncryptionKey[:])
@@ -302,6 +368,18 @@ func (k *Key) Open(dst, nonce, ciphertext, _ []byte) ([]byte, error) {
 		return nil, errors.Errorf("trying to decrypt invalid data: ciphertext too short")
 	}
 
+	switch k.Cipher {
+	case CipherAES256GCM:
+		ret, err := k.gcm().Open(dst, nonce[:gcmNonceSize], ciphertext, nil)
+		if err != nil {
+			return nil, ErrUnauthenticated
+		}
+		return ret, nil
+	case "", CipherAES256Poly1305:
+	default:
+		return nil, errors.Errorf("unsupported cipher %q", k.Cipher)
+	}
+
 	l := len(ciphertext) - macSize
 	ct, mac := ciphertext[:l], ciphertext[l:]
 
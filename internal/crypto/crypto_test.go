@@ -300,3 +300,40 @@ func BenchmarkDecrypt(b *testing.B) {
 		rtest.OK(b, err)
 	}
 }
+
+func TestEncryptDecryptGCM(t *testing.T) {
+	k := crypto.NewRandomKey()
+	k.Cipher = crypto.CipherAES256GCM
+
+	for _, size := range []int{0, 5, 23, 2<<18 + 23} {
+		data := rtest.Random(23, size)
+
+		nonce := crypto.NewRandomNonce()
+		ciphertext := k.Seal(nil, nonce, data, nil)
+		rtest.Equals(t, len(data)+crypto.Extension-len(nonce), len(ciphertext))
+
+		plaintext, err := k.Open(nil, nonce, ciphertext, nil)
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(data, plaintext), "wrong plaintext returned")
+
+		// the ciphertext must not be readable with the other cipher
+		k.Cipher = ""
+		_, err = k.Open(nil, nonce, ciphertext, nil)
+		rtest.Assert(t, err == crypto.ErrUnauthenticated, "expected ErrUnauthenticated, got %v", err)
+		k.Cipher = crypto.CipherAES256GCM
+
+		ciphertext[0] ^= 1
+		_, err = k.Open(nil, nonce, ciphertext, nil)
+		rtest.Assert(t, err == crypto.ErrUnauthenticated, "expected ErrUnauthenticated, got %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	k := crypto.NewRandomKey()
+	data := []byte("restic test data")
+
+	sig := k.Sign(data)
+	rtest.Assert(t, k.Verify(data, sig), "signature is not valid")
+	rtest.Assert(t, !k.Verify([]byte("restic test date"), sig), "signature of modified data is valid")
+	rtest.Assert(t, !crypto.NewRandomKey().Verify(data, sig), "signature is valid with a different key")
+}
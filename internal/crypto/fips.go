@@ -0,0 +1,9 @@
+package crypto
+
+// FIPSModule reports whether the cryptographic primitives of the standard
+// library are provided by a FIPS 140 validated module. This is the case for
+// builds using GOEXPERIMENT=boringcrypto and, starting with Go 1.24, when
+// running with GODEBUG=fips140=on.
+func FIPSModule() bool {
+	return fipsModule()
+}
@@ -0,0 +1,9 @@
+//go:build boringcrypto
+
+package crypto
+
+import "crypto/boring"
+
+func fipsModule() bool {
+	return boring.Enabled()
+}
@@ -0,0 +1,9 @@
+//go:build go1.24 && !boringcrypto
+
+package crypto
+
+import "crypto/fips140"
+
+func fipsModule() bool {
+	return fips140.Enabled()
+}
@@ -2,16 +2,25 @@ package crypto
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"time"
 
 	"github.com/restic/restic/internal/errors"
 
 	sscrypt "github.com/elithrar/simple-scrypt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/scrypt"
 )
 
 const saltLength = 64
 
+// DefaultPBKDF2Iterations is the default number of iterations for PBKDF2().
+const DefaultPBKDF2Iterations = 600000
+
+// minPBKDF2Iterations is the lowest number of iterations accepted by PBKDF2().
+const minPBKDF2Iterations = 1000
+
 // Params are the default parameters used for the key derivation function KDF().
 type Params struct {
 	N int
@@ -89,6 +98,82 @@ func KDF(p Params, salt []byte, password string) (*Key, error) {
 	return derKeys, nil
 }
 
+// PBKDF2 derives the encryption key from the password using PBKDF2 with
+// HMAC-SHA-256, which is approved by FIPS 140, and the supplied number of
+// iterations and salt. The returned key uses AES-GCM.
+func PBKDF2(iterations int, salt []byte, password string) (*Key, error) {
+	if len(salt) != saltLength {
+		return nil, errors.Errorf("pbkdf2() called with invalid salt bytes (len %d)", len(salt))
+	}
+
+	if iterations < minPBKDF2Iterations {
+		return nil, errors.Errorf("pbkdf2() called with too few iterations (%d)", iterations)
+	}
+
+	keybytes := macKeySize + aesKeySize
+	derived := pbkdf2.Key([]byte(password), salt, iterations, keybytes, sha256.New)
+
+	// the MAC key is unused by AES-GCM, but it must be valid
+	derKeys := &Key{Cipher: CipherAES256GCM}
+	copy(derKeys.EncryptionKey[:], derived[:aesKeySize])
+	macKeyFromSlice(&derKeys.MACKey, derived[aesKeySize:])
+
+	return derKeys, nil
+}
+
+// Argon2Params are the parameters for Argon2id().
+type Argon2Params struct {
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is the size of the memory in KiB.
+	Memory uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+}
+
+// DefaultArgon2Params are the default parameters for Argon2id(), which follow
+// the second recommended option of RFC 9106 with 64 MiB of memory.
+var DefaultArgon2Params = Argon2Params{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+// Check returns an error if the parameters are not valid.
+func (p Argon2Params) Check() error {
+	if p.Time < 1 {
+		return errors.New("argon2id time must be at least 1")
+	}
+	if p.Threads < 1 {
+		return errors.New("argon2id threads must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Threads) {
+		return errors.Errorf("argon2id memory must be at least %d KiB for %d threads", 8*uint32(p.Threads), p.Threads)
+	}
+	return nil
+}
+
+// Argon2id derives encryption and message authentication keys from the
+// password using Argon2id with the supplied parameters and salt.
+func Argon2id(p Argon2Params, salt []byte, password string) (*Key, error) {
+	if len(salt) != saltLength {
+		return nil, errors.Errorf("argon2id() called with invalid salt bytes (len %d)", len(salt))
+	}
+
+	if err := p.Check(); err != nil {
+		return nil, err
+	}
+
+	keybytes := macKeySize + aesKeySize
+	derived := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(keybytes))
+
+	derKeys := &Key{}
+	copy(derKeys.EncryptionKey[:], derived[:aesKeySize])
+	macKeyFromSlice(&derKeys.MACKey, derived[aesKeySize:])
+
+	return derKeys, nil
+}
+
 // NewSalt returns new random salt bytes to use with KDF(). If NewSalt returns
 // an error, this is a grave situation and the program must abort and terminate.
 func NewSalt() ([]byte, error) {
@@ -3,6 +3,8 @@ package crypto
 import (
 	"testing"
 	"time"
+
+	rtest "github.com/restic/restic/internal/test"
 )
 
 func TestCalibrate(t *testing.T) {
@@ -12,3 +14,54 @@ func TestCalibrate(t *testing.T) {
 	}
 	t.Logf("testing calibrate, params after: %v", params)
 }
+
+func TestPBKDF2(t *testing.T) {
+	salt, err := NewSalt()
+	rtest.OK(t, err)
+
+	k1, err := PBKDF2(minPBKDF2Iterations, salt, "geheim")
+	rtest.OK(t, err)
+	rtest.Equals(t, CipherAES256GCM, k1.Cipher)
+	rtest.Assert(t, k1.Valid(), "derived key is invalid")
+
+	k2, err := PBKDF2(minPBKDF2Iterations, salt, "geheim")
+	rtest.OK(t, err)
+	rtest.Equals(t, k1, k2)
+
+	k3, err := PBKDF2(minPBKDF2Iterations, salt, "other")
+	rtest.OK(t, err)
+	rtest.Assert(t, k1.EncryptionKey != k3.EncryptionKey, "different passwords yield the same key")
+
+	_, err = PBKDF2(minPBKDF2Iterations-1, salt, "geheim")
+	rtest.Assert(t, err != nil, "expected error for too few iterations")
+	_, err = PBKDF2(minPBKDF2Iterations, salt[:8], "geheim")
+	rtest.Assert(t, err != nil, "expected error for short salt")
+}
+
+func TestArgon2id(t *testing.T) {
+	salt, err := NewSalt()
+	rtest.OK(t, err)
+	params := Argon2Params{Time: 1, Memory: 64, Threads: 1}
+
+	k1, err := Argon2id(params, salt, "geheim")
+	rtest.OK(t, err)
+	rtest.Equals(t, "", k1.Cipher)
+	rtest.Assert(t, k1.Valid(), "derived key is invalid")
+
+	k2, err := Argon2id(params, salt, "geheim")
+	rtest.OK(t, err)
+	rtest.Equals(t, k1, k2)
+
+	k3, err := Argon2id(params, salt, "other")
+	rtest.OK(t, err)
+	rtest.Assert(t, k1.EncryptionKey != k3.EncryptionKey, "different passwords yield the same key")
+
+	k4, err := Argon2id(Argon2Params{Time: 2, Memory: 64, Threads: 1}, salt, "geheim")
+	rtest.OK(t, err)
+	rtest.Assert(t, k1.EncryptionKey != k4.EncryptionKey, "different parameters yield the same key")
+
+	_, err = Argon2id(Argon2Params{Time: 1, Memory: 16, Threads: 4}, salt, "geheim")
+	rtest.Assert(t, err != nil, "expected error for too little memory")
+	_, err = Argon2id(params, salt[:8], "geheim")
+	rtest.Assert(t, err != nil, "expected error for short salt")
+}
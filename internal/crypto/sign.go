@@ -0,0 +1,41 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// signingKeyInfo separates the signing key from other keys derived from the
+// master key.
+const signingKeyInfo = "restic signing key v1"
+
+// signingKey derives the key used by Sign from the encryption and MAC keys.
+func (k *Key) signingKey() []byte {
+	secret := make([]byte, 0, aesKeySize+macKeySize)
+	secret = append(secret, k.EncryptionKey[:]...)
+	secret = append(secret, k.MACKey.K[:]...)
+	secret = append(secret, k.MACKey.R[:]...)
+
+	key := make([]byte, sha256.Size)
+	_, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(signingKeyInfo)), key)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// Sign returns an HMAC-SHA-256 of data, keyed with a key derived from k.
+// Callers should prefix data with a string identifying its purpose.
+func (k *Key) Sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, k.signingKey())
+	_, _ = mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Verify reports whether sig is a valid signature of data created by Sign.
+func (k *Key) Verify(data, sig []byte) bool {
+	return hmac.Equal(k.Sign(data), sig)
+}
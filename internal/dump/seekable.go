@@ -0,0 +1,127 @@
+package dump
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Constants of the zstd seekable format, see
+// https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md
+const (
+	seekableSkippableMagic = 0x184D2A5E
+	seekableMagic          = 0x8F92EAB1
+	seekableFooterSize     = 9
+	seekableEntrySize      = 8
+
+	// DefaultSeekableFrameSize is the default amount of uncompressed data
+	// stored in each frame.
+	DefaultSeekableFrameSize = 4 << 20
+	// MaxSeekableFrameSize is the largest supported frame size, the seek
+	// table stores frame sizes as 32 bit values.
+	MaxSeekableFrameSize = 1 << 30
+)
+
+// SeekableWriter compresses data using the zstd seekable format. The data is
+// split into independently compressed frames of a fixed uncompressed size,
+// which are followed by a seek table listing the size of each frame. This
+// allows tools which support the format to decompress arbitrary ranges without
+// decompressing everything that precedes them. The output can be decompressed
+// by any zstd decoder.
+type SeekableWriter struct {
+	w         io.Writer
+	enc       *zstd.Encoder
+	frameSize int
+
+	buf     []byte
+	out     []byte
+	entries []byte
+	frames  uint32
+	err     error
+}
+
+// NewSeekableWriter returns a writer which writes data compressed in the zstd
+// seekable format to w. Each frame contains frameSize bytes of uncompressed
+// data. Close must be called to write the seek table.
+func NewSeekableWriter(w io.Writer, frameSize int) (*SeekableWriter, error) {
+	if frameSize <= 0 || frameSize > MaxSeekableFrameSize {
+		return nil, errors.Errorf("invalid frame size %d", frameSize)
+	}
+
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SeekableWriter{
+		w:         w,
+		enc:       enc,
+		frameSize: frameSize,
+		buf:       make([]byte, 0, frameSize),
+	}, nil
+}
+
+// Write implements io.Writer.
+func (s *SeekableWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		l := min(len(p), s.frameSize-len(s.buf))
+		s.buf = append(s.buf, p[:l]...)
+		p = p[l:]
+		n += l
+
+		if len(s.buf) == s.frameSize {
+			if err := s.flushFrame(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (s *SeekableWriter) flushFrame() error {
+	s.out = s.enc.EncodeAll(s.buf, s.out[:0])
+	if _, err := s.w.Write(s.out); err != nil {
+		s.err = err
+		return err
+	}
+
+	s.entries = binary.LittleEndian.AppendUint32(s.entries, uint32(len(s.out)))
+	s.entries = binary.LittleEndian.AppendUint32(s.entries, uint32(len(s.buf)))
+	s.frames++
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// Close writes the remaining data and the seek table. It does not close the
+// underlying writer.
+func (s *SeekableWriter) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	if len(s.buf) > 0 {
+		if err := s.flushFrame(); err != nil {
+			return err
+		}
+	}
+	s.err = errors.New("writer is closed")
+
+	// the seek table is stored in a skippable frame, the descriptor is zero
+	// as the entries do not contain checksums
+	table := make([]byte, 0, 8+len(s.entries)+seekableFooterSize)
+	table = binary.LittleEndian.AppendUint32(table, seekableSkippableMagic)
+	table = binary.LittleEndian.AppendUint32(table, uint32(len(s.entries)+seekableFooterSize))
+	table = append(table, s.entries...)
+	table = binary.LittleEndian.AppendUint32(table, s.frames)
+	table = append(table, 0)
+	table = binary.LittleEndian.AppendUint32(table, seekableMagic)
+
+	_, err := s.w.Write(table)
+	return errors.Wrap(err, "Write")
+}
@@ -0,0 +1,88 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// readSeekTable parses the seek table at the end of data and returns the
+// compressed and decompressed size of each frame.
+func readSeekTable(t *testing.T, data []byte) (compressed, decompressed []int) {
+	rtest.Assert(t, len(data) >= seekableFooterSize, "data too short")
+	footer := data[len(data)-seekableFooterSize:]
+	rtest.Equals(t, uint32(seekableMagic), binary.LittleEndian.Uint32(footer[5:]))
+	rtest.Equals(t, byte(0), footer[4])
+
+	frames := int(binary.LittleEndian.Uint32(footer))
+	tableSize := frames*seekableEntrySize + seekableFooterSize
+	table := data[len(data)-tableSize-8:]
+	rtest.Equals(t, uint32(seekableSkippableMagic), binary.LittleEndian.Uint32(table))
+	rtest.Equals(t, uint32(tableSize), binary.LittleEndian.Uint32(table[4:]))
+
+	for i := 0; i < frames; i++ {
+		entry := table[8+i*seekableEntrySize:]
+		compressed = append(compressed, int(binary.LittleEndian.Uint32(entry)))
+		decompressed = append(decompressed, int(binary.LittleEndian.Uint32(entry[4:])))
+	}
+	return compressed, decompressed
+}
+
+func TestSeekableWriter(t *testing.T) {
+	dec, err := zstd.NewReader(nil)
+	rtest.OK(t, err)
+	defer dec.Close()
+
+	for _, size := range []int{0, 1, 1000, 4096, 10000} {
+		data := make([]byte, size)
+		_, _ = rand.Read(data[:size/2])
+
+		var buf bytes.Buffer
+		w, err := NewSeekableWriter(&buf, 1000)
+		rtest.OK(t, err)
+		// write in chunks which do not match the frame size
+		for p := data; len(p) > 0; {
+			n := min(len(p), 333)
+			_, err := w.Write(p[:n])
+			rtest.OK(t, err)
+			p = p[n:]
+		}
+		rtest.OK(t, w.Close())
+
+		out := buf.Bytes()
+		compressed, decompressed := readSeekTable(t, out)
+		rtest.Equals(t, (size+999)/1000, len(compressed))
+
+		// each frame can be decompressed on its own
+		offset, pos := 0, 0
+		for i := range compressed {
+			frame, err := dec.DecodeAll(out[offset:offset+compressed[i]], nil)
+			rtest.OK(t, err)
+			rtest.Equals(t, decompressed[i], len(frame))
+			rtest.Assert(t, bytes.Equal(data[pos:pos+len(frame)], frame), "frame %d differs", i)
+			offset += compressed[i]
+			pos += len(frame)
+		}
+		rtest.Equals(t, size, pos)
+
+		// the output is a valid zstd stream
+		r, err := zstd.NewReader(bytes.NewReader(out))
+		rtest.OK(t, err)
+		all, err := io.ReadAll(r)
+		r.Close()
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(data, all), "decompressed data differs for size %d", size)
+	}
+}
+
+func TestSeekableWriterFrameSize(t *testing.T) {
+	for _, size := range []int{-1, 0, MaxSeekableFrameSize + 1} {
+		_, err := NewSeekableWriter(io.Discard, size)
+		rtest.Assert(t, err != nil, "expected error for frame size %d", size)
+	}
+}
@@ -0,0 +1,109 @@
+// Package events defines the events which are emitted while a backup or a
+// restore is running. Both the terminal user interface and programs embedding
+// restic receive them via a Sink.
+package events
+
+import "time"
+
+// ItemType is the type of a file system item.
+type ItemType string
+
+// Item types.
+const (
+	TypeFile  ItemType = "file"
+	TypeDir   ItemType = "dir"
+	TypeOther ItemType = "other"
+)
+
+// Action describes what happened to an item.
+type Action string
+
+// Actions for finished items. New, Modified and Unchanged are used by the
+// backup, the others by the restore.
+const (
+	ActionNew       Action = "new"
+	ActionModified  Action = "modified"
+	ActionUnchanged Action = "unchanged"
+	ActionRestored  Action = "restored"
+	ActionUpdated   Action = "updated"
+	ActionDeleted   Action = "deleted"
+)
+
+// Item describes a finished file, directory or other item.
+type Item struct {
+	Path     string
+	Type     ItemType
+	Action   Action
+	Duration time.Duration
+
+	// Size is the size of the item. For the backup, it is the amount of
+	// file data which was added to the repository.
+	Size uint64
+	// SizeInRepo is the amount of file data added to the repository after
+	// compression. It is only set by the backup.
+	SizeInRepo uint64
+	// MetadataSize and MetadataSizeInRepo are the size of the directory
+	// metadata added to the repository. They are only set by the backup.
+	MetadataSize       uint64
+	MetadataSizeInRepo uint64
+}
+
+// Summary describes a completed operation.
+type Summary struct {
+	// SnapshotID is the ID of the snapshot created by a backup.
+	SnapshotID string
+
+	// FilesNew, FilesModified, FilesUnchanged and the Dirs counts are set
+	// by the backup.
+	FilesNew, FilesModified, FilesUnchanged uint
+	DirsNew, DirsModified, DirsUnchanged    uint
+
+	// FilesRestored, FilesSkipped and FilesDeleted are set by the restore.
+	// The counts include directories and other items.
+	FilesRestored, FilesSkipped, FilesDeleted uint
+
+	// BytesProcessed is the amount of file data which was read during a
+	// backup or written during a restore.
+	BytesProcessed uint64
+	// BytesAdded is the amount of data added to the repository by a backup.
+	BytesAdded uint64
+
+	Start, End time.Time
+}
+
+// Sink receives the events of a running operation. The methods may be called
+// concurrently from several goroutines.
+type Sink interface {
+	// FileStarted is called when reading a file starts.
+	FileStarted(path string)
+	// FileFinished is called once an item has been processed completely.
+	FileFinished(item Item)
+	// BlobUploaded is called for each blob of file data which has been saved.
+	BlobUploaded(size uint64)
+	// Error is called for errors which only affect a single item. If it
+	// returns an error, the operation is aborted.
+	Error(path string, err error) error
+	// Summary is called once the operation has completed successfully.
+	Summary(summary Summary)
+}
+
+// NopSink ignores all events, errors are skipped. It can be embedded to only
+// implement some methods of Sink.
+type NopSink struct{}
+
+var _ Sink = NopSink{}
+
+// FileStarted implements Sink.
+func (NopSink) FileStarted(string) {}
+
+// FileFinished implements Sink.
+func (NopSink) FileFinished(Item) {}
+
+// BlobUploaded implements Sink.
+func (NopSink) BlobUploaded(uint64) {}
+
+// Error implements Sink.
+func (NopSink) Error(string, error) error { return nil }
+
+// Summary implements Sink.
+func (NopSink) Summary(Summary) {}
@@ -0,0 +1,234 @@
+// Package export implements a portable archive format for transferring a
+// single snapshot between repositories without a connection between them.
+//
+// An archive is a tar file. The first entry "header.json" is stored in
+// plaintext and contains the format version and the parameters to derive the
+// archive key from a password. All further entries are encrypted with the
+// archive key: "manifest" contains the snapshot and describes the archive, it
+// is followed by one entry "blobs/<n>" for each tree and data blob used by the
+// snapshot.
+package export
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// Format identifies snapshot export archives.
+const Format = "restic-snapshot-export"
+
+// Version is the version of the archive format written by Write.
+const Version = 1
+
+const (
+	headerName   = "header.json"
+	manifestName = "manifest"
+	blobPrefix   = "blobs/"
+)
+
+// Header is stored unencrypted at the start of an archive.
+type Header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+
+	// KDF parameters used to derive the archive key from the password
+	KDF    string `json:"kdf"`
+	N      int    `json:"N"`
+	R      int    `json:"r"`
+	P      int    `json:"p"`
+	Salt   []byte `json:"salt"`
+	Cipher string `json:"cipher,omitempty"`
+}
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	// Snapshot is the exported snapshot, SnapshotID its ID in the source
+	// repository.
+	Snapshot   *restic.Snapshot `json:"snapshot"`
+	SnapshotID restic.ID        `json:"snapshot_id"`
+
+	// ContentHash and ChunkerPolynomial are taken from the source repository.
+	ContentHash       string      `json:"content_hash"`
+	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+
+	// NodeAttributes lists the attributes which the nodes of the exported
+	// trees can contain.
+	NodeAttributes []string `json:"node_attributes"`
+
+	// Blobs is the number of blob entries in the archive.
+	Blobs int `json:"blobs"`
+}
+
+// NodeAttributes returns the names of the node attributes known to this
+// version of restic.
+func NodeAttributes() []string {
+	var attrs []string
+	t := reflect.TypeOf(restic.Node{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			attrs = append(attrs, name)
+		}
+	}
+	return attrs
+}
+
+// Write exports the snapshot sn with the given id and all blobs it references
+// from repo to w. The archive is encrypted using a key derived from password
+// using params. The index of repo must be loaded. p is increased for each
+// exported blob.
+func Write(ctx context.Context, repo restic.Repository, id restic.ID, sn *restic.Snapshot, w io.Writer, password string, params crypto.Params, p *progress.Counter) error {
+	if sn.Tree == nil {
+		return errors.Errorf("snapshot %v has no tree", id.Str())
+	}
+
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return err
+	}
+	key, err := crypto.KDF(params, salt, password)
+	if err != nil {
+		return err
+	}
+	key.Cipher = repo.Config().Cipher
+
+	blobs := restic.NewBlobSet()
+	if err := restic.FindUsedBlobs(ctx, repo, sn.TreeIDs(), blobs, nil); err != nil {
+		return err
+	}
+	handles, err := sortByLocation(repo, blobs)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		p.SetMax(uint64(len(handles)))
+	}
+
+	aw := &archiveWriter{tw: tar.NewWriter(w), key: key, modTime: time.Now()}
+
+	header, err := json.Marshal(Header{
+		Format:  Format,
+		Version: Version,
+		KDF:     "scrypt",
+		N:       params.N,
+		R:       params.R,
+		P:       params.P,
+		Salt:    salt,
+		Cipher:  key.Cipher,
+	})
+	if err != nil {
+		return err
+	}
+	if err := aw.writeEntry(headerName, header); err != nil {
+		return err
+	}
+
+	manifest, err := json.Marshal(Manifest{
+		Snapshot:          sn,
+		SnapshotID:        id,
+		ContentHash:       repo.Config().ContentHashName(),
+		ChunkerPolynomial: repo.Config().ChunkerPolynomial,
+		NodeAttributes:    NodeAttributes(),
+		Blobs:             len(handles),
+	})
+	if err != nil {
+		return err
+	}
+	if err := aw.writeEncrypted(manifestName, manifest); err != nil {
+		return err
+	}
+
+	var buf []byte
+	for i, h := range handles {
+		buf, err = repo.LoadBlob(ctx, h.Type, h.ID, buf)
+		if err != nil {
+			return fmt.Errorf("loading blob %v failed: %w", h, err)
+		}
+
+		entry := make([]byte, 0, 1+len(h.ID)+len(buf))
+		entry = append(entry, byte(h.Type))
+		entry = append(entry, h.ID[:]...)
+		entry = append(entry, buf...)
+		if err := aw.writeEncrypted(fmt.Sprintf("%v%08d", blobPrefix, i), entry); err != nil {
+			return err
+		}
+		if p != nil {
+			p.Add(1)
+		}
+	}
+
+	debug.Log("exported snapshot %v with %d blobs", id, len(handles))
+	return aw.tw.Close()
+}
+
+// sortByLocation sorts the blobs by their location in the repository such that
+// they can be read sequentially.
+func sortByLocation(repo restic.Repository, blobs restic.BlobSet) (restic.BlobHandles, error) {
+	packed := make([]restic.PackedBlob, 0, len(blobs))
+	for h := range blobs {
+		pbs := repo.LookupBlob(h.Type, h.ID)
+		if len(pbs) == 0 {
+			return nil, errors.Errorf("blob %v not found in index", h)
+		}
+		packed = append(packed, pbs[0])
+	}
+
+	sort.Slice(packed, func(i, j int) bool {
+		if packed[i].PackID != packed[j].PackID {
+			return bytes.Compare(packed[i].PackID[:], packed[j].PackID[:]) < 0
+		}
+		return packed[i].Offset < packed[j].Offset
+	})
+
+	handles := make(restic.BlobHandles, 0, len(packed))
+	for _, pb := range packed {
+		handles = append(handles, pb.BlobHandle)
+	}
+	return handles, nil
+}
+
+type archiveWriter struct {
+	tw      *tar.Writer
+	key     *crypto.Key
+	modTime time.Time
+}
+
+func (aw *archiveWriter) writeEntry(name string, data []byte) error {
+	err := aw.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  aw.modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = aw.tw.Write(data)
+	return err
+}
+
+// writeEncrypted encrypts data with the archive key, the nonce is prepended to
+// the ciphertext.
+func (aw *archiveWriter) writeEncrypted(name string, data []byte) error {
+	nonce := crypto.NewRandomNonce()
+	ciphertext := make([]byte, 0, crypto.CiphertextLength(len(data)))
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = aw.key.Seal(ciphertext, nonce, data, nil)
+	return aw.writeEntry(name, ciphertext)
+}
@@ -0,0 +1,79 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/export"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testParams = crypto.Params{N: 128, R: 1, P: 1}
+
+func exportTestSnapshot(t *testing.T) (restic.Repository, restic.ID, *restic.Snapshot, []byte) {
+	repo := repository.TestRepository(t)
+	sn := restic.TestCreateSnapshot(t, repo, time.Unix(1700000000, 0), 3)
+	rtest.OK(t, repo.LoadIndex(context.TODO(), nil))
+
+	var buf bytes.Buffer
+	rtest.OK(t, export.Write(context.TODO(), repo, *sn.ID(), sn, &buf, "secret", testParams, nil))
+	return repo, *sn.ID(), sn, buf.Bytes()
+}
+
+func usedBlobs(t *testing.T, repo restic.Repository, tree restic.ID) restic.BlobSet {
+	blobs := restic.NewBlobSet()
+	rtest.OK(t, restic.FindUsedBlobs(context.TODO(), repo, restic.IDs{tree}, blobs, nil))
+	return blobs
+}
+
+func TestExportImport(t *testing.T) {
+	src, id, sn, archive := exportTestSnapshot(t)
+	dst := repository.TestRepository(t)
+
+	rd, err := export.Open(bytes.NewReader(archive), "secret")
+	rtest.OK(t, err)
+	rtest.Equals(t, export.Version, rd.Header.Version)
+	rtest.Equals(t, id, rd.Manifest.SnapshotID)
+	rtest.Equals(t, sn.Tree, rd.Manifest.Snapshot.Tree)
+	rtest.Equals(t, 0, len(rd.UnknownAttributes()))
+
+	blobs := usedBlobs(t, src, *sn.Tree)
+	rtest.Equals(t, len(blobs), rd.Manifest.Blobs)
+
+	rtest.OK(t, rd.Import(context.TODO(), dst, nil))
+	rtest.Equals(t, blobs, usedBlobs(t, dst, *sn.Tree))
+
+	// importing again does not add blobs
+	rd, err = export.Open(bytes.NewReader(archive), "secret")
+	rtest.OK(t, err)
+	rtest.OK(t, rd.Import(context.TODO(), dst, nil))
+	rtest.Equals(t, len(blobs), len(usedBlobs(t, dst, *sn.Tree)))
+}
+
+func TestImportErrors(t *testing.T) {
+	_, _, _, archive := exportTestSnapshot(t)
+
+	_, err := export.Open(bytes.NewReader(archive), "wrong")
+	rtest.Assert(t, errors.Is(err, export.ErrWrongPassword), "unexpected error %v", err)
+
+	// corrupt the last blob entry, its content follows the header block which
+	// starts with the name of the entry
+	corrupted := bytes.Clone(archive)
+	corrupted[bytes.LastIndex(archive, []byte("blobs/"))+512+20] ^= 0x01
+	rd, err := export.Open(bytes.NewReader(corrupted), "secret")
+	rtest.OK(t, err)
+	err = rd.Import(context.TODO(), repository.TestRepository(t), nil)
+	rtest.Assert(t, errors.Is(err, crypto.ErrUnauthenticated), "unexpected error %v", err)
+
+	// a truncated archive is missing blobs
+	rd, err = export.Open(bytes.NewReader(archive[:len(archive)/2]), "secret")
+	rtest.OK(t, err)
+	err = rd.Import(context.TODO(), repository.TestRepository(t), nil)
+	rtest.Assert(t, err != nil, "missing error for truncated archive")
+}
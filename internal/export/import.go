@@ -0,0 +1,197 @@
+package export
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrWrongPassword is returned by Open if the archive cannot be decrypted
+// using the password.
+var ErrWrongPassword = errors.New("wrong password or corrupted archive")
+
+// Reader reads an archive written by Write.
+type Reader struct {
+	Header   Header
+	Manifest Manifest
+
+	tr  *tar.Reader
+	key *crypto.Key
+}
+
+// Open reads the header and the manifest of the archive from r and decrypts
+// them using a key derived from password.
+func Open(r io.Reader, password string) (*Reader, error) {
+	rd := &Reader{tr: tar.NewReader(r)}
+
+	buf, err := rd.readEntry(headerName)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &rd.Header); err != nil {
+		return nil, fmt.Errorf("invalid archive header: %w", err)
+	}
+	if rd.Header.Format != Format {
+		return nil, errors.Errorf("unknown archive format %q", rd.Header.Format)
+	}
+	if rd.Header.Version < 1 || rd.Header.Version > Version {
+		return nil, errors.Errorf("unsupported archive version %d", rd.Header.Version)
+	}
+	if rd.Header.KDF != "scrypt" {
+		return nil, errors.Errorf("unsupported KDF %q", rd.Header.KDF)
+	}
+	if !crypto.ValidCipher(rd.Header.Cipher) {
+		return nil, errors.Errorf("unsupported cipher %q", rd.Header.Cipher)
+	}
+
+	params := crypto.Params{N: rd.Header.N, R: rd.Header.R, P: rd.Header.P}
+	rd.key, err = crypto.KDF(params, rd.Header.Salt, password)
+	if err != nil {
+		return nil, err
+	}
+	rd.key.Cipher = rd.Header.Cipher
+
+	buf, err = rd.readEncrypted(manifestName)
+	if err != nil {
+		if errors.Is(err, crypto.ErrUnauthenticated) {
+			return nil, ErrWrongPassword
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &rd.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid archive manifest: %w", err)
+	}
+	if rd.Manifest.Snapshot == nil || rd.Manifest.Snapshot.Tree == nil {
+		return nil, errors.New("archive manifest contains no snapshot")
+	}
+	return rd, nil
+}
+
+// UnknownAttributes returns the node attributes listed in the manifest which
+// are unknown to this version of restic.
+func (rd *Reader) UnknownAttributes() []string {
+	known := make(map[string]struct{})
+	for _, attr := range NodeAttributes() {
+		known[attr] = struct{}{}
+	}
+
+	var unknown []string
+	for _, attr := range rd.Manifest.NodeAttributes {
+		if _, ok := known[attr]; !ok {
+			unknown = append(unknown, attr)
+		}
+	}
+	return unknown
+}
+
+// Import saves all blobs of the archive which are not yet contained in repo.
+// The ID of each blob is verified. The snapshot from the manifest is not saved.
+// p is increased for each blob read from the archive.
+func (rd *Reader) Import(ctx context.Context, repo restic.Repository, p *progress.Counter) error {
+	if repo.Config().ContentHashName() != rd.Manifest.ContentHash {
+		return errors.Errorf("cannot import snapshot into a repository with a different content hash (%v and %v)",
+			rd.Manifest.ContentHash, repo.Config().ContentHashName())
+	}
+	if p != nil {
+		p.SetMax(uint64(rd.Manifest.Blobs))
+	}
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+	wg.Go(func() error {
+		if err := rd.importBlobs(wgCtx, repo, p); err != nil {
+			return err
+		}
+		return repo.Flush(wgCtx)
+	})
+	return wg.Wait()
+}
+
+func (rd *Reader) importBlobs(ctx context.Context, repo restic.Repository, p *progress.Counter) error {
+	var added int
+	for i := 0; i < rd.Manifest.Blobs; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		buf, err := rd.readEncrypted(fmt.Sprintf("%v%08d", blobPrefix, i))
+		if err != nil {
+			return err
+		}
+		if len(buf) < 1+len(restic.ID{}) {
+			return errors.Errorf("blob entry %d is too short", i)
+		}
+
+		var h restic.BlobHandle
+		h.Type = restic.BlobType(buf[0])
+		copy(h.ID[:], buf[1:])
+		data := buf[1+len(h.ID):]
+		if h.Type != restic.DataBlob && h.Type != restic.TreeBlob {
+			return errors.Errorf("blob entry %d has invalid type %v", i, h.Type)
+		}
+
+		if id := repo.Config().BlobHash(data); !id.Equal(h.ID) {
+			return errors.Errorf("blob %v is corrupted, the content has ID %v", h, id.Str())
+		}
+
+		if _, ok := repo.LookupBlobSize(h.Type, h.ID); !ok {
+			if _, _, _, err := repo.SaveBlob(ctx, h.Type, data, h.ID, false); err != nil {
+				return err
+			}
+			added++
+		}
+		if p != nil {
+			p.Add(1)
+		}
+	}
+
+	if _, err := rd.tr.Next(); err != io.EOF {
+		return errors.New("archive contains more entries than listed in the manifest")
+	}
+	debug.Log("imported %d of %d blobs", added, rd.Manifest.Blobs)
+	return nil
+}
+
+// readEntry returns the content of the next entry, which must have the given
+// name.
+func (rd *Reader) readEntry(name string) ([]byte, error) {
+	hdr, err := rd.tr.Next()
+	if err == io.EOF {
+		return nil, errors.Errorf("archive is truncated, entry %v is missing", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	if hdr.Name != name {
+		return nil, errors.Errorf("invalid archive: expected entry %v, found %v", name, hdr.Name)
+	}
+	return io.ReadAll(rd.tr)
+}
+
+// readEncrypted returns the decrypted content of the next entry, which must
+// have the given name.
+func (rd *Reader) readEncrypted(name string) ([]byte, error) {
+	buf, err := rd.readEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < rd.key.NonceSize() {
+		return nil, errors.Errorf("entry %v is too short", name)
+	}
+
+	nonce, ciphertext := buf[:rd.key.NonceSize()], buf[rd.key.NonceSize():]
+	plaintext, err := rd.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting entry %v failed: %w", name, err)
+	}
+	return plaintext, nil
+}
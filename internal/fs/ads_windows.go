@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unsafe"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32          = windows.NewLazySystemDLL("kernel32.dll")
+	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+)
+
+// findStreamInfoStandard is the FindStreamInfoStandard information level.
+const findStreamInfoStandard = 0
+
+// win32FindStreamData is the WIN32_FIND_STREAM_DATA structure.
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [windows.MAX_PATH + 36]uint16
+}
+
+// listAlternateStreams returns the names of the alternate data streams of the
+// file at path. The unnamed default stream, which contains the content of the
+// file, is not included.
+func listAlternateStreams(path string) ([]string, error) {
+	pathPointer, err := windows.UTF16PtrFromString(fixpath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var data win32FindStreamData
+	h, _, err := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(pathPointer)), findStreamInfoStandard,
+		uintptr(unsafe.Pointer(&data)), 0)
+	if windows.Handle(h) == windows.InvalidHandle {
+		if errors.Is(err, windows.ERROR_HANDLE_EOF) || errors.Is(err, windows.ERROR_INVALID_PARAMETER) {
+			// no streams or the file system does not support them
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "FindFirstStreamW")
+	}
+	defer func() {
+		_ = windows.FindClose(windows.Handle(h))
+	}()
+
+	var names []string
+	for {
+		// stream names have the form ":name:$DATA", the default stream is "::$DATA"
+		name := windows.UTF16ToString(data.StreamName[:])
+		name = strings.TrimSuffix(strings.TrimPrefix(name, ":"), ":$DATA")
+		if name != "" {
+			names = append(names, name)
+		}
+
+		r, _, err := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data)))
+		if r == 0 {
+			if errors.Is(err, windows.ERROR_HANDLE_EOF) {
+				return names, nil
+			}
+			return nil, errors.Wrap(err, "FindNextStreamW")
+		}
+	}
+}
+
+func openAlternateStream(path, name string) (io.ReadCloser, error) {
+	return os.Open(fixpath(path + ":" + name))
+}
+
+// CreateAlternateStream creates or truncates the alternate data stream name
+// of the file at path and opens it for writing.
+func CreateAlternateStream(path, name string) (*os.File, error) {
+	return os.OpenFile(fixpath(path+":"+name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+}
@@ -4,7 +4,9 @@
 package fs
 
 import (
+	"encoding/binary"
 	"fmt"
+	"sync"
 	"syscall"
 	"unsafe"
 
@@ -15,16 +17,96 @@ import (
 // extendedAttribute is a type alias for winio.ExtendedAttribute
 type extendedAttribute = winio.ExtendedAttribute
 
+const (
+	// eaBufferSize is the initial size of the buffers used to query extended attributes.
+	eaBufferSize = 1024
+	// maxPooledEABufferSize limits the size of buffers kept for reuse. The
+	// extended attributes of a file are limited to 64 KiB on NTFS.
+	maxPooledEABufferSize = 128 * 1024
+
+	// size of the FILE_FULL_EA_INFORMATION header
+	eaHeaderSize = 8
+)
+
+// eaBufferPool holds buffers for querying and encoding extended attributes. The
+// buffers keep the size they were grown to, which avoids repeatedly growing
+// them for files with large extended attributes.
+var eaBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, eaBufferSize)
+		return &buf
+	},
+}
+
+func getEABuffer() *[]byte {
+	return eaBufferPool.Get().(*[]byte)
+}
+
+func putEABuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledEABufferSize {
+		return
+	}
+	eaBufferPool.Put(buf)
+}
+
 // encodeExtendedAttributes encodes the extended attributes to a byte slice.
 func encodeExtendedAttributes(attrs []extendedAttribute) ([]byte, error) {
-	return winio.EncodeExtendedAttributes(attrs)
+	return appendExtendedAttributes(nil, attrs)
+}
+
+// appendExtendedAttributes appends the encoded extended attributes to buf
+// using the same format as winio.EncodeExtendedAttributes.
+func appendExtendedAttributes(buf []byte, attrs []extendedAttribute) ([]byte, error) {
+	for i := range attrs {
+		ea := &attrs[i]
+		if int(uint8(len(ea.Name))) != len(ea.Name) {
+			return nil, fmt.Errorf("extended attribute name %q too large", ea.Name)
+		}
+		if int(uint16(len(ea.Value))) != len(ea.Value) {
+			return nil, fmt.Errorf("value of extended attribute %q too large", ea.Name)
+		}
+
+		entrySize := eaHeaderSize + len(ea.Name) + 1 + len(ea.Value)
+		withPadding := (entrySize + 3) &^ 3
+		nextOffset := uint32(0)
+		if i != len(attrs)-1 {
+			nextOffset = uint32(withPadding)
+		}
+
+		buf = binary.LittleEndian.AppendUint32(buf, nextOffset)
+		buf = append(buf, ea.Flags, uint8(len(ea.Name)))
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(ea.Value)))
+		buf = append(buf, ea.Name...)
+		buf = append(buf, 0)
+		buf = append(buf, ea.Value...)
+		for j := entrySize; j < withPadding; j++ {
+			buf = append(buf, 0)
+		}
+	}
+	return buf, nil
 }
 
 // decodeExtendedAttributes decodes the extended attributes from a byte slice.
+// The values of the returned attributes reference data.
 func decodeExtendedAttributes(data []byte) ([]extendedAttribute, error) {
 	return winio.DecodeExtendedAttributes(data)
 }
 
+// detachExtendedAttributes copies the values of attrs into a single new
+// allocation, such that the buffer they were decoded from can be reused.
+func detachExtendedAttributes(attrs []extendedAttribute) {
+	size := 0
+	for _, ea := range attrs {
+		size += len(ea.Value)
+	}
+	values := make([]byte, 0, size)
+	for i := range attrs {
+		start := len(values)
+		values = append(values, attrs[i].Value...)
+		attrs[i].Value = values[start:len(values):len(values)]
+	}
+}
+
 // The code below was copied over from https://github.com/microsoft/go-winio/blob/main/pipe.go under MIT license.
 
 // The MIT License (MIT)
@@ -98,13 +180,14 @@ const (
 // The extended file attribute names in windows are case-insensitive and when fetching
 // the attributes the names are generally returned in UPPER case.
 func fgetEA(handle windows.Handle) ([]extendedAttribute, error) {
-	// default buffer size to start with
-	bufLen := 1024
-	buf := make([]byte, bufLen)
+	bufp := getEABuffer()
+	defer putEABuffer(bufp)
+
+	buf := (*bufp)[:cap(*bufp)]
 	var iosb ioStatusBlock
 	// keep increasing the buffer size until it is large enough
 	for {
-		status := getFileEA(handle, &iosb, &buf[0], uint32(bufLen), false, 0, 0, nil, true)
+		status := getFileEA(handle, &iosb, &buf[0], uint32(len(buf)), false, 0, 0, nil, true)
 
 		if status == STATUS_NO_EAS_ON_FILE {
 			//If status is -1073741742, no extended attributes were found
@@ -114,24 +197,41 @@ func fgetEA(handle windows.Handle) ([]extendedAttribute, error) {
 		if err != nil {
 			// convert ntstatus code to windows error
 			if err == windows.ERROR_INSUFFICIENT_BUFFER || err == windows.ERROR_MORE_DATA {
-				bufLen *= 2
-				buf = make([]byte, bufLen)
+				// the grown buffer is returned to the pool for later calls
+				buf = make([]byte, 2*len(buf))
+				*bufp = buf
 				continue
 			}
 			return nil, fmt.Errorf("get file EA failed with: %w", err)
 		}
 		break
 	}
-	return decodeExtendedAttributes(buf)
+
+	// decoding stops at the last entry, thus data of a previous call which
+	// may remain at the end of the reused buffer is ignored
+	eas, err := decodeExtendedAttributes(buf)
+	if err != nil {
+		return nil, err
+	}
+	detachExtendedAttributes(eas)
+	return eas, nil
 }
 
 // fsetEA sets the extended attributes for the file represented by `handle`.  The
 // handle must have been opened with the file access flag FILE_WRITE_EA(0x10).
 func fsetEA(handle windows.Handle, attrs []extendedAttribute) error {
-	encodedEA, err := encodeExtendedAttributes(attrs)
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	bufp := getEABuffer()
+	defer putEABuffer(bufp)
+
+	encodedEA, err := appendExtendedAttributes((*bufp)[:0], attrs)
 	if err != nil {
 		return fmt.Errorf("failed to encoded extended attributes: %w", err)
 	}
+	*bufp = encodedEA
 
 	var iosb ioStatusBlock
 
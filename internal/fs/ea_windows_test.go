@@ -4,6 +4,7 @@
 package fs
 
 import (
+	"bytes"
 	"crypto/rand"
 	"fmt"
 	"math/big"
@@ -246,6 +247,47 @@ func testSetGetEA(t *testing.T, path string, handle windows.Handle, testEAs []ex
 	}
 }
 
+// TestGetEAReusedBuffer checks that attributes read using a grown and reused
+// buffer are correct and not modified by later calls.
+func TestGetEAReusedBuffer(t *testing.T) {
+	largePath, largeFile := setupTestFile(t)
+	largeEAs := generateTestEAs(t, 3, largePath)
+	for i := range largeEAs {
+		// requires growing the buffer
+		largeEAs[i].Value = bytes.Repeat([]byte{byte(i + 1)}, 2000)
+	}
+	largeHandle := openFile(t, largePath, windows.FILE_ATTRIBUTE_NORMAL)
+	defer testCloseFileHandle(t, largePath, largeFile, largeHandle)
+
+	smallPath, smallFile := setupTestFile(t)
+	smallEAs := generateTestEAs(t, 1, smallPath)
+	smallHandle := openFile(t, smallPath, windows.FILE_ATTRIBUTE_NORMAL)
+	defer testCloseFileHandle(t, smallPath, smallFile, smallHandle)
+
+	if err := fsetEA(largeHandle, largeEAs); err != nil {
+		t.Fatalf("set EA for path %s failed: %s", largePath, err)
+	}
+	if err := fsetEA(smallHandle, smallEAs); err != nil {
+		t.Fatalf("set EA for path %s failed: %s", smallPath, err)
+	}
+
+	readLarge, err := fgetEA(largeHandle)
+	if err != nil {
+		t.Fatalf("get EA for path %s failed: %s", largePath, err)
+	}
+	readSmall, err := fgetEA(smallHandle)
+	if err != nil {
+		t.Fatalf("get EA for path %s failed: %s", smallPath, err)
+	}
+
+	if !reflect.DeepEqual(readLarge, largeEAs) {
+		t.Fatalf("EAs read from path %s don't match", largePath)
+	}
+	if !reflect.DeepEqual(readSmall, smallEAs) {
+		t.Fatalf("EAs read from path %s don't match, expected: %+v, found: %+v", smallPath, smallEAs, readSmall)
+	}
+}
+
 func TestPathSupportsExtendedAttributes(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -2,8 +2,11 @@ package fs
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+
+	"github.com/restic/restic/internal/errors"
 )
 
 // MkdirAll creates a directory named path, along with any necessary parents,
@@ -68,6 +71,51 @@ func ResetPermissions(path string) error {
 	return nil
 }
 
+// metadataPrefetcher is implemented by directories which can retrieve
+// metadata of their entries in the background.
+type metadataPrefetcher interface {
+	prefetchMetadata(names []string)
+}
+
+// PrefetchMetadata starts retrieving expensive metadata, like the security
+// descriptors on Windows, for the entries of dir in the background. This is a
+// no-op for file systems which do not support it.
+func PrefetchMetadata(dir File, names []string) {
+	if p, ok := dir.(metadataPrefetcher); ok {
+		p.prefetchMetadata(names)
+	}
+}
+
+// ErrAlternateStreamsNotSupported is returned for alternate data streams on
+// platforms and file systems which do not support them.
+var ErrAlternateStreamsNotSupported = errors.New("alternate data streams are not supported")
+
+// alternateStreamReader is implemented by files which can have alternate data
+// streams.
+type alternateStreamReader interface {
+	alternateStreams() ([]string, error)
+	openAlternateStream(name string) (io.ReadCloser, error)
+}
+
+// AlternateStreams returns the names of the alternate data streams of the file
+// f, which must have been opened for reading. The list is empty for file
+// systems which do not support alternate data streams.
+func AlternateStreams(f File) ([]string, error) {
+	if r, ok := f.(alternateStreamReader); ok {
+		return r.alternateStreams()
+	}
+	return nil, nil
+}
+
+// OpenAlternateStream opens the alternate data stream name of the file f for
+// reading.
+func OpenAlternateStream(f File, name string) (io.ReadCloser, error) {
+	if r, ok := f.(alternateStreamReader); ok {
+		return r.openAlternateStream(name)
+	}
+	return nil, ErrAlternateStreamsNotSupported
+}
+
 // Readdirnames returns a list of file in a directory. Flags are passed to fs.OpenFile.
 // O_RDONLY and O_DIRECTORY are implied.
 func Readdirnames(filesystem FS, dir string, flags int) ([]string, error) {
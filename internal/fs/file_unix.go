@@ -4,6 +4,7 @@
 package fs
 
 import (
+	"io"
 	"os"
 	"syscall"
 )
@@ -48,3 +49,20 @@ func chmod(name string, mode os.FileMode) error {
 
 	return err
 }
+
+// prefetchSecurityDescriptors is a no-op, security descriptors only exist on windows.
+func prefetchSecurityDescriptors(_ string, _ []string) {}
+
+// listAlternateStreams returns no streams, alternate data streams only exist on windows.
+func listAlternateStreams(_ string) ([]string, error) {
+	return nil, nil
+}
+
+func openAlternateStream(_, _ string) (io.ReadCloser, error) {
+	return nil, ErrAlternateStreamsNotSupported
+}
+
+// CreateAlternateStream is not supported, alternate data streams only exist on windows.
+func CreateAlternateStream(_, _ string) (*os.File, error) {
+	return nil, ErrAlternateStreamsNotSupported
+}
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 
@@ -167,6 +168,18 @@ func (f *localFile) Readdirnames(n int) ([]string, error) {
 	return f.f.Readdirnames(n)
 }
 
+func (f *localFile) prefetchMetadata(names []string) {
+	prefetchSecurityDescriptors(f.name, names)
+}
+
+func (f *localFile) alternateStreams() ([]string, error) {
+	return listAlternateStreams(f.name)
+}
+
+func (f *localFile) openAlternateStream(name string) (io.ReadCloser, error) {
+	return openAlternateStream(f.name, name)
+}
+
 func (f *localFile) Close() error {
 	if f.f != nil {
 		return f.f.Close()
@@ -1,14 +1,17 @@
 package fs
 
 import (
+	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
 )
 
 // VSSConfig holds extended options of windows volume shadow copy service.
@@ -17,6 +20,10 @@ type VSSConfig struct {
 	ExcludeVolumes        string        `option:"exclude-volumes" help:"semicolon separated list of volumes to exclude from snapshotting (ex. 'c:\\;e:\\mnt;\\\\?\\Volume{...}')"`
 	Timeout               time.Duration `option:"timeout" help:"time that the VSS can spend creating snapshot before timing out"`
 	Provider              string        `option:"provider" help:"VSS provider identifier which will be used for snapshotting"`
+	Remote                bool          `option:"remote" help:"request shadow copies of administrative shares on remote hosts (ex. '\\\\host\\c$') via WMI"`
+
+	// Writers is set by the --vss-writers option of the backup command.
+	Writers bool
 }
 
 func init() {
@@ -57,6 +64,7 @@ type VolumeFilter func(volume string) bool
 type LocalVss struct {
 	FS
 	snapshots             map[string]VssSnapshot
+	remoteSnapshots       map[string]RemoteShadowCopy
 	failedSnapshots       map[string]struct{}
 	mutex                 sync.RWMutex
 	msgError              ErrorHandler
@@ -65,6 +73,12 @@ type LocalVss struct {
 	excludeVolumes        map[string]struct{}
 	timeout               time.Duration
 	provider              string
+	remote                bool
+	writers               bool
+
+	systemDrive        string
+	sharedVolumes      map[string]bool
+	sharedVolumesMutex sync.Mutex
 }
 
 // statically ensure that LocalVss implements FS.
@@ -78,7 +92,12 @@ func parseMountPoints(list string, msgError ErrorHandler) (volumes map[string]st
 		return
 	}
 	for _, s := range strings.Split(list, ";") {
-		if v, err := getVolumeNameForVolumeMountPoint(s); err != nil {
+		getVolumeName := getVolumeNameForVolumeMountPoint
+		if root, ok := SharedVolume(s); ok {
+			s = root
+			getVolumeName = getSharedVolumeName
+		}
+		if v, err := getVolumeName(s); err != nil {
 			msgError(s, errors.Errorf("failed to parse vss.exclude-volumes [%s]: %s", s, err))
 		} else {
 			if volumes == nil {
@@ -97,6 +116,7 @@ func NewLocalVss(msgError ErrorHandler, msgMessage MessageHandler, cfg VSSConfig
 	return &LocalVss{
 		FS:                    Local{},
 		snapshots:             make(map[string]VssSnapshot),
+		remoteSnapshots:       make(map[string]RemoteShadowCopy),
 		failedSnapshots:       make(map[string]struct{}),
 		msgError:              msgError,
 		msgMessage:            msgMessage,
@@ -104,6 +124,10 @@ func NewLocalVss(msgError ErrorHandler, msgMessage MessageHandler, cfg VSSConfig
 		excludeVolumes:        parseMountPoints(cfg.ExcludeVolumes, msgError),
 		timeout:               cfg.Timeout,
 		provider:              cfg.Provider,
+		remote:                cfg.Remote,
+		writers:               cfg.Writers,
+		systemDrive:           systemDrive(),
+		sharedVolumes:         make(map[string]bool),
 	}
 }
 
@@ -122,6 +146,53 @@ func (fs *LocalVss) DeleteSnapshots() {
 	}
 
 	fs.snapshots = activeSnapshots
+
+	activeRemoteSnapshots := make(map[string]RemoteShadowCopy)
+
+	for share, snapshot := range fs.remoteSnapshots {
+		if err := snapshot.Delete(); err != nil {
+			fs.msgError(share, errors.Errorf("failed to delete remote shadow copy: %s", err))
+			activeRemoteSnapshots[share] = snapshot
+		}
+	}
+
+	fs.remoteSnapshots = activeRemoteSnapshots
+}
+
+// Writers returns the VSS writers whose components were included in the
+// snapshots, ordered by volume.
+func (fs *LocalVss) Writers() []restic.VSSWriter {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	volumes := make([]string, 0, len(fs.snapshots))
+	for volume := range fs.snapshots {
+		volumes = append(volumes, volume)
+	}
+	sort.Strings(volumes)
+
+	var writers []restic.VSSWriter
+	for _, volume := range volumes {
+		writers = append(writers, fs.snapshots[volume].writers...)
+	}
+	return writers
+}
+
+// Documents returns the VSS metadata documents of the snapshots, that is the
+// Backup Components Document and the Writer Metadata Documents. The documents
+// of each snapshot are stored in a directory named after its volume.
+func (fs *LocalVss) Documents() []restic.AuxiliaryDocument {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	var docs []restic.AuxiliaryDocument
+	for volume, snapshot := range fs.snapshots {
+		dir := vssDocumentDir(volume)
+		for _, doc := range snapshot.documents {
+			docs = append(docs, restic.AuxiliaryDocument{Path: path.Join(dir, doc.Path), Data: doc.Data})
+		}
+	}
+	return docs
 }
 
 // OpenFile wraps the OpenFile method of the underlying file system.
@@ -158,7 +229,10 @@ func (fs *LocalVss) snapshotPath(path string) string {
 	fixPath := fixpath(path)
 
 	if strings.HasPrefix(fixPath, `\\?\UNC\`) {
-		// UNC network shares are currently not supported so we access the regular file
+		if host, share, rest, ok := parseAdminShare(fixPath); ok && fs.remote {
+			return fs.remoteSnapshotPath(path, host, share, rest)
+		}
+		// Other UNC network shares are currently not supported so we access the regular file
 		// without snapshotting
 		// TODO: right now there is a problem in fixpath(): "\\host\share" is not returned as a UNC path
 		//       "\\host\share\" is returned as a valid UNC path
@@ -166,6 +240,10 @@ func (fs *LocalVss) snapshotPath(path string) string {
 	}
 
 	fixPath = strings.TrimPrefix(fixPath, `\\?\`)
+	if root, ok := fs.sharedVolumeRoot(fixPath); ok {
+		return fs.sharedVolumeSnapshotPath(path, fixPath, root)
+	}
+
 	fixPathLower := strings.ToLower(fixPath)
 	volumeName := filepath.VolumeName(fixPath)
 	volumeNameLower := strings.ToLower(volumeName)
@@ -199,7 +277,7 @@ func (fs *LocalVss) snapshotPath(path string) string {
 					}
 				}
 
-				if snapshot, err := NewVssSnapshot(fs.provider, vssVolume, fs.timeout, includeVolume, fs.msgError); err != nil {
+				if snapshot, err := NewVssSnapshot(fs.provider, vssVolume, fs.timeout, includeVolume, fs.writers, fs.msgError); err != nil {
 					fs.msgError(vssVolume, errors.Errorf("failed to create snapshot for [%s]: %s",
 						vssVolume, err))
 					fs.failedSnapshots[volumeNameLower] = struct{}{}
@@ -216,6 +294,9 @@ func (fs *LocalVss) snapshotPath(path string) string {
 							fs.msgMessage(" - %s%s\n", mp, info)
 						}
 					}
+					for _, w := range snapshot.writers {
+						fs.msgMessage("included %d components of VSS writer %s\n", len(w.Components), w.Name)
+					}
 				}
 			}
 		}
@@ -268,3 +349,105 @@ func (fs *LocalVss) snapshotPath(path string) string {
 
 	return snapshotPath
 }
+
+// remoteSnapshotPath returns the path inside a shadow copy of an
+// administrative share on a remote host. The shadow copy is requested via WMI
+// when the share is accessed for the first time. If that fails, the original
+// path is returned as a fallback.
+func (fs *LocalVss) remoteSnapshotPath(path, host, share, rest string) string {
+	key := strings.ToLower(host + `\` + share)
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	snapshot, ok := fs.remoteSnapshots[key]
+	if !ok {
+		if _, failed := fs.failedSnapshots[key]; failed {
+			return path
+		}
+
+		target := `\\` + host + `\` + share
+		fs.msgMessage("creating remote shadow copy for [%s]\n", target)
+		var err error
+		snapshot, err = NewRemoteShadowCopy(host, share[0])
+		if err != nil {
+			fs.msgError(target, errors.Errorf("failed to create remote shadow copy for [%s]: %s", target, err))
+			fs.failedSnapshots[key] = struct{}{}
+			return path
+		}
+		fs.remoteSnapshots[key] = snapshot
+		fs.msgMessage("successfully created remote shadow copy for [%s]\n", target)
+	}
+
+	root := snapshot.Path(share)
+	if rest == "" {
+		return root + string(filepath.Separator)
+	}
+	return fs.Join(root, rest)
+}
+
+// sharedVolumeRoot returns the root directory of the cluster shared volume
+// path is located on. The result is cached for each volume.
+func (fs *LocalVss) sharedVolumeRoot(path string) (string, bool) {
+	root, ok := sharedVolumeCandidate(fs.systemDrive, path)
+	if !ok {
+		return "", false
+	}
+	key := strings.ToLower(root)
+
+	fs.sharedVolumesMutex.Lock()
+	defer fs.sharedVolumesMutex.Unlock()
+
+	isShared, ok := fs.sharedVolumes[key]
+	if !ok {
+		isShared = isSharedVolume(root)
+		fs.sharedVolumes[key] = isShared
+	}
+	return root, isShared
+}
+
+// sharedVolumeSnapshotPath returns the path inside a VSS snapshot of the
+// cluster shared volume mounted at root. Cluster shared volumes are not
+// mount points of the system volume, so a separate snapshot is created for
+// each of them. If that fails, the original path is returned as a fallback.
+func (fs *LocalVss) sharedVolumeSnapshotPath(path, fixPath, root string) string {
+	key := strings.ToLower(root)
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	snapshot, ok := fs.snapshots[key]
+	if !ok {
+		if _, failed := fs.failedSnapshots[key]; failed {
+			return path
+		}
+
+		volume, err := getSharedVolumeName(root)
+		if err != nil {
+			fs.msgError(root, errors.Errorf("failed to get volume of cluster shared volume [%s]: %s", root, err))
+			fs.failedSnapshots[key] = struct{}{}
+			return path
+		}
+		if _, excluded := fs.excludeVolumes[strings.ToLower(volume)]; excluded {
+			fs.msgMessage("snapshots for [%s] excluded by user\n", root)
+			fs.failedSnapshots[key] = struct{}{}
+			return path
+		}
+
+		fs.msgMessage("creating VSS snapshot for cluster shared volume [%s]\n", root)
+		snapshot, err = NewVssSnapshot(fs.provider, volume, fs.timeout, nil, fs.writers, fs.msgError)
+		if err != nil {
+			fs.msgError(root, errors.Errorf("failed to create snapshot for [%s]: %s", root, err))
+			fs.failedSnapshots[key] = struct{}{}
+			return path
+		}
+		fs.snapshots[key] = snapshot
+		fs.msgMessage("successfully created snapshot for [%s]\n", root)
+	}
+
+	rel := fixPath[len(root):]
+	if rel == "" {
+		return snapshot.GetSnapshotDeviceObject() + string(filepath.Separator)
+	}
+	return fs.Join(snapshot.GetSnapshotDeviceObject(), rel)
+}
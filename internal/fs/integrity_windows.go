@@ -0,0 +1,168 @@
+package fs
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// fileSupportsIntegrityStreams is the FILE_SUPPORTS_INTEGRITY_STREAMS
+	// filesystem flag, which is set for ReFS volumes.
+	fileSupportsIntegrityStreams = 0x04000000
+	// fsctlGetIntegrityInformation is FSCTL_GET_INTEGRITY_INFORMATION.
+	fsctlGetIntegrityInformation = 0x9027C
+)
+
+// integritySupportedVolumesMap is a map of volumes to boolean values indicating if they support integrity streams.
+var integritySupportedVolumesMap = sync.Map{}
+
+// getIntegrityInformationBuffer is the FSCTL_GET_INTEGRITY_INFORMATION_BUFFER structure.
+type getIntegrityInformationBuffer struct {
+	ChecksumAlgorithm        uint16
+	Reserved                 uint16
+	Flags                    uint32
+	ChecksumChunkSizeInBytes uint32
+	ClusterSizeInBytes       uint32
+}
+
+// setIntegrityInformationBuffer is the FSCTL_SET_INTEGRITY_INFORMATION_BUFFER structure.
+type setIntegrityInformationBuffer struct {
+	ChecksumAlgorithm uint16
+	Reserved          uint16
+	Flags             uint32
+}
+
+// checkAndStoreIntegritySupport checks if the volume of the path supports integrity streams and stores
+// the result in a map. If the result is already in the map, it returns the result from the map.
+func checkAndStoreIntegritySupport(path string) (bool, error) {
+	volumeName, err := prepareVolumeName(path)
+	if err != nil {
+		return false, err
+	}
+	if volumeName == "" {
+		// the volume name cannot be derived from relative paths and similar
+		if volumeName, err = getVolumePathName(path); err != nil {
+			debug.Log("Error getting volume name for path %s: %v", path, err)
+			return false, nil
+		}
+	}
+
+	if supported, exists := integritySupportedVolumesMap.Load(volumeName); exists {
+		return supported.(bool), nil
+	}
+
+	supported, err := pathSupportsIntegrityStreams(volumeName + `\`)
+	if err != nil {
+		// There can be multiple errors like path does not exist, bad network path, etc.
+		// We just treat the volume as not supporting integrity streams in these cases.
+		debug.Log("Error checking if integrity streams are supported for volume %s: %v", volumeName, err)
+		supported = false
+	}
+	integritySupportedVolumesMap.Store(volumeName, supported)
+	return supported, nil
+}
+
+// pathSupportsIntegrityStreams returns true if the filesystem of the volume supports integrity streams.
+func pathSupportsIntegrityStreams(path string) (bool, error) {
+	var fileSystemFlags uint32
+	utf16Path, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return false, err
+	}
+	err = windows.GetVolumeInformation(utf16Path, nil, 0, nil, nil, &fileSystemFlags, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	return fileSystemFlags&fileSupportsIntegrityStreams != 0, nil
+}
+
+// openForIntegrity opens the file or directory at path with the given access rights. Reparse
+// points are opened themselves instead of their target.
+func openForIntegrity(path string, access uint32) (windows.Handle, error) {
+	pathPointer, err := windows.UTF16PtrFromString(fixpath(path))
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	return windows.CreateFile(pathPointer, access,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+}
+
+// getIntegrityStream returns the integrity stream setting of the file or directory at path. It
+// returns nil if the volume does not support integrity streams.
+func getIntegrityStream(path string) (*restic.IntegrityStream, error) {
+	supported, err := checkAndStoreIntegritySupport(path)
+	if err != nil || !supported {
+		return nil, err
+	}
+
+	handle, err := openForIntegrity(path, windows.FILE_READ_ATTRIBUTES)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := windows.CloseHandle(handle); err != nil {
+			debug.Log("Error closing file handle for %s: %v\n", path, err)
+		}
+	}()
+	return readIntegrityStream(handle)
+}
+
+func readIntegrityStream(handle windows.Handle) (*restic.IntegrityStream, error) {
+	var info getIntegrityInformationBuffer
+	var n uint32
+	err := windows.DeviceIoControl(handle, fsctlGetIntegrityInformation,
+		nil, 0, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)), &n, nil)
+	if err != nil {
+		if errors.Is(err, windows.ERROR_INVALID_FUNCTION) || errors.Is(err, windows.ERROR_NOT_SUPPORTED) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &restic.IntegrityStream{ChecksumAlgorithm: info.ChecksumAlgorithm, Flags: info.Flags}, nil
+}
+
+// restoreIntegrityStream sets the integrity stream setting of the file or directory at path.
+// Targets on volumes which do not support integrity streams are skipped. ReFS only allows
+// changing the setting of empty files, new files inherit the setting of their directory.
+func restoreIntegrityStream(path string, integrity *restic.IntegrityStream) error {
+	supported, err := checkAndStoreIntegritySupport(path)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		debug.Log("volume of %s does not support integrity streams, skipping", path)
+		return nil
+	}
+
+	handle, err := openForIntegrity(path, windows.GENERIC_READ|windows.GENERIC_WRITE)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := windows.CloseHandle(handle); err != nil {
+			debug.Log("Error closing file handle for %s: %v\n", path, err)
+		}
+	}()
+
+	current, err := readIntegrityStream(handle)
+	if err != nil {
+		return err
+	}
+	if current != nil && *current == *integrity {
+		return nil
+	}
+
+	info := setIntegrityInformationBuffer{
+		ChecksumAlgorithm: integrity.ChecksumAlgorithm,
+		Flags:             integrity.Flags,
+	}
+	var n uint32
+	return windows.DeviceIoControl(handle, windows.FSCTL_SET_INTEGRITY_INFORMATION,
+		(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)), nil, 0, &n, nil)
+}
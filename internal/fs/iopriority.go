@@ -0,0 +1,56 @@
+package fs
+
+import "fmt"
+
+// IOPriority is the priority of disk I/O requests issued by the process.
+type IOPriority int
+
+// Supported I/O priorities.
+const (
+	// IOPriorityNormal keeps the default I/O priority of the process.
+	IOPriorityNormal IOPriority = iota
+	// IOPriorityLow only uses the disk when no other process needs it.
+	IOPriorityLow
+	// IOPriorityHigh prefers the I/O requests over those of other processes.
+	IOPriorityHigh
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (p *IOPriority) Set(s string) error {
+	switch s {
+	case "low":
+		*p = IOPriorityLow
+	case "normal":
+		*p = IOPriorityNormal
+	case "high":
+		*p = IOPriorityHigh
+	default:
+		return fmt.Errorf("invalid I/O priority %q, must be one of (low|normal|high)", s)
+	}
+	return nil
+}
+
+func (p *IOPriority) String() string {
+	switch *p {
+	case IOPriorityLow:
+		return "low"
+	case IOPriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+func (p *IOPriority) Type() string {
+	return "priority"
+}
+
+// SetIOPriority sets the I/O priority of the current process. On Linux, this
+// is the equivalent of ionice, on Windows the I/O priority hint of the
+// process is changed.
+func SetIOPriority(p IOPriority) error {
+	if p == IOPriorityNormal {
+		return nil
+	}
+	return setIOPriority(p)
+}
@@ -0,0 +1,51 @@
+package fs
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// see linux/ioprio.h
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+)
+
+func setIOPriority(p IOPriority) error {
+	// like ionice -c 3 for low, and ionice -c 2 -n 0 for high
+	prio := ioprioClassIdle << ioprioClassShift
+	if p == IOPriorityHigh {
+		// level 0 is the highest within the best-effort class
+		prio = ioprioClassBE << ioprioClassShift
+	}
+
+	// The I/O priority is a property of each thread. New threads inherit it
+	// from the thread creating them, so it is sufficient to change all
+	// existing threads.
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return ioprioSet(0, prio)
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := ioprioSet(tid, prio); err != nil && err != unix.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
+
+func ioprioSet(tid, prio int) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio))
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "ioprio_set", Err: errno}
+	}
+	return nil
+}
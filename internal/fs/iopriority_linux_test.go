@@ -0,0 +1,36 @@
+package fs
+
+import (
+	"runtime"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSetIOPriority(t *testing.T) {
+	var p IOPriority
+	rtest.OK(t, p.Set("low"))
+	rtest.Equals(t, IOPriorityLow, p)
+	rtest.Equals(t, "low", p.String())
+	rtest.Assert(t, p.Set("idle") != nil, "invalid priority was accepted")
+
+	// run in a separate thread, which is discarded afterwards, so that the
+	// priority of other tests is not changed
+	done := make(chan int)
+	go func() {
+		runtime.LockOSThread()
+		// the thread is terminated without calling UnlockOSThread
+
+		if err := ioprioSet(0, ioprioClassIdle<<ioprioClassShift); err != nil {
+			t.Error(err)
+		}
+		prio, _, errno := unix.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+		if errno != 0 {
+			t.Error(errno)
+		}
+		done <- int(prio)
+	}()
+	rtest.Equals(t, ioprioClassIdle, <-done>>ioprioClassShift)
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package fs
+
+import "github.com/restic/restic/internal/errors"
+
+func setIOPriority(_ IOPriority) error {
+	return errors.New("setting the I/O priority is not supported on this platform")
+}
@@ -0,0 +1,29 @@
+package fs
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// see IO_PRIORITY_HINT in wdm.h
+const (
+	ioPriorityVeryLow = 0
+	ioPriorityHigh    = 3
+)
+
+func setIOPriority(p IOPriority) error {
+	// Setting a high priority requires SeIncreaseBasePriorityPrivilege,
+	// which is held by administrators.
+	hint := uint32(ioPriorityVeryLow)
+	if p == IOPriorityHigh {
+		hint = ioPriorityHigh
+	}
+	err := windows.NtSetInformationProcess(windows.CurrentProcess(), windows.ProcessIoPriority,
+		unsafe.Pointer(&hint), uint32(unsafe.Sizeof(hint)))
+	if err != nil {
+		return &os.SyscallError{Syscall: "NtSetInformationProcess", Err: err}
+	}
+	return nil
+}
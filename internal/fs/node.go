@@ -175,7 +175,7 @@ func NodeCreateAt(node *restic.Node, path string) (err error) {
 	case restic.NodeTypeFifo:
 		err = nodeCreateFifoAt(path)
 	case restic.NodeTypeSocket:
-		err = nil
+		err = nodeCreateSocketAt(path)
 	default:
 		err = errors.Errorf("filetype %q not implemented", node.Type)
 	}
@@ -225,6 +225,12 @@ func nodeCreateFifoAt(path string) error {
 	return mkfifo(path, 0600)
 }
 
+// nodeCreateSocketAt creates the file system entry of a socket, it is not
+// bound to any process.
+func nodeCreateSocketAt(path string) error {
+	return mknod(path, syscall.S_IFSOCK|0600, 0)
+}
+
 func mkfifo(path string, mode uint32) (err error) {
 	return mknod(path, mode|syscall.S_IFIFO, 0)
 }
@@ -246,6 +252,29 @@ func NodeRestoreMetadata(node *restic.Node, path string, warn func(msg string),
 	return err
 }
 
+// NodeRestoreOwner restores only the owner and group stored in the security
+// descriptor of node on Windows. mapSID, if set, translates the stored SIDs to
+// those used on this computer. On other platforms, the owner is already
+// restored by NodeRestoreMetadata.
+func NodeRestoreOwner(node *restic.Node, path string, mapSID func(sid string) string) error {
+	err := nodeRestoreOwner(node, path, mapSID)
+	if err != nil {
+		debug.Log("restoreOwner(%s) error %v", path, err)
+	}
+	return err
+}
+
+// NodeRestoreInheritedAttributes restores the attributes of a directory which
+// are inherited by the files created in it. It must be called before the
+// content of the directory is restored.
+func NodeRestoreInheritedAttributes(node *restic.Node, path string) error {
+	err := nodeRestoreInheritedAttributes(node, path)
+	if err != nil {
+		debug.Log("restoreInheritedAttributes(%s) error %v", path, err)
+	}
+	return err
+}
+
 func nodeRestoreMetadata(node *restic.Node, path string, warn func(msg string), xattrSelectFilter func(xattrName string) bool) error {
 	var firsterr error
 
@@ -18,6 +18,11 @@ func nodeRestoreGenericAttributes(node *restic.Node, _ string, warn func(msg str
 	return restic.HandleAllUnknownGenericAttributesFound(node.GenericAttributes, warn)
 }
 
+// nodeRestoreInheritedAttributes is a no-op.
+func nodeRestoreInheritedAttributes(_ *restic.Node, _ string) error {
+	return nil
+}
+
 // nodeFillGenericAttributes is a no-op.
 func nodeFillGenericAttributes(_ *restic.Node, _ string, _ *ExtendedFileInfo) error {
 	return nil
@@ -202,6 +202,12 @@ func nodeRestoreGenericAttributes(node *restic.Node, path string, warn func(msg
 			errs = append(errs, fmt.Errorf("error restoring creation time for: %s : %v", path, err))
 		}
 	}
+	if windowsAttributes.IntegrityStream != nil {
+		// must be restored before the file attributes, as a readonly file cannot be opened for writing
+		if err := restoreIntegrityStream(path, windowsAttributes.IntegrityStream); err != nil {
+			errs = append(errs, fmt.Errorf("error restoring integrity stream for: %s : %v", path, err))
+		}
+	}
 	if windowsAttributes.FileAttributes != nil {
 		if err := restoreFileAttributes(path, windowsAttributes.FileAttributes); err != nil {
 			errs = append(errs, fmt.Errorf("error restoring file attributes for: %s : %v", path, err))
@@ -217,6 +223,25 @@ func nodeRestoreGenericAttributes(node *restic.Node, path string, warn func(msg
 	return errors.Join(errs...)
 }
 
+// nodeRestoreInheritedAttributes restores the integrity stream setting of a directory, which is
+// inherited by files created in it. Integrity streams can only be enabled for empty files.
+func nodeRestoreInheritedAttributes(node *restic.Node, path string) error {
+	if node.Type != restic.NodeTypeDir || len(node.GenericAttributes) == 0 {
+		return nil
+	}
+	windowsAttributes, _, err := genericAttributesToWindowsAttrs(node.GenericAttributes)
+	if err != nil {
+		return fmt.Errorf("error parsing generic attribute for: %s : %v", path, err)
+	}
+	if windowsAttributes.IntegrityStream == nil {
+		return nil
+	}
+	if err := restoreIntegrityStream(path, windowsAttributes.IntegrityStream); err != nil {
+		return fmt.Errorf("error restoring integrity stream for: %s : %v", path, err)
+	}
+	return nil
+}
+
 // genericAttributesToWindowsAttrs converts the generic attributes map to a WindowsAttributes and also returns a string of unknown attributes that it could not convert.
 func genericAttributesToWindowsAttrs(attrs map[restic.GenericAttributeType]json.RawMessage) (windowsAttributes restic.WindowsAttributes, unknownAttribs []restic.GenericAttributeType, err error) {
 	waValue := reflect.ValueOf(&windowsAttributes).Elem()
@@ -340,7 +365,7 @@ func decryptFile(pathPointer *uint16) error {
 }
 
 // nodeFillGenericAttributes fills in the generic attributes for windows like File Attributes,
-// Created time and Security Descriptors.
+// Created time, Security Descriptors and the integrity stream setting on ReFS.
 func nodeFillGenericAttributes(node *restic.Node, path string, stat *ExtendedFileInfo) error {
 	if strings.Contains(filepath.Base(path), ":") {
 		// Do not process for Alternate Data Streams in Windows
@@ -360,10 +385,17 @@ func nodeFillGenericAttributes(node *restic.Node, path string, stat *ExtendedFil
 	}
 
 	var sd *[]byte
+	var integrity *restic.IntegrityStream
 	if node.Type == restic.NodeTypeFile || node.Type == restic.NodeTypeDir {
 		if sd, err = getSecurityDescriptor(path); err != nil {
 			return err
 		}
+		if sd != nil {
+			recordAccountNames(*sd)
+		}
+		if integrity, err = getIntegrityStream(path); err != nil {
+			return err
+		}
 	}
 
 	winFI := stat.sys.(*syscall.Win32FileAttributeData)
@@ -373,6 +405,7 @@ func nodeFillGenericAttributes(node *restic.Node, path string, stat *ExtendedFil
 		CreationTime:       &winFI.CreationTime,
 		FileAttributes:     &winFI.FileAttributes,
 		SecurityDescriptor: sd,
+		IntegrityStream:    integrity,
 	})
 	return err
 }
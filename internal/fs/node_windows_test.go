@@ -86,6 +86,28 @@ func TestRestoreCreationTime(t *testing.T) {
 	runGenericAttributesTest(t, path, restic.TypeCreationTime, restic.WindowsAttributes{CreationTime: &creationTimeAttribute}, false)
 }
 
+func TestRestoreIntegrityStream(t *testing.T) {
+	t.Parallel()
+	path := t.TempDir()
+	supported, err := checkAndStoreIntegritySupport(path)
+	test.OK(t, err)
+
+	integrity := restic.IntegrityStream{ChecksumAlgorithm: 2}
+	if supported {
+		runGenericAttributesTest(t, path, restic.TypeIntegrityStream, restic.WindowsAttributes{IntegrityStream: &integrity}, false)
+		return
+	}
+
+	// the setting is silently skipped on volumes without integrity streams
+	genericAttrs, err := restic.WindowsAttrsToGenericAttributes(restic.WindowsAttributes{IntegrityStream: &integrity})
+	test.OK(t, err)
+	expectedNodes := []restic.Node{
+		{Name: "testfile", Type: restic.NodeTypeFile, Mode: 0644, GenericAttributes: genericAttrs},
+		{Name: "testdirectory", Type: restic.NodeTypeDir, Mode: 0755, GenericAttributes: genericAttrs},
+	}
+	runGenericAttributesTestForNodes(t, expectedNodes, path, restic.TypeIntegrityStream, restic.WindowsAttributes{}, false)
+}
+
 func TestRestoreFileAttributes(t *testing.T) {
 	t.Parallel()
 	genericAttributeName := restic.TypeFileAttributes
@@ -0,0 +1,124 @@
+package fs
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+const (
+	// sdPrefetchWorkers is the number of goroutines which retrieve security
+	// descriptors in the background.
+	sdPrefetchWorkers = 8
+	// sdPrefetchMaxEntries limits the number of prefetched security
+	// descriptors which have not been used yet. The oldest entries are
+	// discarded once the limit is reached, for example for excluded files.
+	sdPrefetchMaxEntries = 4096
+)
+
+type sdPrefetchResult struct {
+	path string
+	done chan struct{}
+	sd   *[]byte
+	err  error
+}
+
+// sdPrefetcher retrieves the security descriptors of directory entries using
+// several workers before the archiver requests them. Querying the security
+// descriptor by path is dominated by the latency of opening and closing the
+// file, which is especially slow on network shares. All workers share the
+// backup privileges which are enabled once for the whole process.
+type sdPrefetcher struct {
+	once  sync.Once
+	queue chan *sdPrefetchResult
+
+	mu      sync.Mutex
+	entries map[string]*sdPrefetchResult
+	order   []string
+}
+
+var securityDescriptors = &sdPrefetcher{}
+
+func (p *sdPrefetcher) start() {
+	p.queue = make(chan *sdPrefetchResult, sdPrefetchMaxEntries)
+	p.entries = make(map[string]*sdPrefetchResult)
+	for i := 0; i < sdPrefetchWorkers; i++ {
+		go p.worker()
+	}
+}
+
+func (p *sdPrefetcher) worker() {
+	for res := range p.queue {
+		res.sd, res.err = querySecurityDescriptor(res.path)
+		close(res.done)
+	}
+}
+
+// prefetch queues the retrieval of the security descriptors for the given
+// paths. It does not block.
+func (p *sdPrefetcher) prefetch(paths []string) {
+	p.once.Do(p.start)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.order) > 2*sdPrefetchMaxEntries {
+		// drop paths which were already taken
+		order := p.order[:0]
+		for _, path := range p.order {
+			if _, ok := p.entries[path]; ok {
+				order = append(order, path)
+			}
+		}
+		p.order = order
+	}
+
+	for _, path := range paths {
+		if _, ok := p.entries[path]; ok {
+			continue
+		}
+		for len(p.entries) >= sdPrefetchMaxEntries && len(p.order) > 0 {
+			delete(p.entries, p.order[0])
+			p.order = p.order[1:]
+		}
+
+		res := &sdPrefetchResult{path: path, done: make(chan struct{})}
+		select {
+		case p.queue <- res:
+			p.entries[path] = res
+			p.order = append(p.order, path)
+		default:
+			// the workers are busy, the remaining descriptors are retrieved on demand
+			return
+		}
+	}
+}
+
+// take returns the prefetched security descriptor for path, waiting for its
+// retrieval if necessary. It returns nil if no prefetch was queued for path.
+func (p *sdPrefetcher) take(path string) *sdPrefetchResult {
+	p.mu.Lock()
+	res, ok := p.entries[path]
+	if ok {
+		delete(p.entries, path)
+	}
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	<-res.done
+	return res
+}
+
+// prefetchSecurityDescriptors starts retrieving the security descriptors of
+// the entries of dir in the background.
+func prefetchSecurityDescriptors(dir string, names []string) {
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	debug.Log("prefetching security descriptors for %d entries of %v", len(paths), dir)
+	securityDescriptors.prefetch(paths)
+}
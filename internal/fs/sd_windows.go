@@ -42,6 +42,14 @@ var lowRestoreSecurityFlags windows.SECURITY_INFORMATION = windows.DACL_SECURITY
 // This needs admin permissions or SeBackupPrivilege for getting the full SD.
 // If there are no admin permissions, only the current user's owner, group and DACL will be got.
 func getSecurityDescriptor(filePath string) (securityDescriptor *[]byte, err error) {
+	if res := securityDescriptors.take(filePath); res != nil {
+		return res.sd, res.err
+	}
+	return querySecurityDescriptor(filePath)
+}
+
+// querySecurityDescriptor retrieves the SecurityDescriptor for the file at filePath.
+func querySecurityDescriptor(filePath string) (securityDescriptor *[]byte, err error) {
 	onceBackup.Do(enableBackupPrivilege)
 
 	var sd *windows.SECURITY_DESCRIPTOR
@@ -66,7 +74,7 @@ func getSecurityDescriptor(filePath string) (securityDescriptor *[]byte, err err
 		if !useLowerPrivileges && isHandlePrivilegeNotHeldError(err) {
 			// If ERROR_PRIVILEGE_NOT_HELD is encountered, fallback to backups/restores using lower non-admin privileges.
 			lowerPrivileges.Store(true)
-			return getSecurityDescriptor(filePath)
+			return querySecurityDescriptor(filePath)
 		} else if errors.Is(err, windows.ERROR_NOT_SUPPORTED) {
 			return nil, nil
 		} else {
@@ -11,6 +11,7 @@ import (
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/test"
+	"golang.org/x/sys/windows"
 )
 
 func TestSetGetFileSecurityDescriptors(t *testing.T) {
@@ -58,3 +59,46 @@ func testSecurityDescriptors(t *testing.T, testSDs []string, testPath string) {
 		compareSecurityDescriptors(t, testPath, sdInputBytes, *sdOutputBytes)
 	}
 }
+
+func TestPrefetchSecurityDescriptors(t *testing.T) {
+	tempDir := t.TempDir()
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		test.OK(t, os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600))
+	}
+
+	prefetchSecurityDescriptors(tempDir, names)
+	for _, name := range names {
+		path := filepath.Join(tempDir, name)
+		expected, err := querySecurityDescriptor(path)
+		test.OK(t, err)
+
+		res := securityDescriptors.take(path)
+		test.Assert(t, res != nil, "security descriptor for %v was not prefetched", name)
+		test.OK(t, res.err)
+		compareSecurityDescriptors(t, path, *expected, *res.sd)
+		test.Assert(t, securityDescriptors.take(path) == nil, "prefetched security descriptor for %v was not removed", name)
+	}
+}
+
+func TestMapSecurityDescriptorSIDs(t *testing.T) {
+	const (
+		oldSID = "S-1-5-21-1-2-3-1001"
+		newSID = "S-1-5-21-4-5-6-1001"
+	)
+	sd, err := windows.SecurityDescriptorFromString("O:" + oldSID + "G:BAD:P(A;;FA;;;" + oldSID + ")(A;;FA;;;SY)S:(AU;FA;FA;;;" + oldSID + ")")
+	test.OK(t, err)
+	sdBytes, err := securityDescriptorStructToBytes(sd)
+	test.OK(t, err)
+
+	mapped, err := MapSecurityDescriptorSIDs(sdBytes, func(sid string) string {
+		if sid == oldSID {
+			return newSID
+		}
+		return sid
+	})
+	test.OK(t, err)
+	s, err := securityDescriptorBytesToStruct(mapped)
+	test.OK(t, err)
+	test.Equals(t, "O:"+newSID+"G:BAD:P(A;;FA;;;"+newSID+")(A;;FA;;;SY)S:(AU;FA;FA;;;"+newSID+")", s.String())
+}
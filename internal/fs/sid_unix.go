@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import (
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// AccountNames returns nil, SIDs only exist on windows.
+func AccountNames() map[string]string {
+	return nil
+}
+
+// LookupAccountSID is not supported, SIDs only exist on windows.
+func LookupAccountSID(_ string) (string, error) {
+	return "", errors.New("looking up account SIDs is only supported on windows")
+}
+
+// MapSecurityDescriptorSIDs returns sd unchanged, security descriptors are only
+// restored on windows.
+func MapSecurityDescriptorSIDs(sd []byte, _ func(sid string) string) ([]byte, error) {
+	return sd, nil
+}
+
+// nodeRestoreOwner is a no-op, the owner is restored with the other metadata.
+func nodeRestoreOwner(_ *restic.Node, _ string, _ func(sid string) string) error {
+	return nil
+}
@@ -0,0 +1,190 @@
+package fs
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"unsafe"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+	"golang.org/x/sys/windows"
+)
+
+// accountNames caches the account names of the SIDs found in the security
+// descriptors read during a backup, indexed by the string representation of
+// the SID. SIDs which cannot be resolved are stored with an empty name.
+var accountNames sync.Map
+
+// ACE types whose SID directly follows the access mask, see
+// https://learn.microsoft.com/en-us/windows/win32/secauthz/ace.
+const (
+	accessAllowedAceType         = 0x0
+	accessDeniedAceType          = 0x1
+	systemAuditAceType           = 0x2
+	systemAlarmAceType           = 0x3
+	accessAllowedCallbackAceType = 0x9
+	accessDeniedCallbackAceType  = 0xA
+	systemAuditCallbackAceType   = 0xD
+)
+
+// recordAccountNames looks up the account names of the owner, the group and
+// the SIDs in the DACL and SACL of the security descriptor sd.
+func recordAccountNames(sd []byte) {
+	s, err := securityDescriptorBytesToStruct(sd)
+	if err != nil {
+		return
+	}
+	if owner, _, err := s.Owner(); err == nil && owner != nil {
+		recordAccountName(owner)
+	}
+	if group, _, err := s.Group(); err == nil && group != nil {
+		recordAccountName(group)
+	}
+	if dacl, _, err := s.DACL(); err == nil && dacl != nil {
+		recordACLAccountNames(dacl)
+	}
+	if sacl, _, err := s.SACL(); err == nil && sacl != nil {
+		recordACLAccountNames(sacl)
+	}
+}
+
+func recordACLAccountNames(acl *windows.ACL) {
+	for i := uint32(0); i < uint32(acl.AceCount); i++ {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err := windows.GetAce(acl, i, &ace); err != nil {
+			debug.Log("unable to read ACE %d: %v", i, err)
+			return
+		}
+		switch ace.Header.AceType {
+		case accessAllowedAceType, accessDeniedAceType, systemAuditAceType, systemAlarmAceType,
+			accessAllowedCallbackAceType, accessDeniedCallbackAceType, systemAuditCallbackAceType:
+			recordAccountName((*windows.SID)(unsafe.Pointer(&ace.SidStart)))
+		}
+	}
+}
+
+func recordAccountName(sid *windows.SID) {
+	key := sid.String()
+	if _, ok := accountNames.Load(key); ok {
+		return
+	}
+
+	var name string
+	account, domain, _, err := sid.LookupAccount("")
+	if err != nil {
+		debug.Log("unable to look up the account name of %v: %v", key, err)
+	} else if domain != "" {
+		name = domain + `\` + account
+	} else {
+		name = account
+	}
+	accountNames.Store(key, name)
+}
+
+// AccountNames returns the account names of the SIDs found in the security
+// descriptors read so far, indexed by SID. SIDs whose account name could not
+// be looked up are not included.
+func AccountNames() map[string]string {
+	names := make(map[string]string)
+	accountNames.Range(func(key, value any) bool {
+		if name := value.(string); name != "" {
+			names[key.(string)] = name
+		}
+		return true
+	})
+	if len(names) == 0 {
+		return nil
+	}
+	return names
+}
+
+// LookupAccountSID returns the SID of the account name on this computer.
+func LookupAccountSID(name string) (string, error) {
+	sid, _, _, err := windows.LookupSID("", name)
+	if err != nil {
+		return "", err
+	}
+	return sid.String(), nil
+}
+
+// nodeRestoreOwner sets the owner and group of path to those stored in the
+// security descriptor of node. The DACL and SACL are not changed.
+func nodeRestoreOwner(node *restic.Node, path string, mapSID func(sid string) string) error {
+	if len(node.GenericAttributes) == 0 {
+		return nil
+	}
+	windowsAttributes, _, err := genericAttributesToWindowsAttrs(node.GenericAttributes)
+	if err != nil {
+		return err
+	}
+	if windowsAttributes.SecurityDescriptor == nil {
+		return nil
+	}
+	sd, err := securityDescriptorBytesToStruct(*windowsAttributes.SecurityDescriptor)
+	if err != nil {
+		return err
+	}
+
+	var flags windows.SECURITY_INFORMATION
+	owner, _, err := sd.Owner()
+	if err == nil && owner != nil {
+		if owner, err = translateSID(owner, mapSID); err != nil {
+			return err
+		}
+		flags |= windows.OWNER_SECURITY_INFORMATION
+	} else {
+		owner = nil
+	}
+	group, _, err := sd.Group()
+	if err == nil && group != nil {
+		if group, err = translateSID(group, mapSID); err != nil {
+			return err
+		}
+		flags |= windows.GROUP_SECURITY_INFORMATION
+	} else {
+		group = nil
+	}
+	if flags == 0 {
+		return nil
+	}
+
+	onceRestore.Do(enableRestorePrivilege)
+	return windows.SetNamedSecurityInfo(fixpath(path), windows.SE_FILE_OBJECT, flags, owner, group, nil, nil)
+}
+
+// translateSID returns the SID which mapSID returns for sid.
+func translateSID(sid *windows.SID, mapSID func(sid string) string) (*windows.SID, error) {
+	if mapSID == nil {
+		return sid, nil
+	}
+	s := sid.String()
+	mapped := mapSID(s)
+	if mapped == s {
+		return sid, nil
+	}
+	return windows.StringToSid(mapped)
+}
+
+// sidPattern matches the SIDs in the SDDL form of a security descriptor.
+// Well-known SIDs are represented by aliases like "BA" and are not matched.
+var sidPattern = regexp.MustCompile(`S-1-[0-9]+(-[0-9]+)+`)
+
+// MapSecurityDescriptorSIDs returns a copy of the security descriptor sd in
+// which mapSID has replaced the SIDs of the owner, the group and all entries
+// of the DACL and SACL.
+func MapSecurityDescriptorSIDs(sd []byte, mapSID func(sid string) string) ([]byte, error) {
+	s, err := securityDescriptorBytesToStruct(sd)
+	if err != nil {
+		return nil, err
+	}
+	sddl := s.String()
+	if sddl == "" {
+		return nil, fmt.Errorf("unable to convert security descriptor to SDDL")
+	}
+	mapped, err := windows.SecurityDescriptorFromString(sidPattern.ReplaceAllStringFunc(sddl, mapSID))
+	if err != nil {
+		return nil, fmt.Errorf("converting SDDL to security descriptor: %w", err)
+	}
+	return securityDescriptorStructToBytes(mapped)
+}
@@ -0,0 +1,62 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// StagingDir creates an empty directory which can later be swapped with the
+// directory target using SwapDirectories. The directory is created next to
+// target, such that both are on the same filesystem. If target already
+// exists, the permissions of the staging directory are copied from it.
+func StagingDir(target string) (string, error) {
+	parent, err := stagingParent(target)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp(parent, "."+filepath.Base(target)+".restic-staging-")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if fi, err := os.Stat(target); err == nil {
+		if err := os.Chmod(dir, fi.Mode().Perm()); err != nil {
+			_ = os.Remove(dir)
+			return "", errors.WithStack(err)
+		}
+	}
+	return dir, nil
+}
+
+// SwapDirectories replaces the directory target with the directory staging,
+// which must have been created using StagingDir. Other processes either see
+// the previous or the new content of target, the swap is atomic where the
+// platform supports it. The returned path contains the previous content of
+// target and must be removed by the caller, it is empty if target did not
+// exist.
+func SwapDirectories(target, staging string) (string, error) {
+	if _, err := os.Lstat(target); errors.Is(err, os.ErrNotExist) {
+		return "", errors.WithStack(os.Rename(staging, target))
+	} else if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return swapDirectories(target, staging)
+}
+
+// swapDirectoriesRename swaps target and staging using three renames. For a
+// short time, target does not exist, but it never contains partial content.
+func swapDirectoriesRename(target, staging string) (string, error) {
+	old := staging + ".old"
+	if err := os.Rename(target, old); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err := os.Rename(staging, target); err != nil {
+		// try to restore the previous state
+		_ = os.Rename(old, target)
+		return "", errors.WithStack(err)
+	}
+	return old, nil
+}
@@ -0,0 +1,29 @@
+package fs
+
+import (
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
+
+func stagingParent(target string) (string, error) {
+	return filepath.Dir(target), nil
+}
+
+// swapDirectories exchanges target and staging atomically using renameat2.
+// Filesystems which do not support RENAME_EXCHANGE fall back to renames.
+func swapDirectories(target, staging string) (string, error) {
+	err := ignoringEINTR(func() error {
+		return unix.Renameat2(unix.AT_FDCWD, staging, unix.AT_FDCWD, target, unix.RENAME_EXCHANGE)
+	})
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+		debug.Log("RENAME_EXCHANGE not supported for %v: %v", target, err)
+		return swapDirectoriesRename(target, staging)
+	}
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return staging, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package fs
+
+import "path/filepath"
+
+func stagingParent(target string) (string, error) {
+	return filepath.Dir(target), nil
+}
+
+func swapDirectories(target, staging string) (string, error) {
+	return swapDirectoriesRename(target, staging)
+}
@@ -0,0 +1,55 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSwapDirectories(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		exists bool
+	}{
+		{"new-target", false},
+		{"existing-target", true},
+	} {
+		exists := test.exists
+		t.Run(test.name, func(t *testing.T) {
+			target := filepath.Join(rtest.TempDir(t), "target")
+			if exists {
+				rtest.OK(t, os.Mkdir(target, 0750))
+				rtest.OK(t, os.WriteFile(filepath.Join(target, "old"), []byte("old"), 0600))
+			}
+
+			staging, err := StagingDir(target)
+			rtest.OK(t, err)
+			rtest.Equals(t, filepath.Dir(target), filepath.Dir(staging))
+			rtest.OK(t, os.WriteFile(filepath.Join(staging, "new"), []byte("new"), 0600))
+			if exists {
+				fi, err := os.Stat(staging)
+				rtest.OK(t, err)
+				rtest.Equals(t, os.FileMode(0750), fi.Mode().Perm())
+			}
+
+			old, err := SwapDirectories(target, staging)
+			rtest.OK(t, err)
+
+			buf, err := os.ReadFile(filepath.Join(target, "new"))
+			rtest.OK(t, err)
+			rtest.Equals(t, "new", string(buf))
+			_, err = os.Stat(filepath.Join(target, "old"))
+			rtest.Assert(t, os.IsNotExist(err), "old file still exists in target: %v", err)
+
+			if !exists {
+				rtest.Equals(t, "", old)
+				return
+			}
+			buf, err = os.ReadFile(filepath.Join(old, "old"))
+			rtest.OK(t, err)
+			rtest.Equals(t, "old", string(buf))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package fs
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"unicode/utf16"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/windows"
+)
+
+// junctionTarget returns the destination of the junction at path. The
+// returned bool is false if path is not a junction.
+func junctionTarget(path string) (string, bool, error) {
+	pathPointer, err := windows.UTF16PtrFromString(fixpath(path))
+	if err != nil {
+		return "", false, err
+	}
+	var data windows.Win32finddata
+	h, err := windows.FindFirstFile(pathPointer, &data)
+	if err != nil {
+		return "", false, err
+	}
+	_ = windows.FindClose(h)
+
+	if data.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT == 0 || data.Reserved0 != windows.IO_REPARSE_TAG_MOUNT_POINT {
+		return "", false, nil
+	}
+	dest, err := os.Readlink(path)
+	if err != nil {
+		return "", false, errors.WithStack(err)
+	}
+	return dest, true, nil
+}
+
+// stagingParent returns the directory which contains the destination of a
+// junction at target, such that the junction can later be redirected to the
+// staging directory.
+func stagingParent(target string) (string, error) {
+	dest, isJunction, err := junctionTarget(target)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !isJunction) {
+		return filepath.Dir(target), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(dest), nil
+}
+
+// swapDirectories redirects a junction at target to staging, which replaces
+// the content visible through the junction atomically. Other directories
+// cannot be replaced atomically on Windows, they are swapped using renames.
+func swapDirectories(target, staging string) (string, error) {
+	dest, isJunction, err := junctionTarget(target)
+	if err != nil {
+		return "", err
+	}
+	if !isJunction {
+		return swapDirectoriesRename(target, staging)
+	}
+
+	debug.Log("redirecting junction %v from %v to %v", target, dest, staging)
+	if err := setJunctionTarget(target, staging); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// setJunctionTarget replaces the destination of the junction at path with the
+// absolute path dest.
+func setJunctionTarget(path, dest string) error {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	buf := mountPointReparseBuffer(`\??\`+dest, dest)
+
+	handle, err := openForIntegrity(path, windows.GENERIC_WRITE)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err := windows.CloseHandle(handle); err != nil {
+			debug.Log("Error closing file handle for %s: %v\n", path, err)
+		}
+	}()
+
+	var n uint32
+	err = windows.DeviceIoControl(handle, windows.FSCTL_SET_REPARSE_POINT,
+		&buf[0], uint32(len(buf)), nil, 0, &n, nil)
+	return errors.WithStack(err)
+}
+
+// mountPointReparseBuffer returns the REPARSE_DATA_BUFFER of a junction with
+// the given substitute and print name.
+func mountPointReparseBuffer(substituteName, printName string) []byte {
+	substitute := utf16.Encode([]rune(substituteName))
+	printed := utf16.Encode([]rune(printName))
+
+	// both names are followed by a null character
+	pathBuffer := make([]uint16, 0, len(substitute)+len(printed)+2)
+	pathBuffer = append(pathBuffer, substitute...)
+	pathBuffer = append(pathBuffer, 0)
+	pathBuffer = append(pathBuffer, printed...)
+	pathBuffer = append(pathBuffer, 0)
+
+	const headerSize = 8
+	buf := make([]byte, 8+headerSize+2*len(pathBuffer))
+	binary.LittleEndian.PutUint32(buf[0:], windows.IO_REPARSE_TAG_MOUNT_POINT)
+	binary.LittleEndian.PutUint16(buf[4:], uint16(headerSize+2*len(pathBuffer)))
+	// SubstituteNameOffset, SubstituteNameLength, PrintNameOffset, PrintNameLength
+	binary.LittleEndian.PutUint16(buf[8:], 0)
+	binary.LittleEndian.PutUint16(buf[10:], uint16(2*len(substitute)))
+	binary.LittleEndian.PutUint16(buf[12:], uint16(2*(len(substitute)+1)))
+	binary.LittleEndian.PutUint16(buf[14:], uint16(2*len(printed)))
+	for i, c := range pathBuffer {
+		binary.LittleEndian.PutUint16(buf[16+2*i:], c)
+	}
+	return buf
+}
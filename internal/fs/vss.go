@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
 )
 
 // MountPoint is a dummy for non-windows platforms to let client code compile.
@@ -26,6 +27,8 @@ func (p *MountPoint) GetSnapshotDeviceObject() string {
 // VssSnapshot is a dummy for non-windows platforms to let client code compile.
 type VssSnapshot struct {
 	mountPointInfo map[string]MountPoint
+	writers        []restic.VSSWriter
+	documents      []restic.AuxiliaryDocument
 }
 
 // HasSufficientPrivilegesForVSS returns true if the user is allowed to use VSS.
@@ -42,7 +45,7 @@ func getVolumeNameForVolumeMountPoint(mountPoint string) (string, error) {
 // NewVssSnapshot creates a new vss snapshot. If creating the snapshots doesn't
 // finish within the timeout an error is returned.
 func NewVssSnapshot(_ string,
-	_ string, _ time.Duration, _ VolumeFilter, _ ErrorHandler) (VssSnapshot, error) {
+	_ string, _ time.Duration, _ VolumeFilter, _ bool, _ ErrorHandler) (VssSnapshot, error) {
 	return VssSnapshot{}, errors.New("VSS snapshots are only supported on windows")
 }
 
@@ -56,3 +59,24 @@ func (p *VssSnapshot) Delete() error {
 func (p *VssSnapshot) GetSnapshotDeviceObject() string {
 	return ""
 }
+
+// NewRemoteShadowCopy requests a shadow copy of a volume of a remote host.
+func NewRemoteShadowCopy(_ string, _ byte) (RemoteShadowCopy, error) {
+	return RemoteShadowCopy{}, errors.New("VSS snapshots are only supported on windows")
+}
+
+// Delete deletes the shadow copy on the remote host.
+func (s *RemoteShadowCopy) Delete() error {
+	return nil
+}
+
+// isSharedVolume returns true if root is the root directory of a cluster
+// shared volume.
+func isSharedVolume(_ string) bool {
+	return false
+}
+
+// getSharedVolumeName returns the volume GUID path of a cluster shared volume.
+func getSharedVolumeName(_ string) (string, error) {
+	return "", errors.New("cluster shared volumes are only supported on windows")
+}
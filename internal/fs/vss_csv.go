@@ -0,0 +1,41 @@
+package fs
+
+import (
+	"os"
+	"strings"
+)
+
+// sharedVolumeCandidate returns the root of the cluster shared volume (CSV)
+// which path would be located on. Windows failover clusters always mount CSVs
+// as directories below ClusterStorage on the system drive, for example
+// C:\ClusterStorage\Volume1. The path must not have a \\?\ prefix.
+func sharedVolumeCandidate(systemDrive, path string) (root string, ok bool) {
+	namespace := systemDrive + `\ClusterStorage\`
+	if len(path) <= len(namespace) || !strings.EqualFold(path[:len(namespace)], namespace) {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(path[len(namespace):], `\`)
+	if name == "" {
+		return "", false
+	}
+	return path[:len(namespace)+len(name)] + `\`, true
+}
+
+func systemDrive() string {
+	if drive := os.Getenv("SystemDrive"); drive != "" {
+		return drive
+	}
+	return "C:"
+}
+
+// SharedVolume returns the root directory of the cluster shared volume path
+// is located on. ok is false if the path is not on a cluster shared volume.
+func SharedVolume(path string) (root string, ok bool) {
+	p := strings.TrimPrefix(fixpath(path), `\\?\`)
+	root, ok = sharedVolumeCandidate(systemDrive(), p)
+	if !ok || !isSharedVolume(root) {
+		return "", false
+	}
+	return root, true
+}
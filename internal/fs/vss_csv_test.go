@@ -0,0 +1,28 @@
+package fs
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSharedVolumeCandidate(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		root string
+		ok   bool
+	}{
+		{`C:\ClusterStorage\Volume1\VMs\disk.vhdx`, `C:\ClusterStorage\Volume1\`, true},
+		{`c:\clusterstorage\volume1`, `c:\clusterstorage\volume1\`, true},
+		{`C:\ClusterStorage\Data Volume\`, `C:\ClusterStorage\Data Volume\`, true},
+		{`C:\ClusterStorage\`, "", false},
+		{`C:\ClusterStorage`, "", false},
+		{`C:\ClusterStorageX\Volume1`, "", false},
+		{`D:\ClusterStorage\Volume1`, "", false},
+		{`C:\Users\alice`, "", false},
+	} {
+		root, ok := sharedVolumeCandidate("C:", test.path)
+		rtest.Equals(t, test.ok, ok, test.path)
+		rtest.Equals(t, test.root, root, test.path)
+	}
+}
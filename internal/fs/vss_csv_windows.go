@@ -0,0 +1,57 @@
+//go:build windows
+// +build windows
+
+package fs
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// The functions for cluster shared volumes are only available if the failover
+// clustering feature is installed.
+var (
+	modresutils = windows.NewLazySystemDLL("resutils.dll")
+
+	procClusterIsPathOnSharedVolume             = modresutils.NewProc("ClusterIsPathOnSharedVolume")
+	procClusterGetVolumeNameForVolumeMountPoint = modresutils.NewProc("ClusterGetVolumeNameForVolumeMountPoint")
+)
+
+// isSharedVolume returns true if root is the root directory of a cluster
+// shared volume.
+func isSharedVolume(root string) bool {
+	if procClusterIsPathOnSharedVolume.Find() != nil {
+		return false
+	}
+	p, err := syscall.UTF16PtrFromString(root)
+	if err != nil {
+		return false
+	}
+	r, _, _ := procClusterIsPathOnSharedVolume.Call(uintptr(unsafe.Pointer(p)))
+	return r != 0
+}
+
+// getSharedVolumeName returns the volume GUID path of the cluster shared
+// volume mounted at root. GetVolumeNameForVolumeMountPoint cannot be used for
+// cluster shared volumes.
+func getSharedVolumeName(root string) (string, error) {
+	if err := procClusterGetVolumeNameForVolumeMountPoint.Find(); err != nil {
+		return "", err
+	}
+	p, err := syscall.UTF16PtrFromString(root)
+	if err != nil {
+		return "", err
+	}
+
+	// A reasonable size for the buffer to accommodate the largest possible
+	// volume GUID path is 50 characters.
+	volumeNameBuffer := make([]uint16, 50)
+	r, _, err := procClusterGetVolumeNameForVolumeMountPoint.Call(uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&volumeNameBuffer[0])), uintptr(len(volumeNameBuffer)))
+	if r == 0 {
+		return "", err
+	}
+	return syscall.UTF16ToString(volumeNameBuffer), nil
+}
@@ -0,0 +1,50 @@
+package fs
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// vssDocuments returns the Backup Components Document and the Writer Metadata
+// Documents, which are indexed by the instance ID of their writer, as
+// auxiliary documents. The paths are relative to the directory of the volume.
+func vssDocuments(backupComponents string, writerMetadata map[string]string) []restic.AuxiliaryDocument {
+	ids := make([]string, 0, len(writerMetadata))
+	for id := range writerMetadata {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	docs := []restic.AuxiliaryDocument{{Path: "backup_components.xml", Data: []byte(backupComponents)}}
+	for _, id := range ids {
+		docs = append(docs, restic.AuxiliaryDocument{
+			Path: path.Join("writers", id+".xml"),
+			Data: []byte(writerMetadata[id]),
+		})
+	}
+	return docs
+}
+
+// vssDocumentDir returns the directory of the documents of the snapshot of a
+// volume, for example "vss/c" for the volume "c:". Colons are removed, other
+// characters which are not allowed in file names are replaced.
+func vssDocumentDir(volume string) string {
+	volume = strings.TrimPrefix(volume, `\\?\`)
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case ':':
+			return -1
+		case '\\', '/', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, volume)
+	name = strings.Trim(name, "_")
+	if name == "" {
+		name = "_"
+	}
+	return path.Join("vss", name)
+}
@@ -0,0 +1,33 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestVSSDocuments(t *testing.T) {
+	docs := vssDocuments("<BACKUP/>", map[string]string{
+		"{b}": "<WRITER name=\"b\"/>",
+		"{a}": "<WRITER name=\"a\"/>",
+	})
+	rtest.Equals(t, []restic.AuxiliaryDocument{
+		{Path: "backup_components.xml", Data: []byte("<BACKUP/>")},
+		{Path: "writers/{a}.xml", Data: []byte("<WRITER name=\"a\"/>")},
+		{Path: "writers/{b}.xml", Data: []byte("<WRITER name=\"b\"/>")},
+	}, docs)
+}
+
+func TestVSSDocumentDir(t *testing.T) {
+	for _, test := range []struct {
+		volume, dir string
+	}{
+		{`c:`, "vss/c"},
+		{`c:\clusterstorage\volume1`, "vss/c_clusterstorage_volume1"},
+		{`\\?\volume{a9e1b0c4-1d2f-4e3a-9b8c-7d6e5f4a3b2c}\`, "vss/volume{a9e1b0c4-1d2f-4e3a-9b8c-7d6e5f4a3b2c}"},
+		{`\\?\`, "vss/_"},
+	} {
+		rtest.Equals(t, test.dir, vssDocumentDir(test.volume))
+	}
+}
@@ -0,0 +1,79 @@
+//go:build windows
+// +build windows
+
+package fs
+
+import (
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// SaveAsXML calls the equivalent VSS api.
+func (vss *IVssBackupComponents) SaveAsXML() (string, error) {
+	var xml *uint16
+	result, _, _ := syscall.Syscall(vss.getVTable().saveAsXML, 2,
+		uintptr(unsafe.Pointer(vss)), uintptr(unsafe.Pointer(&xml)), 0)
+
+	return freeBSTR(xml), newVssErrorIfResultNotOK("SaveAsXML() failed", HRESULT(result))
+}
+
+// SaveAsXML calls the equivalent VSS api.
+func (m *IVssExamineWriterMetadata) SaveAsXML() (string, error) {
+	var xml *uint16
+	result, _, _ := syscall.Syscall(m.getVTable().saveAsXML, 2,
+		uintptr(unsafe.Pointer(m)), uintptr(unsafe.Pointer(&xml)), 0)
+
+	return freeBSTR(xml), newVssErrorIfResultNotOK("SaveAsXML() failed", HRESULT(result))
+}
+
+// readVSSWriterMetadataDocuments returns the Writer Metadata Documents of all
+// writers, indexed by the lowercase instance ID of the writer. It must be
+// called after GatherWriterMetadata and before FreeWriterMetadata.
+func readVSSWriterMetadataDocuments(vss *IVssBackupComponents) (map[string]string, error) {
+	count, err := vss.GetWriterMetadataCount()
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make(map[string]string, count)
+	for i := uint32(0); i < count; i++ {
+		instanceID, metadata, err := vss.GetWriterMetadata(i)
+		if err != nil {
+			return nil, err
+		}
+		xml, err := metadata.SaveAsXML()
+		metadata.Release()
+		if err != nil {
+			return nil, err
+		}
+		documents[strings.ToLower(instanceID.String())] = xml
+	}
+	return documents, nil
+}
+
+// vssSnapshotDocuments returns the Backup Components Document of the snapshot
+// and the Writer Metadata Documents of the writers which took part in it. In
+// component mode, these are only the writers whose components were included.
+// It must be called after DoSnapshotSet.
+func vssSnapshotDocuments(vss *IVssBackupComponents, metadata map[string]string, writers []restic.VSSWriter, componentMode bool) ([]restic.AuxiliaryDocument, error) {
+	backupComponents, err := vss.SaveAsXML()
+	if err != nil {
+		return nil, errors.Wrap(err, "saving Backup Components Document")
+	}
+
+	if componentMode {
+		included := make(map[string]string, len(writers))
+		for _, w := range writers {
+			id := strings.ToLower(w.InstanceID)
+			if xml, ok := metadata[id]; ok {
+				included[id] = xml
+			}
+		}
+		metadata = included
+	}
+	return vssDocuments(backupComponents, metadata), nil
+}
@@ -0,0 +1,76 @@
+package fs
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// RemoteShadowCopy is a shadow copy of a volume of a remote Windows host. Its
+// files are accessed via the administrative share of the volume, using the
+// @GMT token of the shadow copy as the first path component.
+type RemoteShadowCopy struct {
+	host    string
+	id      string
+	created time.Time
+}
+
+// Path returns the root path of the shadow copy within the share.
+func (s *RemoteShadowCopy) Path(share string) string {
+	return `\\?\UNC\` + s.host + `\` + share + `\` + gmtToken(s.created)
+}
+
+// gmtToken returns the token used by SMB to access a shadow copy created at t.
+func gmtToken(t time.Time) string {
+	return t.UTC().Format("@GMT-2006.01.02-15.04.05")
+}
+
+// parseAdminShare splits a path like \\?\UNC\host\C$\dir into the host, the
+// administrative share and the remaining path. ok is false for paths which
+// are not on an administrative share.
+func parseAdminShare(path string) (host, share, rest string, ok bool) {
+	p, found := strings.CutPrefix(path, `\\?\UNC\`)
+	if !found {
+		return "", "", "", false
+	}
+	parts := strings.SplitN(p, `\`, 3)
+	if len(parts) < 2 || parts[0] == "" || !isAdminShare(parts[1]) {
+		return "", "", "", false
+	}
+	if len(parts) == 3 {
+		rest = parts[2]
+	}
+	return parts[0], parts[1], rest, true
+}
+
+// isAdminShare returns true for shares like C$, which share the root of a
+// volume.
+func isAdminShare(share string) bool {
+	if len(share) != 2 || share[1] != '$' {
+		return false
+	}
+	c := share[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+// parseCIMDateTime parses a date in the CIM format used by WMI, for example
+// "20240603080000.123456+120". The suffix is the offset to UTC in minutes.
+func parseCIMDateTime(s string) (time.Time, error) {
+	if len(s) != 25 || (s[21] != '+' && s[21] != '-') {
+		return time.Time{}, errors.Errorf("invalid CIM datetime %q", s)
+	}
+	offset, err := strconv.Atoi(s[22:])
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid CIM datetime %q", s)
+	}
+	if s[21] == '-' {
+		offset = -offset
+	}
+	t, err := time.ParseInLocation("20060102150405.000000", s[:21], time.FixedZone("", offset*60))
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid CIM datetime %q", s)
+	}
+	return t, nil
+}
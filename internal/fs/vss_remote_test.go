@@ -0,0 +1,49 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseAdminShare(t *testing.T) {
+	for _, test := range []struct {
+		path              string
+		host, share, rest string
+		ok                bool
+	}{
+		{`\\?\UNC\fileserver\C$\Users\alice`, "fileserver", "C$", `Users\alice`, true},
+		{`\\?\UNC\fileserver\d$`, "fileserver", "d$", "", true},
+		{`\\?\UNC\fileserver\d$\`, "fileserver", "d$", "", true},
+		{`\\?\UNC\fileserver\data\Users`, "", "", "", false},
+		{`\\?\UNC\fileserver\C$$\Users`, "", "", "", false},
+		{`\\?\UNC\fileserver\1$\Users`, "", "", "", false},
+		{`\\?\UNC\fileserver`, "", "", "", false},
+		{`\\?\C:\Users`, "", "", "", false},
+	} {
+		host, share, rest, ok := parseAdminShare(test.path)
+		rtest.Equals(t, test.ok, ok, test.path)
+		rtest.Equals(t, test.host, host, test.path)
+		rtest.Equals(t, test.share, share, test.path)
+		rtest.Equals(t, test.rest, rest, test.path)
+	}
+}
+
+func TestRemoteShadowCopyPath(t *testing.T) {
+	created, err := parseCIMDateTime("20240603100512.123456+120")
+	rtest.OK(t, err)
+	rtest.Assert(t, created.Equal(time.Date(2024, 6, 3, 8, 5, 12, 123456000, time.UTC)), "wrong time %v", created)
+
+	s := RemoteShadowCopy{host: "fileserver", created: created}
+	rtest.Equals(t, `\\?\UNC\fileserver\C$\@GMT-2024.06.03-08.05.12`, s.Path("C$"))
+
+	created, err = parseCIMDateTime("20240603030000.000000-300")
+	rtest.OK(t, err)
+	rtest.Equals(t, "@GMT-2024.06.03-08.00.00", gmtToken(created))
+
+	for _, s := range []string{"", "20240603100512.123456", "20240603100512.123456*120", "2024060310051a.123456+120"} {
+		_, err := parseCIMDateTime(s)
+		rtest.Assert(t, err != nil, "missing error for %q", s)
+	}
+}
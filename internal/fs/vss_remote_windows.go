@@ -0,0 +1,175 @@
+//go:build windows
+// +build windows
+
+package fs
+
+import (
+	"fmt"
+	"runtime"
+
+	ole "github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
+	"github.com/restic/restic/internal/errors"
+)
+
+// withWMI connects to the WMI service of host and calls fn with the
+// SWbemServices object. COM requires all calls to happen on the same thread.
+func withWMI(host string, fn func(service *ole.IDispatch) error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+		// CoInitializeEx returns S_FALSE if COM is already initialized
+		if oleErr, ok := err.(*ole.OleError); !ok || HRESULT(oleErr.Code()) != S_FALSE {
+			return err
+		}
+	}
+
+	unknown, err := oleutil.CreateObject("WbemScripting.SWbemLocator")
+	if err != nil {
+		return fmt.Errorf("create WMI locator: %w", err)
+	}
+	defer unknown.Release()
+
+	locator, err := unknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return err
+	}
+	defer locator.Release()
+
+	result, err := oleutil.CallMethod(locator, "ConnectServer", host, `root\cimv2`)
+	if err != nil {
+		return fmt.Errorf("connect to WMI on %v: %w", host, err)
+	}
+	defer func() { _ = result.Clear() }()
+
+	return fn(result.ToIDispatch())
+}
+
+// shadowCopyStatus contains the descriptions of the return values of
+// Win32_ShadowCopy.Create.
+var shadowCopyStatus = map[int64]string{
+	1:  "access denied",
+	2:  "invalid argument",
+	3:  "specified volume not found",
+	4:  "specified volume not supported",
+	5:  "unsupported shadow copy context",
+	6:  "insufficient storage",
+	7:  "volume is in use",
+	8:  "maximum number of shadow copies reached",
+	9:  "another shadow copy operation is already in progress",
+	10: "shadow copy provider vetoed the operation",
+	11: "shadow copy provider not registered",
+	12: "shadow copy provider failure",
+}
+
+// NewRemoteShadowCopy requests a shadow copy of the volume with the given
+// drive letter on the remote host via WMI. The shadow copy can be accessed
+// via the administrative share of the volume. This requires administrative
+// privileges on the remote host.
+func NewRemoteShadowCopy(host string, drive byte) (RemoteShadowCopy, error) {
+	var s RemoteShadowCopy
+	err := withWMI(host, func(service *ole.IDispatch) error {
+		class, err := oleutil.CallMethod(service, "Get", "Win32_ShadowCopy")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = class.Clear() }()
+
+		methods, err := oleutil.GetProperty(class.ToIDispatch(), "Methods_")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = methods.Clear() }()
+		method, err := oleutil.CallMethod(methods.ToIDispatch(), "Item", "Create")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = method.Clear() }()
+		inParamsClass, err := oleutil.GetProperty(method.ToIDispatch(), "InParameters")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = inParamsClass.Clear() }()
+		inParams, err := oleutil.CallMethod(inParamsClass.ToIDispatch(), "SpawnInstance_")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = inParams.Clear() }()
+
+		if _, err := oleutil.PutProperty(inParams.ToIDispatch(), "Volume", string(drive)+`:\`); err != nil {
+			return err
+		}
+		// only shadow copies in this context are visible as previous versions
+		if _, err := oleutil.PutProperty(inParams.ToIDispatch(), "Context", "ClientAccessible"); err != nil {
+			return err
+		}
+
+		outParams, err := oleutil.CallMethod(class.ToIDispatch(), "ExecMethod_", "Create", inParams.ToIDispatch())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = outParams.Clear() }()
+
+		ret, err := oleutil.GetProperty(outParams.ToIDispatch(), "ReturnValue")
+		if err != nil {
+			return err
+		}
+		if code := variantToInt(ret); code != 0 {
+			status, ok := shadowCopyStatus[code]
+			if !ok {
+				status = "unknown error"
+			}
+			return errors.Errorf("Win32_ShadowCopy.Create failed with %d: %v", code, status)
+		}
+		id, err := oleutil.GetProperty(outParams.ToIDispatch(), "ShadowID")
+		if err != nil {
+			return err
+		}
+
+		s = RemoteShadowCopy{host: host, id: id.ToString()}
+		instance, err := oleutil.CallMethod(service, "Get", s.objectPath())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = instance.Clear() }()
+		installDate, err := oleutil.GetProperty(instance.ToIDispatch(), "InstallDate")
+		if err != nil {
+			return err
+		}
+		s.created, err = parseCIMDateTime(installDate.ToString())
+		return err
+	})
+	return s, err
+}
+
+func (s *RemoteShadowCopy) objectPath() string {
+	return fmt.Sprintf("Win32_ShadowCopy.ID='%s'", s.id)
+}
+
+// Delete deletes the shadow copy on the remote host.
+func (s *RemoteShadowCopy) Delete() error {
+	return withWMI(s.host, func(service *ole.IDispatch) error {
+		instance, err := oleutil.CallMethod(service, "Get", s.objectPath())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = instance.Clear() }()
+		_, err = oleutil.CallMethod(instance.ToIDispatch(), "Delete_")
+		return err
+	})
+}
+
+func variantToInt(v *ole.VARIANT) int64 {
+	switch value := v.Value().(type) {
+	case int32:
+		return int64(value)
+	case uint32:
+		return int64(value)
+	case int64:
+		return value
+	case uint8:
+		return int64(value)
+	}
+	return -1
+}
@@ -15,6 +15,7 @@ import (
 
 	ole "github.com/go-ole/go-ole"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sys/windows"
 )
 
@@ -787,6 +788,8 @@ type VssSnapshot struct {
 	snapshotDeviceObject string
 	mountPointInfo       map[string]MountPoint
 	timeout              time.Duration
+	writers              []restic.VSSWriter
+	documents            []restic.AuxiliaryDocument
 }
 
 // GetSnapshotDeviceObject returns root path to access the snapshot files
@@ -885,9 +888,11 @@ func getVolumeNameForVolumeMountPoint(mountPoint string) (string, error) {
 }
 
 // NewVssSnapshot creates a new vss snapshot. If creating the snapshots doesn't
-// finish within the timeout an error is returned.
+// finish within the timeout an error is returned. If writers is set, the
+// components of all VSS writers which store their files on the volume are
+// included in the snapshot.
 func NewVssSnapshot(provider string,
-	volume string, timeout time.Duration, filter VolumeFilter, msgError ErrorHandler) (VssSnapshot, error) {
+	volume string, timeout time.Duration, filter VolumeFilter, writers bool, msgError ErrorHandler) (VssSnapshot, error) {
 	is64Bit, err := isRunningOn64BitWindows()
 	if err != nil {
 		return VssSnapshot{}, newVssTextError(fmt.Sprintf(
@@ -952,7 +957,8 @@ func NewVssSnapshot(provider string,
 
 	// see https://techcommunity.microsoft.com/t5/Storage-at-Microsoft/What-is-the-difference-between-VSS-Full-Backup-and-VSS-Copy/ba-p/423575
 
-	if err := iVssBackupComponents.SetBackupState(false, false, VSS_BT_COPY, false); err != nil {
+	// in component mode, only the writers of the added components take part
+	if err := iVssBackupComponents.SetBackupState(writers, false, VSS_BT_COPY, false); err != nil {
 		iVssBackupComponents.Release()
 		return VssSnapshot{}, err
 	}
@@ -964,6 +970,13 @@ func NewVssSnapshot(provider string,
 		return VssSnapshot{}, err
 	}
 
+	// the documents are only needed by application-aware restores, failing
+	// to save them does not affect the snapshot
+	writerMetadata, err := readVSSWriterMetadataDocuments(iVssBackupComponents)
+	if err != nil {
+		msgError(volume, errors.Errorf("VSS error: failed to save Writer Metadata Documents: %v", err))
+	}
+
 	if isSupported, err := iVssBackupComponents.IsVolumeSupported(providerID, volume); err != nil {
 		iVssBackupComponents.Release()
 		return VssSnapshot{}, err
@@ -1037,6 +1050,22 @@ func NewVssSnapshot(provider string,
 		}
 	}
 
+	var vssWriters []restic.VSSWriter
+	if writers {
+		volumes := []string{volume}
+		for mountPoint, info := range mountPointInfo {
+			if info.isSnapshotted {
+				volumes = append(volumes, mountPoint)
+			}
+		}
+
+		vssWriters, err = addVSSWriterComponents(iVssBackupComponents, volume, volumes, msgError)
+		if err != nil {
+			iVssBackupComponents.Release()
+			return VssSnapshot{}, err
+		}
+	}
+
 	err = callAsyncFunctionAndWait(iVssBackupComponents.PrepareForBackup, "PrepareForBackup",
 		deadline)
 	if err != nil {
@@ -1056,6 +1085,20 @@ func NewVssSnapshot(provider string,
 		return VssSnapshot{}, err
 	}
 
+	if writers {
+		err = updateVSSWriterStatus(iVssBackupComponents, vssWriters, deadline, msgError)
+		if err != nil {
+			_ = iVssBackupComponents.AbortBackup()
+			iVssBackupComponents.Release()
+			return VssSnapshot{}, err
+		}
+	}
+
+	documents, err := vssSnapshotDocuments(iVssBackupComponents, writerMetadata, vssWriters, writers)
+	if err != nil {
+		msgError(volume, errors.Errorf("VSS error: %v", err))
+	}
+
 	var snapshotProperties VssSnapshotProperties
 	err = iVssBackupComponents.GetSnapshotProperties(snapshotSetID, &snapshotProperties)
 	if err != nil {
@@ -1086,6 +1129,7 @@ func NewVssSnapshot(provider string,
 	return VssSnapshot{
 		iVssBackupComponents, snapshotSetID, snapshotProperties,
 		snapshotProperties.GetSnapshotDeviceObject(), mountPointInfo, time.Until(deadline),
+		vssWriters, documents,
 	}, nil
 }
 
@@ -0,0 +1,117 @@
+package fs
+
+import (
+	"strings"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// vssWriterComponent is a component listed in the metadata of a VSS writer.
+type vssWriterComponent struct {
+	restic.VSSComponent
+	componentType uint32
+	// files contains the directories of the files which belong to the
+	// component, wildcards are not included.
+	files []string
+}
+
+// path returns the full logical path of the component.
+func (c *vssWriterComponent) path() string {
+	if c.LogicalPath == "" {
+		return c.Name
+	}
+	return c.LogicalPath + `\` + c.Name
+}
+
+// isSubcomponentOf returns true if c is a direct or indirect subcomponent of
+// parent.
+func (c *vssWriterComponent) isSubcomponentOf(parent *vssWriterComponent) bool {
+	p := strings.ToLower(parent.path())
+	l := strings.ToLower(c.LogicalPath)
+	return l == p || strings.HasPrefix(l, p+`\`)
+}
+
+// selectVSSComponents returns the top-level components which have at least
+// one file and whose files, including those of their subcomponents, are all
+// stored on the volume. Subcomponents are included implicitly by the writer
+// when their parent is selected. Top-level components with files on the volume
+// and on other volumes are returned as spanning, as a snapshot only contains a
+// single volume.
+func selectVSSComponents(components []vssWriterComponent, onVolume func(path string) bool) (selected, spanning []vssWriterComponent) {
+	for i := range components {
+		c := &components[i]
+
+		topLevel := true
+		for j := range components {
+			if i != j && c.isSubcomponentOf(&components[j]) {
+				topLevel = false
+				break
+			}
+		}
+		if !topLevel {
+			continue
+		}
+
+		var inside, outside int
+		for j := range components {
+			if i != j && !components[j].isSubcomponentOf(c) {
+				continue
+			}
+			for _, file := range components[j].files {
+				if onVolume(file) {
+					inside++
+				} else {
+					outside++
+				}
+			}
+		}
+
+		switch {
+		case inside > 0 && outside == 0:
+			selected = append(selected, *c)
+		case inside > 0:
+			spanning = append(spanning, *c)
+		}
+	}
+	return selected, spanning
+}
+
+// vssWriterStateNames contains the names of the VSS_WRITER_STATE values.
+var vssWriterStateNames = []string{
+	"unknown",
+	"stable",
+	"waiting for freeze",
+	"waiting for thaw",
+	"waiting for post snapshot",
+	"waiting for backup complete",
+	"failed at identify",
+	"failed at prepare backup",
+	"failed at prepare snapshot",
+	"failed at freeze",
+	"failed at thaw",
+	"failed at post snapshot",
+	"failed at backup complete",
+	"failed at pre restore",
+	"failed at post restore",
+	"failed at backup shutdown",
+}
+
+// vssWriterStateName returns the name of a VSS_WRITER_STATE value.
+func vssWriterStateName(state uint32) string {
+	if int(state) < len(vssWriterStateNames) {
+		return vssWriterStateNames[state]
+	}
+	return "unknown"
+}
+
+// vssComponentTypeName returns the name of a VSS_COMPONENT_TYPE value.
+func vssComponentTypeName(componentType uint32) string {
+	switch componentType {
+	case 1:
+		return "database"
+	case 2:
+		return "file group"
+	default:
+		return "undefined"
+	}
+}
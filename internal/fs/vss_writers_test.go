@@ -0,0 +1,57 @@
+package fs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSelectVSSComponents(t *testing.T) {
+	component := func(logicalPath, name string, files ...string) vssWriterComponent {
+		return vssWriterComponent{
+			VSSComponent: restic.VSSComponent{Name: name, LogicalPath: logicalPath},
+			files:        files,
+		}
+	}
+
+	components := []vssWriterComponent{
+		component("", "SQL01"),
+		component(`SQL01`, "master", `D:\Data`, `D:\Logs`),
+		component(`sql01`, "sales", `D:\Data`, `E:\Logs`),
+		component("", "Hyper-V", `C:\VMs`),
+		component(`Hyper-V`, "web01", `D:\VMs\web01`),
+		component("", "Registry", `C:\Windows\System32\config`),
+		component("", "Empty"),
+		component("", "Other", `E:\Data`),
+	}
+
+	onVolume := func(path string) bool {
+		return strings.HasPrefix(path, `D:\`)
+	}
+	selected, spanning := selectVSSComponents(components, onVolume)
+
+	names := func(list []vssWriterComponent) []string {
+		var names []string
+		for _, c := range list {
+			names = append(names, c.path())
+		}
+		return names
+	}
+	rtest.Equals(t, []string(nil), names(selected))
+	rtest.Equals(t, []string{"SQL01", "Hyper-V"}, names(spanning))
+
+	onVolume = func(path string) bool {
+		return !strings.HasPrefix(path, `C:\`)
+	}
+	selected, spanning = selectVSSComponents(components, onVolume)
+	rtest.Equals(t, []string{"SQL01", "Other"}, names(selected))
+	rtest.Equals(t, []string{"Hyper-V"}, names(spanning))
+}
+
+func TestVSSWriterStateName(t *testing.T) {
+	rtest.Equals(t, "stable", vssWriterStateName(1))
+	rtest.Equals(t, "failed at freeze", vssWriterStateName(9))
+	rtest.Equals(t, "unknown", vssWriterStateName(100))
+}
@@ -0,0 +1,519 @@
+//go:build windows
+// +build windows
+
+package fs
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"golang.org/x/sys/windows"
+)
+
+// GetWriterMetadataCount calls the equivalent VSS api.
+func (vss *IVssBackupComponents) GetWriterMetadataCount() (uint32, error) {
+	var count uint32
+	result, _, _ := syscall.Syscall(vss.getVTable().getWriterMetadataCount, 2,
+		uintptr(unsafe.Pointer(vss)), uintptr(unsafe.Pointer(&count)), 0)
+
+	return count, newVssErrorIfResultNotOK("GetWriterMetadataCount() failed", HRESULT(result))
+}
+
+// GetWriterMetadata calls the equivalent VSS api.
+func (vss *IVssBackupComponents) GetWriterMetadata(index uint32) (ole.GUID, *IVssExamineWriterMetadata, error) {
+	var instanceID ole.GUID
+	var metadata *IVssExamineWriterMetadata
+	result, _, _ := syscall.Syscall6(vss.getVTable().getWriterMetadata, 4,
+		uintptr(unsafe.Pointer(vss)), uintptr(index), uintptr(unsafe.Pointer(&instanceID)),
+		uintptr(unsafe.Pointer(&metadata)), 0, 0)
+
+	return instanceID, metadata, newVssErrorIfResultNotOK("GetWriterMetadata() failed", HRESULT(result))
+}
+
+// FreeWriterMetadata calls the equivalent VSS api.
+func (vss *IVssBackupComponents) FreeWriterMetadata() error {
+	result, _, _ := syscall.Syscall(vss.getVTable().freeWriterMetadata, 1,
+		uintptr(unsafe.Pointer(vss)), 0, 0)
+
+	return newVssErrorIfResultNotOK("FreeWriterMetadata() failed", HRESULT(result))
+}
+
+// AddComponent calls the equivalent VSS api.
+func (vss *IVssBackupComponents) AddComponent(instanceID, writerID *ole.GUID, componentType uint32,
+	logicalPath, componentName string) error {
+	var logicalPathPointer *uint16
+	if logicalPath != "" {
+		var err error
+		logicalPathPointer, err = syscall.UTF16PtrFromString(logicalPath)
+		if err != nil {
+			return err
+		}
+	}
+	componentNamePointer, err := syscall.UTF16PtrFromString(componentName)
+	if err != nil {
+		return err
+	}
+
+	var result uintptr
+
+	if runtime.GOARCH == "386" {
+		instance := (*[4]uintptr)(unsafe.Pointer(instanceID))
+		writer := (*[4]uintptr)(unsafe.Pointer(writerID))
+
+		result, _, _ = syscall.Syscall12(vss.getVTable().addComponent, 12,
+			uintptr(unsafe.Pointer(vss)), instance[0], instance[1], instance[2], instance[3],
+			writer[0], writer[1], writer[2], writer[3], uintptr(componentType),
+			uintptr(unsafe.Pointer(logicalPathPointer)), uintptr(unsafe.Pointer(componentNamePointer)))
+	} else {
+		result, _, _ = syscall.Syscall6(vss.getVTable().addComponent, 6,
+			uintptr(unsafe.Pointer(vss)), uintptr(unsafe.Pointer(instanceID)),
+			uintptr(unsafe.Pointer(writerID)), uintptr(componentType),
+			uintptr(unsafe.Pointer(logicalPathPointer)), uintptr(unsafe.Pointer(componentNamePointer)))
+	}
+
+	return newVssErrorIfResultNotOK("AddComponent() failed", HRESULT(result))
+}
+
+// GatherWriterStatus calls the equivalent VSS api.
+func (vss *IVssBackupComponents) GatherWriterStatus() (*IVSSAsync, error) {
+	var oleIUnknown *ole.IUnknown
+	result, _, _ := syscall.Syscall(vss.getVTable().gatherWriterStatus, 2,
+		uintptr(unsafe.Pointer(vss)), uintptr(unsafe.Pointer(&oleIUnknown)), 0)
+
+	err := newVssErrorIfResultNotOK("GatherWriterStatus() failed", HRESULT(result))
+	return vss.convertToVSSAsync(oleIUnknown, err)
+}
+
+// GetWriterStatusCount calls the equivalent VSS api.
+func (vss *IVssBackupComponents) GetWriterStatusCount() (uint32, error) {
+	var count uint32
+	result, _, _ := syscall.Syscall(vss.getVTable().getWriterStatusCount, 2,
+		uintptr(unsafe.Pointer(vss)), uintptr(unsafe.Pointer(&count)), 0)
+
+	return count, newVssErrorIfResultNotOK("GetWriterStatusCount() failed", HRESULT(result))
+}
+
+// vssWriterStatus is the status of a VSS writer returned by GetWriterStatus.
+type vssWriterStatus struct {
+	instanceID ole.GUID
+	writerID   ole.GUID
+	name       string
+	state      uint32
+	failure    HRESULT
+}
+
+// GetWriterStatus calls the equivalent VSS api.
+func (vss *IVssBackupComponents) GetWriterStatus(index uint32) (vssWriterStatus, error) {
+	var status vssWriterStatus
+	var name *uint16
+	var failure int32
+	result, _, _ := syscall.Syscall9(vss.getVTable().getWriterStatus, 7,
+		uintptr(unsafe.Pointer(vss)), uintptr(index), uintptr(unsafe.Pointer(&status.instanceID)),
+		uintptr(unsafe.Pointer(&status.writerID)), uintptr(unsafe.Pointer(&name)),
+		uintptr(unsafe.Pointer(&status.state)), uintptr(unsafe.Pointer(&failure)), 0, 0)
+
+	status.name = freeBSTR(name)
+	status.failure = HRESULT(uint32(failure))
+	return status, newVssErrorIfResultNotOK("GetWriterStatus() failed", HRESULT(result))
+}
+
+// FreeWriterStatus calls the equivalent VSS api.
+func (vss *IVssBackupComponents) FreeWriterStatus() error {
+	result, _, _ := syscall.Syscall(vss.getVTable().freeWriterStatus, 1,
+		uintptr(unsafe.Pointer(vss)), 0, 0)
+
+	return newVssErrorIfResultNotOK("FreeWriterStatus() failed", HRESULT(result))
+}
+
+// IVssExamineWriterMetadata VSS api interface.
+type IVssExamineWriterMetadata struct {
+	ole.IUnknown
+}
+
+// IVssExamineWriterMetadataVTable is the vtable for IVssExamineWriterMetadata.
+// nolint:structcheck
+type IVssExamineWriterMetadataVTable struct {
+	ole.IUnknownVtbl
+	getIdentity                 uintptr
+	getFileCounts               uintptr
+	getIncludeFile              uintptr
+	getExcludeFile              uintptr
+	getComponent                uintptr
+	getRestoreMethod            uintptr
+	getAlternateLocationMapping uintptr
+	getBackupSchema             uintptr
+	getDocument                 uintptr
+	saveAsXML                   uintptr
+	loadFromXML                 uintptr
+}
+
+// getVTable returns the vtable for IVssExamineWriterMetadata.
+func (m *IVssExamineWriterMetadata) getVTable() *IVssExamineWriterMetadataVTable {
+	return (*IVssExamineWriterMetadataVTable)(unsafe.Pointer(m.RawVTable))
+}
+
+// GetIdentity calls the equivalent VSS api.
+func (m *IVssExamineWriterMetadata) GetIdentity() (instanceID, writerID ole.GUID, name string, err error) {
+	var namePointer *uint16
+	var usage, source uint32
+	result, _, _ := syscall.Syscall6(m.getVTable().getIdentity, 6,
+		uintptr(unsafe.Pointer(m)), uintptr(unsafe.Pointer(&instanceID)),
+		uintptr(unsafe.Pointer(&writerID)), uintptr(unsafe.Pointer(&namePointer)),
+		uintptr(unsafe.Pointer(&usage)), uintptr(unsafe.Pointer(&source)))
+
+	name = freeBSTR(namePointer)
+	return instanceID, writerID, name, newVssErrorIfResultNotOK("GetIdentity() failed", HRESULT(result))
+}
+
+// GetFileCounts calls the equivalent VSS api.
+func (m *IVssExamineWriterMetadata) GetFileCounts() (components uint32, err error) {
+	var includeFiles, excludeFiles uint32
+	result, _, _ := syscall.Syscall6(m.getVTable().getFileCounts, 4,
+		uintptr(unsafe.Pointer(m)), uintptr(unsafe.Pointer(&includeFiles)),
+		uintptr(unsafe.Pointer(&excludeFiles)), uintptr(unsafe.Pointer(&components)), 0, 0)
+
+	return components, newVssErrorIfResultNotOK("GetFileCounts() failed", HRESULT(result))
+}
+
+// GetComponent calls the equivalent VSS api.
+func (m *IVssExamineWriterMetadata) GetComponent(index uint32) (*IVssWMComponent, error) {
+	var component *IVssWMComponent
+	result, _, _ := syscall.Syscall(m.getVTable().getComponent, 3,
+		uintptr(unsafe.Pointer(m)), uintptr(index), uintptr(unsafe.Pointer(&component)))
+
+	return component, newVssErrorIfResultNotOK("GetComponent() failed", HRESULT(result))
+}
+
+// IVssWMComponent VSS api interface.
+type IVssWMComponent struct {
+	ole.IUnknown
+}
+
+// IVssWMComponentVTable is the vtable for IVssWMComponent.
+// nolint:structcheck
+type IVssWMComponentVTable struct {
+	ole.IUnknownVtbl
+	getComponentInfo   uintptr
+	freeComponentInfo  uintptr
+	getFile            uintptr
+	getDatabaseFile    uintptr
+	getDatabaseLogFile uintptr
+	getDependency      uintptr
+}
+
+// vssComponentInfo is the VSS_COMPONENTINFO structure of the VSS api.
+// nolint:structcheck
+type vssComponentInfo struct {
+	componentType          uint32
+	logicalPath            *uint16
+	componentName          *uint16
+	caption                *uint16
+	icon                   *byte
+	iconSize               uint32
+	restoreMetadata        bool
+	notifyOnBackupComplete bool
+	selectable             bool
+	selectableForRestore   bool
+	componentFlags         uint32
+	fileCount              uint32
+	databases              uint32
+	logFiles               uint32
+	dependencies           uint32
+}
+
+// getVTable returns the vtable for IVssWMComponent.
+func (c *IVssWMComponent) getVTable() *IVssWMComponentVTable {
+	return (*IVssWMComponentVTable)(unsafe.Pointer(c.RawVTable))
+}
+
+// GetComponentInfo calls the equivalent VSS api. The result must be freed
+// using FreeComponentInfo.
+func (c *IVssWMComponent) GetComponentInfo() (*vssComponentInfo, error) {
+	var info *vssComponentInfo
+	result, _, _ := syscall.Syscall(c.getVTable().getComponentInfo, 2,
+		uintptr(unsafe.Pointer(c)), uintptr(unsafe.Pointer(&info)), 0)
+
+	return info, newVssErrorIfResultNotOK("GetComponentInfo() failed", HRESULT(result))
+}
+
+// FreeComponentInfo calls the equivalent VSS api.
+func (c *IVssWMComponent) FreeComponentInfo(info *vssComponentInfo) {
+	_, _, _ = syscall.Syscall(c.getVTable().freeComponentInfo, 2,
+		uintptr(unsafe.Pointer(c)), uintptr(unsafe.Pointer(info)), 0)
+}
+
+// getFileDescriptor calls GetFile, GetDatabaseFile or GetDatabaseLogFile.
+func (c *IVssWMComponent) getFileDescriptor(method uintptr, name string, index uint32) (*IVssWMFiledesc, error) {
+	var desc *IVssWMFiledesc
+	result, _, _ := syscall.Syscall(method, 3,
+		uintptr(unsafe.Pointer(c)), uintptr(index), uintptr(unsafe.Pointer(&desc)))
+
+	return desc, newVssErrorIfResultNotOK(name+"() failed", HRESULT(result))
+}
+
+// Paths returns the expanded paths of all files, database files and database
+// log files of the component.
+func (c *IVssWMComponent) Paths(info *vssComponentInfo) ([]string, error) {
+	vtable := c.getVTable()
+	files := []struct {
+		method uintptr
+		name   string
+		count  uint32
+	}{
+		{vtable.getFile, "GetFile", info.fileCount},
+		{vtable.getDatabaseFile, "GetDatabaseFile", info.databases},
+		{vtable.getDatabaseLogFile, "GetDatabaseLogFile", info.logFiles},
+	}
+
+	var paths []string
+	for _, f := range files {
+		for i := uint32(0); i < f.count; i++ {
+			desc, err := c.getFileDescriptor(f.method, f.name, i)
+			if err != nil {
+				return nil, err
+			}
+			path, err := desc.GetPath()
+			desc.Release()
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, expandEnvironmentStrings(path))
+		}
+	}
+	return paths, nil
+}
+
+// IVssWMFiledesc VSS api interface.
+type IVssWMFiledesc struct {
+	ole.IUnknown
+}
+
+// IVssWMFiledescVTable is the vtable for IVssWMFiledesc.
+// nolint:structcheck
+type IVssWMFiledescVTable struct {
+	ole.IUnknownVtbl
+	getPath              uintptr
+	getFilespec          uintptr
+	getRecursive         uintptr
+	getAlternateLocation uintptr
+	getBackupTypeMask    uintptr
+}
+
+// getVTable returns the vtable for IVssWMFiledesc.
+func (d *IVssWMFiledesc) getVTable() *IVssWMFiledescVTable {
+	return (*IVssWMFiledescVTable)(unsafe.Pointer(d.RawVTable))
+}
+
+// GetPath calls the equivalent VSS api.
+func (d *IVssWMFiledesc) GetPath() (string, error) {
+	var path *uint16
+	result, _, _ := syscall.Syscall(d.getVTable().getPath, 2,
+		uintptr(unsafe.Pointer(d)), uintptr(unsafe.Pointer(&path)), 0)
+
+	return freeBSTR(path), newVssErrorIfResultNotOK("GetPath() failed", HRESULT(result))
+}
+
+// freeBSTR converts a BSTR returned by the VSS api to a string and frees it.
+func freeBSTR(s *uint16) string {
+	if s == nil {
+		return ""
+	}
+	str := ole.BstrToString(s)
+	_ = ole.SysFreeString((*int16)(unsafe.Pointer(s)))
+	return str
+}
+
+// expandEnvironmentStrings replaces references to environment variables like
+// %SystemRoot% in path.
+func expandEnvironmentStrings(path string) string {
+	src, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return path
+	}
+
+	buf := make([]uint16, 260)
+	for {
+		n, err := windows.ExpandEnvironmentStrings(src, &buf[0], uint32(len(buf)))
+		if err != nil {
+			return path
+		}
+		if int(n) <= len(buf) {
+			return windows.UTF16ToString(buf[:n])
+		}
+		buf = make([]uint16, n)
+	}
+}
+
+// volumeOfPath returns the volume GUID path of the volume path is stored on.
+func volumeOfPath(path string) (string, error) {
+	pathPointer, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	if err := windows.GetVolumePathName(pathPointer, &buf[0], uint32(len(buf))); err != nil {
+		return "", err
+	}
+	return getVolumeNameForVolumeMountPoint(windows.UTF16ToString(buf))
+}
+
+// addVSSWriterComponents adds the components of all VSS writers whose files
+// are stored on the volumes to the backup. The writers of these components are
+// returned. It must be called after GatherWriterMetadata and before
+// PrepareForBackup.
+func addVSSWriterComponents(vss *IVssBackupComponents, volume string, volumes []string, msgError ErrorHandler) ([]restic.VSSWriter, error) {
+	volumeNames := make(map[string]struct{})
+	for _, v := range volumes {
+		name, err := getVolumeNameForVolumeMountPoint(v)
+		if err != nil {
+			return nil, err
+		}
+		volumeNames[strings.ToLower(name)] = struct{}{}
+	}
+	onVolume := func(path string) bool {
+		name, err := volumeOfPath(path)
+		if err != nil {
+			return false
+		}
+		_, ok := volumeNames[strings.ToLower(name)]
+		return ok
+	}
+
+	count, err := vss.GetWriterMetadataCount()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = vss.FreeWriterMetadata()
+	}()
+
+	var writers []restic.VSSWriter
+	for i := uint32(0); i < count; i++ {
+		_, metadata, err := vss.GetWriterMetadata(i)
+		if err != nil {
+			return nil, err
+		}
+		writer, components, err := readVSSWriterMetadata(metadata)
+		metadata.Release()
+		if err != nil {
+			return nil, err
+		}
+
+		selected, spanning := selectVSSComponents(components, onVolume)
+		for _, c := range spanning {
+			msgError(c.path(), errors.Errorf("VSS writer %v: component is stored on multiple volumes and was not included", writer.Name))
+		}
+		if len(selected) == 0 {
+			continue
+		}
+
+		instanceID, writerID := ole.NewGUID(writer.InstanceID), ole.NewGUID(writer.WriterID)
+		for _, c := range selected {
+			if err := vss.AddComponent(instanceID, writerID, c.componentType, c.LogicalPath, c.Name); err != nil {
+				return nil, err
+			}
+			writer.Components = append(writer.Components, c.VSSComponent)
+		}
+		writer.Volume = volume
+		writers = append(writers, writer)
+	}
+	return writers, nil
+}
+
+// readVSSWriterMetadata returns the identity and the components of a writer.
+func readVSSWriterMetadata(metadata *IVssExamineWriterMetadata) (restic.VSSWriter, []vssWriterComponent, error) {
+	instanceID, writerID, name, err := metadata.GetIdentity()
+	if err != nil {
+		return restic.VSSWriter{}, nil, err
+	}
+	writer := restic.VSSWriter{
+		Name:       name,
+		WriterID:   writerID.String(),
+		InstanceID: instanceID.String(),
+	}
+
+	count, err := metadata.GetFileCounts()
+	if err != nil {
+		return writer, nil, err
+	}
+
+	components := make([]vssWriterComponent, 0, count)
+	for i := uint32(0); i < count; i++ {
+		c, err := metadata.GetComponent(i)
+		if err != nil {
+			return writer, nil, err
+		}
+		component, err := readVSSComponent(c)
+		c.Release()
+		if err != nil {
+			return writer, nil, fmt.Errorf("writer %v: %w", name, err)
+		}
+		components = append(components, component)
+	}
+	return writer, components, nil
+}
+
+func readVSSComponent(c *IVssWMComponent) (vssWriterComponent, error) {
+	info, err := c.GetComponentInfo()
+	if err != nil {
+		return vssWriterComponent{}, err
+	}
+	defer c.FreeComponentInfo(info)
+
+	component := vssWriterComponent{
+		VSSComponent: restic.VSSComponent{
+			Name:        ole.BstrToString(info.componentName),
+			LogicalPath: ole.BstrToString(info.logicalPath),
+			Type:        vssComponentTypeName(info.componentType),
+			Caption:     ole.BstrToString(info.caption),
+		},
+		componentType: info.componentType,
+	}
+	component.files, err = c.Paths(info)
+	return component, err
+}
+
+// updateVSSWriterStatus stores the state of each writer after the snapshot
+// was created. Failed writers are reported to msgError, the files of their
+// components may not be in a consistent state.
+func updateVSSWriterStatus(vss *IVssBackupComponents, writers []restic.VSSWriter, deadline time.Time, msgError ErrorHandler) error {
+	err := callAsyncFunctionAndWait(vss.GatherWriterStatus, "GatherWriterStatus", deadline)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = vss.FreeWriterStatus()
+	}()
+
+	count, err := vss.GetWriterStatusCount()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		status, err := vss.GetWriterStatus(i)
+		if err != nil {
+			return err
+		}
+
+		for j := range writers {
+			w := &writers[j]
+			if !strings.EqualFold(w.InstanceID, status.instanceID.String()) {
+				continue
+			}
+			w.State = vssWriterStateName(status.state)
+			if status.failure != S_OK {
+				w.Error = status.failure.Str()
+				msgError(w.Name, errors.Errorf("VSS writer %v is in state %q: %v, its components may not be consistent", w.Name, w.State, w.Error))
+			}
+		}
+	}
+	return nil
+}
@@ -23,7 +23,7 @@ var _ = fs.HandleReadDirAller(&dir{})
 var _ = fs.NodeForgetter(&dir{})
 var _ = fs.NodeGetxattrer(&dir{})
 var _ = fs.NodeListxattrer(&dir{})
-var _ = fs.NodeStringLookuper(&dir{})
+var _ = fs.NodeRequestLookuper(&dir{})
 
 type dir struct {
 	root        *Root
@@ -34,6 +34,9 @@ type dir struct {
 	node        *restic.Node
 	m           sync.Mutex
 	cache       treeCache
+	// subtree is the path of the directory within node.Subtree shown by the
+	// directory, it is only set for snapshot directories.
+	subtree string
 }
 
 func cleanupNodeName(name string) string {
@@ -94,8 +97,9 @@ func newDirFromSnapshot(root *Root, forget forgetFn, inode uint64, snapshot *res
 			Mode:       os.ModeDir | 0555,
 			Subtree:    snapshot.Tree,
 		},
-		inode: inode,
-		cache: *newTreeCache(),
+		inode:   inode,
+		cache:   *newTreeCache(),
+		subtree: root.cfg.Subtree,
 	}, nil
 }
 
@@ -109,7 +113,30 @@ func (d *dir) open(ctx context.Context) error {
 
 	debug.Log("open dir %v (%v)", d.node.Name, d.node.Subtree)
 
-	tree, err := restic.LoadTree(ctx, d.root.repo, *d.node.Subtree)
+	id := d.node.Subtree
+	if d.subtree != "" {
+		// only loads the trees along the path
+		subtree, err := restic.FindTreeDirectory(ctx, d.root.repo, id, d.subtree)
+		if errors.Is(err, restic.ErrDirectoryNotFound) {
+			// the snapshot does not contain the subtree
+			debug.Log("  subtree %v not found: %v", d.subtree, err)
+			d.items = make(map[string]*restic.Node)
+			return nil
+		}
+		if err != nil {
+			debug.Log("  error loading subtree %v: %v", d.subtree, err)
+			return unwrapCtxCanceled(err)
+		}
+		id = subtree
+	}
+
+	if items, ok := d.root.dirCache.get(*id); ok {
+		debug.Log("  using cached entries of tree %v", id)
+		d.items = items
+		return nil
+	}
+
+	tree, err := restic.LoadTree(ctx, d.root.repo, *id)
 	if err != nil {
 		debug.Log("  error loading tree %v: %v", d.node.Subtree, err)
 		return unwrapCtxCanceled(err)
@@ -129,6 +156,7 @@ func (d *dir) open(ctx context.Context) error {
 			items[cleanupNodeName(node.Name)] = node
 		}
 	}
+	d.root.dirCache.add(*id, items)
 	d.items = items
 	return nil
 }
@@ -147,6 +175,7 @@ func (d *dir) Attr(_ context.Context, a *fuse.Attr) error {
 	a.Mtime = d.node.ModTime
 
 	a.Nlink = d.calcNumberOfLinks()
+	d.root.setAttrValid(a)
 
 	return nil
 }
@@ -209,13 +238,15 @@ func (d *dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	return ret, nil
 }
 
-func (d *dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+func (d *dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
+	name := req.Name
 	debug.Log("Lookup(%v)", name)
 
 	err := d.open(ctx)
 	if err != nil {
 		return nil, err
 	}
+	resp.EntryValid = d.root.cfg.EntryTimeout
 
 	return d.cache.lookupOrCreate(name, func(forget forgetFn) (fs.Node, error) {
 		node, ok := d.items[name]
@@ -0,0 +1,54 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package fuse
+
+import (
+	"sync"
+
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// dirCache keeps the entries of recently opened directories by tree ID. This
+// avoids loading the same tree again when the kernel forgets a directory and
+// looks it up again later, or when the tree is part of several snapshots.
+// It is safe for concurrent access, a nil *dirCache caches nothing.
+type dirCache struct {
+	m sync.Mutex
+	c *simplelru.LRU[restic.ID, map[string]*restic.Node]
+}
+
+// newDirCache returns a cache for the entries of up to size directories. For
+// size zero, nil is returned.
+func newDirCache(size int) *dirCache {
+	if size <= 0 {
+		return nil
+	}
+	lru, err := simplelru.NewLRU[restic.ID, map[string]*restic.Node](size, nil)
+	if err != nil {
+		panic(err) // Can only be size <= 0.
+	}
+	return &dirCache{c: lru}
+}
+
+func (c *dirCache) get(id restic.ID) (map[string]*restic.Node, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.c.Get(id)
+}
+
+// add stores the entries of a directory. The map must not be modified
+// afterwards, as it is shared by all directories with the same tree.
+func (c *dirCache) add(id restic.ID, items map[string]*restic.Node) {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.c.Add(id, items)
+}
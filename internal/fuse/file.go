@@ -6,6 +6,7 @@ package fuse
 import (
 	"context"
 	"sort"
+	"sync"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -36,6 +37,13 @@ type openFile struct {
 	file
 	// cumsize[i] holds the cumulative size of blobs[:i].
 	cumsize []uint64
+
+	// read pattern tracking for the read-ahead
+	readMu sync.Mutex
+	// nextOffset is the offset directly after the last read
+	nextOffset uint64
+	// prefetched is the index of the first blob not yet scheduled for prefetching
+	prefetched int
 }
 
 func newFile(root *Root, forget forgetFn, inode uint64, node *restic.Node) (fusefile *file, err error) {
@@ -64,6 +72,7 @@ func (f *file) Attr(_ context.Context, a *fuse.Attr) error {
 	a.Atime = f.node.AccessTime
 	a.Ctime = f.node.ChangeTime
 	a.Mtime = f.node.ModTime
+	f.root.setAttrValid(a)
 
 	return nil
 
@@ -88,7 +97,7 @@ func (f *file) Open(ctx context.Context, _ *fuse.OpenRequest, _ *fuse.OpenRespon
 		cumsize[i+1] = bytes
 	}
 
-	var of = openFile{file: *f}
+	var of = &openFile{file: *f}
 
 	if bytes != f.node.Size {
 		debug.Log("sizes do not match: node.Size %v != size %v, using real size", f.node.Size, bytes)
@@ -99,7 +108,49 @@ func (f *file) Open(ctx context.Context, _ *fuse.OpenRequest, _ *fuse.OpenRespon
 	}
 	of.cumsize = cumsize
 
-	return &of, nil
+	return of, nil
+}
+
+// scheduleReadAhead prefetches the blobs following a read of size bytes at
+// offset if the file is read sequentially.
+func (f *openFile) scheduleReadAhead(offset uint64, size int) {
+	ra := f.root.readAhead
+	if ra == nil {
+		return
+	}
+
+	end := offset + uint64(size)
+
+	f.readMu.Lock()
+	sequential := offset == f.nextOffset
+	f.nextOffset = end
+	if !sequential {
+		// random access, start over once sequential reads resume
+		f.prefetched = 0
+		f.readMu.Unlock()
+		return
+	}
+
+	// prefetch all blobs starting within [end, end+ra.size)
+	numBlobs := len(f.cumsize) - 1
+	first := sort.Search(numBlobs, func(i int) bool {
+		return f.cumsize[i] >= end
+	})
+	last := sort.Search(numBlobs, func(i int) bool {
+		return f.cumsize[i] >= end+ra.size
+	})
+	if first < f.prefetched {
+		first = f.prefetched
+	}
+	if first >= last {
+		f.readMu.Unlock()
+		return
+	}
+	f.prefetched = last
+	f.readMu.Unlock()
+
+	debug.Log("read-ahead for %v: blobs %d to %d", f.node.Name, first, last)
+	ra.prefetch(f.node.Content[first:last])
 }
 
 func (f *openFile) getBlobAt(ctx context.Context, i int) (blob []byte, err error) {
@@ -133,6 +184,8 @@ func (f *openFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.R
 	})
 	offset -= f.cumsize[startContent]
 
+	f.scheduleReadAhead(uint64(req.Offset), req.Size)
+
 	dst := resp.Data[0:req.Size]
 	readBytes := 0
 	remainingBytes := req.Size
@@ -6,8 +6,11 @@ package fuse
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"math/rand"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -147,6 +150,101 @@ func TestFuseFile(t *testing.T) {
 	}
 }
 
+func TestFuseFileReadAhead(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	timestamp, err := time.Parse(time.RFC3339, "2017-01-24T10:42:56+01:00")
+	rtest.OK(t, err)
+	restic.TestCreateSnapshot(t, repo, timestamp, 2)
+
+	sn := loadFirstSnapshot(t, repo)
+	tree := loadTree(t, repo, *sn.Tree)
+
+	var (
+		content restic.IDs
+		memfile []byte
+	)
+	for _, node := range tree.Nodes {
+		for _, id := range node.Content {
+			buf, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+			rtest.OK(t, err)
+			content = append(content, id)
+			memfile = append(memfile, buf...)
+		}
+	}
+	rtest.Assert(t, len(content) > 2, "test file needs more than two blobs, got %d", len(content))
+
+	node := &restic.Node{
+		Name:    "foo",
+		Size:    uint64(len(memfile)),
+		Content: content,
+	}
+	cache := bloblru.New(blobCacheSize)
+	root := &Root{repo: repo, blobCache: cache}
+	root.readAhead = newReadAhead(context.TODO(), repo, cache, blobCacheSize, 2)
+
+	f, err := newFile(root, func() {}, 1, node)
+	rtest.OK(t, err)
+	of, err := f.Open(context.TODO(), nil, nil)
+	rtest.OK(t, err)
+
+	// a sequential read of the first byte must prefetch the following blobs
+	buf := make([]byte, 1)
+	testRead(t, of, 0, 1, buf)
+	rtest.Equals(t, memfile[:1], buf)
+
+	for _, id := range content[1:] {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			if _, ok := cache.Get(id); ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("blob %v was not prefetched", id.Str())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// the remaining data must be returned correctly
+	buf = make([]byte, len(memfile)-1)
+	testRead(t, of, 1, len(buf), buf)
+	if !bytes.Equal(memfile[1:], buf) {
+		t.Error("wrong data returned after read-ahead")
+	}
+}
+
+func TestFuseReadAheadCancel(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	timestamp, err := time.Parse(time.RFC3339, "2017-01-24T10:42:56+01:00")
+	rtest.OK(t, err)
+	restic.TestCreateSnapshot(t, repo, timestamp, 2)
+
+	sn := loadFirstSnapshot(t, repo)
+	tree := loadTree(t, repo, *sn.Tree)
+	var content restic.IDs
+	for _, node := range tree.Nodes {
+		content = append(content, node.Content...)
+	}
+	rtest.Assert(t, len(content) > 0, "test snapshot contains no data blobs")
+
+	// nothing is prefetched after the mount ended
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cache := bloblru.New(blobCacheSize)
+	ra := newReadAhead(ctx, repo, cache, blobCacheSize, 2)
+	ra.prefetch(content)
+	for _, id := range content {
+		pb := repo.LookupBlob(restic.DataBlob, id)[0]
+		ra.loadPack(pb.PackID, []restic.Blob{pb.Blob})
+	}
+	for _, id := range content {
+		_, ok := cache.Get(id)
+		rtest.Assert(t, !ok, "blob %v was prefetched after the context was cancelled", id.Str())
+	}
+}
+
 func TestFuseDir(t *testing.T) {
 	repo := repository.TestRepository(t)
 
@@ -190,7 +288,7 @@ func testTopUIDGID(t *testing.T, cfg Config, repo restic.Repository, uid, gid ui
 	t.Helper()
 
 	ctx := context.Background()
-	root := NewRoot(repo, cfg)
+	root := NewRoot(context.TODO(), repo, cfg)
 
 	var attr fuse.Attr
 	err := root.Attr(ctx, &attr)
@@ -217,17 +315,26 @@ func testTopUIDGID(t *testing.T, cfg Config, repo restic.Repository, uid, gid ui
 	rtest.Equals(t, uint32(0), attr.Gid)
 }
 
+// lookup calls the Lookup method of node, which is either a
+// fs.NodeStringLookuper or a fs.NodeRequestLookuper.
+func lookup(node fs.Node, name string) (fs.Node, error) {
+	if n, ok := node.(fs.NodeStringLookuper); ok {
+		return n.Lookup(context.TODO(), name)
+	}
+	return node.(fs.NodeRequestLookuper).Lookup(context.TODO(), &fuse.LookupRequest{Name: name}, &fuse.LookupResponse{})
+}
+
 // The Lookup method must return the same Node object unless it was forgotten in the meantime
 func testStableLookup(t *testing.T, node fs.Node, path string) fs.Node {
 	t.Helper()
-	result, err := node.(fs.NodeStringLookuper).Lookup(context.TODO(), path)
+	result, err := lookup(node, path)
 	rtest.OK(t, err)
-	result2, err := node.(fs.NodeStringLookuper).Lookup(context.TODO(), path)
+	result2, err := lookup(node, path)
 	rtest.OK(t, err)
 	rtest.Assert(t, result == result2, "%v are not the same object", path)
 
 	result2.(fs.NodeForgetter).Forget()
-	result2, err = node.(fs.NodeStringLookuper).Lookup(context.TODO(), path)
+	result2, err = lookup(node, path)
 	rtest.OK(t, err)
 	rtest.Assert(t, result != result2, "object for %v should change after forget", path)
 	return result
@@ -236,7 +343,7 @@ func testStableLookup(t *testing.T, node fs.Node, path string) fs.Node {
 func TestStableNodeObjects(t *testing.T) {
 	repo := repository.TestRepository(t)
 	restic.TestCreateSnapshot(t, repo, time.Unix(1460289341, 207401672), 2)
-	root := NewRoot(repo, Config{})
+	root := NewRoot(context.TODO(), repo, Config{})
 
 	idsdir := testStableLookup(t, root, "ids")
 	snapID := loadFirstSnapshot(t, repo).ID().Str()
@@ -245,6 +352,86 @@ func TestStableNodeObjects(t *testing.T) {
 	testStableLookup(t, dir, "file-2")
 }
 
+func TestDirCache(t *testing.T) {
+	repo := repository.TestRepository(t)
+	restic.TestCreateSnapshot(t, repo, time.Unix(1460289341, 207401672), 2)
+	root := NewRoot(context.TODO(), repo, Config{AttrTimeout: time.Hour, EntryTimeout: 2 * time.Hour, DirCacheSize: 10})
+
+	idsdir, err := lookup(root, "ids")
+	rtest.OK(t, err)
+	snapshotdir, err := lookup(idsdir, loadFirstSnapshot(t, repo).ID().Str())
+	rtest.OK(t, err)
+
+	resp := &fuse.LookupResponse{}
+	node, err := snapshotdir.(fs.NodeRequestLookuper).Lookup(context.TODO(), &fuse.LookupRequest{Name: "dir-0"}, resp)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2*time.Hour, resp.EntryValid)
+
+	var attr fuse.Attr
+	rtest.OK(t, node.Attr(context.TODO(), &attr))
+	rtest.Equals(t, time.Hour, attr.Valid)
+
+	// the entries of a forgotten directory are taken from the cache
+	d := node.(*dir)
+	rtest.OK(t, d.open(context.TODO()))
+	d.Forget()
+	node2, err := lookup(snapshotdir, "dir-0")
+	rtest.OK(t, err)
+	d2 := node2.(*dir)
+	rtest.Assert(t, d != d2, "directory was not forgotten")
+	rtest.OK(t, d2.open(context.TODO()))
+	rtest.Assert(t, reflect.ValueOf(d.items).Pointer() == reflect.ValueOf(d2.items).Pointer(), "entries were loaded again")
+}
+
+func TestSubtree(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn := restic.TestCreateSnapshot(t, repo, time.Unix(1460289341, 207401672), 2)
+
+	// find a directory in the snapshot
+	var subtree *restic.Node
+	for _, node := range loadTree(t, repo, *sn.Tree).Nodes {
+		if node.Type == restic.NodeTypeDir {
+			subtree = node
+			break
+		}
+	}
+	rtest.Assert(t, subtree != nil, "snapshot contains no directory")
+	expected := loadTree(t, repo, *subtree.Subtree)
+
+	for _, test := range []struct {
+		subtree string
+		names   []string
+	}{
+		{"/" + subtree.Name, nil},
+		{"/missing", []string{}},
+	} {
+		if test.names == nil {
+			for _, node := range expected.Nodes {
+				test.names = append(test.names, node.Name)
+			}
+		}
+
+		ctx := context.TODO()
+		root := NewRoot(context.TODO(), repo, Config{Subtree: test.subtree})
+		idsdir, err := root.Lookup(ctx, "ids")
+		rtest.OK(t, err)
+		snapshotdir, err := idsdir.(fs.NodeStringLookuper).Lookup(ctx, sn.ID().Str())
+		rtest.OK(t, err)
+
+		entries, err := snapshotdir.(fs.HandleReadDirAller).ReadDirAll(ctx)
+		rtest.OK(t, err)
+		names := []string{}
+		for _, entry := range entries {
+			if entry.Name != "." && entry.Name != ".." {
+				names = append(names, entry.Name)
+			}
+		}
+		// the entries are returned in random order
+		sort.Strings(names)
+		rtest.Equals(t, test.names, names)
+	}
+}
+
 // Test reporting of fuse.Attr.Blocks in multiples of 512.
 func TestBlocks(t *testing.T) {
 	root := &Root{}
@@ -324,6 +511,44 @@ func TestLink(t *testing.T) {
 	rtest.Assert(t, err != nil, "missing error on reading invalid xattr")
 }
 
+func TestXattrSecurityDescriptor(t *testing.T) {
+	node := &restic.Node{Name: "foo.txt", Type: restic.NodeTypeSymlink, Links: 1, LinkTarget: "dst",
+		ExtendedAttributes: []restic.ExtendedAttribute{
+			{Name: "system.posix_acl_access", Value: []byte{2, 0, 0, 0}},
+		},
+		GenericAttributes: map[restic.GenericAttributeType]json.RawMessage{
+			restic.TypeSecurityDescriptor: json.RawMessage(`"AQAEgA=="`),
+		},
+	}
+
+	lnk, err := newLink(&Root{}, func() {}, 42, node)
+	rtest.OK(t, err)
+
+	exp := &fuse.ListxattrResponse{}
+	exp.Append("system.posix_acl_access", "system.ntfs_acl")
+	resp := &fuse.ListxattrResponse{}
+	rtest.OK(t, lnk.Listxattr(context.TODO(), &fuse.ListxattrRequest{}, resp))
+	rtest.Equals(t, exp.Xattr, resp.Xattr)
+
+	getResp := &fuse.GetxattrResponse{}
+	rtest.OK(t, lnk.Getxattr(context.TODO(), &fuse.GetxattrRequest{Name: "system.posix_acl_access"}, getResp))
+	rtest.Equals(t, []byte{2, 0, 0, 0}, getResp.Xattr)
+
+	getResp = &fuse.GetxattrResponse{}
+	rtest.OK(t, lnk.Getxattr(context.TODO(), &fuse.GetxattrRequest{Name: "system.ntfs_acl"}, getResp))
+	rtest.Equals(t, []byte{1, 0, 4, 128}, getResp.Xattr)
+
+	// nodes without a security descriptor don't have the attribute
+	node.GenericAttributes = nil
+	resp = &fuse.ListxattrResponse{}
+	rtest.OK(t, lnk.Listxattr(context.TODO(), &fuse.ListxattrRequest{}, resp))
+	exp = &fuse.ListxattrResponse{}
+	exp.Append("system.posix_acl_access")
+	rtest.Equals(t, exp.Xattr, resp.Xattr)
+	err = lnk.Getxattr(context.TODO(), &fuse.GetxattrRequest{Name: "system.ntfs_acl"}, &fuse.GetxattrResponse{})
+	rtest.Assert(t, err != nil, "missing error on reading missing security descriptor")
+}
+
 var sink uint64
 
 func BenchmarkInode(b *testing.B) {
@@ -47,6 +47,7 @@ func (l *link) Attr(_ context.Context, a *fuse.Attr) error {
 	a.Nlink = uint32(l.node.Links)
 	a.Size = uint64(len(l.node.LinkTarget))
 	a.Blocks = (a.Size + blockSize - 1) / blockSize
+	l.root.setAttrValid(a)
 
 	return nil
 }
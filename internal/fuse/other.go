@@ -43,6 +43,7 @@ func (l *other) Attr(_ context.Context, a *fuse.Attr) error {
 	a.Mtime = l.node.ModTime
 
 	a.Nlink = uint32(l.node.Links)
+	l.root.setAttrValid(a)
 
 	return nil
 }
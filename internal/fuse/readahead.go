@@ -0,0 +1,102 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package fuse
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// readAhead prefetches data blobs into the blob cache in the background. The
+// blobs are grouped by pack file, such that each pack is fetched using a
+// single request. At most workers pack files are loaded concurrently. The
+// prefetching stops once ctx is cancelled, that is when the mount ends.
+type readAhead struct {
+	ctx   context.Context
+	repo  restic.Repository
+	cache *bloblru.Cache
+	size  uint64
+	sem   chan struct{}
+}
+
+func newReadAhead(ctx context.Context, repo restic.Repository, cache *bloblru.Cache, size uint64, workers int) *readAhead {
+	if size == 0 {
+		return nil
+	}
+	// prefetched blobs must not evict each other from the cache before they are read
+	if size > blobCacheSize/4 {
+		size = blobCacheSize / 4
+	}
+	if workers <= 0 {
+		workers = int(repo.Connections())
+	}
+
+	return &readAhead{
+		ctx:   ctx,
+		repo:  repo,
+		cache: cache,
+		size:  size,
+		sem:   make(chan struct{}, workers),
+	}
+}
+
+// prefetch loads the blobs in the background, blobs which are already cached
+// are skipped.
+func (ra *readAhead) prefetch(ids restic.IDs) {
+	if ra.ctx.Err() != nil {
+		return
+	}
+
+	packs := make(map[restic.ID][]restic.Blob)
+	seen := restic.NewIDSet()
+	for _, id := range ids {
+		if seen.Has(id) {
+			continue
+		}
+		seen.Insert(id)
+
+		if _, ok := ra.cache.Get(id); ok {
+			continue
+		}
+		pbs := ra.repo.LookupBlob(restic.DataBlob, id)
+		if len(pbs) == 0 {
+			// the error is reported once the blob is actually read
+			continue
+		}
+		packs[pbs[0].PackID] = append(packs[pbs[0].PackID], pbs[0].Blob)
+	}
+
+	for packID, blobs := range packs {
+		go ra.loadPack(packID, blobs)
+	}
+}
+
+func (ra *readAhead) loadPack(packID restic.ID, blobs []restic.Blob) {
+	select {
+	case ra.sem <- struct{}{}:
+	case <-ra.ctx.Done():
+		return
+	}
+	defer func() {
+		<-ra.sem
+	}()
+
+	debug.Log("prefetching %d blobs from pack %v", len(blobs), packID.Str())
+	err := ra.repo.LoadBlobsFromPack(ra.ctx, packID, blobs, func(blob restic.BlobHandle, buf []byte, err error) error {
+		if err != nil {
+			// ignore the error, the blob is loaded again once it is read
+			debug.Log("prefetching blob %v failed: %v", blob, err)
+			return nil
+		}
+		ra.cache.Add(blob.ID, bytes.Clone(buf))
+		return nil
+	})
+	if err != nil {
+		debug.Log("prefetching pack %v failed: %v", packID.Str(), err)
+	}
+}
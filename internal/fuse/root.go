@@ -4,12 +4,15 @@
 package fuse
 
 import (
+	"context"
 	"os"
+	"time"
 
 	"github.com/restic/restic/internal/bloblru"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/restic"
 
+	"github.com/anacrolix/fuse"
 	"github.com/anacrolix/fuse/fs"
 )
 
@@ -19,6 +22,23 @@ type Config struct {
 	Filter        restic.SnapshotFilter
 	TimeTemplate  string
 	PathTemplates []string
+	// ReadAhead is the number of bytes to prefetch when a file is read
+	// sequentially, zero disables the read-ahead.
+	ReadAhead uint64
+	// ReadAheadWorkers is the number of pack files which are prefetched
+	// concurrently. It defaults to the number of backend connections.
+	ReadAheadWorkers int
+	// Subtree restricts the snapshot directories to the directory with this
+	// path within each snapshot. Only the trees along the path are loaded.
+	Subtree string
+	// AttrTimeout and EntryTimeout are the durations for which the kernel
+	// caches the attributes and the directory entries of the snapshot
+	// contents. Zero disables the caching.
+	AttrTimeout  time.Duration
+	EntryTimeout time.Duration
+	// DirCacheSize is the number of directories whose entries are kept in
+	// memory after the kernel forgot them, zero disables the cache.
+	DirCacheSize int
 }
 
 // Root is the root node of the fuse mount of a repository.
@@ -26,6 +46,8 @@ type Root struct {
 	repo      restic.Repository
 	cfg       Config
 	blobCache *bloblru.Cache
+	dirCache  *dirCache
+	readAhead *readAhead
 
 	*SnapshotsDir
 
@@ -41,15 +63,18 @@ const rootInode = 1
 // Size of the blob cache. TODO: make this configurable.
 const blobCacheSize = 64 << 20
 
-// NewRoot initializes a new root node from a repository.
-func NewRoot(repo restic.Repository, cfg Config) *Root {
+// NewRoot initializes a new root node from a repository. Background work like
+// the read-ahead stops once ctx is cancelled.
+func NewRoot(ctx context.Context, repo restic.Repository, cfg Config) *Root {
 	debug.Log("NewRoot(), config %v", cfg)
 
 	root := &Root{
 		repo:      repo,
 		cfg:       cfg,
 		blobCache: bloblru.New(blobCacheSize),
+		dirCache:  newDirCache(cfg.DirCacheSize),
 	}
+	root.readAhead = newReadAhead(ctx, repo, root.blobCache, cfg.ReadAhead, cfg.ReadAheadWorkers)
 
 	if !cfg.OwnerIsRoot {
 		root.uid = uint32(os.Getuid())
@@ -71,6 +96,12 @@ func NewRoot(repo restic.Repository, cfg Config) *Root {
 	return root
 }
 
+// setAttrValid sets the duration for which the kernel caches the attributes
+// of the snapshot contents.
+func (r *Root) setAttrValid(a *fuse.Attr) {
+	a.Valid = r.cfg.AttrTimeout
+}
+
 // Root is just there to satisfy fs.Root, it returns itself.
 func (r *Root) Root() (fs.Node, error) {
 	debug.Log("Root()")
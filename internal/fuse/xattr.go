@@ -4,21 +4,49 @@
 package fuse
 
 import (
+	"encoding/json"
+
 	"github.com/anacrolix/fuse"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/restic"
 )
 
+// xattrNTFSACL exposes the security descriptor of files backed up on Windows.
+// The value is a self-relative security descriptor, which is the format used
+// by ntfs-3g for the same attribute.
+const xattrNTFSACL = "system.ntfs_acl"
+
+// securityDescriptor returns the Windows security descriptor stored for the
+// node, or nil if there is none.
+func securityDescriptor(node *restic.Node) []byte {
+	raw, ok := node.GenericAttributes[restic.TypeSecurityDescriptor]
+	if !ok {
+		return nil
+	}
+	var sd []byte
+	if err := json.Unmarshal(raw, &sd); err != nil {
+		debug.Log("invalid security descriptor for %v: %v", node.Name, err)
+		return nil
+	}
+	return sd
+}
+
 func nodeToXattrList(node *restic.Node, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) {
 	debug.Log("Listxattr(%v, %v)", node.Name, req.Size)
 	for _, attr := range node.ExtendedAttributes {
 		resp.Append(attr.Name)
 	}
+	if node.GetExtendedAttribute(xattrNTFSACL) == nil && securityDescriptor(node) != nil {
+		resp.Append(xattrNTFSACL)
+	}
 }
 
 func nodeGetXattr(node *restic.Node, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
 	debug.Log("Getxattr(%v, %v, %v)", node.Name, req.Name, req.Size)
 	attrval := node.GetExtendedAttribute(req.Name)
+	if attrval == nil && req.Name == xattrNTFSACL {
+		attrval = securityDescriptor(node)
+	}
 	if attrval != nil {
 		resp.Xattr = attrval
 		return nil
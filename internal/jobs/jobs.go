@@ -0,0 +1,274 @@
+// Package jobs coordinates backups which run at the same time on one computer
+// for the same repository, for example backups of different profiles started
+// by a scheduler. Each job registers in a directory in the local cache and
+// periodically publishes its progress there. The jobs divide the available
+// resources according to their shares, and each job can show the progress of
+// the other jobs.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+const (
+	// staleTimeout is the time after which a job which did not update its
+	// state is considered as terminated.
+	staleTimeout = 30 * time.Second
+	// lockTimeout is the time after which the scheduler lock is considered
+	// as abandoned by a terminated process.
+	lockTimeout = 10 * time.Second
+
+	lockFilename = "scheduler.lock"
+	jobSuffix    = ".json"
+)
+
+// Progress is the progress of a job.
+type Progress struct {
+	Files      uint64 `json:"files"`
+	Bytes      uint64 `json:"bytes"`
+	TotalFiles uint64 `json:"total_files,omitempty"`
+	TotalBytes uint64 `json:"total_bytes,omitempty"`
+}
+
+// Job describes a running job.
+type Job struct {
+	Name     string    `json:"name"`
+	PID      int       `json:"pid"`
+	Share    uint      `json:"share"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated"`
+	Progress Progress  `json:"progress"`
+}
+
+// Scheduler is the registration of a job in the scheduler directory.
+type Scheduler struct {
+	dir  string
+	file string
+	now  func() time.Time
+
+	mu     sync.Mutex
+	self   Job
+	others []Job
+	share  float64
+}
+
+// Join registers the job name with the given share in the scheduler
+// directory dir. The share is the weight of the job, a job with share 2 gets
+// twice the resources of a job with share 1.
+func Join(dir, name string, share uint) (*Scheduler, error) {
+	return join(dir, name, share, time.Now)
+}
+
+func join(dir, name string, share uint, now func() time.Time) (*Scheduler, error) {
+	if share == 0 {
+		return nil, errors.New("the share of a job must be at least 1")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Scheduler{
+		dir:  dir,
+		file: filepath.Join(dir, fmt.Sprintf("%d-%s%s", os.Getpid(), randomSuffix(), jobSuffix)),
+		now:  now,
+		self: Job{
+			Name:    name,
+			PID:     os.Getpid(),
+			Share:   share,
+			Started: now(),
+		},
+		share: 1,
+	}
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// randomSuffix distinguishes jobs of the same process.
+func randomSuffix() string {
+	id := restic.NewRandomID()
+	return id.Str()
+}
+
+// SetProgress sets the progress which is published with the next refresh.
+func (s *Scheduler) SetProgress(p Progress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.self.Progress = p
+}
+
+// Share returns the fraction of the resources available to this job.
+func (s *Scheduler) Share() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.share
+}
+
+// Others returns the other running jobs, sorted by their start time.
+func (s *Scheduler) Others() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Job(nil), s.others...)
+}
+
+// Refresh publishes the state of this job and reads the state of the other
+// jobs.
+func (s *Scheduler) Refresh() error {
+	unlock, err := lock(s.dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.mu.Lock()
+	s.self.Updated = s.now()
+	buf, err := json.Marshal(s.self)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := writeFile(s.file, buf); err != nil {
+		return err
+	}
+
+	others, err := s.readOthers()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := s.self.Share
+	for _, job := range others {
+		total += job.Share
+	}
+	s.others = others
+	s.share = float64(s.self.Share) / float64(total)
+	return nil
+}
+
+// readOthers reads the state of the other jobs and removes the files of
+// terminated jobs.
+func (s *Scheduler) readOthers() ([]Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var others []Job
+	for _, entry := range entries {
+		name := filepath.Join(s.dir, entry.Name())
+		if name == s.file || !strings.HasSuffix(name, jobSuffix) {
+			continue
+		}
+		buf, err := os.ReadFile(name)
+		if err != nil {
+			debug.Log("unable to read job %v: %v", name, err)
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(buf, &job); err != nil {
+			debug.Log("unable to parse job %v: %v", name, err)
+			continue
+		}
+		if s.now().Sub(job.Updated) > staleTimeout {
+			debug.Log("removing stale job %v (%v)", job.Name, name)
+			_ = os.Remove(name)
+			continue
+		}
+		if job.Share == 0 {
+			job.Share = 1
+		}
+		others = append(others, job)
+	}
+
+	sort.Slice(others, func(i, j int) bool {
+		if !others[i].Started.Equal(others[j].Started) {
+			return others[i].Started.Before(others[j].Started)
+		}
+		return others[i].Name < others[j].Name
+	})
+	return others, nil
+}
+
+// Run refreshes the state of the jobs every interval until ctx is cancelled.
+// onChange is called with the share of this job after each refresh.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration, onChange func(share float64)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil {
+				debug.Log("refreshing job state failed: %v", err)
+				continue
+			}
+			if onChange != nil {
+				onChange(s.Share())
+			}
+		}
+	}
+}
+
+// Leave removes the registration of the job.
+func (s *Scheduler) Leave() error {
+	unlock, err := lock(s.dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return os.Remove(s.file)
+}
+
+// lock acquires the scheduler lock of dir, which serializes the changes of
+// the job states. It returns a function which releases the lock.
+func lock(dir string) (func(), error) {
+	filename := filepath.Join(dir, lockFilename)
+	start := time.Now()
+	for {
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = f.Close()
+			return func() {
+				_ = os.Remove(filename)
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if fi, err := os.Stat(filename); err == nil && time.Since(fi.ModTime()) > lockTimeout {
+			debug.Log("removing abandoned scheduler lock %v", filename)
+			_ = os.Remove(filename)
+			continue
+		}
+		if time.Since(start) > lockTimeout {
+			return nil, errors.Errorf("timeout waiting for the scheduler lock %v", filename)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeFile atomically replaces the file filename with buf.
+func writeFile(filename string, buf []byte) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
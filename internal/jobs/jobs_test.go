@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSchedulerShares(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "jobs")
+
+	a, err := Join(dir, "a", 1)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1.0, a.Share())
+	rtest.Equals(t, 0, len(a.Others()))
+
+	b, err := Join(dir, "b", 3)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0.75, b.Share())
+
+	b.SetProgress(Progress{Files: 10, Bytes: 1000, TotalBytes: 4000})
+	rtest.OK(t, b.Refresh())
+	rtest.OK(t, a.Refresh())
+	rtest.Equals(t, 0.25, a.Share())
+	others := a.Others()
+	rtest.Equals(t, 1, len(others))
+	rtest.Equals(t, "b", others[0].Name)
+	rtest.Equals(t, uint(3), others[0].Share)
+	rtest.Equals(t, Progress{Files: 10, Bytes: 1000, TotalBytes: 4000}, others[0].Progress)
+
+	rtest.OK(t, b.Leave())
+	rtest.OK(t, a.Refresh())
+	rtest.Equals(t, 1.0, a.Share())
+	rtest.Equals(t, 0, len(a.Others()))
+
+	rtest.OK(t, a.Leave())
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(entries))
+}
+
+func TestSchedulerStaleJobs(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Join(dir, "crashed", 1)
+	rtest.OK(t, err)
+
+	now := time.Now()
+	a, err := join(dir, "a", 1, func() time.Time { return now })
+	rtest.OK(t, err)
+	rtest.Equals(t, 0.5, a.Share())
+
+	// the other job did not update its state for too long
+	now = now.Add(staleTimeout + time.Second)
+	rtest.OK(t, a.Refresh())
+	rtest.Equals(t, 1.0, a.Share())
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+}
+
+func TestSchedulerAbandonedLock(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, lockFilename)
+	rtest.OK(t, os.WriteFile(filename, nil, 0600))
+	old := time.Now().Add(-2 * lockTimeout)
+	rtest.OK(t, os.Chtimes(filename, old, old))
+
+	a, err := Join(dir, "a", 1)
+	rtest.OK(t, err)
+	rtest.OK(t, a.Leave())
+	_, err = os.Stat(filename)
+	rtest.Assert(t, os.IsNotExist(err), "scheduler lock was not released: %v", err)
+}
+
+func TestJoinInvalidShare(t *testing.T) {
+	_, err := Join(t.TempDir(), "a", 0)
+	rtest.Assert(t, err != nil, "expected error for share 0")
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// journaldSocket is the socket of the native journal protocol.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// Journald sends messages to the systemd journal using its native protocol,
+// which preserves the severity and allows filtering by command, e.g. using
+// `journalctl RESTIC_COMMAND=backup`.
+type Journald struct {
+	identifier string
+	command    string
+
+	m    sync.Mutex
+	conn net.Conn
+}
+
+// NewJournald connects to the journal at socket.
+func NewJournald(socket, identifier, command string) (*Journald, error) {
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the journal: %w", err)
+	}
+
+	return &Journald{
+		identifier: identifier,
+		command:    command,
+		conn:       conn,
+	}, nil
+}
+
+// journaldField appends a field to buf. Values containing a line break are
+// serialized in the binary format which is prefixed by the length.
+func journaldField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if strings.Contains(value, "\n") {
+		buf.WriteByte('\n')
+		_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	} else {
+		buf.WriteByte('=')
+	}
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+func (j *Journald) format(severity Severity, msg string) []byte {
+	var buf bytes.Buffer
+	journaldField(&buf, "MESSAGE", msg)
+	journaldField(&buf, "PRIORITY", strconv.Itoa(int(severity)))
+	journaldField(&buf, "SYSLOG_IDENTIFIER", j.identifier)
+	if j.command != "" {
+		journaldField(&buf, "RESTIC_COMMAND", j.command)
+	}
+	return buf.Bytes()
+}
+
+// Log sends the message to the journal.
+func (j *Journald) Log(severity Severity, msg string) error {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	_, err := j.conn.Write(j.format(severity, msg))
+	return err
+}
+
+// Close closes the connection to the journal.
+func (j *Journald) Close() error {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.conn.Close()
+}
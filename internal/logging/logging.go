@@ -0,0 +1,106 @@
+// Package logging sends the messages of restic to the logging system of the
+// host, either a syslog daemon or the systemd journal.
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Severity is the severity of a message as defined in RFC 5424. Lower values
+// are more severe.
+type Severity int
+
+// Severities of messages, restic uses Error, Warning, Notice and Info.
+const (
+	Emergency Severity = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Info
+	Debug
+)
+
+// Sink receives log messages. It is safe for concurrent use.
+type Sink interface {
+	// Log writes a single message.
+	Log(severity Severity, msg string) error
+	Close() error
+}
+
+// Open returns the sink for target, which is one of
+//
+//	journald
+//	syslog
+//	syslog+unix:///path/to/socket
+//	syslog+udp://host:port
+//	syslog+tcp://host:port
+//
+// "syslog" uses the local syslog daemon. The identifier is used as the name of
+// the program, command is the restic command which is running.
+func Open(target, identifier, command string) (Sink, error) {
+	switch {
+	case target == "journald":
+		return NewJournald(journaldSocket, identifier, command)
+	case target == "syslog":
+		return NewSyslog("", "", identifier, command)
+	case strings.HasPrefix(target, "syslog+"):
+		network, address, ok := strings.Cut(strings.TrimPrefix(target, "syslog+"), "://")
+		if !ok || address == "" {
+			return nil, fmt.Errorf("invalid log target %q, expected syslog+network://address", target)
+		}
+		switch network {
+		case "unix":
+			network = "unixgram"
+		case "udp", "tcp":
+		default:
+			return nil, fmt.Errorf("invalid log target %q, network must be one of unix, udp or tcp", target)
+		}
+		return NewSyslog(network, address, identifier, command)
+	}
+	return nil, fmt.Errorf("invalid log target %q, must be journald, syslog or syslog+network://address", target)
+}
+
+// Writer passes the data written to it on to an underlying writer and
+// additionally calls a function for each line.
+type Writer struct {
+	wr  io.Writer
+	log func(line string)
+
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+// NewWriter returns a Writer which writes to wr and calls log for each line
+// written. Empty lines are not passed to log.
+func NewWriter(wr io.Writer, log func(line string)) *Writer {
+	return &Writer{wr: wr, log: log}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.m.Lock()
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.buf.Next(i+1)), "\r\n")
+		if line != "" {
+			w.log(line)
+		}
+	}
+	w.m.Unlock()
+
+	return w.wr.Write(p)
+}
+
+// Unwrap returns the underlying writer.
+func (w *Writer) Unwrap() io.Writer {
+	return w.wr
+}
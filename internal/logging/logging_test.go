@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	rtest.OK(t, err)
+	defer func() { _ = conn.Close() }()
+
+	sink, err := Open("syslog+udp://"+conn.LocalAddr().String(), "restic", "backup")
+	rtest.OK(t, err)
+	s := sink.(*Syslog)
+	s.hostname = "host"
+	s.now = func() time.Time { return time.Date(2024, 3, 1, 2, 30, 0, 0, time.UTC) }
+
+	rtest.OK(t, sink.Log(Warning, "unable to read file"))
+	rtest.OK(t, sink.Close())
+
+	buf := make([]byte, 1024)
+	rtest.OK(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	rtest.OK(t, err)
+	// facility user (1) and severity warning (4)
+	rtest.Equals(t, fmt.Sprintf("<12>1 2024-03-01T02:30:00Z host restic %d backup - unable to read file", os.Getpid()), string(buf[:n]))
+}
+
+func TestSyslogTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	rtest.OK(t, err)
+	defer func() { _ = l.Close() }()
+
+	sink, err := Open("syslog+tcp://"+l.Addr().String(), "restic", "check")
+	rtest.OK(t, err)
+	rtest.OK(t, sink.Log(Error, "first"))
+	rtest.OK(t, sink.Log(Info, "second"))
+	rtest.OK(t, sink.Close())
+
+	conn, err := l.Accept()
+	rtest.OK(t, err)
+	defer func() { _ = conn.Close() }()
+	rd := bufio.NewReader(conn)
+
+	// messages are framed by their length
+	for _, expected := range []string{"<11>1 ", "<14>1 "} {
+		var length int
+		_, err := fmt.Fscanf(rd, "%d ", &length)
+		rtest.OK(t, err)
+		msg := make([]byte, length)
+		_, err = io.ReadFull(rd, msg)
+		rtest.OK(t, err)
+		rtest.Assert(t, strings.HasPrefix(string(msg), expected), "unexpected message %q", msg)
+	}
+}
+
+func TestSyslogHeaderField(t *testing.T) {
+	rtest.Equals(t, "-", syslogHeaderField("", 10))
+	rtest.Equals(t, "key_add", syslogHeaderField("key add", 10))
+	rtest.Equals(t, "abc", syslogHeaderField("abcdef", 3))
+}
+
+func TestJournaldFormat(t *testing.T) {
+	j := &Journald{identifier: "restic", command: "backup"}
+	data := j.format(Error, "line 1\nline 2")
+
+	var expected bytes.Buffer
+	expected.WriteString("MESSAGE\n")
+	_ = binary.Write(&expected, binary.LittleEndian, uint64(13))
+	expected.WriteString("line 1\nline 2\n")
+	expected.WriteString("PRIORITY=3\nSYSLOG_IDENTIFIER=restic\nRESTIC_COMMAND=backup\n")
+	rtest.Equals(t, expected.Bytes(), data)
+}
+
+func TestOpenInvalid(t *testing.T) {
+	for _, target := range []string{"", "file", "syslog+udp", "syslog+udp://", "syslog+foo://host:514"} {
+		_, err := Open(target, "restic", "backup")
+		rtest.Assert(t, err != nil, "expected error for %q", target)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	var lines []string
+	w := NewWriter(&out, func(line string) {
+		lines = append(lines, line)
+	})
+
+	for _, s := range []string{"foo\nbar", "\n\n", "baz\r\n", "incomplete"} {
+		_, err := w.Write([]byte(s))
+		rtest.OK(t, err)
+	}
+
+	rtest.Equals(t, "foo\nbar\n\nbaz\r\nincomplete", out.String())
+	rtest.Equals(t, []string{"foo", "bar", "baz"}, lines)
+	rtest.Equals(t, &out, w.Unwrap())
+}
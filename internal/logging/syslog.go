@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// facilityUser is the syslog facility used for all messages.
+const facilityUser = 1
+
+// localSyslogSockets are the sockets of the local syslog daemon on the
+// different platforms.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Syslog sends messages to a syslog daemon, formatted according to RFC 5424.
+// Messages sent via TCP are framed using octet counting (RFC 6587).
+type Syslog struct {
+	network, address string
+	hostname         string
+	appName          string
+	msgID            string
+
+	m    sync.Mutex
+	conn net.Conn
+	now  func() time.Time
+}
+
+// NewSyslog connects to the syslog daemon at address. If network is empty,
+// the local syslog daemon is used.
+func NewSyslog(network, address, identifier, command string) (*Syslog, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	s := &Syslog{
+		network:  network,
+		address:  address,
+		hostname: syslogHeaderField(hostname, 255),
+		appName:  syslogHeaderField(identifier, 48),
+		msgID:    syslogHeaderField(command, 32),
+		now:      time.Now,
+	}
+
+	err = s.connect()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Syslog) connect() error {
+	if s.network != "" {
+		conn, err := net.Dial(s.network, s.address)
+		if err != nil {
+			return fmt.Errorf("unable to connect to syslog: %w", err)
+		}
+		s.conn = conn
+		return nil
+	}
+
+	var err error
+	for _, socket := range localSyslogSockets {
+		var conn net.Conn
+		conn, err = net.Dial("unixgram", socket)
+		if err == nil {
+			s.network, s.address, s.conn = "unixgram", socket, conn
+			return nil
+		}
+	}
+	return fmt.Errorf("unable to connect to the local syslog daemon: %w", err)
+}
+
+// syslogHeaderField returns s as a valid field of the header of a message,
+// which must only contain printable ASCII characters.
+func syslogHeaderField(s string, maxLen int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// format returns the message formatted according to RFC 5424, without
+// structured data.
+func (s *Syslog) format(severity Severity, msg string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		facilityUser*8+int(severity), s.now().Format(time.RFC3339Nano),
+		s.hostname, s.appName, os.Getpid(), s.msgID, msg)
+}
+
+// Log sends the message to the syslog daemon. If sending the message fails,
+// the connection is reestablished once.
+func (s *Syslog) Log(severity Severity, msg string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	line := s.format(severity, msg)
+	if s.network == "tcp" {
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.conn == nil {
+			err = s.connect()
+			if err != nil {
+				continue
+			}
+		}
+		_, err = s.conn.Write([]byte(line))
+		if err == nil {
+			return nil
+		}
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *Syslog) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,178 @@
+// Package metrics writes the outcome of a restic run in the Prometheus text
+// format, such that monitoring systems can alert on failed or missing jobs
+// which are started by cron or a task scheduler. The metrics are either
+// written to a file read by the textfile collector of the node exporter or
+// pushed to a Prometheus Pushgateway.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats describes the data processed by a job.
+type Stats struct {
+	// Files is the number of files processed.
+	Files uint64
+	// Bytes is the size of the processed data.
+	Bytes uint64
+	// DataAdded is the size of the data added to the repository.
+	DataAdded uint64
+}
+
+// Job is the outcome of a restic run.
+type Job struct {
+	Command  string
+	Start    time.Time
+	End      time.Time
+	ExitCode int
+	// Errors is the number of files which could not be processed.
+	Errors uint64
+	// Stats is nil if the command does not process data.
+	Stats *Stats
+	// SnapshotID is the ID of the snapshot created by the job, if any.
+	SnapshotID string
+}
+
+// Label is a label attached to all metrics.
+type Label struct {
+	Name  string
+	Value string
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, l.Name+`="`+labelEscaper.Replace(l.Value)+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Write writes the metrics of the job in the Prometheus text format. The
+// labels are attached to all metrics.
+func (j *Job) Write(w io.Writer, labels []Label) error {
+	labels = append([]Label{{"command", j.Command}}, labels...)
+	buf := &bytes.Buffer{}
+
+	gauge := func(name, help string, value float64, extra ...Label) {
+		fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(buf, "%s%s %s\n", name, formatLabels(append(labels[:len(labels):len(labels)], extra...)),
+			strconv.FormatFloat(value, 'g', -1, 64))
+	}
+
+	success := 0.0
+	if j.ExitCode == 0 {
+		success = 1
+	}
+	gauge("restic_job_start_timestamp_seconds", "Time the job was started.", float64(j.Start.UnixNano())/1e9)
+	gauge("restic_job_end_timestamp_seconds", "Time the job finished.", float64(j.End.UnixNano())/1e9)
+	gauge("restic_job_duration_seconds", "Duration of the job.", j.End.Sub(j.Start).Seconds())
+	gauge("restic_job_success", "Whether the job completed successfully.", success)
+	gauge("restic_job_exit_code", "Exit code of the job.", float64(j.ExitCode))
+	gauge("restic_job_errors", "Number of files which could not be processed.", float64(j.Errors))
+	if j.Stats != nil {
+		gauge("restic_job_files", "Number of files processed.", float64(j.Stats.Files))
+		gauge("restic_job_bytes", "Size of the data processed in bytes.", float64(j.Stats.Bytes))
+		gauge("restic_job_data_added_bytes", "Size of the data added to the repository in bytes.", float64(j.Stats.DataAdded))
+	}
+	if j.SnapshotID != "" {
+		gauge("restic_job_snapshot_info", "ID of the snapshot created by the job.", 1, Label{"snapshot_id", j.SnapshotID})
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteFile atomically replaces filename with the metrics of the job, such
+// that the textfile collector never reads a partially written file.
+func (j *Job) WriteFile(filename string, labels []Label) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() { _ = os.Remove(tmp) }()
+
+	err = j.Write(f, labels)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// make the file readable by the node exporter
+		err = os.Chmod(tmp, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// groupingKey returns the path elements of a label in the URL of the
+// Pushgateway. Values which cannot be used as path element are encoded using
+// base64, an empty value is encoded as "=".
+func groupingKey(l Label) []string {
+	if l.Value == "" || strings.Contains(l.Value, "/") {
+		value := base64.URLEncoding.EncodeToString([]byte(l.Value))
+		if value == "" {
+			value = "="
+		}
+		return []string{l.Name + "@base64", value}
+	}
+	return []string{l.Name, l.Value}
+}
+
+// Push replaces the metrics of the group identified by job and the labels in
+// the Pushgateway at gateway with the metrics of the job. Credentials for
+// basic authentication can be included in the URL.
+func (j *Job) Push(ctx context.Context, gateway, job string, labels []Label) error {
+	u, err := url.Parse(gateway)
+	if err != nil {
+		return err
+	}
+
+	// the labels are part of the grouping key instead of the metrics
+	u = u.JoinPath("metrics")
+	for _, l := range append([]Label{{"job", job}}, labels...) {
+		u = u.JoinPath(groupingKey(l)...)
+	}
+
+	buf := &bytes.Buffer{}
+	err = j.Write(buf, nil)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("pushgateway returned %v: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testJob = Job{
+	Command:    "backup",
+	Start:      time.Unix(1700000000, 0),
+	End:        time.Unix(1700000090, 500000000),
+	ExitCode:   3,
+	Errors:     2,
+	Stats:      &Stats{Files: 10, Bytes: 2048, DataAdded: 512},
+	SnapshotID: "0123456789abcdef",
+}
+
+func TestWrite(t *testing.T) {
+	buf := &bytes.Buffer{}
+	rtest.OK(t, testJob.Write(buf, []Label{{"job", `nightly "home"`}}))
+
+	for _, line := range []string{
+		`restic_job_start_timestamp_seconds{command="backup",job="nightly \"home\""} 1.7e+09`,
+		`restic_job_duration_seconds{command="backup",job="nightly \"home\""} 90.5`,
+		`restic_job_success{command="backup",job="nightly \"home\""} 0`,
+		`restic_job_exit_code{command="backup",job="nightly \"home\""} 3`,
+		`restic_job_errors{command="backup",job="nightly \"home\""} 2`,
+		`restic_job_bytes{command="backup",job="nightly \"home\""} 2048`,
+		`restic_job_snapshot_info{command="backup",job="nightly \"home\"",snapshot_id="0123456789abcdef"} 1`,
+		"# TYPE restic_job_files gauge",
+	} {
+		rtest.Assert(t, strings.Contains(buf.String(), line+"\n"), "missing line %q in\n%s", line, buf.String())
+	}
+
+	// commands which do not process data only report the outcome
+	buf.Reset()
+	rtest.OK(t, (&Job{Command: "forget"}).Write(buf, nil))
+	rtest.Assert(t, strings.Contains(buf.String(), `restic_job_success{command="forget"} 1`), "unexpected output\n%s", buf.String())
+	rtest.Assert(t, !strings.Contains(buf.String(), "restic_job_files"), "unexpected file count\n%s", buf.String())
+	rtest.Assert(t, !strings.Contains(buf.String(), "restic_job_snapshot_info"), "unexpected snapshot\n%s", buf.String())
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := rtest.TempDir(t)
+	filename := filepath.Join(dir, "restic.prom")
+	rtest.OK(t, os.WriteFile(filename, []byte("old"), 0600))
+
+	rtest.OK(t, testJob.WriteFile(filename, nil))
+	data, err := os.ReadFile(filename)
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.HasPrefix(string(data), "# HELP restic_job_start_timestamp_seconds"), "unexpected content\n%s", data)
+
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+}
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.EscapedPath()
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		if strings.Contains(path, "fail") {
+			http.Error(w, "invalid metrics", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	rtest.OK(t, testJob.Push(context.TODO(), srv.URL+"/prefix", "nightly", []Label{{"host", "server"}, {"path", "/home"}}))
+	rtest.Equals(t, http.MethodPut, method)
+	rtest.Equals(t, "/prefix/metrics/job/nightly/host/server/path@base64/L2hvbWU=", path)
+	rtest.Assert(t, strings.Contains(body, `restic_job_success{command="backup"} 0`), "unexpected body\n%s", body)
+
+	err := testJob.Push(context.TODO(), srv.URL, "fail", nil)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "invalid metrics"), "unexpected error %v", err)
+}
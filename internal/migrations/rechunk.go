@@ -0,0 +1,352 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+	"golang.org/x/sync/errgroup"
+)
+
+func init() {
+	register(&Rechunk{})
+}
+
+// ErrIncomplete is returned by Apply if a migration stopped before it was
+// completed. Applying the migration again continues where it stopped.
+var ErrIncomplete = errors.New("migration is incomplete, apply it again to continue")
+
+// Rechunk splits the files of all snapshots again using a new chunker
+// polynomial. Each snapshot is replaced once its files are rechunked, such that
+// an interrupted migration continues with the remaining snapshots.
+type Rechunk struct {
+	// Profile selects the new chunker parameters, it is only necessary to
+	// start the migration.
+	Profile *restic.ChunkerProfile
+	// MaxDuration stops the migration after the current snapshot once the
+	// duration has elapsed, at least one snapshot is always rechunked. Zero
+	// means no limit.
+	MaxDuration time.Duration
+	// UpdateSnapshot is called for each rechunked snapshot before it is saved,
+	// for example to sign it again. If it is nil, signatures are removed.
+	UpdateSnapshot func(sn *restic.Snapshot) error
+	// Removed is called after the original snapshot with the given ID and
+	// root tree was removed, for example to record the removal.
+	Removed func(ctx context.Context, id, tree restic.ID) error
+	// Progress is called before the snapshot with the given index is
+	// rechunked.
+	Progress func(sn *restic.Snapshot, index, total int)
+}
+
+func (*Rechunk) Name() string {
+	return "rechunk"
+}
+
+func (*Rechunk) Desc() string {
+	return "split the files of all snapshots again using a new chunker polynomial"
+}
+
+func (m *Rechunk) Check(_ context.Context, repo restic.Repository) (bool, string, error) {
+	cfg := repo.Config()
+	if m.Profile == nil || m.Profile.ChunkerPolynomial == cfg.ChunkerPolynomial {
+		if cfg.PreviousChunkerPolynomial == nil {
+			return false, "no rechunking in progress, select the new chunker parameters with --chunker-profile", nil
+		}
+		return true, "", nil
+	}
+
+	if cfg.PreviousChunkerPolynomial != nil {
+		return false, fmt.Sprintf("rechunking to chunker polynomial %v is still in progress", cfg.ChunkerPolynomial), nil
+	}
+	if m.Profile.ContentHash != cfg.ContentHashName() {
+		return false, fmt.Sprintf("changing the content hash from %v to %v is not supported", cfg.ContentHashName(), m.Profile.ContentHash), nil
+	}
+	return true, "", nil
+}
+
+func (*Rechunk) RepoCheck() bool {
+	return false
+}
+
+func (m *Rechunk) Apply(ctx context.Context, repo restic.Repository) error {
+	cfg := repo.Config()
+	if m.Profile != nil && m.Profile.ChunkerPolynomial != cfg.ChunkerPolynomial {
+		if m.Profile.ContentHash != cfg.ContentHashName() {
+			return fmt.Errorf("changing the content hash from %v to %v is not supported", cfg.ContentHashName(), m.Profile.ContentHash)
+		}
+		if err := repository.StartRechunk(ctx, repo.(*repository.Repository), m.Profile.ChunkerPolynomial); err != nil {
+			return err
+		}
+		cfg = repo.Config()
+	} else if cfg.PreviousChunkerPolynomial == nil {
+		return errors.New("no rechunking in progress")
+	}
+
+	snapshots, err := pendingRechunkSnapshots(ctx, repo, cfg.ChunkerPolynomial)
+	if err != nil {
+		return err
+	}
+	if err := repo.LoadIndex(ctx, nil); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	rc := newRechunker(repo, cfg.ChunkerPolynomial)
+	for i, sn := range snapshots {
+		if i > 0 && m.MaxDuration > 0 && time.Since(start) > m.MaxDuration {
+			return ErrIncomplete
+		}
+		if m.Progress != nil {
+			m.Progress(sn, i, len(snapshots))
+		}
+		if err := m.rechunkSnapshot(ctx, repo, rc, sn); err != nil {
+			return fmt.Errorf("rechunking snapshot %v failed: %w", sn.ID().Str(), err)
+		}
+	}
+
+	return repository.FinishRechunk(ctx, repo.(*repository.Repository))
+}
+
+// pendingRechunkSnapshots returns the snapshots which are not yet split using
+// pol, sorted by time.
+func pendingRechunkSnapshots(ctx context.Context, repo restic.Repository, pol chunker.Pol) (restic.Snapshots, error) {
+	var snapshots restic.Snapshots
+	err := restic.ForAllSnapshots(ctx, repo, repo, nil, func(_ restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		if sn.ChunkerPolynomial == nil || *sn.ChunkerPolynomial != pol {
+			snapshots = append(snapshots, sn)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(snapshots)
+	return snapshots, nil
+}
+
+// rechunkSnapshot replaces sn by a snapshot whose files are split by rc.
+func (m *Rechunk) rechunkSnapshot(ctx context.Context, repo restic.Repository, rc *rechunker, sn *restic.Snapshot) error {
+	if sn.Tree == nil {
+		return errors.New("snapshot has no tree")
+	}
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+
+	var treeID restic.ID
+	wg.Go(func() error {
+		var err error
+		treeID, err = rc.rewriteTree(wgCtx, *sn.Tree)
+		if err != nil {
+			return err
+		}
+		return repo.Flush(wgCtx)
+	})
+	if err := wg.Wait(); err != nil {
+		return err
+	}
+
+	oldID, oldTree := *sn.ID(), *sn.Tree
+	if sn.Original == nil {
+		sn.Original = &oldID
+	}
+	sn.Tree = &treeID
+	pol := rc.pol
+	sn.ChunkerPolynomial = &pol
+	if m.UpdateSnapshot != nil {
+		if err := m.UpdateSnapshot(sn); err != nil {
+			return err
+		}
+	} else {
+		sn.Signature = nil
+	}
+
+	id, err := restic.SaveSnapshot(ctx, repo, sn)
+	if err != nil {
+		return err
+	}
+	debug.Log("rechunked snapshot %v, new snapshot %v", oldID, id)
+	if err := repo.RemoveUnpacked(ctx, restic.WriteableSnapshotFile, oldID); err != nil {
+		return err
+	}
+	if m.Removed != nil {
+		return m.Removed(ctx, oldID, oldTree)
+	}
+	return nil
+}
+
+// maxCachedContentIDs is the number of blob IDs of the new content of files
+// kept by the rechunker, which uses about 32 MiB plus an overhead per file.
+const maxCachedContentIDs = 1 << 20
+
+// rechunker splits files using a chunker polynomial. Rewritten trees and the
+// new content of recently processed files are cached, such that content
+// shared by several snapshots is usually only processed once.
+type rechunker struct {
+	repo     restic.Repository
+	pol      chunker.Pol
+	rewriter *walker.TreeRewriter
+	chunker  *chunker.Chunker
+	buf      []byte
+	// contents maps the ID of the old content of a file to its new content,
+	// it holds at most maxCachedContentIDs blob IDs
+	contents      *simplelru.LRU[restic.ID, restic.IDs]
+	contentsSize  int
+	maxContentIDs int
+
+	// context and error of the current tree traversal
+	ctx    context.Context
+	cancel context.CancelFunc
+	err    error
+}
+
+func newRechunker(repo restic.Repository, pol chunker.Pol) *rechunker {
+	rc := &rechunker{
+		repo:          repo,
+		pol:           pol,
+		chunker:       chunker.New(nil, pol),
+		buf:           make([]byte, chunker.MaxSize),
+		maxContentIDs: maxCachedContentIDs,
+	}
+	// each entry contains at least one ID, thus the number of IDs also
+	// limits the number of entries
+	contents, err := simplelru.NewLRU(maxCachedContentIDs, func(_ restic.ID, content restic.IDs) {
+		rc.contentsSize -= len(content)
+	})
+	if err != nil {
+		panic(err) // only fails for a non-positive size
+	}
+	rc.contents = contents
+	rc.rewriter = walker.NewTreeRewriter(walker.RewriteOpts{
+		RewriteNode: rc.rewriteNode,
+	})
+	return rc
+}
+
+func (rc *rechunker) rewriteTree(ctx context.Context, treeID restic.ID) (restic.ID, error) {
+	// the node rewrite function cannot return errors, stop the tree
+	// traversal instead and report the error afterwards
+	rc.ctx, rc.cancel = context.WithCancel(ctx)
+	defer rc.cancel()
+
+	rc.err = nil
+	newID, err := rc.rewriter.RewriteTree(rc.ctx, rc.repo, "/", treeID)
+	if rc.err != nil {
+		return restic.ID{}, rc.err
+	}
+	return newID, err
+}
+
+func (rc *rechunker) rewriteNode(node *restic.Node, path string) *restic.Node {
+	if node.Type != restic.NodeTypeFile || rc.err != nil {
+		return node
+	}
+
+	if len(node.Content) > 0 {
+		content, err := rc.rechunk(rc.ctx, node.Content)
+		if err != nil {
+			rc.err = fmt.Errorf("%v: %w", path, err)
+			rc.cancel()
+			return node
+		}
+		node.Content = content
+	}
+	for i, stream := range node.AlternateStreams {
+		if len(stream.Content) == 0 {
+			continue
+		}
+		content, err := rc.rechunk(rc.ctx, stream.Content)
+		if err != nil {
+			rc.err = fmt.Errorf("%v:%v: %w", path, stream.Name, err)
+			rc.cancel()
+			return node
+		}
+		node.AlternateStreams[i].Content = content
+	}
+	return node
+}
+
+// rechunk returns the blobs of content split using the new polynomial.
+func (rc *rechunker) rechunk(ctx context.Context, content restic.IDs) (restic.IDs, error) {
+	buf := make([]byte, 0, len(content)*len(restic.ID{}))
+	for _, id := range content {
+		buf = append(buf, id[:]...)
+	}
+	key := restic.Hash(buf)
+	if newContent, ok := rc.contents.Get(key); ok {
+		return newContent, nil
+	}
+
+	rc.chunker.Reset(&blobReader{ctx: ctx, repo: rc.repo, blobs: content}, rc.pol)
+	var newContent restic.IDs
+	for {
+		chunk, err := rc.chunker.Next(rc.buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, _, _, err := rc.repo.SaveBlob(ctx, restic.DataBlob, chunk.Data, restic.ID{}, false)
+		if err != nil {
+			return nil, err
+		}
+		newContent = append(newContent, id)
+	}
+
+	rc.cacheContent(key, newContent)
+	return newContent, nil
+}
+
+// cacheContent adds the new content of a file to the cache, evicting the
+// least recently used entries to stay below maxContentIDs.
+func (rc *rechunker) cacheContent(key restic.ID, content restic.IDs) {
+	if len(content) == 0 || len(content) > rc.maxContentIDs {
+		return
+	}
+	for rc.contentsSize+len(content) > rc.maxContentIDs {
+		rc.contents.RemoveOldest()
+	}
+	rc.contents.Add(key, content)
+	rc.contentsSize += len(content)
+}
+
+// blobReader reads the concatenated content of the blobs.
+type blobReader struct {
+	ctx   context.Context
+	repo  restic.BlobLoader
+	blobs restic.IDs
+	buf   []byte
+	data  []byte
+}
+
+func (rd *blobReader) Read(p []byte) (int, error) {
+	for len(rd.data) == 0 {
+		if len(rd.blobs) == 0 {
+			return 0, io.EOF
+		}
+		var err error
+		rd.buf, err = rd.repo.LoadBlob(rd.ctx, restic.DataBlob, rd.blobs[0], rd.buf)
+		if err != nil {
+			return 0, err
+		}
+		rd.data = rd.buf
+		rd.blobs = rd.blobs[1:]
+	}
+
+	n := copy(p, rd.data)
+	rd.data = rd.data[n:]
+	return n, nil
+}
@@ -0,0 +1,138 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/walker"
+)
+
+// snapshotFiles returns the hash of the content of each file in the snapshots
+// and the data blobs used by the files.
+func snapshotFiles(t *testing.T, repo restic.Repository) (map[string][sha256.Size]byte, restic.IDSet) {
+	files := make(map[string][sha256.Size]byte)
+	blobs := restic.NewIDSet()
+	snapshots, err := restic.TestLoadAllSnapshots(context.TODO(), repo, nil)
+	rtest.OK(t, err)
+	for _, sn := range snapshots {
+		rtest.OK(t, walker.Walk(context.TODO(), repo, *sn.Tree, walker.WalkVisitor{
+			ProcessNode: func(_ restic.ID, path string, node *restic.Node, err error) error {
+				if err != nil || node == nil || node.Type != restic.NodeTypeFile {
+					return err
+				}
+				h := sha256.New()
+				for _, id := range node.Content {
+					blobs.Insert(id)
+					buf, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+					if err != nil {
+						return err
+					}
+					h.Write(buf)
+				}
+				files[sn.Time.String()+path] = [sha256.Size]byte(h.Sum(nil))
+				return nil
+			},
+		}))
+	}
+	return files, blobs
+}
+
+func TestRechunk(t *testing.T) {
+	repo, _, _ := repository.TestRepositoryWithVersion(t, restic.StableRepoVersion)
+	dir := rtest.TempDir(t)
+	archiver.TestCreateFiles(t, dir, archiver.TestDir{
+		"large": archiver.TestFile{Content: string(rtest.Random(1, 5*1024*1024))},
+		"small": archiver.TestFile{Content: "foo"},
+		"sub": archiver.TestDir{
+			"copy": archiver.TestFile{Content: string(rtest.Random(1, 5*1024*1024))},
+		},
+	})
+	var parent *restic.ID
+	for i := 0; i < 3; i++ {
+		rtest.OK(t, os.WriteFile(filepath.Join(dir, "changed"), rtest.Random(i, 3*1024*1024), 0600))
+		parent = archiver.TestSnapshot(t, repo, dir, parent).ID()
+	}
+	files, blobs := snapshotFiles(t, repo)
+	oldPol := repo.Config().ChunkerPolynomial
+
+	m := &Rechunk{}
+	ok, _, err := m.Check(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "migration check returned true without chunker profile")
+
+	pol, err := chunker.RandomPolynomial()
+	rtest.OK(t, err)
+	m.Profile = &restic.ChunkerProfile{ChunkerPolynomial: pol, ContentHash: restic.ContentHashSHA256}
+	ok, _, err = m.Check(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "migration check returned false")
+
+	// stop after the first snapshot
+	m.MaxDuration = time.Nanosecond
+	err = m.Apply(context.TODO(), repo)
+	rtest.Assert(t, errors.Is(err, ErrIncomplete), "unexpected error %v", err)
+	rtest.Equals(t, pol, repo.Config().ChunkerPolynomial)
+	rtest.Equals(t, oldPol, *repo.Config().PreviousChunkerPolynomial)
+	pending, err := pendingRechunkSnapshots(context.TODO(), repo, pol)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(pending))
+
+	// continue without selecting the profile again
+	m = &Rechunk{}
+	ok, _, err = m.Check(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "migration check returned false for incomplete migration")
+	rtest.OK(t, m.Apply(context.TODO(), repo))
+
+	rtest.Assert(t, repo.Config().PreviousChunkerPolynomial == nil, "previous polynomial was not removed")
+	pending, err = pendingRechunkSnapshots(context.TODO(), repo, pol)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(pending))
+	newFiles, newBlobs := snapshotFiles(t, repo)
+	rtest.Equals(t, files, newFiles)
+	// the small file still consists of the same blob
+	small := restic.Hash([]byte("foo"))
+	rtest.Assert(t, blobs.Has(small) && newBlobs.Has(small), "blob of the small file was not kept")
+	// the old data is removed by prune
+	checker.TestCheckRepo(t, repo, true)
+}
+
+func TestRechunkerContentCache(t *testing.T) {
+	repo, _, _ := repository.TestRepositoryWithVersion(t, restic.StableRepoVersion)
+	rc := newRechunker(repo, repo.Config().ChunkerPolynomial)
+	rc.maxContentIDs = 4
+
+	ids := func(n int) restic.IDs {
+		content := make(restic.IDs, n)
+		for i := range content {
+			content[i] = restic.NewRandomID()
+		}
+		return content
+	}
+	keys := restic.IDs{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	rc.cacheContent(keys[0], ids(2))
+	rc.cacheContent(keys[1], ids(2))
+	// too large for the cache
+	rc.cacheContent(restic.NewRandomID(), ids(5))
+	rtest.Equals(t, 4, rc.contentsSize)
+	rtest.Equals(t, 2, rc.contents.Len())
+
+	// the least recently used entry is evicted
+	_, ok := rc.contents.Get(keys[0])
+	rtest.Assert(t, ok, "entry is missing")
+	rc.cacheContent(keys[2], ids(1))
+	rtest.Equals(t, 3, rc.contentsSize)
+	_, ok = rc.contents.Get(keys[1])
+	rtest.Assert(t, !ok, "least recently used entry was not evicted")
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+func init() {
+	register(&SignConfig{})
+}
+
+type SignConfig struct{}
+
+func (*SignConfig) Name() string {
+	return "sign_config"
+}
+
+func (*SignConfig) Desc() string {
+	return "sign the repository config to detect modified repository parameters"
+}
+
+func (*SignConfig) Check(_ context.Context, repo restic.Repository) (bool, string, error) {
+	if repo.Config().Signature != nil && repo.(*repository.Repository).ConfigSignatureEnforced() {
+		return false, "repository config is already signed", nil
+	}
+	return true, "", nil
+}
+
+func (*SignConfig) RepoCheck() bool {
+	return false
+}
+
+func (m *SignConfig) Apply(ctx context.Context, repo restic.Repository) error {
+	return repository.SignConfig(ctx, repo.(*repository.Repository))
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSignConfig(t *testing.T) {
+	repo, unpacked, be := repository.TestRepositoryWithVersion(t, restic.StableRepoVersion)
+
+	m := &SignConfig{}
+	ok, _, err := m.Check(context.Background(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "migration check returned true for a signed config")
+
+	// strip the signature and the flag of the key like in repositories
+	// created by older versions
+	master := *repo.Key()
+	master.SignedConfig = false
+	_, err = repository.AddKey(context.TODO(), repo, rtest.TestPassword, "", "", &master)
+	rtest.OK(t, err)
+	rtest.OK(t, be.Remove(context.TODO(), backend.Handle{Type: restic.KeyFile, Name: repo.KeyID().String()}))
+	cfg := repo.Config()
+	cfg.Signature = nil
+	rtest.OK(t, be.Remove(context.TODO(), backend.Handle{Type: restic.ConfigFile}))
+	rtest.OK(t, restic.SaveConfig(context.TODO(), unpacked, cfg))
+	repo = repository.TestOpenBackend(t, be)
+
+	ok, _, err = m.Check(context.Background(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "migration check returned false")
+
+	rtest.OK(t, m.Apply(context.Background(), repo))
+
+	repo = repository.TestOpenBackend(t, be)
+	rtest.OK(t, repo.Config().VerifySignature(repo.Key()))
+	ok, _, err = m.Check(context.Background(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "migration check returned true after the migration")
+}
@@ -0,0 +1,197 @@
+// Package mssql streams native backups of Microsoft SQL Server databases. The
+// backup is requested using the T-SQL statement BACKUP DATABASE, which is run
+// via sqlcmd, and SQL Server writes the backup to a virtual device created
+// using the Virtual Device Interface (VDI). The data written to the device is
+// passed on to the reader without storing a .bak file on disk.
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Config selects the SQL Server instance.
+type Config struct {
+	// Instance is the name of the SQL Server instance on the local host,
+	// empty for the default instance.
+	Instance string
+	// Sqlcmd is the sqlcmd program used to run T-SQL statements, it defaults
+	// to "sqlcmd".
+	Sqlcmd string
+}
+
+// server returns the server name passed to sqlcmd. VDI only works with
+// instances on the local host.
+func (c Config) server() string {
+	if c.Instance == "" {
+		return "localhost"
+	}
+	return `localhost\` + c.Instance
+}
+
+// sqlcmd runs the query using Windows authentication and returns its output.
+func (c Config) sqlcmd(ctx context.Context, query string) ([]byte, error) {
+	program := c.Sqlcmd
+	if program == "" {
+		program = "sqlcmd"
+	}
+	// -b returns an error on failed statements, -h -1 omits the headers and
+	// -W removes trailing spaces
+	cmd := exec.CommandContext(ctx, program, "-S", c.server(), "-E", "-b", "-h", "-1", "-W", "-s", "|", "-Q", query)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	debug.Log("running %v", cmd.Args)
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String() + stdout.String())
+		return nil, fmt.Errorf("sqlcmd failed: %w: %v", err, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// quoteIdentifier quotes a database name for use in T-SQL statements.
+func quoteIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// quoteString quotes a string literal for use in T-SQL statements.
+func quoteString(s string) string {
+	return "N'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// backupStatement returns the statement which writes a full backup of the
+// database to the virtual device. COPY_ONLY ensures that the backup does not
+// affect the differential and log backups made by other tools.
+func backupStatement(database, device string) string {
+	return fmt.Sprintf("BACKUP DATABASE %s TO VIRTUAL_DEVICE = %s WITH COPY_ONLY",
+		quoteIdentifier(database), quoteString(device))
+}
+
+// Info describes a finished backup, it is read from the backup history in
+// the msdb database.
+type Info struct {
+	FirstLSN string
+	LastLSN  string
+	// Finished is the time at which the backup finished, the backup contains
+	// the state of the database at this point in time.
+	Finished time.Time
+}
+
+func infoStatement(database string) string {
+	return fmt.Sprintf("SET NOCOUNT ON; SELECT TOP 1 first_lsn, last_lsn, "+
+		"CONVERT(varchar(33), backup_finish_date, 126) FROM msdb.dbo.backupset "+
+		"WHERE database_name = %s AND type = 'D' ORDER BY backup_set_id DESC", quoteString(database))
+}
+
+// parseInfo parses the output of sqlcmd for the infoStatement.
+func parseInfo(output []byte) (Info, error) {
+	line := strings.TrimSpace(string(output))
+	fields := strings.Split(line, "|")
+	if len(fields) != 3 {
+		return Info{}, errors.Errorf("unexpected backup history %q", line)
+	}
+	// SQL Server returns the time without time zone in local time
+	finished, err := time.ParseInLocation("2006-01-02T15:04:05.999", fields[2], time.Local)
+	if err != nil {
+		return Info{}, errors.Errorf("unexpected backup finish date %q", fields[2])
+	}
+	return Info{FirstLSN: fields[0], LastLSN: fields[1], Finished: finished}, nil
+}
+
+// Tags returns the snapshot tags describing the backup of database. Empty
+// fields of i are omitted.
+func (i Info) Tags(database string) restic.TagList {
+	tags := restic.TagList{"mssql", "mssql-database:" + database}
+	if i.FirstLSN != "" {
+		tags = append(tags, "mssql-first-lsn:"+i.FirstLSN)
+	}
+	if i.LastLSN != "" {
+		tags = append(tags, "mssql-last-lsn:"+i.LastLSN)
+	}
+	if !i.Finished.IsZero() {
+		tags = append(tags, "mssql-finished:"+i.Finished.UTC().Format("2006-01-02T15:04:05Z"))
+	}
+	return tags
+}
+
+// Backup is a running backup of a database. Reading from it returns the
+// backup in the format of a .bak file.
+type Backup struct {
+	cfg      Config
+	database string
+	r        *io.PipeReader
+	done     chan struct{}
+	err      error
+}
+
+// Start starts a full backup of the database.
+func Start(ctx context.Context, cfg Config, database string) (*Backup, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	device := "restic-" + hex.EncodeToString(buf)
+
+	r, w := io.Pipe()
+	b := &Backup{
+		cfg:      cfg,
+		database: database,
+		r:        r,
+		done:     make(chan struct{}),
+	}
+
+	backup := func() error {
+		_, err := cfg.sqlcmd(ctx, backupStatement(database, device))
+		return err
+	}
+
+	go func() {
+		defer close(b.done)
+		err := runVirtualDevice(ctx, cfg.Instance, device, w, backup)
+		if err != nil {
+			debug.Log("backup of %v failed: %v", database, err)
+			// use a fatal error to abort the snapshot
+			b.err = errors.Fatalf("backup of database %v failed: %v", database, err)
+		}
+		_ = w.CloseWithError(b.err)
+	}()
+
+	return b, nil
+}
+
+func (b *Backup) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+// Close stops reading the backup. If the backup is still running, it is
+// aborted. Close returns the error of the backup.
+func (b *Backup) Close() error {
+	_ = b.r.CloseWithError(errors.New("backup stream closed"))
+	<-b.done
+	return b.err
+}
+
+// Info returns the details of the finished backup. It must only be called
+// after the backup was read completely.
+func (b *Backup) Info(ctx context.Context) (Info, error) {
+	<-b.done
+	if b.err != nil {
+		return Info{}, b.err
+	}
+	output, err := b.cfg.sqlcmd(ctx, infoStatement(b.database))
+	if err != nil {
+		return Info{}, err
+	}
+	return parseInfo(output)
+}
@@ -0,0 +1,39 @@
+package mssql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestBackupStatement(t *testing.T) {
+	rtest.Equals(t, "BACKUP DATABASE [Sales] TO VIRTUAL_DEVICE = N'restic-1' WITH COPY_ONLY",
+		backupStatement("Sales", "restic-1"))
+	rtest.Equals(t, "BACKUP DATABASE [a]]b] TO VIRTUAL_DEVICE = N'x''y' WITH COPY_ONLY",
+		backupStatement("a]b", "x'y"))
+}
+
+func TestParseInfo(t *testing.T) {
+	info, err := parseInfo([]byte("37000000025600001|37000000027200001|2024-06-03T10:05:12.513\r\n"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "37000000025600001", info.FirstLSN)
+	rtest.Equals(t, "37000000027200001", info.LastLSN)
+	rtest.Equals(t, time.Date(2024, 6, 3, 10, 5, 12, 513000000, time.Local), info.Finished)
+
+	rtest.Equals(t, restic.TagList{
+		"mssql",
+		"mssql-database:Sales",
+		"mssql-first-lsn:37000000025600001",
+		"mssql-last-lsn:37000000027200001",
+		"mssql-finished:" + info.Finished.UTC().Format("2006-01-02T15:04:05Z"),
+	}, info.Tags("Sales"))
+
+	rtest.Equals(t, restic.TagList{"mssql", "mssql-database:Sales"}, Info{}.Tags("Sales"))
+
+	for _, output := range []string{"", "1|2", "1|2|yesterday"} {
+		_, err := parseInfo([]byte(output))
+		rtest.Assert(t, err != nil, "missing error for %q", output)
+	}
+}
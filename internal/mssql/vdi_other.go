@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package mssql
+
+import (
+	"context"
+	"io"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+func runVirtualDevice(_ context.Context, _, _ string, _ io.Writer, _ func() error) error {
+	return errors.New("SQL Server backups are only supported on Windows")
+}
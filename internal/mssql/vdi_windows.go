@@ -0,0 +1,223 @@
+//go:build windows
+// +build windows
+
+package mssql
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+	"golang.org/x/sys/windows"
+)
+
+// see vdi.h and vdierror.h of the SQL Server VDI specification
+var (
+	clsidClientVirtualDeviceSet = ole.NewGUID("{40700425-0080-11d2-851f-00c04fc21759}")
+	iidClientVirtualDeviceSet2  = ole.NewGUID("{d0e6eb07-7a62-11d2-8573-00c04fc21759}")
+)
+
+const (
+	vdcWrite      = 2
+	vdcClearError = 3
+	vdcFlush      = 11
+
+	vdErrorClose = 0x80770004
+
+	errorSuccess          = 0
+	errorNotSupported     = 50
+	errorOperationAborted = 995
+
+	infinite = 0xFFFFFFFF
+)
+
+type vdConfig struct {
+	DeviceCount           uint32
+	Features              uint32
+	PrefixZoneSize        uint32
+	Alignment             uint32
+	SoftFileMarkBlockSize uint32
+	EOMWarningSize        uint32
+	ServerTimeOut         uint32
+	BlockSize             uint32
+	MaxIODepth            uint32
+	MaxTransferSize       uint32
+	BufferAreaSize        uint32
+}
+
+type vdcCommand struct {
+	CommandCode uint32
+	Size        uint32
+	Position    uint64
+	Buffer      *byte
+}
+
+// clientVirtualDeviceSet is the COM interface IClientVirtualDeviceSet2.
+type clientVirtualDeviceSet struct {
+	ole.IUnknown
+}
+
+type clientVirtualDeviceSetVtbl struct {
+	ole.IUnknownVtbl
+	Create            uintptr
+	GetConfiguration  uintptr
+	OpenDevice        uintptr
+	Close             uintptr
+	SignalAbort       uintptr
+	OpenInSecondary   uintptr
+	GetBufferHandle   uintptr
+	MapBufferHandle   uintptr
+	CreateEx          uintptr
+	OpenInSecondaryEx uintptr
+}
+
+func (s *clientVirtualDeviceSet) vtbl() *clientVirtualDeviceSetVtbl {
+	return (*clientVirtualDeviceSetVtbl)(unsafe.Pointer(s.RawVTable))
+}
+
+// clientVirtualDevice is the COM interface IClientVirtualDevice.
+type clientVirtualDevice struct {
+	ole.IUnknown
+}
+
+type clientVirtualDeviceVtbl struct {
+	ole.IUnknownVtbl
+	GetCommand      uintptr
+	CompleteCommand uintptr
+}
+
+func (d *clientVirtualDevice) vtbl() *clientVirtualDeviceVtbl {
+	return (*clientVirtualDeviceVtbl)(unsafe.Pointer(d.RawVTable))
+}
+
+// call calls the COM method fn of the object and converts a failed HRESULT
+// to an error.
+func call(fn uintptr, object unsafe.Pointer, args ...uintptr) error {
+	hr, _, _ := syscall.SyscallN(fn, append([]uintptr{uintptr(object)}, args...)...)
+	if int32(hr) < 0 {
+		return ole.NewError(hr)
+	}
+	return nil
+}
+
+func isHRESULT(err error, hr uint32) bool {
+	oleErr, ok := err.(*ole.OleError)
+	return ok && uint32(oleErr.Code()) == hr
+}
+
+// runVirtualDevice creates the virtual device set with the given name and
+// calls backup, which must instruct SQL Server to write a backup to it. The
+// data written by SQL Server is copied to w.
+func runVirtualDevice(_ context.Context, instance, name string, w io.Writer, backup func() error) error {
+	// COM objects must only be used on the thread which created them
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+		// CoInitializeEx returns S_FALSE if COM is already initialized
+		if oleErr, ok := err.(*ole.OleError); !ok || oleErr.Code() != 1 {
+			return err
+		}
+	}
+
+	unknown, err := ole.CreateInstance(clsidClientVirtualDeviceSet, iidClientVirtualDeviceSet2)
+	if err != nil {
+		return fmt.Errorf("unable to create virtual device set, is SQL Server installed: %w", err)
+	}
+	set := (*clientVirtualDeviceSet)(unsafe.Pointer(unknown))
+	defer set.Release()
+
+	var instanceName *uint16
+	if instance != "" {
+		instanceName = windows.StringToUTF16Ptr(instance)
+	}
+	deviceName := windows.StringToUTF16Ptr(name)
+	cfg := vdConfig{DeviceCount: 1}
+	err = call(set.vtbl().CreateEx, unsafe.Pointer(set), uintptr(unsafe.Pointer(instanceName)),
+		uintptr(unsafe.Pointer(deviceName)), uintptr(unsafe.Pointer(&cfg)))
+	if err != nil {
+		return fmt.Errorf("unable to create virtual device set: %w", err)
+	}
+	defer func() { _ = call(set.vtbl().Close, unsafe.Pointer(set)) }()
+
+	abort := func() {
+		_ = call(set.vtbl().SignalAbort, unsafe.Pointer(set))
+	}
+
+	backupDone := make(chan error, 1)
+	go func() {
+		err := backup()
+		if err != nil {
+			// wakes up GetConfiguration and GetCommand
+			abort()
+		}
+		backupDone <- err
+	}()
+
+	// failed returns the error of the backup statement if there is one, as
+	// it is more useful than the error of the virtual device
+	failed := func(err error) error {
+		abort()
+		if backupErr := <-backupDone; backupErr != nil {
+			return backupErr
+		}
+		return err
+	}
+
+	// wait until SQL Server opens the device set
+	err = call(set.vtbl().GetConfiguration, unsafe.Pointer(set), infinite, uintptr(unsafe.Pointer(&cfg)))
+	if err != nil {
+		return failed(fmt.Errorf("virtual device set was not opened: %w", err))
+	}
+
+	var device *clientVirtualDevice
+	err = call(set.vtbl().OpenDevice, unsafe.Pointer(set), uintptr(unsafe.Pointer(deviceName)), uintptr(unsafe.Pointer(&device)))
+	if err != nil {
+		return failed(fmt.Errorf("unable to open virtual device: %w", err))
+	}
+	defer device.Release()
+
+	for {
+		var cmd *vdcCommand
+		err := call(device.vtbl().GetCommand, unsafe.Pointer(device), infinite, uintptr(unsafe.Pointer(&cmd)))
+		if isHRESULT(err, vdErrorClose) {
+			// SQL Server closed the device, the backup is complete
+			break
+		}
+		if err != nil {
+			return failed(fmt.Errorf("virtual device failed: %w", err))
+		}
+
+		code, n := uintptr(errorSuccess), uintptr(0)
+		var writeErr error
+		switch cmd.CommandCode {
+		case vdcWrite:
+			_, writeErr = w.Write(unsafe.Slice(cmd.Buffer, cmd.Size))
+			if writeErr != nil {
+				code = errorOperationAborted
+			} else {
+				n = uintptr(cmd.Size)
+			}
+		case vdcFlush, vdcClearError:
+		default:
+			code = errorNotSupported
+		}
+
+		// The position is a 64 bit value, which takes up two arguments on
+		// 32 bit systems. The additional argument is ignored on 64 bit
+		// systems.
+		err = call(device.vtbl().CompleteCommand, unsafe.Pointer(device), uintptr(unsafe.Pointer(cmd)), code, n, 0, 0)
+		if writeErr != nil {
+			return failed(writeErr)
+		}
+		if err != nil {
+			return failed(fmt.Errorf("virtual device failed: %w", err))
+		}
+	}
+
+	return <-backupDone
+}
@@ -0,0 +1,506 @@
+// Package nfsserver exports snapshots via NFSv3. The snapshots are presented
+// as a read-only file system, which contains one directory per snapshot and a
+// symlink "latest" to the directory of the newest snapshot.
+package nfsserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/access"
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	nfsfile "github.com/willscott/go-nfs/file"
+)
+
+// blobCacheSize is the memory used to cache file content.
+const blobCacheSize = 64 << 20
+
+// treeCacheSize is the number of trees kept in memory.
+const treeCacheSize = 1024
+
+// latestName is the name of the symlink to the newest snapshot.
+const latestName = "latest"
+
+// FS is a read-only billy.Filesystem which contains the files of snapshots.
+type FS struct {
+	ctx  context.Context
+	repo restic.Loader
+
+	// snapshots maps the directory names in the root to the snapshots.
+	snapshots map[string]*restic.Snapshot
+	names     []string
+	latest    string
+	created   time.Time
+
+	blobCache *bloblru.Cache
+	trees     *treeCache
+
+	// checker restricts the visible files, it is nil if all files are
+	// visible.
+	checker *access.Checker
+}
+
+// treeCache holds the recently used trees.
+type treeCache struct {
+	mu  sync.Mutex
+	lru *simplelru.LRU[restic.ID, *restic.Tree]
+}
+
+var _ billy.Filesystem = &FS{}
+var _ billy.Capable = &FS{}
+
+// New returns a file system containing the snapshots. The directory of each
+// snapshot is named after its time formatted using timeTemplate, duplicate
+// names get a numeric suffix. Data is loaded using ctx.
+func New(ctx context.Context, repo restic.Loader, snapshots restic.Snapshots, timeTemplate string) *FS {
+	lru, err := simplelru.NewLRU[restic.ID, *restic.Tree](treeCacheSize, nil)
+	if err != nil {
+		panic(err) // only possible if treeCacheSize <= 0
+	}
+
+	f := &FS{
+		ctx:       ctx,
+		repo:      repo,
+		snapshots: make(map[string]*restic.Snapshot),
+		created:   time.Now(),
+		blobCache: bloblru.New(blobCacheSize),
+		trees:     &treeCache{lru: lru},
+	}
+
+	sorted := append(restic.Snapshots(nil), snapshots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+	for _, sn := range sorted {
+		name := strings.ReplaceAll(sn.Time.Format(timeTemplate), "/", "_")
+		if name == latestName {
+			name += "-snapshot"
+		}
+		unique := name
+		for i := 1; f.snapshots[unique] != nil; i++ {
+			unique = fmt.Sprintf("%s-%d", name, i)
+		}
+		f.snapshots[unique] = sn
+		f.names = append(f.names, unique)
+		f.latest = unique
+	}
+	sort.Strings(f.names)
+	return f
+}
+
+// WithChecker returns a view of the file system which only contains the files
+// checker grants access to. The view shares the caches with f.
+func (f *FS) WithChecker(checker *access.Checker) *FS {
+	view := *f
+	view.checker = checker
+	return &view
+}
+
+// visible reports whether the file or directory node at path p within a
+// snapshot is visible. Node is nil for the root directory of a snapshot.
+func (f *FS) visible(p string, node *restic.Node) bool {
+	return f.checker.Check(p, node) != access.Denied
+}
+
+// Capabilities implements billy.Capable.
+func (f *FS) Capabilities() billy.Capability {
+	return billy.ReadCapability | billy.SeekCapability
+}
+
+func (f *FS) loadTree(id restic.ID) (*restic.Tree, error) {
+	f.trees.mu.Lock()
+	tree, ok := f.trees.lru.Get(id)
+	f.trees.mu.Unlock()
+	if ok {
+		return tree, nil
+	}
+
+	tree, err := restic.LoadTree(f.ctx, f.repo, id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.trees.mu.Lock()
+	f.trees.lru.Add(id, tree)
+	f.trees.mu.Unlock()
+	return tree, nil
+}
+
+// entry is a file or directory in the file system.
+type entry struct {
+	path string
+	// node is nil for the root directory and the latest symlink.
+	node *restic.Node
+	// tree is set for directories.
+	tree *restic.ID
+	// snapshot is set for the directories of snapshots.
+	snapshot *restic.Snapshot
+	// snapshotPath is the path within the snapshot.
+	snapshotPath string
+}
+
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+// splitPath returns the components of name, which is relative to the root.
+func splitPath(name string) []string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// lookup returns the entry for name.
+func (f *FS) lookup(op, name string) (*entry, error) {
+	parts := splitPath(name)
+	if len(parts) == 0 {
+		return &entry{path: "/"}, nil
+	}
+	// the root directories of all snapshots have the same access
+	if !f.visible("/", nil) {
+		return nil, notExist(op, name)
+	}
+	if len(parts) == 1 && parts[0] == latestName && f.latest != "" {
+		return &entry{path: "/" + latestName}, nil
+	}
+
+	sn, ok := f.snapshots[parts[0]]
+	if !ok {
+		return nil, notExist(op, name)
+	}
+	e := &entry{path: "/" + parts[0], tree: sn.Tree, snapshot: sn, snapshotPath: "/"}
+
+	for _, part := range parts[1:] {
+		if e.tree == nil {
+			return nil, notExist(op, name)
+		}
+		tree, err := f.loadTree(*e.tree)
+		if err != nil {
+			return nil, err
+		}
+		node := tree.Find(part)
+		snapshotPath := path.Join(e.snapshotPath, part)
+		if node == nil || !f.visible(snapshotPath, node) {
+			return nil, notExist(op, name)
+		}
+		e = &entry{path: e.path + "/" + part, node: node, snapshotPath: snapshotPath}
+		if node.Type == restic.NodeTypeDir {
+			if node.Subtree == nil {
+				return nil, notExist(op, name)
+			}
+			e.tree = node.Subtree
+		}
+	}
+	return e, nil
+}
+
+// fileInfo implements os.FileInfo for an entry.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	sys     nfsfile.FileInfo
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return fi.sys }
+
+// fileID derives a unique file ID from the path. Inode numbers stored in the
+// snapshots cannot be used, they are not unique across snapshots.
+func fileID(p string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(p))
+	return h.Sum64()
+}
+
+// nodeMode returns the mode of node including the file type bits.
+func nodeMode(node *restic.Node) os.FileMode {
+	mode := node.Mode &^ os.ModeType
+	switch node.Type {
+	case restic.NodeTypeDir:
+		mode |= os.ModeDir
+	case restic.NodeTypeSymlink:
+		mode |= os.ModeSymlink
+	case restic.NodeTypeDev:
+		mode |= os.ModeDevice
+	case restic.NodeTypeCharDev:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case restic.NodeTypeFifo:
+		mode |= os.ModeNamedPipe
+	case restic.NodeTypeSocket:
+		mode |= os.ModeSocket
+	}
+	return mode
+}
+
+func (f *FS) stat(e *entry) os.FileInfo {
+	fi := &fileInfo{
+		name: path.Base(e.path),
+		sys:  nfsfile.FileInfo{Nlink: 1, Fileid: fileID(e.path)},
+	}
+
+	switch {
+	case e.node != nil:
+		fi.size = int64(e.node.Size)
+		fi.mode = nodeMode(e.node)
+		fi.modTime = e.node.ModTime
+		fi.sys.UID = e.node.UID
+		fi.sys.GID = e.node.GID
+		if e.node.Links > 0 {
+			fi.sys.Nlink = uint32(e.node.Links)
+		}
+		if e.node.Type == restic.NodeTypeSymlink {
+			fi.size = int64(len(e.node.LinkTarget))
+		}
+		if e.node.Type == restic.NodeTypeDev || e.node.Type == restic.NodeTypeCharDev {
+			// device numbers are stored using the encoding of Linux
+			dev := e.node.Device
+			fi.sys.Major = uint32(dev>>8&0xfff | dev>>32&^0xfff)
+			fi.sys.Minor = uint32(dev&0xff | dev>>12&^0xff)
+		}
+	case e.snapshot != nil:
+		fi.mode = os.ModeDir | 0555
+		fi.modTime = e.snapshot.Time
+	case e.path == "/"+latestName:
+		fi.mode = os.ModeSymlink | 0777
+		fi.size = int64(len(f.latest))
+		fi.modTime = f.snapshots[f.latest].Time
+	default:
+		fi.name = "/"
+		fi.mode = os.ModeDir | 0555
+		fi.modTime = f.created
+	}
+	return fi
+}
+
+// Stat returns information about name. As the file system does not resolve
+// symlinks, it is the same as Lstat.
+func (f *FS) Stat(name string) (os.FileInfo, error) {
+	return f.Lstat(name)
+}
+
+// Lstat returns information about name.
+func (f *FS) Lstat(name string) (os.FileInfo, error) {
+	e, err := f.lookup("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.stat(e), nil
+}
+
+// ReadDir returns the entries of the directory name.
+func (f *FS) ReadDir(name string) ([]os.FileInfo, error) {
+	e, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.path == "/" {
+		if !f.visible("/", nil) {
+			return nil, nil
+		}
+		infos := make([]os.FileInfo, 0, len(f.names)+1)
+		for _, name := range f.names {
+			infos = append(infos, f.stat(&entry{path: "/" + name, tree: f.snapshots[name].Tree, snapshot: f.snapshots[name]}))
+		}
+		if f.latest != "" {
+			infos = append(infos, f.stat(&entry{path: "/" + latestName}))
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+		return infos, nil
+	}
+
+	if e.tree == nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	tree, err := f.loadTree(*e.tree)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(tree.Nodes))
+	for _, node := range tree.Nodes {
+		if !f.visible(path.Join(e.snapshotPath, node.Name), node) {
+			continue
+		}
+		infos = append(infos, f.stat(&entry{path: e.path + "/" + node.Name, node: node}))
+	}
+	return infos, nil
+}
+
+// Readlink returns the target of the symlink link.
+func (f *FS) Readlink(link string) (string, error) {
+	e, err := f.lookup("readlink", link)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case e.path == "/"+latestName:
+		return f.latest, nil
+	case e.node != nil && e.node.Type == restic.NodeTypeSymlink:
+		return e.node.LinkTarget, nil
+	}
+	return "", &os.PathError{Op: "readlink", Path: link, Err: errors.New("not a symlink")}
+}
+
+// Open opens the file name for reading.
+func (f *FS) Open(name string) (billy.File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the file name, which must be a regular file. Only reading is
+// supported.
+func (f *FS) OpenFile(name string, flag int, _ os.FileMode) (billy.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, billy.ErrReadOnly
+	}
+	e, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.node == nil || e.node.Type != restic.NodeTypeFile {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("not a regular file")}
+	}
+
+	// cumsize[i] holds the cumulative size of blobs[:i].
+	cumsize := make([]uint64, 1+len(e.node.Content))
+	for i, id := range e.node.Content {
+		size, found := f.repo.LookupBlobSize(restic.DataBlob, id)
+		if !found {
+			return nil, fmt.Errorf("id %v not found in repository", id)
+		}
+		cumsize[i+1] = cumsize[i] + uint64(size)
+	}
+
+	return &file{fs: f, name: name, content: e.node.Content, cumsize: cumsize}, nil
+}
+
+// Join joins the path elements.
+func (f *FS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Root returns the root path of the file system.
+func (f *FS) Root() string {
+	return "/"
+}
+
+// Create is not supported, the file system is read-only.
+func (f *FS) Create(string) (billy.File, error) { return nil, billy.ErrReadOnly }
+
+// Rename is not supported, the file system is read-only.
+func (f *FS) Rename(string, string) error { return billy.ErrReadOnly }
+
+// Remove is not supported, the file system is read-only.
+func (f *FS) Remove(string) error { return billy.ErrReadOnly }
+
+// TempFile is not supported, the file system is read-only.
+func (f *FS) TempFile(string, string) (billy.File, error) { return nil, billy.ErrReadOnly }
+
+// MkdirAll is not supported, the file system is read-only.
+func (f *FS) MkdirAll(string, os.FileMode) error { return billy.ErrReadOnly }
+
+// Symlink is not supported, the file system is read-only.
+func (f *FS) Symlink(string, string) error { return billy.ErrReadOnly }
+
+// Chroot is not supported.
+func (f *FS) Chroot(string) (billy.Filesystem, error) { return nil, billy.ErrNotSupported }
+
+// file reads the content of a regular file.
+type file struct {
+	fs      *FS
+	name    string
+	content restic.IDs
+	cumsize []uint64
+	offset  int64
+}
+
+var _ billy.File = &file{}
+
+func (f *file) size() int64 {
+	return int64(f.cumsize[len(f.cumsize)-1])
+}
+
+func (f *file) Name() string { return f.name }
+
+// ReadAt reads from the file starting at offset off.
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := uint64(off) + uint64(n)
+		if pos >= uint64(f.size()) {
+			return n, io.EOF
+		}
+
+		i := sort.Search(len(f.cumsize), func(i int) bool {
+			return f.cumsize[i] > pos
+		}) - 1
+
+		id := f.content[i]
+		blob, err := f.fs.blobCache.GetOrCompute(id, func() ([]byte, error) {
+			return f.fs.repo.LoadBlob(f.fs.ctx, restic.DataBlob, id, nil)
+		})
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], blob[pos-f.cumsize[i]:])
+	}
+	return n, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Close() error { return nil }
+
+func (f *file) Lock() error   { return nil }
+func (f *file) Unlock() error { return nil }
+
+func (f *file) Write([]byte) (int, error) { return 0, billy.ErrReadOnly }
+func (f *file) Truncate(int64) error      { return billy.ErrReadOnly }
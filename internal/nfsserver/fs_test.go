@@ -0,0 +1,201 @@
+package nfsserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/access"
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+
+	nfsc "github.com/willscott/go-nfs-client/nfs"
+	"github.com/willscott/go-nfs-client/nfs/rpc"
+)
+
+var testFiles = archiver.TestDir{
+	"a": archiver.TestDir{
+		"x": archiver.TestFile{Content: "x"},
+		"large": archiver.TestFile{
+			Content: strings.Repeat("restic", 400000),
+		},
+	},
+	"b":    archiver.TestFile{Content: "b"},
+	"link": archiver.TestSymlink{Target: "b"},
+}
+
+var snapshotTimes = []time.Time{
+	time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC),
+	time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC),
+}
+
+func testFS(t *testing.T) *FS {
+	ctx := context.Background()
+	repo := repository.TestRepository(t)
+	tempdir := rtest.TempDir(t)
+	archiver.TestCreateFiles(t, tempdir, testFiles)
+
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	var snapshots restic.Snapshots
+	for _, ts := range snapshotTimes {
+		arch := archiver.New(repo, fs.Track{FS: fs.Local{}}, archiver.Options{})
+		sn, _, _, err := arch.Snapshot(ctx, []string{"."}, archiver.SnapshotOptions{Time: ts})
+		rtest.OK(t, err)
+		snapshots = append(snapshots, sn)
+	}
+
+	return New(ctx, repo, snapshots, time.RFC3339)
+}
+
+func names(infos []os.FileInfo) []string {
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	return names
+}
+
+func TestFS(t *testing.T) {
+	f := testFS(t)
+
+	infos, err := f.ReadDir("/")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"2024-01-02T03:04:05Z", "2024-01-03T03:04:05Z", "2024-01-03T03:04:05Z-1", "latest"}, names(infos))
+
+	target, err := f.Readlink("latest")
+	rtest.OK(t, err)
+	rtest.Equals(t, "2024-01-03T03:04:05Z-1", target)
+
+	_, err = f.ReadDir("/latest/a")
+	rtest.Assert(t, err != nil, "symlinks must not be followed")
+	infos, err = f.ReadDir("/2024-01-02T03:04:05Z/a")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"large", "x"}, names(infos))
+
+	fi, err := f.Lstat("2024-01-02T03:04:05Z/link")
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.Mode()&os.ModeSymlink != 0, "unexpected mode %v", fi.Mode())
+	target, err = f.Readlink("2024-01-02T03:04:05Z/link")
+	rtest.OK(t, err)
+	rtest.Equals(t, "b", target)
+
+	content := strings.Repeat("restic", 400000)
+	file, err := f.Open("2024-01-02T03:04:05Z/a/large")
+	rtest.OK(t, err)
+	data, err := io.ReadAll(file)
+	rtest.OK(t, err)
+	rtest.Equals(t, content, string(data))
+
+	// read across blob boundaries
+	buf := make([]byte, 1<<20)
+	n, err := file.ReadAt(buf, 1000)
+	rtest.OK(t, err)
+	rtest.Equals(t, len(buf), n)
+	rtest.Equals(t, content[1000:1000+len(buf)], string(buf))
+	n, err = file.ReadAt(buf, int64(len(content)-10))
+	rtest.Equals(t, io.EOF, err)
+	rtest.Equals(t, 10, n)
+	rtest.OK(t, file.Close())
+
+	for _, name := range []string{"missing", "2024-01-02T03:04:05Z/missing", "2024-01-02T03:04:05Z/b/x"} {
+		_, err = f.Lstat(name)
+		rtest.Assert(t, os.IsNotExist(err), "expected not exist error for %q, got %v", name, err)
+	}
+
+	_, err = f.Create("2024-01-02T03:04:05Z/new")
+	rtest.Assert(t, err != nil, "file system must be read-only")
+	_, err = f.OpenFile("2024-01-02T03:04:05Z/b", os.O_RDWR, 0)
+	rtest.Assert(t, err != nil, "file system must be read-only")
+}
+
+func TestChecker(t *testing.T) {
+	policy, err := access.Parse(strings.NewReader("allow host:10.0.0.1 /a/x\nallow host:10.0.0.2 /b"), "policy")
+	rtest.OK(t, err)
+	f := testFS(t)
+
+	view := f.WithChecker(policy.For(access.Identity{Host: net.ParseIP("10.0.0.1")}))
+	infos, err := view.ReadDir("/2024-01-02T03:04:05Z")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"a"}, names(infos))
+	infos, err = view.ReadDir("/2024-01-02T03:04:05Z/a")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"x"}, names(infos))
+	_, err = view.Open("/2024-01-02T03:04:05Z/a/large")
+	rtest.Assert(t, os.IsNotExist(err), "expected not exist error, got %v", err)
+	_, err = view.Lstat("/2024-01-02T03:04:05Z/b")
+	rtest.Assert(t, os.IsNotExist(err), "expected not exist error, got %v", err)
+
+	// hosts without access see an empty file system
+	view = f.WithChecker(policy.For(access.Identity{Host: net.ParseIP("10.0.0.3")}))
+	infos, err = view.ReadDir("/")
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(infos))
+	_, err = view.Readlink("latest")
+	rtest.Assert(t, os.IsNotExist(err), "expected not exist error, got %v", err)
+
+	// the original file system is not restricted
+	infos, err = f.ReadDir("/2024-01-02T03:04:05Z")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"a", "b", "link"}, names(infos))
+}
+
+func TestServe(t *testing.T) {
+	f := testFS(t)
+	policy, err := access.Parse(strings.NewReader("allow host:127.0.0.1 /a\n"), "policy")
+	rtest.OK(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	rtest.OK(t, err)
+	done := make(chan struct{})
+	go func() {
+		_ = Serve(listener, f, policy)
+		close(done)
+	}()
+	defer func() {
+		rtest.OK(t, listener.Close())
+		<-done
+	}()
+
+	client, err := rpc.DialTCP("tcp", listener.Addr().String(), false)
+	rtest.OK(t, err)
+	defer client.Close()
+
+	mounter := nfsc.Mount{Client: client}
+	target, err := mounter.Mount("/", rpc.AuthNull)
+	rtest.OK(t, err)
+	defer func() { _ = mounter.Unmount() }()
+
+	entries, err := target.ReadDirPlus("/2024-01-02T03:04:05Z")
+	rtest.OK(t, err)
+	var entryNames []string
+	for _, e := range entries {
+		if e.FileName != "." && e.FileName != ".." {
+			entryNames = append(entryNames, e.FileName)
+		}
+	}
+	sort.Strings(entryNames)
+	rtest.Equals(t, []string{"a"}, entryNames)
+
+	file, err := target.Open("/2024-01-03T03:04:05Z/a/large")
+	rtest.OK(t, err)
+	data, err := io.ReadAll(file)
+	rtest.OK(t, err)
+	// the client commits written data on close, which fails on a read-only
+	// file system
+	_ = file.Close()
+	rtest.Equals(t, strings.Repeat("restic", 400000), string(data))
+
+	_, err = target.Create("/2024-01-02T03:04:05Z/new", 0644)
+	rtest.Assert(t, err != nil, "creating a file must fail")
+}
@@ -0,0 +1,71 @@
+package nfsserver
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/restic/restic/internal/access"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/willscott/go-nfs"
+	"github.com/willscott/go-nfs/helpers"
+)
+
+// handleCacheSize is the number of file handles the server remembers. Clients
+// get an error when they use a handle which was evicted from the cache, so it
+// is large. The cache only grows as files are accessed.
+const handleCacheSize = 1 << 20
+
+func init() {
+	// the library logs every failed request, including lookups of missing
+	// files, unless only errors are logged
+	nfs.Log.SetLevel(nfs.ErrorLevel)
+}
+
+// Serve exports fs via NFSv3 to clients connecting to listener. Clients must
+// not authenticate. If policy is not nil, each client only sees the files the
+// policy grants to its address. Serve returns when listener is closed.
+func Serve(listener net.Listener, fs *FS, policy *access.Policy) error {
+	var handler nfs.Handler = helpers.NewNullAuthHandler(fs)
+	if policy != nil {
+		handler = &policyHandler{
+			Handler: handler,
+			fs:      fs,
+			policy:  policy,
+			views:   make(map[string]*FS),
+		}
+	}
+	return nfs.Serve(listener, helpers.NewCachingHandler(handler, handleCacheSize))
+}
+
+// policyHandler returns a view of the file system for the address of the
+// client on mount. The kernel sends the credentials of root when mounting, so
+// clients are only identified by their address.
+type policyHandler struct {
+	nfs.Handler
+	fs     *FS
+	policy *access.Policy
+
+	mu sync.Mutex
+	// views maps client addresses to their view of the file system. The views
+	// are reused, so file handles stay valid when a client mounts again.
+	views map[string]*FS
+}
+
+// Mount returns the view of the file system for the client.
+func (h *policyHandler) Mount(_ context.Context, conn net.Conn, _ nfs.MountRequest) (nfs.MountStatus, billy.Filesystem, []nfs.AuthFlavor) {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return nfs.MountStatusErrAcces, nil, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	view, ok := h.views[host]
+	if !ok {
+		view = h.fs.WithChecker(h.policy.For(access.Identity{Host: net.ParseIP(host)}))
+		h.views[host] = view
+	}
+	return nfs.MountStatusOk, view, []nfs.AuthFlavor{nfs.AuthFlavorNull}
+}
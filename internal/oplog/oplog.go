@@ -0,0 +1,229 @@
+// Package oplog implements a tamper-evident log of destructive operations,
+// like removing snapshots, pruning data or changing keys, which is stored in
+// the repository itself.
+//
+// Each record contains the ID of the preceding record. As the ID of a file is
+// the hash of its encrypted content, the records form a hash chain: removing
+// or modifying a record breaks the chain, which is detected by Verify.
+// Removing the newest records cannot be detected this way, it is detected by
+// comparing the ID of the newest record with a copy kept outside of the
+// repository.
+package oplog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Operations recorded in the log.
+const (
+	OpForget    = "forget"
+	OpPrune     = "prune"
+	OpKeyAdd    = "key add"
+	OpKeyRemove = "key remove"
+	OpKeyPasswd = "key passwd"
+	// OpRewrite, OpRepairSnapshots and OpRechunk remove the original
+	// snapshots which were replaced by new snapshots or became empty.
+	OpRewrite         = "rewrite"
+	OpRepairSnapshots = "repair snapshots"
+	OpRechunk         = "rechunk"
+)
+
+// Record describes an operation.
+type Record struct {
+	// Sequence is the position of the record in the log, starting at zero.
+	Sequence uint64 `json:"sequence"`
+	// Previous is the ID of the preceding record, it is nil for the first
+	// record.
+	Previous *restic.ID `json:"previous,omitempty"`
+
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	Username string    `json:"username"`
+	// KeyID is the ID of the key used to access the repository.
+	KeyID *restic.ID `json:"key_id,omitempty"`
+
+	Operation string `json:"operation"`
+	// Snapshots are the IDs of the removed snapshots.
+	Snapshots restic.IDs `json:"snapshots,omitempty"`
+	// Trees are the root trees of the removed snapshots. They are used to
+	// find out when data became unused.
+	Trees restic.IDs `json:"trees,omitempty"`
+	// Key is the ID of the added or removed key.
+	Key *restic.ID `json:"key,omitempty"`
+	// Approval is the ID of the approval request which authorized the
+	// operation, it is nil if the operation did not require approval.
+	Approval *restic.ID `json:"approval,omitempty"`
+	// Details is a summary of the changes, for example the amount of data
+	// removed by prune.
+	Details string `json:"details,omitempty"`
+
+	id restic.ID
+}
+
+// ID returns the ID of the record.
+func (r *Record) ID() restic.ID {
+	return r.id
+}
+
+// Log is the list of records stored in a repository.
+type Log struct {
+	// Records are sorted by their sequence number.
+	Records []*Record
+}
+
+// Load loads all records from the repository.
+func Load(ctx context.Context, repo restic.ListerLoaderUnpacked) (*Log, error) {
+	var m sync.Mutex
+	log := &Log{}
+
+	err := restic.ParallelList(ctx, repo, restic.OpLogFile, repo.Connections(), func(ctx context.Context, id restic.ID, _ int64) error {
+		rec := &Record{}
+		err := restic.LoadJSONUnpacked(ctx, repo, restic.OpLogFile, id, rec)
+		if err != nil {
+			return fmt.Errorf("operation log record %v: %w", id.Str(), err)
+		}
+		rec.id = id
+
+		m.Lock()
+		defer m.Unlock()
+		log.Records = append(log.Records, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(log.Records, func(i, j int) bool {
+		a, b := log.Records[i], log.Records[j]
+		if a.Sequence != b.Sequence {
+			return a.Sequence < b.Sequence
+		}
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		return a.id.String() < b.id.String()
+	})
+	return log, nil
+}
+
+// Head returns the newest record, or nil if the log is empty.
+func (l *Log) Head() *Record {
+	if len(l.Records) == 0 {
+		return nil
+	}
+	return l.Records[len(l.Records)-1]
+}
+
+// Removed returns the number of snapshots removed without approval after
+// since, by forget or by replacing them with new snapshots.
+func (l *Log) Removed(since time.Time) uint {
+	var n uint
+	for _, rec := range l.Records {
+		if rec.Approval == nil && rec.Time.After(since) {
+			n += uint(len(rec.Snapshots))
+		}
+	}
+	return n
+}
+
+// Verify checks that the records form a single unbroken chain and returns
+// all problems found.
+func (l *Log) Verify() []error {
+	var errs []error
+
+	records := make(map[restic.ID]*Record, len(l.Records))
+	for _, rec := range l.Records {
+		records[rec.id] = rec
+	}
+
+	successors := make(map[restic.ID]int)
+	for _, rec := range l.Records {
+		if rec.Previous == nil {
+			if rec.Sequence != 0 {
+				errs = append(errs, fmt.Errorf("record %v (sequence %d) has no predecessor, earlier records were removed", rec.id.Str(), rec.Sequence))
+			}
+			continue
+		}
+
+		prev, ok := records[*rec.Previous]
+		if !ok {
+			errs = append(errs, fmt.Errorf("record %v (sequence %d) references missing record %v, records were removed", rec.id.Str(), rec.Sequence, rec.Previous.Str()))
+			continue
+		}
+		if rec.Sequence != prev.Sequence+1 {
+			errs = append(errs, fmt.Errorf("record %v has sequence %d, but its predecessor %v has sequence %d", rec.id.Str(), rec.Sequence, prev.id.Str(), prev.Sequence))
+		}
+		successors[prev.id]++
+	}
+
+	roots := 0
+	for _, rec := range l.Records {
+		if rec.Previous == nil {
+			roots++
+		}
+		if successors[rec.id] > 1 {
+			errs = append(errs, fmt.Errorf("record %v (sequence %d) has %d successors, the history was forked", rec.id.Str(), rec.Sequence, successors[rec.id]))
+		}
+	}
+	if roots > 1 {
+		errs = append(errs, fmt.Errorf("found %d records without predecessor", roots))
+	}
+
+	return errs
+}
+
+// Append adds rec as the newest record to the log in the repository. The
+// sequence number and the reference to the previous record are set by Append,
+// as well as the time, host and user name unless they are already set. The
+// repository should be locked exclusively, otherwise concurrent operations may
+// fork the log.
+func Append(ctx context.Context, repo restic.Unpacked[restic.WriteableFileType], rec *Record) (restic.ID, error) {
+	log, err := Load(ctx, repo)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	return log.Append(ctx, repo, rec)
+}
+
+// Append adds rec as the newest record to the log, which must have been
+// loaded from repo, and to l. This allows appending several records while
+// listing the log only once.
+func (l *Log) Append(ctx context.Context, repo restic.SaverUnpacked[restic.WriteableFileType], rec *Record) (restic.ID, error) {
+	rec.Sequence = 0
+	rec.Previous = nil
+	if head := l.Head(); head != nil {
+		id := head.id
+		rec.Sequence = head.Sequence + 1
+		rec.Previous = &id
+	}
+
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if rec.Hostname == "" {
+		rec.Hostname, _ = os.Hostname()
+	}
+	if rec.Username == "" {
+		if usr, err := user.Current(); err == nil {
+			rec.Username = usr.Username
+		}
+	}
+
+	id, err := restic.SaveJSONUnpacked(ctx, repo, restic.WriteableOpLogFile, rec)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	rec.id = id
+	l.Records = append(l.Records, rec)
+	debug.Log("appended record %v (sequence %d) for %v", id, rec.Sequence, rec.Operation)
+	return id, nil
+}
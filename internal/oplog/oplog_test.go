@@ -0,0 +1,153 @@
+package oplog_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/oplog"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func appendRecords(t *testing.T, repo restic.Repository, ops ...string) []restic.ID {
+	var ids []restic.ID
+	for _, op := range ops {
+		id, err := oplog.Append(context.TODO(), repo, &oplog.Record{Operation: op})
+		rtest.OK(t, err)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestAppend(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	log, err := oplog.Load(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, log.Head() == nil, "expected empty log")
+
+	ids := appendRecords(t, repo, oplog.OpForget, oplog.OpPrune, oplog.OpKeyAdd)
+
+	log, err = oplog.Load(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, len(log.Records))
+	rtest.Equals(t, 0, len(log.Verify()))
+
+	for i, rec := range log.Records {
+		rtest.Equals(t, uint64(i), rec.Sequence)
+		rtest.Equals(t, ids[i], rec.ID())
+		if i == 0 {
+			rtest.Assert(t, rec.Previous == nil, "first record has a predecessor")
+		} else {
+			rtest.Equals(t, ids[i-1], *rec.Previous)
+		}
+		rtest.Assert(t, !rec.Time.IsZero(), "time is not set")
+	}
+	rtest.Equals(t, oplog.OpKeyAdd, log.Head().Operation)
+}
+
+func TestLogAppend(t *testing.T) {
+	repo := repository.TestRepository(t)
+	appendRecords(t, repo, oplog.OpKeyAdd)
+
+	log, err := oplog.Load(context.TODO(), repo)
+	rtest.OK(t, err)
+	for _, op := range []string{oplog.OpForget, oplog.OpForget, oplog.OpPrune} {
+		_, err := log.Append(context.TODO(), repo, &oplog.Record{Operation: op})
+		rtest.OK(t, err)
+	}
+	rtest.Equals(t, 4, len(log.Records))
+	rtest.Equals(t, uint64(3), log.Head().Sequence)
+
+	loaded, err := oplog.Load(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 4, len(loaded.Records))
+	rtest.Equals(t, 0, len(loaded.Verify()))
+	rtest.Equals(t, log.Head().ID(), loaded.Head().ID())
+}
+
+func TestRemoved(t *testing.T) {
+	now := time.Now()
+	approval := restic.NewRandomID()
+	log := &oplog.Log{Records: []*oplog.Record{
+		{Operation: oplog.OpForget, Time: now.Add(-48 * time.Hour), Snapshots: restic.IDs{restic.NewRandomID()}},
+		{Operation: oplog.OpForget, Time: now.Add(-2 * time.Hour), Snapshots: restic.IDs{restic.NewRandomID(), restic.NewRandomID()}},
+		{Operation: oplog.OpForget, Time: now.Add(-time.Hour), Snapshots: restic.IDs{restic.NewRandomID()}, Approval: &approval},
+		{Operation: oplog.OpPrune, Time: now.Add(-time.Hour)},
+		{Operation: oplog.OpForget, Time: now, Snapshots: restic.IDs{restic.NewRandomID()}},
+		{Operation: oplog.OpRewrite, Time: now.Add(-time.Hour), Snapshots: restic.IDs{restic.NewRandomID()}},
+	}}
+
+	// approved removals are not counted
+	rtest.Equals(t, uint(4), log.Removed(now.Add(-24*time.Hour)))
+	rtest.Equals(t, uint(5), log.Removed(now.Add(-72*time.Hour)))
+	rtest.Equals(t, uint(0), log.Removed(now))
+}
+
+func TestVerify(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		modify func(t *testing.T, repo restic.Repository, ids []restic.ID)
+		err    string
+	}{
+		{
+			name: "removed",
+			modify: func(t *testing.T, repo restic.Repository, ids []restic.ID) {
+				rtest.OK(t, repo.RemoveUnpacked(context.TODO(), restic.WriteableOpLogFile, ids[1]))
+			},
+			err: "references missing record",
+		},
+		{
+			name: "removed-first",
+			modify: func(t *testing.T, repo restic.Repository, ids []restic.ID) {
+				rtest.OK(t, repo.RemoveUnpacked(context.TODO(), restic.WriteableOpLogFile, ids[0]))
+			},
+			err: "references missing record",
+		},
+		{
+			name: "forked",
+			modify: func(t *testing.T, repo restic.Repository, ids []restic.ID) {
+				prev := ids[0]
+				_, err := restic.SaveJSONUnpacked(context.TODO(), repo, restic.WriteableOpLogFile, &oplog.Record{
+					Sequence:  1,
+					Previous:  &prev,
+					Operation: oplog.OpForget,
+				})
+				rtest.OK(t, err)
+			},
+			err: "the history was forked",
+		},
+		{
+			name: "sequence",
+			modify: func(t *testing.T, repo restic.Repository, ids []restic.ID) {
+				prev := ids[2]
+				_, err := restic.SaveJSONUnpacked(context.TODO(), repo, restic.WriteableOpLogFile, &oplog.Record{
+					Sequence:  7,
+					Previous:  &prev,
+					Operation: oplog.OpForget,
+				})
+				rtest.OK(t, err)
+			},
+			err: "has sequence 7",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			repo := repository.TestRepository(t)
+			ids := appendRecords(t, repo, oplog.OpForget, oplog.OpPrune, oplog.OpKeyRemove)
+			test.modify(t, repo, ids)
+
+			log, err := oplog.Load(context.TODO(), repo)
+			rtest.OK(t, err)
+			errs := log.Verify()
+			rtest.Assert(t, len(errs) > 0, "expected verification errors")
+			found := false
+			for _, err := range errs {
+				found = found || strings.Contains(err.Error(), test.err)
+			}
+			rtest.Assert(t, found, "expected error containing %q, got %v", test.err, errs)
+		})
+	}
+}
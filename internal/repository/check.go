@@ -93,7 +93,7 @@ func checkPackInner(ctx context.Context, r *Repository, id restic.ID, blobs []re
 		hrd := hashing.NewReader(rd, sha256.New())
 		bufRd.Reset(hrd)
 
-		it := newPackBlobIterator(id, newBufReader(bufRd), 0, blobs, r.Key(), dec)
+		it := newPackBlobIterator(id, newBufReader(bufRd), 0, blobs, r.Key(), r.Config().BlobHash, dec)
 		for {
 			if ctx.Err() != nil {
 				return ctx.Err()
@@ -489,6 +489,12 @@ func (idx *Index) merge(idx2 *Index) error {
 
 // DecodeIndex unserializes an index from buf.
 func DecodeIndex(buf []byte, id restic.ID) (idx *Index, err error) {
+	return decodeIndex(buf, id, restic.InvalidBlob)
+}
+
+// decodeIndex unserializes an index from buf. If tpe is not InvalidBlob, only
+// the entries for blobs of that type are kept.
+func decodeIndex(buf []byte, id restic.ID, tpe restic.BlobType) (idx *Index, err error) {
 	debug.Log("Start decoding index")
 	idxJSON := &jsonIndex{}
 
@@ -503,6 +509,9 @@ func DecodeIndex(buf []byte, id restic.ID) (idx *Index, err error) {
 		packID := idx.addToPacks(pack.ID)
 
 		for _, blob := range pack.Blobs {
+			if tpe != restic.InvalidBlob && blob.Type != tpe {
+				continue
+			}
 			idx.store(packID, restic.Blob{
 				BlobHandle: restic.BlobHandle{
 					Type: blob.Type,
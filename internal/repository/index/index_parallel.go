@@ -13,6 +13,13 @@ import (
 // returns an error, this function is cancelled and also returns that error.
 func ForAllIndexes(ctx context.Context, lister restic.Lister, repo restic.LoaderUnpacked,
 	fn func(id restic.ID, index *Index, err error) error) error {
+	return forAllIndexes(ctx, lister, repo, restic.InvalidBlob, fn)
+}
+
+// forAllIndexes works like ForAllIndexes. If tpe is not InvalidBlob, then the
+// indexes only contain the entries for blobs of that type.
+func forAllIndexes(ctx context.Context, lister restic.Lister, repo restic.LoaderUnpacked, tpe restic.BlobType,
+	fn func(id restic.ID, index *Index, err error) error) error {
 
 	// decoding an index can take quite some time such that this can be both CPU- or IO-bound
 	// as the whole index is kept in memory anyways, a few workers too much don't matter
@@ -25,7 +32,7 @@ func ForAllIndexes(ctx context.Context, lister restic.Lister, repo restic.Loader
 
 		buf, err := repo.LoadUnpacked(ctx, restic.IndexFile, id)
 		if err == nil {
-			idx, err = DecodeIndex(buf, id)
+			idx, err = decodeIndex(buf, id, tpe)
 		}
 
 		m.Lock()
@@ -6,7 +6,9 @@ import (
 	"runtime"
 	"sync"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui/progress"
 	"golang.org/x/sync/errgroup"
@@ -266,6 +268,17 @@ func (mi *MasterIndex) MergeFinalIndexes() error {
 }
 
 func (mi *MasterIndex) Load(ctx context.Context, r restic.ListerLoaderUnpacked, p *progress.Counter, cb func(id restic.ID, idx *Index, err error) error) error {
+	return mi.load(ctx, r, p, restic.InvalidBlob, cb)
+}
+
+// LoadType loads all index files like Load, but only keeps the entries for
+// blobs of type tpe. Blobs of other types cannot be found afterwards unless
+// they are loaded by another call to LoadType.
+func (mi *MasterIndex) LoadType(ctx context.Context, r restic.ListerLoaderUnpacked, p *progress.Counter, tpe restic.BlobType) error {
+	return mi.load(ctx, r, p, tpe, nil)
+}
+
+func (mi *MasterIndex) load(ctx context.Context, r restic.ListerLoaderUnpacked, p *progress.Counter, tpe restic.BlobType, cb func(id restic.ID, idx *Index, err error) error) error {
 	indexList, err := restic.MemorizeList(ctx, r, restic.IndexFile)
 	if err != nil {
 		return err
@@ -284,7 +297,7 @@ func (mi *MasterIndex) Load(ctx context.Context, r restic.ListerLoaderUnpacked,
 		defer p.Done()
 	}
 
-	err = ForAllIndexes(ctx, indexList, r, func(id restic.ID, idx *Index, err error) error {
+	err = forAllIndexes(ctx, indexList, r, tpe, func(id restic.ID, idx *Index, err error) error {
 		if p != nil {
 			p.Add(1)
 		}
@@ -319,6 +332,8 @@ type MasterIndexRewriteOpts struct {
 // It also removes the rewritten index files and those listed in extraObsolete.
 // If oldIndexes is not nil, then only the indexes in this set are processed.
 // This is used by repair index to only rewrite and delete the old indexes.
+// If some of the old index files are protected against deletion, the others
+// are still removed and an error wrapping backend.ErrImmutable is returned.
 //
 // Must not be called concurrently to any other MasterIndex operation.
 func (mi *MasterIndex) Rewrite(ctx context.Context, repo restic.Unpacked[restic.FileType], excludePacks restic.IDSet, oldIndexes restic.IDSet, extraObsolete restic.IDs, opts MasterIndexRewriteOpts) error {
@@ -486,12 +501,24 @@ func (mi *MasterIndex) Rewrite(ctx context.Context, repo restic.Unpacked[restic.
 		p = opts.DeleteProgress()
 	}
 	defer p.Done()
-	return restic.ParallelRemove(ctx, repo, obsolete, restic.IndexFile, func(id restic.ID, err error) error {
+	var m sync.Mutex
+	protected := 0
+	err = restic.ParallelRemove(ctx, repo, obsolete, restic.IndexFile, func(id restic.ID, err error) error {
 		if opts.DeleteReport != nil {
 			opts.DeleteReport(id, err)
 		}
+		if errors.Is(err, backend.ErrImmutable) {
+			m.Lock()
+			protected++
+			m.Unlock()
+			return nil
+		}
 		return err
 	}, p)
+	if err == nil && protected > 0 {
+		err = fmt.Errorf("%d old index files were not removed: %w", protected, backend.ErrImmutable)
+	}
+	return err
 }
 
 // SaveFallback saves all known indexes to index files, leaving out any
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"os/user"
 	"time"
@@ -22,20 +23,64 @@ var (
 
 	// ErrMaxKeysReached is returned when the maximum number of keys was checked and no key could be found.
 	ErrMaxKeysReached = errors.New("maximum number of keys reached")
+
+	// ErrNotFIPS is returned in FIPS mode when a repository or key uses
+	// algorithms which are not approved by FIPS 140.
+	ErrNotFIPS = errors.New("repository does not use FIPS 140 approved cryptography")
+)
+
+// Supported key derivation functions.
+const (
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+	kdfPBKDF2   = "pbkdf2-sha256"
 )
 
+// KDFOptions select the key derivation function used for new keys.
+type KDFOptions struct {
+	// KDF is either KDFScrypt or KDFArgon2id, an empty value selects scrypt
+	// with calibrated parameters.
+	KDF string
+	// Argon2 are the parameters used with KDFArgon2id.
+	Argon2 crypto.Argon2Params
+}
+
+// Check returns an error if the options are invalid.
+func (opts KDFOptions) Check() error {
+	switch opts.KDF {
+	case "", KDFScrypt:
+		return nil
+	case KDFArgon2id:
+		return opts.Argon2.Check()
+	default:
+		return errors.Errorf("unsupported KDF %q", opts.KDF)
+	}
+}
+
 // Key represents an encrypted master key for a repository.
 type Key struct {
 	Created  time.Time `json:"created"`
 	Username string    `json:"username"`
 	Hostname string    `json:"hostname"`
 
-	KDF  string `json:"kdf"`
-	N    int    `json:"N"`
-	R    int    `json:"r"`
-	P    int    `json:"p"`
-	Salt []byte `json:"salt"`
-	Data []byte `json:"data"`
+	KDF string `json:"kdf"`
+	N   int    `json:"N,omitempty"`
+	R   int    `json:"r,omitempty"`
+	P   int    `json:"p,omitempty"`
+	// Iterations is the number of iterations for PBKDF2 or the number of
+	// passes over the memory for Argon2id.
+	Iterations int `json:"iterations,omitempty"`
+	// Memory is the memory size in KiB and Threads the degree of parallelism
+	// for Argon2id.
+	Memory  int    `json:"memory,omitempty"`
+	Threads int    `json:"threads,omitempty"`
+	Salt    []byte `json:"salt"`
+	Data    []byte `json:"data"`
+
+	// Token holds the secret protecting this key, wrapped by a hardware token
+	// such as a PKCS#11 device or a smart card. It is empty for keys which are
+	// protected by a password.
+	Token []byte `json:"token,omitempty"`
 
 	user   *crypto.Key
 	master *crypto.Key
@@ -47,6 +92,9 @@ type Key struct {
 // calibrated on the first run of AddKey().
 var params *crypto.Params
 
+// pbkdf2Iterations is the number of iterations used for new PBKDF2 keys.
+var pbkdf2Iterations = crypto.DefaultPBKDF2Iterations
+
 const (
 	// KDFTimeout specifies the maximum runtime for the KDF.
 	KDFTimeout = 500 * time.Millisecond
@@ -55,10 +103,34 @@ const (
 	KDFMemory = 60
 )
 
-// createMasterKey creates a new master key in the given backend and encrypts
-// it with the password.
-func createMasterKey(ctx context.Context, s *Repository, password string) (*Key, error) {
-	return AddKey(ctx, s, password, "", "", nil)
+// KDFParams returns the scrypt parameters used for new keys. The parameters
+// are calibrated on the first call.
+func KDFParams() (crypto.Params, error) {
+	if params == nil {
+		p, err := crypto.Calibrate(KDFTimeout, KDFMemory)
+		if err != nil {
+			return crypto.Params{}, errors.Wrap(err, "Calibrate")
+		}
+
+		params = &p
+		debug.Log("calibrated KDF parameters are %v", p)
+	}
+	return *params, nil
+}
+
+// KeyUnwrapFunc recovers the secret of a token-protected key from the data
+// which was wrapped by the token when the key was created.
+type KeyUnwrapFunc func(ctx context.Context, wrapped []byte) (string, error)
+
+// createMasterKey creates a new master key for the config cfg in the given
+// backend and encrypts it with the password.
+func createMasterKey(ctx context.Context, s *Repository, password string, cfg restic.Config) (*Key, error) {
+	master := crypto.NewRandomKey()
+	master.Cipher = cfg.Cipher
+	// the config of new repositories is always signed
+	master.SignedConfig = true
+	master.ConfigRevision = cfg.Revision
+	return AddKey(ctx, s, password, "", "", master)
 }
 
 // OpenKey tries do decrypt the key specified by name with the given password.
@@ -69,27 +141,75 @@ func OpenKey(ctx context.Context, s *Repository, id restic.ID, password string)
 		return nil, err
 	}
 
-	// check KDF
-	if k.KDF != "scrypt" {
-		return nil, errors.New("only supported KDF is scrypt()")
+	if s.opts.FIPS && k.KDF != kdfPBKDF2 {
+		return nil, ErrNotFIPS
 	}
 
+	err = k.open(id, password)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// OpenTokenKey tries to decrypt the key specified by id. The secret protecting
+// the key is recovered from the token-wrapped data using unwrap. For keys
+// without token data, crypto.ErrUnauthenticated is returned.
+func OpenTokenKey(ctx context.Context, s *Repository, id restic.ID, unwrap KeyUnwrapFunc) (*Key, error) {
+	k, err := LoadKey(ctx, s, id)
+	if err != nil {
+		debug.Log("LoadKey(%v) returned error %v", id.String(), err)
+		return nil, err
+	}
+
+	if len(k.Token) == 0 {
+		return nil, crypto.ErrUnauthenticated
+	}
+
+	if s.opts.FIPS && k.KDF != kdfPBKDF2 {
+		return nil, ErrNotFIPS
+	}
+
+	secret, err := unwrap(ctx, k.Token)
+	if err != nil {
+		return nil, errors.Wrap(err, "unwrap")
+	}
+
+	err = k.open(id, secret)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// open derives the user key from password and decrypts the master key.
+func (k *Key) open(id restic.ID, password string) error {
 	// derive user key
-	params := crypto.Params{
-		N: k.N,
-		R: k.R,
-		P: k.P,
+	var err error
+	switch k.KDF {
+	case KDFScrypt:
+		params := crypto.Params{
+			N: k.N,
+			R: k.R,
+			P: k.P,
+		}
+		k.user, err = crypto.KDF(params, k.Salt, password)
+	case kdfPBKDF2:
+		k.user, err = crypto.PBKDF2(k.Iterations, k.Salt, password)
+	case KDFArgon2id:
+		k.user, err = crypto.Argon2id(k.argon2Params(), k.Salt, password)
+	default:
+		return errors.Errorf("unsupported KDF %q", k.KDF)
 	}
-	k.user, err = crypto.KDF(params, k.Salt, password)
 	if err != nil {
-		return nil, errors.Wrap(err, "crypto.KDF")
+		return errors.Wrap(err, "crypto.KDF")
 	}
 
 	// decrypt master keys
 	nonce, ciphertext := k.Data[:k.user.NonceSize()], k.Data[k.user.NonceSize():]
 	buf, err := k.user.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// restore json
@@ -97,15 +217,31 @@ func OpenKey(ctx context.Context, s *Repository, id restic.ID, password string)
 	err = json.Unmarshal(buf, k.master)
 	if err != nil {
 		debug.Log("Unmarshal() returned error %v", err)
-		return nil, errors.Wrap(err, "Unmarshal")
+		return errors.Wrap(err, "Unmarshal")
 	}
 	k.id = id
 
 	if !k.Valid() {
-		return nil, errors.New("Invalid key for repository")
+		return errors.New("Invalid key for repository")
 	}
 
-	return k, nil
+	return nil
+}
+
+// argon2Params returns the Argon2id parameters of the key. Values which are out
+// of range are replaced by zero, which is rejected by crypto.Argon2id.
+func (k *Key) argon2Params() crypto.Argon2Params {
+	var p crypto.Argon2Params
+	if k.Iterations > 0 && k.Iterations <= math.MaxUint32 {
+		p.Time = uint32(k.Iterations)
+	}
+	if k.Memory > 0 && k.Memory <= math.MaxUint32 {
+		p.Memory = uint32(k.Memory)
+	}
+	if k.Threads > 0 && k.Threads <= math.MaxUint8 {
+		p.Threads = uint8(k.Threads)
+	}
+	return p
 }
 
 // SearchKey tries to decrypt at most maxKeys keys in the backend with the
@@ -113,13 +249,27 @@ func OpenKey(ctx context.Context, s *Repository, id restic.ID, password string)
 // maxKeys is reached, ErrMaxKeysReached is returned. When setting maxKeys to
 // zero, all keys in the repo are checked.
 func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int, keyHint string) (k *Key, err error) {
+	return searchKey(ctx, s, maxKeys, keyHint, func(ctx context.Context, id restic.ID) (*Key, error) {
+		return OpenKey(ctx, s, id, password)
+	})
+}
+
+// SearchTokenKey works like SearchKey, but only considers keys protected by a
+// hardware token. The secret for each of these keys is recovered using unwrap.
+func SearchTokenKey(ctx context.Context, s *Repository, unwrap KeyUnwrapFunc, maxKeys int, keyHint string) (k *Key, err error) {
+	return searchKey(ctx, s, maxKeys, keyHint, func(ctx context.Context, id restic.ID) (*Key, error) {
+		return OpenTokenKey(ctx, s, id, unwrap)
+	})
+}
+
+func searchKey(ctx context.Context, s *Repository, maxKeys int, keyHint string, openKey func(ctx context.Context, id restic.ID) (*Key, error)) (k *Key, err error) {
 	checked := 0
 
 	if len(keyHint) > 0 {
 		id, err := restic.Find(ctx, s, restic.KeyFile, keyHint)
 
 		if err == nil {
-			key, err := OpenKey(ctx, s, id, password)
+			key, err := openKey(ctx, id)
 
 			if err == nil {
 				debug.Log("successfully opened hinted key %v", id)
@@ -143,7 +293,7 @@ func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int,
 		}
 
 		debug.Log("trying key %q", id.String())
-		key, err := OpenKey(ctx, s, id, password)
+		key, err := openKey(ctx, id)
 		if err != nil {
 			debug.Log("key %v returned error %v", id.String(), err)
 
@@ -194,15 +344,41 @@ func LoadKey(ctx context.Context, s *Repository, id restic.ID) (k *Key, err erro
 
 // AddKey adds a new key to an already existing repository.
 func AddKey(ctx context.Context, s *Repository, password, username, hostname string, template *crypto.Key) (*Key, error) {
+	return addKey(ctx, s, password, nil, username, hostname, template)
+}
+
+// AddTokenKey adds a new key which is protected by a hardware token. The key
+// is encrypted using secret, token must contain the secret wrapped by the
+// token. It is stored alongside the key and passed to the KeyUnwrapFunc when
+// opening the key.
+func AddTokenKey(ctx context.Context, s *Repository, secret string, token []byte, username, hostname string, template *crypto.Key) (*Key, error) {
+	if len(token) == 0 {
+		return nil, errors.New("token data is empty")
+	}
+	return addKey(ctx, s, secret, token, username, hostname, template)
+}
+
+func addKey(ctx context.Context, s *Repository, password string, token []byte, username, hostname string, template *crypto.Key) (*Key, error) {
+	// keys for master keys using AES-GCM are derived using PBKDF2, such that
+	// all algorithms are approved by FIPS 140
+	fips := template != nil && template.Cipher == crypto.CipherAES256GCM
+
+	kdf := s.opts.KDF
+	if err := kdf.Check(); err != nil {
+		return nil, err
+	}
+	if kdf.KDF == "" {
+		kdf.KDF = KDFScrypt
+	}
+	if fips && kdf.KDF != KDFScrypt {
+		return nil, errors.Errorf("KDF %v is not approved in FIPS mode", kdf.KDF)
+	}
+
 	// make sure we have valid KDF parameters
-	if params == nil {
-		p, err := crypto.Calibrate(KDFTimeout, KDFMemory)
-		if err != nil {
-			return nil, errors.Wrap(err, "Calibrate")
+	if !fips && kdf.KDF == KDFScrypt {
+		if _, err := KDFParams(); err != nil {
+			return nil, err
 		}
-
-		params = &p
-		debug.Log("calibrated KDF parameters are %v", p)
 	}
 
 	// fill meta data about key
@@ -211,10 +387,22 @@ func AddKey(ctx context.Context, s *Repository, password, username, hostname str
 		Username: username,
 		Hostname: hostname,
 
-		KDF: "scrypt",
-		N:   params.N,
-		R:   params.R,
-		P:   params.P,
+		Token: token,
+	}
+	switch {
+	case fips:
+		newkey.KDF = kdfPBKDF2
+		newkey.Iterations = pbkdf2Iterations
+	case kdf.KDF == KDFArgon2id:
+		newkey.KDF = KDFArgon2id
+		newkey.Iterations = int(kdf.Argon2.Time)
+		newkey.Memory = int(kdf.Argon2.Memory)
+		newkey.Threads = int(kdf.Argon2.Threads)
+	default:
+		newkey.KDF = KDFScrypt
+		newkey.N = params.N
+		newkey.R = params.R
+		newkey.P = params.P
 	}
 
 	if newkey.Hostname == "" {
@@ -236,7 +424,14 @@ func AddKey(ctx context.Context, s *Repository, password, username, hostname str
 	}
 
 	// call KDF to derive user key
-	newkey.user, err = crypto.KDF(*params, newkey.Salt, password)
+	switch newkey.KDF {
+	case kdfPBKDF2:
+		newkey.user, err = crypto.PBKDF2(newkey.Iterations, newkey.Salt, password)
+	case KDFArgon2id:
+		newkey.user, err = crypto.Argon2id(kdf.Argon2, newkey.Salt, password)
+	default:
+		newkey.user, err = crypto.KDF(*params, newkey.Salt, password)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -249,22 +444,32 @@ func AddKey(ctx context.Context, s *Repository, password, username, hostname str
 		newkey.master = template
 	}
 
+	err = saveKey(ctx, s, newkey)
+	if err != nil {
+		return nil, err
+	}
+	return newkey, nil
+}
+
+// saveKey encrypts the master key of k with the user key and stores k as new
+// key file.
+func saveKey(ctx context.Context, s *Repository, k *Key) error {
 	// encrypt master keys (as json) with user key
-	buf, err := json.Marshal(newkey.master)
+	buf, err := json.Marshal(k.master)
 	if err != nil {
-		return nil, errors.Wrap(err, "Marshal")
+		return errors.Wrap(err, "Marshal")
 	}
 
 	nonce := crypto.NewRandomNonce()
 	ciphertext := make([]byte, 0, crypto.CiphertextLength(len(buf)))
 	ciphertext = append(ciphertext, nonce...)
-	ciphertext = newkey.user.Seal(ciphertext, nonce, buf, nil)
-	newkey.Data = ciphertext
+	ciphertext = k.user.Seal(ciphertext, nonce, buf, nil)
+	k.Data = ciphertext
 
 	// dump as json
-	buf, err = json.Marshal(newkey)
+	buf, err = json.Marshal(k)
 	if err != nil {
-		return nil, errors.Wrap(err, "Marshal")
+		return errors.Wrap(err, "Marshal")
 	}
 
 	id := restic.Hash(buf)
@@ -276,12 +481,28 @@ func AddKey(ctx context.Context, s *Repository, password, username, hostname str
 
 	err = s.be.Save(ctx, h, backend.NewByteReader(buf, s.be.Hasher()))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	newkey.id = id
+	k.id = id
+	return nil
+}
 
-	return newkey, nil
+// replaceMasterKey stores the master key master in a new key file which is
+// protected by the same password as k and removes the key file of k.
+func replaceMasterKey(ctx context.Context, s *Repository, k *Key, master *crypto.Key) (*Key, error) {
+	newkey := *k
+	newkey.master = master
+	err := saveKey(ctx, s, &newkey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.be.Remove(ctx, backend.Handle{Type: restic.KeyFile, Name: k.ID().String()})
+	if err != nil {
+		return nil, err
+	}
+	return &newkey, nil
 }
 
 func RemoveKey(ctx context.Context, repo *Repository, id restic.ID) error {
@@ -0,0 +1,85 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestTokenKey(t *testing.T) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, restic.StableRepoVersion)
+
+	// a trivial "token" which wraps the secret by reversing it
+	wrapped := []byte("terces")
+	unwrap := func(_ context.Context, data []byte) (string, error) {
+		if !bytes.Equal(data, wrapped) {
+			return "", errors.New("unexpected token data")
+		}
+		return "secret", nil
+	}
+
+	key, err := repository.AddTokenKey(context.TODO(), repo, "secret", wrapped, "user", "host", repo.Key())
+	rtest.OK(t, err)
+
+	repo2, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo2.SearchTokenKey(context.TODO(), unwrap, 0, ""))
+	rtest.Equals(t, key.ID(), repo2.KeyID())
+	rtest.Equals(t, repo.Config().ID, repo2.Config().ID)
+
+	// the secret must also work as a regular password
+	repo3, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo3.SearchKey(context.TODO(), "secret", 0, key.ID().String()))
+	rtest.Equals(t, key.ID(), repo3.KeyID())
+}
+
+func TestTokenKeyIgnoresPasswordKeys(t *testing.T) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, restic.StableRepoVersion)
+
+	unwrap := func(_ context.Context, _ []byte) (string, error) {
+		t.Fatal("unwrap must not be called for keys without token data")
+		return "", nil
+	}
+
+	repo2, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	err = repo2.SearchTokenKey(context.TODO(), unwrap, 0, repo.KeyID().String())
+	rtest.Assert(t, errors.Is(err, repository.ErrNoKeyFound), "expected ErrNoKeyFound, got %v", err)
+
+	_, err = repository.AddTokenKey(context.TODO(), repo, "secret", nil, "", "", repo.Key())
+	rtest.Assert(t, err != nil, "expected error for empty token data")
+}
+
+func TestArgon2idKey(t *testing.T) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, restic.StableRepoVersion)
+
+	repo.SetKDFOptions(repository.KDFOptions{
+		KDF:    repository.KDFArgon2id,
+		Argon2: crypto.Argon2Params{Time: 1, Memory: 64, Threads: 2},
+	})
+	key, err := repository.AddKey(context.TODO(), repo, "other", "user", "host", repo.Key())
+	rtest.OK(t, err)
+	rtest.Equals(t, repository.KDFArgon2id, key.KDF)
+	rtest.Equals(t, 1, key.Iterations)
+	rtest.Equals(t, 64, key.Memory)
+	rtest.Equals(t, 2, key.Threads)
+
+	repo2, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo2.SearchKey(context.TODO(), "other", 0, ""))
+	rtest.Equals(t, key.ID(), repo2.KeyID())
+
+	repo.SetKDFOptions(repository.KDFOptions{
+		KDF:    repository.KDFArgon2id,
+		Argon2: crypto.Argon2Params{Time: 0, Memory: 64, Threads: 1},
+	})
+	_, err = repository.AddKey(context.TODO(), repo, "invalid", "", "", repo.Key())
+	rtest.Assert(t, err != nil, "expected error for invalid parameters")
+}
@@ -293,6 +293,11 @@ func RemoveStaleLocks(ctx context.Context, repo *Repository) (uint, error) {
 	return processed, err
 }
 
+// RemoveLock removes the lock file with the given id.
+func RemoveLock(ctx context.Context, repo *Repository, id restic.ID) error {
+	return (&internalRepository{repo}).RemoveUnpacked(ctx, restic.LockFile, id)
+}
+
 // RemoveAllLocks removes all locks forcefully.
 func RemoveAllLocks(ctx context.Context, repo *Repository) (uint, error) {
 	var processed uint32
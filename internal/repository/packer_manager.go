@@ -130,23 +130,31 @@ func (r *packerManager) newPacker() (pck *packer, err error) {
 	return pck, nil
 }
 
-// savePacker stores p in the backend.
-func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *packer) error {
-	debug.Log("save packer for %v with %d blobs (%d bytes)\n", t, p.Packer.Count(), p.Packer.Size())
+// preparedPacker is a finalized pack which is ready for upload.
+type preparedPacker struct {
+	*packer
+	tpe    restic.BlobType
+	id     restic.ID
+	beHash []byte
+}
+
+// preparePacker finalizes p and calculates the hashes required for the upload.
+func (r *Repository) preparePacker(t restic.BlobType, p *packer) (*preparedPacker, error) {
+	debug.Log("prepare packer for %v with %d blobs (%d bytes)\n", t, p.Packer.Count(), p.Packer.Size())
 	err := p.Packer.Finalize()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = p.bufWr.Flush()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// calculate sha256 hash in a second pass
 	var rd io.Reader
 	rd, err = backend.NewFileReader(p.tmpfile, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	beHasher := r.be.Hasher()
 	var beHr *hashing.Reader
@@ -158,16 +166,24 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *packe
 	hr := hashing.NewReader(rd, sha256.New())
 	_, err = io.Copy(io.Discard, hr)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	id := restic.IDFromHash(hr.Sum(nil))
-	h := backend.Handle{Type: backend.PackFile, Name: id.String(), IsMetadata: t.IsMetadata()}
-	var beHash []byte
+	pp := &preparedPacker{
+		packer: p,
+		tpe:    t,
+		id:     restic.IDFromHash(hr.Sum(nil)),
+	}
 	if beHr != nil {
-		beHash = beHr.Sum(nil)
+		pp.beHash = beHr.Sum(nil)
 	}
-	rrd, err := backend.NewFileReader(p.tmpfile, beHash)
+	return pp, nil
+}
+
+// uploadPacker stores the prepared pack p in the backend.
+func (r *Repository) uploadPacker(ctx context.Context, p *preparedPacker) error {
+	h := backend.Handle{Type: backend.PackFile, Name: p.id.String(), IsMetadata: p.tpe.IsMetadata()}
+	rrd, err := backend.NewFileReader(p.tmpfile, p.beHash)
 	if err != nil {
 		return err
 	}
@@ -186,8 +202,8 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *packe
 	}
 
 	// update blobs in the index
-	debug.Log("  updating blobs %v to pack %v", p.Packer.Blobs(), id)
-	r.idx.StorePack(id, p.Packer.Blobs())
+	debug.Log("  updating blobs %v to pack %v", p.Packer.Blobs(), p.id)
+	r.idx.StorePack(p.id, p.Packer.Blobs())
 
 	// Save index if full
 	return r.idx.SaveFullIndex(ctx, &internalRepository{r})
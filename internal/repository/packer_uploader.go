@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"sync"
 
 	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sync/errgroup"
@@ -9,7 +10,8 @@ import (
 
 // savePacker implements saving a pack in the repository.
 type savePacker interface {
-	savePacker(ctx context.Context, t restic.BlobType, p *packer) error
+	preparePacker(t restic.BlobType, p *packer) (*preparedPacker, error)
+	uploadPacker(ctx context.Context, p *preparedPacker) error
 }
 
 type uploadTask struct {
@@ -17,6 +19,11 @@ type uploadTask struct {
 	tpe    restic.BlobType
 }
 
+// packerUploader saves packs in two stages. The preparation stage finalizes
+// the packs and calculates their hashes, while the upload stage sends them to
+// the backend. This allows preparing the next packs while the previous ones
+// are still uploading. Each stage uses one worker per backend connection,
+// such that at most twice as many packs as connections are in flight.
 type packerUploader struct {
 	uploadQueue chan uploadTask
 }
@@ -25,16 +32,51 @@ func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo savePacker,
 	pu := &packerUploader{
 		uploadQueue: make(chan uploadTask),
 	}
+	preparedQueue := make(chan *preparedPacker)
 
+	var preparers sync.WaitGroup
+	preparers.Add(int(connections))
 	for i := 0; i < int(connections); i++ {
 		wg.Go(func() error {
+			defer preparers.Done()
 			for {
 				select {
 				case t, ok := <-pu.uploadQueue:
 					if !ok {
 						return nil
 					}
-					err := repo.savePacker(ctx, t.tpe, t.packer)
+					p, err := repo.preparePacker(t.tpe, t.packer)
+					if err != nil {
+						return err
+					}
+					select {
+					case preparedQueue <- p:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		})
+	}
+
+	wg.Go(func() error {
+		// the uploaders finish once all prepared packs are passed on
+		preparers.Wait()
+		close(preparedQueue)
+		return nil
+	})
+
+	for i := 0; i < int(connections); i++ {
+		wg.Go(func() error {
+			for {
+				select {
+				case p, ok := <-preparedQueue:
+					if !ok {
+						return nil
+					}
+					err := repo.uploadPacker(ctx, p)
 					if err != nil {
 						return err
 					}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
+)
+
+type blockingSavePacker struct {
+	prepared chan *packer
+	uploaded chan *packer
+	unblock  chan struct{}
+}
+
+func (s *blockingSavePacker) preparePacker(t restic.BlobType, p *packer) (*preparedPacker, error) {
+	s.prepared <- p
+	return &preparedPacker{packer: p, tpe: t}, nil
+}
+
+func (s *blockingSavePacker) uploadPacker(_ context.Context, p *preparedPacker) error {
+	<-s.unblock
+	s.uploaded <- p.packer
+	return nil
+}
+
+func TestPackerUploaderPipelined(t *testing.T) {
+	s := &blockingSavePacker{
+		prepared: make(chan *packer, 10),
+		uploaded: make(chan *packer, 10),
+		unblock:  make(chan struct{}),
+	}
+
+	wg, ctx := errgroup.WithContext(context.Background())
+	pu := newPackerUploader(ctx, wg, s, 1)
+
+	packers := []*packer{{}, {}, {}}
+	for _, p := range packers[:2] {
+		test.OK(t, pu.QueuePacker(ctx, restic.DataBlob, p))
+	}
+
+	// the second pack must be prepared while the first one is still uploading
+	for _, p := range packers[:2] {
+		select {
+		case prepared := <-s.prepared:
+			test.Assert(t, prepared == p, "packs prepared in unexpected order")
+		case <-time.After(5 * time.Second):
+			t.Fatal("pack was not prepared while the upload was blocked")
+		}
+	}
+
+	// both stages are busy, thus the third pack cannot be queued yet
+	queued := make(chan error, 1)
+	go func() {
+		queued <- pu.QueuePacker(ctx, restic.DataBlob, packers[2])
+	}()
+	select {
+	case <-queued:
+		t.Fatal("pack was queued although all workers are busy")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(s.unblock)
+	test.OK(t, <-queued)
+	pu.TriggerShutdown()
+	test.OK(t, wg.Wait())
+
+	close(s.uploaded)
+	var uploaded []*packer
+	for p := range s.uploaded {
+		uploaded = append(uploaded, p)
+	}
+	test.Equals(t, packers, uploaded)
+}
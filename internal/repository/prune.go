@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"sync/atomic"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository/index"
 	"github.com/restic/restic/internal/repository/pack"
@@ -595,7 +597,12 @@ func (plan *PrunePlan) Execute(ctx context.Context, printer progress.Printer) er
 		}
 	} else if len(plan.ignorePacks) != 0 {
 		err := rewriteIndexFiles(ctx, repo, plan.ignorePacks, nil, nil, printer)
-		if err != nil {
+		if errors.Is(err, backend.ErrImmutable) {
+			// the remaining old index files still reference the packs, removing
+			// them would leave the index pointing to missing packs
+			printer.P("%v, keeping %d old packs\n", err, len(plan.removePacks))
+			plan.removePacks = nil
+		} else if err != nil {
 			return errors.Fatalf("%s", err)
 		}
 	}
@@ -624,11 +631,17 @@ func (plan *PrunePlan) Execute(ctx context.Context, printer progress.Printer) er
 
 // deleteFiles deletes the given fileList of fileType in parallel
 // if ignoreError=true, it will print a warning if there was an error, else it will abort.
+// Files which are protected against deletion are reported and skipped if ignoreError=true.
 func deleteFiles(ctx context.Context, ignoreError bool, repo restic.RemoverUnpacked[restic.FileType], fileList restic.IDSet, fileType restic.FileType, printer progress.Printer) error {
 	bar := printer.NewCounter("files deleted")
-	defer bar.Done()
 
-	return restic.ParallelRemove(ctx, repo, fileList, fileType, func(id restic.ID, err error) error {
+	var protected atomic.Uint64
+	err := restic.ParallelRemove(ctx, repo, fileList, fileType, func(id restic.ID, err error) error {
+		if ignoreError && errors.Is(err, backend.ErrImmutable) {
+			printer.V("%v/%v is protected against deletion\n", fileType, id)
+			protected.Add(1)
+			return nil
+		}
 		if err != nil {
 			printer.E("unable to remove %v/%v from the repository\n", fileType, id)
 			if !ignoreError {
@@ -638,4 +651,10 @@ func deleteFiles(ctx context.Context, ignoreError bool, repo restic.RemoverUnpac
 		printer.VV("removed %v/%v\n", fileType, id)
 		return nil
 	}, bar)
+	bar.Done()
+
+	if n := protected.Load(); n > 0 {
+		printer.P("%d %v files are protected against deletion and were kept\n", n, fileType)
+	}
+	return err
 }
@@ -2,11 +2,14 @@ package repository_test
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"math/rand"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/mem"
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -191,3 +194,55 @@ func TestPruneMaxUnusedDuplicate(t *testing.T) {
 	rtest.Equals(t, rsize.Unref, uint64(0))
 	rtest.Equals(t, rsize.Uncompressed, uint64(0))
 }
+
+// immutableBackend refuses to remove files of the given type.
+type immutableBackend struct {
+	backend.Backend
+	immutable backend.FileType
+}
+
+func (be *immutableBackend) Remove(ctx context.Context, h backend.Handle) error {
+	if h.Type == be.immutable {
+		return fmt.Errorf("%v: %w", h, backend.ErrImmutable)
+	}
+	return be.Backend.Remove(ctx, h)
+}
+
+func TestPruneImmutable(t *testing.T) {
+	for _, tpe := range []backend.FileType{backend.PackFile, backend.IndexFile} {
+		t.Run(tpe.String(), func(t *testing.T) {
+			seed := time.Now().UnixNano()
+			random := rand.New(rand.NewSource(seed))
+			t.Logf("rand initialized with seed %d", seed)
+
+			be := &immutableBackend{Backend: mem.New(), immutable: tpe}
+			repo, _ := repository.TestRepositoryWithBackend(t, be, 0, repository.Options{})
+			createRandomBlobs(t, random, repo, 4, 0.5, true)
+			createRandomBlobs(t, random, repo, 5, 0.5, true)
+			keep, _ := selectBlobs(t, random, repo, 0.5)
+			packs := listPacks(t, repo)
+
+			plan, err := repository.PlanPrune(context.TODO(), repository.PruneOptions{
+				MaxRepackBytes: math.MaxUint64,
+				MaxUnusedBytes: func(used uint64) (unused uint64) { return 0 },
+			}, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+				for blob := range keep {
+					usedBlobs.Insert(blob)
+				}
+				return nil
+			}, &progress.NoopPrinter{})
+			rtest.OK(t, err)
+			rtest.OK(t, plan.Execute(context.TODO(), &progress.NoopPrinter{}))
+
+			// all packs must still exist, either because they cannot be
+			// removed or because they are still referenced by an old index
+			repo = repository.TestOpenBackend(t, be)
+			removed := packs.Sub(listPacks(t, repo))
+			rtest.Assert(t, len(removed) == 0, "protected packs were removed: %v", removed)
+			rtest.OK(t, repo.LoadIndex(context.TODO(), nil))
+			for blob := range keep {
+				rtest.Assert(t, len(repo.LookupBlob(blob.Type, blob.ID)) > 0, "blob %v missing from index", blob)
+			}
+		})
+	}
+}
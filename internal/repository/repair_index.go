@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository/index"
 	"github.com/restic/restic/internal/repository/pack"
 	"github.com/restic/restic/internal/restic"
@@ -129,7 +131,9 @@ func rewriteIndexFiles(ctx context.Context, repo *Repository, removePacks restic
 			return printer.NewCounter("old indexes deleted")
 		},
 		DeleteReport: func(id restic.ID, err error) {
-			if err != nil {
+			if errors.Is(err, backend.ErrImmutable) {
+				printer.V("index %v is protected against deletion\n", id.String())
+			} else if err != nil {
 				printer.VV("failed to remove index %v: %v\n", id.String(), err)
 			} else {
 				printer.VV("removed index %v\n", id.String())
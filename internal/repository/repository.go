@@ -8,6 +8,7 @@ import (
 	"math"
 	"os"
 	"runtime"
+	"slices"
 	"sort"
 	"sync"
 
@@ -37,8 +38,13 @@ type Repository struct {
 	cfg   restic.Config
 	key   *crypto.Key
 	keyID restic.ID
-	idx   *index.MasterIndex
-	cache *cache.Cache
+	// keyFile is the key file used to open the repository
+	keyFile *Key
+	idx     *index.MasterIndex
+	cache   *cache.Cache
+
+	// lazyIdx is set if the index is loaded on demand
+	lazyIdx *lazyIndex
 
 	opts Options
 
@@ -62,6 +68,12 @@ type Options struct {
 	Compression   CompressionMode
 	PackSize      uint
 	NoExtraVerify bool
+	// FIPS restricts the cryptography to algorithms approved by FIPS 140. New
+	// repositories use AES-256-GCM and keys derived with PBKDF2, repositories
+	// and keys using other algorithms cannot be opened.
+	FIPS bool
+	// KDF selects the key derivation function for new keys.
+	KDF KDFOptions
 }
 
 // CompressionMode configures if data should be compressed.
@@ -138,6 +150,11 @@ func (r *Repository) setConfig(cfg restic.Config) {
 	r.cfg = cfg
 }
 
+// SetKDFOptions selects the key derivation function for keys added later on.
+func (r *Repository) SetKDFOptions(opts KDFOptions) {
+	r.opts.KDF = opts
+}
+
 // Config returns the repository configuration.
 func (r *Repository) Config() restic.Config {
 	return r.cfg
@@ -226,6 +243,10 @@ func sortCachedPacksFirst(cache haver, blobs []restic.PackedBlob) {
 func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
 	debug.Log("load %v with id %v (buf len %v, cap %d)", t, id, len(buf), cap(buf))
 
+	if err := r.ensureIndex(ctx, t); err != nil {
+		return nil, err
+	}
+
 	// lookup packs
 	blobs := r.idx.Lookup(restic.BlobHandle{ID: id, Type: t})
 	if len(blobs) == 0 {
@@ -272,7 +293,7 @@ func (r *Repository) loadBlob(ctx context.Context, blobs []restic.PackedBlob, bu
 			continue
 		}
 
-		it := newPackBlobIterator(blob.PackID, newByteReader(buf), uint(blob.Offset), []restic.Blob{blob.Blob}, r.key, r.getZstdDecoder())
+		it := newPackBlobIterator(blob.PackID, newByteReader(buf), uint(blob.Offset), []restic.Blob{blob.Blob}, r.key, r.cfg.BlobHash, r.getZstdDecoder())
 		pbv, err := it.Next()
 
 		if err == nil {
@@ -412,7 +433,7 @@ func (r *Repository) verifyCiphertext(buf []byte, uncompressedLength int, id res
 			return fmt.Errorf("decompression failed: %w", err)
 		}
 	}
-	if !restic.Hash(plaintext).Equal(id) {
+	if !r.cfg.BlobHash(plaintext).Equal(id) {
 		return errors.New("hash mismatch")
 	}
 
@@ -586,16 +607,32 @@ func (r *Repository) flushPacks(ctx context.Context) error {
 	return err
 }
 
+// Capacity returns the free and total space of the storage used by the
+// repository. ok is false if the backend cannot determine its capacity.
+func (r *Repository) Capacity(ctx context.Context) (capacity backend.Capacity, ok bool, err error) {
+	be := backend.AsBackend[backend.CapacityBackend](r.be)
+	if be == nil {
+		return backend.Capacity{}, false, nil
+	}
+	capacity, err = be.Capacity(ctx)
+	if err != nil {
+		return backend.Capacity{}, false, err
+	}
+	return capacity, true, nil
+}
+
 func (r *Repository) Connections() uint {
 	return r.be.Connections()
 }
 
 func (r *Repository) LookupBlob(tpe restic.BlobType, id restic.ID) []restic.PackedBlob {
+	r.ensureIndexNoCtx(tpe)
 	return r.idx.Lookup(restic.BlobHandle{Type: tpe, ID: id})
 }
 
 // LookupBlobSize returns the size of blob id.
 func (r *Repository) LookupBlobSize(tpe restic.BlobType, id restic.ID) (uint, bool) {
+	r.ensureIndexNoCtx(tpe)
 	return r.idx.LookupSize(restic.BlobHandle{Type: tpe, ID: id})
 }
 
@@ -612,6 +649,7 @@ func (r *Repository) ListPacksFromIndex(ctx context.Context, packs restic.IDSet)
 // SetIndex instructs the repository to use the given index.
 func (r *Repository) SetIndex(i restic.MasterIndex) error {
 	r.idx = i.(*index.MasterIndex)
+	r.lazyIdx = nil
 	return r.prepareCache()
 }
 
@@ -625,6 +663,7 @@ func (r *Repository) LoadIndex(ctx context.Context, p *progress.Counter) error {
 
 	// reset in-memory index before loading it from the repository
 	r.clearIndex()
+	r.lazyIdx = nil
 
 	err := r.idx.Load(ctx, r, p, nil)
 	if err != nil {
@@ -634,23 +673,8 @@ func (r *Repository) LoadIndex(ctx context.Context, p *progress.Counter) error {
 	// Trigger GC to reset garbage collection threshold
 	runtime.GC()
 
-	if r.cfg.Version < 2 {
-		// sanity check
-		ctx, cancel := context.WithCancel(ctx)
-		defer cancel()
-
-		invalidIndex := false
-		err := r.idx.Each(ctx, func(blob restic.PackedBlob) {
-			if blob.IsCompressed() {
-				invalidIndex = true
-			}
-		})
-		if err != nil {
-			return err
-		}
-		if invalidIndex {
-			return errors.New("index uses feature not supported by repository version 1")
-		}
+	if err := r.checkIndexFeatures(ctx); err != nil {
+		return err
 	}
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -660,6 +684,88 @@ func (r *Repository) LoadIndex(ctx context.Context, p *progress.Counter) error {
 	return r.prepareCache()
 }
 
+// checkIndexFeatures verifies that the index only uses features which are
+// supported by the repository version.
+func (r *Repository) checkIndexFeatures(ctx context.Context) error {
+	if r.cfg.Version >= 2 {
+		return nil
+	}
+
+	// sanity check
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	invalidIndex := false
+	err := r.idx.Each(ctx, func(blob restic.PackedBlob) {
+		if blob.IsCompressed() {
+			invalidIndex = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if invalidIndex {
+		return errors.New("index uses feature not supported by repository version 1")
+	}
+	return nil
+}
+
+// lazyIndex records which blob types of a lazily loaded index are available.
+type lazyIndex struct {
+	m           sync.Mutex
+	newProgress func() *progress.Counter
+	loaded      [restic.NumBlobTypes]bool
+	err         [restic.NumBlobTypes]error
+}
+
+// LoadIndexLazy prepares the repository to load the index on demand. The
+// index files are only read once a blob is requested, and only the entries
+// for the type of the requested blob are kept in memory. This is intended for
+// read-only commands which only access tree blobs, such as ls. newProgress is
+// called to create a progress counter each time index files are loaded, it
+// may be nil.
+func (r *Repository) LoadIndexLazy(newProgress func() *progress.Counter) {
+	debug.Log("Loading index on demand")
+	r.clearIndex()
+	r.lazyIdx = &lazyIndex{newProgress: newProgress}
+}
+
+// ensureIndex loads the index entries for blobs of type t if the index is
+// loaded on demand and the entries are not loaded yet.
+func (r *Repository) ensureIndex(ctx context.Context, t restic.BlobType) error {
+	l := r.lazyIdx
+	if l == nil || t == restic.InvalidBlob || t >= restic.NumBlobTypes {
+		return nil
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.loaded[t] {
+		return l.err[t]
+	}
+
+	debug.Log("Loading index for %v blobs", t)
+	var p *progress.Counter
+	if l.newProgress != nil {
+		p = l.newProgress()
+	}
+	err := r.idx.LoadType(ctx, r, p, t)
+	if err == nil {
+		err = r.checkIndexFeatures(ctx)
+	}
+	l.loaded[t] = true
+	l.err[t] = err
+	return err
+}
+
+// ensureIndexNoCtx is used by the lookup methods which do not return errors.
+// A failure is reported by the next call to LoadBlob.
+func (r *Repository) ensureIndexNoCtx(t restic.BlobType) {
+	if err := r.ensureIndex(context.Background(), t); err != nil {
+		debug.Log("loading index for %v blobs failed: %v", t, err)
+	}
+}
+
 // createIndexFromPacks creates a new index by reading all given pack files (with sizes).
 // The index is added to the MasterIndex but not marked as finalized.
 // Returned is the list of pack files which could not be read.
@@ -748,13 +854,33 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 	if err != nil {
 		return err
 	}
+	return r.useKey(ctx, key)
+}
+
+// SearchTokenKey finds a key protected by a hardware token, the secret for
+// the key is recovered using unwrap. Afterwards the config is read and parsed.
+// It tries at most maxKeys key files in the repo.
+func (r *Repository) SearchTokenKey(ctx context.Context, unwrap KeyUnwrapFunc, maxKeys int, keyHint string) error {
+	key, err := SearchTokenKey(ctx, r, unwrap, maxKeys, keyHint)
+	if err != nil {
+		return err
+	}
+	return r.useKey(ctx, key)
+}
+
+// useKey switches the repository to the given key and loads the config.
+func (r *Repository) useKey(ctx context.Context, key *Key) error {
 
 	oldKey := r.key
 	oldKeyID := r.keyID
 
 	r.key = key.master
 	r.keyID = key.ID()
-	cfg, err := restic.LoadConfig(ctx, r)
+	buf, err := r.LoadUnpacked(ctx, restic.ConfigFile, restic.ID{})
+	var cfg restic.Config
+	if err == nil {
+		cfg, err = restic.ParseConfig(buf)
+	}
 	if err != nil {
 		r.key = oldKey
 		r.keyID = oldKeyID
@@ -765,13 +891,46 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 		return fmt.Errorf("config cannot be loaded: %w", err)
 	}
 
+	// configs written by older versions of restic are not signed, these can
+	// be signed using the sign_config migration. Once the config is signed,
+	// the key rejects configs without signature.
+	if cfg.Signature != nil || key.master.SignedConfig {
+		err = restic.VerifyConfigSignature(buf, key.master)
+		if err != nil {
+			r.key = oldKey
+			r.keyID = oldKeyID
+			return err
+		}
+	}
+
+	// the key rejects configs older than the newest one it has seen, see
+	// RecordConfigRevision
+	if cfg.Revision < key.master.ConfigRevision {
+		r.key = oldKey
+		r.keyID = oldKeyID
+		return fmt.Errorf("%w: the config has revision %d, but key %v has already seen revision %d",
+			restic.ErrConfigRollback, cfg.Revision, key.ID(), key.master.ConfigRevision)
+	}
+
+	if cfg.CipherName() != key.master.CipherName() {
+		r.key = oldKey
+		r.keyID = oldKeyID
+		return fmt.Errorf("key %v uses cipher %v, but the repository uses %v", key.ID(), key.master.CipherName(), cfg.CipherName())
+	}
+	if r.opts.FIPS && !cfg.FIPS() {
+		r.key = oldKey
+		r.keyID = oldKeyID
+		return ErrNotFIPS
+	}
+
+	r.keyFile = key
 	r.setConfig(cfg)
 	return nil
 }
 
 // Init creates a new master key with the supplied password, initializes and
-// saves the repository config.
-func (r *Repository) Init(ctx context.Context, version uint, password string, chunkerPolynomial *chunker.Pol) error {
+// saves the repository config. An empty contentHash selects SHA-256.
+func (r *Repository) Init(ctx context.Context, version uint, password string, chunkerPolynomial *chunker.Pol, contentHash string) error {
 	if version > restic.MaxRepoVersion {
 		return fmt.Errorf("repository version %v too high", version)
 	}
@@ -812,6 +971,21 @@ func (r *Repository) Init(ctx context.Context, version uint, password string, ch
 	if chunkerPolynomial != nil {
 		cfg.ChunkerPolynomial = *chunkerPolynomial
 	}
+	if err := restic.ValidateContentHash(version, contentHash); err != nil {
+		return err
+	}
+	if contentHash != restic.ContentHashSHA256 {
+		cfg.ContentHash = contentHash
+	}
+	if r.opts.FIPS {
+		if version < restic.CipherVersion {
+			return fmt.Errorf("FIPS mode requires repository version %v or later", restic.CipherVersion)
+		}
+		cfg.Cipher = crypto.CipherAES256GCM
+		if !cfg.FIPS() {
+			return fmt.Errorf("content hash %v is not approved in FIPS mode", cfg.ContentHashName())
+		}
+	}
 
 	return r.init(ctx, password, cfg)
 }
@@ -819,13 +993,19 @@ func (r *Repository) Init(ctx context.Context, version uint, password string, ch
 // init creates a new master key with the supplied password and uses it to save
 // the config into the repo.
 func (r *Repository) init(ctx context.Context, password string, cfg restic.Config) error {
-	key, err := createMasterKey(ctx, r, password)
+	cfg.Revision = 1
+	key, err := createMasterKey(ctx, r, password, cfg)
 	if err != nil {
 		return err
 	}
 
 	r.key = key.master
 	r.keyID = key.ID()
+	r.keyFile = key
+	err = cfg.Sign(r.key)
+	if err != nil {
+		return err
+	}
 	r.setConfig(cfg)
 	return restic.SaveConfig(ctx, &internalRepository{r}, cfg)
 }
@@ -900,9 +1080,9 @@ func (r *Repository) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte
 		// useful for sparse files containing large all zero regions. For these we can
 		// process chunks as fast as we can read the from disk.
 		if len(buf) == chunker.MinSize && restic.ZeroPrefixLen(buf) == chunker.MinSize {
-			newID = ZeroChunk()
+			newID = ZeroChunk(r.cfg)
 		} else {
-			newID = restic.Hash(buf)
+			newID = r.cfg.BlobHash(buf)
 		}
 	} else {
 		newID = id
@@ -921,6 +1101,7 @@ func (r *Repository) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte
 
 type backendLoadFn func(ctx context.Context, h backend.Handle, length int, offset int64, fn func(rd io.Reader) error) error
 type loadBlobFn func(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error)
+type blobHashFn func(data []byte) restic.ID
 
 // Skip sections with more than 1MB unused blobs
 const maxUnusedRange = 1 * 1024 * 1024
@@ -931,10 +1112,10 @@ const maxUnusedRange = 1 * 1024 * 1024
 // then LoadBlobsFromPack will abort and not retry it. The buf passed to the callback is only valid within
 // this specific call. The callback must not keep a reference to buf.
 func (r *Repository) LoadBlobsFromPack(ctx context.Context, packID restic.ID, blobs []restic.Blob, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
-	return streamPack(ctx, r.be.Load, r.LoadBlob, r.getZstdDecoder(), r.key, packID, blobs, handleBlobFn)
+	return streamPack(ctx, r.be.Load, r.LoadBlob, r.getZstdDecoder(), r.key, r.cfg.BlobHash, packID, blobs, handleBlobFn)
 }
 
-func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, packID restic.ID, blobs []restic.Blob, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, blobHash blobHashFn, packID restic.ID, blobs []restic.Blob, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
 	if len(blobs) == 0 {
 		// nothing to do
 		return nil
@@ -944,6 +1125,14 @@ func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn
 		return blobs[i].Offset < blobs[j].Offset
 	})
 
+	return splitPack(packID, blobs, func(part []restic.Blob) error {
+		return streamPackPart(ctx, beLoad, loadBlobFn, dec, key, blobHash, packID, part, handleBlobFn)
+	})
+}
+
+// splitPack splits the blobs, which must be sorted by offset, into parts that
+// are each loaded from the pack using a single request.
+func splitPack(packID restic.ID, blobs []restic.Blob, loadPart func(part []restic.Blob) error) error {
 	lowerIdx := 0
 	lastPos := blobs[0].Offset
 	const maxChunkSize = 2 * DefaultPackSize
@@ -968,8 +1157,7 @@ func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn
 
 		if split {
 			// load everything up to the skipped file section
-			err := streamPackPart(ctx, beLoad, loadBlobFn, dec, key, packID, blobs[lowerIdx:i], handleBlobFn)
-			if err != nil {
+			if err := loadPart(blobs[lowerIdx:i]); err != nil {
 				return err
 			}
 			lowerIdx = i
@@ -977,10 +1165,30 @@ func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn
 		lastPos = blobs[i].Offset + blobs[i].Length
 	}
 	// load remainder
-	return streamPackPart(ctx, beLoad, loadBlobFn, dec, key, packID, blobs[lowerIdx:], handleBlobFn)
+	return loadPart(blobs[lowerIdx:])
 }
 
-func streamPackPart(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, packID restic.ID, blobs []restic.Blob, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+// PackDownloadSize returns the number of requests and bytes needed by
+// LoadBlobsFromPack to load the blobs from the pack packID.
+func PackDownloadSize(packID restic.ID, blobs []restic.Blob) (requests int, size uint64, err error) {
+	if len(blobs) == 0 {
+		return 0, 0, nil
+	}
+
+	blobs = slices.Clone(blobs)
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].Offset < blobs[j].Offset
+	})
+
+	err = splitPack(packID, blobs, func(part []restic.Blob) error {
+		requests++
+		size += uint64(part[len(part)-1].Offset + part[len(part)-1].Length - part[0].Offset)
+		return nil
+	})
+	return requests, size, err
+}
+
+func streamPackPart(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, blobHash blobHashFn, packID restic.ID, blobs []restic.Blob, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
 	h := backend.Handle{Type: restic.PackFile, Name: packID.String(), IsMetadata: blobs[0].Type.IsMetadata()}
 
 	dataStart := blobs[0].Offset
@@ -1012,7 +1220,7 @@ func streamPackPart(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBl
 		return errors.Wrap(err, "StreamPack")
 	}
 
-	it := newPackBlobIterator(packID, newByteReader(data), dataStart, blobs, key, dec)
+	it := newPackBlobIterator(packID, newByteReader(data), dataStart, blobs, key, blobHash, dec)
 
 	for {
 		if ctx.Err() != nil {
@@ -1090,9 +1298,10 @@ type packBlobIterator struct {
 	rd            discardReader
 	currentOffset uint
 
-	blobs []restic.Blob
-	key   *crypto.Key
-	dec   *zstd.Decoder
+	blobs    []restic.Blob
+	key      *crypto.Key
+	blobHash blobHashFn
+	dec      *zstd.Decoder
 
 	decode []byte
 }
@@ -1106,13 +1315,14 @@ type packBlobValue struct {
 var errPackEOF = errors.New("reached EOF of pack file")
 
 func newPackBlobIterator(packID restic.ID, rd discardReader, currentOffset uint,
-	blobs []restic.Blob, key *crypto.Key, dec *zstd.Decoder) *packBlobIterator {
+	blobs []restic.Blob, key *crypto.Key, blobHash blobHashFn, dec *zstd.Decoder) *packBlobIterator {
 	return &packBlobIterator{
 		packID:        packID,
 		rd:            rd,
 		currentOffset: currentOffset,
 		blobs:         blobs,
 		key:           key,
+		blobHash:      blobHash,
 		dec:           dec,
 	}
 }
@@ -1169,7 +1379,7 @@ func (b *packBlobIterator) Next() (packBlobValue, error) {
 		}
 	}
 	if err == nil {
-		id := restic.Hash(plaintext)
+		id := b.blobHash(plaintext)
 		if !id.Equal(entry.ID) {
 			debug.Log("read blob %v/%v from %v: wrong data returned, hash is %v",
 				h.Type, h.ID, b.packID.Str(), id)
@@ -1182,12 +1392,17 @@ func (b *packBlobIterator) Next() (packBlobValue, error) {
 }
 
 var zeroChunkOnce sync.Once
-var zeroChunkID restic.ID
+var zeroChunkIDs map[string]restic.ID
 
-// ZeroChunk computes and returns (cached) the ID of an all-zero chunk with size chunker.MinSize
-func ZeroChunk() restic.ID {
+// ZeroChunk computes and returns (cached) the ID of an all-zero chunk with size
+// chunker.MinSize for the content hash of the repository config cfg.
+func ZeroChunk(cfg restic.Config) restic.ID {
 	zeroChunkOnce.Do(func() {
-		zeroChunkID = restic.Hash(make([]byte, chunker.MinSize))
+		buf := make([]byte, chunker.MinSize)
+		zeroChunkIDs = make(map[string]restic.ID)
+		for _, contentHash := range []string{restic.ContentHashSHA256, restic.ContentHashBLAKE3} {
+			zeroChunkIDs[contentHash] = restic.Config{ContentHash: contentHash}.BlobHash(buf)
+		}
 	})
-	return zeroChunkID
+	return zeroChunkIDs[cfg.ContentHashName()]
 }
@@ -224,7 +224,7 @@ func testStreamPack(t *testing.T, version uint) {
 	switch version {
 	case 1:
 		compress = false
-	case 2:
+	case 2, 3:
 		compress = true
 	default:
 		t.Fatal("test does not support repository version", version)
@@ -324,7 +324,7 @@ func testStreamPack(t *testing.T, version uint) {
 
 				loadCalls = 0
 				shortFirstLoad = test.shortFirstLoad
-				err := streamPack(ctx, load, nil, dec, &key, restic.ID{}, test.blobs, handleBlob)
+				err := streamPack(ctx, load, nil, dec, &key, restic.Hash, restic.ID{}, test.blobs, handleBlob)
 				if err != nil {
 					t.Fatal(err)
 				}
@@ -387,7 +387,7 @@ func testStreamPack(t *testing.T, version uint) {
 					return err
 				}
 
-				err := streamPack(ctx, load, nil, dec, &key, restic.ID{}, test.blobs, handleBlob)
+				err := streamPack(ctx, load, nil, dec, &key, restic.Hash, restic.ID{}, test.blobs, handleBlob)
 				if err == nil {
 					t.Fatalf("wanted error %v, got nil", test.err)
 				}
@@ -400,6 +400,37 @@ func testStreamPack(t *testing.T, version uint) {
 	})
 }
 
+func TestPackDownloadSize(t *testing.T) {
+	blob := func(offset, length uint) restic.Blob {
+		return restic.Blob{Offset: offset, Length: length}
+	}
+
+	var tests = []struct {
+		blobs    []restic.Blob
+		requests int
+		size     uint64
+	}{
+		{nil, 0, 0},
+		{[]restic.Blob{blob(100, 50)}, 1, 50},
+		// small gaps are downloaded
+		{[]restic.Blob{blob(1000, 100), blob(0, 100)}, 1, 1100},
+		// large gaps are skipped
+		{[]restic.Blob{blob(0, 100), blob(maxUnusedRange+200, 100)}, 2, 200},
+		// large parts are split
+		{[]restic.Blob{blob(0, 2*DefaultPackSize), blob(2*DefaultPackSize, 100)}, 2, 2*DefaultPackSize + 100},
+	}
+
+	for _, test := range tests {
+		requests, size, err := PackDownloadSize(restic.ID{}, test.blobs)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.requests, requests)
+		rtest.Equals(t, test.size, size)
+	}
+
+	_, _, err := PackDownloadSize(restic.ID{}, []restic.Blob{blob(0, 100), blob(50, 100)})
+	rtest.Assert(t, err != nil, "missing error for overlapping blobs")
+}
+
 func TestBlobVerification(t *testing.T) {
 	repo := TestRepository(t)
 
@@ -563,7 +594,7 @@ func TestStreamPackFallback(t *testing.T) {
 			return err
 		}
 
-		err := streamPack(ctx, loadPack, loadBlob, dec, &key, restic.ID{}, blobs, handleBlob)
+		err := streamPack(ctx, loadPack, loadBlob, dec, &key, restic.Hash, restic.ID{}, blobs, handleBlob)
 		rtest.OK(t, err)
 		rtest.Assert(t, blobOK, "blob failed to load")
 	}
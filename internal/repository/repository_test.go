@@ -16,13 +16,16 @@ import (
 	"github.com/restic/restic/internal/backend/cache"
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/sema"
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/repository/index"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
 	"golang.org/x/sync/errgroup"
+	"lukechampine.com/blake3"
 )
 
 var testSizes = []int{5, 23, 2<<18 + 23, 1 << 20}
@@ -422,12 +425,12 @@ func TestNoDoubleInit(t *testing.T) {
 	rtest.OK(t, err)
 
 	pol := r.Config().ChunkerPolynomial
-	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &pol)
+	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &pol, "")
 	rtest.Assert(t, strings.Contains(err.Error(), "repository master key and config already initialized"), "expected config exist error, got %q", err)
 
 	// must also prevent init if only keys exist
 	rtest.OK(t, be.Remove(context.TODO(), backend.Handle{Type: backend.ConfigFile}))
-	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &pol)
+	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &pol, "")
 	rtest.Assert(t, strings.Contains(err.Error(), "repository already contains keys"), "expected already contains keys error, got %q", err)
 
 	// must also prevent init if a snapshot exists and keys were deleted
@@ -437,6 +440,244 @@ func TestNoDoubleInit(t *testing.T) {
 	rtest.OK(t, be.List(context.TODO(), restic.KeyFile, func(fi backend.FileInfo) error {
 		return be.Remove(context.TODO(), backend.Handle{Type: restic.KeyFile, Name: fi.Name})
 	}))
-	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &pol)
+	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &pol, "")
 	rtest.Assert(t, strings.Contains(err.Error(), "repository already contains snapshots"), "expected already contains snapshots error, got %q", err)
 }
+
+// capacityBackend reports a fixed capacity.
+type capacityBackend struct {
+	backend.Backend
+	capacity backend.Capacity
+}
+
+func (be *capacityBackend) Capacity(_ context.Context) (backend.Capacity, error) {
+	return be.capacity, nil
+}
+
+func TestRepositoryCapacity(t *testing.T) {
+	repo := repository.TestRepository(t)
+	_, ok, err := repo.Capacity(context.TODO())
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "mem backend should not report a capacity")
+
+	want := backend.Capacity{Free: 100, Total: 1000}
+	be := &capacityBackend{Backend: mem.New(), capacity: want}
+	// the capacity must also be found if the backend is wrapped
+	repo, _ = repository.TestRepositoryWithBackend(t, sema.NewBackend(be), 0, repository.Options{})
+	capacity, ok, err := repo.Capacity(context.TODO())
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "capacity not reported")
+	rtest.Equals(t, want, capacity)
+}
+
+func TestContentHashBLAKE3(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	be := repository.TestBackend(t)
+
+	repo, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	err = repo.Init(context.TODO(), restic.StableRepoVersion, rtest.TestPassword, nil, restic.ContentHashBLAKE3)
+	rtest.Assert(t, err != nil, "expected error for BLAKE3 content hash with repository version %v", restic.StableRepoVersion)
+	err = repo.Init(context.TODO(), restic.ContentHashVersion, rtest.TestPassword, nil, "md5")
+	rtest.Assert(t, err != nil, "expected error for unsupported content hash")
+
+	rtest.OK(t, repo.Init(context.TODO(), restic.ContentHashVersion, rtest.TestPassword, nil, restic.ContentHashBLAKE3))
+	rtest.Equals(t, restic.ContentHashBLAKE3, repo.Config().ContentHashName())
+
+	data := make([]byte, 300*1024)
+	_, err = io.ReadFull(rnd, data)
+	rtest.OK(t, err)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	id, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ID(blake3.Sum256(data)), id)
+	rtest.OK(t, repo.Flush(context.Background()))
+
+	// the content hash must be used after reopening the repository
+	repo = repository.TestOpenBackend(t, be)
+	rtest.OK(t, repo.LoadIndex(context.TODO(), nil))
+	buf, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(buf, data), "data does not match")
+}
+
+func TestFIPS(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	be := repository.TestBackend(t)
+
+	repo, err := repository.New(be, repository.Options{FIPS: true})
+	rtest.OK(t, err)
+	err = repo.Init(context.TODO(), restic.StableRepoVersion, rtest.TestPassword, nil, "")
+	rtest.Assert(t, err != nil, "expected error for repository version %v", restic.StableRepoVersion)
+	err = repo.Init(context.TODO(), restic.CipherVersion, rtest.TestPassword, nil, restic.ContentHashBLAKE3)
+	rtest.Assert(t, err != nil, "expected error for BLAKE3 content hash")
+
+	rtest.OK(t, repo.Init(context.TODO(), restic.CipherVersion, rtest.TestPassword, nil, ""))
+	rtest.Equals(t, crypto.CipherAES256GCM, repo.Config().Cipher)
+	rtest.Equals(t, crypto.CipherAES256GCM, repo.Key().Cipher)
+	rtest.Assert(t, repo.Config().FIPS(), "repository is not in FIPS mode")
+
+	data := make([]byte, 300*1024)
+	_, err = io.ReadFull(rnd, data)
+	rtest.OK(t, err)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	id, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.Background()))
+
+	// additional keys are derived using PBKDF2 as well
+	key, err := repository.AddKey(context.TODO(), repo, "other", "user", "host", repo.Key())
+	rtest.OK(t, err)
+	rtest.Equals(t, "pbkdf2-sha256", key.KDF)
+
+	// the repository can be opened with and without FIPS mode
+	for _, fips := range []bool{false, true} {
+		repo2, err := repository.New(be, repository.Options{FIPS: fips})
+		rtest.OK(t, err)
+		rtest.OK(t, repo2.SearchKey(context.TODO(), "other", 0, ""))
+		rtest.OK(t, repo2.LoadIndex(context.TODO(), nil))
+		buf, err := repo2.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(buf, data), "data does not match")
+	}
+
+	// other repositories cannot be opened in FIPS mode
+	_, _, be = repository.TestRepositoryWithVersion(t, restic.CipherVersion)
+	repo2, err := repository.New(be, repository.Options{FIPS: true})
+	rtest.OK(t, err)
+	err = repo2.SearchKey(context.TODO(), rtest.TestPassword, 0, "")
+	rtest.Assert(t, errors.Is(err, repository.ErrNotFIPS), "expected ErrNotFIPS, got %v", err)
+}
+
+func TestConfigSignature(t *testing.T) {
+	repo, unpacked, be := repository.TestRepositoryWithVersion(t, restic.StableRepoVersion)
+	rtest.Assert(t, repo.Config().Signature != nil, "config of a new repository is not signed")
+	rtest.Assert(t, repo.ConfigSignatureEnforced(), "key of a new repository does not enforce the signature")
+
+	openRepo := func() error {
+		repo, err := repository.New(be, repository.Options{})
+		rtest.OK(t, err)
+		return repo.SearchKey(context.TODO(), rtest.TestPassword, 0, "")
+	}
+	saveConfig := func(cfg restic.Config) {
+		rtest.OK(t, be.Remove(context.TODO(), backend.Handle{Type: restic.ConfigFile}))
+		rtest.OK(t, restic.SaveConfig(context.TODO(), unpacked, cfg))
+	}
+
+	// the key of a new repository rejects a config without signature
+	cfg := repo.Config()
+	cfg.Signature = nil
+	saveConfig(cfg)
+	err := openRepo()
+	rtest.Assert(t, errors.Is(err, restic.ErrConfigNotSigned), "expected ErrConfigNotSigned, got %v", err)
+
+	// unsigned configs of older repositories are accepted
+	master := *repo.Key()
+	master.SignedConfig = false
+	_, err = repository.AddKey(context.TODO(), repo, rtest.TestPassword, "", "", &master)
+	rtest.OK(t, err)
+	rtest.OK(t, be.Remove(context.TODO(), backend.Handle{Type: restic.KeyFile, Name: repo.KeyID().String()}))
+	repo2 := repository.TestOpenBackend(t, be)
+	rtest.Assert(t, repo2.Config().Signature == nil, "unexpected signature")
+	rtest.Assert(t, !repo2.ConfigSignatureEnforced(), "key enforces the signature")
+
+	rtest.OK(t, repository.SignConfig(context.TODO(), repo2))
+	rtest.Assert(t, repo2.Config().Signature != nil, "config is not signed")
+	rtest.Assert(t, repo2.ConfigSignatureEnforced(), "key does not enforce the signature")
+	repo2 = repository.TestOpenBackend(t, be)
+	rtest.OK(t, repo2.Config().VerifySignature(repo2.Key()))
+	rtest.Assert(t, repo2.ConfigSignatureEnforced(), "key does not enforce the signature")
+
+	// removing the signature is detected
+	cfg = repo2.Config()
+	cfg.Signature = nil
+	saveConfig(cfg)
+	err = openRepo()
+	rtest.Assert(t, errors.Is(err, restic.ErrConfigNotSigned), "expected ErrConfigNotSigned, got %v", err)
+
+	// modified parameters are rejected
+	cfg = repo2.Config()
+	cfg.ChunkerPolynomial ^= 1
+	saveConfig(cfg)
+	err = openRepo()
+	rtest.Assert(t, errors.Is(err, restic.ErrConfigSignatureInvalid), "expected ErrConfigSignatureInvalid, got %v", err)
+}
+
+func TestConfigRollback(t *testing.T) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, restic.StableRepoVersion)
+	rtest.Equals(t, uint64(1), repo.Config().Revision)
+	_, err := repository.AddKey(context.TODO(), repo, "other", "", "", repo.Key())
+	rtest.OK(t, err)
+
+	oldConfig, err := repo.LoadRaw(context.TODO(), restic.ConfigFile, restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repository.SetReplica(context.TODO(), repo, &restic.Replica{Primary: "primary"}))
+	rtest.Equals(t, uint64(2), repo.Config().Revision)
+	rtest.Equals(t, uint64(2), repo.Key().ConfigRevision)
+
+	openRepo := func(password string) (*repository.Repository, error) {
+		repo, err := repository.New(be, repository.Options{})
+		rtest.OK(t, err)
+		return repo, repo.SearchKey(context.TODO(), password, 0, "")
+	}
+
+	// the other key records the new revision once it is used to write
+	repo2, err := openRepo("other")
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(1), repo2.Key().ConfigRevision)
+	oldKeyID := repo2.KeyID()
+	rtest.OK(t, repo2.RecordConfigRevision(context.TODO()))
+	rtest.Equals(t, uint64(2), repo2.Key().ConfigRevision)
+	rtest.Assert(t, repo2.KeyID() != oldKeyID, "key file was not replaced")
+
+	// the old config still has a valid signature, but is rejected by both keys
+	h := backend.Handle{Type: restic.ConfigFile}
+	rtest.OK(t, be.Remove(context.TODO(), h))
+	rtest.OK(t, be.Save(context.TODO(), h, backend.NewByteReader(oldConfig, be.Hasher())))
+	for _, password := range []string{rtest.TestPassword, "other"} {
+		_, err = openRepo(password)
+		rtest.Assert(t, errors.Is(err, restic.ErrConfigRollback), "expected ErrConfigRollback, got %v", err)
+	}
+}
+
+func TestRepositoryLoadIndexLazy(t *testing.T) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, 0)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	dataID, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, []byte("data"), restic.ID{}, false)
+	rtest.OK(t, err)
+	treeID, _, _, err := repo.SaveBlob(context.TODO(), restic.TreeBlob, []byte("tree"), restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.Background()))
+
+	repo = repository.TestOpenBackend(t, be)
+	loads := 0
+	repo.LoadIndexLazy(func() *progress.Counter {
+		loads++
+		return nil
+	})
+	rtest.Equals(t, 0, loads)
+
+	buf, err := repo.LoadBlob(context.TODO(), restic.TreeBlob, treeID, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("tree"), buf)
+	rtest.Equals(t, 1, loads)
+
+	// only the entries for tree blobs are loaded so far
+	var blobs []restic.BlobHandle
+	rtest.OK(t, repo.ListBlobs(context.TODO(), func(pb restic.PackedBlob) {
+		blobs = append(blobs, pb.BlobHandle)
+	}))
+	rtest.Equals(t, []restic.BlobHandle{{Type: restic.TreeBlob, ID: treeID}}, blobs)
+
+	_, ok := repo.LookupBlobSize(restic.DataBlob, dataID)
+	rtest.Assert(t, ok, "data blob not found")
+	_, ok = repo.LookupBlobSize(restic.TreeBlob, treeID)
+	rtest.Assert(t, ok, "tree blob not found")
+	rtest.Equals(t, 2, loads)
+}
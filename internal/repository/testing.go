@@ -33,6 +33,7 @@ func TestUseLowSecurityKDFParameters(t logger) {
 			R: 1,
 			P: 1,
 		}
+		pbkdf2Iterations = 1000
 	})
 }
 
@@ -64,7 +65,7 @@ func TestRepositoryWithBackend(t testing.TB, be backend.Backend, version uint, o
 		version = restic.StableRepoVersion
 	}
 	pol := testChunkerPol
-	err = repo.Init(context.TODO(), version, test.TestPassword, &pol)
+	err = repo.Init(context.TODO(), version, test.TestPassword, &pol, "")
 	if err != nil {
 		t.Fatalf("TestRepository(): initialize repo failed: %v", err)
 	}
@@ -162,3 +163,12 @@ func TestNewLock(t *testing.T, repo *Repository, exclusive bool) (*restic.Lock,
 	// TODO get rid of this test helper
 	return restic.NewLock(context.TODO(), &internalRepository{repo}, exclusive)
 }
+
+// TestSaveLock stores a copy of lock in the repository without any checks.
+func TestSaveLock(t testing.TB, repo *Repository, lock *restic.Lock) restic.ID {
+	id, err := restic.SaveJSONUnpacked[restic.FileType](context.TODO(), &internalRepository{repo}, restic.LockFile, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
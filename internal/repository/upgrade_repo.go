@@ -6,18 +6,20 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/restic"
 )
 
-type upgradeRepoV2Error struct {
+type replaceConfigError struct {
 	UploadNewConfigError   error
 	ReuploadOldConfigError error
 
 	BackupFilePath string
 }
 
-func (err *upgradeRepoV2Error) Error() string {
+func (err *replaceConfigError) Error() string {
 	if err.ReuploadOldConfigError != nil {
 		return fmt.Sprintf("error uploading config (%v), re-uploading old config filed failed as well (%v), but there is a backup of the config file in %v", err.UploadNewConfigError, err.ReuploadOldConfigError, err.BackupFilePath)
 	}
@@ -25,12 +27,12 @@ func (err *upgradeRepoV2Error) Error() string {
 	return fmt.Sprintf("error uploading config (%v), re-uploaded old config was successful, there is a backup of the config file in %v", err.UploadNewConfigError, err.BackupFilePath)
 }
 
-func (err *upgradeRepoV2Error) Unwrap() error {
+func (err *replaceConfigError) Unwrap() error {
 	// consider the original upload error as the primary cause
 	return err.UploadNewConfigError
 }
 
-func upgradeRepository(ctx context.Context, repo *Repository) error {
+func saveConfig(ctx context.Context, repo *Repository, cfg restic.Config) error {
 	h := backend.Handle{Type: backend.ConfigFile}
 
 	if !repo.be.HasAtomicReplace() {
@@ -41,24 +43,27 @@ func upgradeRepository(ctx context.Context, repo *Repository) error {
 		}
 	}
 
-	// upgrade config
-	cfg := repo.Config()
-	cfg.Version = 2
+	cfg.Revision = repo.cfg.Revision + 1
+	err := cfg.Sign(repo.key)
+	if err != nil {
+		return err
+	}
 
-	err := restic.SaveConfig(ctx, &internalRepository{repo}, cfg)
+	err = restic.SaveConfig(ctx, &internalRepository{repo}, cfg)
 	if err != nil {
 		return fmt.Errorf("save new config file failed: %w", err)
 	}
 
+	repo.setConfig(cfg)
 	return nil
 }
 
-func UpgradeRepo(ctx context.Context, repo *Repository) error {
-	if repo.Config().Version != 1 {
-		return fmt.Errorf("repository has version %v, only upgrades from version 1 are supported", repo.Config().Version)
-	}
-
-	tempdir, err := os.MkdirTemp("", "restic-migrate-upgrade-repo-v2-")
+// replaceConfig signs and saves cfg as the new config of the repository with
+// the next revision, which is recorded in the key used to open the
+// repository. The old config file is stored in a temporary directory and
+// uploaded again if saving the new config fails.
+func replaceConfig(ctx context.Context, repo *Repository, cfg restic.Config, name string) error {
+	tempdir, err := os.MkdirTemp("", "restic-migrate-"+name+"-")
 	if err != nil {
 		return fmt.Errorf("create temp dir failed: %w", err)
 	}
@@ -77,12 +82,12 @@ func UpgradeRepo(ctx context.Context, repo *Repository) error {
 		return fmt.Errorf("write config file backup to %v failed: %w", tempdir, err)
 	}
 
-	// run the upgrade
-	err = upgradeRepository(ctx, repo)
+	// replace the config
+	err = saveConfig(ctx, repo, cfg)
 	if err != nil {
 
 		// build an error we can return to the caller
-		repoError := &upgradeRepoV2Error{
+		repoError := &replaceConfigError{
 			UploadNewConfigError: err,
 			BackupFilePath:       backupFileName,
 		}
@@ -99,5 +104,116 @@ func UpgradeRepo(ctx context.Context, repo *Repository) error {
 
 	_ = os.Remove(backupFileName)
 	_ = os.Remove(tempdir)
+
+	err = repo.RecordConfigRevision(ctx)
+	if err != nil {
+		return fmt.Errorf("config was saved, but %w", err)
+	}
 	return nil
 }
+
+func UpgradeRepo(ctx context.Context, repo *Repository) error {
+	if repo.Config().Version != 1 {
+		return fmt.Errorf("repository has version %v, only upgrades from version 1 are supported", repo.Config().Version)
+	}
+
+	cfg := repo.Config()
+	cfg.Version = 2
+	return replaceConfig(ctx, repo, cfg, "upgrade-repo-v2")
+}
+
+// SignConfig adds a signature to the config of a repository created by an
+// older version of restic. Afterwards, the key used to open the repository is
+// marked to reject configs without signature.
+func SignConfig(ctx context.Context, repo *Repository) error {
+	if repo.Config().Signature != nil && repo.key.SignedConfig {
+		return fmt.Errorf("repository config is already signed")
+	}
+	if repo.Config().Signature == nil {
+		err := replaceConfig(ctx, repo, repo.Config(), "sign-config")
+		if err != nil {
+			return err
+		}
+	}
+	if repo.key.SignedConfig {
+		return nil
+	}
+
+	return repo.updateMasterKey(ctx, func(master *crypto.Key) {
+		master.SignedConfig = true
+	})
+}
+
+// RecordConfigRevision records the revision of the current config in the key
+// used to open the repository, such that the key rejects older configs
+// afterwards. This replaces the key file, which changes the ID of the key.
+func (r *Repository) RecordConfigRevision(ctx context.Context) error {
+	if r.key.ConfigRevision >= r.cfg.Revision {
+		return nil
+	}
+	revision := r.cfg.Revision
+	return r.updateMasterKey(ctx, func(master *crypto.Key) {
+		master.ConfigRevision = revision
+	})
+}
+
+// updateMasterKey stores the master key modified by fn in a new key file,
+// which replaces the key file used to open the repository.
+func (r *Repository) updateMasterKey(ctx context.Context, fn func(master *crypto.Key)) error {
+	if r.keyFile == nil {
+		return fmt.Errorf("the key used to open the repository is unknown")
+	}
+	master := *r.key
+	fn(&master)
+	key, err := replaceMasterKey(ctx, r, r.keyFile, &master)
+	if err != nil {
+		return fmt.Errorf("updating key %v failed: %w", r.keyID.Str(), err)
+	}
+	r.key = key.master
+	r.keyID = key.ID()
+	r.keyFile = key
+	return nil
+}
+
+// ConfigSignatureEnforced reports whether the key used to open the repository
+// rejects configs without signature.
+func (r *Repository) ConfigSignatureEnforced() bool {
+	return r.key.SignedConfig
+}
+
+// StartRechunk replaces the chunker polynomial of the repository by pol. The
+// previous polynomial is kept in the config until FinishRechunk is called.
+func StartRechunk(ctx context.Context, repo *Repository, pol chunker.Pol) error {
+	cfg := repo.Config()
+	if cfg.PreviousChunkerPolynomial != nil {
+		return fmt.Errorf("rechunking to chunker polynomial %v is still in progress", cfg.ChunkerPolynomial)
+	}
+	previous := cfg.ChunkerPolynomial
+	cfg.PreviousChunkerPolynomial = &previous
+	cfg.ChunkerPolynomial = pol
+	return replaceConfig(ctx, repo, cfg, "rechunk")
+}
+
+// FinishRechunk removes the previous chunker polynomial from the config once
+// all snapshots are rechunked.
+func FinishRechunk(ctx context.Context, repo *Repository) error {
+	cfg := repo.Config()
+	cfg.PreviousChunkerPolynomial = nil
+	return replaceConfig(ctx, repo, cfg, "rechunk")
+}
+
+// SetApprovalPolicy stores policy in the config of the repository, a nil
+// policy removes an existing one.
+func SetApprovalPolicy(ctx context.Context, repo *Repository, policy *restic.ApprovalPolicy) error {
+	cfg := repo.Config()
+	cfg.ApprovalPolicy = policy
+	return replaceConfig(ctx, repo, cfg, "approval-policy")
+}
+
+// SetReplica marks the repository as a replica described by replica, a nil
+// replica promotes the repository to a regular, writable repository.
+func SetReplica(ctx context.Context, repo *Repository, replica *restic.Replica) error {
+	cfg := repo.Config()
+	cfg.Replica = replica
+	return replaceConfig(ctx, repo, cfg, "replica")
+}
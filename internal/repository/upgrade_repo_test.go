@@ -65,7 +65,7 @@ func TestUpgradeRepoV2Failure(t *testing.T) {
 		t.Fatal("expected error returned from Apply(), got nil")
 	}
 
-	upgradeErr := err.(*upgradeRepoV2Error)
+	upgradeErr := err.(*replaceConfigError)
 	if upgradeErr.UploadNewConfigError == nil {
 		t.Fatal("expected upload error, got nil")
 	}
@@ -0,0 +1,44 @@
+package restic
+
+import (
+	"crypto/ed25519"
+	"time"
+)
+
+// DefaultApprovalWindow is the time within which a destructive operation must
+// be approved by a second admin, unless the policy specifies otherwise.
+const DefaultApprovalWindow = 24 * time.Hour
+
+// ApprovalPolicy implements the two-person rule: removing more than
+// ForgetThreshold snapshots, removing a key or changing the policy itself must
+// be requested by one admin and approved by a second, distinct admin within
+// Window. Admins are identified by their Ed25519 signing keys.
+type ApprovalPolicy struct {
+	// AdminKeys are the public keys of the admins.
+	AdminKeys []ed25519.PublicKey `json:"admin_keys"`
+	// ForgetThreshold is the number of snapshots forget may remove without
+	// approval within Window, summed over all runs.
+	ForgetThreshold uint `json:"forget_threshold"`
+	// Window is the time within which a request must be approved.
+	Window time.Duration `json:"window"`
+}
+
+// AdminKey returns the admin key with the given ID, as returned by
+// SigningKeyID, or nil if there is no such admin key.
+func (p *ApprovalPolicy) AdminKey(keyID string) ed25519.PublicKey {
+	for _, key := range p.AdminKeys {
+		if SigningKeyID(key) == keyID {
+			return key
+		}
+	}
+	return nil
+}
+
+// ApprovalWindow returns the configured window, or DefaultApprovalWindow if
+// none is set.
+func (p *ApprovalPolicy) ApprovalWindow() time.Duration {
+	if p.Window <= 0 {
+		return DefaultApprovalWindow
+	}
+	return p.Window
+}
@@ -0,0 +1,11 @@
+package restic
+
+// AuxiliaryDocument is a document which is stored alongside the backed up
+// data of a snapshot, for example the VSS metadata needed by an
+// application-aware restore. The documents of a snapshot are stored as files
+// in the tree referenced by Snapshot.Auxiliary.
+type AuxiliaryDocument struct {
+	// Path is the slash separated path of the document within the tree.
+	Path string
+	Data []byte
+}
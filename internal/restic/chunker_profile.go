@@ -0,0 +1,53 @@
+package restic
+
+import (
+	"encoding/json"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/errors"
+)
+
+// ChunkerProfile contains the parameters which determine how files are split
+// into blobs and how blob IDs are computed. Repositories with the same profile
+// store identical files as identical blobs, such that snapshots copied
+// between them deduplicate against each other.
+type ChunkerProfile struct {
+	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+	ContentHash       string      `json:"content_hash"`
+}
+
+// ChunkerProfile returns the chunker profile of the repository.
+func (cfg Config) ChunkerProfile() ChunkerProfile {
+	return ChunkerProfile{
+		ChunkerPolynomial: cfg.ChunkerPolynomial,
+		ContentHash:       cfg.ContentHashName(),
+	}
+}
+
+// Validate returns an error if the profile cannot be used for a repository.
+func (p ChunkerProfile) Validate() error {
+	// the chunker requires a polynomial of degree 53, as generated by
+	// chunker.RandomPolynomial
+	if p.ChunkerPolynomial.Deg() != 53 {
+		return errors.Errorf("chunker polynomial %v must have degree 53, got %d", p.ChunkerPolynomial, p.ChunkerPolynomial.Deg())
+	}
+	if checkPolynomial && !p.ChunkerPolynomial.Irreducible() {
+		return errors.Errorf("chunker polynomial %v is not irreducible", p.ChunkerPolynomial)
+	}
+	return ValidateContentHash(MaxRepoVersion, p.ContentHash)
+}
+
+// ParseChunkerProfile parses and validates a chunker profile in the JSON
+// format written by "restic chunker export". A missing content hash selects
+// SHA-256.
+func ParseChunkerProfile(buf []byte) (ChunkerProfile, error) {
+	var p ChunkerProfile
+	err := json.Unmarshal(buf, &p)
+	if err != nil {
+		return ChunkerProfile{}, errors.Wrap(err, "Unmarshal")
+	}
+	if p.ContentHash == "" {
+		p.ContentHash = ContentHashSHA256
+	}
+	return p, p.Validate()
+}
@@ -0,0 +1,38 @@
+package restic_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestChunkerProfile(t *testing.T) {
+	pol, err := chunker.RandomPolynomial()
+	rtest.OK(t, err)
+	cfg := restic.Config{Version: 3, ChunkerPolynomial: pol, ContentHash: restic.ContentHashBLAKE3}
+
+	buf, err := json.Marshal(cfg.ChunkerProfile())
+	rtest.OK(t, err)
+	p, err := restic.ParseChunkerProfile(buf)
+	rtest.OK(t, err)
+	rtest.Equals(t, cfg.ChunkerProfile(), p)
+
+	p, err = restic.ParseChunkerProfile([]byte(`{"chunker_polynomial": "` + pol.String()[2:] + `"}`))
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ChunkerProfile{ChunkerPolynomial: pol, ContentHash: restic.ContentHashSHA256}, p)
+
+	for _, invalid := range []string{
+		`{}`,
+		`{"chunker_polynomial": "3"}`,
+		// reducible polynomial of degree 53
+		`{"chunker_polynomial": "20000000000000"}`,
+		`{"chunker_polynomial": "` + pol.String()[2:] + `", "content_hash": "md5"}`,
+		`{"chunker_polynomial": 42}`,
+	} {
+		_, err := restic.ParseChunkerProfile([]byte(invalid))
+		rtest.Assert(t, err != nil, "expected error for %v", invalid)
+	}
+}
@@ -2,14 +2,17 @@ package restic
 
 import (
 	"context"
+	"encoding/json"
 	"sync"
 	"testing"
 
+	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/errors"
 
 	"github.com/restic/restic/internal/debug"
 
 	"github.com/restic/chunker"
+	"lukechampine.com/blake3"
 )
 
 // Config contains the configuration for a repository.
@@ -17,15 +20,58 @@ type Config struct {
 	Version           uint        `json:"version"`
 	ID                string      `json:"id"`
 	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+	// ContentHash is the hash function used to compute blob IDs. An empty
+	// value selects SHA-256.
+	ContentHash string `json:"content_hash,omitempty"`
+	// Cipher is the cipher used to encrypt the files of the repository. An
+	// empty value selects AES-256 in counter mode with Poly1305-AES.
+	Cipher string `json:"cipher,omitempty"`
+	// ApprovalPolicy requires destructive operations to be approved by two
+	// admins. It is nil if no policy is configured.
+	ApprovalPolicy *ApprovalPolicy `json:"approval_policy,omitempty"`
+	// PreviousChunkerPolynomial is the chunker polynomial used before it was
+	// replaced by "migrate rechunk". It is only set while snapshots which are
+	// not yet rechunked remain.
+	PreviousChunkerPolynomial *chunker.Pol `json:"previous_chunker_polynomial,omitempty"`
+	// Replica marks the repository as a read-only standby of a primary
+	// repository. It is nil for regular repositories.
+	Replica *Replica `json:"replica,omitempty"`
+	// Revision is incremented whenever the config is replaced. The keys
+	// record the highest revision they have seen and reject older configs,
+	// see crypto.Key.ConfigRevision. It is zero for repositories created by
+	// older versions of restic.
+	Revision uint64 `json:"revision,omitempty"`
+	// Signature authenticates the other fields using the master key. It is
+	// missing for repositories created by older versions of restic.
+	Signature []byte `json:"signature,omitempty"`
 }
 
 const MinRepoVersion = 1
-const MaxRepoVersion = 2
+const MaxRepoVersion = 3
+
+// ContentHashVersion is the first repository version which supports selecting
+// the content hash.
+const ContentHashVersion = 3
+
+// CipherVersion is the first repository version which supports selecting the
+// cipher.
+const CipherVersion = 3
+
+// Supported content hash functions.
+const (
+	ContentHashSHA256 = "sha256"
+	ContentHashBLAKE3 = "blake3"
+)
 
 // StableRepoVersion is the version that is written to the config when a repository
 // is newly created with Init().
 const StableRepoVersion = 2
 
+// LatestRepoVersion is the version selected by "init --repository-version
+// latest". Versions above it are still experimental and must be requested
+// explicitly.
+const LatestRepoVersion = 2
+
 // JSONUnpackedLoader loads unpacked JSON.
 type JSONUnpackedLoader interface {
 	LoadJSONUnpacked(context.Context, FileType, ID, interface{}) error
@@ -65,11 +111,17 @@ func TestDisableCheckPolynomial(t testing.TB) {
 
 // LoadConfig returns loads, checks and returns the config for a repository.
 func LoadConfig(ctx context.Context, r LoaderUnpacked) (Config, error) {
-	var (
-		cfg Config
-	)
+	buf, err := r.LoadUnpacked(ctx, ConfigFile, ID{})
+	if err != nil {
+		return Config{}, err
+	}
+	return ParseConfig(buf)
+}
 
-	err := LoadJSONUnpacked(ctx, r, ConfigFile, ID{}, &cfg)
+// ParseConfig parses and checks the config stored in buf.
+func ParseConfig(buf []byte) (Config, error) {
+	var cfg Config
+	err := json.Unmarshal(buf, &cfg)
 	if err != nil {
 		return Config{}, err
 	}
@@ -78,6 +130,14 @@ func LoadConfig(ctx context.Context, r LoaderUnpacked) (Config, error) {
 		return Config{}, errors.Errorf("unsupported repository version %v", cfg.Version)
 	}
 
+	if err := ValidateContentHash(cfg.Version, cfg.ContentHash); err != nil {
+		return Config{}, err
+	}
+
+	if err := ValidateCipher(cfg.Version, cfg.Cipher); err != nil {
+		return Config{}, err
+	}
+
 	if checkPolynomial {
 		if !cfg.ChunkerPolynomial.Irreducible() {
 			return Config{}, errors.New("invalid chunker polynomial")
@@ -87,6 +147,69 @@ func LoadConfig(ctx context.Context, r LoaderUnpacked) (Config, error) {
 	return cfg, nil
 }
 
+// ValidateContentHash returns an error if the content hash is not supported by
+// the repository version.
+func ValidateContentHash(version uint, contentHash string) error {
+	switch contentHash {
+	case "", ContentHashSHA256:
+		return nil
+	case ContentHashBLAKE3:
+		if version < ContentHashVersion {
+			return errors.Errorf("content hash %v requires repository version %v or later", contentHash, ContentHashVersion)
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported content hash %q", contentHash)
+	}
+}
+
+// ValidateCipher returns an error if the cipher is not supported by the
+// repository version.
+func ValidateCipher(version uint, cipher string) error {
+	switch cipher {
+	case "", crypto.CipherAES256Poly1305:
+		return nil
+	case crypto.CipherAES256GCM:
+		if version < CipherVersion {
+			return errors.Errorf("cipher %v requires repository version %v or later", cipher, CipherVersion)
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported cipher %q", cipher)
+	}
+}
+
+// CipherName returns the name of the cipher used by the repository.
+func (cfg Config) CipherName() string {
+	if cfg.Cipher == "" {
+		return crypto.CipherAES256Poly1305
+	}
+	return cfg.Cipher
+}
+
+// FIPS reports whether the repository only uses algorithms approved by
+// FIPS 140, that is AES-256-GCM for encryption and SHA-256 for blob IDs.
+func (cfg Config) FIPS() bool {
+	return cfg.Cipher == crypto.CipherAES256GCM && cfg.ContentHashName() == ContentHashSHA256
+}
+
+// BlobHash returns the ID of a blob with the given plaintext using the content
+// hash of the repository.
+func (cfg Config) BlobHash(data []byte) ID {
+	if cfg.ContentHash == ContentHashBLAKE3 {
+		return blake3.Sum256(data)
+	}
+	return Hash(data)
+}
+
+// ContentHashName returns the name of the content hash used by the repository.
+func (cfg Config) ContentHashName() string {
+	if cfg.ContentHash == "" {
+		return ContentHashSHA256
+	}
+	return cfg.ContentHash
+}
+
 func SaveConfig(ctx context.Context, r SaverUnpacked[FileType], cfg Config) error {
 	_, err := SaveJSONUnpacked(ctx, r, ConfigFile, cfg)
 	return err
@@ -0,0 +1,96 @@
+package restic
+
+import (
+	"encoding/json"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+)
+
+var (
+	// ErrConfigNotSigned is returned when verifying a config without signature.
+	ErrConfigNotSigned = errors.New("repository config is not signed")
+	// ErrConfigSignatureInvalid is returned when the signature does not match
+	// the config.
+	ErrConfigSignatureInvalid = errors.New("repository config signature is invalid, the repository parameters were modified")
+	// ErrConfigRollback is returned when the config is older than the
+	// newest config seen using the key.
+	ErrConfigRollback = errors.New("repository config was replaced by an older version")
+)
+
+// configSignaturePrefix separates config signatures from other uses of the
+// master key.
+const configSignaturePrefix = "restic config signature v1\n"
+
+// configSignatureField is the name of the signature in the stored config.
+const configSignatureField = "signature"
+
+// signedConfigData returns the data covered by the signature of the stored
+// config buf. These are the stored bytes with the signature member of the
+// JSON object removed, such that all other fields are covered, including
+// those unknown to this version. The member is located by parsing buf, so its
+// position within the object does not matter.
+func signedConfigData(buf []byte) ([]byte, error) {
+	data, err := removeMembers(buf, configSignatureField)
+	if errors.Is(err, errDuplicateMember) {
+		return nil, ErrConfigSignatureInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(configSignaturePrefix), data...), nil
+}
+
+// Sign signs the config using the master key and replaces any existing
+// signature. The signature covers the JSON encoding of the config written
+// by SaveConfig, without the signature itself.
+func (cfg *Config) Sign(key *crypto.Key) error {
+	// the signature has a fixed length, such that the encoding with a
+	// placeholder only differs from the stored config in the signature
+	cfg.Signature = make([]byte, len(key.Sign(nil)))
+	buf, err := json.Marshal(cfg)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+	data, err := signedConfigData(buf)
+	if err != nil {
+		return err
+	}
+	cfg.Signature = key.Sign(data)
+	return nil
+}
+
+// VerifySignature checks that the config was signed using the master key. It
+// returns ErrConfigNotSigned or ErrConfigSignatureInvalid if the verification
+// fails.
+func (cfg Config) VerifySignature(key *crypto.Key) error {
+	buf, err := json.Marshal(cfg)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+	return VerifyConfigSignature(buf, key)
+}
+
+// VerifyConfigSignature checks the signature of the config stored in buf.
+// It returns ErrConfigNotSigned or ErrConfigSignatureInvalid if the
+// verification fails.
+func VerifyConfigSignature(buf []byte, key *crypto.Key) error {
+	var cfg struct {
+		Signature []byte `json:"signature"`
+	}
+	if err := json.Unmarshal(buf, &cfg); err != nil {
+		return errors.Wrap(err, "Unmarshal")
+	}
+	if cfg.Signature == nil {
+		return ErrConfigNotSigned
+	}
+
+	data, err := signedConfigData(buf)
+	if err != nil {
+		return err
+	}
+	if !key.Verify(data, cfg.Signature) {
+		return ErrConfigSignatureInvalid
+	}
+	return nil
+}
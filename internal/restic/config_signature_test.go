@@ -0,0 +1,82 @@
+package restic_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestConfigSignature(t *testing.T) {
+	key := crypto.NewRandomKey()
+
+	cfg, err := restic.CreateConfig(restic.MaxRepoVersion)
+	rtest.OK(t, err)
+
+	err = cfg.VerifySignature(key)
+	rtest.Assert(t, errors.Is(err, restic.ErrConfigNotSigned), "unexpected error %v", err)
+
+	rtest.OK(t, cfg.Sign(key))
+	rtest.OK(t, cfg.VerifySignature(key))
+
+	err = cfg.VerifySignature(crypto.NewRandomKey())
+	rtest.Assert(t, errors.Is(err, restic.ErrConfigSignatureInvalid), "unexpected error %v", err)
+
+	for name, modify := range map[string]func(cfg *restic.Config){
+		"version":      func(cfg *restic.Config) { cfg.Version-- },
+		"id":           func(cfg *restic.Config) { cfg.ID = restic.NewRandomID().String() },
+		"polynomial":   func(cfg *restic.Config) { cfg.ChunkerPolynomial++ },
+		"content-hash": func(cfg *restic.Config) { cfg.ContentHash = restic.ContentHashBLAKE3 },
+		"cipher":       func(cfg *restic.Config) { cfg.Cipher = crypto.CipherAES256GCM },
+	} {
+		t.Run(name, func(t *testing.T) {
+			modified := cfg
+			modify(&modified)
+			err := modified.VerifySignature(key)
+			rtest.Assert(t, errors.Is(err, restic.ErrConfigSignatureInvalid), "unexpected error %v", err)
+		})
+	}
+}
+
+func TestVerifyConfigSignature(t *testing.T) {
+	key := crypto.NewRandomKey()
+
+	cfg, err := restic.CreateConfig(restic.MaxRepoVersion)
+	rtest.OK(t, err)
+	rtest.OK(t, cfg.Sign(key))
+	buf, err := json.Marshal(cfg)
+	rtest.OK(t, err)
+	rtest.OK(t, restic.VerifyConfigSignature(buf, key))
+	rtest.OK(t, restic.VerifyConfigSignature(append(buf, '\n'), key))
+
+	// the position of the signature does not matter
+	var members map[string]json.RawMessage
+	rtest.OK(t, json.Unmarshal(buf, &members))
+	signature := members["signature"]
+	moved := bytes.Replace(buf, []byte(`,"signature":`+string(signature)), nil, 1)
+	moved = append([]byte(`{"signature":`+string(signature)+`,`), moved[1:]...)
+	rtest.OK(t, restic.VerifyConfigSignature(moved, key))
+	// as does whitespace between the fields
+	rtest.OK(t, restic.VerifyConfigSignature(bytes.Replace(buf, []byte(`,`), []byte(`, `), 1), key))
+
+	unsigned, err := json.Marshal(restic.Config{Version: 1})
+	rtest.OK(t, err)
+	err = restic.VerifyConfigSignature(unsigned, key)
+	rtest.Assert(t, errors.Is(err, restic.ErrConfigNotSigned), "unexpected error %v", err)
+
+	for name, modified := range map[string][]byte{
+		// fields unknown to this version are also covered by the signature
+		"unknown field": bytes.Replace(buf, []byte(`{`), []byte(`{"unknown":1,`), 1),
+		// the signature must only be present once
+		"two signatures": append([]byte(`{"signature":"AAAA",`), buf[1:]...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := restic.VerifyConfigSignature(modified, key)
+			rtest.Assert(t, errors.Is(err, restic.ErrConfigSignatureInvalid), "unexpected error %v", err)
+		})
+	}
+}
@@ -47,7 +47,7 @@ func FindUsedBlobs(ctx context.Context, repo Loader, treeIDs IDs, blobs FindBlob
 			for _, node := range tree.Nodes {
 				switch node.Type {
 				case NodeTypeFile:
-					for _, blob := range node.Content {
+					for _, blob := range node.DataBlobs() {
 						blobs.Insert(BlobHandle{ID: blob, Type: DataBlob})
 					}
 				}
@@ -1,8 +1,10 @@
 package restic
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -30,3 +32,64 @@ func SaveJSONUnpacked[FT FileTypes](ctx context.Context, repo SaverUnpacked[FT],
 
 	return repo.SaveUnpacked(ctx, t, plaintext)
 }
+
+// errDuplicateMember is returned by removeMembers if a removed member is
+// present more than once.
+var errDuplicateMember = errors.New("duplicate member")
+
+// removeMembers removes the members with the given names from the JSON object
+// in buf. All other members are kept as stored in buf, including those
+// unknown to this version, only the whitespace between members is dropped.
+func removeMembers(buf []byte, names ...string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "Token")
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("not a JSON object")
+	}
+
+	removed := make(map[string]bool, len(names))
+	for _, name := range names {
+		removed[name] = false
+	}
+
+	out := make([]byte, 0, len(buf))
+	out = append(out, '{')
+	for dec.More() {
+		// the member starts after the separating comma
+		start := int(dec.InputOffset())
+		for start < len(buf) && bytes.IndexByte([]byte(" \t\r\n,"), buf[start]) >= 0 {
+			start++
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "Token")
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, errors.Wrap(err, "Decode")
+		}
+
+		name, _ := tok.(string)
+		if seen, ok := removed[name]; ok {
+			if seen {
+				return nil, errors.Wrap(errDuplicateMember, name)
+			}
+			removed[name] = true
+			continue
+		}
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+		out = append(out, buf[start:dec.InputOffset()]...)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, errors.Wrap(err, "Token")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON object")
+	}
+	return append(out, '}'), nil
+}
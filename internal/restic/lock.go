@@ -37,6 +37,7 @@ type Lock struct {
 	PID       int       `json:"pid"`
 	UID       uint32    `json:"uid,omitempty"`
 	GID       uint32    `json:"gid,omitempty"`
+	Operation string    `json:"operation,omitempty"`
 
 	repo   Unpacked[FileType]
 	lockID *ID
@@ -107,6 +108,7 @@ func NewLock(ctx context.Context, repo Unpacked[FileType], exclusive bool) (*Loc
 		Time:      time.Now(),
 		PID:       os.Getpid(),
 		Exclusive: exclusive,
+		Operation: LockOperation,
 		repo:      repo,
 	}
 
@@ -251,40 +253,66 @@ func (l *Lock) Unlock(ctx context.Context) error {
 
 var StaleLockTimeout = 30 * time.Minute
 
+// LockOperation is recorded in new locks to describe the operation which
+// holds the lock, for example the name of the restic command.
+var LockOperation string
+
 // Stale returns true if the lock is stale. A lock is stale if the timestamp is
 // older than 30 minutes or if it was created on the current machine and the
 // process isn't alive any more.
 func (l *Lock) Stale() bool {
+	return l.StaleReason() != ""
+}
+
+// StaleReason returns a description why the lock is stale, or an empty string
+// if the lock is not stale.
+func (l *Lock) StaleReason() string {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	debug.Log("testing if lock %v for process %d is stale", l.lockID, l.PID)
 	if time.Since(l.Time) > StaleLockTimeout {
 		debug.Log("lock is stale, timestamp is too old: %v\n", l.Time)
-		return true
-	}
-
-	hn, err := os.Hostname()
-	if err != nil {
-		debug.Log("unable to find current hostname: %v", err)
-		// since we cannot find the current hostname, assume that the lock is
-		// not stale.
-		return false
+		return fmt.Sprintf("not refreshed for more than %v", StaleLockTimeout)
 	}
 
-	if hn != l.Hostname {
+	if !l.createdOnThisHost() {
 		// lock was created on a different host, assume the lock is not stale.
-		return false
+		return ""
 	}
 
 	// check if we can reach the process retaining the lock
 	exists := l.processExists()
 	if !exists {
 		debug.Log("could not reach process, %d, lock is probably stale\n", l.PID)
-		return true
+		return fmt.Sprintf("process %d does not exist", l.PID)
 	}
 
 	debug.Log("lock not stale\n")
-	return false
+	return ""
+}
+
+// HolderReachable returns whether the process holding the lock can be checked
+// for liveness, which is only possible for locks created on this host. If so,
+// alive reports whether the process still exists.
+func (l *Lock) HolderReachable() (reachable bool, alive bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !l.createdOnThisHost() {
+		return false, false
+	}
+	return true, l.processExists()
+}
+
+func (l *Lock) createdOnThisHost() bool {
+	hn, err := os.Hostname()
+	if err != nil {
+		debug.Log("unable to find current hostname: %v", err)
+		// since we cannot find the current hostname, assume that the lock
+		// was created elsewhere.
+		return false
+	}
+	return hn == l.Hostname
 }
 
 func delayedCancelContext(parentCtx context.Context, delay time.Duration) (context.Context, context.CancelFunc) {
@@ -395,6 +423,13 @@ func (l *Lock) checkExistence(ctx context.Context) (bool, error) {
 	return exists, err
 }
 
+// ID returns the storage ID of the lock file.
+func (l *Lock) ID() ID {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return *l.lockID
+}
+
 func (l *Lock) String() string {
 	l.lock.Lock()
 	defer l.lock.Unlock()
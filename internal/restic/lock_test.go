@@ -176,6 +176,41 @@ func TestLockStale(t *testing.T) {
 	}
 }
 
+func TestLockHolderReachable(t *testing.T) {
+	hostname, err := os.Hostname()
+	rtest.OK(t, err)
+
+	lock := restic.Lock{Time: time.Now(), PID: os.Getpid(), Hostname: hostname}
+	reachable, alive := lock.HolderReachable()
+	rtest.Assert(t, reachable && alive, "expected running process to be reachable and alive")
+	rtest.Equals(t, "", lock.StaleReason())
+
+	lock.PID = os.Getpid() + 500000
+	reachable, alive = lock.HolderReachable()
+	rtest.Assert(t, reachable && !alive, "expected missing process to be reachable but not alive")
+	rtest.Assert(t, lock.StaleReason() != "", "expected lock of missing process to be stale")
+
+	lock.Hostname = "other-" + hostname
+	reachable, _ = lock.HolderReachable()
+	rtest.Assert(t, !reachable, "expected process on other host to be unreachable")
+}
+
+func TestLockOperation(t *testing.T) {
+	repo := repository.TestRepository(t)
+	restic.TestSetLockTimeout(t, 5*time.Millisecond)
+
+	restic.LockOperation = "backup"
+	defer func() { restic.LockOperation = "" }()
+
+	lock, err := repository.TestNewLock(t, repo, false)
+	rtest.OK(t, err)
+
+	loaded, err := restic.LoadLock(context.TODO(), repo, lock.ID())
+	rtest.OK(t, err)
+	rtest.Equals(t, "backup", loaded.Operation)
+	rtest.OK(t, lock.Unlock(context.TODO()))
+}
+
 func checkSingleLock(t *testing.T, repo restic.Lister) restic.ID {
 	t.Helper()
 	var lockID *restic.ID
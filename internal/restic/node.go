@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,6 +25,14 @@ type ExtendedAttribute struct {
 	Value []byte `json:"value"`
 }
 
+// AlternateStream is an alternate data stream of a file on Windows. The
+// content of the stream is split into blobs like the content of the file.
+type AlternateStream struct {
+	Name    string `json:"name"`
+	Size    uint64 `json:"size"`
+	Content IDs    `json:"content"`
+}
+
 // GenericAttributeType can be used for OS specific functionalities by defining specific types
 // in node.go to be used by the specific node_xx files.
 // OS specific attribute types should follow the convention <OS>Attributes.
@@ -46,13 +55,15 @@ const (
 	TypeFileAttributes GenericAttributeType = "windows.file_attributes"
 	// TypeSecurityDescriptor is the GenericAttributeType used for storing security descriptors including owner, group, discretionary access control list (DACL), system access control list (SACL)) for windows files within the generic attributes map.
 	TypeSecurityDescriptor GenericAttributeType = "windows.security_descriptor"
+	// TypeIntegrityStream is the GenericAttributeType used for storing the ReFS integrity stream setting for windows files and directories within the generic attributes map.
+	TypeIntegrityStream GenericAttributeType = "windows.integrity_stream"
 
 	// Generic Attributes for other OS types should be defined here.
 )
 
 // init is called when the package is initialized. Any new GenericAttributeTypes being created must be added here as well.
 func init() {
-	storeGenericAttributeType(TypeCreationTime, TypeFileAttributes, TypeSecurityDescriptor)
+	storeGenericAttributeType(TypeCreationTime, TypeFileAttributes, TypeSecurityDescriptor, TypeIntegrityStream)
 }
 
 // genericAttributesForOS maintains a map of known genericAttributesForOS to the OSType
@@ -107,6 +118,7 @@ type Node struct {
 	GenericAttributes  map[GenericAttributeType]json.RawMessage `json:"generic_attributes,omitempty"`
 	Device             uint64                                   `json:"device,omitempty"` // in case of Type == "dev", stat.st_rdev
 	Content            IDs                                      `json:"content"`
+	AlternateStreams   []AlternateStream                        `json:"alternate_streams,omitempty"`
 	Subtree            *ID                                      `json:"subtree,omitempty"`
 
 	Error string `json:"error,omitempty"`
@@ -263,6 +275,9 @@ func (node Node) Equals(other Node) bool {
 	if !node.sameContent(other) {
 		return false
 	}
+	if !node.sameAlternateStreams(other) {
+		return false
+	}
 	if !node.sameExtendedAttributes(other) {
 		return false
 	}
@@ -310,6 +325,32 @@ func (node Node) sameContent(other Node) bool {
 	return true
 }
 
+func (node Node) sameAlternateStreams(other Node) bool {
+	if len(node.AlternateStreams) != len(other.AlternateStreams) {
+		return false
+	}
+	for i, stream := range node.AlternateStreams {
+		o := other.AlternateStreams[i]
+		if stream.Name != o.Name || stream.Size != o.Size || !slices.Equal(stream.Content, o.Content) {
+			return false
+		}
+	}
+	return true
+}
+
+// DataBlobs returns the IDs of the data blobs of the file content and of all
+// alternate data streams.
+func (node *Node) DataBlobs() IDs {
+	if len(node.AlternateStreams) == 0 {
+		return node.Content
+	}
+	ids := append(IDs{}, node.Content...)
+	for _, stream := range node.AlternateStreams {
+		ids = append(ids, stream.Content...)
+	}
+	return ids
+}
+
 func (node Node) sameExtendedAttributes(other Node) bool {
 	ln := len(node.ExtendedAttributes)
 	lo := len(other.ExtendedAttributes)
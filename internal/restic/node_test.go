@@ -1,6 +1,7 @@
 package restic
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"testing"
@@ -94,3 +95,34 @@ func TestSymlinkSerializationFormat(t *testing.T) {
 		test.Assert(t, n2.LinkTargetRaw == nil, "quoted link target is just a helper field and must be unset after decoding")
 	}
 }
+
+func TestNodeAlternateStreams(t *testing.T) {
+	content := IDs{NewRandomID()}
+	stream := IDs{NewRandomID(), NewRandomID()}
+	node := Node{
+		Name:    "file",
+		Type:    NodeTypeFile,
+		Content: content,
+		AlternateStreams: []AlternateStream{
+			{Name: "Zone.Identifier", Size: 42, Content: stream},
+		},
+	}
+	test.Equals(t, append(append(IDs{}, content...), stream...), node.DataBlobs())
+
+	buf, err := json.Marshal(node)
+	test.OK(t, err)
+	var decoded Node
+	test.OK(t, json.Unmarshal(buf, &decoded))
+	test.Assert(t, node.Equals(decoded), "decoded node %v differs from %v", decoded, node)
+
+	other := node
+	other.AlternateStreams = []AlternateStream{{Name: "Zone.Identifier", Size: 42, Content: IDs{stream[0]}}}
+	test.Assert(t, !node.Equals(other), "nodes with different streams are equal")
+
+	// nodes without streams do not store the field
+	node.AlternateStreams = nil
+	buf, err = json.Marshal(node)
+	test.OK(t, err)
+	test.Assert(t, !bytes.Contains(buf, []byte("alternate_streams")), "unexpected streams in %s", buf)
+	test.Equals(t, content, node.DataBlobs())
+}
@@ -16,6 +16,18 @@ type WindowsAttributes struct {
 	// SecurityDescriptor is used for storing security descriptors which includes
 	// owner, group, discretionary access control list (DACL), system access control list (SACL)
 	SecurityDescriptor *[]byte `generic:"security_descriptor"`
+	// IntegrityStream is used for storing the integrity stream setting of files and
+	// directories on ReFS volumes.
+	IntegrityStream *IntegrityStream `generic:"integrity_stream"`
+}
+
+// IntegrityStream is the integrity stream setting of a file or directory on ReFS.
+type IntegrityStream struct {
+	// ChecksumAlgorithm is the CHECKSUM_TYPE_* value, CHECKSUM_TYPE_NONE (0) if
+	// integrity streams are disabled.
+	ChecksumAlgorithm uint16 `json:"checksum_algorithm"`
+	// Flags contains the FSCTL_INTEGRITY_FLAG_* values.
+	Flags uint32 `json:"flags,omitempty"`
 }
 
 // windowsAttrsToGenericAttributes converts the WindowsAttributes to a generic attributes map using reflection
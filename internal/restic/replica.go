@@ -0,0 +1,14 @@
+package restic
+
+import "time"
+
+// Replica describes a repository which is kept as a hot standby of a primary
+// repository, usually by running "copy" regularly. Replicas only accept
+// changes from commands which replicate data until they are promoted to a
+// primary repository.
+type Replica struct {
+	// Primary is the location of the primary repository, if known.
+	Primary string `json:"primary,omitempty"`
+	// Since is the time at which the repository was marked as a replica.
+	Since time.Time `json:"since"`
+}
@@ -77,6 +77,8 @@ const (
 	SnapshotFile FileType = backend.SnapshotFile
 	IndexFile    FileType = backend.IndexFile
 	ConfigFile   FileType = backend.ConfigFile
+	OpLogFile    FileType = backend.OpLogFile
+	ApprovalFile FileType = backend.ApprovalFile
 )
 
 type WriteableFileType backend.FileType
@@ -84,12 +86,18 @@ type WriteableFileType backend.FileType
 // These are the different data types that can be modified via SaveUnpacked or RemoveUnpacked.
 const (
 	WriteableSnapshotFile WriteableFileType = WriteableFileType(SnapshotFile)
+	WriteableOpLogFile    WriteableFileType = WriteableFileType(OpLogFile)
+	WriteableApprovalFile WriteableFileType = WriteableFileType(ApprovalFile)
 )
 
 func (w *WriteableFileType) ToFileType() FileType {
 	switch *w {
 	case WriteableSnapshotFile:
 		return SnapshotFile
+	case WriteableOpLogFile:
+		return OpLogFile
+	case WriteableApprovalFile:
+		return ApprovalFile
 	default:
 		panic("invalid WriteableFileType")
 	}
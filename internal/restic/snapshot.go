@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/debug"
 )
 
@@ -24,10 +25,28 @@ type Snapshot struct {
 	Excludes []string  `json:"excludes,omitempty"`
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
+	// ChunkerPolynomial is set by "migrate rechunk" to the chunker polynomial
+	// used to split all files of the snapshot.
+	ChunkerPolynomial *chunker.Pol `json:"chunker_polynomial,omitempty"`
 
 	ProgramVersion string           `json:"program_version,omitempty"`
 	Summary        *SnapshotSummary `json:"summary,omitempty"`
 
+	Signature *SnapshotSignature `json:"signature,omitempty"`
+
+	// VSSWriters lists the VSS writers whose components were included in the
+	// snapshot, it is only set for backups with --vss-writers.
+	VSSWriters []VSSWriter `json:"vss_writers,omitempty"`
+
+	// Auxiliary references a tree containing documents which are stored
+	// alongside the backed up data, see AuxiliaryDocument.
+	Auxiliary *ID `json:"auxiliary,omitempty"`
+
+	// AccountNames maps the SIDs found in the Windows security descriptors of
+	// the snapshot to their account names at the time of the backup. It
+	// allows translating the SIDs when restoring to a different computer.
+	AccountNames map[string]string `json:"account_names,omitempty"`
+
 	id *ID // plaintext ID, used during restore
 }
 
@@ -48,6 +67,32 @@ type SnapshotSummary struct {
 	DataAddedPacked     uint64 `json:"data_added_packed"`
 	TotalFilesProcessed uint   `json:"total_files_processed"`
 	TotalBytesProcessed uint64 `json:"total_bytes_processed"`
+	// DedupRatio is the ratio of TotalBytesProcessed to DataAdded. It is
+	// omitted if no data was added.
+	DedupRatio float64 `json:"dedup_ratio,omitempty"`
+	// Classification lists the number and size of the files per content
+	// class, it is only set if the backup ran with --classify.
+	Classification map[string]ContentClassStats `json:"classification,omitempty"`
+}
+
+// ContentClassStats counts the files of a content class in a snapshot.
+type ContentClassStats struct {
+	Files uint   `json:"files"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// Duration returns how long the backup took.
+func (s *SnapshotSummary) Duration() time.Duration {
+	return s.BackupEnd.Sub(s.BackupStart)
+}
+
+// DedupRatio returns the ratio of the bytes processed by a backup to the
+// bytes it added to the repository, or zero if no data was added.
+func DedupRatio(processed, added uint64) float64 {
+	if added == 0 {
+		return 0
+	}
+	return float64(processed) / float64(added)
 }
 
 // NewSnapshot returns an initialized snapshot struct for the current user and
@@ -125,6 +170,19 @@ func (sn Snapshot) ID() *ID {
 	return sn.id
 }
 
+// TreeIDs returns the IDs of all trees referenced by the snapshot, that is the
+// root tree and the tree of the auxiliary documents if there is one.
+func (sn *Snapshot) TreeIDs() IDs {
+	var ids IDs
+	if sn.Tree != nil {
+		ids = append(ids, *sn.Tree)
+	}
+	if sn.Auxiliary != nil {
+		ids = append(ids, *sn.Auxiliary)
+	}
+	return ids
+}
+
 func (sn *Snapshot) fillUserInfo() error {
 	usr, err := user.Current()
 	if err != nil {
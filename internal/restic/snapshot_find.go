@@ -20,15 +20,24 @@ type SnapshotFilter struct {
 	Hosts []string
 	Tags  TagLists
 	Paths []string
+	// Match snapshots created at or after Since and at or before Until. Zero
+	// for no limit.
+	Since time.Time
+	Until time.Time
 	// Match snapshots from before this timestamp. Zero for no limit.
 	TimestampLimit time.Time
 }
 
 func (f *SnapshotFilter) Empty() bool {
-	return len(f.Hosts)+len(f.Tags)+len(f.Paths) == 0
+	return len(f.Hosts)+len(f.Tags)+len(f.Paths) == 0 && f.Since.IsZero() && f.Until.IsZero()
 }
 
-func (f *SnapshotFilter) matches(sn *Snapshot) bool {
+// Matches returns whether sn matches the hosts, tags, paths and time range of
+// the filter.
+func (f *SnapshotFilter) Matches(sn *Snapshot) bool {
+	if (!f.Since.IsZero() && sn.Time.Before(f.Since)) || (!f.Until.IsZero() && sn.Time.After(f.Until)) {
+		return false
+	}
 	return sn.HasHostname(f.Hosts) && sn.HasTagList(f.Tags) && sn.HasPaths(f.Paths)
 }
 
@@ -64,7 +73,7 @@ func (f *SnapshotFilter) findLatest(ctx context.Context, be Lister, loader Loade
 			return nil
 		}
 
-		if !f.matches(snapshot) {
+		if !f.Matches(snapshot) {
 			return nil
 		}
 
@@ -184,7 +193,7 @@ func (f *SnapshotFilter) FindAll(ctx context.Context, be Lister, loader LoaderUn
 	}
 
 	return ForAllSnapshots(ctx, be, loader, nil, func(id ID, sn *Snapshot, err error) error {
-		if err == nil && !f.matches(sn) {
+		if err == nil && !f.Matches(sn) {
 			return nil
 		}
 
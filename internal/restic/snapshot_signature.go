@@ -0,0 +1,115 @@
+package restic
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// SnapshotSignature is an Ed25519 signature of a snapshot, created with a
+// signing key which is kept separately from the repository password.
+type SnapshotSignature struct {
+	KeyID     string `json:"key_id"`
+	Signature []byte `json:"signature"`
+}
+
+var (
+	// ErrSnapshotNotSigned is returned when verifying a snapshot without signature.
+	ErrSnapshotNotSigned = errors.New("snapshot is not signed")
+	// ErrSnapshotSignatureUnknownKey is returned when a snapshot was signed by an unknown key.
+	ErrSnapshotSignatureUnknownKey = errors.New("snapshot is signed by an unknown key")
+	// ErrSnapshotSignatureInvalid is returned when the signature does not match the snapshot.
+	ErrSnapshotSignatureInvalid = errors.New("snapshot signature is invalid")
+)
+
+// signaturePrefix separates snapshot signatures from other uses of the key.
+const signaturePrefix = "restic snapshot signature v1\n"
+
+// SigningKeyID returns a short identifier for the public key.
+func SigningKeyID(key ed25519.PublicKey) string {
+	h := sha256.Sum256(key)
+	return hex.EncodeToString(h[:8])
+}
+
+// signedSnapshotData returns the data covered by the signature of the stored
+// snapshot buf. These are the stored bytes with the members signature,
+// parent and original removed. Parent and original are excluded, these are
+// updated when copying a snapshot to a different repository. All other
+// fields are covered, including those unknown to this version.
+func signedSnapshotData(buf []byte) ([]byte, error) {
+	data, err := removeMembers(buf, "signature", "parent", "original")
+	if errors.Is(err, errDuplicateMember) {
+		return nil, ErrSnapshotSignatureInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(signaturePrefix), data...), nil
+}
+
+// Sign signs the snapshot using key and replaces any existing signature. The
+// signature covers the JSON encoding of the snapshot written by SaveSnapshot.
+func (sn *Snapshot) Sign(key ed25519.PrivateKey) error {
+	tmp := *sn
+	tmp.Signature = nil
+	buf, err := json.Marshal(&tmp)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+	data, err := signedSnapshotData(buf)
+	if err != nil {
+		return err
+	}
+	sn.Signature = &SnapshotSignature{
+		KeyID:     SigningKeyID(key.Public().(ed25519.PublicKey)),
+		Signature: ed25519.Sign(key, data),
+	}
+	return nil
+}
+
+// VerifySignature checks that the snapshot was signed by one of the keys. It
+// returns ErrSnapshotNotSigned, ErrSnapshotSignatureUnknownKey or
+// ErrSnapshotSignatureInvalid if the verification fails. Use
+// VerifySnapshotSignature to check a snapshot as stored in the repository.
+func (sn *Snapshot) VerifySignature(keys []ed25519.PublicKey) error {
+	buf, err := json.Marshal(sn)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+	return VerifySnapshotSignature(buf, keys)
+}
+
+// VerifySnapshotSignature checks the signature of the snapshot stored in buf.
+// It returns ErrSnapshotNotSigned, ErrSnapshotSignatureUnknownKey or
+// ErrSnapshotSignatureInvalid if the verification fails.
+func VerifySnapshotSignature(buf []byte, keys []ed25519.PublicKey) error {
+	var sn struct {
+		Signature *SnapshotSignature `json:"signature"`
+	}
+	if err := json.Unmarshal(buf, &sn); err != nil {
+		return errors.Wrap(err, "Unmarshal")
+	}
+	if sn.Signature == nil {
+		return ErrSnapshotNotSigned
+	}
+
+	for _, key := range keys {
+		if SigningKeyID(key) != sn.Signature.KeyID {
+			continue
+		}
+
+		data, err := signedSnapshotData(buf)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(key, data, sn.Signature.Signature) {
+			return ErrSnapshotSignatureInvalid
+		}
+		return nil
+	}
+
+	return ErrSnapshotSignatureUnknownKey
+}
@@ -0,0 +1,62 @@
+package restic_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSnapshotSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	rtest.OK(t, err)
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	rtest.OK(t, err)
+
+	repo := repository.TestRepository(t)
+	sn, err := restic.NewSnapshot([]string{"/home/foobar"}, []string{"foo"}, "host", time.Unix(1434025801, 0))
+	rtest.OK(t, err)
+	sn.Tree = &restic.ID{42}
+
+	err = sn.VerifySignature([]ed25519.PublicKey{pub})
+	rtest.Assert(t, errors.Is(err, restic.ErrSnapshotNotSigned), "unexpected error %v", err)
+
+	rtest.OK(t, sn.Sign(priv))
+	id, err := restic.SaveSnapshot(context.TODO(), repo, sn)
+	rtest.OK(t, err)
+
+	loaded, err := restic.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	rtest.OK(t, loaded.VerifySignature([]ed25519.PublicKey{otherPub, pub}))
+
+	err = loaded.VerifySignature([]ed25519.PublicKey{otherPub})
+	rtest.Assert(t, errors.Is(err, restic.ErrSnapshotSignatureUnknownKey), "unexpected error %v", err)
+
+	// copying a snapshot updates parent and original, which are not signed
+	loaded.Parent = &restic.ID{23}
+	loaded.Original = &id
+	rtest.OK(t, loaded.VerifySignature([]ed25519.PublicKey{pub}))
+
+	loaded.AddTags([]string{"bar"})
+	err = loaded.VerifySignature([]ed25519.PublicKey{pub})
+	rtest.Assert(t, errors.Is(err, restic.ErrSnapshotSignatureInvalid), "unexpected error %v", err)
+
+	// the stored snapshot is verified including fields unknown to this version
+	buf, err := repo.LoadUnpacked(context.TODO(), restic.SnapshotFile, id)
+	rtest.OK(t, err)
+	rtest.OK(t, restic.VerifySnapshotSignature(buf, []ed25519.PublicKey{pub}))
+	rtest.OK(t, restic.VerifySnapshotSignature(bytes.Replace(buf, []byte(`{`), []byte(`{"parent":"2a",`), 1), []ed25519.PublicKey{pub}))
+	for name, modified := range map[string][]byte{
+		"unknown field":    bytes.Replace(buf, []byte(`{`), []byte(`{"unknown":1,`), 1),
+		"second signature": bytes.Replace(buf, []byte(`{`), []byte(`{"signature":null,`), 1),
+	} {
+		err = restic.VerifySnapshotSignature(modified, []ed25519.PublicKey{pub})
+		rtest.Assert(t, errors.Is(err, restic.ErrSnapshotSignatureInvalid), "%v: unexpected error %v", name, err)
+	}
+}
@@ -49,3 +49,8 @@ func testLoadJSONUnpacked(t *testing.T, version uint) {
 	rtest.Equals(t, sn.Hostname, sn2.Hostname)
 	rtest.Equals(t, sn.Username, sn2.Username)
 }
+
+func TestDedupRatio(t *testing.T) {
+	rtest.Equals(t, 0.0, restic.DedupRatio(1000, 0))
+	rtest.Equals(t, 4.0, restic.DedupRatio(1000, 250))
+}
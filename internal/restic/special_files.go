@@ -0,0 +1,113 @@
+package restic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// SpecialFilesPolicy determines how backup and restore handle device nodes,
+// FIFOs and sockets.
+type SpecialFilesPolicy string
+
+// Supported special files policies.
+const (
+	// SpecialFilesDefault handles device nodes and FIFOs like other files,
+	// sockets are skipped.
+	SpecialFilesDefault SpecialFilesPolicy = ""
+	// SpecialFilesStore includes all special files, including sockets.
+	SpecialFilesStore SpecialFilesPolicy = "store"
+	// SpecialFilesSkip skips all special files.
+	SpecialFilesSkip SpecialFilesPolicy = "skip"
+	// SpecialFilesFail aborts when a special file is found.
+	SpecialFilesFail SpecialFilesPolicy = "fail"
+)
+
+// ErrSpecialFile is returned by SpecialFilesPolicy.Include for the policy
+// SpecialFilesFail.
+var ErrSpecialFile = errors.New("special file found and --special-files=fail is set")
+
+// ParseSpecialFilesPolicy parses s as a special files policy.
+func ParseSpecialFilesPolicy(s string) (SpecialFilesPolicy, error) {
+	switch p := SpecialFilesPolicy(s); p {
+	case SpecialFilesDefault, SpecialFilesStore, SpecialFilesSkip, SpecialFilesFail:
+		return p, nil
+	}
+	return "", errors.Errorf("invalid special files policy %q, must be one of store, skip or fail", s)
+}
+
+// IsSpecial returns true for device nodes, FIFOs and sockets.
+func (t NodeType) IsSpecial() bool {
+	switch t {
+	case NodeTypeDev, NodeTypeCharDev, NodeTypeFifo, NodeTypeSocket:
+		return true
+	}
+	return false
+}
+
+// Include returns whether a special file of type t is included. For the
+// policy SpecialFilesFail, ErrSpecialFile is returned.
+func (p SpecialFilesPolicy) Include(t NodeType) (bool, error) {
+	switch p {
+	case SpecialFilesStore:
+		return true, nil
+	case SpecialFilesSkip:
+		return false, nil
+	case SpecialFilesFail:
+		return false, ErrSpecialFile
+	}
+	return t != NodeTypeSocket, nil
+}
+
+// SpecialFileStats counts the special files included or skipped by backup or
+// restore per type.
+type SpecialFileStats struct {
+	Included map[NodeType]uint `json:"included,omitempty"`
+	Skipped  map[NodeType]uint `json:"skipped,omitempty"`
+}
+
+// Add counts a special file of type t.
+func (s *SpecialFileStats) Add(t NodeType, included bool) {
+	m := &s.Skipped
+	if included {
+		m = &s.Included
+	}
+	if *m == nil {
+		*m = make(map[NodeType]uint)
+	}
+	(*m)[t]++
+}
+
+// Empty returns true if no special files were counted.
+func (s *SpecialFileStats) Empty() bool {
+	return len(s.Included) == 0 && len(s.Skipped) == 0
+}
+
+// Format describes the counts, e.g. "2 dev, 1 fifo stored, 1 socket
+// skipped". The verb describes included files.
+func (s *SpecialFileStats) Format(verb string) string {
+	format := func(m map[NodeType]uint) string {
+		types := make([]string, 0, len(m))
+		for t := range m {
+			types = append(types, string(t))
+		}
+		sort.Strings(types)
+
+		parts := make([]string, 0, len(types))
+		for _, t := range types {
+			parts = append(parts, fmt.Sprintf("%d %s", m[NodeType(t)], t))
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	var parts []string
+	if len(s.Included) > 0 {
+		parts = append(parts, format(s.Included)+" "+verb)
+	}
+	if len(s.Skipped) > 0 {
+		parts = append(parts, format(s.Skipped)+" skipped")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,51 @@
+package restic
+
+import (
+	"errors"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSpecialFilesPolicy(t *testing.T) {
+	for _, test := range []struct {
+		policy   SpecialFilesPolicy
+		included []NodeType
+		err      error
+	}{
+		{SpecialFilesDefault, []NodeType{NodeTypeDev, NodeTypeCharDev, NodeTypeFifo}, nil},
+		{SpecialFilesStore, []NodeType{NodeTypeDev, NodeTypeCharDev, NodeTypeFifo, NodeTypeSocket}, nil},
+		{SpecialFilesSkip, nil, nil},
+		{SpecialFilesFail, nil, ErrSpecialFile},
+	} {
+		p, err := ParseSpecialFilesPolicy(string(test.policy))
+		rtest.OK(t, err)
+		rtest.Equals(t, test.policy, p)
+
+		var included []NodeType
+		for _, typ := range []NodeType{NodeTypeDev, NodeTypeCharDev, NodeTypeFifo, NodeTypeSocket} {
+			rtest.Assert(t, typ.IsSpecial(), "%v is not special", typ)
+			ok, err := p.Include(typ)
+			rtest.Assert(t, errors.Is(err, test.err), "unexpected error %v", err)
+			if ok {
+				included = append(included, typ)
+			}
+		}
+		rtest.Equals(t, test.included, included)
+	}
+
+	_, err := ParseSpecialFilesPolicy("foo")
+	rtest.Assert(t, err != nil, "missing error for invalid policy")
+	rtest.Assert(t, !NodeTypeFile.IsSpecial(), "files are not special")
+}
+
+func TestSpecialFileStats(t *testing.T) {
+	var stats SpecialFileStats
+	rtest.Assert(t, stats.Empty(), "stats not empty")
+	stats.Add(NodeTypeFifo, true)
+	stats.Add(NodeTypeDev, true)
+	stats.Add(NodeTypeFifo, true)
+	stats.Add(NodeTypeSocket, false)
+	rtest.Assert(t, !stats.Empty(), "stats empty")
+	rtest.Equals(t, "1 dev, 2 fifo stored, 1 socket skipped", stats.Format("stored"))
+}
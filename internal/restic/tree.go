@@ -187,6 +187,10 @@ func (builder *TreeJSONBuilder) Finalize() ([]byte, error) {
 	return buf, nil
 }
 
+// ErrDirectoryNotFound is returned by FindTreeDirectory if the directory does
+// not exist.
+var ErrDirectoryNotFound = errors.New("not found")
+
 func FindTreeDirectory(ctx context.Context, repo BlobLoader, id *ID, dir string) (*ID, error) {
 	if id == nil {
 		return nil, errors.New("tree id is null")
@@ -206,7 +210,7 @@ func FindTreeDirectory(ctx context.Context, repo BlobLoader, id *ID, dir string)
 		}
 		node := tree.Find(name)
 		if node == nil {
-			return nil, fmt.Errorf("path %s: not found", subfolder)
+			return nil, fmt.Errorf("path %s: %w", subfolder, ErrDirectoryNotFound)
 		}
 		if node.Type != NodeTypeDir || node.Subtree == nil {
 			return nil, fmt.Errorf("path %s: not a directory", subfolder)
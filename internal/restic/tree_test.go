@@ -241,6 +241,9 @@ func TestFindTreeDirectory(t *testing.T) {
 			} else {
 				rtest.Assert(t, exp.err.Error() == err.Error(), "unexpected err, expected %v, got %v", exp.err, err)
 			}
+			if exp.subfolder == ".." {
+				rtest.Assert(t, errors.Is(err, restic.ErrDirectoryNotFound), "unexpected err %v", err)
+			}
 		})
 	}
 
@@ -0,0 +1,27 @@
+package restic
+
+// VSSWriter describes a VSS writer which took part in the file system
+// snapshot of a backup on Windows. Writers flush the data of applications
+// like SQL Server or Hyper-V to disk before the snapshot is created, such
+// that the backup of the selected components is application-consistent.
+type VSSWriter struct {
+	Name       string `json:"name"`
+	WriterID   string `json:"writer_id"`
+	InstanceID string `json:"instance_id"`
+	// Volume is the volume on which the files of the components are stored.
+	Volume     string         `json:"volume"`
+	Components []VSSComponent `json:"components"`
+	// State is the state of the writer after the snapshot was created,
+	// Error is set if the writer failed.
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// VSSComponent is a component of a VSS writer which was included in a
+// snapshot. Its subcomponents are included implicitly.
+type VSSComponent struct {
+	Name        string `json:"name"`
+	LogicalPath string `json:"logical_path,omitempty"`
+	Type        string `json:"type"`
+	Caption     string `json:"caption,omitempty"`
+}
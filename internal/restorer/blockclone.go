@@ -0,0 +1,71 @@
+package restorer
+
+import (
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// errBlockCloneUnsupported is returned by cloneFileData if the filesystem
+// cannot share extents between the files.
+var errBlockCloneUnsupported = errors.New("block cloning is not supported")
+
+// cloneBufferSize is the size of the buffer used to copy files if block
+// cloning is not supported.
+const cloneBufferSize = 1024 * 1024
+
+// cloneFile creates the file at path with the content of the first size bytes
+// of the file at source. The extents of source are shared with the new file
+// if the filesystem supports block cloning, otherwise the content is copied.
+// It returns whether the extents are shared.
+func (w *filesWriter) cloneFile(source, path string, size int64, sparse bool) (bool, error) {
+	src, err := fs.OpenFile(source, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	f, err := createFile(path, 0, false, w.allowRecursiveDelete)
+	if err != nil {
+		return false, err
+	}
+
+	err = cloneFileData(f, src, size)
+	cloned := err == nil
+	if errors.Is(err, errBlockCloneUnsupported) {
+		err = copyFileData(&partialFile{File: f, sparse: sparse}, src, size)
+	}
+	if err != nil {
+		_ = f.Close()
+		return false, err
+	}
+	return cloned, f.Close()
+}
+
+// copyFileData copies the first size bytes of src to f.
+func copyFileData(f *partialFile, src *os.File, size int64) error {
+	if f.sparse {
+		if err := truncateSparse(f.File, size); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, min(size, cloneBufferSize))
+	for offset := int64(0); offset < size; {
+		n, err := src.ReadAt(buf[:min(size-offset, int64(len(buf)))], offset)
+		if err == io.EOF && n == 0 {
+			return errors.Errorf("%v is shorter than expected", src.Name())
+		} else if err != nil && err != io.EOF {
+			return err
+		}
+		if _, err := f.WriteAt(buf[:n], offset); err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+	return nil
+}
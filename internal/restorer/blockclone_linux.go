@@ -0,0 +1,28 @@
+package restorer
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
+
+// cloneFileData shares the extents of src with the empty file f using the
+// FICLONE ioctl, which is supported by btrfs, XFS and other filesystems with
+// reflink support.
+func cloneFileData(f *os.File, src *os.File, size int64) error {
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != size {
+		return errors.Errorf("%v has size %d instead of %d", src.Name(), fi.Size(), size)
+	}
+
+	err = unix.IoctlFileClone(int(f.Fd()), int(src.Fd()))
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOTTY) ||
+		errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) {
+		return errBlockCloneUnsupported
+	}
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package restorer
+
+import "os"
+
+// cloneFileData is not implemented on this platform.
+func cloneFileData(_ *os.File, _ *os.File, _ int64) error {
+	return errBlockCloneUnsupported
+}
@@ -0,0 +1,95 @@
+package restorer
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/windows"
+)
+
+// maxCloneChunk is the maximum number of bytes cloned using a single
+// FSCTL_DUPLICATE_EXTENTS_TO_FILE call, which must be less than 4 GiB.
+const maxCloneChunk = 1 << 31
+
+// duplicateExtentsData is the DUPLICATE_EXTENTS_DATA structure.
+type duplicateExtentsData struct {
+	FileHandle       windows.Handle
+	SourceFileOffset int64
+	TargetFileOffset int64
+	ByteCount        int64
+}
+
+// integrityInformation is the FSCTL_GET_INTEGRITY_INFORMATION_BUFFER structure.
+type integrityInformation struct {
+	ChecksumAlgorithm        uint16
+	Reserved                 uint16
+	Flags                    uint32
+	ChecksumChunkSizeInBytes uint32
+	ClusterSizeInBytes       uint32
+}
+
+// cloneFileData shares the extents of src with the empty file f using
+// FSCTL_DUPLICATE_EXTENTS_TO_FILE, which is supported by ReFS.
+func cloneFileData(f *os.File, src *os.File, size int64) error {
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != size {
+		return errors.Errorf("%v has size %d instead of %d", src.Name(), fi.Size(), size)
+	}
+
+	// the cloned ranges must be aligned to the cluster size, the integrity
+	// information is only available on filesystems supporting block cloning
+	var info integrityInformation
+	var n uint32
+	err = windows.DeviceIoControl(windows.Handle(src.Fd()), windows.FSCTL_GET_INTEGRITY_INFORMATION,
+		nil, 0, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)), &n, nil)
+	if err != nil || info.ClusterSizeInBytes == 0 {
+		return errBlockCloneUnsupported
+	}
+	clusterSize := int64(info.ClusterSizeInBytes)
+
+	// extents can only be shared between files with the same integrity stream
+	// setting, which the target inherits from its directory
+	var targetInfo integrityInformation
+	err = windows.DeviceIoControl(windows.Handle(f.Fd()), windows.FSCTL_GET_INTEGRITY_INFORMATION,
+		nil, 0, (*byte)(unsafe.Pointer(&targetInfo)), uint32(unsafe.Sizeof(targetInfo)), &n, nil)
+	if err != nil || targetInfo.ChecksumAlgorithm != info.ChecksumAlgorithm || targetInfo.Flags != info.Flags {
+		return errBlockCloneUnsupported
+	}
+
+	// the target must be sparse if the source is sparse
+	if attrs, ok := fi.Sys().(*syscall.Win32FileAttributeData); ok && attrs.FileAttributes&windows.FILE_ATTRIBUTE_SPARSE_FILE != 0 {
+		err = windows.DeviceIoControl(windows.Handle(f.Fd()), windows.FSCTL_SET_SPARSE, nil, 0, nil, 0, &n, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+
+	// the last cluster may extend beyond the end of the file
+	alignedSize := (size + clusterSize - 1) / clusterSize * clusterSize
+	for offset := int64(0); offset < alignedSize; offset += maxCloneChunk {
+		data := duplicateExtentsData{
+			FileHandle:       windows.Handle(src.Fd()),
+			SourceFileOffset: offset,
+			TargetFileOffset: offset,
+			ByteCount:        min(alignedSize-offset, maxCloneChunk),
+		}
+		err = windows.DeviceIoControl(windows.Handle(f.Fd()), windows.FSCTL_DUPLICATE_EXTENTS_TO_FILE,
+			(*byte)(unsafe.Pointer(&data)), uint32(unsafe.Sizeof(data)), nil, 0, &n, nil)
+		if err != nil {
+			if offset == 0 && (errors.Is(err, windows.ERROR_INVALID_FUNCTION) ||
+				errors.Is(err, windows.ERROR_NOT_SUPPORTED) || errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)) {
+				return errBlockCloneUnsupported
+			}
+			return err
+		}
+	}
+	return nil
+}
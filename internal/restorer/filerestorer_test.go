@@ -302,6 +302,68 @@ func TestFileRestorerFrequentBlob(t *testing.T) {
 	}
 }
 
+func setTestFileSizes(repo *TestRepo) {
+	for _, file := range repo.files {
+		file.size = int64(len(repo.fileContent(file)))
+	}
+}
+
+func TestFileRestorerBlockClone(t *testing.T) {
+	for _, sparse := range []bool{false, true} {
+		tempdir := rtest.TempDir(t)
+		blobs := []TestBlob{{"data1-1", "pack1"}, {"data1-2", "pack2"}}
+		content := []TestFile{
+			{name: "file1", blobs: blobs},
+			{name: "file2", blobs: []TestBlob{{"data2-1", "pack1"}}},
+			{name: "file3", blobs: blobs},
+			{name: "file4", blobs: blobs},
+		}
+		repo := newTestRepo(content)
+		setTestFileSizes(repo)
+
+		r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 1, sparse, false, repo.StartWarmup, nil)
+		r.blockClone = true
+		r.files = repo.files
+		rtest.OK(t, r.restoreFiles(context.TODO()))
+
+		for _, file := range repo.files {
+			data, err := os.ReadFile(r.targetPath(file.location))
+			rtest.OK(t, err)
+			rtest.Equals(t, repo.fileContent(file), string(data))
+		}
+	}
+}
+
+func TestFileRestorerBlockCloneError(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	blobs := []TestBlob{{"data1-1", "pack1"}, {"data1-2", "pack1"}}
+	repo := newTestRepo([]TestFile{
+		{name: "file1", blobs: blobs},
+		{name: "file2", blobs: blobs},
+	})
+	setTestFileSizes(repo)
+	// file2 is cloned from file1, which cannot be restored
+	repo.loader = func(ctx context.Context, packID restic.ID, blobs []restic.Blob, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		for _, blob := range blobs {
+			if err := handleBlobFn(blob.BlobHandle, nil, errors.New("load error")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil)
+	r.blockClone = true
+	r.files = repo.files
+	var failed []string
+	r.Error = func(s string, _ error) error {
+		failed = append(failed, s)
+		return nil
+	}
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Equals(t, []string{"file1", "file1", "file2"}, failed)
+}
+
 func TestErrorRestoreFiles(t *testing.T) {
 	tempdir := rtest.TempDir(t)
 	content := []TestFile{
@@ -217,3 +217,29 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 
 	return releaseWriter(wr)
 }
+
+// writeWholeFile creates the file at path with the given content. As the
+// content is written using a single write operation, neither the bookkeeping
+// for concurrent writes nor preallocating the file is necessary.
+func (w *filesWriter) writeWholeFile(path string, blob []byte, sparse bool) error {
+	// discard the old content as the sparse write below skips zeros
+	f, err := createFile(path, 0, false, w.allowRecursiveDelete)
+	if err != nil {
+		return err
+	}
+	if sparse {
+		err = truncateSparse(f, int64(len(blob)))
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	wr := &partialFile{File: f, sparse: sparse}
+	_, err = wr.WriteAt(blob, 0)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -39,6 +39,34 @@ func TestFilesWriterBasic(t *testing.T) {
 	rtest.Equals(t, []byte{2, 2}, buf)
 }
 
+func TestFilesWriterWholeFile(t *testing.T) {
+	dir := rtest.TempDir(t)
+	w := newFilesWriter(1, false)
+
+	path := filepath.Join(dir, "file")
+	rtest.OK(t, w.writeWholeFile(path, []byte{1, 2, 3}, false))
+	buf, err := os.ReadFile(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte{1, 2, 3}, buf)
+
+	// a longer existing file must be truncated
+	rtest.OK(t, os.WriteFile(path, []byte("some longer content"), 0o600))
+	rtest.OK(t, w.writeWholeFile(path, []byte{4, 5}, false))
+	buf, err = os.ReadFile(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte{4, 5}, buf)
+
+	// sparse files must still have the correct size
+	rtest.OK(t, w.writeWholeFile(path, []byte{0, 0, 0, 6}, true))
+	buf, err = os.ReadFile(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte{0, 0, 0, 6}, buf)
+	rtest.OK(t, w.writeWholeFile(path, []byte{0, 0}, true))
+	buf, err = os.ReadFile(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte{0, 0}, buf)
+}
+
 func TestFilesWriterRecursiveOverwrite(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "test")
 
@@ -0,0 +1,205 @@
+package restorer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// CaseCollisionBehavior selects how files whose names collide on the target
+// are restored. This happens for names which only differ in case, like "File"
+// and "file", on a case-insensitive filesystem, or for names which become
+// identical after normalization. The first file in the directory is always
+// restored under its original name.
+type CaseCollisionBehavior int
+
+// Constants for different case collision behavior
+const (
+	// CaseCollisionRename restores the other files under a new name.
+	CaseCollisionRename CaseCollisionBehavior = iota
+	// CaseCollisionSkip does not restore the other files.
+	CaseCollisionSkip
+	// CaseCollisionFail aborts the restore before any file content is
+	// written.
+	CaseCollisionFail
+	CaseCollisionInvalid
+)
+
+// ErrNameCollision is returned for CaseCollisionFail if the names of two
+// files collide on the target.
+var ErrNameCollision = errors.New("file names collide on the target")
+
+// Set implements the method needed for pflag command flag parsing.
+func (c *CaseCollisionBehavior) Set(s string) error {
+	switch s {
+	case "rename":
+		*c = CaseCollisionRename
+	case "skip":
+		*c = CaseCollisionSkip
+	case "fail":
+		*c = CaseCollisionFail
+	default:
+		*c = CaseCollisionInvalid
+		return fmt.Errorf("invalid case collision behavior %q, must be one of (rename|skip|fail)", s)
+	}
+
+	return nil
+}
+
+func (c *CaseCollisionBehavior) String() string {
+	switch *c {
+	case CaseCollisionRename:
+		return "rename"
+	case CaseCollisionSkip:
+		return "skip"
+	case CaseCollisionFail:
+		return "fail"
+	default:
+		return "invalid"
+	}
+}
+
+func (c *CaseCollisionBehavior) Type() string {
+	return "behavior"
+}
+
+// NameCollision describes a file which was not restored under its original
+// name, because its name collides with another file in the same directory.
+type NameCollision struct {
+	// Location is the path of the file in the snapshot.
+	Location string
+	// Other is the location of the file restored under the original name.
+	Other string
+	// Target is the path the file was restored to, it is empty if the file
+	// was skipped.
+	Target string
+}
+
+// foldCase returns the name used to compare file names on case-insensitive
+// filesystems.
+func foldCase(name string) string {
+	return strings.ToUpper(name)
+}
+
+// isCaseInsensitive checks whether the filesystem containing dir treats file
+// names case-insensitively, by creating a file and looking it up using an
+// upper case name.
+func isCaseInsensitive(dir string) (bool, error) {
+	f, err := os.CreateTemp(dir, ".restic-case-probe-")
+	if err != nil {
+		return false, err
+	}
+	name := f.Name()
+	_ = f.Close()
+	defer func() {
+		_ = fs.Remove(name)
+	}()
+
+	_, err = fs.Lstat(filepath.Join(dir, foldCase(filepath.Base(name))))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// defaultCaseInsensitive guesses whether the target is case-insensitive
+// without writing to it, based on the default filesystem of the platform.
+func defaultCaseInsensitive() bool {
+	return runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+}
+
+// renamedCollision returns the n-th alternative name for name.
+func renamedCollision(name string, isDir bool, n int) string {
+	ext := filepath.Ext(name)
+	if isDir || ext == name {
+		ext = ""
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// collisionKey returns the key used to detect colliding names on the target.
+func (res *Restorer) collisionKey(name string) string {
+	if res.caseInsensitive {
+		return foldCase(name)
+	}
+	return name
+}
+
+// targetNames returns the names under which the nodes of the directory at
+// location are restored to target. An empty name means that the node is
+// skipped. Only nodes for which restore is true are considered. Unless the
+// names are normalized or the target is case-insensitive, the names are not
+// changed.
+func (res *Restorer) targetNames(location, target string, nodes []*restic.Node, restore func(*restic.Node) bool) ([]string, error) {
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = res.opts.NormalizeNames.normalize(node.Name)
+	}
+	if !res.caseInsensitive && res.opts.NormalizeNames == NormalizePreserve {
+		return names, nil
+	}
+
+	// used maps the keys of the names in use to the original name
+	used := make(map[string]string, len(nodes))
+	var colliding []int
+	for i, node := range nodes {
+		if !restore(node) {
+			continue
+		}
+		key := res.collisionKey(names[i])
+		if _, ok := used[key]; ok {
+			colliding = append(colliding, i)
+			continue
+		}
+		used[key] = node.Name
+	}
+
+	for _, i := range colliding {
+		node := nodes[i]
+		c := NameCollision{
+			Location: filepath.Join(location, node.Name),
+			Other:    filepath.Join(location, used[res.collisionKey(names[i])]),
+		}
+
+		switch res.opts.CaseCollision {
+		case CaseCollisionFail:
+			return nil, fmt.Errorf("%w: %v and %v", ErrNameCollision, c.Other, c.Location)
+		case CaseCollisionSkip:
+			names[i] = ""
+		default:
+			var name string
+			for n := 2; ; n++ {
+				name = renamedCollision(names[i], node.Type == restic.NodeTypeDir, n)
+				if _, ok := used[res.collisionKey(name)]; !ok {
+					break
+				}
+			}
+			used[res.collisionKey(name)] = node.Name
+			names[i] = name
+			c.Target = filepath.Join(target, name)
+		}
+
+		res.nameCollisions[c.Location] = c
+	}
+	return names, nil
+}
+
+// NameCollisions returns the files which were renamed or skipped because
+// their name collides with another file in the same directory.
+func (res *Restorer) NameCollisions() []NameCollision {
+	list := make([]NameCollision, 0, len(res.nameCollisions))
+	for _, c := range res.nameCollisions {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Location < list[j].Location
+	})
+	return list
+}
@@ -0,0 +1,187 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerCaseCollision(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"Dir":  Dir{Nodes: map[string]Node{"x": File{Data: "x"}}},
+			"File": File{Data: "upper"},
+			"dir": Dir{Nodes: map[string]Node{
+				"a.txt":     File{Data: "1"},
+				"A.TXT":     File{Data: "2"},
+				"A (2).txt": File{Data: "3"},
+			}},
+			"file": File{Data: "lower"},
+		},
+	}
+
+	for _, test := range []struct {
+		behavior        CaseCollisionBehavior
+		caseInsensitive bool
+		files           map[string]string
+		collisions      []NameCollision
+	}{
+		{
+			behavior:        CaseCollisionRename,
+			caseInsensitive: false,
+			files: map[string]string{
+				"Dir/x": "x", "File": "upper", "dir/a.txt": "1", "dir/A.TXT": "2", "dir/A (2).txt": "3", "file": "lower",
+			},
+		},
+		{
+			behavior:        CaseCollisionRename,
+			caseInsensitive: true,
+			files: map[string]string{
+				"Dir/x": "x", "File": "upper", "dir (2)/a (3).txt": "1", "dir (2)/A.TXT": "2", "dir (2)/A (2).txt": "3", "file (2)": "lower",
+			},
+			collisions: []NameCollision{
+				{Location: "/dir", Other: "/Dir", Target: "dir (2)"},
+				{Location: "/dir/a.txt", Other: "/dir/A.TXT", Target: "dir (2)/a (3).txt"},
+				{Location: "/file", Other: "/File", Target: "file (2)"},
+			},
+		},
+		{
+			behavior:        CaseCollisionSkip,
+			caseInsensitive: true,
+			files:           map[string]string{"Dir/x": "x", "File": "upper"},
+			collisions: []NameCollision{
+				{Location: "/dir", Other: "/Dir"},
+				{Location: "/file", Other: "/File"},
+			},
+		},
+		{
+			behavior:        CaseCollisionFail,
+			caseInsensitive: true,
+		},
+	} {
+		t.Run(test.behavior.String(), func(t *testing.T) {
+			repo := repository.TestRepository(t)
+			sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+
+			res := NewRestorer(repo, sn, Options{CaseCollision: test.behavior})
+			res.caseProbe = func(string) (bool, error) {
+				return test.caseInsensitive, nil
+			}
+
+			tempdir := rtest.TempDir(t)
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			if test.behavior == CaseCollisionFail {
+				rtest.Assert(t, errors.Is(err, ErrNameCollision), "expected case collision error, got %v", err)
+				return
+			}
+			rtest.OK(t, err)
+
+			files := make(map[string]string)
+			rtest.OK(t, filepath.Walk(tempdir, func(path string, fi os.FileInfo, err error) error {
+				if err != nil || fi.IsDir() {
+					return err
+				}
+				data, err := os.ReadFile(path)
+				rtest.OK(t, err)
+				rel, err := filepath.Rel(tempdir, path)
+				rtest.OK(t, err)
+				files[filepath.ToSlash(rel)] = string(data)
+				return nil
+			}))
+			rtest.Equals(t, test.files, files)
+
+			collisions := res.NameCollisions()
+			for i := range collisions {
+				collisions[i].Location = filepath.ToSlash(collisions[i].Location)
+				collisions[i].Other = filepath.ToSlash(collisions[i].Other)
+				if collisions[i].Target != "" {
+					rel, err := filepath.Rel(tempdir, collisions[i].Target)
+					rtest.OK(t, err)
+					collisions[i].Target = filepath.ToSlash(rel)
+				}
+			}
+			if test.collisions == nil {
+				test.collisions = []NameCollision{}
+			}
+			rtest.Equals(t, test.collisions, collisions)
+		})
+	}
+}
+
+func TestIsCaseInsensitive(t *testing.T) {
+	dir := rtest.TempDir(t)
+	_, err := isCaseInsensitive(dir)
+	rtest.OK(t, err)
+
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(entries))
+}
+
+func TestRestorerNormalizeNames(t *testing.T) {
+	const (
+		cafeNFC   = "café"
+		cafeNFD   = "café"
+		resumeNFC = "résumé.txt"
+		resumeNFD = "résumé.txt"
+	)
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			cafeNFC:   File{Data: "composed"},
+			cafeNFD:   File{Data: "decomposed"},
+			resumeNFD: File{Data: "resume"},
+		},
+	}
+
+	for _, test := range []struct {
+		form  NormalizationForm
+		files map[string]string
+	}{
+		{
+			form:  NormalizePreserve,
+			files: map[string]string{cafeNFC: "composed", cafeNFD: "decomposed", resumeNFD: "resume"},
+		},
+		{
+			// the decomposed name sorts first and keeps the name
+			form:  NormalizeNFC,
+			files: map[string]string{cafeNFC: "decomposed", cafeNFC + " (2)": "composed", resumeNFC: "resume"},
+		},
+		{
+			form:  NormalizeNFD,
+			files: map[string]string{cafeNFD: "decomposed", cafeNFD + " (2)": "composed", resumeNFD: "resume"},
+		},
+	} {
+		t.Run(test.form.String(), func(t *testing.T) {
+			repo := repository.TestRepository(t)
+			sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+
+			res := NewRestorer(repo, sn, Options{NormalizeNames: test.form})
+			res.caseProbe = func(string) (bool, error) {
+				return false, nil
+			}
+
+			tempdir := rtest.TempDir(t)
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.OK(t, err)
+
+			entries, err := os.ReadDir(tempdir)
+			rtest.OK(t, err)
+			files := make(map[string]string)
+			for _, entry := range entries {
+				data, err := os.ReadFile(filepath.Join(tempdir, entry.Name()))
+				rtest.OK(t, err)
+				files[entry.Name()] = string(data)
+			}
+			rtest.Equals(t, test.files, files)
+
+			if test.form != NormalizePreserve {
+				rtest.Equals(t, 1, len(res.NameCollisions()))
+			}
+		})
+	}
+}
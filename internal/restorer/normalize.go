@@ -0,0 +1,69 @@
+package restorer
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizationForm selects the Unicode normalization form of restored file
+// names. macOS stores file names in decomposed form (NFD), while Windows and
+// most Linux applications expect the composed form (NFC). Without
+// normalization, a file name can look identical to another one but refer to
+// a different file.
+type NormalizationForm int
+
+// Constants for the supported normalization forms
+const (
+	// NormalizePreserve restores file names unchanged.
+	NormalizePreserve NormalizationForm = iota
+	NormalizeNFC
+	NormalizeNFD
+	NormalizeInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (f *NormalizationForm) Set(s string) error {
+	switch s {
+	case "preserve":
+		*f = NormalizePreserve
+	case "nfc":
+		*f = NormalizeNFC
+	case "nfd":
+		*f = NormalizeNFD
+	default:
+		*f = NormalizeInvalid
+		return fmt.Errorf("invalid normalization form %q, must be one of (nfc|nfd|preserve)", s)
+	}
+
+	return nil
+}
+
+func (f *NormalizationForm) String() string {
+	switch *f {
+	case NormalizePreserve:
+		return "preserve"
+	case NormalizeNFC:
+		return "nfc"
+	case NormalizeNFD:
+		return "nfd"
+	default:
+		return "invalid"
+	}
+}
+
+func (f *NormalizationForm) Type() string {
+	return "form"
+}
+
+// normalize returns name in the normalization form f.
+func (f NormalizationForm) normalize(name string) string {
+	switch f {
+	case NormalizeNFC:
+		return norm.NFC.String(name)
+	case NormalizeNFD:
+		return norm.NFD.String(name)
+	default:
+		return name
+	}
+}
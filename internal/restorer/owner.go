@@ -0,0 +1,117 @@
+package restorer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// sidMapper translates the SIDs stored in a snapshot to the SIDs of the
+// accounts with the same name on this computer, using the account names
+// recorded at backup time.
+type sidMapper struct {
+	names  map[string]string
+	host   string
+	lookup func(name string) (string, error)
+	warn   func(message string)
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func newSIDMapper(sn *restic.Snapshot, lookup func(name string) (string, error), warn func(message string)) *sidMapper {
+	return &sidMapper{
+		names:  sn.AccountNames,
+		host:   sn.Hostname,
+		lookup: lookup,
+		warn:   warn,
+		cache:  make(map[string]string),
+	}
+}
+
+// Map returns the SID of the account on this computer which has the same name
+// as the account of sid at backup time. Local accounts of the backed up
+// computer are looked up by their name without the computer name. If no such
+// account exists, sid is returned unchanged.
+func (m *sidMapper) Map(sid string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mapped, ok := m.cache[sid]; ok {
+		return mapped
+	}
+
+	mapped, err := m.translate(sid)
+	if err != nil {
+		m.warn(fmt.Sprintf("%v, restoring the SID unchanged", err))
+		mapped = sid
+	} else if mapped != sid {
+		debug.Log("translated SID %v of %v to %v", sid, m.names[sid], mapped)
+	}
+	m.cache[sid] = mapped
+	return mapped
+}
+
+func (m *sidMapper) translate(sid string) (string, error) {
+	name, ok := m.names[sid]
+	if !ok {
+		return "", fmt.Errorf("account name of SID %v is unknown", sid)
+	}
+
+	mapped, err := m.lookup(name)
+	if err == nil {
+		return mapped, nil
+	}
+	if domain, account, ok := strings.Cut(name, `\`); ok && strings.EqualFold(domain, m.host) {
+		if mapped, err := m.lookup(account); err == nil {
+			return mapped, nil
+		}
+	}
+	return "", fmt.Errorf("account %v of SID %v not found: %w", name, sid, err)
+}
+
+// withoutSecurityDescriptor returns a copy of node without the Windows
+// security descriptor.
+func withoutSecurityDescriptor(node *restic.Node) *restic.Node {
+	if _, ok := node.GenericAttributes[restic.TypeSecurityDescriptor]; !ok {
+		return node
+	}
+	n := *node
+	n.GenericAttributes = make(map[restic.GenericAttributeType]json.RawMessage, len(node.GenericAttributes))
+	for k, v := range node.GenericAttributes {
+		if k != restic.TypeSecurityDescriptor {
+			n.GenericAttributes[k] = v
+		}
+	}
+	return &n
+}
+
+// mapSecurityDescriptor returns a copy of node whose Windows security
+// descriptor contains the SIDs returned by mapSID.
+func mapSecurityDescriptor(node *restic.Node, mapSID func(sid string) string) (*restic.Node, error) {
+	raw, ok := node.GenericAttributes[restic.TypeSecurityDescriptor]
+	if !ok {
+		return node, nil
+	}
+	var sd []byte
+	if err := json.Unmarshal(raw, &sd); err != nil {
+		return nil, fmt.Errorf("parsing security descriptor: %w", err)
+	}
+	mapped, err := fs.MapSecurityDescriptorSIDs(sd, mapSID)
+	if err != nil {
+		return nil, fmt.Errorf("translating SIDs of the security descriptor: %w", err)
+	}
+	raw, err = json.Marshal(mapped)
+	if err != nil {
+		return nil, err
+	}
+
+	n := withoutSecurityDescriptor(node)
+	n.GenericAttributes[restic.TypeSecurityDescriptor] = raw
+	return n, nil
+}
@@ -0,0 +1,107 @@
+package restorer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSIDMapper(t *testing.T) {
+	sn := &restic.Snapshot{
+		Hostname: "oldhost",
+		AccountNames: map[string]string{
+			"S-1-5-21-1-2-3-1001": `OLDHOST\alice`,
+			"S-1-5-21-7-8-9-1105": `CORP\bob`,
+			"S-1-5-21-1-2-3-1002": `OLDHOST\carol`,
+			"S-1-5-32-544":        `BUILTIN\Administrators`,
+		},
+	}
+	accounts := map[string]string{
+		"alice":                  "S-1-5-21-4-5-6-1001",
+		`CORP\bob`:               "S-1-5-21-7-8-9-1105",
+		`BUILTIN\Administrators`: "S-1-5-32-544",
+	}
+	lookups := 0
+	lookup := func(name string) (string, error) {
+		lookups++
+		if sid, ok := accounts[name]; ok {
+			return sid, nil
+		}
+		return "", fmt.Errorf("account %v not found", name)
+	}
+	var warnings []string
+	m := newSIDMapper(sn, lookup, func(message string) {
+		warnings = append(warnings, message)
+	})
+
+	for _, test := range []struct {
+		sid, want string
+	}{
+		// local account of the backed up computer
+		{"S-1-5-21-1-2-3-1001", "S-1-5-21-4-5-6-1001"},
+		// domain account
+		{"S-1-5-21-7-8-9-1105", "S-1-5-21-7-8-9-1105"},
+		{"S-1-5-32-544", "S-1-5-32-544"},
+		// unknown account on this computer
+		{"S-1-5-21-1-2-3-1002", "S-1-5-21-1-2-3-1002"},
+		// no account name stored
+		{"S-1-5-21-1-2-3-1003", "S-1-5-21-1-2-3-1003"},
+	} {
+		rtest.Equals(t, test.want, m.Map(test.sid))
+	}
+	rtest.Equals(t, 2, len(warnings))
+	rtest.Assert(t, strings.Contains(warnings[0], "S-1-5-21-1-2-3-1002"), "unexpected warning %q", warnings[0])
+	rtest.Assert(t, strings.Contains(warnings[1], "S-1-5-21-1-2-3-1003"), "unexpected warning %q", warnings[1])
+
+	// results are cached
+	n := lookups
+	m.Map("S-1-5-21-1-2-3-1001")
+	m.Map("S-1-5-21-1-2-3-1002")
+	rtest.Equals(t, n, lookups)
+	rtest.Equals(t, 2, len(warnings))
+}
+
+func TestWithoutSecurityDescriptor(t *testing.T) {
+	node := &restic.Node{
+		Name: "file",
+		GenericAttributes: map[restic.GenericAttributeType]json.RawMessage{
+			restic.TypeSecurityDescriptor: json.RawMessage(`"AQAEgA=="`),
+			restic.TypeFileAttributes:     json.RawMessage(`32`),
+		},
+	}
+	stripped := withoutSecurityDescriptor(node)
+	rtest.Equals(t, map[restic.GenericAttributeType]json.RawMessage{
+		restic.TypeFileAttributes: json.RawMessage(`32`),
+	}, stripped.GenericAttributes)
+	// the original node is unchanged
+	rtest.Equals(t, 2, len(node.GenericAttributes))
+
+	other := &restic.Node{Name: "other"}
+	rtest.Assert(t, withoutSecurityDescriptor(other) == other, "node without security descriptor was copied")
+}
+
+func TestMapSecurityDescriptor(t *testing.T) {
+	node := &restic.Node{
+		Name: "file",
+		GenericAttributes: map[restic.GenericAttributeType]json.RawMessage{
+			restic.TypeSecurityDescriptor: json.RawMessage(`"AQAEgA=="`),
+		},
+	}
+	mapped, err := mapSecurityDescriptor(node, func(sid string) string { return sid })
+	rtest.OK(t, err)
+	rtest.Assert(t, mapped != node, "node was not copied")
+	rtest.Equals(t, 1, len(mapped.GenericAttributes))
+
+	other := &restic.Node{Name: "other"}
+	mapped, err = mapSecurityDescriptor(other, func(sid string) string { return sid })
+	rtest.OK(t, err)
+	rtest.Assert(t, mapped == other, "node without security descriptor was copied")
+
+	node.GenericAttributes[restic.TypeSecurityDescriptor] = json.RawMessage(`42`)
+	_, err = mapSecurityDescriptor(node, func(sid string) string { return sid })
+	rtest.Assert(t, err != nil, "expected error for invalid security descriptor")
+}
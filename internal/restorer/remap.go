@@ -0,0 +1,99 @@
+package restorer
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// remapDirName is the directory below the target in which entries with an
+// overlong path are restored.
+const remapDirName = "restic-remapped"
+
+// RemappedPath describes an entry which was restored to a different path as
+// its original path exceeds the maximum path length.
+type RemappedPath struct {
+	// Location is the path of the entry in the snapshot.
+	Location string `json:"location"`
+	// Original is the path the entry would have been restored to.
+	Original string `json:"original"`
+	// Target is the path the entry was restored to.
+	Target string `json:"target"`
+}
+
+// pathLength returns the length of path in UTF-16 code units, which is how
+// Windows and SMB servers measure path lengths.
+func pathLength(path string) int {
+	n := 0
+	for _, r := range path {
+		if r >= 0x10000 && r <= unicode.MaxRune {
+			// encoded as surrogate pair
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// shortenName truncates name to at most max UTF-16 code units, preserving
+// the extension if possible. It returns an empty string if that is not
+// possible.
+func shortenName(name string, max int) string {
+	if pathLength(name) <= max {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if ext == name || pathLength(ext) >= max {
+		ext = ""
+	}
+	base := []rune(strings.TrimSuffix(name, ext))
+	for len(base) > 0 && pathLength(string(base))+pathLength(ext) > max {
+		base = base[:len(base)-1]
+	}
+	if len(base) == 0 {
+		return ""
+	}
+	return string(base) + ext
+}
+
+// remapTarget returns the path to which the entry at location is restored.
+// If target exceeds the maximum path length, the entry is placed in a new
+// directory below remapDirName in the root of the restore target, with its
+// name shortened if necessary. The same location is always mapped to the
+// same path.
+func (res *Restorer) remapTarget(location, target string) (string, error) {
+	if res.opts.MaxPathLength <= 0 || pathLength(target) <= res.opts.MaxPathLength {
+		return target, nil
+	}
+	if r, ok := res.remapped[location]; ok {
+		return r.Target, nil
+	}
+
+	dir := filepath.Join(res.remapRoot, fmt.Sprintf("%06d", len(res.remapped)+1))
+	// leave room for the separator
+	name := shortenName(filepath.Base(target), res.opts.MaxPathLength-pathLength(dir)-1)
+	if name == "" {
+		return "", fmt.Errorf("path exceeds the maximum length of %d, remapping it to %v would not be shorter", res.opts.MaxPathLength, dir)
+	}
+
+	r := RemappedPath{Location: location, Original: target, Target: filepath.Join(dir, name)}
+	res.remapped[location] = r
+	return r.Target, nil
+}
+
+// RemappedPaths returns the entries which were restored to a different path,
+// as their path exceeded the maximum length.
+func (res *Restorer) RemappedPaths() []RemappedPath {
+	list := make([]RemappedPath, 0, len(res.remapped))
+	for _, r := range res.remapped {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Location < list[j].Location
+	})
+	return list
+}
@@ -0,0 +1,112 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestShortenName(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		max      int
+		expected string
+	}{
+		{"file.txt", 8, "file.txt"},
+		{"file.txt", 7, "fil.txt"},
+		{"file.txt", 5, "f.txt"},
+		{"file.txt", 4, "file"},
+		{"file.txt", 0, ""},
+		{".profile", 4, ".pro"},
+		{"\U0001F600\U0001F600.txt", 7, "\U0001F600.txt"},
+		{"\U0001F600\U0001F600.txt", 3, "\U0001F600"},
+	} {
+		rtest.Equals(t, test.expected, shortenName(test.name, test.max))
+	}
+}
+
+func TestRestorerMaxPathLength(t *testing.T) {
+	const (
+		longFile = "a-very-long-file-name-which-exceeds-it.txt"
+		longDir  = "directory-with-a-rather-long-n"
+	)
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			longFile: File{Data: "long"},
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"short": File{Data: "short"},
+					longDir: Dir{
+						Nodes: map[string]Node{
+							"file.txt": File{Data: "nested"},
+						},
+					},
+				},
+			},
+		},
+	}, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	opts := Options{MaxPathLength: pathLength(tempdir) + 40}
+	res := NewRestorer(repo, sn, opts)
+	countRestoredFiles, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	remapDir := filepath.Join(tempdir, remapDirName)
+	files := map[string]string{
+		filepath.Join(tempdir, "dir", "short"):                "short",
+		filepath.Join(remapDir, "000001", "a-very-long-.txt"): "long",
+		filepath.Join(remapDir, "000002", "file.txt"):         "nested",
+	}
+	for path, content := range files {
+		data, err := os.ReadFile(path)
+		rtest.OK(t, err)
+		rtest.Equals(t, content, string(data))
+	}
+	_, err = os.Stat(filepath.Join(tempdir, "dir", longDir))
+	rtest.OK(t, err)
+
+	rtest.Equals(t, []RemappedPath{
+		{
+			Location: filepath.FromSlash("/" + longFile),
+			Original: filepath.Join(tempdir, longFile),
+			Target:   filepath.Join(remapDir, "000001", "a-very-long-.txt"),
+		},
+		{
+			Location: filepath.FromSlash("/dir/" + longDir + "/file.txt"),
+			Original: filepath.Join(tempdir, "dir", longDir, "file.txt"),
+			Target:   filepath.Join(remapDir, "000002", "file.txt"),
+		},
+	}, res.RemappedPaths())
+
+	nverified, err := res.VerifyFiles(context.TODO(), tempdir, countRestoredFiles, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, nverified)
+
+	// restoring again with --delete must keep the remapped files
+	opts.Delete = true
+	res = NewRestorer(repo, sn, opts)
+	_, err = res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	_, err = os.Stat(filepath.Join(remapDir, "000002", "file.txt"))
+	rtest.OK(t, err)
+}
+
+func TestRestorerMaxPathLengthTooShort(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"a-long-file-name": File{Data: "long"},
+		},
+	}, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	res := NewRestorer(repo, sn, Options{MaxPathLength: pathLength(tempdir) + 10})
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.Assert(t, err != nil, "expected error for too short maximum path length")
+}
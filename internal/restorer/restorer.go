@@ -6,11 +6,13 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"sync/atomic"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui/progress"
 	restoreui "github.com/restic/restic/internal/ui/restore"
@@ -25,6 +27,28 @@ type Restorer struct {
 	opts Options
 
 	fileList map[string]bool
+	warnMu   sync.Mutex
+	// streamsUnsupported reports once that alternate data streams cannot be
+	// restored on this platform.
+	streamsUnsupported sync.Once
+	// sids translates the SIDs for opts.RestoreOwner and opts.MapSIDsByName.
+	sids *sidMapper
+
+	// caseInsensitive is set if the target filesystem is case-insensitive,
+	// caseProbe detects this.
+	caseInsensitive bool
+	caseProbe       func(dir string) (bool, error)
+	nameCollisions  map[string]NameCollision
+
+	// remapped contains the entries restored below remapRoot as their path
+	// exceeds opts.MaxPathLength, indexed by location.
+	remapped  map[string]RemappedPath
+	remapRoot string
+
+	specialFiles restic.SpecialFileStats
+	// rewrittenSymlinks counts the symlinks whose target was changed by
+	// opts.RewriteSymlinks.
+	rewrittenSymlinks uint
 
 	Error func(location string, err error) error
 	Warn  func(message string)
@@ -44,6 +68,32 @@ type Options struct {
 	Progress  *restoreui.Progress
 	Overwrite OverwriteBehavior
 	Delete    bool
+	// CaseCollision selects how to restore files whose names collide on the
+	// target, see CaseCollisionBehavior.
+	CaseCollision CaseCollisionBehavior
+	// NormalizeNames selects the Unicode normalization form of file names.
+	NormalizeNames NormalizationForm
+	// MaxPathLength is the maximum length of a path on the target in UTF-16
+	// code units. Entries with a longer path are restored below a directory
+	// in the target instead, see RemappedPaths. Zero means no limit.
+	MaxPathLength int
+	// SpecialFiles selects which device nodes, FIFOs and sockets are
+	// restored.
+	SpecialFiles restic.SpecialFilesPolicy
+	// RewriteSymlinks is applied to the targets of restored symlinks.
+	RewriteSymlinks SymlinkRewrites
+	// BlockClone restores files with identical content only once and clones
+	// the other files, sharing their extents on filesystems which support
+	// block cloning.
+	BlockClone bool
+	// RestoreOwner only restores the owner and group of the Windows security
+	// descriptors instead of the full security descriptors. The SIDs are
+	// translated using the account names stored in the snapshot.
+	RestoreOwner bool
+	// MapSIDsByName translates all SIDs of the Windows security descriptors,
+	// including those in the access control lists, to the SIDs of the
+	// accounts with the same name on this computer.
+	MapSIDsByName bool
 }
 
 type OverwriteBehavior int
@@ -103,11 +153,17 @@ func NewRestorer(repo restic.Repository, sn *restic.Snapshot, opts Options) *Res
 		repo:              repo,
 		opts:              opts,
 		fileList:          make(map[string]bool),
+		caseProbe:         isCaseInsensitive,
+		nameCollisions:    make(map[string]NameCollision),
+		remapped:          make(map[string]RemappedPath),
 		Error:             restorerAbortOnAllErrors,
 		SelectFilter:      func(string, bool) (bool, bool) { return true, true },
 		XattrSelectFilter: func(string) bool { return true },
 		sn:                sn,
 	}
+	if opts.RestoreOwner || opts.MapSIDsByName {
+		r.sids = newSIDMapper(sn, fs.LookupAccountSID, r.warn)
+	}
 
 	return r
 }
@@ -118,9 +174,17 @@ type treeVisitor struct {
 	// 'entries' contains all files the snapshot contains for this node. This also includes files
 	// ignored by the SelectFilter.
 	leaveDir func(node *restic.Node, target, location string, entries []string) error
+	// skipSpecial is called for selected special files which are not
+	// restored due to the SpecialFiles policy.
+	skipSpecial func(node *restic.Node, location string)
 }
 
 func (res *Restorer) sanitizeError(location string, err error) error {
+	if errors.Is(err, ErrNameCollision) || errors.Is(err, restic.ErrSpecialFile) {
+		// abort the restore as requested
+		return err
+	}
+
 	switch err {
 	case nil, context.Canceled, context.DeadlineExceeded:
 		// Context errors are permanent.
@@ -134,6 +198,7 @@ func (res *Restorer) sanitizeError(location string, err error) error {
 // target is the path in the file system, location within the snapshot.
 func (res *Restorer) traverseTree(ctx context.Context, target string, treeID restic.ID, visitor treeVisitor) error {
 	location := string(filepath.Separator)
+	res.remapRoot = filepath.Join(target, remapDirName)
 
 	if visitor.enterDir != nil {
 		err := res.sanitizeError(location, visitor.enterDir(nil, target, location))
@@ -145,6 +210,9 @@ func (res *Restorer) traverseTree(ctx context.Context, target string, treeID res
 	if err != nil {
 		return err
 	}
+	if len(res.remapped) > 0 {
+		childFilenames = append(childFilenames, remapDirName)
+	}
 	if hasRestored && visitor.leaveDir != nil {
 		err = res.sanitizeError(location, visitor.leaveDir(nil, target, location, childFilenames))
 	}
@@ -160,6 +228,19 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 		return nil, hasRestored, res.sanitizeError(location, err)
 	}
 
+	targetNames, err := res.targetNames(location, target, tree.Nodes, func(node *restic.Node) bool {
+		if node.Type.IsSpecial() {
+			if include, _ := res.opts.SpecialFiles.Include(node.Type); !include {
+				return false
+			}
+		}
+		selected, childMayBeSelected := res.SelectFilter(filepath.Join(location, node.Name), node.Type == restic.NodeTypeDir)
+		return selected || (childMayBeSelected && node.Type == restic.NodeTypeDir)
+	})
+	if err != nil {
+		return nil, hasRestored, res.sanitizeError(location, err)
+	}
+
 	if res.opts.Delete {
 		filenames = make([]string, 0, len(tree.Nodes))
 	}
@@ -170,10 +251,14 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 
 		// allow GC of tree node
 		tree.Nodes[i] = nil
+		if targetNames[i] == "" {
+			debug.Log("skipping %q due to a name collision", node.Name)
+			continue
+		}
 		if res.opts.Delete {
 			// just track all files included in the tree node to simplify the control flow.
 			// tracking too many files does not matter except for a slightly elevated memory usage
-			filenames = append(filenames, node.Name)
+			filenames = append(filenames, targetNames[i])
 		}
 
 		// ensure that the node name does not contain anything that refers to a
@@ -190,7 +275,7 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 			continue
 		}
 
-		nodeTarget := filepath.Join(target, nodeName)
+		nodeTarget := filepath.Join(target, targetNames[i])
 		nodeLocation := filepath.Join(location, nodeName)
 
 		if target == nodeTarget || !fs.HasPathPrefix(target, nodeTarget) {
@@ -205,14 +290,34 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 			continue
 		}
 
-		// sockets cannot be restored
-		if node.Type == restic.NodeTypeSocket {
-			continue
-		}
-
 		selectedForRestore, childMayBeSelected := res.SelectFilter(nodeLocation, node.Type == restic.NodeTypeDir)
 		debug.Log("SelectFilter returned %v %v for %q", selectedForRestore, childMayBeSelected, nodeLocation)
 
+		if selectedForRestore && node.Type.IsSpecial() {
+			include, err := res.opts.SpecialFiles.Include(node.Type)
+			if err != nil {
+				return nil, hasRestored, fmt.Errorf("%v: %w", nodeLocation, err)
+			}
+			if !include {
+				debug.Log("skipping %v %q due to the special files policy", node.Type, nodeLocation)
+				if visitor.skipSpecial != nil {
+					visitor.skipSpecial(node, nodeLocation)
+				}
+				continue
+			}
+		}
+
+		if selectedForRestore || (node.Type == restic.NodeTypeDir && childMayBeSelected) {
+			nodeTarget, err = res.remapTarget(nodeLocation, nodeTarget)
+			if err != nil {
+				err = res.sanitizeError(nodeLocation, err)
+				if err != nil {
+					return nil, hasRestored, err
+				}
+				continue
+			}
+		}
+
 		if selectedForRestore {
 			hasRestored = true
 		}
@@ -270,6 +375,16 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 }
 
 func (res *Restorer) restoreNodeTo(node *restic.Node, target, location string) error {
+	if node.Type == restic.NodeTypeSymlink && len(res.opts.RewriteSymlinks) > 0 {
+		if linkTarget := res.opts.RewriteSymlinks.Apply(node.LinkTarget); linkTarget != node.LinkTarget {
+			debug.Log("rewriting target of symlink %v from %v to %v", location, node.LinkTarget, linkTarget)
+			rewritten := *node
+			rewritten.LinkTarget = linkTarget
+			node = &rewritten
+			res.rewrittenSymlinks++
+		}
+	}
+
 	if !res.opts.DryRun {
 		debug.Log("restoreNode %v %v %v", node.Name, target, location)
 		if err := fs.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -292,11 +407,29 @@ func (res *Restorer) restoreNodeMetadataTo(node *restic.Node, target, location s
 		return nil
 	}
 	debug.Log("restoreNodeMetadata %v %v %v", node.Name, target, location)
-	err := fs.NodeRestoreMetadata(node, target, res.Warn, res.XattrSelectFilter)
+	var sdErr error
+	if res.opts.RestoreOwner {
+		sdErr = fs.NodeRestoreOwner(node, target, res.sids.Map)
+		node = withoutSecurityDescriptor(node)
+	} else if res.opts.MapSIDsByName {
+		var mapped *restic.Node
+		mapped, sdErr = mapSecurityDescriptor(node, res.sids.Map)
+		if sdErr == nil {
+			node = mapped
+		}
+	}
+	err := fs.NodeRestoreMetadata(node, target, res.warn, res.XattrSelectFilter)
 	if err != nil {
 		debug.Log("node.RestoreMetadata(%s) error %v", target, err)
 	}
-	return err
+	return errors.Join(sdErr, err)
+}
+
+// warn calls res.Warn, it can be used concurrently.
+func (res *Restorer) warn(message string) {
+	res.warnMu.Lock()
+	defer res.warnMu.Unlock()
+	res.Warn(message)
 }
 
 func (res *Restorer) restoreHardlinkAt(node *restic.Node, target, path, location string) error {
@@ -354,35 +487,65 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 		if err := fs.MkdirAll(dst, 0700); err != nil {
 			return restoredFileCount, fmt.Errorf("cannot create target directory: %w", err)
 		}
+
+		res.caseInsensitive, err = res.caseProbe(dst)
+		if err != nil {
+			return restoredFileCount, fmt.Errorf("cannot check whether the target is case-insensitive: %w", err)
+		}
+	} else {
+		res.caseInsensitive = defaultCaseInsensitive()
 	}
+	debug.Log("target %v is case-insensitive: %v", dst, res.caseInsensitive)
 
 	idx := NewHardlinkIndex[string]()
 	filerestorer := newFileRestorer(dst, res.repo.LoadBlobsFromPack, res.repo.LookupBlob,
 		res.repo.Connections(), res.opts.Sparse, res.opts.Delete, res.repo.StartWarmup, res.opts.Progress)
+	filerestorer.zeroChunk = repository.ZeroChunk(res.repo.Config())
+	filerestorer.blockClone = res.opts.BlockClone
 	filerestorer.Error = res.Error
 	filerestorer.Info = res.Info
 
 	debug.Log("first pass for %q", dst)
 
 	var buf []byte
+	// the directory which was last created, this avoids checking the parent
+	// directory again for each file in it
+	var lastDir string
 
 	// first tree pass: create directories and collect all files to restore
 	err = res.traverseTree(ctx, dst, *res.sn.Tree, treeVisitor{
-		enterDir: func(_ *restic.Node, target, location string) error {
+		enterDir: func(node *restic.Node, target, location string) error {
 			debug.Log("first pass, enterDir: mkdir %q, leaveDir should restore metadata", location)
 			if location != string(filepath.Separator) {
 				res.opts.Progress.AddFile(0)
 			}
-			return res.ensureDir(target)
+			if err := res.ensureDir(target); err != nil {
+				return err
+			}
+			// attributes inherited by the directory content must be set before
+			// the files are created
+			if node != nil && !res.opts.DryRun {
+				if err := fs.NodeRestoreInheritedAttributes(node, target); err != nil {
+					return err
+				}
+			}
+			lastDir = target
+			return nil
 		},
 
 		visitNode: func(node *restic.Node, target, location string) error {
 			debug.Log("first pass, visitNode: mkdir %q, leaveDir on second pass should restore metadata", location)
-			if err := res.ensureDir(filepath.Dir(target)); err != nil {
-				return err
+			if dir := filepath.Dir(target); dir != lastDir {
+				if err := res.ensureDir(dir); err != nil {
+					return err
+				}
+				lastDir = dir
 			}
 
 			if node.Type != restic.NodeTypeFile {
+				if node.Type.IsSpecial() {
+					res.specialFiles.Add(node.Type, true)
+				}
 				res.opts.Progress.AddFile(0)
 				return nil
 			}
@@ -393,7 +556,7 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 					res.opts.Progress.AddFile(0)
 					return nil
 				}
-				idx.Add(node.Inode, node.DeviceID, location)
+				idx.Add(node.Inode, node.DeviceID, target)
 			}
 
 			buf, err = res.withOverwriteCheck(ctx, node, target, location, false, buf, func(updateMetadataOnly bool, matches *fileState) error {
@@ -402,7 +565,7 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 				} else {
 					res.opts.Progress.AddFile(node.Size)
 					if !res.opts.DryRun {
-						filerestorer.addFile(location, node.Content, int64(node.Size), matches)
+						filerestorer.addFile(location, target, node.Content, int64(node.Size), matches)
 					} else {
 						action := restoreui.ActionFileUpdated
 						if matches == nil {
@@ -420,6 +583,10 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 			})
 			return err
 		},
+
+		skipSpecial: func(node *restic.Node, _ string) {
+			res.specialFiles.Add(node.Type, false)
+		},
 	})
 	if err != nil {
 		return 0, err
@@ -434,6 +601,8 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 
 	debug.Log("second pass for %q", dst)
 
+	metadata := newMetadataRestorer(res, metadataWorkers)
+
 	// second tree pass: restore special files and filesystem metadata
 	err = res.traverseTree(ctx, dst, *res.sn.Tree, treeVisitor{
 		visitNode: func(node *restic.Node, target, location string) error {
@@ -445,20 +614,31 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 				return err
 			}
 
-			if idx.Has(node.Inode, node.DeviceID) && idx.Value(node.Inode, node.DeviceID) != location {
+			if idx.Has(node.Inode, node.DeviceID) && idx.Value(node.Inode, node.DeviceID) != target {
 				_, err := res.withOverwriteCheck(ctx, node, target, location, true, nil, func(_ bool, _ *fileState) error {
-					return res.restoreHardlinkAt(node, filerestorer.targetPath(idx.Value(node.Inode, node.DeviceID)), target, location)
+					return res.restoreHardlinkAt(node, idx.Value(node.Inode, node.DeviceID), target, location)
 				})
 				return err
 			}
 
-			if _, ok := res.hasRestoredFile(location); ok {
-				return res.restoreNodeMetadataTo(node, target, location)
+			if metadataOnly, ok := res.hasRestoredFile(location); ok {
+				if !metadataOnly {
+					err := res.restoreAlternateStreams(ctx, node, target)
+					if err := res.sanitizeError(location, err); err != nil {
+						return err
+					}
+				}
+				return metadata.Queue(node, target, location)
 			}
 			// don't touch skipped files
 			return nil
 		},
 		leaveDir: func(node *restic.Node, target, location string, expectedFilenames []string) error {
+			// the directory metadata must be restored after that of its contents
+			if err := metadata.Wait(); err != nil {
+				return err
+			}
+
 			if res.opts.Delete {
 				if err := res.removeUnexpectedFiles(ctx, target, location, expectedFilenames); err != nil {
 					return err
@@ -476,9 +656,98 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 			return err
 		},
 	})
+	if closeErr := metadata.Close(); err == nil {
+		err = closeErr
+	}
 	return restoredFileCount, err
 }
 
+// metadataWorkers is the number of goroutines which restore file metadata.
+const metadataWorkers = 8
+
+// metadataRestorer restores the metadata of regular files using several
+// goroutines. For many small files, restoring the metadata is dominated by the
+// latency of the individual syscalls, especially on network filesystems.
+type metadataRestorer struct {
+	res     *Restorer
+	ch      chan metadataJob
+	pending sync.WaitGroup
+	workers sync.WaitGroup
+
+	lock sync.Mutex
+	errs []metadataError
+}
+
+type metadataJob struct {
+	node             *restic.Node
+	target, location string
+}
+
+type metadataError struct {
+	location string
+	err      error
+}
+
+func newMetadataRestorer(res *Restorer, workers int) *metadataRestorer {
+	m := &metadataRestorer{
+		res: res,
+		ch:  make(chan metadataJob, workers),
+	}
+	m.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer m.workers.Done()
+			for job := range m.ch {
+				err := res.restoreNodeMetadataTo(job.node, job.target, job.location)
+				if err != nil {
+					m.lock.Lock()
+					m.errs = append(m.errs, metadataError{job.location, err})
+					m.lock.Unlock()
+				}
+				m.pending.Done()
+			}
+		}()
+	}
+	return m
+}
+
+// Queue schedules restoring the metadata of node.
+func (m *metadataRestorer) Queue(node *restic.Node, target, location string) error {
+	m.pending.Add(1)
+	m.ch <- metadataJob{node, target, location}
+	return m.report()
+}
+
+// Wait blocks until the metadata of all queued nodes is restored.
+func (m *metadataRestorer) Wait() error {
+	m.pending.Wait()
+	return m.report()
+}
+
+// Close waits for all queued nodes and stops the workers.
+func (m *metadataRestorer) Close() error {
+	close(m.ch)
+	m.workers.Wait()
+	return m.report()
+}
+
+// report passes the errors collected so far to the error callback of the
+// restorer. This happens in the calling goroutine, such that the callback
+// is not called concurrently.
+func (m *metadataRestorer) report() error {
+	m.lock.Lock()
+	errs := m.errs
+	m.errs = nil
+	m.lock.Unlock()
+
+	for _, e := range errs {
+		if err := m.res.sanitizeError(e.location, e.err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (res *Restorer) removeUnexpectedFiles(ctx context.Context, target, location string, expectedFilenames []string) error {
 	if !res.opts.Delete {
 		panic("internal error")
@@ -608,6 +877,18 @@ func (res *Restorer) Snapshot() *restic.Snapshot {
 	return res.sn
 }
 
+// RewrittenSymlinks returns the number of symlinks whose target was changed
+// by Options.RewriteSymlinks.
+func (res *Restorer) RewrittenSymlinks() uint {
+	return res.rewrittenSymlinks
+}
+
+// SpecialFiles returns the number of device nodes, FIFOs and sockets which
+// were restored or skipped by RestoreTo.
+func (res *Restorer) SpecialFiles() restic.SpecialFileStats {
+	return res.specialFiles
+}
+
 // Number of workers in VerifyFiles.
 const nVerifyWorkers = 8
 
@@ -759,7 +1040,7 @@ func (res *Restorer) verifyFile(ctx context.Context, target string, node *restic
 		if err != nil {
 			return nil, buf, err
 		}
-		matches[i] = blobID.Equal(restic.Hash(buf))
+		matches[i] = blobID.Equal(res.repo.Config().BlobHash(buf))
 		if failFast && !matches[i] {
 			return nil, buf, errors.Errorf(
 				"Unexpected content in %s, starting at offset %d",
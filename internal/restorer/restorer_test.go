@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
 	"testing"
@@ -36,6 +37,7 @@ type Snapshot struct {
 type File struct {
 	Data       string
 	DataParts  []string
+	Streams    map[string]string
 	Links      uint64
 	Inode      uint64
 	Mode       os.FileMode
@@ -103,6 +105,19 @@ func saveDir(t testing.TB, repo restic.BlobSaver, nodes map[string]Node, inode u
 					size += len(part)
 				}
 			}
+			names := make([]string, 0, len(node.Streams))
+			for name := range node.Streams {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var streams []restic.AlternateStream
+			for _, name := range names {
+				streams = append(streams, restic.AlternateStream{
+					Name:    name,
+					Size:    uint64(len(node.Streams[name])),
+					Content: restic.IDs{saveFile(t, repo, node.Streams[name])},
+				})
+			}
 			mode := node.Mode
 			if mode == 0 {
 				mode = 0644
@@ -115,6 +130,7 @@ func saveDir(t testing.TB, repo restic.BlobSaver, nodes map[string]Node, inode u
 				UID:               uint32(os.Getuid()),
 				GID:               uint32(os.Getgid()),
 				Content:           fc,
+				AlternateStreams:  streams,
 				Size:              uint64(size),
 				Inode:             fi,
 				Links:             lc,
@@ -1563,3 +1579,51 @@ func TestRestorerLongPath(t *testing.T) {
 	_, err = res.VerifyFiles(ctx, tmp, countRestoredFiles, nil)
 	rtest.OK(t, err)
 }
+
+func TestRestorerManySmallFiles(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	baseTime := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	dirs := map[string]Node{}
+	for i := 0; i < 4; i++ {
+		files := map[string]Node{}
+		for j := 0; j < 100; j++ {
+			files[fmt.Sprintf("file%03d", j)] = File{
+				Data:    fmt.Sprintf("content %d/%d\n", i, j),
+				Mode:    normalizeFileMode(0600),
+				ModTime: baseTime.Add(time.Duration(i*100+j) * time.Second),
+			}
+		}
+		dirs[fmt.Sprintf("dir%d", i)] = Dir{
+			Nodes:   files,
+			Mode:    normalizeFileMode(0700 | os.ModeDir),
+			ModTime: baseTime,
+		}
+	}
+	sn, _ := saveSnapshot(t, repo, Snapshot{Nodes: dirs}, noopGetGenericAttributes)
+
+	res := NewRestorer(repo, sn, Options{})
+	tempdir := rtest.TempDir(t)
+	count, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(400), count)
+
+	for i := 0; i < 4; i++ {
+		dir := filepath.Join(tempdir, fmt.Sprintf("dir%d", i))
+		for j := 0; j < 100; j++ {
+			file := filepath.Join(dir, fmt.Sprintf("file%03d", j))
+			data, err := os.ReadFile(file)
+			rtest.OK(t, err)
+			rtest.Equals(t, fmt.Sprintf("content %d/%d\n", i, j), string(data))
+
+			fi, err := os.Stat(file)
+			rtest.OK(t, err)
+			checkConsistentInfo(t, file, fi, baseTime.Add(time.Duration(i*100+j)*time.Second), normalizeFileMode(0600))
+		}
+
+		// creating the files must not change the directory metadata
+		fi, err := os.Stat(dir)
+		rtest.OK(t, err)
+		checkConsistentInfo(t, dir, fi, baseTime, normalizeFileMode(0700|os.ModeDir))
+	}
+}
@@ -142,3 +142,28 @@ func TestRestorePermissions(t *testing.T) {
 		rtest.Equals(t, fs.FileMode(0o600), fi.Mode().Perm(), "unexpected permissions")
 	}
 }
+
+func TestRestoreRewriteSymlinks(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"abs":      Symlink{Target: "/mnt/data/www"},
+			"relative": Symlink{Target: "../mnt/data"},
+		},
+	}, noopGetGenericAttributes)
+
+	var rewrites SymlinkRewrites
+	rtest.OK(t, rewrites.Set("s|^/mnt/data|/srv/data|"))
+	res := NewRestorer(repo, sn, Options{RewriteSymlinks: rewrites})
+
+	tempdir := rtest.TempDir(t)
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1), res.RewrittenSymlinks())
+
+	for name, expected := range map[string]string{"abs": "/srv/data/www", "relative": "../mnt/data"} {
+		target, err := os.Readlink(filepath.Join(tempdir, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, expected, target)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"unsafe"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
@@ -573,3 +574,50 @@ func TestRestoreDeleteCaseInsensitive(t *testing.T) {
 	_, err = os.Stat(filepath.Join(tempdir, "anotherfile"))
 	rtest.OK(t, err)
 }
+
+func TestRestoreAlternateStreams(t *testing.T) {
+	repo := repository.TestRepository(t)
+	tempdir := rtest.TempDir(t)
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{
+				Data:    "content: file\n",
+				Streams: map[string]string{"Zone.Identifier": "[ZoneTransfer]\nZoneId=3\n", "empty": ""},
+			},
+			"same": File{
+				Data:    "content: same\n",
+				Streams: map[string]string{"Zone.Identifier": "[ZoneTransfer]\nZoneId=3\n"},
+			},
+		},
+	}, noopGetGenericAttributes)
+
+	res := NewRestorer(repo, sn, Options{})
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	for _, name := range []string{"file", "same"} {
+		data, err := os.ReadFile(filepath.Join(tempdir, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, "content: "+name+"\n", string(data))
+
+		data, err = os.ReadFile(filepath.Join(tempdir, name+":Zone.Identifier"))
+		rtest.OK(t, err)
+		rtest.Equals(t, "[ZoneTransfer]\nZoneId=3\n", string(data))
+	}
+
+	streams, err := listAlternateStreamsForTest(filepath.Join(tempdir, "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"Zone.Identifier", "empty"}, streams)
+}
+
+func listAlternateStreamsForTest(path string) ([]string, error) {
+	f, err := fs.Local{}.OpenFile(path, fs.O_RDONLY, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return fs.AlternateStreams(f)
+}
@@ -0,0 +1,53 @@
+package restorer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// restoreAlternateStreams writes the alternate data streams of the file node
+// to target. This happens after the content of the file was restored and
+// before its metadata is restored, such that the file is complete once its
+// modification time is set.
+func (res *Restorer) restoreAlternateStreams(ctx context.Context, node *restic.Node, target string) error {
+	if res.opts.DryRun || len(node.AlternateStreams) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for _, stream := range node.AlternateStreams {
+		f, err := fs.CreateAlternateStream(target, stream.Name)
+		if errors.Is(err, fs.ErrAlternateStreamsNotSupported) {
+			res.streamsUnsupported.Do(func() {
+				res.warn("alternate data streams are not supported on this platform and are skipped")
+			})
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("stream %v: %w", stream.Name, err)
+		}
+
+		for _, id := range stream.Content {
+			buf, err = res.repo.LoadBlob(ctx, restic.DataBlob, id, buf)
+			if err == nil {
+				_, err = f.Write(buf)
+			}
+			if err != nil {
+				break
+			}
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("stream %v: %w", stream.Name, err)
+		}
+		debug.Log("restored stream %v of %v, %d bytes", stream.Name, target, stream.Size)
+	}
+	return nil
+}
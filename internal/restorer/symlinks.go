@@ -0,0 +1,109 @@
+package restorer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// SymlinkRewrite is a substitution applied to the targets of restored
+// symlinks, for example to adapt absolute targets recorded on the source
+// system to the layout of the restore target.
+type SymlinkRewrite struct {
+	expr   string
+	re     *regexp.Regexp
+	repl   string
+	global bool
+}
+
+// sedGroup matches the \1 style references to capture groups used by sed.
+var sedGroup = regexp.MustCompile(`\\([0-9])`)
+
+// ParseSymlinkRewrite parses a substitution in the sed syntax
+// s|regexp|replacement|flags. Any character can be used as delimiter instead
+// of "|". The replacement can refer to capture groups using \1 or ${1}, the
+// only supported flag is "g" to replace all matches instead of the first one.
+func ParseSymlinkRewrite(expr string) (SymlinkRewrite, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return SymlinkRewrite{}, fmt.Errorf("invalid symlink rewrite %q, must be s|regexp|replacement|", expr)
+	}
+	delim, size := utf8.DecodeRuneInString(expr[1:])
+	if delim == '\\' || delim == '\n' {
+		return SymlinkRewrite{}, fmt.Errorf("invalid delimiter %q in symlink rewrite %q", delim, expr)
+	}
+	parts := strings.Split(expr[1+size:], string(delim))
+	if len(parts) != 3 {
+		return SymlinkRewrite{}, fmt.Errorf("invalid symlink rewrite %q, must be s%cregexp%creplacement%c", expr, delim, delim, delim)
+	}
+
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return SymlinkRewrite{}, fmt.Errorf("invalid regexp in symlink rewrite %q: %w", expr, err)
+	}
+	rw := SymlinkRewrite{
+		expr: expr,
+		re:   re,
+		repl: sedGroup.ReplaceAllString(parts[1], "$${$1}"),
+	}
+	for _, flag := range parts[2] {
+		switch flag {
+		case 'g':
+			rw.global = true
+		default:
+			return SymlinkRewrite{}, fmt.Errorf("invalid flag %q in symlink rewrite %q", flag, expr)
+		}
+	}
+	return rw, nil
+}
+
+func (rw SymlinkRewrite) String() string {
+	return rw.expr
+}
+
+// Apply returns target with the substitution applied.
+func (rw SymlinkRewrite) Apply(target string) string {
+	if rw.global {
+		return rw.re.ReplaceAllString(target, rw.repl)
+	}
+	loc := rw.re.FindStringSubmatchIndex(target)
+	if loc == nil {
+		return target
+	}
+	dst := rw.re.ExpandString(nil, rw.repl, target, loc)
+	return target[:loc[0]] + string(dst) + target[loc[1]:]
+}
+
+// SymlinkRewrites is a list of substitutions applied in order. It implements
+// the pflag.Value interface, each use of the flag adds a substitution.
+type SymlinkRewrites []SymlinkRewrite
+
+// Set implements the method needed for pflag command flag parsing.
+func (s *SymlinkRewrites) Set(expr string) error {
+	rw, err := ParseSymlinkRewrite(expr)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, rw)
+	return nil
+}
+
+func (s *SymlinkRewrites) String() string {
+	exprs := make([]string, 0, len(*s))
+	for _, rw := range *s {
+		exprs = append(exprs, rw.expr)
+	}
+	return strings.Join(exprs, ",")
+}
+
+func (s *SymlinkRewrites) Type() string {
+	return "expression"
+}
+
+// Apply returns target with all substitutions applied.
+func (s SymlinkRewrites) Apply(target string) string {
+	for _, rw := range s {
+		target = rw.Apply(target)
+	}
+	return target
+}
@@ -0,0 +1,39 @@
+package restorer
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSymlinkRewrite(t *testing.T) {
+	for _, test := range []struct {
+		expr, target, expected string
+	}{
+		{"s|^/mnt/data|/srv/data|", "/mnt/data/www", "/srv/data/www"},
+		{"s|^/mnt/data|/srv/data|", "../mnt/data/www", "../mnt/data/www"},
+		{"s#/old/#/new/#", "/old/a/old/b", "/new/a/old/b"},
+		{"s#/old/#/new/#g", "/old/a/old/b", "/new/a/new/b"},
+		{`s|^/home/([^/]+)/|/users/\1/|`, "/home/alice/doc", "/users/alice/doc"},
+		{`s|^/home/([^/]+)/|/users/${1}x/|`, "/home/alice/doc", "/users/alicex/doc"},
+		{"s|^/mnt||", "/mnt/data", "/data"},
+	} {
+		rw, err := ParseSymlinkRewrite(test.expr)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.expected, rw.Apply(test.target), test.expr)
+	}
+
+	for _, expr := range []string{"", "s", "x|a|b|", "s|a|b", "s|a|b|c|", "s|(|b|", "s|a|b|i", `s\a\b\`} {
+		_, err := ParseSymlinkRewrite(expr)
+		rtest.Assert(t, err != nil, "expected error for %q", expr)
+	}
+}
+
+func TestSymlinkRewrites(t *testing.T) {
+	var rws SymlinkRewrites
+	rtest.OK(t, rws.Set("s|^/mnt|/srv|"))
+	rtest.OK(t, rws.Set("s|/data|/backup|"))
+	rtest.Assert(t, rws.Set("s|a") != nil, "expected error")
+	rtest.Equals(t, "s|^/mnt|/srv|,s|/data|/backup|", rws.String())
+	rtest.Equals(t, "/srv/backup/x", rws.Apply("/mnt/data/x"))
+}
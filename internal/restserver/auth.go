@@ -0,0 +1,153 @@
+package restserver
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticator checks the credentials of requests.
+type Authenticator interface {
+	// Authenticate returns the name of the user who sent the request or an
+	// error if the request is not authenticated.
+	Authenticate(r *http.Request) (string, error)
+}
+
+var errNoCredentials = errors.New("no credentials")
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// Chain tries the authenticators in order and returns the first success.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator.
+func (c Chain) Authenticate(r *http.Request) (string, error) {
+	err := errNoCredentials
+	for _, auth := range c {
+		var username string
+		username, err = auth.Authenticate(r)
+		if err == nil {
+			return username, nil
+		}
+	}
+	return "", err
+}
+
+// htpasswdCacheDuration is how long a successful password check is cached.
+// Checking a bcrypt hash is slow by design, and clients send many requests.
+const htpasswdCacheDuration = time.Minute
+
+type htpasswdCacheEntry struct {
+	hash    [sha256.Size]byte
+	expires time.Time
+}
+
+// Htpasswd authenticates users using HTTP basic authentication with the
+// passwords stored in an htpasswd file. Only bcrypt hashes are supported. The
+// file is reloaded when it changes.
+type Htpasswd struct {
+	filename string
+
+	m       sync.Mutex
+	modTime time.Time
+	users   map[string]string
+	cache   map[string]htpasswdCacheEntry
+}
+
+// NewHtpasswd loads the htpasswd file.
+func NewHtpasswd(filename string) (*Htpasswd, error) {
+	h := &Htpasswd{filename: filename}
+	err := h.reload()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// reload loads the file if it was modified. The caller must hold h.m, except
+// when called by NewHtpasswd.
+func (h *Htpasswd) reload() error {
+	fi, err := os.Stat(h.filename)
+	if err != nil {
+		return err
+	}
+	if h.users != nil && fi.ModTime().Equal(h.modTime) {
+		return nil
+	}
+
+	f, err := os.Open(h.filename)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	users := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("%v: line %d: invalid entry", h.filename, line)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("%v: line %d: password of user %q is not hashed using bcrypt", h.filename, line, user)
+		}
+		users[user] = hash
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	h.users = users
+	h.cache = make(map[string]htpasswdCacheEntry)
+	h.modTime = fi.ModTime()
+	return nil
+}
+
+// Authenticate implements Authenticator.
+func (h *Htpasswd) Authenticate(r *http.Request) (string, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return "", errNoCredentials
+	}
+	sum := sha256.Sum256([]byte(password))
+
+	h.m.Lock()
+	err := h.reload()
+	if err != nil {
+		// keep using the users loaded before
+		debug.Log("unable to reload %v: %v", h.filename, err)
+	}
+	hash, known := h.users[username]
+	entry, cached := h.cache[username]
+	h.m.Unlock()
+
+	if !known {
+		return "", errInvalidCredentials
+	}
+	if cached && time.Now().Before(entry.expires) && subtle.ConstantTimeCompare(entry.hash[:], sum[:]) == 1 {
+		return username, nil
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return "", errInvalidCredentials
+	}
+
+	h.m.Lock()
+	h.cache[username] = htpasswdCacheEntry{hash: sum, expires: time.Now().Add(htpasswdCacheDuration)}
+	h.m.Unlock()
+	return username, nil
+}
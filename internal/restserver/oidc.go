@@ -0,0 +1,264 @@
+package restserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcMinRefreshInterval limits how often the keys of the issuer are fetched
+// when a token is signed with an unknown key.
+const oidcMinRefreshInterval = time.Minute
+
+// OIDC authenticates users with ID tokens issued by an OpenID Connect
+// provider. The token is either sent as a bearer token or as the password of
+// HTTP basic authentication, the user name of the latter is ignored. This
+// allows restic clients to use tokens as part of the repository URL.
+type OIDC struct {
+	issuer        string
+	clientID      string
+	usernameClaim string
+	client        *http.Client
+	jwksURI       string
+
+	m           sync.Mutex
+	keys        map[string]interface{}
+	lastRefresh time.Time
+}
+
+// NewOIDC discovers the configuration of issuer and fetches its keys. Tokens
+// must be issued for the audience clientID, the user name is read from the
+// claim usernameClaim.
+func NewOIDC(ctx context.Context, issuer, clientID, usernameClaim string, client *http.Client) (*OIDC, error) {
+	o := &OIDC{
+		issuer:        issuer,
+		clientID:      clientID,
+		usernameClaim: usernameClaim,
+		client:        client,
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	err := o.getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("OIDC discovery failed: issuer %q does not match %q", discovery.Issuer, issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery failed: jwks_uri is missing")
+	}
+	o.jwksURI = discovery.JWKSURI
+
+	err = o.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *OIDC) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %v returned %v", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// jsonWebKey is a public key in the JSON Web Key format (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// publicKey returns the public key described by k.
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// refresh fetches the keys of the issuer. The caller must not hold o.m.
+func (o *OIDC) refresh(ctx context.Context) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err := o.getJSON(ctx, o.jwksURI, &set)
+	if err != nil {
+		return fmt.Errorf("unable to fetch OIDC keys: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			debug.Log("ignoring key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	o.m.Lock()
+	o.keys = keys
+	o.lastRefresh = time.Now()
+	o.m.Unlock()
+	return nil
+}
+
+// key returns the key with the key ID kid. Unknown keys are fetched from the
+// issuer, as it may have rotated its keys.
+func (o *OIDC) key(ctx context.Context, kid string) (interface{}, error) {
+	o.m.Lock()
+	key, ok := o.keys[kid]
+	refresh := !ok && time.Since(o.lastRefresh) >= oidcMinRefreshInterval
+	o.m.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !refresh {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	err := o.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	o.m.Lock()
+	key, ok = o.keys[kid]
+	o.m.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// token returns the token sent with r.
+func token(r *http.Request) (string, bool) {
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return auth[7:], true
+	}
+	if _, password, ok := r.BasicAuth(); ok && strings.Count(password, ".") == 2 {
+		return password, true
+	}
+	return "", false
+}
+
+// Authenticate implements Authenticator.
+func (o *OIDC) Authenticate(r *http.Request) (string, error) {
+	tokenString, ok := token(r)
+	if !ok {
+		return "", errNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return o.key(r.Context(), kid)
+	},
+		jwt.WithIssuer(o.issuer),
+		jwt.WithAudience(o.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	username, _ := claims[o.usernameClaim].(string)
+	if username == "" {
+		return "", fmt.Errorf("claim %q is missing in token", o.usernameClaim)
+	}
+	return username, nil
+}
@@ -0,0 +1,331 @@
+// Package restserver implements the server side of the REST backend protocol,
+// which is also implemented by rest-server. Repositories are stored in a
+// directory using the same layout as the local backend.
+package restserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Content types of list responses for the two versions of the protocol.
+const (
+	ContentTypeV1 = "application/vnd.x.restic.rest.v1"
+	ContentTypeV2 = "application/vnd.x.restic.rest.v2"
+)
+
+// Config configures the server.
+type Config struct {
+	// Path is the directory which contains the repositories.
+	Path string
+	// AppendOnly forbids removing files other than locks.
+	AppendOnly bool
+	// PrivateRepos restricts users to the repositories below a directory
+	// named like the user.
+	PrivateRepos bool
+	// Auth authenticates requests. If it is nil, all requests are allowed.
+	Auth Authenticator
+}
+
+// Server handles requests of the REST backend protocol.
+type Server struct {
+	cfg Config
+}
+
+// New returns a new server.
+func New(cfg Config) *Server {
+	return &Server{cfg: cfg}
+}
+
+// fileTypes maps the directory names used by the protocol to the file types.
+var fileTypes = map[string]backend.FileType{
+	"data":      backend.PackFile,
+	"keys":      backend.KeyFile,
+	"locks":     backend.LockFile,
+	"snapshots": backend.SnapshotFile,
+	"index":     backend.IndexFile,
+	"oplog":     backend.OpLogFile,
+	"approvals": backend.ApprovalFile,
+}
+
+// request is a parsed request.
+type request struct {
+	// repo are the path components of the repository.
+	repo []string
+	// handle is the file the request refers to, the name is empty for list
+	// requests.
+	handle backend.Handle
+	// isRepo is set for requests to the repository itself.
+	isRepo bool
+}
+
+var errInvalidPath = errors.New("invalid path")
+
+// validPathComponent reports whether s may be used as a directory name. Hidden
+// directories and names which are interpreted specially on Windows are
+// rejected.
+func validPathComponent(s string) bool {
+	return s != "" && !strings.HasPrefix(s, ".") && !strings.ContainsAny(s, `\:`)
+}
+
+// parsePath splits the path of a request into the repository and the file.
+func parsePath(p string) (request, error) {
+	dir := strings.HasSuffix(p, "/")
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) == 1 && parts[0] == "" {
+		parts = nil
+	}
+
+	for _, part := range parts {
+		if !validPathComponent(part) {
+			return request{}, errInvalidPath
+		}
+	}
+
+	isType := func(i int) bool {
+		_, ok := fileTypes[parts[i]]
+		return ok
+	}
+
+	n := len(parts)
+	switch {
+	case n >= 1 && !dir && parts[n-1] == "config":
+		return request{repo: parts[:n-1], handle: backend.Handle{Type: backend.ConfigFile}}, nil
+	case n >= 1 && dir && isType(n-1):
+		return request{repo: parts[:n-1], handle: backend.Handle{Type: fileTypes[parts[n-1]]}}, nil
+	case n >= 2 && !dir && isType(n-2):
+		if _, err := restic.ParseID(parts[n-1]); err != nil {
+			return request{}, errInvalidPath
+		}
+		return request{repo: parts[:n-2], handle: backend.Handle{Type: fileTypes[parts[n-2]], Name: parts[n-1]}}, nil
+	case dir || n == 0:
+		return request{repo: parts, isRepo: true}, nil
+	}
+	return request{}, errInvalidPath
+}
+
+func httpError(w http.ResponseWriter, code int) {
+	http.Error(w, http.StatusText(code), code)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	debug.Log("%v %v", r.Method, r.URL)
+
+	username := ""
+	if s.cfg.Auth != nil {
+		var err error
+		username, err = s.cfg.Auth.Authenticate(r)
+		if err != nil {
+			debug.Log("authentication failed: %v", err)
+			w.Header().Set("WWW-Authenticate", `Basic realm="restic"`)
+			httpError(w, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	req, err := parsePath(r.URL.Path)
+	if err != nil {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+
+	if s.cfg.PrivateRepos && (len(req.repo) == 0 || req.repo[0] != username) {
+		httpError(w, http.StatusUnauthorized)
+		return
+	}
+
+	repoPath := filepath.Join(append([]string{s.cfg.Path}, req.repo...)...)
+	be, err := local.Open(r.Context(), local.Config{Path: repoPath, Connections: 2})
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+
+	switch {
+	case req.isRepo:
+		if r.Method != http.MethodPost || r.URL.Query().Get("create") != "true" {
+			httpError(w, http.StatusMethodNotAllowed)
+			return
+		}
+		s.createRepo(w, r, be)
+	case req.handle.Type != backend.ConfigFile && req.handle.Name == "":
+		if r.Method != http.MethodGet {
+			httpError(w, http.StatusMethodNotAllowed)
+			return
+		}
+		s.list(w, r, be, repoPath, req.handle.Type)
+	default:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.getFile(w, r, be, req.handle)
+		case http.MethodPost:
+			s.saveFile(w, r, be, req.handle)
+		case http.MethodDelete:
+			s.deleteFile(w, r, be, req.handle)
+		default:
+			httpError(w, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (s *Server) internalError(w http.ResponseWriter, err error) {
+	debug.Log("request failed: %v", err)
+	httpError(w, http.StatusInternalServerError)
+}
+
+func (s *Server) createRepo(w http.ResponseWriter, r *http.Request, be *local.Local) {
+	// creating an existing repository does nothing
+	if _, err := be.Stat(r.Context(), backend.Handle{Type: backend.ConfigFile}); err == nil {
+		return
+	}
+
+	_, err := local.Create(r.Context(), be.Config)
+	if err != nil {
+		s.internalError(w, err)
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, be *local.Local, repoPath string, t backend.FileType) {
+	if _, err := os.Stat(repoPath); err != nil {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+
+	type fileInfo struct {
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+	}
+	names := []string{}
+	files := []fileInfo{}
+	err := be.List(r.Context(), t, func(fi backend.FileInfo) error {
+		names = append(names, fi.Name)
+		files = append(files, fileInfo{Name: fi.Name, Size: fi.Size})
+		return nil
+	})
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+
+	var data interface{} = names
+	contentType := ContentTypeV1
+	if r.Header.Get("Accept") == ContentTypeV2 {
+		data = files
+		contentType = ContentTypeV2
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	err = json.NewEncoder(w).Encode(data)
+	if err != nil {
+		debug.Log("unable to write list: %v", err)
+	}
+}
+
+func (s *Server) getFile(w http.ResponseWriter, r *http.Request, be *local.Local, h backend.Handle) {
+	f, err := os.Open(be.Filename(h))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			httpError(w, http.StatusNotFound)
+			return
+		}
+		s.internalError(w, err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+var errHashMismatch = errors.New("hash of the uploaded data does not match the file name")
+
+// verifyingReader checks that the data read has the expected SHA-256 hash. If
+// the hash does not match, reading fails at the end of the data, such that the
+// file is not stored.
+type verifyingReader struct {
+	rd       io.Reader
+	length   int64
+	hash     hash.Hash
+	expected string
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.rd.Read(p)
+	if v.hash != nil {
+		v.hash.Write(p[:n])
+		if errors.Is(err, io.EOF) && hex.EncodeToString(v.hash.Sum(nil)) != v.expected {
+			return n, errHashMismatch
+		}
+	}
+	return n, err
+}
+
+func (v *verifyingReader) Length() int64 { return v.length }
+func (v *verifyingReader) Hash() []byte  { return nil }
+func (v *verifyingReader) Rewind() error { return errors.New("rewind is not supported") }
+
+var _ backend.RewindReader = &verifyingReader{}
+
+func (s *Server) saveFile(w http.ResponseWriter, r *http.Request, be *local.Local, h backend.Handle) {
+	if r.ContentLength < 0 {
+		httpError(w, http.StatusLengthRequired)
+		return
+	}
+
+	// existing files are never replaced
+	if _, err := os.Lstat(be.Filename(h)); err == nil {
+		httpError(w, http.StatusForbidden)
+		return
+	}
+
+	rd := &verifyingReader{rd: r.Body, length: r.ContentLength}
+	if h.Type != backend.ConfigFile {
+		rd.hash = sha256.New()
+		rd.expected = h.Name
+	}
+
+	err := be.Save(r.Context(), h, rd)
+	if err != nil {
+		debug.Log("saving %v failed: %v", h, err)
+		if r.Context().Err() != nil || errors.Is(err, errHashMismatch) {
+			httpError(w, http.StatusBadRequest)
+			return
+		}
+		s.internalError(w, err)
+	}
+}
+
+func (s *Server) deleteFile(w http.ResponseWriter, r *http.Request, be *local.Local, h backend.Handle) {
+	if s.cfg.AppendOnly && h.Type != backend.LockFile {
+		httpError(w, http.StatusForbidden)
+		return
+	}
+
+	err := be.Remove(r.Context(), h)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			httpError(w, http.StatusNotFound)
+			return
+		}
+		s.internalError(w, err)
+	}
+}
@@ -0,0 +1,208 @@
+package restserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/restic/restic/internal/backend/rest"
+	"github.com/restic/restic/internal/backend/test"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestServer(t testing.TB, cfg Config) *httptest.Server {
+	cfg.Path = rtest.TempDir(t)
+	srv := httptest.NewServer(New(cfg))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBackend(t *testing.T) {
+	srv := newTestServer(t, Config{})
+	u, err := url.Parse(srv.URL + "/restic-test/")
+	rtest.OK(t, err)
+
+	suite := &test.Suite[rest.Config]{
+		NewConfig: func() (*rest.Config, error) {
+			cfg := rest.NewConfig()
+			cfg.URL = u
+			return &cfg, nil
+		},
+		Factory: rest.NewFactory(),
+	}
+	suite.RunTests(t)
+}
+
+func TestParsePath(t *testing.T) {
+	id := strings.Repeat("ab", 32)
+	for _, test := range []struct {
+		path  string
+		repo  string
+		name  string
+		isDir bool
+		err   bool
+	}{
+		{path: "/", isDir: true},
+		{path: "/foo/", repo: "foo", isDir: true},
+		{path: "/foo/bar/config", repo: "foo/bar"},
+		{path: "/foo/data/", repo: "foo"},
+		{path: "/foo/data/" + id, repo: "foo", name: id},
+		{path: "/data/" + id, name: id},
+		{path: "/foo/data/invalid", err: true},
+		{path: "/foo/../data/", err: true},
+		{path: "/.hidden/config", err: true},
+		{path: "/c:/config", err: true},
+		{path: "/foo/bar", err: true},
+	} {
+		req, err := parsePath(test.path)
+		if test.err {
+			rtest.Assert(t, err != nil, "expected error for %q", test.path)
+			continue
+		}
+		rtest.OK(t, err)
+		rtest.Equals(t, test.repo, strings.Join(req.repo, "/"), test.path)
+		rtest.Equals(t, test.name, req.handle.Name, test.path)
+		rtest.Equals(t, test.isDir, req.isRepo, test.path)
+	}
+}
+
+// do sends a request and returns the status code.
+func do(t *testing.T, method, u, user, password string, body string) int {
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	rtest.OK(t, err)
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	res, err := http.DefaultClient.Do(req)
+	rtest.OK(t, err)
+	_, _ = io.Copy(io.Discard, res.Body)
+	rtest.OK(t, res.Body.Close())
+	return res.StatusCode
+}
+
+func hashName(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAppendOnly(t *testing.T) {
+	srv := newTestServer(t, Config{AppendOnly: true})
+	repo := srv.URL + "/repo/"
+
+	rtest.Equals(t, http.StatusOK, do(t, http.MethodPost, repo+"?create=true", "", "", ""))
+
+	data := srv.URL + "/repo/data/" + hashName("data")
+	rtest.Equals(t, http.StatusOK, do(t, http.MethodPost, data, "", "", "data"))
+	rtest.Equals(t, http.StatusForbidden, do(t, http.MethodPost, data, "", "", "data"))
+	rtest.Equals(t, http.StatusForbidden, do(t, http.MethodDelete, data, "", "", ""))
+	rtest.Equals(t, http.StatusOK, do(t, http.MethodGet, data, "", "", ""))
+
+	invalid := srv.URL + "/repo/data/" + hashName("other")
+	rtest.Equals(t, http.StatusBadRequest, do(t, http.MethodPost, invalid, "", "", "data"))
+	rtest.Equals(t, http.StatusNotFound, do(t, http.MethodGet, invalid, "", "", ""))
+
+	lock := srv.URL + "/repo/locks/" + hashName("lock")
+	rtest.Equals(t, http.StatusOK, do(t, http.MethodPost, lock, "", "", "lock"))
+	rtest.Equals(t, http.StatusOK, do(t, http.MethodDelete, lock, "", "", ""))
+}
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	rtest.OK(t, err)
+	filename := filepath.Join(rtest.TempDir(t), "htpasswd")
+	rtest.OK(t, os.WriteFile(filename, []byte("# comment\nuser:"+string(hash)+"\n"), 0600))
+
+	auth, err := NewHtpasswd(filename)
+	rtest.OK(t, err)
+	srv := newTestServer(t, Config{Auth: auth, PrivateRepos: true})
+
+	rtest.Equals(t, http.StatusUnauthorized, do(t, http.MethodPost, srv.URL+"/user/?create=true", "", "", ""))
+	rtest.Equals(t, http.StatusUnauthorized, do(t, http.MethodPost, srv.URL+"/user/?create=true", "user", "wrong", ""))
+	rtest.Equals(t, http.StatusUnauthorized, do(t, http.MethodPost, srv.URL+"/other/?create=true", "user", "secret", ""))
+	rtest.Equals(t, http.StatusOK, do(t, http.MethodPost, srv.URL+"/user/?create=true", "user", "secret", ""))
+	rtest.Equals(t, http.StatusOK, do(t, http.MethodPost, srv.URL+"/user/sub/?create=true", "user", "secret", ""))
+
+	rtest.OK(t, os.WriteFile(filename, []byte("invalid:plaintext\n"), 0600))
+	_, err = NewHtpasswd(filename)
+	rtest.Assert(t, err != nil, "expected error for password without bcrypt hash")
+}
+
+// testIssuer is an OpenID Connect provider which serves a single RSA key.
+func testIssuer(t *testing.T) (*httptest.Server, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	rtest.OK(t, err)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	return srv, key
+}
+
+func TestOIDC(t *testing.T) {
+	issuer, key := testIssuer(t)
+	auth, err := NewOIDC(context.TODO(), issuer.URL, "restic", "preferred_username", issuer.Client())
+	rtest.OK(t, err)
+	srv := newTestServer(t, Config{Auth: auth, PrivateRepos: true})
+
+	sign := func(claims jwt.MapClaims, kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		rtest.OK(t, err)
+		return s
+	}
+	claims := func(aud string, exp time.Duration) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":                issuer.URL,
+			"aud":                aud,
+			"exp":                time.Now().Add(exp).Unix(),
+			"preferred_username": "alice",
+		}
+	}
+
+	u := srv.URL + "/alice/?create=true"
+	rtest.Equals(t, http.StatusOK, do(t, http.MethodPost, u, "token", sign(claims("restic", time.Hour), "test"), ""))
+	rtest.Equals(t, http.StatusUnauthorized, do(t, http.MethodPost, srv.URL+"/bob/?create=true", "token", sign(claims("restic", time.Hour), "test"), ""))
+	rtest.Equals(t, http.StatusUnauthorized, do(t, http.MethodPost, u, "token", sign(claims("other", time.Hour), "test"), ""))
+	rtest.Equals(t, http.StatusUnauthorized, do(t, http.MethodPost, u, "token", sign(claims("restic", -time.Hour), "test"), ""))
+	rtest.Equals(t, http.StatusUnauthorized, do(t, http.MethodPost, u, "token", sign(claims("restic", time.Hour), "unknown"), ""))
+
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	rtest.OK(t, err)
+	req.Header.Set("Authorization", "Bearer "+sign(claims("restic", time.Hour), "test"))
+	res, err := http.DefaultClient.Do(req)
+	rtest.OK(t, err)
+	rtest.OK(t, res.Body.Close())
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+}
@@ -0,0 +1,258 @@
+package s3gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/access"
+)
+
+const (
+	signatureAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat      = "20060102T150405Z"
+	unsignedPayload    = "UNSIGNED-PAYLOAD"
+	// emptyPayload is the SHA-256 hash of an empty request body.
+	emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// maxClockSkew is the maximum difference between the time of a signed
+	// request and the local time.
+	maxClockSkew = 15 * time.Minute
+	// maxPresignExpiry is the longest validity of a presigned URL.
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// now returns the current time, it is replaced in tests.
+var now = time.Now
+
+// signedRequest holds the parts of a request signed with AWS signature
+// version 4, either in the Authorization header or in the query string of a
+// presigned URL.
+type signedRequest struct {
+	accessKeyID   string
+	date          string
+	region        string
+	signedHeaders []string
+	signature     string
+	time          time.Time
+	presigned     bool
+}
+
+// authenticate checks the signature of r and returns the identity of the user
+// who signed it. Requests are accepted without a signature if no credentials
+// are configured.
+func (h *Handler) authenticate(r *http.Request) (access.Identity, error) {
+	if len(h.cfg.Credentials) == 0 {
+		return access.Identity{}, nil
+	}
+
+	var req *signedRequest
+	var err error
+	if r.URL.Query().Has("X-Amz-Signature") {
+		req, err = parsePresigned(r)
+	} else {
+		req, err = parseAuthorization(r)
+	}
+	if err != nil {
+		return access.Identity{}, err
+	}
+	// without the host, a signed request could be replayed to other servers
+	// which accept the same credentials
+	if !slices.Contains(req.signedHeaders, "host") {
+		return access.Identity{}, errHostNotSigned
+	}
+
+	cred, ok := h.cfg.Credentials[req.accessKeyID]
+	if !ok {
+		return access.Identity{}, &s3Error{http.StatusForbidden, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records."}
+	}
+
+	expected := signature(r, req, cred.SecretAccessKey)
+	if !hmac.Equal([]byte(expected), []byte(req.signature)) {
+		return access.Identity{}, errSignatureInvalid
+	}
+	return cred.Identity, nil
+}
+
+// parseCredential parses the credential of a request, which has the format
+// "key/date/region/s3/aws4_request".
+func parseCredential(req *signedRequest, credential string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[3] != "s3" || parts[4] != "aws4_request" {
+		return errAuthorizationMalformed
+	}
+	req.accessKeyID, req.date, req.region = parts[0], parts[1], parts[2]
+	return nil
+}
+
+var errAuthorizationMalformed = &s3Error{http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed."}
+var errHostNotSigned = &s3Error{http.StatusForbidden, "AccessDenied", "The host header must be signed."}
+var errRequestTimeTooSkewed = &s3Error{http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the current time is too large."}
+
+func parseAuthorization(r *http.Request) (*signedRequest, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return nil, errAccessDenied
+	}
+
+	algorithm, params, _ := strings.Cut(auth, " ")
+	if algorithm != signatureAlgorithm {
+		return nil, errAuthorizationMalformed
+	}
+
+	req := &signedRequest{}
+	for _, param := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch key {
+		case "Credential":
+			err := parseCredential(req, value)
+			if err != nil {
+				return nil, err
+			}
+		case "SignedHeaders":
+			req.signedHeaders = strings.Split(value, ";")
+		case "Signature":
+			req.signature = value
+		}
+	}
+	if req.accessKeyID == "" || len(req.signedHeaders) == 0 || req.signature == "" {
+		return nil, errAuthorizationMalformed
+	}
+
+	t, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		t, err = http.ParseTime(r.Header.Get("Date"))
+		if err != nil {
+			return nil, errAccessDenied
+		}
+	}
+	req.time = t.UTC()
+
+	if d := now().Sub(t); d > maxClockSkew || d < -maxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+	return req, nil
+}
+
+func parsePresigned(r *http.Request) (*signedRequest, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != signatureAlgorithm {
+		return nil, errAuthorizationMalformed
+	}
+
+	req := &signedRequest{
+		signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		signature:     query.Get("X-Amz-Signature"),
+		presigned:     true,
+	}
+	err := parseCredential(req, query.Get("X-Amz-Credential"))
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := time.Parse(amzDateFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, errAuthorizationMalformed
+	}
+	req.time = t
+
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignExpiry {
+		return nil, errAuthorizationMalformed
+	}
+	if now().After(t.Add(time.Duration(expires)*time.Second)) || t.Sub(now()) > maxClockSkew {
+		return nil, &s3Error{http.StatusForbidden, "AccessDenied", "Request has expired"}
+	}
+	return req, nil
+}
+
+// escape encodes s as required for the canonical request: all bytes except
+// unreserved characters are percent-encoded. Slashes are kept unless
+// encodeSlash is set.
+func escape(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+// canonicalRequest returns the canonical form of r as described in the
+// documentation of the signature version 4.
+func canonicalRequest(r *http.Request, req *signedRequest) string {
+	var query []string
+	for key, values := range r.URL.Query() {
+		if req.presigned && key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			query = append(query, escape(key, true)+"="+escape(value, true))
+		}
+	}
+	sort.Strings(query)
+
+	var headers strings.Builder
+	for _, name := range req.signedHeaders {
+		var value string
+		if name == "host" {
+			value = r.Host
+		} else {
+			value = strings.Join(r.Header.Values(name), ",")
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = emptyPayload
+		if req.presigned {
+			payload = unsignedPayload
+		}
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		escape(r.URL.Path, false),
+		strings.Join(query, "&"),
+		headers.String(),
+		strings.Join(req.signedHeaders, ";"),
+		payload,
+	}, "\n")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signature returns the expected signature of r.
+func signature(r *http.Request, req *signedRequest, secretAccessKey string) string {
+	scope := req.date + "/" + req.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest(r, req)))
+	stringToSign := signatureAlgorithm + "\n" +
+		req.time.Format(amzDateFormat) + "\n" +
+		scope + "\n" +
+		hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), req.date)
+	key = hmacSHA256(key, req.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
@@ -0,0 +1,55 @@
+package s3gateway
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/restic/restic/internal/access"
+)
+
+// LoadCredentials reads the credentials of the users from a file.
+func LoadCredentials(filename string) (map[string]Credential, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return ParseCredentials(f, filename)
+}
+
+// ParseCredentials reads the credentials of the users, filename is only used
+// in error messages. Each line contains the access key ID, the secret access
+// key, the name of the user and optionally a comma-separated list of the
+// groups the user belongs to. Empty lines and lines starting with # are
+// ignored.
+func ParseCredentials(rd io.Reader, filename string) (map[string]Credential, error) {
+	creds := make(map[string]Credential)
+
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("%v: line %d: expected access key ID, secret access key, user and groups", filename, line)
+		}
+		if _, ok := creds[fields[0]]; ok {
+			return nil, fmt.Errorf("%v: line %d: duplicate access key ID %q", filename, line, fields[0])
+		}
+
+		id := access.Identity{User: fields[2]}
+		if len(fields) == 4 {
+			id.Groups = strings.Split(fields[3], ",")
+		}
+		creds[fields[0]] = Credential{SecretAccessKey: fields[1], Identity: id}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
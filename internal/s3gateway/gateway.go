@@ -0,0 +1,250 @@
+// Package s3gateway serves the files of a snapshot as a read-only bucket via
+// the S3 API. It supports listing objects (ListObjects and ListObjectsV2) and
+// downloading objects including range requests, which is sufficient for most
+// S3 clients to read data.
+package s3gateway
+
+import (
+	"context"
+	"encoding/xml"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/access"
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// Config configures the gateway.
+type Config struct {
+	// Bucket is the name of the bucket containing the files of the snapshot.
+	Bucket string
+
+	// Credentials maps the access key IDs clients can sign their requests
+	// with to the credentials. If it is empty, anonymous requests are allowed.
+	Credentials map[string]Credential
+
+	// Policy restricts the files users can access. If it is nil, all files
+	// can be accessed.
+	Policy *access.Policy
+	// Path is the path of the served tree within the snapshot, it is used to
+	// check the policy.
+	Path string
+}
+
+// Credential is the secret key of a user.
+type Credential struct {
+	SecretAccessKey string
+	Identity        access.Identity
+}
+
+// blobCacheSize is the memory used to cache file content.
+const blobCacheSize = 64 << 20
+
+// treeCacheSize is the number of trees kept in memory.
+const treeCacheSize = 1024
+
+// Handler implements the S3 API for a snapshot.
+type Handler struct {
+	repo    restic.Loader
+	tree    restic.ID
+	created time.Time
+	cfg     Config
+
+	blobCache *bloblru.Cache
+
+	treeMu    sync.Mutex
+	treeCache *simplelru.LRU[restic.ID, *restic.Tree]
+}
+
+// New returns a handler which serves tree as the bucket. The creation date of
+// the bucket is set to created, usually the time of the snapshot.
+func New(repo restic.Loader, tree restic.ID, created time.Time, cfg Config) *Handler {
+	treeCache, err := simplelru.NewLRU[restic.ID, *restic.Tree](treeCacheSize, nil)
+	if err != nil {
+		panic(err) // only possible if treeCacheSize <= 0
+	}
+
+	return &Handler{
+		repo:      repo,
+		tree:      tree,
+		created:   created,
+		cfg:       cfg,
+		blobCache: bloblru.New(blobCacheSize),
+		treeCache: treeCache,
+	}
+}
+
+// s3Error is an error reported to the client.
+type s3Error struct {
+	status  int
+	Code    string
+	Message string
+}
+
+func (e *s3Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied     = &s3Error{http.StatusForbidden, "AccessDenied", "Access Denied"}
+	errReadOnly         = &s3Error{http.StatusForbidden, "AccessDenied", "The bucket is read-only"}
+	errNoSuchBucket     = &s3Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist"}
+	errNoSuchKey        = &s3Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errInvalidArgument  = &s3Error{http.StatusBadRequest, "InvalidArgument", "Invalid Argument"}
+	errInternal         = &s3Error{http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."}
+	errNotImplemented   = &s3Error{http.StatusNotImplemented, "NotImplemented", "A header you provided implies functionality that is not implemented"}
+	errSignatureInvalid = &s3Error{http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."}
+)
+
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e, ok := err.(*s3Error)
+	if !ok {
+		debug.Log("request %v %v failed: %v", r.Method, r.URL, err)
+		e = errInternal
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string
+		Message  string
+		Resource string
+	}{Code: e.Code, Message: e.Message, Resource: r.URL.Path})
+}
+
+const xmlNamespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	err := xml.NewEncoder(w).Encode(v)
+	if err != nil {
+		debug.Log("unable to write response: %v", err)
+	}
+}
+
+// ServeHTTP handles requests using path-style addressing, that is the bucket
+// is the first component of the path.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	debug.Log("%v %v", r.Method, r.URL)
+
+	id, err := h.authenticate(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		id.Host = net.ParseIP(host)
+	}
+	checker := h.cfg.Policy.For(id)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.writeError(w, r, errReadOnly)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case bucket == "":
+		h.listBuckets(w)
+	case bucket != h.cfg.Bucket:
+		h.writeError(w, r, errNoSuchBucket)
+	case key == "":
+		err = h.bucket(w, r, checker)
+	default:
+		err = h.getObject(w, r, key, checker)
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+	}
+}
+
+func (h *Handler) listBuckets(w http.ResponseWriter) {
+	type bucket struct {
+		Name         string
+		CreationDate string
+	}
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		XMLNS   string   `xml:"xmlns,attr"`
+		Owner   struct {
+			ID          string
+			DisplayName string
+		}
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{
+		XMLNS:   xmlNamespace,
+		Buckets: []bucket{{Name: h.cfg.Bucket, CreationDate: formatTime(h.created)}},
+	})
+}
+
+func (h *Handler) bucket(w http.ResponseWriter, r *http.Request, checker *access.Checker) error {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodHead:
+		return nil
+	case query.Has("location"):
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+			XMLNS   string   `xml:"xmlns,attr"`
+		}{XMLNS: xmlNamespace})
+		return nil
+	case query.Has("versioning"):
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"VersioningConfiguration"`
+			XMLNS   string   `xml:"xmlns,attr"`
+		}{XMLNS: xmlNamespace})
+		return nil
+	case query.Has("list-type") && query.Get("list-type") != "2":
+		return errInvalidArgument
+	}
+
+	for _, unsupported := range []string{"acl", "policy", "uploads", "versions", "tagging", "lifecycle", "cors"} {
+		if query.Has(unsupported) {
+			return errNotImplemented
+		}
+	}
+
+	return h.listObjects(r.Context(), w, query, checker)
+}
+
+// snapshotPath returns the path of key within the snapshot.
+func (h *Handler) snapshotPath(key string) string {
+	return path.Join("/", h.cfg.Path, key)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// loadTree returns the tree with id, recently used trees are cached.
+func (h *Handler) loadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
+	h.treeMu.Lock()
+	tree, ok := h.treeCache.Get(id)
+	h.treeMu.Unlock()
+	if ok {
+		return tree, nil
+	}
+
+	tree, err := restic.LoadTree(ctx, h.repo, id)
+	if err != nil {
+		return nil, err
+	}
+
+	h.treeMu.Lock()
+	h.treeCache.Add(id, tree)
+	h.treeMu.Unlock()
+	return tree, nil
+}
@@ -0,0 +1,230 @@
+package s3gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/restic/restic/internal/access"
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testFiles = archiver.TestDir{
+	"a-b": archiver.TestFile{Content: "a-b"},
+	"a": archiver.TestDir{
+		"x": archiver.TestFile{Content: "x"},
+		"y z": archiver.TestDir{
+			"file+1": archiver.TestFile{Content: strings.Repeat("restic", 1000)},
+		},
+	},
+	"b":     archiver.TestFile{Content: "b"},
+	"link":  archiver.TestSymlink{Target: "b"},
+	"empty": archiver.TestDir{},
+}
+
+var testCredentials = Config{Credentials: map[string]Credential{
+	"key": {SecretAccessKey: "secret", Identity: access.Identity{User: "alice"}},
+}}
+
+func testHandler(t *testing.T, cfg Config) *httptest.Server {
+	ctx := context.Background()
+	repo := repository.TestRepository(t)
+	tempdir := rtest.TempDir(t)
+	archiver.TestCreateFiles(t, tempdir, testFiles)
+
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+	arch := archiver.New(repo, fs.Track{FS: fs.Local{}}, archiver.Options{})
+	sn, _, _, err := arch.Snapshot(ctx, []string{"."}, archiver.SnapshotOptions{Time: time.Now()})
+	rtest.OK(t, err)
+
+	cfg.Bucket = "restic"
+	srv := httptest.NewServer(New(repo, *sn.Tree, sn.Time, cfg))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testClient(t *testing.T, srv *httptest.Server, keyID, secret string) *minio.Client {
+	u, err := url.Parse(srv.URL)
+	rtest.OK(t, err)
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyID, secret, ""),
+		Region: "us-east-1",
+	})
+	rtest.OK(t, err)
+	return client
+}
+
+func listKeys(t *testing.T, client *minio.Client, opts minio.ListObjectsOptions) []string {
+	var keys []string
+	for obj := range client.ListObjects(context.TODO(), "restic", opts) {
+		rtest.OK(t, obj.Err)
+		keys = append(keys, obj.Key)
+	}
+	// common prefixes are returned after the objects of each page
+	sort.Strings(keys)
+	return keys
+}
+
+func TestList(t *testing.T) {
+	srv := testHandler(t, Config{})
+	client := testClient(t, srv, "", "")
+
+	buckets, err := client.ListBuckets(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(buckets))
+	rtest.Equals(t, "restic", buckets[0].Name)
+
+	for _, test := range []struct {
+		opts minio.ListObjectsOptions
+		keys []string
+	}{
+		{minio.ListObjectsOptions{Recursive: true}, []string{"a-b", "a/x", "a/y z/file+1", "b"}},
+		// empty directories are listed as common prefixes
+		{minio.ListObjectsOptions{}, []string{"a-b", "a/", "b", "empty/"}},
+		{minio.ListObjectsOptions{Prefix: "a/"}, []string{"a/x", "a/y z/"}},
+		{minio.ListObjectsOptions{Prefix: "a"}, []string{"a-b", "a/"}},
+		{minio.ListObjectsOptions{Prefix: "a/y", Recursive: true}, []string{"a/y z/file+1"}},
+		{minio.ListObjectsOptions{StartAfter: "a/x", Recursive: true}, []string{"a/y z/file+1", "b"}},
+		// paginate using one key per request
+		{minio.ListObjectsOptions{Recursive: true, MaxKeys: 1}, []string{"a-b", "a/x", "a/y z/file+1", "b"}},
+		{minio.ListObjectsOptions{MaxKeys: 1}, []string{"a-b", "a/", "b", "empty/"}},
+		{minio.ListObjectsOptions{Recursive: true, MaxKeys: 1, UseV1: true}, []string{"a-b", "a/x", "a/y z/file+1", "b"}},
+	} {
+		rtest.Equals(t, test.keys, listKeys(t, client, test.opts), fmt.Sprintf("options %+v", test.opts))
+	}
+}
+
+func TestGetObject(t *testing.T) {
+	srv := testHandler(t, testCredentials)
+	client := testClient(t, srv, "key", "secret")
+	content := strings.Repeat("restic", 1000)
+
+	obj, err := client.GetObject(context.TODO(), "restic", "a/y z/file+1", minio.GetObjectOptions{})
+	rtest.OK(t, err)
+	data, err := io.ReadAll(obj)
+	rtest.OK(t, err)
+	rtest.Equals(t, content, string(data))
+
+	opts := minio.GetObjectOptions{}
+	rtest.OK(t, opts.SetRange(100, 199))
+	obj, err = client.GetObject(context.TODO(), "restic", "a/y z/file+1", opts)
+	rtest.OK(t, err)
+	data, err = io.ReadAll(obj)
+	rtest.OK(t, err)
+	rtest.Equals(t, content[100:200], string(data))
+
+	info, err := client.StatObject(context.TODO(), "restic", "b", minio.StatObjectOptions{})
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(1), info.Size)
+
+	for _, key := range []string{"a", "a/", "link", "empty", "missing", "a//x"} {
+		_, err = client.StatObject(context.TODO(), "restic", key, minio.StatObjectOptions{})
+		rtest.Equals(t, "NoSuchKey", minio.ToErrorResponse(err).Code, fmt.Sprintf("key %q", key))
+	}
+
+	_, err = client.PutObject(context.TODO(), "restic", "new", strings.NewReader("data"), 4, minio.PutObjectOptions{})
+	rtest.Equals(t, "AccessDenied", minio.ToErrorResponse(err).Code)
+}
+
+func TestAuthentication(t *testing.T) {
+	srv := testHandler(t, testCredentials)
+
+	_, err := testClient(t, srv, "key", "wrong").ListBuckets(context.TODO())
+	rtest.Equals(t, "SignatureDoesNotMatch", minio.ToErrorResponse(err).Code)
+	_, err = testClient(t, srv, "other", "secret").ListBuckets(context.TODO())
+	rtest.Equals(t, "InvalidAccessKeyId", minio.ToErrorResponse(err).Code)
+
+	res, err := http.Get(srv.URL + "/restic/b")
+	rtest.OK(t, err)
+	rtest.OK(t, res.Body.Close())
+	rtest.Equals(t, http.StatusForbidden, res.StatusCode)
+
+	u, err := testClient(t, srv, "key", "secret").PresignedGetObject(context.TODO(), "restic", "a/x", time.Minute, nil)
+	rtest.OK(t, err)
+	res, err = http.Get(u.String())
+	rtest.OK(t, err)
+	data, err := io.ReadAll(res.Body)
+	rtest.OK(t, err)
+	rtest.OK(t, res.Body.Close())
+	rtest.Equals(t, "x", string(data))
+
+	// the host must be signed
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/restic/b", nil)
+	rtest.OK(t, err)
+	date := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", date.Format(amzDateFormat))
+	signed := &signedRequest{
+		date:          date.Format("20060102"),
+		region:        "us-east-1",
+		signedHeaders: []string{"x-amz-date"},
+		time:          date,
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("%v Credential=key/%v/us-east-1/s3/aws4_request, SignedHeaders=x-amz-date, Signature=%v",
+		signatureAlgorithm, signed.date, signature(req, signed, "secret")))
+	res, err = http.DefaultClient.Do(req)
+	rtest.OK(t, err)
+	rtest.OK(t, res.Body.Close())
+	rtest.Equals(t, http.StatusForbidden, res.StatusCode)
+
+	// presigned URLs expire
+	now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	defer func() { now = time.Now }()
+	res, err = http.Get(u.String())
+	rtest.OK(t, err)
+	rtest.OK(t, res.Body.Close())
+	rtest.Equals(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestPolicy(t *testing.T) {
+	policy, err := access.Parse(strings.NewReader("allow user:alice /a/y z\nallow user:bob /\n"), "policy")
+	rtest.OK(t, err)
+
+	cfg := Config{
+		Credentials: map[string]Credential{
+			"alice": {SecretAccessKey: "secret", Identity: access.Identity{User: "alice"}},
+			"bob":   {SecretAccessKey: "secret", Identity: access.Identity{User: "bob"}},
+		},
+		Policy: policy,
+	}
+	srv := testHandler(t, cfg)
+	alice := testClient(t, srv, "alice", "secret")
+	bob := testClient(t, srv, "bob", "secret")
+
+	rtest.Equals(t, []string{"a/y z/file+1"}, listKeys(t, alice, minio.ListObjectsOptions{Recursive: true}))
+	rtest.Equals(t, []string{"a/"}, listKeys(t, alice, minio.ListObjectsOptions{}))
+	rtest.Equals(t, []string{"a-b", "a/x", "a/y z/file+1", "b"}, listKeys(t, bob, minio.ListObjectsOptions{Recursive: true}))
+
+	_, err = alice.StatObject(context.TODO(), "restic", "a/y z/file+1", minio.StatObjectOptions{})
+	rtest.OK(t, err)
+	for _, key := range []string{"a/x", "b"} {
+		_, err = alice.StatObject(context.TODO(), "restic", key, minio.StatObjectOptions{})
+		rtest.Equals(t, "NoSuchKey", minio.ToErrorResponse(err).Code, fmt.Sprintf("key %q", key))
+	}
+}
+
+func TestParseCredentials(t *testing.T) {
+	creds, err := ParseCredentials(strings.NewReader("# comment\nkey1 secret1 alice\n\nkey2 secret2 bob finance,staff\n"), "credentials")
+	rtest.OK(t, err)
+	rtest.Equals(t, map[string]Credential{
+		"key1": {SecretAccessKey: "secret1", Identity: access.Identity{User: "alice"}},
+		"key2": {SecretAccessKey: "secret2", Identity: access.Identity{User: "bob", Groups: []string{"finance", "staff"}}},
+	}, creds)
+
+	for _, data := range []string{"key1 secret1", "key1 secret1 alice a b", "key1 s alice\nkey1 s bob"} {
+		_, err = ParseCredentials(strings.NewReader(data), "credentials")
+		rtest.Assert(t, err != nil, "expected error for %q", data)
+	}
+}
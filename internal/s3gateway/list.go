@@ -0,0 +1,291 @@
+package s3gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/access"
+	"github.com/restic/restic/internal/restic"
+)
+
+// maxListKeys is the maximum number of keys returned by a single request.
+const maxListKeys = 1000
+
+// listEntry is either an object or a common prefix.
+type listEntry struct {
+	key  string
+	node *restic.Node
+}
+
+// lister walks the snapshot and reports the entries matching a listing
+// request in lexical order of their keys.
+type lister struct {
+	h         *Handler
+	checker   *access.Checker
+	prefix    string
+	delimiter string
+	// after is the key or common prefix after which the listing starts.
+	after string
+	// fn is called for each entry, the walk stops if it returns false.
+	fn func(listEntry) bool
+
+	lastPrefix string
+}
+
+// sortedNodes returns the files and directories of tree in the lexical order
+// of the keys of the files they contain. A directory "a" sorts as "a/", such
+// that for example the file "a-b" is returned before the contents of "a".
+func sortedNodes(tree *restic.Tree) []*restic.Node {
+	nodes := make([]*restic.Node, 0, len(tree.Nodes))
+	for _, node := range tree.Nodes {
+		if node.Type == restic.NodeTypeFile || (node.Type == restic.NodeTypeDir && node.Subtree != nil) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	sortKey := func(node *restic.Node) string {
+		if node.Type == restic.NodeTypeDir {
+			return node.Name + "/"
+		}
+		return node.Name
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return sortKey(nodes[i]) < sortKey(nodes[j])
+	})
+	return nodes
+}
+
+// commonPrefix returns the common prefix key belongs to and whether there is
+// one.
+func (l *lister) commonPrefix(key string) (string, bool) {
+	if l.delimiter == "" || !strings.HasPrefix(key, l.prefix) {
+		return "", false
+	}
+	rest := key[len(l.prefix):]
+	i := strings.Index(rest, l.delimiter)
+	if i < 0 {
+		return "", false
+	}
+	return l.prefix + rest[:i+len(l.delimiter)], true
+}
+
+// reportPrefix reports a common prefix once.
+func (l *lister) reportPrefix(prefix string) bool {
+	if prefix <= l.after || prefix == l.lastPrefix {
+		return true
+	}
+	l.lastPrefix = prefix
+	return l.fn(listEntry{key: prefix})
+}
+
+// walk reports the entries in the tree with id, dir is the key prefix of the
+// tree. It returns false if the walk was stopped.
+func (l *lister) walk(ctx context.Context, id restic.ID, dir string) (bool, error) {
+	tree, err := l.h.loadTree(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	for _, node := range sortedNodes(tree) {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if l.checker.Check(l.h.snapshotPath(dir+node.Name), node) == access.Denied {
+			continue
+		}
+
+		if node.Type == restic.NodeTypeFile {
+			key := dir + node.Name
+			if !strings.HasPrefix(key, l.prefix) || key <= l.after {
+				continue
+			}
+			if prefix, ok := l.commonPrefix(key); ok {
+				if !l.reportPrefix(prefix) {
+					return false, nil
+				}
+				continue
+			}
+			if !l.fn(listEntry{key: key, node: node}) {
+				return false, nil
+			}
+			continue
+		}
+
+		subdir := dir + node.Name + "/"
+		if !strings.HasPrefix(subdir, l.prefix) && !strings.HasPrefix(l.prefix, subdir) {
+			continue
+		}
+		// all keys within the directory sort before the start of the listing
+		if subdir < l.after && !strings.HasPrefix(l.after, subdir) {
+			continue
+		}
+		// all keys within the directory belong to the same common prefix
+		if prefix, ok := l.commonPrefix(subdir); ok {
+			if !l.reportPrefix(prefix) {
+				return false, nil
+			}
+			continue
+		}
+
+		ok, err := l.walk(ctx, *node.Subtree, subdir)
+		if !ok || err != nil {
+			return ok, err
+		}
+	}
+
+	return true, nil
+}
+
+// etag returns an entity tag for a file. It is derived from the content of
+// the file, but is not the MD5 hash of the data. The suffix marks the entity
+// tag as belonging to a multipart upload, which prevents clients from trying
+// to compare it to the MD5 hash.
+func etag(node *restic.Node) string {
+	h := sha256.New()
+	for _, id := range node.Content {
+		h.Write(id[:])
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + "-" + strconv.Itoa(max(len(node.Content), 1)) + `"`
+}
+
+type listContents struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         uint64
+	StorageClass string
+}
+
+type listCommonPrefix struct {
+	Prefix string
+}
+
+type listBucketResult struct {
+	XMLName xml.Name `xml:"ListBucketResult"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Name    string
+	Prefix  string
+
+	// ListObjects
+	Marker     *string `xml:",omitempty"`
+	NextMarker string  `xml:",omitempty"`
+
+	// ListObjectsV2
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	KeyCount              *int   `xml:",omitempty"`
+
+	Delimiter      string `xml:",omitempty"`
+	EncodingType   string `xml:",omitempty"`
+	MaxKeys        int
+	IsTruncated    bool
+	Contents       []listContents
+	CommonPrefixes []listCommonPrefix
+}
+
+func (h *Handler) listObjects(ctx context.Context, w http.ResponseWriter, query url.Values, checker *access.Checker) error {
+	v2 := query.Get("list-type") == "2"
+
+	maxKeys := maxListKeys
+	if query.Has("max-keys") {
+		n, err := strconv.Atoi(query.Get("max-keys"))
+		if err != nil || n < 0 {
+			return errInvalidArgument
+		}
+		maxKeys = min(n, maxListKeys)
+	}
+
+	encode := func(s string) string { return s }
+	switch query.Get("encoding-type") {
+	case "":
+	case "url":
+		encode = func(s string) string { return escape(s, false) }
+	default:
+		return errInvalidArgument
+	}
+
+	l := &lister{
+		h:         h,
+		checker:   checker,
+		prefix:    query.Get("prefix"),
+		delimiter: query.Get("delimiter"),
+	}
+	res := listBucketResult{
+		XMLNS:        xmlNamespace,
+		Name:         h.cfg.Bucket,
+		Prefix:       encode(l.prefix),
+		Delimiter:    encode(l.delimiter),
+		EncodingType: query.Get("encoding-type"),
+		MaxKeys:      maxKeys,
+	}
+
+	if v2 {
+		res.ContinuationToken = query.Get("continuation-token")
+		res.StartAfter = encode(query.Get("start-after"))
+		l.after = query.Get("start-after")
+		if res.ContinuationToken != "" {
+			after, err := base64.RawURLEncoding.DecodeString(res.ContinuationToken)
+			if err != nil {
+				return errInvalidArgument
+			}
+			l.after = string(after)
+		}
+	} else {
+		l.after = query.Get("marker")
+		marker := encode(l.after)
+		res.Marker = &marker
+	}
+
+	var entries []listEntry
+	l.fn = func(entry listEntry) bool {
+		entries = append(entries, entry)
+		return len(entries) <= maxKeys
+	}
+	_, err := l.walk(ctx, h.tree, "")
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > maxKeys {
+		entries = entries[:maxKeys]
+		if maxKeys > 0 {
+			res.IsTruncated = true
+			last := entries[len(entries)-1].key
+			if v2 {
+				res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			} else {
+				res.NextMarker = encode(last)
+			}
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.node == nil {
+			res.CommonPrefixes = append(res.CommonPrefixes, listCommonPrefix{Prefix: encode(entry.key)})
+			continue
+		}
+		res.Contents = append(res.Contents, listContents{
+			Key:          encode(entry.key),
+			LastModified: formatTime(entry.node.ModTime),
+			ETag:         etag(entry.node),
+			Size:         entry.node.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	if v2 {
+		count := len(entries)
+		res.KeyCount = &count
+	}
+
+	writeXML(w, res)
+	return nil
+}
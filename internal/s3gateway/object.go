@@ -0,0 +1,135 @@
+package s3gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/access"
+	"github.com/restic/restic/internal/restic"
+)
+
+// findFile returns the node of the regular file with key. Files and
+// directories which checker denies access to are treated as missing.
+func (h *Handler) findFile(ctx context.Context, key string, checker *access.Checker) (*restic.Node, error) {
+	id := h.tree
+	parts := strings.Split(key, "/")
+	for i, name := range parts {
+		if name == "" {
+			return nil, errNoSuchKey
+		}
+
+		tree, err := h.loadTree(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		node := tree.Find(name)
+		if node == nil || checker.Check(h.snapshotPath(strings.Join(parts[:i+1], "/")), node) == access.Denied {
+			return nil, errNoSuchKey
+		}
+
+		if i == len(parts)-1 {
+			if node.Type != restic.NodeTypeFile {
+				return nil, errNoSuchKey
+			}
+			return node, nil
+		}
+
+		if node.Type != restic.NodeTypeDir || node.Subtree == nil {
+			return nil, errNoSuchKey
+		}
+		id = *node.Subtree
+	}
+	return nil, errNoSuchKey
+}
+
+func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, key string, checker *access.Checker) error {
+	node, err := h.findFile(r.Context(), key, checker)
+	if err != nil {
+		return err
+	}
+
+	// cumsize[i] holds the cumulative size of blobs[:i].
+	cumsize := make([]uint64, 1+len(node.Content))
+	for i, id := range node.Content {
+		size, found := h.repo.LookupBlobSize(restic.DataBlob, id)
+		if !found {
+			return errors.New("id " + id.String() + " not found in repository")
+		}
+		cumsize[i+1] = cumsize[i] + uint64(size)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", etag(node))
+
+	rd := &fileReader{
+		ctx:     r.Context(),
+		h:       h,
+		content: node.Content,
+		cumsize: cumsize,
+	}
+	http.ServeContent(w, r, "", node.ModTime, rd)
+	return nil
+}
+
+// fileReader reads the content of a file.
+type fileReader struct {
+	ctx     context.Context
+	h       *Handler
+	content restic.IDs
+	cumsize []uint64
+	offset  int64
+}
+
+func (f *fileReader) size() int64 {
+	return int64(f.cumsize[len(f.cumsize)-1])
+}
+
+func (f *fileReader) Read(p []byte) (int, error) {
+	if f.offset >= f.size() {
+		return 0, io.EOF
+	}
+
+	offset := uint64(f.offset)
+	i := sort.Search(len(f.cumsize), func(i int) bool {
+		return f.cumsize[i] > offset
+	}) - 1
+
+	id := f.content[i]
+	blob, err := f.h.blobCache.GetOrCompute(id, func() ([]byte, error) {
+		return f.h.repo.LoadBlob(f.ctx, restic.DataBlob, id, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(p, blob[offset-f.cumsize[i]:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *fileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,85 @@
+package sandbox
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// DefaultProbe only checks that the restored data is not empty.
+var DefaultProbe = []string{"sh", "-c", `test -n "$(ls -A "$RESTIC_RESTORE_DIR")"`}
+
+// Container runs the probe in a container without network access using
+// docker or podman.
+type Container struct {
+	// Runtime is the container engine, "docker" or "podman".
+	Runtime string
+	// Image is the container image the probe runs in. The restored data is
+	// mounted read-only at MountPoint.
+	Image      string
+	MountPoint string
+	// RootFS uses the restored data as root file system of the container
+	// instead of an image, which requires podman. The data is modified by
+	// the probe.
+	RootFS bool
+	// Probe is the command run in the container, DefaultProbe if empty. The
+	// check passes if it exits with status zero.
+	Probe []string
+}
+
+func (c *Container) args(name, dir string) ([]string, error) {
+	args := []string{c.Runtime, "run", "--rm", "--name", name, "--network", "none"}
+	if c.RootFS {
+		if c.Runtime != "podman" {
+			return nil, errors.New("using the restored data as root file system requires podman")
+		}
+		args = append(args, "--env", "RESTIC_RESTORE_DIR=/", "--rootfs", dir)
+	} else {
+		args = append(args, "--env", "RESTIC_RESTORE_DIR="+c.MountPoint,
+			"--mount", bindMount(dir, c.MountPoint), c.Image)
+	}
+
+	probe := c.Probe
+	if len(probe) == 0 {
+		probe = DefaultProbe
+	}
+	return append(args, probe...), nil
+}
+
+// bindMount returns the value of --mount which mounts dir read-only at target.
+// Unlike --volume, the value is parsed as CSV, so paths may contain colons and
+// fields with commas or quotes are quoted.
+func bindMount(dir, target string) string {
+	field := func(key, value string) string {
+		f := key + "=" + value
+		if strings.ContainsAny(f, ",\"\n") {
+			f = `"` + strings.ReplaceAll(f, `"`, `""`) + `"`
+		}
+		return f
+	}
+	return strings.Join([]string{"type=bind", field("source", dir), field("target", target), "readonly"}, ",")
+}
+
+// Validate runs the probe in a new container.
+func (c *Container) Validate(ctx context.Context, dir string) (Result, error) {
+	if _, err := exec.LookPath(c.Runtime); err != nil {
+		return Result{}, errors.Errorf("container runtime %v not found: %v", c.Runtime, err)
+	}
+	name, err := newName()
+	if err != nil {
+		return Result{}, err
+	}
+	args, err := c.args(name, dir)
+	if err != nil {
+		return Result{}, err
+	}
+
+	check := run(ctx, "probe", nil, args...)
+	if ctx.Err() != nil {
+		// the container keeps running if only the client was stopped
+		_ = exec.Command(c.Runtime, "rm", "--force", name).Run()
+	}
+	return Result{Checks: []Check{check}}, nil
+}
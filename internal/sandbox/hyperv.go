@@ -0,0 +1,94 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// HyperV boots a restored virtual disk in a new Hyper-V virtual machine. The
+// virtual machine is not connected to a network unless Switch is set.
+type HyperV struct {
+	// Disk is the restored .vhd or .vhdx file.
+	Disk       string
+	Generation int
+	MemoryMB   int
+	Switch     string
+	// BootTimeout is the time to wait for the heartbeat of the integration
+	// services in the guest.
+	BootTimeout time.Duration
+	// Probe is an optional command run on the host once the guest has
+	// booted, the name of the virtual machine is passed in
+	// $RESTIC_SANDBOX_VM. It can use PowerShell Direct to check services in
+	// the guest.
+	Probe []string
+}
+
+// psQuote quotes s as a PowerShell string literal.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func powershell(script string) []string {
+	return []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", "$ErrorActionPreference = 'Stop'; " + script}
+}
+
+func (h *HyperV) createScript(name, dir string) string {
+	script := fmt.Sprintf("New-VM -Name %s -Generation %d -MemoryStartupBytes %dMB -VHDPath %s -Path %s",
+		psQuote(name), h.Generation, h.MemoryMB, psQuote(h.Disk), psQuote(dir))
+	if h.Switch != "" {
+		script += " -SwitchName " + psQuote(h.Switch)
+	}
+	return script + fmt.Sprintf(" | Out-Null; Start-VM -Name %s", psQuote(name))
+}
+
+// bootScript waits until the heartbeat of the guest is reported as OK.
+func (h *HyperV) bootScript(name string) string {
+	return fmt.Sprintf("$deadline = (Get-Date).AddSeconds(%d); "+
+		"while (-not (\"\" + (Get-VM -Name %s).Heartbeat).StartsWith('Ok')) { "+
+		"if ((Get-Date) -gt $deadline) { throw 'no heartbeat from the guest' }; Start-Sleep -Seconds 5 }",
+		int(h.BootTimeout.Seconds()), psQuote(name))
+}
+
+func (h *HyperV) removeScript(name string) string {
+	return fmt.Sprintf("Stop-VM -Name %s -TurnOff -Force; Remove-VM -Name %s -Force", psQuote(name), psQuote(name))
+}
+
+// Validate creates the virtual machine, waits for it to boot and runs the
+// probe. The virtual machine is removed afterwards.
+func (h *HyperV) Validate(ctx context.Context, dir string) (Result, error) {
+	if runtime.GOOS != "windows" {
+		return Result{}, errors.New("the Hyper-V sandbox is only available on Windows")
+	}
+	name, err := newName()
+	if err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	check := run(ctx, "create", nil, powershell(h.createScript(name, dir))...)
+	defer func() {
+		// the virtual machine must also be removed if the context was cancelled
+		_ = run(context.Background(), "remove", nil, powershell(h.removeScript(name))...)
+	}()
+	result.Checks = append(result.Checks, check)
+	if !check.Passed {
+		return result, nil
+	}
+
+	check = run(ctx, "boot", nil, powershell(h.bootScript(name))...)
+	result.Checks = append(result.Checks, check)
+	if !check.Passed || len(h.Probe) == 0 {
+		return result, nil
+	}
+
+	env := append(os.Environ(), "RESTIC_SANDBOX_VM="+name, "RESTIC_RESTORE_DIR="+filepath.Clean(dir))
+	result.Checks = append(result.Checks, run(ctx, "probe", env, h.Probe...))
+	return result, nil
+}
@@ -0,0 +1,88 @@
+// Package sandbox starts restored data in a disposable container or virtual
+// machine and runs health checks against it. It is used to test that a
+// snapshot can actually be restored and used.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+// Sandbox checks the data restored to a directory in an isolated
+// environment, which is removed afterwards.
+type Sandbox interface {
+	// Validate runs the health checks. An error is only returned if the
+	// sandbox could not be set up, failed checks are reported in the result.
+	Validate(ctx context.Context, dir string) (Result, error)
+}
+
+// Check is the outcome of a single health check.
+type Check struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Output   string        `json:"output,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Result collects the checks run in the sandbox.
+type Result struct {
+	Checks []Check `json:"checks"`
+}
+
+// Passed returns true if all checks passed.
+func (r Result) Passed() bool {
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return len(r.Checks) > 0
+}
+
+// maxOutput limits the output of a check stored in the result.
+const maxOutput = 4096
+
+// run executes the command and returns a check named name. Only the end of the
+// output is kept.
+func run(ctx context.Context, name string, env []string, args ...string) Check {
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if env != nil {
+		cmd.Env = env
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	debug.Log("running %v", cmd.Args)
+	err := cmd.Run()
+	output := out.String()
+	if len(output) > maxOutput {
+		output = output[len(output)-maxOutput:]
+	}
+	output = strings.TrimSpace(output)
+	if err != nil {
+		debug.Log("%v failed: %v", name, err)
+		if output != "" {
+			output += "\n"
+		}
+		output += err.Error()
+	}
+	return Check{Name: name, Passed: err == nil, Output: output, Duration: time.Since(start)}
+}
+
+// newName returns a random name for the container or virtual machine.
+func newName() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "restic-validate-" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,77 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestResultPassed(t *testing.T) {
+	rtest.Assert(t, !Result{}.Passed(), "empty result passed")
+	rtest.Assert(t, Result{Checks: []Check{{Passed: true}, {Passed: true}}}.Passed(), "result failed")
+	rtest.Assert(t, !Result{Checks: []Check{{Passed: true}, {Passed: false}}}.Passed(), "result passed")
+}
+
+func TestContainerArgs(t *testing.T) {
+	c := &Container{Runtime: "docker", Image: "alpine", MountPoint: "/restore", Probe: []string{"test", "-f", "/restore/etc/passwd"}}
+	args, err := c.args("name", "/tmp/restore")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"docker", "run", "--rm", "--name", "name", "--network", "none",
+		"--env", "RESTIC_RESTORE_DIR=/restore", "--mount", "type=bind,source=/tmp/restore,target=/restore,readonly", "alpine",
+		"test", "-f", "/restore/etc/passwd"}, args)
+
+	args, err = c.args("name", `/tmp/restore:2024-05-02,"x"`)
+	rtest.OK(t, err)
+	rtest.Equals(t, `type=bind,"source=/tmp/restore:2024-05-02,""x""",target=/restore,readonly`, args[10])
+
+	c.RootFS = true
+	_, err = c.args("name", "/tmp/restore")
+	rtest.Assert(t, err != nil, "expected error for --rootfs with docker")
+
+	c.Runtime = "podman"
+	c.Probe = nil
+	args, err = c.args("name", "/tmp/restore")
+	rtest.OK(t, err)
+	rtest.Equals(t, append([]string{"podman", "run", "--rm", "--name", "name", "--network", "none",
+		"--env", "RESTIC_RESTORE_DIR=/", "--rootfs", "/tmp/restore"}, DefaultProbe...), args)
+}
+
+func TestContainerValidate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as container runtime")
+	}
+
+	// the fake runtime fails if the probe command is "false"
+	runtimePath := filepath.Join(t.TempDir(), "runtime")
+	script := "#!/bin/sh\necho \"$@\"\nfor arg; do last=$arg; done\ntest \"$last\" != false\n"
+	rtest.OK(t, os.WriteFile(runtimePath, []byte(script), 0700))
+
+	for _, probe := range []string{"true", "false"} {
+		c := &Container{Runtime: runtimePath, Image: "alpine", MountPoint: "/restore", Probe: []string{probe}}
+		res, err := c.Validate(context.TODO(), "/tmp/restore")
+		rtest.OK(t, err)
+		rtest.Equals(t, 1, len(res.Checks))
+		rtest.Equals(t, probe == "true", res.Passed())
+		rtest.Assert(t, strings.Contains(res.Checks[0].Output, "source=/tmp/restore,target=/restore"), "unexpected output %q", res.Checks[0].Output)
+	}
+
+	c := &Container{Runtime: "restic-missing-runtime"}
+	_, err := c.Validate(context.TODO(), "/tmp/restore")
+	rtest.Assert(t, err != nil, "expected error for missing runtime")
+}
+
+func TestHyperVScripts(t *testing.T) {
+	h := &HyperV{Disk: `C:\restore\it's.vhdx`, Generation: 2, MemoryMB: 2048, BootTimeout: 5 * time.Minute}
+	rtest.Equals(t, `New-VM -Name 'vm' -Generation 2 -MemoryStartupBytes 2048MB -VHDPath 'C:\restore\it''s.vhdx' -Path 'C:\restore' | Out-Null; Start-VM -Name 'vm'`,
+		h.createScript("vm", `C:\restore`))
+	rtest.Assert(t, strings.Contains(h.bootScript("vm"), "AddSeconds(300)"), "wrong timeout in %q", h.bootScript("vm"))
+
+	h.Switch = "Isolated"
+	rtest.Assert(t, strings.Contains(h.createScript("vm", `C:\restore`), "-SwitchName 'Isolated'"), "switch missing")
+}
@@ -161,33 +161,16 @@ func (b *JSONProgress) ReportTotal(start time.Time, s archiver.ScanStats) {
 	}
 }
 
+// SlowFile reports a file which took longer than the threshold to save.
+func (b *JSONProgress) SlowFile(t archiver.FileTiming) {
+	out := newFileTiming(t)
+	out.MessageType = "slow_file"
+	b.print(out)
+}
+
 // Finish prints the finishing messages.
 func (b *JSONProgress) Finish(snapshotID restic.ID, summary *archiver.Summary, dryRun bool) {
-	id := ""
-	// empty if snapshot creation was skipped
-	if !snapshotID.IsNull() {
-		id = snapshotID.String()
-	}
-	b.print(summaryOutput{
-		MessageType:         "summary",
-		FilesNew:            summary.Files.New,
-		FilesChanged:        summary.Files.Changed,
-		FilesUnmodified:     summary.Files.Unchanged,
-		DirsNew:             summary.Dirs.New,
-		DirsChanged:         summary.Dirs.Changed,
-		DirsUnmodified:      summary.Dirs.Unchanged,
-		DataBlobs:           summary.ItemStats.DataBlobs,
-		TreeBlobs:           summary.ItemStats.TreeBlobs,
-		DataAdded:           summary.ItemStats.DataSize + summary.ItemStats.TreeSize,
-		DataAddedPacked:     summary.ItemStats.DataSizeInRepo + summary.ItemStats.TreeSizeInRepo,
-		TotalFilesProcessed: summary.Files.New + summary.Files.Changed + summary.Files.Unchanged,
-		TotalBytesProcessed: summary.ProcessedBytes,
-		BackupStart:         summary.BackupStart,
-		BackupEnd:           summary.BackupEnd,
-		TotalDuration:       summary.BackupEnd.Sub(summary.BackupStart).Seconds(),
-		SnapshotID:          id,
-		DryRun:              dryRun,
-	})
+	b.print(newSummaryOutput("summary", snapshotID, summary, dryRun))
 }
 
 // Reset no-op
@@ -230,8 +213,33 @@ type verboseUpdate struct {
 	TotalFiles         uint    `json:"total_files"`
 }
 
+type fileTiming struct {
+	MessageType string  `json:"message_type,omitempty"` // "slow_file"
+	Item        string  `json:"item"`
+	Size        uint64  `json:"size"`
+	Duration    float64 `json:"duration"` // in seconds
+	Metadata    float64 `json:"metadata"`
+	Read        float64 `json:"read"`
+	Chunk       float64 `json:"chunk"`
+	Hash        float64 `json:"hash"`
+	Upload      float64 `json:"upload"`
+}
+
+func newFileTiming(t archiver.FileTiming) fileTiming {
+	return fileTiming{
+		Item:     t.Path,
+		Size:     t.Size,
+		Duration: t.Duration.Seconds(),
+		Metadata: t.Metadata.Seconds(),
+		Read:     t.Read.Seconds(),
+		Chunk:    t.Chunk.Seconds(),
+		Hash:     t.Hash.Seconds(),
+		Upload:   t.Upload.Seconds(),
+	}
+}
+
 type summaryOutput struct {
-	MessageType         string    `json:"message_type"` // "summary"
+	MessageType         string    `json:"message_type,omitempty"` // "summary"
 	FilesNew            uint      `json:"files_new"`
 	FilesChanged        uint      `json:"files_changed"`
 	FilesUnmodified     uint      `json:"files_unmodified"`
@@ -249,4 +257,44 @@ type summaryOutput struct {
 	BackupEnd           time.Time `json:"backup_end"`
 	SnapshotID          string    `json:"snapshot_id,omitempty"`
 	DryRun              bool      `json:"dry_run,omitempty"`
+
+	SpecialFiles   *restic.SpecialFileStats            `json:"special_files,omitempty"`
+	Classification map[string]restic.ContentClassStats `json:"classification,omitempty"`
+	SlowFiles      []fileTiming                        `json:"slow_files,omitempty"`
+}
+
+func newSummaryOutput(messageType string, snapshotID restic.ID, summary *archiver.Summary, dryRun bool) summaryOutput {
+	id := ""
+	// empty if snapshot creation was skipped
+	if !snapshotID.IsNull() {
+		id = snapshotID.String()
+	}
+	out := summaryOutput{
+		MessageType:         messageType,
+		FilesNew:            summary.Files.New,
+		FilesChanged:        summary.Files.Changed,
+		FilesUnmodified:     summary.Files.Unchanged,
+		DirsNew:             summary.Dirs.New,
+		DirsChanged:         summary.Dirs.Changed,
+		DirsUnmodified:      summary.Dirs.Unchanged,
+		DataBlobs:           summary.ItemStats.DataBlobs,
+		TreeBlobs:           summary.ItemStats.TreeBlobs,
+		DataAdded:           summary.ItemStats.DataSize + summary.ItemStats.TreeSize,
+		DataAddedPacked:     summary.ItemStats.DataSizeInRepo + summary.ItemStats.TreeSizeInRepo,
+		TotalFilesProcessed: summary.Files.New + summary.Files.Changed + summary.Files.Unchanged,
+		TotalBytesProcessed: summary.ProcessedBytes,
+		BackupStart:         summary.BackupStart,
+		BackupEnd:           summary.BackupEnd,
+		TotalDuration:       summary.BackupEnd.Sub(summary.BackupStart).Seconds(),
+		SnapshotID:          id,
+		DryRun:              dryRun,
+		Classification:      summary.Classification,
+	}
+	if !summary.SpecialFiles.Empty() {
+		out.SpecialFiles = &summary.SpecialFiles
+	}
+	for _, t := range summary.SlowFiles {
+		out.SlowFiles = append(out.SlowFiles, newFileTiming(t))
+	}
+	return out
 }
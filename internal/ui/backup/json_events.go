@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/jsonevents"
+)
+
+// JSONEventsProgress reports progress for the `backup` command as part of the
+// event stream enabled by --json-events.
+type JSONEventsProgress struct {
+	events *jsonevents.Stream
+}
+
+// assert that JSONEventsProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &JSONEventsProgress{}
+
+// NewJSONEventsProgress returns a new backup progress reporter.
+func NewJSONEventsProgress(events *jsonevents.Stream) *JSONEventsProgress {
+	return &JSONEventsProgress{events: events}
+}
+
+// Update reports the current progress.
+func (b *JSONEventsProgress) Update(total, processed Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64) {
+	p := jsonevents.Progress{
+		SecondsElapsed:   uint64(time.Since(start) / time.Second),
+		SecondsRemaining: secs,
+		FilesDone:        processed.Files,
+		FilesTotal:       total.Files,
+		BytesDone:        processed.Bytes,
+		BytesTotal:       total.Bytes,
+		ErrorCount:       uint64(errors),
+	}
+	if total.Bytes > 0 {
+		p.PercentDone = float64(processed.Bytes) / float64(total.Bytes)
+	}
+	for filename := range currentFiles {
+		p.CurrentFiles = append(p.CurrentFiles, filename)
+	}
+	sort.Strings(p.CurrentFiles)
+
+	b.events.Progress(p)
+}
+
+// ScannerError reports errors of the scanner as warnings, they only affect
+// the progress estimation.
+func (b *JSONEventsProgress) ScannerError(item string, err error) error {
+	b.events.Warning(item, err.Error())
+	return nil
+}
+
+// Error reports an error for a file which could not be saved.
+func (b *JSONEventsProgress) Error(item string, err error) error {
+	b.events.Error(item, err)
+	return nil
+}
+
+// CompleteItem does nothing, the event stream does not contain single files.
+func (b *JSONEventsProgress) CompleteItem(_, _ string, _ archiver.ItemStats, _ time.Duration) {}
+
+// ReportTotal does nothing, the totals are part of the progress events.
+func (b *JSONEventsProgress) ReportTotal(_ time.Time, _ archiver.ScanStats) {}
+
+// SlowFile reports a file which took longer than the threshold to save as a
+// warning.
+func (b *JSONEventsProgress) SlowFile(t archiver.FileTiming) {
+	b.events.Warning(t.Path, "slow file: "+t.String())
+}
+
+// Finish reports the summary.
+func (b *JSONEventsProgress) Finish(snapshotID restic.ID, summary *archiver.Summary, dryRun bool) {
+	b.events.Summary(newSummaryOutput("", snapshotID, summary, dryRun))
+}
+
+// Reset no-op
+func (b *JSONEventsProgress) Reset() {}
+
+// P discards the message.
+func (b *JSONEventsProgress) P(_ string, _ ...interface{}) {}
+
+// V discards the message.
+func (b *JSONEventsProgress) V(_ string, _ ...interface{}) {}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/events"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui/progress"
 )
@@ -17,6 +18,7 @@ type ProgressPrinter interface {
 	ScannerError(item string, err error) error
 	CompleteItem(messageType string, item string, s archiver.ItemStats, d time.Duration)
 	ReportTotal(start time.Time, s archiver.ScanStats)
+	SlowFile(t archiver.FileTiming)
 	Finish(snapshotID restic.ID, summary *archiver.Summary, dryRun bool)
 	Reset()
 
@@ -45,6 +47,8 @@ type Progress struct {
 	printer ProgressPrinter
 }
 
+var _ events.Sink = &Progress{}
+
 func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
 	p := &Progress{
 		start:        time.Now(),
@@ -85,13 +89,15 @@ func (p *Progress) Error(item string, err error) error {
 	p.mu.Lock()
 	p.errors++
 	p.scanStarted = true
+	// tell the status display to remove the line
+	delete(p.currentFiles, item)
 	p.mu.Unlock()
 
 	return p.printer.Error(item, err)
 }
 
-// StartFile is called when a file is being processed by a worker.
-func (p *Progress) StartFile(filename string) {
+// FileStarted is called when a file is being processed by a worker.
+func (p *Progress) FileStarted(filename string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.currentFiles[filename] = struct{}{}
@@ -105,56 +111,43 @@ func (p *Progress) addProcessed(c Counter) {
 	p.scanStarted = true
 }
 
-// CompleteBlob is called for all saved blobs for files.
-func (p *Progress) CompleteBlob(bytes uint64) {
+// BlobUploaded is called for all saved blobs for files.
+func (p *Progress) BlobUploaded(bytes uint64) {
 	p.mu.Lock()
 	p.addProcessed(Counter{Bytes: bytes})
 	p.mu.Unlock()
 }
 
-// CompleteItem is the status callback function for the archiver when a
-// file/dir has been saved successfully.
-func (p *Progress) CompleteItem(item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
-	if current == nil {
-		// error occurred, tell the status display to remove the line
-		p.mu.Lock()
-		delete(p.currentFiles, item)
-		p.mu.Unlock()
+// FileFinished is called when a file/dir has been saved successfully.
+func (p *Progress) FileFinished(item events.Item) {
+	var c Counter
+	switch item.Type {
+	case events.TypeDir:
+		c.Dirs = 1
+	case events.TypeFile:
+		c.Files = 1
+	default:
 		return
 	}
 
-	switch current.Type {
-	case restic.NodeTypeDir:
-		p.mu.Lock()
-		p.addProcessed(Counter{Dirs: 1})
-		p.mu.Unlock()
-
-		switch {
-		case previous == nil:
-			p.printer.CompleteItem("dir new", item, s, d)
-		case previous.Equals(*current):
-			p.printer.CompleteItem("dir unchanged", item, s, d)
-		default:
-			p.printer.CompleteItem("dir modified", item, s, d)
-		}
+	p.mu.Lock()
+	p.addProcessed(c)
+	delete(p.currentFiles, item.Path)
+	p.mu.Unlock()
 
-	case restic.NodeTypeFile:
-		p.mu.Lock()
-		p.addProcessed(Counter{Files: 1})
-		delete(p.currentFiles, item)
-		p.mu.Unlock()
-
-		switch {
-		case previous == nil:
-			p.printer.CompleteItem("file new", item, s, d)
-		case previous.Equals(*current):
-			p.printer.CompleteItem("file unchanged", item, s, d)
-		default:
-			p.printer.CompleteItem("file modified", item, s, d)
-		}
+	s := archiver.ItemStats{
+		DataSize:       item.Size,
+		DataSizeInRepo: item.SizeInRepo,
+		TreeSize:       item.MetadataSize,
+		TreeSizeInRepo: item.MetadataSizeInRepo,
 	}
+	p.printer.CompleteItem(string(item.Type)+" "+string(item.Action), item.Path, s, item.Duration)
 }
 
+// Summary is called once the snapshot has been saved. The summary is printed
+// by Finish instead, as it also covers dry runs.
+func (p *Progress) Summary(events.Summary) {}
+
 // ReportTotal sets the total stats up to now
 func (p *Progress) ReportTotal(item string, s archiver.ScanStats) {
 	p.mu.Lock()
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/events"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -33,6 +34,7 @@ func (p *mockPrinter) CompleteItem(messageType string, _ string, _ archiver.Item
 }
 
 func (p *mockPrinter) ReportTotal(_ time.Time, _ archiver.ScanStats) {}
+func (p *mockPrinter) SlowFile(_ archiver.FileTiming)                {}
 func (p *mockPrinter) Finish(id restic.ID, _ *archiver.Summary, _ bool) {
 	p.Lock()
 	defer p.Unlock()
@@ -51,15 +53,11 @@ func TestProgress(t *testing.T) {
 	prnt := &mockPrinter{}
 	prog := NewProgress(prnt, time.Millisecond)
 
-	prog.StartFile("foo")
-	prog.CompleteBlob(1024)
+	prog.FileStarted("foo")
+	prog.BlobUploaded(1024)
 
-	// "dir unchanged"
-	node := restic.Node{Type: restic.NodeTypeDir}
-	prog.CompleteItem("foo", &node, &node, archiver.ItemStats{}, 0)
-	// "file new"
-	node.Type = restic.NodeTypeFile
-	prog.CompleteItem("foo", nil, &node, archiver.ItemStats{}, 0)
+	prog.FileFinished(events.Item{Path: "foo", Type: events.TypeDir, Action: events.ActionUnchanged})
+	prog.FileFinished(events.Item{Path: "foo", Type: events.TypeFile, Action: events.ActionNew})
 
 	time.Sleep(10 * time.Millisecond)
 	id := restic.NewRandomID()
@@ -17,6 +17,8 @@ type TextProgress struct {
 
 	term      ui.Terminal
 	verbosity uint
+	// otherJobs returns the status lines of concurrently running backups.
+	otherJobs func() []string
 }
 
 // assert that Backup implements the ProgressPrinter interface
@@ -31,6 +33,12 @@ func NewTextProgress(term ui.Terminal, verbosity uint) *TextProgress {
 	}
 }
 
+// SetOtherJobs sets the function which returns the status lines of other
+// backups running at the same time. They are shown below the status line.
+func (b *TextProgress) SetOtherJobs(otherJobs func() []string) {
+	b.otherJobs = otherJobs
+}
+
 // Update updates the status lines.
 func (b *TextProgress) Update(total, processed Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64) {
 	var status string
@@ -67,6 +75,9 @@ func (b *TextProgress) Update(total, processed Counter, errors uint, currentFile
 		lines = append(lines, filename)
 	}
 	sort.Strings(lines)
+	if b.otherJobs != nil {
+		lines = append(b.otherJobs(), lines...)
+	}
 	lines = append([]string{status}, lines...)
 
 	b.term.SetStatus(lines)
@@ -122,6 +133,12 @@ func (b *TextProgress) ReportTotal(start time.Time, s archiver.ScanStats) {
 	)
 }
 
+// SlowFile reports a file which took longer than the threshold to save.
+func (b *TextProgress) SlowFile(t archiver.FileTiming) {
+	t.Path = termstatus.Quote(t.Path)
+	b.P("slow file %v", t)
+}
+
 // Reset status
 func (b *TextProgress) Reset() {
 	if b.term.CanUpdateStatus() {
@@ -134,6 +151,20 @@ func (b *TextProgress) Finish(id restic.ID, summary *archiver.Summary, dryRun bo
 	b.P("\n")
 	b.P("Files:       %5d new, %5d changed, %5d unmodified\n", summary.Files.New, summary.Files.Changed, summary.Files.Unchanged)
 	b.P("Dirs:        %5d new, %5d changed, %5d unmodified\n", summary.Dirs.New, summary.Dirs.Changed, summary.Dirs.Unchanged)
+	if !summary.SpecialFiles.Empty() {
+		b.P("Special:     %s\n", summary.SpecialFiles.Format("stored"))
+	}
+	for _, class := range sortedClasses(summary.Classification) {
+		s := summary.Classification[class]
+		b.V("Content:     %-10s %5d files, %v\n", class, s.Files, ui.FormatBytes(s.Bytes))
+	}
+	if len(summary.SlowFiles) > 0 {
+		b.P("Slowest files:\n")
+		for _, t := range summary.SlowFiles {
+			t.Path = termstatus.Quote(t.Path)
+			b.P("  %v\n", t)
+		}
+	}
 	b.V("Data Blobs:  %5d new\n", summary.ItemStats.DataBlobs)
 	b.V("Tree Blobs:  %5d new\n", summary.ItemStats.TreeBlobs)
 	verb := "Added"
@@ -158,3 +189,19 @@ func (b *TextProgress) Finish(id restic.ID, summary *archiver.Summary, dryRun bo
 		}
 	}
 }
+
+// sortedClasses returns the content classes ordered by decreasing size.
+func sortedClasses(stats map[string]restic.ContentClassStats) []string {
+	classes := make([]string, 0, len(stats))
+	for class := range stats {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		a, b := stats[classes[i]], stats[classes[j]]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return classes[i] < classes[j]
+	})
+	return classes
+}
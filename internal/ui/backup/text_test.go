@@ -2,6 +2,7 @@ package backup
 
 import (
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/test"
@@ -25,3 +26,15 @@ func TestScannerError(t *testing.T) {
 	test.Equals(t, printer.ScannerError("/path", errors.New("error \"message\"")), nil)
 	test.Equals(t, []string{"scan: error \"message\"\n"}, term.Errors)
 }
+
+func TestUpdateOtherJobs(t *testing.T) {
+	term := &ui.MockTerminal{}
+	printer := NewTextProgress(term, 1)
+	printer.SetOtherJobs(func() []string {
+		return []string{"job nightly: 10 files"}
+	})
+	printer.Update(Counter{}, Counter{Files: 1}, 0, map[string]struct{}{"/file": {}}, time.Now(), 0)
+	test.Equals(t, 3, len(term.Output))
+	test.Equals(t, "job nightly: 10 files", term.Output[1])
+	test.Equals(t, "/file", term.Output[2])
+}
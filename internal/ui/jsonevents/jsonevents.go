@@ -0,0 +1,175 @@
+// Package jsonevents implements the newline-delimited JSON event stream which
+// is printed by the long-running commands when --json-events is set.
+//
+// Every line is a single JSON object with the fields "event", "command" and
+// "time". The event type is one of "phase", "progress", "warning", "error" and
+// "summary", the other fields depend on the type, see Event.
+package jsonevents
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// Event types.
+const (
+	TypePhase    = "phase"
+	TypeProgress = "progress"
+	TypeWarning  = "warning"
+	TypeError    = "error"
+	TypeSummary  = "summary"
+)
+
+// Event is a single line of the event stream.
+type Event struct {
+	Event   string    `json:"event"`
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+
+	// Phase is the name of the phase which has started, for phase events.
+	Phase string `json:"phase,omitempty"`
+	// Progress is set for progress events.
+	Progress *Progress `json:"progress,omitempty"`
+	// Item is the file or object affected by a warning or error, if any.
+	Item string `json:"item,omitempty"`
+	// Message is the text of a warning or error.
+	Message string `json:"message,omitempty"`
+	// Summary is set for summary events, its fields depend on the command.
+	Summary interface{} `json:"summary,omitempty"`
+}
+
+// Progress describes the progress of the current phase. Commands which
+// process files report files and bytes, the others report generic items
+// described by Description.
+type Progress struct {
+	Description      string   `json:"description,omitempty"`
+	SecondsElapsed   uint64   `json:"seconds_elapsed"`
+	SecondsRemaining uint64   `json:"seconds_remaining,omitempty"`
+	PercentDone      float64  `json:"percent_done"`
+	ItemsDone        uint64   `json:"items_done,omitempty"`
+	ItemsTotal       uint64   `json:"items_total,omitempty"`
+	FilesDone        uint64   `json:"files_done,omitempty"`
+	FilesTotal       uint64   `json:"files_total,omitempty"`
+	BytesDone        uint64   `json:"bytes_done,omitempty"`
+	BytesTotal       uint64   `json:"bytes_total,omitempty"`
+	ErrorCount       uint64   `json:"error_count,omitempty"`
+	CurrentFiles     []string `json:"current_files,omitempty"`
+}
+
+// Stream prints events for a command. All methods can be called on a nil
+// Stream, in which case they do nothing. It is safe to use a Stream from
+// concurrent goroutines.
+type Stream struct {
+	term     ui.Terminal
+	command  string
+	interval time.Duration
+}
+
+var _ progress.Printer = &Stream{}
+
+// New returns a Stream which prints the events of command to term. Counters
+// returned by NewCounter report their progress every interval.
+func New(term ui.Terminal, command string, interval time.Duration) *Stream {
+	return &Stream{
+		term:     term,
+		command:  command,
+		interval: interval,
+	}
+}
+
+func (s *Stream) emit(e Event) {
+	e.Command = s.command
+	e.Time = time.Now()
+	s.term.Print(ui.ToJSONString(e))
+}
+
+// Phase reports that a new phase of the command has started.
+func (s *Stream) Phase(name string) {
+	if s == nil {
+		return
+	}
+	s.emit(Event{Event: TypePhase, Phase: name})
+}
+
+// Progress reports the progress of the current phase.
+func (s *Stream) Progress(p Progress) {
+	if s == nil {
+		return
+	}
+	s.emit(Event{Event: TypeProgress, Progress: &p})
+}
+
+// Warning reports a problem which does not affect the result of the command.
+func (s *Stream) Warning(item string, msg string) {
+	if s == nil {
+		return
+	}
+	s.emit(Event{Event: TypeWarning, Item: item, Message: msg})
+}
+
+// Error reports an error for item.
+func (s *Stream) Error(item string, err error) {
+	if s == nil {
+		return
+	}
+	s.emit(Event{Event: TypeError, Item: item, Message: err.Error()})
+}
+
+// Summary reports the result of the command.
+func (s *Stream) Summary(summary interface{}) {
+	if s == nil {
+		return
+	}
+	s.emit(Event{Event: TypeSummary, Summary: summary})
+}
+
+// NewCounter returns a counter which reports its value as progress events.
+func (s *Stream) NewCounter(description string) *progress.Counter {
+	if s == nil {
+		return nil
+	}
+	return progress.NewCounter(s.interval, 0, func(value uint64, total uint64, runtime time.Duration, _ bool) {
+		p := Progress{
+			Description:    description,
+			SecondsElapsed: uint64(runtime / time.Second),
+			ItemsDone:      value,
+			ItemsTotal:     total,
+		}
+		if total > 0 {
+			p.PercentDone = float64(value) / float64(total)
+		}
+		s.Progress(p)
+	})
+}
+
+// NewCounterMax is like NewCounter, but also sets the total number of items.
+func (s *Stream) NewCounterMax(description string, max uint64) *progress.Counter {
+	c := s.NewCounter(description)
+	c.SetMax(max)
+	return c
+}
+
+// E reports an error message.
+func (s *Stream) E(msg string, args ...interface{}) {
+	if s == nil {
+		return
+	}
+	msg = strings.TrimSpace(fmt.Sprintf(msg, args...))
+	if msg == "" {
+		return
+	}
+	s.emit(Event{Event: TypeError, Message: msg})
+}
+
+// P discards the message, the stream only contains events.
+func (s *Stream) P(_ string, _ ...interface{}) {}
+
+// V discards the message, the stream only contains events.
+func (s *Stream) V(_ string, _ ...interface{}) {}
+
+// VV discards the message, the stream only contains events.
+func (s *Stream) VV(_ string, _ ...interface{}) {}
@@ -0,0 +1,72 @@
+package jsonevents
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
+)
+
+func TestStream(t *testing.T) {
+	term := &ui.MockTerminal{}
+	s := New(term, "check", 0)
+
+	s.Phase("load index")
+	s.Warning("", "some warning")
+	s.Error("foo", errors.New("failed"))
+	s.E("error: %v\n", "bar")
+	s.P("ignored\n")
+	s.Summary(map[string]int{"num_errors": 2})
+
+	var events []Event
+	for _, line := range term.Output {
+		var e Event
+		test.OK(t, json.Unmarshal([]byte(line), &e))
+		test.Equals(t, "check", e.Command)
+		test.Assert(t, !e.Time.IsZero(), "time not set for %q", line)
+		events = append(events, e)
+	}
+
+	test.Equals(t, 5, len(events))
+	test.Equals(t, TypePhase, events[0].Event)
+	test.Equals(t, "load index", events[0].Phase)
+	test.Equals(t, TypeWarning, events[1].Event)
+	test.Equals(t, "some warning", events[1].Message)
+	test.Equals(t, TypeError, events[2].Event)
+	test.Equals(t, "foo", events[2].Item)
+	test.Equals(t, "failed", events[2].Message)
+	test.Equals(t, TypeError, events[3].Event)
+	test.Equals(t, "error: bar", events[3].Message)
+	test.Equals(t, TypeSummary, events[4].Event)
+	test.Equals(t, map[string]interface{}{"num_errors": float64(2)}, events[4].Summary)
+}
+
+func TestStreamCounter(t *testing.T) {
+	term := &ui.MockTerminal{}
+	s := New(term, "prune", 0)
+
+	c := s.NewCounterMax("packs", 4)
+	c.Add(1)
+	c.Done()
+
+	test.Equals(t, 1, len(term.Output))
+	var e Event
+	test.OK(t, json.Unmarshal([]byte(term.Output[0]), &e))
+	test.Equals(t, TypeProgress, e.Event)
+	test.Equals(t, &Progress{
+		Description: "packs",
+		PercentDone: 0.25,
+		ItemsDone:   1,
+		ItemsTotal:  4,
+	}, e.Progress)
+}
+
+func TestNilStream(t *testing.T) {
+	var s *Stream
+	s.Phase("foo")
+	s.Error("foo", errors.New("failed"))
+	s.Summary(nil)
+	test.Assert(t, s.NewCounter("foo") == nil, "nil stream returned a counter")
+}
@@ -135,7 +135,7 @@ type verboseUpdate struct {
 }
 
 type summaryOutput struct {
-	MessageType    string `json:"message_type"` // "summary"
+	MessageType    string `json:"message_type,omitempty"` // "summary"
 	SecondsElapsed uint64 `json:"seconds_elapsed,omitempty"`
 	TotalFiles     uint64 `json:"total_files,omitempty"`
 	FilesRestored  uint64 `json:"files_restored,omitempty"`
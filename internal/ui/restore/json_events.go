@@ -0,0 +1,51 @@
+package restore
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/ui/jsonevents"
+)
+
+type jsonEventsPrinter struct {
+	events *jsonevents.Stream
+}
+
+// NewJSONEventsProgress returns a printer which reports the progress of the
+// restore as part of the event stream enabled by --json-events.
+func NewJSONEventsProgress(events *jsonevents.Stream) ProgressPrinter {
+	return &jsonEventsPrinter{events: events}
+}
+
+func (t *jsonEventsPrinter) Update(p State, duration time.Duration) {
+	progress := jsonevents.Progress{
+		SecondsElapsed: uint64(duration / time.Second),
+		FilesDone:      p.FilesFinished + p.FilesSkipped,
+		FilesTotal:     p.FilesTotal,
+		BytesDone:      p.AllBytesWritten + p.AllBytesSkipped,
+		BytesTotal:     p.AllBytesTotal,
+	}
+	if p.AllBytesTotal > 0 {
+		progress.PercentDone = float64(progress.BytesDone) / float64(p.AllBytesTotal)
+	}
+	t.events.Progress(progress)
+}
+
+func (t *jsonEventsPrinter) Error(item string, err error) error {
+	t.events.Error(item, err)
+	return nil
+}
+
+func (t *jsonEventsPrinter) CompleteItem(_ ItemAction, _ string, _ uint64) {}
+
+func (t *jsonEventsPrinter) Finish(p State, duration time.Duration) {
+	t.events.Summary(summaryOutput{
+		SecondsElapsed: uint64(duration / time.Second),
+		TotalFiles:     p.FilesTotal,
+		FilesRestored:  p.FilesFinished,
+		FilesSkipped:   p.FilesSkipped,
+		FilesDeleted:   p.FilesDeleted,
+		TotalBytes:     p.AllBytesTotal,
+		BytesRestored:  p.AllBytesWritten,
+		BytesSkipped:   p.AllBytesSkipped,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/restic/restic/internal/events"
 	"github.com/restic/restic/internal/ui/progress"
 )
 
@@ -26,6 +27,7 @@ type Progress struct {
 	started         time.Time
 
 	printer ProgressPrinter
+	sink    events.Sink
 }
 
 type progressInfoEntry struct {
@@ -62,6 +64,50 @@ func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
 	return p
 }
 
+// State returns the current progress.
+func (p *Progress) State() State {
+	if p == nil {
+		return State{}
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.s
+}
+
+// SetEventSink passes finished items, errors and the summary to sink in
+// addition to the printer.
+func (p *Progress) SetEventSink(sink events.Sink) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.sink = sink
+}
+
+// completeItem must be called with p.m held.
+func (p *Progress) completeItem(action ItemAction, name string, size uint64) {
+	p.printer.CompleteItem(action, name, size)
+	if p.sink == nil {
+		return
+	}
+
+	item := events.Item{Path: name, Size: size}
+	switch action {
+	case ActionDirRestored:
+		item.Type, item.Action = events.TypeDir, events.ActionRestored
+	case ActionFileRestored:
+		item.Type, item.Action = events.TypeFile, events.ActionRestored
+	case ActionFileUpdated:
+		item.Type, item.Action = events.TypeFile, events.ActionUpdated
+	case ActionFileUnchanged:
+		item.Type, item.Action = events.TypeFile, events.ActionUnchanged
+	case ActionOtherRestored:
+		item.Type, item.Action = events.TypeOther, events.ActionRestored
+	case ActionDeleted:
+		item.Type, item.Action = events.TypeOther, events.ActionDeleted
+	}
+	p.sink.FileFinished(item)
+}
+
 func (p *Progress) update(runtime time.Duration, final bool) {
 	p.m.Lock()
 	defer p.m.Unlock()
@@ -70,6 +116,16 @@ func (p *Progress) update(runtime time.Duration, final bool) {
 		p.printer.Update(p.s, runtime)
 	} else {
 		p.printer.Finish(p.s, runtime)
+		if p.sink != nil {
+			p.sink.Summary(events.Summary{
+				FilesRestored:  uint(p.s.FilesFinished),
+				FilesSkipped:   uint(p.s.FilesSkipped),
+				FilesDeleted:   uint(p.s.FilesDeleted),
+				BytesProcessed: p.s.AllBytesWritten,
+				Start:          p.started,
+				End:            p.started.Add(runtime),
+			})
+		}
 	}
 }
 
@@ -107,7 +163,7 @@ func (p *Progress) AddProgress(name string, action ItemAction, bytesWrittenPorti
 		delete(p.progressInfoMap, name)
 		p.s.FilesFinished++
 
-		p.printer.CompleteItem(action, name, bytesTotal)
+		p.completeItem(action, name, bytesTotal)
 	}
 }
 
@@ -122,7 +178,7 @@ func (p *Progress) AddSkippedFile(name string, size uint64) {
 	p.s.FilesSkipped++
 	p.s.AllBytesSkipped += size
 
-	p.printer.CompleteItem(ActionFileUnchanged, name, size)
+	p.completeItem(ActionFileUnchanged, name, size)
 }
 
 func (p *Progress) ReportDeletion(name string) {
@@ -130,12 +186,11 @@ func (p *Progress) ReportDeletion(name string) {
 		return
 	}
 
-	p.s.FilesDeleted++
-
 	p.m.Lock()
 	defer p.m.Unlock()
 
-	p.printer.CompleteItem(ActionDeleted, name, 0)
+	p.s.FilesDeleted++
+	p.completeItem(ActionDeleted, name, 0)
 }
 
 func (p *Progress) Error(item string, err error) error {
@@ -146,9 +201,17 @@ func (p *Progress) Error(item string, err error) error {
 	p.m.Lock()
 	defer p.m.Unlock()
 
+	if p.sink != nil {
+		if serr := p.sink.Error(item, err); serr != nil {
+			return serr
+		}
+	}
 	return p.printer.Error(item, err)
 }
 
+// Finish stops the progress updates and prints the final status. If an event
+// sink is set, the summary is passed to it, so Finish should only be called
+// if the restore was successful.
 func (p *Progress) Finish() {
 	p.updater.Done()
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/events"
 	"github.com/restic/restic/internal/test"
 )
 
@@ -219,3 +220,34 @@ func TestProgressError(t *testing.T) {
 		errorTraceEntry{"second", err2},
 	}, errors)
 }
+
+type mockSink struct {
+	events.NopSink
+	items   []events.Item
+	summary events.Summary
+}
+
+func (s *mockSink) FileFinished(item events.Item)  { s.items = append(s.items, item) }
+func (s *mockSink) Summary(summary events.Summary) { s.summary = summary }
+
+func TestProgressEventSink(t *testing.T) {
+	sink := &mockSink{}
+	progress := NewProgress(&mockPrinter{}, 0)
+	progress.SetEventSink(sink)
+
+	progress.AddFile(10)
+	progress.AddProgress("file", ActionFileRestored, 10, 10)
+	progress.AddSkippedFile("skipped", 5)
+	progress.ReportDeletion("del")
+	progress.Finish()
+
+	test.Equals(t, []events.Item{
+		{Path: "file", Type: events.TypeFile, Action: events.ActionRestored, Size: 10},
+		{Path: "skipped", Type: events.TypeFile, Action: events.ActionUnchanged, Size: 5},
+		{Path: "del", Type: events.TypeOther, Action: events.ActionDeleted},
+	}, sink.items)
+	test.Equals(t, uint(1), sink.summary.FilesRestored)
+	test.Equals(t, uint(1), sink.summary.FilesSkipped)
+	test.Equals(t, uint(1), sink.summary.FilesDeleted)
+	test.Equals(t, uint64(10), sink.summary.BytesProcessed)
+}
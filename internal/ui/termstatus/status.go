@@ -32,6 +32,8 @@ type Terminal struct {
 
 	clearCurrentLine func(io.Writer, uintptr)
 	moveCursorUp     func(io.Writer, uintptr, int)
+
+	logger func(line string, isErr bool)
 }
 
 type message struct {
@@ -78,6 +80,13 @@ func New(wr io.Writer, errWriter io.Writer, disableStatus bool) *Terminal {
 	return t
 }
 
+// SetLogger sets a function which is called for each message in addition to
+// printing it, status lines are not passed to it. SetLogger must be called
+// before any message is printed.
+func (t *Terminal) SetLogger(logger func(line string, isErr bool)) {
+	t.logger = logger
+}
+
 // CanUpdateStatus return whether the status output is updated in place.
 func (t *Terminal) CanUpdateStatus() bool {
 	return t.canUpdateStatus
@@ -240,6 +249,10 @@ func (t *Terminal) print(line string, isErr bool) {
 		line += "\n"
 	}
 
+	if t.logger != nil {
+		t.logger(line, isErr)
+	}
+
 	select {
 	case t.msg <- message{line: line, err: isErr}:
 	case <-t.closed:
@@ -57,6 +57,37 @@ func TestSetStatus(t *testing.T) {
 	rtest.Equals(t, exp, buf.String())
 }
 
+func TestSetLogger(t *testing.T) {
+	var buf bytes.Buffer
+	term := New(&buf, io.Discard, false)
+
+	type logged struct {
+		line  string
+		isErr bool
+	}
+	var messages []logged
+	term.SetLogger(func(line string, isErr bool) {
+		messages = append(messages, logged{line, isErr})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		term.Run(ctx)
+		close(done)
+	}()
+
+	term.Print("message")
+	term.Error("error\n")
+	term.SetStatus([]string{"status"})
+
+	cancel()
+	<-done
+
+	// status lines are not logged
+	rtest.Equals(t, []logged{{"message\n", false}, {"error\n", true}}, messages)
+}
+
 func TestQuote(t *testing.T) {
 	for _, c := range []struct {
 		in        string
@@ -0,0 +1,323 @@
+// Package vault reads secrets such as repository passwords and backend
+// credentials from a HashiCorp Vault server, so that backup clients do not
+// need to store static secrets. The client authenticates using a token, a
+// token file written by the Vault agent, AppRole credentials or the auto-auth
+// token of a Vault agent running as a proxy.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Config configures the connection to the Vault server. If no credentials
+// are configured, requests are sent without a token. This works with a Vault
+// agent which has use_auto_auth_token enabled.
+type Config struct {
+	// Address of the Vault server or the Vault agent, e.g.
+	// https://vault.example.com:8200.
+	Address   string
+	Namespace string
+
+	// Token is used directly if set.
+	Token string
+	// TokenFile is read if Token is empty, usually it is the sink file of
+	// the Vault agent.
+	TokenFile string
+
+	// RoleID and SecretID are used to log in via AppRole if neither Token
+	// nor TokenFile is set.
+	RoleID   string
+	SecretID string
+	// AppRoleMount is the mount path of the AppRole auth method, defaults
+	// to "approle".
+	AppRoleMount string
+
+	Transport http.RoundTripper
+}
+
+// ConfigFromEnv returns a config using the environment variables also
+// understood by the vault CLI. VAULT_AGENT_ADDR takes precedence over
+// VAULT_ADDR.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Address:      os.Getenv("VAULT_ADDR"),
+		Namespace:    os.Getenv("VAULT_NAMESPACE"),
+		Token:        os.Getenv("VAULT_TOKEN"),
+		TokenFile:    os.Getenv("RESTIC_VAULT_TOKEN_FILE"),
+		RoleID:       os.Getenv("VAULT_ROLE_ID"),
+		SecretID:     os.Getenv("VAULT_SECRET_ID"),
+		AppRoleMount: os.Getenv("RESTIC_VAULT_APPROLE_MOUNT"),
+	}
+	if addr := os.Getenv("VAULT_AGENT_ADDR"); addr != "" {
+		cfg.Address = addr
+	}
+	return cfg
+}
+
+// Ref references a field of a secret, it is written as "path#field", e.g.
+// "secret/data/restic/prod#password". For the KV secrets engine version 2,
+// the path must contain the "data/" element.
+type Ref struct {
+	Path  string
+	Field string
+}
+
+// ParseRef parses s as a reference to a field of a secret.
+func ParseRef(s string) (Ref, error) {
+	path, field, ok := strings.Cut(s, "#")
+	path = strings.Trim(path, "/")
+	if !ok || path == "" || field == "" {
+		return Ref{}, errors.Errorf("invalid vault secret %q, expected path#field", s)
+	}
+	return Ref{Path: path, Field: field}, nil
+}
+
+func (r Ref) String() string {
+	return r.Path + "#" + r.Field
+}
+
+// renewBefore is the remaining lifetime of the token at which it is renewed.
+const renewBefore = time.Minute
+
+type cachedSecret struct {
+	data    map[string]interface{}
+	expires time.Time
+}
+
+// Client reads secrets from Vault. Secrets are cached for their lease
+// duration, or for the lifetime of the client if they have no lease. Tokens
+// obtained via AppRole are renewed in the background until Close is called.
+//
+// The methods are safe for concurrent use.
+type Client struct {
+	cfg    Config
+	client *http.Client
+
+	mu         sync.Mutex
+	token      string
+	loggedIn   bool
+	renewTimer *time.Timer
+	cache      map[string]cachedSecret
+}
+
+// New returns a new client.
+func New(cfg Config) (*Client, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("vault address is not set, use VAULT_ADDR or VAULT_AGENT_ADDR")
+	}
+	if cfg.AppRoleMount == "" {
+		cfg.AppRoleMount = "approle"
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = http.DefaultTransport
+	}
+	return &Client{
+		cfg:    cfg,
+		client: &http.Client{Transport: cfg.Transport},
+		cache:  make(map[string]cachedSecret),
+	}, nil
+}
+
+// Close stops the renewal of the token.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.renewTimer != nil {
+		c.renewTimer.Stop()
+		c.renewTimer = nil
+	}
+}
+
+type authResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+type secretResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+type errorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// do sends a request to the server and decodes the JSON response into res.
+func (c *Client) do(ctx context.Context, method, path, token string, body, res interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.cfg.Address, "/")+"/v1/"+path, rd)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.cfg.Namespace)
+	}
+	// required if the Vault agent forwards requests
+	req.Header.Set("X-Vault-Request", "true")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		if len(e.Errors) > 0 {
+			return errors.Errorf("vault: %v %v: %v", method, path, strings.Join(e.Errors, ", "))
+		}
+		return errors.Errorf("vault: %v %v: unexpected status %v", method, path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// authToken returns the token used for requests, logging in if necessary.
+// The caller must hold c.mu.
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	if c.loggedIn {
+		return c.token, nil
+	}
+
+	switch {
+	case c.cfg.Token != "":
+		c.token = c.cfg.Token
+	case c.cfg.TokenFile != "":
+		buf, err := os.ReadFile(c.cfg.TokenFile)
+		if err != nil {
+			return "", errors.Wrap(err, "vault token file")
+		}
+		c.token = strings.TrimSpace(string(buf))
+	case c.cfg.RoleID != "":
+		err := c.login(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+	c.loggedIn = true
+	return c.token, nil
+}
+
+// login authenticates using AppRole. The caller must hold c.mu.
+func (c *Client) login(ctx context.Context) error {
+	var res authResponse
+	err := c.do(ctx, http.MethodPost, "auth/"+c.cfg.AppRoleMount+"/login", "", map[string]string{
+		"role_id":   c.cfg.RoleID,
+		"secret_id": c.cfg.SecretID,
+	}, &res)
+	if err != nil {
+		return err
+	}
+	debug.Log("logged in via AppRole, lease duration %vs", res.Auth.LeaseDuration)
+	c.token = res.Auth.ClientToken
+	c.scheduleRenewal(res.Auth.LeaseDuration, res.Auth.Renewable)
+	return nil
+}
+
+// scheduleRenewal renews the token shortly before it expires. The caller
+// must hold c.mu.
+func (c *Client) scheduleRenewal(leaseDuration int, renewable bool) {
+	if c.renewTimer != nil {
+		c.renewTimer.Stop()
+		c.renewTimer = nil
+	}
+	if !renewable || leaseDuration <= 0 {
+		return
+	}
+
+	ttl := time.Duration(leaseDuration) * time.Second
+	wait := ttl - renewBefore
+	if wait < ttl/2 {
+		wait = ttl / 2
+	}
+	c.renewTimer = time.AfterFunc(wait, func() {
+		err := c.renew(context.Background())
+		if err != nil {
+			debug.Log("renewing vault token failed: %v", err)
+		}
+	})
+}
+
+// renew extends the lifetime of the token. If that fails, the client logs
+// in again.
+func (c *Client) renew(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var res authResponse
+	err := c.do(ctx, http.MethodPost, "auth/token/renew-self", c.token, map[string]string{}, &res)
+	if err != nil {
+		debug.Log("renew-self failed: %v, logging in again", err)
+		return c.login(ctx)
+	}
+	c.scheduleRenewal(res.Auth.LeaseDuration, res.Auth.Renewable)
+	return nil
+}
+
+// Get returns the value of the referenced field.
+func (c *Client) Get(ctx context.Context, ref Ref) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	secret, ok := c.cache[ref.Path]
+	if !ok || (!secret.expires.IsZero() && time.Now().After(secret.expires)) {
+		token, err := c.authToken(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		var res secretResponse
+		err = c.do(ctx, http.MethodGet, ref.Path, token, nil, &res)
+		if err != nil {
+			return "", err
+		}
+
+		secret = cachedSecret{data: res.Data}
+		// the KV secrets engine version 2 nests the secret in data.data
+		if nested, ok := res.Data["data"].(map[string]interface{}); ok && res.Data["metadata"] != nil {
+			secret.data = nested
+		}
+		if res.LeaseDuration > 0 {
+			secret.expires = time.Now().Add(time.Duration(res.LeaseDuration) * time.Second)
+		}
+		c.cache[ref.Path] = secret
+	}
+
+	value, ok := secret.data[ref.Field]
+	if !ok {
+		return "", errors.Errorf("vault secret %v has no field %q", ref.Path, ref.Field)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Sprint(value), nil
+	}
+	return s, nil
+}
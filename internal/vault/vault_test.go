@@ -0,0 +1,115 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseRef(t *testing.T) {
+	ref, err := ParseRef("/secret/data/restic#password")
+	rtest.OK(t, err)
+	rtest.Equals(t, Ref{Path: "secret/data/restic", Field: "password"}, ref)
+
+	for _, s := range []string{"", "secret/data/restic", "#password", "secret#"} {
+		_, err := ParseRef(s)
+		rtest.Assert(t, err != nil, "expected error for %q", s)
+	}
+}
+
+type testServer struct {
+	logins, reads atomic.Int32
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON := func(v interface{}) {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(map[string]interface{}{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		s.logins.Add(1)
+		writeJSON(map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": "token", "lease_duration": 3600, "renewable": true,
+		}})
+	case "/v1/secret/data/restic":
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		s.reads.Add(1)
+		writeJSON(map[string]interface{}{"data": map[string]interface{}{
+			"data":     map[string]interface{}{"password": "geheim", "key_id": "AKIA"},
+			"metadata": map[string]interface{}{"version": 1},
+		}})
+	case "/v1/kv/restic":
+		writeJSON(map[string]interface{}{"lease_duration": 60, "data": map[string]interface{}{"password": "kv1"}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(map[string]interface{}{"errors": []string{}})
+	}
+}
+
+func TestClientAppRole(t *testing.T) {
+	srv := &testServer{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c, err := New(Config{Address: ts.URL, RoleID: "role", SecretID: "secret"})
+	rtest.OK(t, err)
+	defer c.Close()
+
+	for _, test := range []struct {
+		ref, value string
+	}{
+		{"secret/data/restic#password", "geheim"},
+		{"secret/data/restic#key_id", "AKIA"},
+		{"kv/restic#password", "kv1"},
+	} {
+		ref, err := ParseRef(test.ref)
+		rtest.OK(t, err)
+		value, err := c.Get(context.TODO(), ref)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.value, value)
+	}
+
+	// the token and the secret are cached
+	rtest.Equals(t, int32(1), srv.logins.Load())
+	rtest.Equals(t, int32(1), srv.reads.Load())
+
+	_, err = c.Get(context.TODO(), Ref{Path: "secret/data/restic", Field: "missing"})
+	rtest.Assert(t, err != nil, "expected error for missing field")
+	_, err = c.Get(context.TODO(), Ref{Path: "secret/data/other", Field: "password"})
+	rtest.Assert(t, err != nil, "expected error for missing secret")
+}
+
+func TestClientToken(t *testing.T) {
+	srv := &testServer{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c, err := New(Config{Address: ts.URL, Token: "invalid"})
+	rtest.OK(t, err)
+	_, err = c.Get(context.TODO(), Ref{Path: "secret/data/restic", Field: "password"})
+	rtest.Assert(t, err != nil, "expected error for invalid token")
+
+	c, err = New(Config{Address: ts.URL, Token: "token"})
+	rtest.OK(t, err)
+	value, err := c.Get(context.TODO(), Ref{Path: "secret/data/restic", Field: "password"})
+	rtest.OK(t, err)
+	rtest.Equals(t, "geheim", value)
+	rtest.Equals(t, int32(0), srv.logins.Load())
+}
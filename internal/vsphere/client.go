@@ -0,0 +1,302 @@
+// Package vsphere backs up the disks of VMware vSphere virtual machines
+// without an agent inside the guest. A snapshot of the virtual machine is
+// created via the vSphere Web Services API, and the disk contents as of the
+// snapshot are read from the datastore over HTTPS. Changed Block Tracking
+// (CBT) is used to only read the areas of a disk which changed since the
+// previous backup.
+package vsphere
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// soapAction selects the API version, it is supported by vSphere 6.7 and
+// later.
+const soapAction = "urn:vim25/6.7"
+
+// ManagedObject is a reference to a server side object, for example a
+// virtual machine.
+type ManagedObject struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (o ManagedObject) String() string {
+	return o.Type + ":" + o.Value
+}
+
+// xml returns the reference as element name.
+func (o ManagedObject) xml(name string) string {
+	return fmt.Sprintf(`<%s type="%s">%s</%s>`, name, escape(o.Type), escape(o.Value), name)
+}
+
+// Client talks to a vCenter server or an ESXi host.
+type Client struct {
+	url     *url.URL
+	http    *http.Client
+	content serviceContent
+}
+
+type serviceContent struct {
+	PropertyCollector ManagedObject `xml:"propertyCollector"`
+	SearchIndex       ManagedObject `xml:"searchIndex"`
+	SessionManager    ManagedObject `xml:"sessionManager"`
+}
+
+// Fault is returned for errors reported by the server.
+type Fault struct {
+	Code    string `xml:"faultcode"`
+	Message string `xml:"faultstring"`
+}
+
+func (f *Fault) Error() string {
+	return "vSphere: " + f.Message
+}
+
+type envelope[T any] struct {
+	Body struct {
+		Fault    *Fault `xml:"Fault"`
+		Response T      `xml:",any"`
+	} `xml:"Body"`
+}
+
+// NewClient returns a client for the server at u, only the scheme and host
+// are used. If insecure is set, the TLS certificate of the server is not
+// verified.
+func NewClient(u *url.URL, insecure bool) (*Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		// #nosec G402 -- requested by the user, e.g. for self-signed certificates
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &Client{
+		url:  &url.URL{Scheme: u.Scheme, Host: u.Host},
+		http: &http.Client{Transport: tr, Jar: jar},
+	}, nil
+}
+
+func escape(s string) string {
+	var buf strings.Builder
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// call runs the method with the given parameters and decodes the response
+// into result, which may be nil.
+func call[T any](ctx context.Context, c *Client, method string, params string, result *T) error {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` +
+		`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		`<soapenv:Body>`)
+	fmt.Fprintf(&body, `<%s xmlns="urn:vim25">%s</%s>`, method, params, method)
+	body.WriteString(`</soapenv:Body></soapenv:Envelope>`)
+
+	u := *c.url
+	u.Path = "/sdk"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", soapAction)
+
+	debug.Log("calling %v", method)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var env envelope[T]
+	err = xml.NewDecoder(resp.Body).Decode(&env)
+	if env.Body.Fault != nil {
+		return env.Body.Fault
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%v failed: %v", method, resp.Status)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: invalid response: %w", method, err)
+	}
+	if result != nil {
+		*result = env.Body.Response
+	}
+	return nil
+}
+
+type returnval[T any] struct {
+	Returnval T `xml:"returnval"`
+}
+
+// Login opens a session on the server.
+func (c *Client) Login(ctx context.Context, user, password string) error {
+	var content returnval[serviceContent]
+	err := call(ctx, c, "RetrieveServiceContent", `<_this type="ServiceInstance">ServiceInstance</_this>`, &content)
+	if err != nil {
+		return err
+	}
+	c.content = content.Returnval
+
+	params := c.content.SessionManager.xml("_this") +
+		"<userName>" + escape(user) + "</userName><password>" + escape(password) + "</password>"
+	return call[struct{}](ctx, c, "Login", params, nil)
+}
+
+// Logout closes the session.
+func (c *Client) Logout(ctx context.Context) error {
+	return call[struct{}](ctx, c, "Logout", c.content.SessionManager.xml("_this"), nil)
+}
+
+// FindVM returns the virtual machine with the inventory path, for example
+// "datacenter/vm/folder/name".
+func (c *Client) FindVM(ctx context.Context, path string) (ManagedObject, error) {
+	var resp returnval[ManagedObject]
+	params := c.content.SearchIndex.xml("_this") + "<inventoryPath>" + escape(path) + "</inventoryPath>"
+	if err := call(ctx, c, "FindByInventoryPath", params, &resp); err != nil {
+		return ManagedObject{}, err
+	}
+	if resp.Returnval.Value == "" || resp.Returnval.Type != "VirtualMachine" {
+		return ManagedObject{}, errors.Errorf("virtual machine %q not found", path)
+	}
+	return resp.Returnval, nil
+}
+
+type propertyResponse[T any] struct {
+	Val T `xml:"returnval>objects>propSet>val"`
+}
+
+// property retrieves a single property of obj. Properties which are not set
+// are returned as zero value.
+func property[T any](ctx context.Context, c *Client, obj ManagedObject, path string) (T, error) {
+	params := c.content.PropertyCollector.xml("_this") +
+		"<specSet><propSet><type>" + escape(obj.Type) + "</type><pathSet>" + escape(path) + "</pathSet></propSet>" +
+		"<objectSet>" + obj.xml("obj") + "</objectSet></specSet><options></options>"
+	var resp propertyResponse[T]
+	err := call(ctx, c, "RetrievePropertiesEx", params, &resp)
+	return resp.Val, err
+}
+
+type taskInfo struct {
+	State  string        `xml:"state"`
+	Result ManagedObject `xml:"result"`
+	Error  *struct {
+		Message string `xml:"localizedMessage"`
+	} `xml:"error"`
+}
+
+// wait waits until the task has finished and returns its result.
+func (c *Client) wait(ctx context.Context, task ManagedObject) (ManagedObject, error) {
+	for {
+		info, err := property[taskInfo](ctx, c, task, "info")
+		if err != nil {
+			return ManagedObject{}, err
+		}
+		switch info.State {
+		case "success":
+			return info.Result, nil
+		case "error":
+			msg := "unknown error"
+			if info.Error != nil {
+				msg = info.Error.Message
+			}
+			return ManagedObject{}, errors.New(msg)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ManagedObject{}, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// runTask starts a task and waits for it to finish.
+func (c *Client) runTask(ctx context.Context, method, params string) (ManagedObject, error) {
+	var resp returnval[ManagedObject]
+	if err := call(ctx, c, method, params, &resp); err != nil {
+		return ManagedObject{}, err
+	}
+	result, err := c.wait(ctx, resp.Returnval)
+	if err != nil {
+		return ManagedObject{}, fmt.Errorf("%v failed: %w", method, err)
+	}
+	return result, nil
+}
+
+// ChangeTrackingEnabled returns whether CBT is enabled for the virtual
+// machine.
+func (c *Client) ChangeTrackingEnabled(ctx context.Context, vm ManagedObject) (bool, error) {
+	return property[bool](ctx, c, vm, "config.changeTrackingEnabled")
+}
+
+// EnableChangeTracking enables CBT for the virtual machine. It only takes
+// effect once the next snapshot is created.
+func (c *Client) EnableChangeTracking(ctx context.Context, vm ManagedObject) error {
+	params := vm.xml("_this") + "<spec><changeTrackingEnabled>true</changeTrackingEnabled></spec>"
+	_, err := c.runTask(ctx, "ReconfigVM_Task", params)
+	return err
+}
+
+// CreateSnapshot creates a snapshot of the disks of the virtual machine. If
+// quiesce is set, VMware Tools are asked to flush the file systems in the
+// guest first.
+func (c *Client) CreateSnapshot(ctx context.Context, vm ManagedObject, name, description string, quiesce bool) (ManagedObject, error) {
+	params := fmt.Sprintf("%s<name>%s</name><description>%s</description><memory>false</memory><quiesce>%t</quiesce>",
+		vm.xml("_this"), escape(name), escape(description), quiesce)
+	return c.runTask(ctx, "CreateSnapshot_Task", params)
+}
+
+// RemoveSnapshot deletes the snapshot and merges its changes into the disks.
+func (c *Client) RemoveSnapshot(ctx context.Context, snapshot ManagedObject) error {
+	params := snapshot.xml("_this") + "<removeChildren>false</removeChildren><consolidate>true</consolidate>"
+	_, err := c.runTask(ctx, "RemoveSnapshot_Task", params)
+	return err
+}
+
+// datastoreURL returns the URL to access the file on the datastore via the
+// HTTP file access interface.
+func (c *Client) datastoreURL(datacenter, datastore, file string) string {
+	u := *c.url
+	u.Path = "/folder/" + file
+	u.RawQuery = url.Values{"dcPath": {datacenter}, "dsName": {datastore}}.Encode()
+	return u.String()
+}
+
+// openRange returns a reader for length bytes of the file on the datastore
+// starting at offset.
+func (c *Client) openRange(ctx context.Context, datacenter, datastore, file string, offset, length int64) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.datastoreURL(datacenter, datastore, file), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		_ = resp.Body.Close()
+		return nil, errors.Errorf("reading [%v] %v failed: %v", datastore, file, resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,251 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Disk is a virtual disk of a virtual machine.
+type Disk struct {
+	// Key identifies the disk within the virtual machine.
+	Key int32
+	// Label is the name of the disk shown in the vSphere client, for example
+	// "Hard disk 1".
+	Label string
+	// Capacity is the size of the disk in bytes.
+	Capacity int64
+	// Datastore and File locate the descriptor of the disk, e.g. "datastore1"
+	// and "vm/vm.vmdk".
+	Datastore, File string
+	// ChangeID identifies the state of the disk for CBT, it is empty if CBT is
+	// not enabled.
+	ChangeID string
+}
+
+// FlatFile returns the name of the file containing the data of the disk, e.g.
+// "vm-flat.vmdk".
+func (d Disk) FlatFile() string {
+	return strings.TrimSuffix(path.Base(d.File), ".vmdk") + "-flat.vmdk"
+}
+
+type virtualDevice struct {
+	Type     string `xml:"type,attr"`
+	Key      int32  `xml:"key"`
+	Label    string `xml:"deviceInfo>label"`
+	Capacity int64  `xml:"capacityInBytes"`
+	Backing  struct {
+		Type     string    `xml:"type,attr"`
+		FileName string    `xml:"fileName"`
+		ChangeID string    `xml:"changeId"`
+		Parent   *struct{} `xml:"parent"`
+	} `xml:"backing"`
+}
+
+type deviceList struct {
+	Devices []virtualDevice `xml:"VirtualDevice"`
+}
+
+// parseDatastorePath splits a path like "[datastore1] vm/vm.vmdk" into the
+// datastore and the file.
+func parseDatastorePath(p string) (datastore, file string, err error) {
+	if !strings.HasPrefix(p, "[") {
+		return "", "", errors.Errorf("invalid datastore path %q", p)
+	}
+	datastore, file, ok := strings.Cut(p[1:], "]")
+	if !ok || datastore == "" {
+		return "", "", errors.Errorf("invalid datastore path %q", p)
+	}
+	return datastore, strings.TrimSpace(file), nil
+}
+
+// disks returns the disks of the device list. Only flat disks without a
+// parent disk are supported, as the data of other disks is not stored in a
+// single file.
+func (l deviceList) disks() ([]Disk, error) {
+	var disks []Disk
+	for _, dev := range l.Devices {
+		if dev.Type != "VirtualDisk" {
+			continue
+		}
+		if dev.Backing.Type != "VirtualDiskFlatVer2BackingInfo" {
+			return nil, errors.Errorf("%v: unsupported disk type %v", dev.Label, dev.Backing.Type)
+		}
+		if dev.Backing.Parent != nil {
+			return nil, errors.Errorf("%v: disks of virtual machines with existing snapshots are not supported", dev.Label)
+		}
+		datastore, file, err := parseDatastorePath(dev.Backing.FileName)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", dev.Label, err)
+		}
+		disks = append(disks, Disk{
+			Key:       dev.Key,
+			Label:     dev.Label,
+			Capacity:  dev.Capacity,
+			Datastore: datastore,
+			File:      file,
+			ChangeID:  dev.Backing.ChangeID,
+		})
+	}
+	return disks, nil
+}
+
+// Disks returns the disks of the virtual machine as of the snapshot.
+func (c *Client) Disks(ctx context.Context, snapshot ManagedObject) ([]Disk, error) {
+	devices, err := property[deviceList](ctx, c, snapshot, "config.hardware.device")
+	if err != nil {
+		return nil, err
+	}
+	return devices.disks()
+}
+
+// Extent is an area of a disk.
+type Extent struct {
+	Start  int64 `xml:"start"`
+	Length int64 `xml:"length"`
+}
+
+// End returns the offset directly after the extent.
+func (e Extent) End() int64 {
+	return e.Start + e.Length
+}
+
+type diskChangeInfo struct {
+	StartOffset int64    `xml:"startOffset"`
+	Length      int64    `xml:"length"`
+	Areas       []Extent `xml:"changedArea"`
+}
+
+// ChangedAreas returns the areas of the disk which changed between the state
+// identified by changeID and the snapshot. With the change ID "*", all
+// allocated areas are returned.
+func (c *Client) ChangedAreas(ctx context.Context, vm, snapshot ManagedObject, disk Disk, changeID string) ([]Extent, error) {
+	var extents []Extent
+	for offset := int64(0); offset < disk.Capacity; {
+		params := fmt.Sprintf("%s%s<deviceKey>%d</deviceKey><startOffset>%d</startOffset><changeId>%s</changeId>",
+			vm.xml("_this"), snapshot.xml("snapshot"), disk.Key, offset, escape(changeID))
+		var resp returnval[diskChangeInfo]
+		if err := call(ctx, c, "QueryChangedDiskAreas", params, &resp); err != nil {
+			return nil, err
+		}
+		info := resp.Returnval
+		extents = append(extents, info.Areas...)
+		if info.Length <= 0 {
+			return nil, errors.Errorf("QueryChangedDiskAreas returned no progress at offset %d", offset)
+		}
+		offset = info.StartOffset + info.Length
+	}
+	return normalizeExtents(extents, disk.Capacity), nil
+}
+
+// normalizeExtents sorts the extents, merges overlapping or adjacent extents
+// and limits them to the size of the disk.
+func normalizeExtents(extents []Extent, size int64) []Extent {
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].Start < extents[j].Start
+	})
+	var result []Extent
+	for _, e := range extents {
+		if e.Start >= size || e.Length <= 0 {
+			continue
+		}
+		if e.End() > size {
+			e.Length = size - e.Start
+		}
+		if n := len(result); n > 0 && e.Start <= result[n-1].End() {
+			if e.End() > result[n-1].End() {
+				result[n-1].Length = e.End() - result[n-1].Start
+			}
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// OpenDisk returns a reader for the complete data of the disk as of the
+// snapshot. The extents are read from the datastore, all other areas of the
+// disk are read from base, which usually holds the data of the previous
+// backup. If base is nil, the other areas are read as zeros.
+func (c *Client) OpenDisk(ctx context.Context, datacenter string, disk Disk, extents []Extent, base io.ReaderAt) io.ReadCloser {
+	file := path.Join(path.Dir(disk.File), disk.FlatFile())
+	return newDiskReader(disk.Capacity, extents, base, func(e Extent) (io.ReadCloser, error) {
+		return c.openRange(ctx, datacenter, disk.Datastore, file, e.Start, e.Length)
+	})
+}
+
+type diskReader struct {
+	size    int64
+	extents []Extent
+	base    io.ReaderAt
+	open    func(Extent) (io.ReadCloser, error)
+
+	pos int64
+	// cur reads the extent extents[0] from pos on, if not nil
+	cur io.ReadCloser
+}
+
+func newDiskReader(size int64, extents []Extent, base io.ReaderAt, open func(Extent) (io.ReadCloser, error)) *diskReader {
+	return &diskReader{size: size, extents: extents, base: base, open: open}
+}
+
+func (r *diskReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	for len(r.extents) > 0 && r.extents[0].End() <= r.pos {
+		r.extents = r.extents[1:]
+	}
+
+	if len(r.extents) > 0 && r.extents[0].Start <= r.pos {
+		e := r.extents[0]
+		if r.cur == nil {
+			rd, err := r.open(Extent{Start: r.pos, Length: e.End() - r.pos})
+			if err != nil {
+				return 0, err
+			}
+			r.cur = rd
+		}
+		n, err := io.ReadFull(r.cur, p[:min(int64(len(p)), e.End()-r.pos)])
+		r.pos += int64(n)
+		if err != nil {
+			return n, fmt.Errorf("reading disk at offset %d: %w", r.pos, err)
+		}
+		if r.pos == e.End() {
+			err = r.cur.Close()
+			r.cur = nil
+		}
+		return n, err
+	}
+
+	end := r.size
+	if len(r.extents) > 0 {
+		end = r.extents[0].Start
+	}
+	buf := p[:min(int64(len(p)), end-r.pos)]
+	if r.base == nil {
+		clear(buf)
+	} else {
+		n, err := r.base.ReadAt(buf, r.pos)
+		if n < len(buf) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, fmt.Errorf("reading previous backup at offset %d: %w", r.pos, err)
+		}
+	}
+	r.pos += int64(len(buf))
+	return len(buf), nil
+}
+
+func (r *diskReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package vsphere
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestNormalizeExtents(t *testing.T) {
+	extents := normalizeExtents([]Extent{
+		{Start: 100, Length: 50},
+		{Start: 0, Length: 10},
+		{Start: 10, Length: 5},
+		{Start: 120, Length: 10},
+		{Start: 190, Length: 20},
+		{Start: 300, Length: 1},
+		{Start: 50, Length: 0},
+	}, 200)
+	rtest.Equals(t, []Extent{{0, 15}, {100, 50}, {190, 10}}, extents)
+}
+
+func TestDiskReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	base := bytes.Repeat([]byte("b"), len(data))
+
+	for _, test := range []struct {
+		base io.ReaderAt
+		want string
+	}{
+		{bytes.NewReader(base), strings.Repeat("b", 5) + string(data[5:20]) + strings.Repeat("b", 70) + string(data[90:])},
+		{nil, strings.Repeat("\x00", 5) + string(data[5:20]) + strings.Repeat("\x00", 70) + string(data[90:])},
+	} {
+		var opened []Extent
+		rd := newDiskReader(int64(len(data)), []Extent{{5, 15}, {90, 10}}, test.base, func(e Extent) (io.ReadCloser, error) {
+			opened = append(opened, e)
+			return io.NopCloser(bytes.NewReader(data[e.Start:e.End()])), nil
+		})
+
+		// read in small pieces to cross the borders of the extents
+		var buf bytes.Buffer
+		_, err := io.CopyBuffer(&buf, struct{ io.Reader }{rd}, make([]byte, 7))
+		rtest.OK(t, err)
+		rtest.OK(t, rd.Close())
+		rtest.Equals(t, test.want, buf.String())
+		rtest.Equals(t, []Extent{{5, 15}, {90, 10}}, opened)
+	}
+}
+
+func TestParseDatastorePath(t *testing.T) {
+	ds, file, err := parseDatastorePath("[datastore 1] vm/vm.vmdk")
+	rtest.OK(t, err)
+	rtest.Equals(t, "datastore 1", ds)
+	rtest.Equals(t, "vm/vm.vmdk", file)
+
+	for _, p := range []string{"vm/vm.vmdk", "[] vm.vmdk", "[ds vm.vmdk"} {
+		_, _, err := parseDatastorePath(p)
+		rtest.Assert(t, err != nil, "expected error for %q", p)
+	}
+}
+
+const devicesResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body>
+<RetrievePropertiesExResponse xmlns="urn:vim25"><returnval><objects><obj type="VirtualMachineSnapshot">snapshot-7</obj>
+<propSet><name>config.hardware.device</name><val xsi:type="ArrayOfVirtualDevice">
+<VirtualDevice xsi:type="VirtualIDEController"><key>200</key><deviceInfo><label>IDE 0</label></deviceInfo></VirtualDevice>
+<VirtualDevice xsi:type="VirtualDisk"><key>2000</key><deviceInfo><label>Hard disk 1</label><summary>16,777,216 KB</summary></deviceInfo>
+<backing xsi:type="VirtualDiskFlatVer2BackingInfo"><fileName>[datastore1] web01/web01.vmdk</fileName><datastore type="Datastore">datastore-11</datastore><diskMode>persistent</diskMode><changeId>52 3c 6b 2e 8f 0e 55 4f-a1 6e 7a 2b 4e 1d 5c 73/12</changeId></backing>
+<capacityInKB>16777216</capacityInKB><capacityInBytes>17179869184</capacityInBytes></VirtualDevice>
+</val></propSet></objects></returnval></RetrievePropertiesExResponse>
+</soapenv:Body></soapenv:Envelope>`
+
+const faultResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body><soapenv:Fault><faultcode>ServerFaultCode</faultcode><faultstring>The session is not authenticated.</faultstring><detail></detail></soapenv:Fault></soapenv:Body></soapenv:Envelope>`
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	rtest.OK(t, err)
+	c, err := NewClient(u, false)
+	rtest.OK(t, err)
+	return c
+}
+
+func TestDisks(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !bytes.Contains(body, []byte(`<obj type="VirtualMachineSnapshot">snapshot-7</obj>`)) {
+			t.Errorf("unexpected request %s", body)
+		}
+		_, _ = w.Write([]byte(devicesResponse))
+	})
+
+	disks, err := c.Disks(context.TODO(), ManagedObject{Type: "VirtualMachineSnapshot", Value: "snapshot-7"})
+	rtest.OK(t, err)
+	rtest.Equals(t, []Disk{{
+		Key:       2000,
+		Label:     "Hard disk 1",
+		Capacity:  17179869184,
+		Datastore: "datastore1",
+		File:      "web01/web01.vmdk",
+		ChangeID:  "52 3c 6b 2e 8f 0e 55 4f-a1 6e 7a 2b 4e 1d 5c 73/12",
+	}}, disks)
+	rtest.Equals(t, "web01-flat.vmdk", disks[0].FlatFile())
+}
+
+func TestFault(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(faultResponse))
+	})
+
+	_, err := c.FindVM(context.TODO(), "dc/vm/web01")
+	rtest.Assert(t, err != nil, "expected error")
+	rtest.Equals(t, "vSphere: The session is not authenticated.", err.Error())
+}
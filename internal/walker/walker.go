@@ -29,6 +29,10 @@ type WalkVisitor struct {
 	ProcessNode WalkFunc
 	// Optional callback
 	LeaveDir func(path string) error
+	// Optional callback, called for each `dir` node before its subtree is
+	// loaded. If it returns true, the subtree is neither loaded nor walked,
+	// ProcessNode is still called for the node itself.
+	SkipTree func(path string, node *restic.Node) bool
 }
 
 // Walk calls walkFn recursively for each node in root. If walkFn returns an
@@ -85,6 +89,14 @@ func walk(ctx context.Context, repo restic.BlobLoader, prefix string, parentTree
 			return errors.Errorf("subtree for node %v in tree %v is nil", node.Name, p)
 		}
 
+		if visitor.SkipTree != nil && visitor.SkipTree(p, node) {
+			err := visitor.ProcessNode(parentTreeID, p, node, nil)
+			if err != nil && err != ErrSkipNode {
+				return err
+			}
+			continue
+		}
+
 		subtree, err := restic.LoadTree(ctx, repo, *node.Subtree)
 		err = visitor.ProcessNode(parentTreeID, p, node, err)
 		if err != nil {
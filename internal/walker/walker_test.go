@@ -451,3 +451,44 @@ func TestWalker(t *testing.T) {
 		})
 	}
 }
+
+func TestWalkerSkipTree(t *testing.T) {
+	repo, root := BuildTreeMap(TestTree{
+		"foo": TestFile{},
+		"skipped": TestTree{
+			"other": TestFile{},
+		},
+		"subdir": TestTree{
+			"file": TestFile{},
+		},
+	})
+
+	// remove the tree of the skipped directory, loading it fails
+	tree, err := restic.LoadTree(context.TODO(), repo, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(repo, *tree.Find("skipped").Subtree)
+
+	var paths []string
+	err = Walk(context.TODO(), repo, root, WalkVisitor{
+		ProcessNode: func(_ restic.ID, path string, _ *restic.Node, err error) error {
+			if err != nil {
+				return err
+			}
+			paths = append(paths, path)
+			return nil
+		},
+		SkipTree: func(path string, _ *restic.Node) bool {
+			return path == "/skipped"
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/", "/foo", "/skipped", "/subdir", "/subdir/file"}
+	if fmt.Sprint(paths) != fmt.Sprint(want) {
+		t.Errorf("wrong paths, want %v, got %v", want, paths)
+	}
+}
@@ -0,0 +1,104 @@
+// Package winhello protects secrets on a Windows workstation using a Windows
+// Hello key credential, which is unlocked for example by fingerprint, face
+// recognition or PIN.
+//
+// The key credential is an RSA key which is stored in the TPM or the Windows
+// Hello container and can only be used after the user was verified. A secret
+// is encrypted using a key derived from the signature of a random challenge,
+// thus it cannot be decrypted without Windows Hello. The result is
+// additionally protected using DPAPI, such that only the same user on the
+// same machine can read it.
+package winhello
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ErrNotSupported is returned on systems other than Windows.
+var ErrNotSupported = errors.New("unlocking using Windows Hello is only supported on Windows")
+
+// ErrNotVerified is returned if the user could not be verified.
+var ErrNotVerified = errors.New("verification using Windows Hello failed")
+
+const (
+	// sealedVersion is the first byte of a sealed secret.
+	sealedVersion = 1
+	challengeSize = 32
+	// keyInfo separates the derived encryption key from other uses of the
+	// signature.
+	keyInfo = "restic windows hello v1"
+)
+
+// newChallenge returns a random challenge which is signed by the key
+// credential to derive the encryption key.
+func newChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	_, err := rand.Read(challenge)
+	return challenge, err
+}
+
+// challengeOf returns the challenge of the sealed secret.
+func challengeOf(sealed []byte) ([]byte, error) {
+	if len(sealed) < 1+challengeSize || sealed[0] != sealedVersion {
+		return nil, errors.New("invalid sealed secret")
+	}
+	return sealed[1 : 1+challengeSize], nil
+}
+
+// newAEAD derives the encryption key from the signature of the challenge.
+// Signatures of the key credential are deterministic (RSA PKCS #1 v1.5), thus
+// signing the same challenge again yields the same key.
+func newAEAD(signature []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, signature)
+	mac.Write([]byte(keyInfo))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts data using the signature of challenge. The result contains
+// the challenge, which is authenticated as additional data.
+func seal(signature, challenge, data []byte) ([]byte, error) {
+	aead, err := newAEAD(signature)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte{sealedVersion}, challenge...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// the output must not overlap the additional data
+	out := make([]byte, 0, len(header)+len(nonce)+len(data)+aead.Overhead())
+	out = append(append(out, header...), nonce...)
+	return aead.Seal(out, nonce, data, header), nil
+}
+
+// unseal decrypts a secret encrypted by seal using the signature of its
+// challenge.
+func unseal(signature, sealed []byte) ([]byte, error) {
+	if _, err := challengeOf(sealed); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(signature)
+	if err != nil {
+		return nil, err
+	}
+	header, rest := sealed[:1+challengeSize], sealed[1+challengeSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("invalid sealed secret")
+	}
+	data, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, errors.New("the sealed secret does not match the Windows Hello credential")
+	}
+	return data, nil
+}
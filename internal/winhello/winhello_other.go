@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package winhello
+
+import "context"
+
+// Seal creates the key credential name and encrypts data using it.
+func Seal(_ context.Context, _ string, _ []byte) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// Open decrypts data encrypted by Seal using the key credential name.
+func Open(_ context.Context, _ string, _ []byte) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// Remove deletes the key credential name.
+func Remove(_ context.Context, _ string) error {
+	return ErrNotSupported
+}
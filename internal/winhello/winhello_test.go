@@ -0,0 +1,36 @@
+package winhello
+
+import (
+	"bytes"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSeal(t *testing.T) {
+	signature := bytes.Repeat([]byte{42}, 256)
+	challenge, err := newChallenge()
+	rtest.OK(t, err)
+
+	sealed, err := seal(signature, challenge, []byte("secret"))
+	rtest.OK(t, err)
+	c, err := challengeOf(sealed)
+	rtest.OK(t, err)
+	rtest.Equals(t, challenge, c)
+
+	data, err := unseal(signature, sealed)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("secret"), data)
+
+	// a different credential yields a different signature
+	_, err = unseal(bytes.Repeat([]byte{23}, 256), sealed)
+	rtest.Assert(t, err != nil, "unseal with wrong signature succeeded")
+
+	// the challenge is authenticated
+	sealed[1] ^= 1
+	_, err = unseal(signature, sealed)
+	rtest.Assert(t, err != nil, "unseal with modified challenge succeeded")
+
+	_, err = challengeOf(sealed[:10])
+	rtest.Assert(t, err != nil, "truncated secret was accepted")
+}
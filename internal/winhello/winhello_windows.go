@@ -0,0 +1,444 @@
+//go:build windows
+// +build windows
+
+package winhello
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	keyCredentialManagerClass = "Windows.Security.Credentials.KeyCredentialManager"
+	cryptographicBufferClass  = "Windows.Security.Cryptography.CryptographicBuffer"
+)
+
+var (
+	iidKeyCredentialManagerStatics = ole.NewGUID("{6AAC468B-0EF1-4CE0-8290-4106DA6A63B5}")
+	iidCryptographicBufferStatics  = ole.NewGUID("{320B7E22-3CB0-4CDF-8663-1D28910065EB}")
+	iidAsyncInfo                   = ole.NewGUID("{00000036-0000-0000-C000-000000000046}")
+)
+
+// keyCredentialManagerStaticsVtbl is the vtable of
+// IKeyCredentialManagerStatics.
+type keyCredentialManagerStaticsVtbl struct {
+	ole.IInspectableVtbl
+	isSupportedAsync      uintptr
+	renewAttestationAsync uintptr
+	requestCreateAsync    uintptr
+	openAsync             uintptr
+	deleteAsync           uintptr
+}
+
+// keyCredentialRetrievalResultVtbl is the vtable of
+// IKeyCredentialRetrievalResult.
+type keyCredentialRetrievalResultVtbl struct {
+	ole.IInspectableVtbl
+	getCredential uintptr
+	getStatus     uintptr
+}
+
+// keyCredentialVtbl is the vtable of IKeyCredential.
+type keyCredentialVtbl struct {
+	ole.IInspectableVtbl
+	getName                              uintptr
+	retrievePublicKeyWithDefaultBlobType uintptr
+	retrievePublicKeyWithBlobType        uintptr
+	requestSignAsync                     uintptr
+	getAttestationAsync                  uintptr
+}
+
+// keyCredentialOperationResultVtbl is the vtable of
+// IKeyCredentialOperationResult.
+type keyCredentialOperationResultVtbl struct {
+	ole.IInspectableVtbl
+	getResult uintptr
+	getStatus uintptr
+}
+
+// cryptographicBufferStaticsVtbl is the vtable of
+// ICryptographicBufferStatics, only the methods used are named.
+type cryptographicBufferStaticsVtbl struct {
+	ole.IInspectableVtbl
+	compare              uintptr
+	generateRandom       uintptr
+	generateRandomNumber uintptr
+	createFromByteArray  uintptr
+	copyToByteArray      uintptr
+}
+
+// asyncOperationVtbl is the vtable of IAsyncOperation<T>.
+type asyncOperationVtbl struct {
+	ole.IInspectableVtbl
+	putCompleted uintptr
+	getCompleted uintptr
+	getResults   uintptr
+}
+
+// asyncInfoVtbl is the vtable of IAsyncInfo.
+type asyncInfoVtbl struct {
+	ole.IInspectableVtbl
+	getID        uintptr
+	getStatus    uintptr
+	getErrorCode uintptr
+	cancel       uintptr
+	close        uintptr
+}
+
+// Values of AsyncStatus.
+const (
+	asyncStarted   = 0
+	asyncCompleted = 1
+	asyncCanceled  = 2
+)
+
+// Values of KeyCredentialCreationOption.
+const keyCredentialReplaceExisting = 0
+
+// statusMessages describes the values of KeyCredentialStatus.
+var statusMessages = map[int32]string{
+	1: "unknown error",
+	2: "no Windows Hello credential was enrolled for the repository, run `restic hello enroll`",
+	3: "canceled by the user",
+	4: "the user prefers to enter the password",
+	5: "the credential already exists",
+	6: "the security device is locked",
+}
+
+func hresultError(call string, hr uintptr) error {
+	if hr == 0 {
+		return nil
+	}
+	return errors.Errorf("%v failed: %v", call, ole.NewError(hr))
+}
+
+func statusError(status int32) error {
+	if status == 0 {
+		return nil
+	}
+	msg, ok := statusMessages[status]
+	if !ok {
+		msg = fmt.Sprintf("status %d", status)
+	}
+	return fmt.Errorf("%w: %v", ErrNotVerified, msg)
+}
+
+// call invokes the method fn of the object this.
+func call(fn uintptr, this *ole.IInspectable, args ...uintptr) uintptr {
+	hr, _, _ := syscall.SyscallN(fn, append([]uintptr{uintptr(unsafe.Pointer(this))}, args...)...)
+	return hr
+}
+
+// wait waits until the asynchronous operation op has completed.
+func wait(ctx context.Context, op *ole.IInspectable) error {
+	var info *ole.IInspectable
+	err := op.PutQueryInterface(iidAsyncInfo, &info)
+	if err != nil {
+		return err
+	}
+	defer info.Release()
+	infoVtbl := (*asyncInfoVtbl)(unsafe.Pointer(info.RawVTable))
+
+	var status int32
+	for {
+		hr := call(infoVtbl.getStatus, info, uintptr(unsafe.Pointer(&status)))
+		if err := hresultError("IAsyncInfo::get_Status", hr); err != nil {
+			return err
+		}
+		if status != asyncStarted {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = call(infoVtbl.cancel, info)
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	switch status {
+	case asyncCompleted:
+		return nil
+	case asyncCanceled:
+		return errors.New("operation canceled")
+	default:
+		var code uintptr
+		_ = call(infoVtbl.getErrorCode, info, uintptr(unsafe.Pointer(&code)))
+		return hresultError("asynchronous operation", code)
+	}
+}
+
+// await waits for the asynchronous operation op, which returns an object, and
+// releases it. The caller must release the result.
+func await(ctx context.Context, op *ole.IInspectable) (*ole.IInspectable, error) {
+	defer op.Release()
+	if err := wait(ctx, op); err != nil {
+		return nil, err
+	}
+
+	var result *ole.IInspectable
+	vtbl := (*asyncOperationVtbl)(unsafe.Pointer(op.RawVTable))
+	hr := call(vtbl.getResults, op, uintptr(unsafe.Pointer(&result)))
+	return result, hresultError("IAsyncOperation::GetResults", hr)
+}
+
+// winrt holds the activation factories used to access the key credentials.
+// Its methods must be called from the thread which created it.
+type winrt struct {
+	manager *ole.IInspectable
+	buffers *ole.IInspectable
+}
+
+// newWinRT locks the goroutine to its thread and initializes the Windows
+// Runtime. The caller must call close.
+func newWinRT() (*winrt, error) {
+	// WinRT objects must not move between threads of different apartments
+	runtime.LockOSThread()
+
+	// returns S_FALSE if already initialized
+	_ = ole.RoInitialize(1) // RO_INIT_MULTITHREADED
+
+	manager, err := ole.RoGetActivationFactory(keyCredentialManagerClass, iidKeyCredentialManagerStatics)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, errors.Errorf("unable to use Windows Hello: %v", err)
+	}
+	buffers, err := ole.RoGetActivationFactory(cryptographicBufferClass, iidCryptographicBufferStatics)
+	if err != nil {
+		manager.Release()
+		runtime.UnlockOSThread()
+		return nil, errors.Errorf("unable to use Windows Hello: %v", err)
+	}
+	return &winrt{manager: manager, buffers: buffers}, nil
+}
+
+func (w *winrt) close() {
+	w.buffers.Release()
+	w.manager.Release()
+	runtime.UnlockOSThread()
+}
+
+// credentialOp starts one of the operations of KeyCredentialManager which
+// return a KeyCredentialRetrievalResult and returns the key credential.
+func (w *winrt) credentialOp(ctx context.Context, method string, fn uintptr, name string, args ...uintptr) (*ole.IInspectable, error) {
+	hname, err := ole.NewHString(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = ole.DeleteHString(hname)
+	}()
+
+	var op *ole.IInspectable
+	args = append(append([]uintptr{uintptr(hname)}, args...), uintptr(unsafe.Pointer(&op)))
+	if err := hresultError(method, call(fn, w.manager, args...)); err != nil {
+		return nil, err
+	}
+	result, err := await(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Release()
+	vtbl := (*keyCredentialRetrievalResultVtbl)(unsafe.Pointer(result.RawVTable))
+
+	var status int32
+	if err := hresultError("get_Status", call(vtbl.getStatus, result, uintptr(unsafe.Pointer(&status)))); err != nil {
+		return nil, err
+	}
+	if err := statusError(status); err != nil {
+		return nil, err
+	}
+	var credential *ole.IInspectable
+	err = hresultError("get_Credential", call(vtbl.getCredential, result, uintptr(unsafe.Pointer(&credential))))
+	return credential, err
+}
+
+// newBuffer returns an IBuffer containing data.
+func (w *winrt) newBuffer(data []byte) (*ole.IInspectable, error) {
+	vtbl := (*cryptographicBufferStaticsVtbl)(unsafe.Pointer(w.buffers.RawVTable))
+	var buf *ole.IInspectable
+	hr := call(vtbl.createFromByteArray, w.buffers, uintptr(len(data)), uintptr(unsafe.Pointer(&data[0])), uintptr(unsafe.Pointer(&buf)))
+	return buf, hresultError("CreateFromByteArray", hr)
+}
+
+// bytes returns the content of an IBuffer.
+func (w *winrt) bytes(buf *ole.IInspectable) ([]byte, error) {
+	vtbl := (*cryptographicBufferStaticsVtbl)(unsafe.Pointer(w.buffers.RawVTable))
+	var length uint32
+	var data *byte
+	hr := call(vtbl.copyToByteArray, w.buffers, uintptr(unsafe.Pointer(buf)), uintptr(unsafe.Pointer(&length)), uintptr(unsafe.Pointer(&data)))
+	if err := hresultError("CopyToByteArray", hr); err != nil {
+		return nil, err
+	}
+	defer ole.CoTaskMemFree(uintptr(unsafe.Pointer(data)))
+	return append([]byte(nil), unsafe.Slice(data, length)...), nil
+}
+
+// sign signs data using the key credential, which asks the user for Windows
+// Hello.
+func (w *winrt) sign(ctx context.Context, credential *ole.IInspectable, data []byte) ([]byte, error) {
+	buf, err := w.newBuffer(data)
+	if err != nil {
+		return nil, err
+	}
+	defer buf.Release()
+
+	vtbl := (*keyCredentialVtbl)(unsafe.Pointer(credential.RawVTable))
+	var op *ole.IInspectable
+	if err := hresultError("RequestSignAsync", call(vtbl.requestSignAsync, credential, uintptr(unsafe.Pointer(buf)), uintptr(unsafe.Pointer(&op)))); err != nil {
+		return nil, err
+	}
+	result, err := await(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Release()
+	resultVtbl := (*keyCredentialOperationResultVtbl)(unsafe.Pointer(result.RawVTable))
+
+	var status int32
+	if err := hresultError("get_Status", call(resultVtbl.getStatus, result, uintptr(unsafe.Pointer(&status)))); err != nil {
+		return nil, err
+	}
+	if err := statusError(status); err != nil {
+		return nil, err
+	}
+	var signature *ole.IInspectable
+	if err := hresultError("get_Result", call(resultVtbl.getResult, result, uintptr(unsafe.Pointer(&signature)))); err != nil {
+		return nil, err
+	}
+	defer signature.Release()
+	return w.bytes(signature)
+}
+
+// Seal creates the key credential name, replacing an existing one, and
+// encrypts data using it. The user is asked for Windows Hello.
+func Seal(ctx context.Context, name string, data []byte) ([]byte, error) {
+	w, err := newWinRT()
+	if err != nil {
+		return nil, err
+	}
+	defer w.close()
+
+	vtbl := (*keyCredentialManagerStaticsVtbl)(unsafe.Pointer(w.manager.RawVTable))
+	credential, err := w.credentialOp(ctx, "RequestCreateAsync", vtbl.requestCreateAsync, name, keyCredentialReplaceExisting)
+	if err != nil {
+		return nil, err
+	}
+	defer credential.Release()
+
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := w.sign(ctx, credential, challenge)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(signature, challenge, data)
+	if err != nil {
+		return nil, err
+	}
+	return protect(sealed)
+}
+
+// Open decrypts data encrypted by Seal using the key credential name. The
+// user is asked for Windows Hello.
+func Open(ctx context.Context, name string, data []byte) ([]byte, error) {
+	sealed, err := unprotect(data)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := challengeOf(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := newWinRT()
+	if err != nil {
+		return nil, err
+	}
+	defer w.close()
+
+	vtbl := (*keyCredentialManagerStaticsVtbl)(unsafe.Pointer(w.manager.RawVTable))
+	credential, err := w.credentialOp(ctx, "OpenAsync", vtbl.openAsync, name)
+	if err != nil {
+		return nil, err
+	}
+	defer credential.Release()
+
+	signature, err := w.sign(ctx, credential, challenge)
+	if err != nil {
+		return nil, err
+	}
+	return unseal(signature, sealed)
+}
+
+// Remove deletes the key credential name.
+func Remove(ctx context.Context, name string) error {
+	w, err := newWinRT()
+	if err != nil {
+		return err
+	}
+	defer w.close()
+
+	hname, err := ole.NewHString(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = ole.DeleteHString(hname)
+	}()
+
+	vtbl := (*keyCredentialManagerStaticsVtbl)(unsafe.Pointer(w.manager.RawVTable))
+	var op *ole.IInspectable
+	if err := hresultError("DeleteAsync", call(vtbl.deleteAsync, w.manager, uintptr(hname), uintptr(unsafe.Pointer(&op)))); err != nil {
+		return err
+	}
+	defer op.Release()
+	return wait(ctx, op)
+}
+
+func newBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+}
+
+// takeBlob copies the data of a blob allocated by DPAPI and frees it.
+func takeBlob(blob windows.DataBlob) []byte {
+	defer func() {
+		_, _ = windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+	}()
+	return append([]byte(nil), unsafe.Slice(blob.Data, blob.Size)...)
+}
+
+// protect encrypts data using DPAPI such that only the current user on this
+// machine can decrypt it.
+func protect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptProtectData(newBlob(data), windows.StringToUTF16Ptr("restic"), nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, errors.Wrap(err, "CryptProtectData")
+	}
+	return takeBlob(out), nil
+}
+
+// unprotect decrypts data encrypted by protect.
+func unprotect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptUnprotectData(newBlob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, errors.Wrap(err, "CryptUnprotectData")
+	}
+	return takeBlob(out), nil
+}
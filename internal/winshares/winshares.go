@@ -0,0 +1,126 @@
+// Package winshares reads and recreates the SMB share definitions of a
+// Windows file server. The definitions are read from the registry key of the
+// LanmanServer service, where Windows keeps the persistent shares, and are
+// recreated using the NetShareAdd API, so a rebuilt file server gets the
+// same shares with the same share-level permissions.
+package winshares
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Share types, see the documentation of SHARE_INFO_2.
+const (
+	TypeDisk       = 0x00
+	TypePrintQueue = 0x01
+	TypeDevice     = 0x02
+	TypeIPC        = 0x03
+	TypeSpecial    = 0x80000000
+	TypeTemporary  = 0x40000000
+)
+
+// UnlimitedUses is the value of MaxUses for shares without a user limit.
+const UnlimitedUses = 0xFFFFFFFF
+
+// Share is the definition of a share.
+type Share struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Remark      string `json:"remark,omitempty"`
+	Type        uint32 `json:"type"`
+	MaxUses     uint32 `json:"max_uses"`
+	Permissions uint32 `json:"permissions,omitempty"`
+	// CSCFlags contains the offline caching settings of the share.
+	CSCFlags uint32 `json:"csc_flags,omitempty"`
+	// Security is the share-level security descriptor in SDDL form. It is
+	// empty for shares which use the default permissions.
+	Security string `json:"security,omitempty"`
+	// PathSecurity is the NTFS security descriptor of Path in SDDL form. It
+	// is only recorded for reference, the NTFS permissions are restored with
+	// the files.
+	PathSecurity string `json:"path_security,omitempty"`
+}
+
+// Definitions is the content of the file stored in the snapshot.
+type Definitions struct {
+	Hostname string  `json:"hostname"`
+	Shares   []Share `json:"shares"`
+}
+
+// Marshal returns the JSON representation of the definitions with the shares
+// sorted by name.
+func (d Definitions) Marshal() ([]byte, error) {
+	sort.Slice(d.Shares, func(i, j int) bool {
+		return strings.ToLower(d.Shares[i].Name) < strings.ToLower(d.Shares[j].Name)
+	})
+	buf, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, '\n'), nil
+}
+
+// Unmarshal parses the definitions written by Marshal.
+func Unmarshal(buf []byte) (Definitions, error) {
+	var d Definitions
+	if err := json.Unmarshal(buf, &d); err != nil {
+		return Definitions{}, fmt.Errorf("invalid share definitions: %w", err)
+	}
+	for _, s := range d.Shares {
+		if s.Name == "" || s.Path == "" {
+			return Definitions{}, errors.Errorf("invalid share definitions: share %q without name or path", s.Name)
+		}
+	}
+	return d, nil
+}
+
+// ParseRegistryValue parses the value stored for a share in the Shares key of
+// the LanmanServer service. It is a REG_MULTI_SZ with one "Key=Value" entry
+// per property, name is the name of the value. Unknown entries are ignored.
+func ParseRegistryValue(name string, entries []string) (Share, error) {
+	s := Share{Name: name, MaxUses: UnlimitedUses}
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		var err error
+		switch key {
+		case "ShareName":
+			s.Name = value
+		case "Path":
+			s.Path = value
+		case "Remark":
+			s.Remark = value
+		case "Type":
+			s.Type, err = parseUint32(value)
+		case "MaxUses":
+			s.MaxUses, err = parseUint32(value)
+		case "Permissions":
+			s.Permissions, err = parseUint32(value)
+		case "CSCFlags":
+			s.CSCFlags, err = parseUint32(value)
+		}
+		if err != nil {
+			return Share{}, fmt.Errorf("share %q: invalid value for %v: %w", name, key, err)
+		}
+	}
+	if s.Path == "" {
+		return Share{}, errors.Errorf("share %q has no path", name)
+	}
+	return s, nil
+}
+
+func parseUint32(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	return uint32(v), err
+}
+
+// ErrShareExists is returned by Create if a share with the same name exists.
+var ErrShareExists = errors.New("share already exists")
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package winshares
+
+import "github.com/restic/restic/internal/errors"
+
+var errNotSupported = errors.New("share definitions are only supported on Windows")
+
+// Read returns the shares defined on the local host.
+func Read() ([]Share, error) {
+	return nil, errNotSupported
+}
+
+// Create creates the share on the local host.
+func Create(_ Share) error {
+	return errNotSupported
+}
+
+// Delete removes the share with the given name from the local host.
+func Delete(_ string) error {
+	return errNotSupported
+}
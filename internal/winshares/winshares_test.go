@@ -0,0 +1,67 @@
+package winshares
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseRegistryValue(t *testing.T) {
+	share, err := ParseRegistryValue("Data", []string{
+		"CATimeout=0",
+		"CSCFlags=16",
+		"MaxUses=4294967295",
+		"Path=D:\\Shares\\Data",
+		"Permissions=0",
+		"Remark=Department data",
+		"ShareName=Data",
+		"Type=0",
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, Share{
+		Name:     "Data",
+		Path:     `D:\Shares\Data`,
+		Remark:   "Department data",
+		Type:     TypeDisk,
+		MaxUses:  UnlimitedUses,
+		CSCFlags: 16,
+	}, share)
+
+	// the remark may contain '='
+	share, err = ParseRegistryValue("x", []string{"Path=C:\\x", "Remark=a=b", "MaxUses=10"})
+	rtest.OK(t, err)
+	rtest.Equals(t, "a=b", share.Remark)
+	rtest.Equals(t, uint32(10), share.MaxUses)
+
+	for _, entries := range [][]string{
+		{"Remark=no path"},
+		{"Path=C:\\x", "Type=printer"},
+		{"Path=C:\\x", "MaxUses=-1"},
+	} {
+		_, err := ParseRegistryValue("x", entries)
+		rtest.Assert(t, err != nil, "missing error for %v", entries)
+	}
+}
+
+func TestDefinitionsRoundtrip(t *testing.T) {
+	defs := Definitions{
+		Hostname: "fileserver",
+		Shares: []Share{
+			{Name: "users", Path: `D:\Users`, MaxUses: UnlimitedUses},
+			{Name: "Data", Path: `D:\Data`, MaxUses: 20, Security: "O:BAG:SYD:(A;;FA;;;WD)"},
+		},
+	}
+	buf, err := defs.Marshal()
+	rtest.OK(t, err)
+
+	loaded, err := Unmarshal(buf)
+	rtest.OK(t, err)
+	rtest.Equals(t, "fileserver", loaded.Hostname)
+	rtest.Equals(t, 2, len(loaded.Shares))
+	rtest.Equals(t, "Data", loaded.Shares[0].Name)
+	rtest.Equals(t, "O:BAG:SYD:(A;;FA;;;WD)", loaded.Shares[0].Security)
+	rtest.Equals(t, "users", loaded.Shares[1].Name)
+
+	_, err = Unmarshal([]byte(`{"shares": [{"name": "x"}]}`))
+	rtest.Assert(t, err != nil, "missing error for share without path")
+}
@@ -0,0 +1,185 @@
+//go:build windows
+// +build windows
+
+package winshares
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/restic/restic/internal/debug"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	sharesKey   = `SYSTEM\CurrentControlSet\Services\LanmanServer\Shares`
+	securityKey = sharesKey + `\Security`
+
+	nerrDuplicateShare = 2118
+)
+
+var (
+	modnetapi32         = windows.NewLazySystemDLL("netapi32.dll")
+	procNetShareAdd     = modnetapi32.NewProc("NetShareAdd")
+	procNetShareDel     = modnetapi32.NewProc("NetShareDel")
+	procNetShareSetInfo = modnetapi32.NewProc("NetShareSetInfo")
+)
+
+// shareInfo502 is SHARE_INFO_502.
+type shareInfo502 struct {
+	netname            *uint16
+	typ                uint32
+	remark             *uint16
+	permissions        uint32
+	maxUses            uint32
+	currentUses        uint32
+	path               *uint16
+	passwd             *uint16
+	reserved           uint32
+	securityDescriptor *windows.SECURITY_DESCRIPTOR
+}
+
+// shareInfo1005 is SHARE_INFO_1005.
+type shareInfo1005 struct {
+	flags uint32
+}
+
+// Read returns the shares defined on the local host.
+func Read() ([]Share, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, sharesKey, registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the share definitions: %w", err)
+	}
+	defer func() { _ = key.Close() }()
+
+	names, err := key.ReadValueNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the share definitions: %w", err)
+	}
+
+	secKey, err := registry.OpenKey(registry.LOCAL_MACHINE, securityKey, registry.QUERY_VALUE)
+	if err != nil {
+		debug.Log("unable to open the share permissions: %v", err)
+		secKey = 0
+	} else {
+		defer func() { _ = secKey.Close() }()
+	}
+
+	shares := make([]Share, 0, len(names))
+	for _, name := range names {
+		entries, _, err := key.GetStringsValue(name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read share %q: %w", name, err)
+		}
+		share, err := ParseRegistryValue(name, entries)
+		if err != nil {
+			return nil, err
+		}
+
+		if secKey != 0 {
+			sd, _, err := secKey.GetBinaryValue(name)
+			if err != nil && err != registry.ErrNotExist {
+				return nil, fmt.Errorf("unable to read the permissions of share %q: %w", name, err)
+			}
+			if len(sd) > 0 {
+				share.Security, err = sddl(sd)
+				if err != nil {
+					return nil, fmt.Errorf("invalid permissions of share %q: %w", name, err)
+				}
+			}
+		}
+
+		sd, err := windows.GetNamedSecurityInfo(share.Path, windows.SE_FILE_OBJECT,
+			windows.OWNER_SECURITY_INFORMATION|windows.GROUP_SECURITY_INFORMATION|windows.DACL_SECURITY_INFORMATION)
+		if err != nil {
+			debug.Log("unable to read the NTFS permissions of %v: %v", share.Path, err)
+		} else {
+			share.PathSecurity = sd.String()
+		}
+
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// sddl converts a self-relative security descriptor to SDDL.
+func sddl(buf []byte) (string, error) {
+	// copy the data to ensure the alignment expected by the API
+	sd := make([]uint64, (len(buf)+7)/8)
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&sd[0])), len(buf)), buf)
+	desc := (*windows.SECURITY_DESCRIPTOR)(unsafe.Pointer(&sd[0]))
+	if !desc.IsValid() || int(desc.Length()) > len(buf) {
+		return "", fmt.Errorf("invalid security descriptor")
+	}
+	return desc.String(), nil
+}
+
+func netError(ret uintptr) error {
+	if ret == nerrDuplicateShare {
+		return ErrShareExists
+	}
+	return syscall.Errno(ret)
+}
+
+// Create creates the share on the local host. It returns ErrShareExists if
+// a share with the same name exists.
+func Create(share Share) error {
+	info := shareInfo502{
+		typ:         share.Type,
+		permissions: share.Permissions,
+		maxUses:     share.MaxUses,
+	}
+	var err error
+	if info.netname, err = windows.UTF16PtrFromString(share.Name); err != nil {
+		return err
+	}
+	if info.remark, err = windows.UTF16PtrFromString(share.Remark); err != nil {
+		return err
+	}
+	if info.path, err = windows.UTF16PtrFromString(share.Path); err != nil {
+		return err
+	}
+	if share.Security != "" {
+		info.securityDescriptor, err = windows.SecurityDescriptorFromString(share.Security)
+		if err != nil {
+			return fmt.Errorf("invalid permissions of share %q: %w", share.Name, err)
+		}
+	}
+
+	var parmErr uint32
+	ret, _, _ := procNetShareAdd.Call(0, 502, uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&parmErr)))
+	if ret != 0 {
+		err := netError(ret)
+		if err == ErrShareExists {
+			return err
+		}
+		return fmt.Errorf("unable to create share %q: %w (parameter %d)", share.Name, err, parmErr)
+	}
+
+	if share.CSCFlags != 0 {
+		flags := shareInfo1005{flags: share.CSCFlags}
+		ret, _, _ := procNetShareSetInfo.Call(0, uintptr(unsafe.Pointer(info.netname)), 1005, uintptr(unsafe.Pointer(&flags)), 0)
+		if ret != 0 {
+			return fmt.Errorf("unable to set the caching mode of share %q: %w", share.Name, netError(ret))
+		}
+	}
+	return nil
+}
+
+// Delete removes the share with the given name from the local host.
+func Delete(name string) error {
+	netname, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	ret, _, _ := procNetShareDel.Call(0, uintptr(unsafe.Pointer(netname)), 0)
+	if ret != 0 {
+		return fmt.Errorf("unable to delete share %q: %w", name, netError(ret))
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package restic
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/events"
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ErrIncomplete is returned if some files could not be backed up or restored
+// and the error callback did not abort the operation.
+var ErrIncomplete = errors.New("operation completed with errors for some files")
+
+// BackupOptions configures a backup.
+type BackupOptions struct {
+	// Hostname is stored in the snapshot. Defaults to the name of the host.
+	Hostname string
+	// Tags are added to the snapshot.
+	Tags []string
+	// Excludes are patterns of files to exclude, as for the --exclude option.
+	Excludes []string
+	// Time of the snapshot. Defaults to the current time.
+	Time time.Time
+	// ProgramVersion is stored in the snapshot, for example "myapp 1.2.3".
+	ProgramVersion string
+
+	// Progress is called whenever a file or directory was completed. Calls
+	// are never run concurrently. It may be nil.
+	Progress func(BackupProgress)
+	// Error is called for files which could not be read. Returning an error
+	// aborts the backup. If Error is nil, the backup continues and returns
+	// ErrIncomplete at the end.
+	Error func(item string, err error) error
+	// Events receives the events of the backup, in addition to Progress and
+	// Error. It may be nil.
+	Events EventSink
+}
+
+// BackupProgress reports the progress of a running backup.
+type BackupProgress struct {
+	Files          uint64
+	Dirs           uint64
+	BytesProcessed uint64
+	Errors         uint64
+}
+
+// BackupSummary describes a finished backup.
+type BackupSummary struct {
+	// Snapshot is the snapshot which was created.
+	Snapshot        Snapshot
+	FilesNew        uint
+	FilesChanged    uint
+	FilesUnmodified uint
+	DirsNew         uint
+	DirsChanged     uint
+	DirsUnmodified  uint
+	// DataAdded is the number of bytes added to the repository, before
+	// compression.
+	DataAdded uint64
+	// BytesProcessed is the total size of all files in the snapshot.
+	BytesProcessed uint64
+}
+
+type backupProgress struct {
+	m     sync.Mutex
+	state BackupProgress
+	fn    func(BackupProgress)
+}
+
+func (p *backupProgress) update(fn func(s *BackupProgress)) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	fn(&p.state)
+	if p.fn != nil {
+		p.fn(p.state)
+	}
+}
+
+// backupSink updates the backup progress and forwards the events to the
+// sink passed by the caller.
+type backupSink struct {
+	progress *backupProgress
+	events   EventSink
+	err      func(item string, err error) error
+}
+
+func (s *backupSink) FileStarted(path string) {
+	if s.events != nil {
+		s.events.FileStarted(path)
+	}
+}
+
+func (s *backupSink) FileFinished(item events.Item) {
+	s.progress.update(func(p *BackupProgress) {
+		if item.Type == events.TypeDir {
+			p.Dirs++
+		} else {
+			p.Files++
+		}
+	})
+	if s.events != nil {
+		s.events.FileFinished(newItem(item))
+	}
+}
+
+func (s *backupSink) BlobUploaded(size uint64) {
+	s.progress.update(func(p *BackupProgress) {
+		p.BytesProcessed += size
+	})
+	if s.events != nil {
+		s.events.BlobUploaded(size)
+	}
+}
+
+func (s *backupSink) Error(path string, err error) error {
+	if s.events != nil {
+		if serr := s.events.Error(path, err); serr != nil {
+			return serr
+		}
+	}
+	return s.err(path, err)
+}
+
+func (s *backupSink) Summary(summary events.Summary) {
+	if s.events != nil {
+		s.events.Summary(newSummary(summary))
+	}
+}
+
+// Backup saves the given paths to the repository and creates a new snapshot.
+// The latest snapshot of the same host and paths is used as parent, such that
+// unchanged files are not read again.
+func (r *Repository) Backup(ctx context.Context, paths []string, opts BackupOptions) (*BackupSummary, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no paths to back up")
+	}
+	if err := filter.ValidatePatterns(opts.Excludes); err != nil {
+		return nil, errors.Wrap(err, "invalid exclude pattern")
+	}
+	excludes := filter.ParsePatterns(opts.Excludes)
+
+	if opts.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		opts.Hostname = hostname
+	}
+	backupStart := time.Now()
+	if opts.Time.IsZero() {
+		opts.Time = backupStart
+	}
+
+	ctx, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	parent, _, err := (&restic.SnapshotFilter{
+		Hosts:          []string{opts.Hostname},
+		Paths:          paths,
+		TimestampLimit: opts.Time,
+	}).FindLatest(ctx, r.repo, r.repo, "latest")
+	if err != nil && !errors.Is(err, restic.ErrNoSnapshotFound) {
+		return nil, err
+	}
+
+	if err := r.repo.LoadIndex(ctx, nil); err != nil {
+		return nil, err
+	}
+
+	progress := &backupProgress{fn: opts.Progress}
+	failed := false
+
+	arch := archiver.New(r.repo, fs.Local{}, archiver.Options{})
+	arch.SelectByName = func(item string) bool {
+		matched, err := filter.List(excludes, item)
+		if err != nil {
+			r.warnf("error for exclude pattern: %v\n", err)
+		}
+		return !matched
+	}
+	arch.SetEventSink(&backupSink{
+		progress: progress,
+		events:   opts.Events,
+		err: func(item string, err error) error {
+			progress.update(func(s *BackupProgress) {
+				s.Errors++
+				failed = true
+			})
+			if opts.Error != nil {
+				return opts.Error(item, err)
+			}
+			return nil
+		},
+	})
+
+	sn, id, summary, err := arch.Snapshot(ctx, paths, archiver.SnapshotOptions{
+		Tags:           opts.Tags,
+		Hostname:       opts.Hostname,
+		Excludes:       opts.Excludes,
+		BackupStart:    backupStart,
+		Time:           opts.Time,
+		ParentSnapshot: parent,
+		ProgramVersion: opts.ProgramVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BackupSummary{
+		Snapshot:        newSnapshot(id, sn),
+		FilesNew:        summary.Files.New,
+		FilesChanged:    summary.Files.Changed,
+		FilesUnmodified: summary.Files.Unchanged,
+		DirsNew:         summary.Dirs.New,
+		DirsChanged:     summary.Dirs.Changed,
+		DirsUnmodified:  summary.Dirs.Unchanged,
+		DataAdded:       summary.ItemStats.DataSize + summary.ItemStats.TreeSize,
+		BytesProcessed:  summary.ProcessedBytes,
+	}
+	if failed {
+		return result, ErrIncomplete
+	}
+	return result, nil
+}
@@ -0,0 +1,13 @@
+// Package restic provides a stable API to embed restic in other Go programs.
+//
+// The package allows opening or initializing a repository, creating backups,
+// listing snapshots and restoring them. All long-running operations accept a
+// context and stop as soon as it is cancelled, progress is reported via
+// optional callbacks.
+//
+// Unlike the packages below internal/, which change whenever needed, this
+// package follows semantic versioning: exported identifiers are only removed
+// or changed in incompatible ways in a new major version. New fields and
+// functions may be added in minor versions, so struct types should always be
+// initialized using field names.
+package restic
@@ -0,0 +1,169 @@
+package restic
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/events"
+)
+
+// EventSink receives the events of a running backup or restore. The methods
+// may be called concurrently from several goroutines. Embed NopSink to only
+// handle some of the events.
+type EventSink interface {
+	// FileStarted is called when reading a file starts.
+	FileStarted(path string)
+	// FileFinished is called once an item has been processed completely.
+	FileFinished(item Item)
+	// BlobUploaded is called for each blob of file data which has been saved.
+	BlobUploaded(size uint64)
+	// Error is called for errors which only affect a single item. If it
+	// returns an error, the operation is aborted.
+	Error(path string, err error) error
+	// Summary is called once the operation has completed successfully.
+	Summary(summary Summary)
+}
+
+// NopSink is an EventSink which ignores all events, errors are skipped.
+type NopSink struct{}
+
+var _ EventSink = NopSink{}
+
+// FileStarted implements EventSink.
+func (NopSink) FileStarted(string) {}
+
+// FileFinished implements EventSink.
+func (NopSink) FileFinished(Item) {}
+
+// BlobUploaded implements EventSink.
+func (NopSink) BlobUploaded(uint64) {}
+
+// Error implements EventSink.
+func (NopSink) Error(string, error) error { return nil }
+
+// Summary implements EventSink.
+func (NopSink) Summary(Summary) {}
+
+// ItemType is the type of an Item.
+type ItemType string
+
+// Item types.
+const (
+	TypeFile  ItemType = "file"
+	TypeDir   ItemType = "dir"
+	TypeOther ItemType = "other"
+)
+
+// Action describes what happened to an Item.
+type Action string
+
+// Actions reported for items. New, Modified and Unchanged are used by the
+// backup, the others by the restore.
+const (
+	ActionNew       Action = "new"
+	ActionModified  Action = "modified"
+	ActionUnchanged Action = "unchanged"
+	ActionRestored  Action = "restored"
+	ActionUpdated   Action = "updated"
+	ActionDeleted   Action = "deleted"
+)
+
+// Item describes a file, directory or other item which has been processed.
+type Item struct {
+	Path     string
+	Type     ItemType
+	Action   Action
+	Duration time.Duration
+
+	// Size is the size of the item. For the backup, it is the amount of
+	// file data which was added to the repository.
+	Size uint64
+	// SizeInRepo is the amount of file data added to the repository after
+	// compression. It is only set by the backup.
+	SizeInRepo uint64
+	// MetadataSize and MetadataSizeInRepo are the size of the directory
+	// metadata added to the repository. They are only set by the backup.
+	MetadataSize       uint64
+	MetadataSizeInRepo uint64
+}
+
+// Summary describes a completed backup or restore.
+type Summary struct {
+	// SnapshotID is the ID of the snapshot created by a backup.
+	SnapshotID string
+
+	// FilesNew, FilesModified, FilesUnchanged and the Dirs counts are set
+	// by the backup.
+	FilesNew, FilesModified, FilesUnchanged uint
+	DirsNew, DirsModified, DirsUnchanged    uint
+
+	// FilesRestored, FilesSkipped and FilesDeleted are set by the restore.
+	// The counts include directories and other items.
+	FilesRestored, FilesSkipped, FilesDeleted uint
+
+	// BytesProcessed is the amount of file data which was read during a
+	// backup or written during a restore.
+	BytesProcessed uint64
+	// BytesAdded is the amount of data added to the repository by a backup.
+	BytesAdded uint64
+
+	Start, End time.Time
+}
+
+func newItem(item events.Item) Item {
+	return Item{
+		Path:               item.Path,
+		Type:               ItemType(item.Type),
+		Action:             Action(item.Action),
+		Duration:           item.Duration,
+		Size:               item.Size,
+		SizeInRepo:         item.SizeInRepo,
+		MetadataSize:       item.MetadataSize,
+		MetadataSizeInRepo: item.MetadataSizeInRepo,
+	}
+}
+
+func newSummary(summary events.Summary) Summary {
+	return Summary{
+		SnapshotID:     summary.SnapshotID,
+		FilesNew:       summary.FilesNew,
+		FilesModified:  summary.FilesModified,
+		FilesUnchanged: summary.FilesUnchanged,
+		DirsNew:        summary.DirsNew,
+		DirsModified:   summary.DirsModified,
+		DirsUnchanged:  summary.DirsUnchanged,
+		FilesRestored:  summary.FilesRestored,
+		FilesSkipped:   summary.FilesSkipped,
+		FilesDeleted:   summary.FilesDeleted,
+		BytesProcessed: summary.BytesProcessed,
+		BytesAdded:     summary.BytesAdded,
+		Start:          summary.Start,
+		End:            summary.End,
+	}
+}
+
+// eventSink forwards the internal events to an EventSink.
+type eventSink struct {
+	sink EventSink
+}
+
+var _ events.Sink = eventSink{}
+
+func (s eventSink) FileStarted(path string) {
+	s.sink.FileStarted(path)
+}
+
+func (s eventSink) FileFinished(item events.Item) {
+	s.sink.FileFinished(newItem(item))
+}
+
+func (s eventSink) BlobUploaded(size uint64) {
+	s.sink.BlobUploaded(size)
+}
+
+func (s eventSink) Error(path string, err error) error {
+	return s.sink.Error(path, err)
+}
+
+func (s eventSink) Summary(summary events.Summary) {
+	s.sink.Summary(newSummary(summary))
+}
@@ -0,0 +1,175 @@
+package restic
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/cache"
+	"github.com/restic/restic/internal/backend/setup"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// maxKeys is the number of keys which are tried to find the one matching the password.
+const maxKeys = 20
+
+// Options configures how a repository is accessed.
+type Options struct {
+	// Repository is the location of the repository in the same format as
+	// used by the --repo option, for example "/srv/restic-repo" or
+	// "s3:s3.amazonaws.com/bucket_name".
+	Repository string
+	// Password is used to decrypt the keys of the repository.
+	Password string
+	// BackendOptions holds backend specific options in the same format as
+	// the -o option, for example "s3.region=eu-west-1".
+	BackendOptions []string
+	// Compression is one of "auto" (default), "off" or "max".
+	Compression string
+	// CacheDir overrides the default cache directory.
+	CacheDir string
+	// NoCache disables the local metadata cache.
+	NoCache bool
+	// MaxConnections enables the adaptive connection limit like the
+	// --max-connections option: the number of concurrent backend requests is
+	// reduced when the backend throttles them.
+	MaxConnections uint
+	// Warnf is called for warnings, for example failed backend requests which
+	// are retried. It may be nil.
+	Warnf func(format string, args ...interface{})
+}
+
+// Repository is an open repository. It can be used concurrently.
+type Repository struct {
+	repo  *repository.Repository
+	warnf func(format string, args ...interface{})
+}
+
+// Init creates a new repository at the location given in opts and returns
+// it opened.
+func Init(ctx context.Context, opts Options) (*Repository, error) {
+	be, err := openBackend(ctx, opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := newRepository(be, opts)
+	if err != nil {
+		return nil, err
+	}
+	version := uint(restic.StableRepoVersion)
+	if fipsMode() && version < restic.CipherVersion {
+		version = restic.CipherVersion
+	}
+	err = repo.Init(ctx, version, opts.Password, nil, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "init")
+	}
+
+	return newRepositoryHandle(repo, opts), nil
+}
+
+// Open opens an existing repository.
+func Open(ctx context.Context, opts Options) (*Repository, error) {
+	be, err := openBackend(ctx, opts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := newRepository(be, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = repo.SearchKey(ctx, opts.Password, maxKeys, "")
+	if err != nil {
+		_ = repo.Close()
+		return nil, err
+	}
+
+	return newRepositoryHandle(repo, opts), nil
+}
+
+func newRepository(be backend.Backend, opts Options) (*repository.Repository, error) {
+	var compression repository.CompressionMode
+	if opts.Compression != "" {
+		if err := compression.Set(opts.Compression); err != nil {
+			return nil, err
+		}
+	}
+
+	repo, err := repository.New(be, repository.Options{Compression: compression, FIPS: fipsMode()})
+	if err != nil {
+		_ = be.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+func newRepositoryHandle(repo *repository.Repository, opts Options) *Repository {
+	r := &Repository{
+		repo:  repo,
+		warnf: opts.Warnf,
+	}
+	if r.warnf == nil {
+		r.warnf = func(string, ...interface{}) {}
+	}
+
+	if !opts.NoCache {
+		c, err := cache.New(repo.Config().ID, opts.CacheDir)
+		if err != nil {
+			r.warnf("unable to open cache: %v\n", err)
+		} else {
+			repo.UseCache(c)
+		}
+	}
+	return r
+}
+
+func openBackend(ctx context.Context, opts Options, create bool) (backend.Backend, error) {
+	beOpts, err := options.Parse(opts.BackendOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup.Open(ctx, opts.Repository, setup.Options{
+		Extended:       beOpts,
+		MaxConnections: opts.MaxConnections,
+		Warnf:          opts.Warnf,
+	}, create)
+}
+
+// fipsMode reports whether the cryptography is restricted to algorithms
+// approved by FIPS 140. Like the command line, this is the case for builds
+// using a FIPS 140 validated module.
+func fipsMode() bool {
+	return crypto.FIPSModule()
+}
+
+// Close closes the repository.
+func (r *Repository) Close() error {
+	return r.repo.Close()
+}
+
+// ID returns the unique ID of the repository.
+func (r *Repository) ID() string {
+	return r.repo.Config().ID
+}
+
+// lock acquires a non-exclusive lock on the repository. The returned context
+// is cancelled if the lock cannot be refreshed.
+func (r *Repository) lock(ctx context.Context) (context.Context, func(), error) {
+	lock, ctx, err := repository.Lock(ctx, r.repo, false, 0, func(msg string) {
+		r.warnf("%s", msg)
+	}, r.warnf)
+	if err != nil {
+		return nil, nil, err
+	}
+	// let the key reject the configs replaced in the meantime
+	if err := r.repo.RecordConfigRevision(ctx); err != nil {
+		r.warnf("unable to record the config revision: %v\n", err)
+	}
+	return ctx, lock.Unlock, nil
+}
@@ -0,0 +1,161 @@
+package restic_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/pkg/restic"
+)
+
+func TestBackupRestore(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	tempdir := t.TempDir()
+	opts := restic.Options{
+		Repository: filepath.Join(tempdir, "repo"),
+		Password:   "secret",
+		NoCache:    true,
+	}
+
+	repo, err := restic.Init(context.TODO(), opts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Close())
+
+	src := filepath.Join(tempdir, "src")
+	rtest.OK(t, os.MkdirAll(filepath.Join(src, "dir"), 0o700))
+	rtest.OK(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("content"), 0o600))
+	rtest.OK(t, os.WriteFile(filepath.Join(src, "excluded"), []byte("excluded"), 0o600))
+
+	_, err = restic.Open(context.TODO(), restic.Options{Repository: opts.Repository, Password: "wrong", NoCache: true})
+	rtest.Assert(t, err != nil, "opening the repository with a wrong password succeeded")
+	repo, err = restic.Open(context.TODO(), opts)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, repo.Close())
+	}()
+
+	var progress restic.BackupProgress
+	summary, err := repo.Backup(context.TODO(), []string{src}, restic.BackupOptions{
+		Hostname: "host",
+		Tags:     []string{"foo"},
+		Excludes: []string{"excluded"},
+		Progress: func(p restic.BackupProgress) {
+			progress = p
+		},
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1), summary.FilesNew)
+	rtest.Equals(t, uint64(len("content")), summary.BytesProcessed)
+	rtest.Equals(t, uint64(1), progress.Files)
+
+	snapshots, err := repo.Snapshots(context.TODO(), restic.SnapshotFilter{Tags: []string{"foo"}})
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(snapshots))
+	rtest.Equals(t, summary.Snapshot.ID, snapshots[0].ID)
+	rtest.Assert(t, summary.Snapshot.Time.Equal(snapshots[0].Time), "snapshot time mismatch")
+	other, err := repo.Snapshots(context.TODO(), restic.SnapshotFilter{Hosts: []string{"other"}})
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(other))
+
+	// the second backup uses the first one as parent
+	summary, err = repo.Backup(context.TODO(), []string{src}, restic.BackupOptions{Hostname: "host"})
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1), summary.FilesUnmodified)
+	rtest.Equals(t, snapshots[0].ID, summary.Snapshot.Parent)
+
+	target := filepath.Join(tempdir, "target")
+	var restoreProgress restic.RestoreProgress
+	rtest.OK(t, repo.Restore(context.TODO(), snapshots[0].ID+":"+filepath.ToSlash(src), restic.RestoreOptions{
+		Target: target,
+		Progress: func(p restic.RestoreProgress) {
+			restoreProgress = p
+		},
+	}))
+	// the directory and the file
+	rtest.Equals(t, uint64(2), restoreProgress.FilesRestored)
+	buf, err := os.ReadFile(filepath.Join(target, "dir", "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content", string(buf))
+	_, err = os.Stat(filepath.Join(target, "excluded"))
+	rtest.Assert(t, os.IsNotExist(err), "excluded file was restored")
+}
+
+func TestBackupCancel(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	tempdir := t.TempDir()
+	repo, err := restic.Init(context.TODO(), restic.Options{
+		Repository: filepath.Join(tempdir, "repo"),
+		Password:   "secret",
+		NoCache:    true,
+	})
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, repo.Close())
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = repo.Backup(ctx, []string{tempdir}, restic.BackupOptions{})
+	rtest.Assert(t, err != nil, "backup with cancelled context succeeded")
+}
+
+type recordingSink struct {
+	restic.NopSink
+
+	m         sync.Mutex
+	items     map[string]restic.Item
+	summaries []restic.Summary
+}
+
+func (s *recordingSink) FileFinished(item restic.Item) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.items[filepath.Base(item.Path)] = item
+}
+
+func (s *recordingSink) Summary(summary restic.Summary) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.summaries = append(s.summaries, summary)
+}
+
+func TestEventSink(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	tempdir := t.TempDir()
+	repo, err := restic.Init(context.TODO(), restic.Options{
+		Repository: filepath.Join(tempdir, "repo"),
+		Password:   "secret",
+		NoCache:    true,
+	})
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, repo.Close())
+	}()
+
+	src := filepath.Join(tempdir, "src")
+	rtest.OK(t, os.MkdirAll(src, 0o700))
+	rtest.OK(t, os.WriteFile(filepath.Join(src, "file"), []byte("content"), 0o600))
+
+	sink := &recordingSink{items: make(map[string]restic.Item)}
+	summary, err := repo.Backup(context.TODO(), []string{src}, restic.BackupOptions{Hostname: "host", Events: sink})
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.TypeFile, sink.items["file"].Type)
+	rtest.Equals(t, restic.ActionNew, sink.items["file"].Action)
+	rtest.Equals(t, uint64(len("content")), sink.items["file"].Size)
+	rtest.Equals(t, 1, len(sink.summaries))
+	rtest.Equals(t, summary.Snapshot.ID, sink.summaries[0].SnapshotID)
+	rtest.Equals(t, uint(1), sink.summaries[0].FilesNew)
+
+	sink = &recordingSink{items: make(map[string]restic.Item)}
+	rtest.OK(t, repo.Restore(context.TODO(), summary.Snapshot.ID+":"+filepath.ToSlash(src), restic.RestoreOptions{
+		Target: filepath.Join(tempdir, "target"),
+		Events: sink,
+	}))
+	rtest.Equals(t, restic.ActionRestored, sink.items["file"].Action)
+	rtest.Equals(t, 1, len(sink.summaries))
+	rtest.Equals(t, uint64(len("content")), sink.summaries[0].BytesProcessed)
+}
@@ -0,0 +1,152 @@
+package restic
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/restorer"
+	restoreui "github.com/restic/restic/internal/ui/restore"
+)
+
+// RestoreOptions configures a restore.
+type RestoreOptions struct {
+	// Target is the directory the snapshot is restored to.
+	Target string
+	// Overwrite selects whether existing files are overwritten. Defaults to
+	// always overwriting files.
+	Overwrite OverwriteBehavior
+
+	// Progress is called regularly while the restore is running and once at
+	// the end. Calls are never run concurrently. It may be nil.
+	Progress func(RestoreProgress)
+	// Error is called for files which could not be restored. Returning an
+	// error aborts the restore. If Error is nil, the restore continues and
+	// returns ErrIncomplete at the end.
+	Error func(item string, err error) error
+	// Events receives the events of the restore, in addition to Progress and
+	// Error. It may be nil.
+	Events EventSink
+}
+
+// OverwriteBehavior selects how existing files are handled during a restore.
+type OverwriteBehavior int
+
+// Overwrite behaviors, see the --overwrite option of the restore command.
+const (
+	OverwriteAlways OverwriteBehavior = iota
+	OverwriteIfChanged
+	OverwriteIfNewer
+	OverwriteNever
+)
+
+// RestoreProgress reports the progress of a running restore. The file
+// counts include directories and other non-regular files.
+type RestoreProgress struct {
+	FilesRestored uint64
+	FilesTotal    uint64
+	FilesSkipped  uint64
+	BytesRestored uint64
+	BytesTotal    uint64
+	BytesSkipped  uint64
+}
+
+// restoreProgressInterval is the interval at which RestoreOptions.Progress is called.
+const restoreProgressInterval = time.Second
+
+type restoreProgressPrinter struct {
+	m  sync.Mutex
+	fn func(RestoreProgress)
+}
+
+func (p *restoreProgressPrinter) report(s restoreui.State) {
+	if p.fn == nil {
+		return
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.fn(RestoreProgress{
+		FilesRestored: s.FilesFinished,
+		FilesTotal:    s.FilesTotal,
+		FilesSkipped:  s.FilesSkipped,
+		BytesRestored: s.AllBytesWritten,
+		BytesTotal:    s.AllBytesTotal,
+		BytesSkipped:  s.AllBytesSkipped,
+	})
+}
+
+func (p *restoreProgressPrinter) Update(s restoreui.State, _ time.Duration)         { p.report(s) }
+func (p *restoreProgressPrinter) Finish(s restoreui.State, _ time.Duration)         { p.report(s) }
+func (p *restoreProgressPrinter) Error(_ string, err error) error                   { return err }
+func (p *restoreProgressPrinter) CompleteItem(restoreui.ItemAction, string, uint64) {}
+
+// Restore restores the snapshot with the given ID to opts.Target. The ID may
+// be abbreviated, "latest" selects the newest snapshot. A subfolder of the
+// snapshot can be selected using the syntax "<snapshot>:<subfolder>".
+func (r *Repository) Restore(ctx context.Context, snapshotID string, opts RestoreOptions) error {
+	if opts.Target == "" {
+		return errors.New("no target directory given")
+	}
+	if opts.Overwrite < OverwriteAlways || opts.Overwrite > OverwriteNever {
+		return errors.Errorf("invalid overwrite behavior %d", opts.Overwrite)
+	}
+
+	ctx, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sn, subfolder, err := (&restic.SnapshotFilter{}).FindLatest(ctx, r.repo, r.repo, snapshotID)
+	if err != nil {
+		return err
+	}
+	if err := r.repo.LoadIndex(ctx, nil); err != nil {
+		return err
+	}
+	sn.Tree, err = restic.FindTreeDirectory(ctx, r.repo, sn.Tree, subfolder)
+	if err != nil {
+		return err
+	}
+
+	progress := restoreui.NewProgress(&restoreProgressPrinter{fn: opts.Progress}, restoreProgressInterval)
+	if opts.Events != nil {
+		progress.SetEventSink(eventSink{sink: opts.Events})
+	}
+	res := restorer.NewRestorer(r.repo, sn, restorer.Options{
+		Progress:  progress,
+		Overwrite: restorer.OverwriteBehavior(opts.Overwrite),
+	})
+
+	failed := false
+	res.Error = func(item string, err error) error {
+		failed = true
+		if opts.Events != nil {
+			if serr := opts.Events.Error(item, err); serr != nil {
+				return serr
+			}
+		}
+		if opts.Error != nil {
+			return opts.Error(item, err)
+		}
+		return nil
+	}
+	res.Warn = func(message string) {
+		r.warnf("%s\n", message)
+	}
+
+	_, err = res.RestoreTo(ctx, opts.Target)
+	if err != nil {
+		// the restore was aborted, don't report a summary
+		progress.SetEventSink(nil)
+		progress.Finish()
+		return err
+	}
+	progress.Finish()
+	if failed {
+		return ErrIncomplete
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package restic
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// Snapshot describes a snapshot stored in the repository.
+type Snapshot struct {
+	// ID is the full ID of the snapshot as a hex string.
+	ID       string
+	Time     time.Time
+	Hostname string
+	Username string
+	Paths    []string
+	Tags     []string
+	// Parent is the ID of the snapshot used as parent, or empty.
+	Parent string
+}
+
+func newSnapshot(id restic.ID, sn *restic.Snapshot) Snapshot {
+	s := Snapshot{
+		ID:       id.String(),
+		Time:     sn.Time,
+		Hostname: sn.Hostname,
+		Username: sn.Username,
+		Paths:    sn.Paths,
+		Tags:     sn.Tags,
+	}
+	if sn.Parent != nil {
+		s.Parent = sn.Parent.String()
+	}
+	return s
+}
+
+// SnapshotFilter selects snapshots. Empty fields match all snapshots.
+type SnapshotFilter struct {
+	// Hosts matches snapshots created on any of the hosts.
+	Hosts []string
+	// Tags matches snapshots which have all of the tags.
+	Tags []string
+	// Paths matches snapshots which contain all of the paths.
+	Paths []string
+}
+
+func (f SnapshotFilter) internal() *restic.SnapshotFilter {
+	filter := &restic.SnapshotFilter{
+		Hosts: f.Hosts,
+		Paths: f.Paths,
+	}
+	if len(f.Tags) > 0 {
+		filter.Tags = restic.TagLists{restic.TagList(f.Tags)}
+	}
+	return filter
+}
+
+// Snapshots returns all snapshots matching the filter, sorted by time with
+// the oldest snapshot first.
+func (r *Repository) Snapshots(ctx context.Context, filter SnapshotFilter) ([]Snapshot, error) {
+	ctx, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var snapshots []Snapshot
+	err = filter.internal().FindAll(ctx, r.repo, r.repo, nil, func(_ string, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		snapshots = append(snapshots, newSnapshot(*sn.ID(), sn))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}